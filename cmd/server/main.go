@@ -3,14 +3,20 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 
+	"stockmarket/internal/ai"
 	"stockmarket/internal/api"
 	"stockmarket/internal/config"
 	"stockmarket/internal/db"
+	"stockmarket/internal/indicators"
+	"stockmarket/internal/logging"
+	"stockmarket/internal/market"
 	"stockmarket/internal/web"
 )
 
@@ -20,23 +26,81 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	logging.Setup(cfg.LogLevel, cfg.LogFormat)
+	ai.OllamaBaseURL = cfg.OllamaBaseURL
+	ai.SetRequestTimeout(cfg.AnalyzeTimeout)
+	if cfg.AnalyzeTimeout < cfg.QuoteTimeout+cfg.HistoricalTimeout {
+		slog.Warn("ANALYZE_TIMEOUT is shorter than QUOTE_TIMEOUT plus HISTORICAL_TIMEOUT; slow market data can use up an analysis's time before the AI call",
+			"analyze_timeout", cfg.AnalyzeTimeout, "quote_timeout", cfg.QuoteTimeout, "historical_timeout", cfg.HistoricalTimeout)
+	}
+	for prefix, price := range cfg.AIModelPrices {
+		ai.SetModelPrice(prefix, ai.ModelPrice{Input: price.Input, Output: price.Output})
+	}
+	if err := ai.LoadPromptTemplates(cfg.PromptTemplatesDir); err != nil {
+		fatal("invalid PROMPT_TEMPLATES_DIR", "error", err)
+	}
+	for _, rule := range cfg.AnalysisModelRules {
+		if err := ai.ValidateModel(rule.Provider, rule.Model); err != nil {
+			fatal("invalid ANALYSIS_MODEL_RULES", "error", err)
+		}
+	}
+	var ensemble []ai.EnsembleMember
+	for _, member := range cfg.EnsembleMembers {
+		if err := ai.ValidateModel(member.Provider, member.Model); err != nil || member.Provider == "ensemble" {
+			fatal("invalid AI_ENSEMBLE_MEMBERS", "provider", member.Provider, "model", member.Model, "error", err)
+		}
+		ensemble = append(ensemble, ai.EnsembleMember{Provider: member.Provider, Model: member.Model, APIKey: cfg.ProviderAPIKeys[ai.CanonicalProvider(member.Provider)], Weight: member.Weight})
+	}
+	ai.SetEnsemble(ensemble, cfg.EnsembleMemberTimeout)
+	market.ClockSkewThreshold = cfg.ProviderClockSkewThreshold
+	market.RetryAttempts = cfg.ProviderRetryAttempts
+	market.RetryBaseDelay = cfg.ProviderRetryBaseDelay
+	market.RateLimitWait = cfg.ProviderRateLimitWait
+	for name, limit := range cfg.ProviderRateLimits {
+		if !slices.Contains(market.Providers, name) {
+			fatal("invalid PROVIDER_RATE_LIMITS: unknown provider", "provider", name)
+		}
+		market.SetRateLimit(name, limit.Count, limit.Interval, limit.Burst)
+	}
+	market.StreamInterval = cfg.StreamPollInterval
+	market.ExtendedHours = cfg.MarketExtendedHours
+	market.MarketHolidays = cfg.MarketHolidays
+	market.BinanceBaseURL = cfg.BinanceBaseURL
+	market.MockSeed = cfg.MockSeed
+	if !slices.Contains(market.Providers, cfg.CryptoProvider) {
+		fatal("invalid CRYPTO_PROVIDER: unknown provider", "provider", cfg.CryptoProvider)
+	}
+	indicators.LevelClusterTolerance = cfg.LevelClusterTolerance
 
 	// Initialize database
 	database, err := db.New(cfg.DatabasePath)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal("failed to initialize database", "error", err)
 	}
 	defer database.Close()
 
-	// Create templ handlers (new type-safe components)
-	templHandlers := web.NewTemplHandlers(database)
-
 	// Create API server
 	apiServer := api.NewServer(database, cfg)
+	ai.UsageRecorder = apiServer.RecordUsage
+	market.CallRecorder = apiServer.RecordMarketCall
+	apiServer.CheckStoredSecrets()
+	if err := apiServer.LoadStoredPromptTemplates(); err != nil {
+		slog.Error("failed to load stored prompt templates", "error", err)
+	}
+
+	// Create templ handlers (new type-safe components)
+	templHandlers := web.NewTemplHandlers(database, apiServer)
 
 	// Start background polling service for alerts
 	pollingCtx, pollingCancel := context.WithCancel(context.Background())
+	jobsCtx, jobsCancel := context.WithCancel(pollingCtx)
+	apiServer.StartJobWorkers(jobsCtx)
 	apiServer.StartPollingService(pollingCtx)
+	apiServer.StartProviderHealthProbe(pollingCtx)
+	apiServer.StartDigestScheduler(pollingCtx)
+	apiServer.StartAutoAnalysisScheduler(pollingCtx)
+	apiServer.StartAlertExpirySweep(pollingCtx)
+	apiServer.StartDeletedPurge(pollingCtx)
 
 	// Setup routes
 	mux := http.NewServeMux()
@@ -57,17 +121,20 @@ func main() {
 	mux.HandleFunc("/settings", templHandlers.Settings)
 
 	// Partial routes for HTMX
-	mux.HandleFunc("/partials/watchlist", templHandlers.PartialWatchlist)
-	mux.HandleFunc("/partials/recommendations", templHandlers.PartialRecommendations)
-	mux.HandleFunc("/partials/recommendations-list", templHandlers.PartialRecommendationsList)
-	mux.HandleFunc("/partials/analysis-history", templHandlers.PartialAnalysisHistory)
+	mux.HandleFunc("/partials/watchlist", api.ETag(templHandlers.PartialWatchlist))
+	mux.HandleFunc("/partials/recommendations", api.ETag(templHandlers.PartialRecommendations))
+	mux.HandleFunc("/partials/recommendations-list", api.ETag(templHandlers.PartialRecommendationsList))
+	mux.HandleFunc("/partials/analysis-history", api.ETag(templHandlers.PartialAnalysisHistory))
 	mux.HandleFunc("/partials/analysis-detail/", templHandlers.PartialAnalysisDetail)
 	mux.HandleFunc("/partials/alerts-list", templHandlers.PartialAlertsList)
 	mux.HandleFunc("/partials/quick-analyze", templHandlers.PartialQuickAnalyze)
 	mux.HandleFunc("/partials/watchlist-alert-buttons", templHandlers.PartialWatchlistAlertButtons)
+	mux.HandleFunc("/partials/symbol-search", templHandlers.PartialSymbolSearch)
 
-	// Add CORS middleware
-	handler := corsMiddleware(mux)
+	// Add CORS, request ID, request logging, compression, API key and rate limit
+	// middleware; CORS runs first so preflights aren't rejected, and rejected requests
+	// are still logged
+	handler := apiServer.CORS(api.RequestID(api.LogRequests(apiServer.Compress(apiServer.RequireAPIKey(apiServer.RateLimit(apiServer.ResolveProfile(mux)))))))
 
 	// Create HTTP server
 	httpServer := &http.Server{
@@ -76,35 +143,37 @@ func main() {
 	}
 
 	// Graceful shutdown
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
+
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
 
-		log.Println("Shutting down server...")
-		pollingCancel() // Stop polling service
+		slog.Info("shutting down server")
 		httpServer.Close()
+
+		// Stop the job workers so no new notifications are queued, flush the ones
+		// already queued, then cancel the polling service
+		jobsCancel()
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.NotifyDrainTimeout)
+		apiServer.DrainNotifications(drainCtx)
+		drainCancel()
+		pollingCancel()
 	}()
 
-	log.Printf("Starting server on port %s", cfg.Port)
-	log.Printf("Environment: %s", cfg.Environment)
+	slog.Info("starting server", "port", cfg.Port, "environment", cfg.Environment)
 	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
-		log.Fatalf("Server failed: %v", err)
+		fatal("server failed", "error", err)
 	}
-}
-
-// corsMiddleware adds CORS headers to responses
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, HX-Request, HX-Target, HX-Trigger")
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+	// Wait for the shutdown sequence to finish before closing the database
+	<-shutdownDone
+}
 
-		next.ServeHTTP(w, r)
-	})
+// fatal logs an error and exits, for startup failures once logging is set up
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -6,9 +6,8 @@ require (
 	github.com/a-h/templ v0.3.977
 	github.com/gorilla/websocket v1.5.1
 	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/scmhub/calendar v0.0.0-20250305134741-bdfe49f3f914
+	golang.org/x/sync v0.16.0
 )
 
-require (
-	github.com/scmhub/calendar v0.0.0-20250305134741-bdfe49f3f914 // indirect
-	golang.org/x/net v0.42.0 // indirect
-)
+require golang.org/x/net v0.42.0 // indirect
@@ -2,16 +2,23 @@ package ai
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
+	"stockmarket/internal/apperr"
+	"stockmarket/internal/market"
 	"stockmarket/internal/models"
 )
 
-// Shared HTTP client with optimized transport for all AI providers
+// Shared HTTP client with optimized transport for all AI providers. Its timeout is
+// the default for ANALYZE_TIMEOUT; see SetRequestTimeout.
 var sharedHTTPClient = &http.Client{
 	Timeout: 60 * time.Second,
 	Transport: &http.Transport{
@@ -26,79 +33,430 @@ var sharedHTTPClient = &http.Client{
 	},
 }
 
+// SetRequestTimeout bounds each AI provider request, streamed replies included. Call it
+// before serving requests.
+func SetRequestTimeout(d time.Duration) {
+	sharedHTTPClient.Timeout = d
+}
+
 // Analyzer defines the interface for AI analysis providers
 type Analyzer interface {
 	Analyze(ctx context.Context, req models.AnalysisRequest) (*models.AnalysisResponse, error)
 	Name() string
+	Model() string
+}
+
+// Completer is implemented by analyzers that can answer free-form prompts,
+// used for auxiliary steps such as summarizing earnings-call transcripts
+type Completer interface {
+	Complete(ctx context.Context, prompt string) (string, error)
+}
+
+// KeyVerifier is implemented by analyzers that can check their API key with a cheap
+// authenticated request that generates nothing, such as listing models
+type KeyVerifier interface {
+	VerifyKey(ctx context.Context) error
 }
 
 // ErrNoAPIKey is returned when no API key is configured
-var ErrNoAPIKey = errors.New("no API key configured")
+var ErrNoAPIKey = apperr.New(apperr.MissingAPIKey, "no API key configured")
+
+// ErrInvalidAPIKey is returned when the AI provider rejects the API key
+var ErrInvalidAPIKey = apperr.New(apperr.ProviderUnauthorized, "API key rejected")
 
 // ErrAnalysisFailed is returned when analysis fails
-var ErrAnalysisFailed = errors.New("analysis failed")
+var ErrAnalysisFailed = apperr.New(apperr.AIError, "analysis failed")
+
+// ErrInvalidAnalysis is returned when the AI response is missing required fields or has invalid values
+var ErrInvalidAnalysis = apperr.Wrap(apperr.AIError, ErrAnalysisFailed, "invalid response")
+
+// ErrRateLimited is returned when the AI provider rejects a request for exceeding its rate limit
+var ErrRateLimited = apperr.Wrap(apperr.RateLimited, ErrAnalysisFailed, "rate limited")
+
+// ErrOverloaded is returned when the AI provider is temporarily too busy to serve a request
+var ErrOverloaded = apperr.Wrap(apperr.AIUnavailable, ErrAnalysisFailed, "provider overloaded")
+
+// requestError reports a request to an AI provider that got no reply as a failed
+// analysis, unless ctx ended first, which is reported as is
+func requestError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrAnalysisFailed, err)
+}
+
+// verifyKeyRequest sends a key check and reports how the provider took it. The check
+// asks for nothing the key could lack, so any client error other than a rate limit
+// means the key was refused.
+func verifyKeyRequest(ctx context.Context, client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	// Providers put the reason in either {"error": {"message": ...}} or {"error": ...}
+	var errResp struct {
+		Error json.RawMessage `json:"error"`
+	}
+	var detail struct {
+		Message string `json:"message"`
+	}
+	message := http.StatusText(resp.StatusCode)
+	if json.NewDecoder(resp.Body).Decode(&errResp) == nil && len(errResp.Error) > 0 {
+		if json.Unmarshal(errResp.Error, &detail) == nil && detail.Message != "" {
+			message = detail.Message
+		} else if json.Unmarshal(errResp.Error, &message) != nil {
+			message = http.StatusText(resp.StatusCode)
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return fmt.Errorf("%w: %s", ErrInvalidAPIKey, message)
+	default:
+		return fmt.Errorf("%w: %s", ErrAnalysisFailed, message)
+	}
+}
+
+// validActions are the actions an analysis may recommend
+var validActions = map[string]bool{
+	"BUY":   true,
+	"SELL":  true,
+	"HOLD":  true,
+	"WATCH": true,
+}
+
+// ValidAction reports whether action is one an analysis may recommend
+func ValidAction(action string) bool {
+	return validActions[action]
+}
+
+// Detail levels control how long the analysis reasoning is, trading cost for depth
+const (
+	DetailBrief    = "brief"
+	DetailStandard = "standard"
+	DetailDetailed = "detailed"
+)
+
+// detailLevel is the output budget and reasoning instruction for a detail level
+type detailLevel struct {
+	maxTokens   int
+	instruction string
+}
+
+// detailLevels are the allowed detail levels. Output tokens are the expensive side
+// of a completion, so brief costs well under half of standard and detailed about
+// two and a half times as much.
+var detailLevels = map[string]detailLevel{
+	DetailBrief: {
+		maxTokens:   400,
+		instruction: "Keep the reasoning to one short paragraph and list at most two risks.",
+	},
+	DetailStandard: {
+		maxTokens: 1000,
+	},
+	DetailDetailed: {
+		maxTokens:   2500,
+		instruction: `Write the reasoning as a detailed report with "Technicals:", "Fundamentals:" and "Risks:" sections, each a full paragraph.`,
+	},
+}
+
+// defaultMaxTokens is the output budget for standard analyses and free-form completions
+const defaultMaxTokens = 1000
+
+// ValidDetailLevel reports whether level is an allowed detail level; "" means standard
+func ValidDetailLevel(level string) bool {
+	_, ok := detailLevels[level]
+	return ok || level == ""
+}
+
+// maxTokens is the output token budget for an analysis at a detail level
+func maxTokens(level string) int {
+	if dl, ok := detailLevels[level]; ok {
+		return dl.maxTokens
+	}
+	return defaultMaxTokens
+}
+
+// Providers lists the registered AI provider names
+var Providers = []string{"openai", "claude", "gemini", "ollama", "mock", "ensemble"}
+
+// providerAliases are alternative names accepted for registered providers
+var providerAliases = map[string]string{
+	"anthropic": "claude",
+}
+
+// CanonicalProvider resolves a provider alias such as "anthropic" to its registered
+// name; other names are returned unchanged
+func CanonicalProvider(name string) string {
+	if canonical, ok := providerAliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// RequiresAPIKey reports whether the named AI provider needs an API key. The ensemble's
+// members use the server-configured keys.
+func RequiresAPIKey(name string) bool {
+	return name != "ollama" && name != "mock" && name != "ensemble"
+}
+
+// modelFamilies are the model-name prefixes each cloud provider serves
+var modelFamilies = map[string]string{
+	"openai": "gpt-",
+	"claude": "claude-",
+	"gemini": "gemini-",
+}
+
+// ValidateModel checks that a provider is registered and that model is one of its
+// models in the price table. Local models can't be checked and only need a name, and
+// the mock analyzer takes any name, as does the ensemble, whose members pick their own.
+func ValidateModel(provider, model string) error {
+	provider = CanonicalProvider(provider)
+	if provider == "mock" || provider == "ensemble" {
+		return nil
+	}
+	if provider == "ollama" {
+		if model == "" {
+			return errors.New("ollama requires a model name")
+		}
+		return nil
+	}
+	family, ok := modelFamilies[provider]
+	if !ok {
+		return errors.New("unknown AI provider: " + provider)
+	}
+	if provider == "claude" {
+		model = claudeModel(model)
+	}
+	if !strings.HasPrefix(model, family) {
+		return fmt.Errorf("model %q is not a %s model", model, provider)
+	}
+	for prefix := range modelPrices {
+		if strings.HasPrefix(model, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %q is not registered", model)
+}
+
+// KnownModels lists the price-table models a cloud provider serves, sorted; it's empty
+// for local providers, whose models can't be checked
+func KnownModels(provider string) []string {
+	family, ok := modelFamilies[CanonicalProvider(provider)]
+	if !ok {
+		return nil
+	}
+	var known []string
+	for prefix := range modelPrices {
+		if strings.HasPrefix(prefix, family) {
+			known = append(known, prefix)
+		}
+	}
+	sort.Strings(known)
+	return known
+}
 
 // NewAnalyzer creates an AI analyzer based on the provider name
 func NewAnalyzer(provider string, apiKey string, model string) (Analyzer, error) {
-	switch provider {
+	switch CanonicalProvider(provider) {
 	case "openai":
 		return NewOpenAI(apiKey, model), nil
 	case "claude":
 		return NewClaude(apiKey, model), nil
 	case "gemini":
 		return NewGemini(apiKey, model), nil
+	case "ollama":
+		return NewOllama(model), nil
+	case "mock":
+		return NewMock(model), nil
+	case "ensemble":
+		return NewEnsemble()
 	default:
 		return nil, errors.New("unknown AI provider: " + provider)
 	}
 }
 
-// BuildPrompt creates the analysis prompt based on risk profile and trade frequency
+// riskReviewInstruction turns an analysis into an exit decision for a holder during a drawdown
+const riskReviewInstruction = `This is a risk review: the user holds this stock during a sharp market drawdown and wants to know whether to exit now. Weigh the downside first: how far the price could still fall, broken support, momentum and event risk. Recommend "SELL" if the position should be closed now and "HOLD" otherwise, with confidence reflecting how sure you are of that call; set "stop_loss" to the level that would invalidate holding.`
+
+// cryptoInstruction keeps the model from reasoning about a crypto pair as if it were a stock
+const cryptoInstruction = `This is a cryptocurrency pair, not a stock: it trades around the clock, so there are no sessions, earnings, dividends or filings, and "today's range" is a rolling 24-hour window. Don't cite earnings or company fundamentals; weigh price action, volatility, liquidity and broad crypto market sentiment instead.`
+
+// BuildPrompt creates the analysis prompt from the template for the request's risk
+// profile and trade frequency; see LoadPromptTemplates
 func BuildPrompt(req models.AnalysisRequest) string {
-	riskProfile := models.RiskProfiles[req.RiskProfile]
-	freqProfile := models.TradeFrequencyProfiles[req.TradeFrequency]
+	return renderPrompt(req)
+}
 
-	prompt := `You are an expert stock market analyst. Analyze the following stock data and provide a trading recommendation.
+// formatPosition describes the user's holding so the recommendation can weigh adding, trimming or holding
+func formatPosition(p models.Position, currentPrice float64, currency string) string {
+	pnl := (currentPrice - p.AvgCost) * p.Quantity
+	pnlPct := 0.0
+	if p.AvgCost > 0 {
+		pnlPct = (currentPrice/p.AvgCost - 1) * 100
+	}
+	return fmt.Sprintf(`
+Current Position: %s shares at an average cost of %s (unrealized P&L %s, %+.2f%%)
+The user already holds this stock; frame the recommendation as whether to add to, trim, or hold the position.
+`, formatFloat(p.Quantity), market.FormatPrice(p.AvgCost, currency), market.FormatPrice(pnl, currency), pnlPct)
+}
 
-Stock: ` + req.Symbol + `
-Current Price: $` + formatFloat(req.CurrentPrice) + `
+// formatLevels lists detected support/resistance levels, most significant first
+func formatLevels(levels []models.PriceLevel, currency string) string {
+	summary := "\nKey Price Levels (from swing highs/lows):\n"
+	for _, l := range levels {
+		summary += fmt.Sprintf("- %s at %s (%d touches)\n", l.Kind, market.FormatPrice(l.Price, currency), l.Touches)
+	}
+	return summary
+}
 
-Risk Profile: ` + riskProfile.Name + `
-` + riskProfile.PromptModifier + `
+// formatIndicators lists the computed technical indicators that had enough history
+func formatIndicators(ind models.Indicators) string {
+	summary := ""
+	add := func(name string, v *float64) {
+		if v != nil {
+			summary += fmt.Sprintf("- %s: %.2f\n", name, *v)
+		}
+	}
+	add("RSI(14)", ind.RSI14)
+	add("SMA(20)", ind.SMA20)
+	add("SMA(50)", ind.SMA50)
+	add("EMA(12)", ind.EMA12)
+	add("EMA(26)", ind.EMA26)
+	add("MACD(12,26)", ind.MACD)
+	add("MACD signal(9)", ind.MACDSignal)
+	add("MACD histogram", ind.MACDHist)
+	if summary == "" {
+		return ""
+	}
+	return "\nTechnical Indicators (computed from the historical data):\n" + summary
+}
 
-Trading Timeframe: ` + freqProfile.Name + `
-Analysis Window: ` + freqProfile.AnalysisWindow + `
-Signal Sensitivity: ` + freqProfile.SignalSensitivity + `
+// formatVWAP gives the session VWAP as an intraday reference level
+func formatVWAP(vwap, currentPrice float64, currency string) string {
+	side := "above"
+	if currentPrice < vwap {
+		side = "below"
+	}
+	return fmt.Sprintf("\nSession VWAP (from today's intraday bars): %s; the current price is %.2f%% %s it\n",
+		market.FormatPrice(vwap, currency), math.Abs(currentPrice/vwap-1)*100, side)
+}
 
-Historical Data (most recent ` + formatInt(len(req.HistoricalData)) + ` periods):
-`
+// formatBenchmark frames the symbol's recent move and beta against the benchmark
+func formatBenchmark(symbol string, b models.BenchmarkComparison) string {
+	summary := "\nBenchmark Comparison (" + b.Symbol + "):\n"
+	if b.BenchmarkReturn != nil {
+		summary += fmt.Sprintf("- %s 1-month return: %+.2f%%\n", b.Symbol, *b.BenchmarkReturn)
+	}
+	if b.SymbolReturn != nil {
+		summary += fmt.Sprintf("- %s 1-month return: %+.2f%%\n", symbol, *b.SymbolReturn)
+	}
+	if b.Beta != nil {
+		summary += fmt.Sprintf("- Beta vs %s: %.2f\n", b.Symbol, *b.Beta)
+	}
+	if b.RelativeStrength != nil {
+		verdict := "outperforming"
+		if *b.RelativeStrength < 0 {
+			verdict = "underperforming"
+		}
+		summary += fmt.Sprintf("- Relative strength over %s: %+.2f points (%s)\n", b.Period, *b.RelativeStrength, verdict)
+	}
+	summary += "Express the expected move relative to the benchmark, weigh whether the symbol is leading or lagging it, and weigh the beta when judging risk.\n"
+	return summary
+}
 
-	// Add historical data summary
-	if len(req.HistoricalData) > 0 {
-		prompt += formatHistoricalSummary(req.HistoricalData)
+// formatSession describes the day's range, change, volume and spread from a quote,
+// leaving out whatever the provider didn't supply
+func formatSession(q *models.Quote, currency string) string {
+	if q == nil {
+		return ""
+	}
+	price := func(amount float64) string { return market.FormatPrice(amount, currency) }
+	var summary string
+	if q.Open > 0 && q.High > 0 && q.Low > 0 {
+		summary += fmt.Sprintf("Today's Range: Open %s, High %s, Low %s\n", price(q.Open), price(q.High), price(q.Low))
+	}
+	if q.PreviousClose > 0 {
+		summary += fmt.Sprintf("Previous Close: %s (day change %+.2f%%)\n", price(q.PreviousClose), q.ChangePercent)
+	}
+	if q.Volume > 0 {
+		summary += fmt.Sprintf("Volume Today: %d\n", q.Volume)
+	}
+	if q.Bid > 0 && q.Ask >= q.Bid {
+		summary += fmt.Sprintf("Bid/Ask: %s / %s (spread %.2f%%)\n", price(q.Bid), price(q.Ask), (q.Ask-q.Bid)/q.Ask*100)
 	}
+	return summary
+}
 
-	if req.UserContext != "" {
-		prompt += "\nUser Notes: " + req.UserContext + "\n"
+// formatYearRange describes where the current price sits in its 52-week range
+func formatYearRange(req models.AnalysisRequest, currency string) string {
+	if req.FiftyTwoWeekHigh <= 0 || req.FiftyTwoWeekLow <= 0 {
+		return "52-Week Range: not available"
 	}
+	fromHigh := (req.FiftyTwoWeekHigh - req.CurrentPrice) / req.FiftyTwoWeekHigh * 100
+	return fmt.Sprintf("52-Week Range: %s - %s (%.1f%% below 52-week high)",
+		market.FormatPrice(req.FiftyTwoWeekLow, currency), market.FormatPrice(req.FiftyTwoWeekHigh, currency), fromHigh)
+}
 
-	prompt += `
-Provide your analysis in the following JSON format:
-{
-  "action": "BUY" | "SELL" | "HOLD" | "WATCH",
-  "confidence": 0.0-1.0,
-  "reasoning": "detailed explanation",
-  "price_targets": {
-    "entry": price,
-    "target": price,
-    "stop_loss": price
-  },
-  "risks": ["risk1", "risk2"],
-  "timeframe": "expected time horizon"
+// shortTermWeights is the weight each trade frequency puts on its shortest timeframe;
+// the longest gets the rest and any in between are interpolated
+var shortTermWeights = map[string]float64{
+	"daily":  0.7,
+	"weekly": 0.5,
+	"swing":  0.3,
 }
 
-Respond ONLY with valid JSON, no additional text.`
+// timeframeEmphasis tells the model which horizon leads for each trade frequency
+var timeframeEmphasis = map[string]string{
+	"daily":  "As a day trader's analysis, let short-term signals lead and use longer timeframes as context.",
+	"weekly": "Balance short-term momentum against the longer-term trend.",
+	"swing":  "As a swing trader's analysis, let the longer-term trend lead and treat short-term moves as entry timing.",
+}
 
-	return prompt
+// WeightTimeframes sets each timeframe's weight for a trade frequency. Timeframes must
+// be ordered shortest first; day traders weight short-term ones heavier and swing
+// traders long-term ones. Weights sum to 1.
+func WeightTimeframes(timeframes []models.TimeframeData, tradeFrequency string) {
+	if len(timeframes) == 1 {
+		timeframes[0].Weight = 1
+		return
+	}
+	short, ok := shortTermWeights[tradeFrequency]
+	if !ok {
+		short = shortTermWeights["weekly"]
+	}
+	var total float64
+	for i := range timeframes {
+		timeframes[i].Weight = short + (1-2*short)*float64(i)/float64(len(timeframes)-1)
+		total += timeframes[i].Weight
+	}
+	for i := range timeframes {
+		timeframes[i].Weight /= total
+	}
+}
+
+// formatTimeframes summarizes each timeframe with its weight and asks the model to
+// reconcile them, leaning on the horizon the trade frequency cares about
+func formatTimeframes(timeframes []models.TimeframeData, tradeFrequency, currency string) string {
+	summary := "\nMulti-Timeframe Data (shortest first):\n"
+	for _, tf := range timeframes {
+		summary += fmt.Sprintf("\n[%s timeframe, %d periods", tf.Period, len(tf.Candles))
+		if tf.Weight > 0 {
+			summary += fmt.Sprintf(", weight %.0f%%", tf.Weight*100)
+		}
+		summary += "]\n" + formatHistoricalSummary(tf.Candles, currency)
+	}
+	summary += "\nSynthesize across all timeframes: note where shorter and longer timeframes agree or conflict, and weigh that in your recommendation and confidence."
+	if emphasis, ok := timeframeEmphasis[tradeFrequency]; ok {
+		summary += " Weight each timeframe's signals by its weight. " + emphasis
+	}
+	return summary + "\n"
 }
 
 func formatFloat(f float64) string {
@@ -109,7 +467,7 @@ func formatInt(i int) string {
 	return fmt.Sprintf("%d", i)
 }
 
-func formatHistoricalSummary(candles []models.Candle) string {
+func formatHistoricalSummary(candles []models.Candle, currency string) string {
 	if len(candles) == 0 {
 		return "No historical data available\n"
 	}
@@ -137,14 +495,14 @@ func formatHistoricalSummary(candles []models.Candle) string {
 	oldestClose := candles[len(candles)-1].Close
 	priceChange := ((latestClose - oldestClose) / oldestClose) * 100
 
-	summary := fmt.Sprintf(`Period High: $%.2f
-Period Low: $%.2f
-Latest Close: $%.2f
+	summary := fmt.Sprintf(`Period High: %s
+Period Low: %s
+Latest Close: %s
 Price Change: %.2f%%
 Average Volume: %d
 
 Recent candles:
-`, high, low, latestClose, priceChange, avgVolume)
+`, market.FormatPrice(high, currency), market.FormatPrice(low, currency), market.FormatPrice(latestClose, currency), priceChange, avgVolume)
 
 	// Show last 5 candles
 	count := 5
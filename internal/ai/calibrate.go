@@ -0,0 +1,49 @@
+package ai
+
+import "stockmarket/internal/models"
+
+// RSI levels past which a BUY is chasing an overbought move or a SELL an oversold one
+const (
+	calibrationOverbought = 70.0
+	calibrationOversold   = 30.0
+)
+
+// calibrationPenalty is the share of confidence removed for each indicator that
+// contradicts the action
+const calibrationPenalty = 0.15
+
+// Calibrate scales a BUY or SELL's confidence down for each computed indicator that
+// disagrees with it: RSI overbought (BUY) or oversold (SELL), price on the wrong side
+// of its 50-day SMA, and a MACD histogram pointing the other way. Agreement never
+// raises confidence, HOLD and WATCH are left alone and the action never changes. The
+// model's own confidence is kept in RawConfidence.
+func Calibrate(analysis models.AnalysisResponse, indicators models.Indicators) models.AnalysisResponse {
+	raw := analysis.Confidence
+	analysis.RawConfidence = &raw
+
+	var direction float64
+	switch analysis.Action {
+	case "BUY":
+		direction = 1
+	case "SELL":
+		direction = -1
+	default:
+		return analysis
+	}
+
+	conflicts := 0
+	if rsi := indicators.RSI14; rsi != nil {
+		if direction > 0 && *rsi >= calibrationOverbought || direction < 0 && *rsi <= calibrationOversold {
+			conflicts++
+		}
+	}
+	if sma := indicators.SMA50; sma != nil && analysis.Price > 0 && (analysis.Price-*sma)*direction < 0 {
+		conflicts++
+	}
+	if hist := indicators.MACDHist; hist != nil && *hist*direction < 0 {
+		conflicts++
+	}
+
+	analysis.Confidence = raw * (1 - calibrationPenalty*float64(conflicts))
+	return analysis
+}
@@ -0,0 +1,47 @@
+package ai
+
+import (
+	"math"
+	"testing"
+
+	"stockmarket/internal/models"
+)
+
+func ptr(v float64) *float64 { return &v }
+
+func TestCalibrate(t *testing.T) {
+	bearish := models.Indicators{RSI14: ptr(78), SMA50: ptr(110), MACDHist: ptr(-0.4)}
+	bullish := models.Indicators{RSI14: ptr(55), SMA50: ptr(90), MACDHist: ptr(0.4)}
+	cases := []struct {
+		name       string
+		action     string
+		indicators models.Indicators
+		want       float64
+	}{
+		{"BUY against every indicator", "BUY", bearish, 0.9 * 0.55},
+		{"BUY with every indicator", "BUY", bullish, 0.9},
+		{"SELL against every indicator", "SELL", models.Indicators{RSI14: ptr(25), SMA50: ptr(90), MACDHist: ptr(0.4)}, 0.9 * 0.55},
+		{"SELL with the bearish ones", "SELL", bearish, 0.9},
+		{"BUY overbought only", "BUY", models.Indicators{RSI14: ptr(70)}, 0.9 * 0.85},
+		{"no indicators", "BUY", models.Indicators{}, 0.9},
+		{"HOLD is left alone", "HOLD", bearish, 0.9},
+	}
+	for _, c := range cases {
+		got := Calibrate(models.AnalysisResponse{Action: c.action, Confidence: 0.9, Price: 100}, c.indicators)
+		if math.Abs(got.Confidence-c.want) > 1e-9 {
+			t.Errorf("%s: confidence = %v, want %v", c.name, got.Confidence, c.want)
+		}
+		if got.Action != c.action {
+			t.Errorf("%s: action changed to %s", c.name, got.Action)
+		}
+		if got.RawConfidence == nil || *got.RawConfidence != 0.9 {
+			t.Errorf("%s: raw confidence = %v, want the model's 0.9", c.name, got.RawConfidence)
+		}
+	}
+
+	// Without a price the SMA can't be compared
+	got := Calibrate(models.AnalysisResponse{Action: "BUY", Confidence: 0.8}, models.Indicators{SMA50: ptr(110)})
+	if got.Confidence != 0.8 {
+		t.Errorf("no price: confidence = %v, want 0.8", got.Confidence)
+	}
+}
@@ -5,13 +5,40 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"stockmarket/internal/models"
 )
 
 const claudeBaseURL = "https://api.anthropic.com/v1/messages"
 
+// claudeDefaultModel is used when no model is configured
+const claudeDefaultModel = "claude-sonnet-4-20250514"
+
+// claudeModelAliases map short family names to current Claude models. Full names,
+// dated snapshots and Anthropic's own "-latest" aliases are sent unchanged.
+var claudeModelAliases = map[string]string{
+	"claude-opus":   "claude-opus-4-20250514",
+	"claude-sonnet": "claude-sonnet-4-20250514",
+	"claude-haiku":  "claude-3-5-haiku-latest",
+}
+
+// claudeStatusOverloaded is Anthropic's non-standard status for an overloaded API
+const claudeStatusOverloaded = 529
+
+// claudeModel maps a configured model name to the Claude model to request
+func claudeModel(model string) string {
+	if model == "" {
+		return claudeDefaultModel
+	}
+	if alias, ok := claudeModelAliases[model]; ok {
+		return alias
+	}
+	return model
+}
+
 // Claude implements the Analyzer interface for Anthropic Claude API
 type Claude struct {
 	apiKey string
@@ -19,14 +46,11 @@ type Claude struct {
 	client *http.Client
 }
 
-// NewClaude creates a new Claude analyzer
+// NewClaude creates a new Claude analyzer using the Anthropic Messages API
 func NewClaude(apiKey string, model string) *Claude {
-	if model == "" {
-		model = "claude-sonnet-4-20250514"
-	}
 	return &Claude{
 		apiKey: apiKey,
-		model:  model,
+		model:  claudeModel(model),
 		client: sharedHTTPClient,
 	}
 }
@@ -36,30 +60,80 @@ func (c *Claude) Name() string {
 	return "claude"
 }
 
+// Model returns the model used for completions
+func (c *Claude) Model() string {
+	return c.model
+}
+
 // Analyze performs stock analysis using Claude
 func (c *Claude) Analyze(ctx context.Context, req models.AnalysisRequest) (*models.AnalysisResponse, error) {
+	return c.AnalyzeStream(ctx, req, nil)
+}
+
+// AnalyzeStream performs stock analysis using Claude, streaming the reply to chunks;
+// a nil chunks channel waits for the whole reply instead
+func (c *Claude) AnalyzeStream(ctx context.Context, req models.AnalysisRequest, chunks chan<- string) (*models.AnalysisResponse, error) {
+	prompt := BuildPrompt(req)
+	content, usage, err := c.complete(ctx, prompt, maxTokens(req.DetailLevel), chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis, err := parseAnalysisResponse(req.Symbol, content)
+	if err != nil {
+		return nil, err
+	}
+	applyUsage(analysis, usage)
+	analysis.Prompt, analysis.RawResponse = prompt, content
+	return analysis, nil
+}
+
+// VerifyKey checks the API key by listing the available models
+func (c *Claude) VerifyKey(ctx context.Context) error {
 	if c.apiKey == "" {
-		return nil, ErrNoAPIKey
+		return ErrNoAPIKey
 	}
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(claudeBaseURL, "/messages")+"/models?limit=1", nil)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("x-api-key", c.apiKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	return verifyKeyRequest(ctx, c.client, httpReq)
+}
 
-	prompt := BuildPrompt(req)
+// Complete sends a single-turn prompt to Claude and returns the raw text reply
+func (c *Claude) Complete(ctx context.Context, prompt string) (string, error) {
+	content, _, err := c.complete(ctx, prompt, defaultMaxTokens, nil)
+	return content, err
+}
+
+// complete sends a prompt with an output token budget, streaming the reply to chunks
+// when given
+func (c *Claude) complete(ctx context.Context, prompt string, maxTokens int, chunks chan<- string) (string, models.AIUsage, error) {
+	if c.apiKey == "" {
+		return "", models.AIUsage{}, ErrNoAPIKey
+	}
 
 	requestBody := map[string]interface{}{
 		"model":      c.model,
-		"max_tokens": 1000,
+		"max_tokens": maxTokens,
 		"messages": []map[string]string{
 			{"role": "user", "content": prompt},
 		},
 	}
+	if chunks != nil {
+		requestBody["stream"] = true
+	}
 
 	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
-		return nil, err
+		return "", models.AIUsage{}, err
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", claudeBaseURL, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, err
+		return "", models.AIUsage{}, err
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
@@ -68,18 +142,28 @@ func (c *Claude) Analyze(ctx context.Context, req models.AnalysisRequest) (*mode
 
 	resp, err := c.client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return "", models.AIUsage{}, requestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		var errResp struct {
 			Error struct {
+				Type    string `json:"type"`
 				Message string `json:"message"`
 			} `json:"error"`
 		}
 		json.NewDecoder(resp.Body).Decode(&errResp)
-		return nil, fmt.Errorf("%w: %s", ErrAnalysisFailed, errResp.Error.Message)
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests || errResp.Error.Type == "rate_limit_error":
+			return "", models.AIUsage{}, fmt.Errorf("%w: %s", ErrRateLimited, errResp.Error.Message)
+		case resp.StatusCode == claudeStatusOverloaded || errResp.Error.Type == "overloaded_error":
+			return "", models.AIUsage{}, fmt.Errorf("%w: %s", ErrOverloaded, errResp.Error.Message)
+		}
+		return "", models.AIUsage{}, fmt.Errorf("%w: %s", ErrAnalysisFailed, errResp.Error.Message)
+	}
+	if chunks != nil {
+		return c.readStream(ctx, resp.Body, chunks)
 	}
 
 	var result struct {
@@ -87,15 +171,83 @@ func (c *Claude) Analyze(ctx context.Context, req models.AnalysisRequest) (*mode
 			Type string `json:"type"`
 			Text string `json:"text"`
 		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+		return "", models.AIUsage{}, err
 	}
+	usage := recordUsage(ctx, c.Name(), c.model, result.Usage.InputTokens, result.Usage.OutputTokens)
 
-	if len(result.Content) == 0 {
-		return nil, ErrAnalysisFailed
+	// Join the text blocks; a reply may be split across several
+	var text strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", usage, ErrAnalysisFailed
 	}
 
-	return parseAnalysisResponse(req.Symbol, result.Content[0].Text)
+	return text.String(), usage, nil
+}
+
+// readStream collects a streamed message, forwarding each text delta. Errors sent
+// mid-stream, such as the API becoming overloaded, fail the completion.
+func (c *Claude) readStream(ctx context.Context, body io.Reader, chunks chan<- string) (string, models.AIUsage, error) {
+	var content strings.Builder
+	var inputTokens, outputTokens int
+	err := readEventStream(body, func(data []byte) error {
+		var event struct {
+			Type    string `json:"type"`
+			Message struct {
+				Usage struct {
+					InputTokens int `json:"input_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		switch event.Type {
+		case "message_start":
+			inputTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" {
+				content.WriteString(event.Delta.Text)
+				return sendChunk(ctx, chunks, event.Delta.Text)
+			}
+		case "message_delta":
+			outputTokens = event.Usage.OutputTokens
+		case "error":
+			if event.Error.Type == "overloaded_error" {
+				return fmt.Errorf("%w: %s", ErrOverloaded, event.Error.Message)
+			}
+			return fmt.Errorf("%w: %s", ErrAnalysisFailed, event.Error.Message)
+		}
+		return nil
+	})
+	usage := recordUsage(ctx, c.Name(), c.model, inputTokens, outputTokens)
+	if err != nil {
+		return "", usage, err
+	}
+	if content.Len() == 0 {
+		return "", usage, ErrAnalysisFailed
+	}
+	return content.String(), usage, nil
 }
@@ -0,0 +1,258 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// EnsembleMember is one provider and model the ensemble analyzer consults, and how much
+// its verdict counts
+type EnsembleMember struct {
+	Provider string
+	Model    string
+	APIKey   string
+	Weight   float64
+}
+
+// The ensemble's members and how long each may take; see SetEnsemble
+var (
+	ensembleMembers       []EnsembleMember
+	ensembleMemberTimeout time.Duration
+)
+
+// SetEnsemble configures the "ensemble" provider to consult members, each given
+// memberTimeout to answer (0 gives each three quarters of the analysis's remaining
+// time). Call it before serving requests.
+func SetEnsemble(members []EnsembleMember, memberTimeout time.Duration) {
+	ensembleMembers = members
+	ensembleMemberTimeout = memberTimeout
+}
+
+// cautiousActions breaks ties between equally weighted actions, most cautious first
+var cautiousActions = []string{"HOLD", "WATCH", "SELL", "BUY"}
+
+// ensembleMember is a member with its analyzer
+type ensembleMember struct {
+	EnsembleMember
+	analyzer Analyzer
+}
+
+// Ensemble implements the Analyzer interface by sending each request to several
+// providers at once and reconciling their verdicts into one. A member that fails or
+// runs out of time is left out, and the analysis says so; it only fails when every
+// member does.
+type Ensemble struct {
+	members []ensembleMember
+	timeout time.Duration
+}
+
+// NewEnsemble creates an ensemble analyzer from the members set with SetEnsemble
+func NewEnsemble() (*Ensemble, error) {
+	if len(ensembleMembers) < 2 {
+		return nil, errors.New("the ensemble provider needs at least two AI_ENSEMBLE_MEMBERS")
+	}
+	e := &Ensemble{timeout: ensembleMemberTimeout}
+	for _, member := range ensembleMembers {
+		analyzer, err := NewAnalyzer(member.Provider, member.APIKey, member.Model)
+		if err != nil {
+			return nil, err
+		}
+		e.members = append(e.members, ensembleMember{EnsembleMember: member, analyzer: analyzer})
+	}
+	return e, nil
+}
+
+// Name returns the provider name
+func (e *Ensemble) Name() string {
+	return "ensemble"
+}
+
+// Model returns the members' providers and models, e.g. "openai/gpt-4o, claude/claude-sonnet-4-5"
+func (e *Ensemble) Model() string {
+	names := make([]string, len(e.members))
+	for i, m := range e.members {
+		names[i] = m.analyzer.Name() + "/" + m.analyzer.Model()
+	}
+	return strings.Join(names, ", ")
+}
+
+// Analyze sends the request to every member concurrently and reconciles their answers
+func (e *Ensemble) Analyze(ctx context.Context, req models.AnalysisRequest) (*models.AnalysisResponse, error) {
+	timeout := e.timeout
+	if deadline, ok := ctx.Deadline(); ok && timeout == 0 {
+		timeout = time.Until(deadline) * 3 / 4
+	}
+
+	answers := make([]*models.AnalysisResponse, len(e.members))
+	errs := make([]error, len(e.members))
+	var wg sync.WaitGroup
+	for i, m := range e.members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			memberCtx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				memberCtx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			answers[i], errs[i] = m.analyzer.Analyze(memberCtx, req)
+			if errs[i] != nil {
+				slog.WarnContext(ctx, "ensemble member failed, continuing without it",
+					"symbol", req.Symbol, "ai_provider", m.analyzer.Name(), "model", m.analyzer.Model(), "error", errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return e.reconcile(answers, errs), nil
+		}
+	}
+	return nil, fmt.Errorf("every ensemble member failed, the first with: %w", errs[0])
+}
+
+// reconcile combines the members' answers, at least one of which is non-nil. The
+// action is the one with the most weight behind it, ties going to the more cautious
+// action (one outside cautiousActions counting as the least cautious). The confidence
+// is the weighted mean over the answering members, counting dissenters as zero, so a
+// split verdict is a less confident one. Price levels and the timeframe are those of
+// the most confident agreeing member, the reasoning is each member's in turn, and the
+// risks are all of theirs. It's incomplete when any answering member's is. Usage adds
+// up.
+func (e *Ensemble) reconcile(answers []*models.AnalysisResponse, errs []error) *models.AnalysisResponse {
+	votes := make(map[string]float64)
+	var totalWeight float64
+	for i, answer := range answers {
+		if answer != nil {
+			votes[answer.Action] += e.members[i].Weight
+			totalWeight += e.members[i].Weight
+		}
+	}
+	action := ""
+	for _, answer := range answers {
+		if answer == nil {
+			continue
+		}
+		candidate := answer.Action
+		if action == "" || votes[candidate] > votes[action] || votes[candidate] == votes[action] && moreCautious(candidate, action) {
+			action = candidate
+		}
+	}
+
+	var lead *models.AnalysisResponse
+	var agreeing int
+	var weightedConfidence, leadScore float64
+	for i, answer := range answers {
+		if answer == nil || answer.Action != action {
+			continue
+		}
+		agreeing++
+		score := e.members[i].Weight * answer.Confidence
+		weightedConfidence += score
+		if lead == nil || score > leadScore {
+			lead, leadScore = answer, score
+		}
+	}
+
+	confidence := 0.0
+	if totalWeight > 0 {
+		confidence = weightedConfidence / totalWeight
+	}
+
+	answered := 0
+	incomplete := false
+	var sections, raw, failures []string
+	var verdicts []models.EnsembleVerdict
+	var risks []string
+	seenRisks := make(map[string]bool)
+	result := &models.AnalysisResponse{
+		Symbol:       lead.Symbol,
+		Action:       action,
+		Confidence:   confidence,
+		PriceTargets: lead.PriceTargets,
+		Timeframe:    lead.Timeframe,
+		GeneratedAt:  time.Now(),
+		Prompt:       lead.Prompt,
+	}
+	for i, m := range e.members {
+		verdict := models.EnsembleVerdict{Provider: m.analyzer.Name(), Model: m.analyzer.Model(), Weight: m.Weight}
+		name := verdict.Provider + "/" + verdict.Model
+		answer := answers[i]
+		if answer == nil {
+			verdict.Error = errs[i].Error()
+			verdicts = append(verdicts, verdict)
+			failures = append(failures, name+" ("+verdict.Error+")")
+			continue
+		}
+		answered++
+		incomplete = incomplete || answer.Incomplete
+		verdict.Action, verdict.Confidence = answer.Action, answer.Confidence
+		verdicts = append(verdicts, verdict)
+		sections = append(sections, fmt.Sprintf("[%s: %s at %.0f%%] %s", name, answer.Action, answer.Confidence*100, strings.TrimSpace(answer.Reasoning)))
+		if answer.RawResponse != "" {
+			raw = append(raw, "["+name+"]\n"+answer.RawResponse)
+		}
+		for _, risk := range answer.Risks {
+			if key := strings.ToLower(risk); !seenRisks[key] {
+				seenRisks[key] = true
+				risks = append(risks, risk)
+			}
+		}
+		result.PromptTokens += answer.PromptTokens
+		result.CompletionTokens += answer.CompletionTokens
+		result.CostUSD += answer.CostUSD
+	}
+
+	summary := fmt.Sprintf("Ensemble verdict: %s, backed by %d of %d models.", action, agreeing, answered)
+	if len(failures) > 0 {
+		summary += fmt.Sprintf(" %d of %d models gave no answer: %s.", len(failures), len(e.members), strings.Join(failures, "; "))
+	}
+	result.Reasoning = summary + "\n\n" + strings.Join(sections, "\n\n")
+	result.RawResponse = strings.Join(raw, "\n\n")
+	result.Risks = risks
+	result.Incomplete = incomplete
+	result.Ensemble = verdicts
+	return result
+}
+
+// moreCautious reports whether action a comes before b in cautiousActions, actions not
+// in it coming last in alphabetical order
+func moreCautious(a, b string) bool {
+	rank := func(action string) int {
+		if i := slices.Index(cautiousActions, action); i >= 0 {
+			return i
+		}
+		return len(cautiousActions)
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
+
+// Complete answers a free-form prompt with the first member able to, trying the others
+// in turn if it fails
+func (e *Ensemble) Complete(ctx context.Context, prompt string) (string, error) {
+	err := errors.New("no ensemble member can answer free-form prompts")
+	for _, m := range e.members {
+		completer, ok := m.analyzer.(Completer)
+		if !ok {
+			continue
+		}
+		var text string
+		if text, err = completer.Complete(ctx, prompt); err == nil {
+			return text, nil
+		}
+	}
+	return "", err
+}
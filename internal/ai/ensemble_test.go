@@ -0,0 +1,138 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"stockmarket/internal/models"
+)
+
+// stubAnalyzer answers every request with a fixed response or error
+type stubAnalyzer struct {
+	name     string
+	response *models.AnalysisResponse
+	err      error
+}
+
+func (a *stubAnalyzer) Analyze(context.Context, models.AnalysisRequest) (*models.AnalysisResponse, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	answer := *a.response
+	return &answer, nil
+}
+
+func (a *stubAnalyzer) Name() string  { return a.name }
+func (a *stubAnalyzer) Model() string { return "stub" }
+
+// vote is a member answering action at confidence, or failing when err is set
+type vote struct {
+	action     string
+	confidence float64
+	weight     float64
+	err        error
+	incomplete bool
+}
+
+func testEnsemble(votes ...vote) *Ensemble {
+	e := &Ensemble{}
+	for i, v := range votes {
+		analyzer := &stubAnalyzer{name: string(rune('a' + i)), err: v.err}
+		if v.err == nil {
+			analyzer.response = &models.AnalysisResponse{
+				Symbol:       "AAPL",
+				Action:       v.action,
+				Confidence:   v.confidence,
+				Reasoning:    v.action + " reasoning",
+				PriceTargets: models.PriceTargets{Target: float64(100 + i)},
+				Risks:        []string{"risk " + string(rune('a'+i))},
+				Incomplete:   v.incomplete,
+			}
+			if v.incomplete {
+				analyzer.response.Risks = nil
+			}
+		}
+		e.members = append(e.members, ensembleMember{EnsembleMember: EnsembleMember{Weight: v.weight}, analyzer: analyzer})
+	}
+	return e
+}
+
+func TestEnsembleMajority(t *testing.T) {
+	e := testEnsemble(vote{action: "BUY", confidence: 0.8, weight: 1}, vote{action: "BUY", confidence: 0.6, weight: 1}, vote{action: "SELL", confidence: 0.9, weight: 1})
+	got, err := e.Analyze(context.Background(), models.AnalysisRequest{Symbol: "AAPL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Action != "BUY" {
+		t.Errorf("action = %s, want BUY", got.Action)
+	}
+	// (0.8 + 0.6 + 0 for the dissenter) / 3
+	if want := 1.4 / 3; math.Abs(got.Confidence-want) > 1e-9 {
+		t.Errorf("confidence = %v, want %v", got.Confidence, want)
+	}
+	if got.PriceTargets.Target != 100 {
+		t.Errorf("levels from target %v, want the most confident agreeing member's (100)", got.PriceTargets.Target)
+	}
+	if len(got.Risks) != 3 || len(got.Ensemble) != 3 {
+		t.Errorf("risks = %v, verdicts = %d, want every member's", got.Risks, len(got.Ensemble))
+	}
+}
+
+func TestEnsembleTieBreak(t *testing.T) {
+	e := testEnsemble(vote{action: "BUY", confidence: 0.9, weight: 1}, vote{action: "HOLD", confidence: 0.5, weight: 1})
+	got, err := e.Analyze(context.Background(), models.AnalysisRequest{Symbol: "AAPL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Action != "HOLD" {
+		t.Errorf("tied action = %s, want the more cautious HOLD", got.Action)
+	}
+
+	e = testEnsemble(vote{action: "ACCUMULATE", confidence: 0.7, weight: 1}, vote{action: "ACCUMULATE", confidence: 0.6, weight: 1})
+	got, err = e.Analyze(context.Background(), models.AnalysisRequest{Symbol: "AAPL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Action != "ACCUMULATE" || got.PriceTargets.Target != 100 {
+		t.Errorf("action = %s with target %v, want the unlisted action the members agreed on", got.Action, got.PriceTargets.Target)
+	}
+}
+
+func TestEnsembleWeighting(t *testing.T) {
+	e := testEnsemble(vote{action: "BUY", confidence: 0.5, weight: 3}, vote{action: "SELL", confidence: 0.9, weight: 1}, vote{action: "SELL", confidence: 0.9, weight: 1})
+	got, err := e.Analyze(context.Background(), models.AnalysisRequest{Symbol: "AAPL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Action != "BUY" {
+		t.Errorf("action = %s, want BUY, which has the most weight behind it", got.Action)
+	}
+	if want := 1.5 / 5; math.Abs(got.Confidence-want) > 1e-9 {
+		t.Errorf("confidence = %v, want %v", got.Confidence, want)
+	}
+}
+
+func TestEnsembleDegradation(t *testing.T) {
+	e := testEnsemble(vote{err: errors.New("timed out"), weight: 1}, vote{action: "SELL", confidence: 0.7, weight: 1, incomplete: true})
+	got, err := e.Analyze(context.Background(), models.AnalysisRequest{Symbol: "AAPL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Action != "SELL" || got.Confidence != 0.7 {
+		t.Errorf("got %s at %v, want the answering member's SELL at 0.7", got.Action, got.Confidence)
+	}
+	if !strings.Contains(got.Reasoning, "1 of 2 models gave no answer") || got.Ensemble[0].Error != "timed out" {
+		t.Errorf("reasoning = %q, want the failed member reported", got.Reasoning)
+	}
+	if !got.Incomplete {
+		t.Error("want the analysis incomplete, as its only answering member's was")
+	}
+
+	e = testEnsemble(vote{err: errors.New("first"), weight: 1}, vote{err: errors.New("second"), weight: 1})
+	if _, err := e.Analyze(context.Background(), models.AnalysisRequest{Symbol: "AAPL"}); err == nil || !strings.Contains(err.Error(), "first") {
+		t.Errorf("err = %v, want every member failing reported with the first error", err)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"stockmarket/internal/models"
 )
@@ -36,16 +38,66 @@ func (g *Gemini) Name() string {
 	return "gemini"
 }
 
+// Model returns the model used for completions
+func (g *Gemini) Model() string {
+	return g.model
+}
+
 // Analyze performs stock analysis using Gemini
 func (g *Gemini) Analyze(ctx context.Context, req models.AnalysisRequest) (*models.AnalysisResponse, error) {
+	return g.AnalyzeStream(ctx, req, nil)
+}
+
+// AnalyzeStream performs stock analysis using Gemini, streaming the reply to chunks;
+// a nil chunks channel waits for the whole reply instead
+func (g *Gemini) AnalyzeStream(ctx context.Context, req models.AnalysisRequest, chunks chan<- string) (*models.AnalysisResponse, error) {
+	prompt := BuildPrompt(req)
+	content, usage, err := g.complete(ctx, prompt, maxTokens(req.DetailLevel), chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis, err := parseAnalysisResponse(req.Symbol, content)
+	if err != nil {
+		return nil, err
+	}
+	applyUsage(analysis, usage)
+	analysis.Prompt, analysis.RawResponse = prompt, content
+	return analysis, nil
+}
+
+// VerifyKey checks the API key by listing the available models. Gemini refuses a bad
+// key with a 400 rather than a 401.
+func (g *Gemini) VerifyKey(ctx context.Context) error {
 	if g.apiKey == "" {
-		return nil, ErrNoAPIKey
+		return ErrNoAPIKey
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", geminiBaseURL+"?pageSize=1", nil)
+	if err != nil {
+		return err
 	}
+	httpReq.Header.Set("x-goog-api-key", g.apiKey)
+	return verifyKeyRequest(ctx, g.client, httpReq)
+}
 
-	prompt := BuildPrompt(req)
+// Complete sends a single-turn prompt to Gemini and returns the raw text reply
+func (g *Gemini) Complete(ctx context.Context, prompt string) (string, error) {
+	content, _, err := g.complete(ctx, prompt, defaultMaxTokens, nil)
+	return content, err
+}
+
+// complete sends a prompt with an output token budget, streaming the reply to chunks
+// when given
+func (g *Gemini) complete(ctx context.Context, prompt string, maxTokens int, chunks chan<- string) (string, models.AIUsage, error) {
+	if g.apiKey == "" {
+		return "", models.AIUsage{}, ErrNoAPIKey
+	}
 
 	// Use header-based auth instead of URL param to prevent key from being logged
 	url := fmt.Sprintf("%s/%s:generateContent", geminiBaseURL, g.model)
+	if chunks != nil {
+		url = fmt.Sprintf("%s/%s:streamGenerateContent?alt=sse", geminiBaseURL, g.model)
+	}
 
 	requestBody := map[string]interface{}{
 		"contents": []map[string]interface{}{
@@ -57,18 +109,18 @@ func (g *Gemini) Analyze(ctx context.Context, req models.AnalysisRequest) (*mode
 		},
 		"generationConfig": map[string]interface{}{
 			"temperature":     0.3,
-			"maxOutputTokens": 1000,
+			"maxOutputTokens": maxTokens,
 		},
 	}
 
 	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
-		return nil, err
+		return "", models.AIUsage{}, err
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, err
+		return "", models.AIUsage{}, err
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
@@ -76,7 +128,7 @@ func (g *Gemini) Analyze(ctx context.Context, req models.AnalysisRequest) (*mode
 
 	resp, err := g.client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return "", models.AIUsage{}, requestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
@@ -87,7 +139,10 @@ func (g *Gemini) Analyze(ctx context.Context, req models.AnalysisRequest) (*mode
 			} `json:"error"`
 		}
 		json.NewDecoder(resp.Body).Decode(&errResp)
-		return nil, fmt.Errorf("%w: %s", ErrAnalysisFailed, errResp.Error.Message)
+		return "", models.AIUsage{}, fmt.Errorf("%w: %s", ErrAnalysisFailed, errResp.Error.Message)
+	}
+	if chunks != nil {
+		return g.readStream(ctx, resp.Body, chunks)
 	}
 
 	var result struct {
@@ -98,15 +153,66 @@ func (g *Gemini) Analyze(ctx context.Context, req models.AnalysisRequest) (*mode
 				} `json:"parts"`
 			} `json:"content"`
 		} `json:"candidates"`
+		UsageMetadata struct {
+			PromptTokenCount     int `json:"promptTokenCount"`
+			CandidatesTokenCount int `json:"candidatesTokenCount"`
+		} `json:"usageMetadata"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+		return "", models.AIUsage{}, err
 	}
+	usage := recordUsage(ctx, g.Name(), g.model, result.UsageMetadata.PromptTokenCount, result.UsageMetadata.CandidatesTokenCount)
 
 	if len(result.Candidates) == 0 || len(result.Candidates[0].Content.Parts) == 0 {
-		return nil, ErrAnalysisFailed
+		return "", usage, ErrAnalysisFailed
 	}
 
-	return parseAnalysisResponse(req.Symbol, result.Candidates[0].Content.Parts[0].Text)
+	return result.Candidates[0].Content.Parts[0].Text, usage, nil
+}
+
+// readStream collects a streamed reply, forwarding the text of each partial response.
+// Usage counts are cumulative, so the last ones seen are kept.
+func (g *Gemini) readStream(ctx context.Context, body io.Reader, chunks chan<- string) (string, models.AIUsage, error) {
+	var content strings.Builder
+	var promptTokens, completionTokens int
+	err := readEventStream(body, func(data []byte) error {
+		var event struct {
+			Candidates []struct {
+				Content struct {
+					Parts []struct {
+						Text string `json:"text"`
+					} `json:"parts"`
+				} `json:"content"`
+			} `json:"candidates"`
+			UsageMetadata struct {
+				PromptTokenCount     int `json:"promptTokenCount"`
+				CandidatesTokenCount int `json:"candidatesTokenCount"`
+			} `json:"usageMetadata"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		if event.UsageMetadata.PromptTokenCount > 0 {
+			promptTokens, completionTokens = event.UsageMetadata.PromptTokenCount, event.UsageMetadata.CandidatesTokenCount
+		}
+		if len(event.Candidates) == 0 {
+			return nil
+		}
+		for _, part := range event.Candidates[0].Content.Parts {
+			content.WriteString(part.Text)
+			if err := sendChunk(ctx, chunks, part.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	usage := recordUsage(ctx, g.Name(), g.model, promptTokens, completionTokens)
+	if err != nil {
+		return "", usage, err
+	}
+	if content.Len() == 0 {
+		return "", usage, ErrAnalysisFailed
+	}
+	return content.String(), usage, nil
 }
@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+
+	"stockmarket/internal/apperr"
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// Guardrail modes for analyses whose price levels look hallucinated
+const (
+	GuardrailModeFlag   = "flag"   // keep the analysis but downgrade its confidence
+	GuardrailModeReject = "reject" // fail the analysis
+	GuardrailModeRetry  = "retry"  // re-run the analysis once, then flag
+)
+
+// flaggedConfidenceCap is the highest confidence a flagged analysis may keep
+const flaggedConfidenceCap = 0.3
+
+// ErrPriceGuardrail is returned when an analysis fails the price sanity check
+var ErrPriceGuardrail = apperr.Wrap(apperr.AIError, ErrAnalysisFailed, "price targets deviate too far from current price")
+
+// CheckPriceTargets reports which price levels deviate from the current price by
+// more than maxMultiple in either direction, priced in currency. A maxMultiple <= 1
+// disables the check.
+func CheckPriceTargets(targets models.PriceTargets, currentPrice, maxMultiple float64, currency string) []string {
+	if maxMultiple <= 1 || currentPrice <= 0 {
+		return nil
+	}
+
+	levels := []struct {
+		name  string
+		price float64
+	}{
+		{"entry", targets.Entry},
+		{"target", targets.Target},
+		{"stop_loss", targets.StopLoss},
+	}
+
+	var violations []string
+	for _, level := range levels {
+		if level.price == 0 {
+			continue
+		}
+		ratio := level.price / currentPrice
+		if ratio > maxMultiple || ratio < 1/maxMultiple || level.price < 0 {
+			violations = append(violations, fmt.Sprintf("%s %s vs current %s", level.name, market.FormatPrice(level.price, currency), market.FormatPrice(currentPrice, currency)))
+		}
+	}
+	return violations
+}
+
+// minSubstantiveReasoning is the shortest reasoning treated as an actual explanation
+const minSubstantiveReasoning = 40
+
+// DirectiveRetryHint is added to the prompt when re-running a bare HOLD analysis
+const DirectiveRetryHint = `Your previous answer was a low-confidence HOLD without a real explanation.
+Commit to the action best supported by the data. If HOLD is still right, explain specifically why,
+citing the price action, trend and levels that make it so.`
+
+// RisksRetryHint is added to the prompt when re-running an analysis that listed no risks
+const RisksRetryHint = `Your previous answer did not list any risks. Every recommendation must name its caveats:
+include the top downside risks in "risks", most significant first.`
+
+// IsBareHold reports whether an analysis is a HOLD below minConfidence with no substantive reasoning
+func IsBareHold(analysis *models.AnalysisResponse, minConfidence float64) bool {
+	return analysis.Action == "HOLD" && analysis.Confidence < minConfidence &&
+		len(strings.TrimSpace(analysis.Reasoning)) < minSubstantiveReasoning
+}
+
+// FlagAnalysis marks an analysis as failing the price sanity check
+func FlagAnalysis(analysis *models.AnalysisResponse, violations []string) {
+	analysis.GuardrailFlagged = true
+	if analysis.Confidence > flaggedConfidenceCap {
+		analysis.Confidence = flaggedConfidenceCap
+	}
+	for _, v := range violations {
+		analysis.Risks = append(analysis.Risks, "Price level failed sanity check: "+v)
+	}
+}
@@ -0,0 +1,61 @@
+package ai
+
+import (
+	"strings"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// CheckLevelSides drops a BUY's stop loss at or above its entry and target at or
+// below it, and the reverse for a SELL, measuring from the current price when the
+// model gave no entry. It returns what was dropped, priced in currency; other actions
+// are left alone.
+func CheckLevelSides(action string, targets *models.PriceTargets, currentPrice float64, currency string) []string {
+	var direction float64
+	switch action {
+	case "BUY":
+		direction = 1
+	case "SELL":
+		direction = -1
+	default:
+		return nil
+	}
+	entry := targets.Entry
+	if entry <= 0 {
+		entry = currentPrice
+	}
+	if entry <= 0 {
+		return nil
+	}
+
+	var dropped []string
+	if targets.StopLoss > 0 && (targets.StopLoss-entry)*direction >= 0 {
+		dropped = append(dropped, "stop_loss "+market.FormatPrice(targets.StopLoss, currency)+" vs entry "+market.FormatPrice(entry, currency))
+		targets.StopLoss = 0
+	}
+	if targets.Target > 0 && (targets.Target-entry)*direction <= 0 {
+		dropped = append(dropped, "target "+market.FormatPrice(targets.Target, currency)+" vs entry "+market.FormatPrice(entry, currency))
+		targets.Target = 0
+	}
+	return dropped
+}
+
+// LevelSummary describes an analysis's price levels in currency, e.g. "BUY AAPL,
+// entry ~$190.00, stop $182.50, target $205.00", or "" when it has none
+func LevelSummary(symbol, action string, targets models.PriceTargets, currency string) string {
+	var levels []string
+	if targets.Entry > 0 {
+		levels = append(levels, "entry ~"+market.FormatPrice(targets.Entry, currency))
+	}
+	if targets.StopLoss > 0 {
+		levels = append(levels, "stop "+market.FormatPrice(targets.StopLoss, currency))
+	}
+	if targets.Target > 0 {
+		levels = append(levels, "target "+market.FormatPrice(targets.Target, currency))
+	}
+	if len(levels) == 0 {
+		return ""
+	}
+	return action + " " + symbol + ", " + strings.Join(levels, ", ")
+}
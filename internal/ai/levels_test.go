@@ -0,0 +1,33 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// TestLevelsInQuoteCurrency checks that the level summary and the dropped-level report
+// price in the analysis's currency rather than dollars
+func TestLevelsInQuoteCurrency(t *testing.T) {
+	targets := models.PriceTargets{Entry: 190, StopLoss: 182.5, Target: 205}
+	if got, want := LevelSummary("BARC.L", "BUY", targets, "GBP"), "BUY BARC.L, entry ~£190.00, stop £182.50, target £205.00"; got != want {
+		t.Errorf("GBP summary = %q, want %q", got, want)
+	}
+	if got, want := LevelSummary("AAPL", "BUY", targets, ""), "BUY AAPL, entry ~$190.00, stop $182.50, target $205.00"; got != want {
+		t.Errorf("default summary = %q, want %q", got, want)
+	}
+	if got := LevelSummary("VOD.L", "SELL", models.PriceTargets{Target: 71.5}, market.SymbolCurrency("VOD.L")); got != "SELL VOD.L, target 71.50p" {
+		t.Errorf("LSE summary = %q, want the target in pence", got)
+	}
+
+	wrongSide := models.PriceTargets{Entry: 100, StopLoss: 105, Target: 95}
+	dropped := CheckLevelSides("BUY", &wrongSide, 100, "GBP")
+	if len(dropped) != 2 || !strings.Contains(dropped[0], "£105.00 vs entry £100.00") || strings.Contains(strings.Join(dropped, " "), "$") {
+		t.Errorf("dropped = %q, want both levels priced in pounds", dropped)
+	}
+	if wrongSide.StopLoss != 0 || wrongSide.Target != 0 {
+		t.Errorf("targets = %+v, want the wrong-side levels cleared", wrongSide)
+	}
+}
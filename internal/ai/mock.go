@@ -0,0 +1,235 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// mockChunkDelay paces a streamed mock reply so it arrives like a model's
+const mockChunkDelay = 15 * time.Millisecond
+
+// mockRisks are the risks mock analyses pick from
+var mockRisks = []string{
+	"A broad market sell-off could drag the price down regardless of its own trend",
+	"Momentum can reverse quickly after an extended run",
+	"Volume is thin, so moves may not hold",
+	"Upcoming macro data could shift rate expectations",
+	"Sector rotation may pull money out of this name",
+	"Support levels may fail on a retest",
+}
+
+// Mock implements the Analyzer interface without calling any AI service, for demos and
+// offline use; it needs no API key and usage is free. Its replies are canned but follow
+// the request: the action weighs the price trend and the computed indicators, and the
+// confidence, targets and risks vary by symbol and day, so the same request on the
+// same day always gets the same analysis.
+type Mock struct {
+	model string
+}
+
+// NewMock creates a new mock analyzer
+func NewMock(model string) *Mock {
+	if model == "" {
+		model = "mock"
+	}
+	return &Mock{model: model}
+}
+
+// Name returns the provider name
+func (m *Mock) Name() string {
+	return "mock"
+}
+
+// Model returns the model name reported on usage
+func (m *Mock) Model() string {
+	return m.model
+}
+
+// Analyze returns a canned analysis for the request
+func (m *Mock) Analyze(ctx context.Context, req models.AnalysisRequest) (*models.AnalysisResponse, error) {
+	return m.AnalyzeStream(ctx, req, nil)
+}
+
+// AnalyzeStream returns a canned analysis, sending the reply to chunks a few words at
+// a time; a nil chunks channel returns it at once
+func (m *Mock) AnalyzeStream(ctx context.Context, req models.AnalysisRequest, chunks chan<- string) (*models.AnalysisResponse, error) {
+	prompt := BuildPrompt(req)
+	content := mockReply(req)
+	if chunks != nil {
+		if err := streamMockReply(ctx, content, chunks); err != nil {
+			return nil, err
+		}
+	}
+
+	analysis, err := parseAnalysisResponse(req.Symbol, content)
+	if err != nil {
+		return nil, err
+	}
+	applyUsage(analysis, recordUsage(ctx, m.Name(), m.model, estimateTokens(prompt), estimateTokens(content)))
+	analysis.Prompt, analysis.RawResponse = prompt, content
+	return analysis, nil
+}
+
+// VerifyKey always succeeds; the mock needs no key
+func (m *Mock) VerifyKey(ctx context.Context) error {
+	return nil
+}
+
+// Complete answers a free-form prompt with a fixed neutral summary
+func (m *Mock) Complete(ctx context.Context, prompt string) (string, error) {
+	reply := "- Management kept a steady tone and reiterated guidance\n- No notable surprises were raised\nOverall sentiment: neutral"
+	recordUsage(ctx, m.Name(), m.model, estimateTokens(prompt), estimateTokens(reply))
+	return reply, nil
+}
+
+// estimateTokens approximates a text's token count at four characters a token
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// streamMockReply sends content to chunks a few words at a time
+func streamMockReply(ctx context.Context, content string, chunks chan<- string) error {
+	words := strings.SplitAfter(content, " ")
+	for i := 0; i < len(words); i += 4 {
+		if err := sendChunk(ctx, chunks, strings.Join(words[i:min(i+4, len(words))], "")); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(mockChunkDelay):
+		}
+	}
+	return nil
+}
+
+// mockReply writes the JSON reply a model would give for req
+func mockReply(req models.AnalysisRequest) string {
+	h := fnv.New64a()
+	h.Write([]byte(req.Symbol + time.Now().UTC().Format(time.DateOnly)))
+	seed := h.Sum64()
+	// vary returns a value in [0, 1) for one of the reply's choices
+	vary := func(choice uint64) float64 {
+		return float64((seed*(2*choice+1))>>11%1000) / 1000
+	}
+
+	price := req.CurrentPrice
+	var notes []string
+	score := 0
+
+	trend := 0.0
+	if n := len(req.HistoricalData); n > 1 && req.HistoricalData[n-1].Close > 0 {
+		trend = (price/req.HistoricalData[n-1].Close - 1) * 100
+		notes = append(notes, fmt.Sprintf("The price has moved %+.1f%% over the last %d sessions.", trend, n))
+		switch {
+		case trend > 2:
+			score++
+		case trend < -2:
+			score--
+		}
+	}
+	if ind := req.Indicators; ind != nil {
+		if rsi := ind.RSI14; rsi != nil {
+			switch {
+			case *rsi >= 70:
+				score--
+				notes = append(notes, fmt.Sprintf("RSI at %.0f is overbought.", *rsi))
+			case *rsi <= 30:
+				score++
+				notes = append(notes, fmt.Sprintf("RSI at %.0f is oversold.", *rsi))
+			default:
+				notes = append(notes, fmt.Sprintf("RSI at %.0f is neutral.", *rsi))
+			}
+		}
+		if sma := ind.SMA50; sma != nil {
+			if price >= *sma {
+				score++
+				notes = append(notes, fmt.Sprintf("It trades above its 50-day average of %.2f.", *sma))
+			} else {
+				score--
+				notes = append(notes, fmt.Sprintf("It trades below its 50-day average of %.2f.", *sma))
+			}
+		}
+		if hist := ind.MACDHist; hist != nil {
+			if *hist >= 0 {
+				score++
+			} else {
+				score--
+			}
+		}
+	}
+
+	action := "HOLD"
+	switch {
+	case score >= 2:
+		action = "BUY"
+	case score <= -2:
+		action = "SELL"
+	case vary(0) < 0.3:
+		action = "WATCH"
+	}
+	confidence := math.Min(0.9, 0.5+0.08*math.Abs(float64(score))+0.1*vary(1))
+
+	move := 0.04 + 0.08*vary(2)
+	targets := models.PriceTargets{Entry: price, Target: price * (1 + move), StopLoss: price * (1 - move/2)}
+	if action == "SELL" {
+		targets.Target, targets.StopLoss = price*(1-move), price*(1+move/2)
+	}
+	targets.Entry, targets.Target, targets.StopLoss = roundPrice(targets.Entry), roundPrice(targets.Target), roundPrice(targets.StopLoss)
+
+	conclusions := map[string]string{
+		"BUY":   "The signals line up to the upside, so adding at the current price looks reasonable.",
+		"SELL":  "The signals point lower, so reducing exposure looks prudent.",
+		"HOLD":  "The signals are mixed, so there's no strong reason to change a position.",
+		"WATCH": "Nothing is decisive yet; wait for a clearer setup before acting.",
+	}
+	opening := fmt.Sprintf("Mock analysis of %s at %s.", req.Symbol, formatFloat(price))
+	technicals := strings.Join(append(notes, conclusions[action]), " ")
+	reasoning := opening + " " + technicals
+	riskCount := 3
+	switch req.DetailLevel {
+	case DetailBrief:
+		reasoning = opening + " " + conclusions[action]
+		riskCount = 2
+	case DetailDetailed:
+		reasoning = "Technicals: " + technicals + "\n\nFundamentals: This is generated demo data, so there are no fundamentals to weigh.\n\nRisks: " + mockRisks[0] + "."
+	}
+
+	first := int(vary(3) * float64(len(mockRisks)))
+	risks := make([]string, riskCount)
+	for i := range risks {
+		risks[i] = mockRisks[(first+i)%len(mockRisks)]
+	}
+
+	timeframes := map[string]string{"daily": "1-3 days", "weekly": "1-2 weeks", "swing": "2-6 weeks"}
+	timeframe, ok := timeframes[req.TradeFrequency]
+	if !ok {
+		timeframe = "1-4 weeks"
+	}
+
+	reply, _ := json.MarshalIndent(map[string]interface{}{
+		"action":        action,
+		"confidence":    math.Round(confidence*100) / 100,
+		"reasoning":     reasoning,
+		"price_targets": targets,
+		"risks":         risks,
+		"timeframe":     timeframe,
+	}, "", "  ")
+	return string(reply)
+}
+
+// roundPrice rounds a generated price level to cents, or to six decimals below a dollar
+func roundPrice(price float64) float64 {
+	scale := 100.0
+	if price < 1 {
+		scale = 1e6
+	}
+	return math.Round(price*scale) / scale
+}
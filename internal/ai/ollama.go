@@ -0,0 +1,186 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"stockmarket/internal/models"
+)
+
+// OllamaBaseURL is the local Ollama server analyses are sent to
+var OllamaBaseURL = "http://localhost:11434"
+
+// Ollama implements the Analyzer interface for a local Ollama server, so prompts
+// never leave the machine. It needs no API key.
+type Ollama struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+// NewOllama creates a new Ollama analyzer
+func NewOllama(model string) *Ollama {
+	if model == "" {
+		model = "llama3.1"
+	}
+	return &Ollama{
+		baseURL: strings.TrimRight(OllamaBaseURL, "/"),
+		model:   model,
+		client:  sharedHTTPClient,
+	}
+}
+
+// Name returns the provider name
+func (o *Ollama) Name() string {
+	return "ollama"
+}
+
+// Model returns the model used for completions
+func (o *Ollama) Model() string {
+	return o.model
+}
+
+// Analyze performs stock analysis using a local model
+func (o *Ollama) Analyze(ctx context.Context, req models.AnalysisRequest) (*models.AnalysisResponse, error) {
+	return o.AnalyzeStream(ctx, req, nil)
+}
+
+// AnalyzeStream performs stock analysis using Ollama, streaming the reply to chunks;
+// a nil chunks channel waits for the whole reply instead
+func (o *Ollama) AnalyzeStream(ctx context.Context, req models.AnalysisRequest, chunks chan<- string) (*models.AnalysisResponse, error) {
+	prompt := BuildPrompt(req)
+	content, usage, err := o.complete(ctx, prompt, maxTokens(req.DetailLevel), chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis, err := parseAnalysisResponse(req.Symbol, content)
+	if err != nil {
+		return nil, err
+	}
+	applyUsage(analysis, usage)
+	analysis.Prompt, analysis.RawResponse = prompt, content
+	return analysis, nil
+}
+
+// VerifyKey checks that the Ollama server answers, by listing its local models; there's
+// no key to check
+func (o *Ollama) VerifyKey(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", o.baseURL+"/api/tags", nil)
+	if err != nil {
+		return err
+	}
+	return verifyKeyRequest(ctx, o.client, httpReq)
+}
+
+// Complete sends a single-turn prompt to Ollama and returns the raw text reply
+func (o *Ollama) Complete(ctx context.Context, prompt string) (string, error) {
+	content, _, err := o.complete(ctx, prompt, defaultMaxTokens, nil)
+	return content, err
+}
+
+// complete sends a prompt with an output token budget, streaming the reply to chunks
+// when given
+func (o *Ollama) complete(ctx context.Context, prompt string, maxTokens int, chunks chan<- string) (string, models.AIUsage, error) {
+	requestBody := map[string]interface{}{
+		"model": o.model,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+		"stream": chunks != nil,
+		"options": map[string]interface{}{
+			"temperature": 0.3,
+			"num_predict": maxTokens,
+		},
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", models.AIUsage{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/api/chat", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", models.AIUsage{}, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return "", models.AIUsage{}, requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return "", models.AIUsage{}, fmt.Errorf("%w: %s", ErrAnalysisFailed, errResp.Error)
+	}
+	if chunks != nil {
+		return o.readStream(ctx, resp.Body, chunks)
+	}
+
+	var result struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		PromptEvalCount int `json:"prompt_eval_count"`
+		EvalCount       int `json:"eval_count"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", models.AIUsage{}, err
+	}
+	usage := recordUsage(ctx, o.Name(), o.model, result.PromptEvalCount, result.EvalCount)
+
+	if result.Message.Content == "" {
+		return "", usage, ErrAnalysisFailed
+	}
+
+	return result.Message.Content, usage, nil
+}
+
+// readStream collects a streamed chat reply, forwarding each message fragment. The
+// final line carries the token counts.
+func (o *Ollama) readStream(ctx context.Context, body io.Reader, chunks chan<- string) (string, models.AIUsage, error) {
+	var content strings.Builder
+	var promptTokens, completionTokens int
+	err := readJSONLines(body, func(line []byte) error {
+		var event struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			Done            bool   `json:"done"`
+			Error           string `json:"error"`
+			PromptEvalCount int    `json:"prompt_eval_count"`
+			EvalCount       int    `json:"eval_count"`
+		}
+		if err := json.Unmarshal(line, &event); err != nil {
+			return err
+		}
+		if event.Error != "" {
+			return fmt.Errorf("%w: %s", ErrAnalysisFailed, event.Error)
+		}
+		if event.Done {
+			promptTokens, completionTokens = event.PromptEvalCount, event.EvalCount
+		}
+		content.WriteString(event.Message.Content)
+		return sendChunk(ctx, chunks, event.Message.Content)
+	})
+	usage := recordUsage(ctx, o.Name(), o.model, promptTokens, completionTokens)
+	if err != nil {
+		return "", usage, err
+	}
+	if content.Len() == 0 {
+		return "", usage, ErrAnalysisFailed
+	}
+	return content.String(), usage, nil
+}
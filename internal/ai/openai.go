@@ -5,6 +5,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"strings"
 	"time"
@@ -38,13 +40,59 @@ func (o *OpenAI) Name() string {
 	return "openai"
 }
 
+// Model returns the model used for completions
+func (o *OpenAI) Model() string {
+	return o.model
+}
+
 // Analyze performs stock analysis using OpenAI
 func (o *OpenAI) Analyze(ctx context.Context, req models.AnalysisRequest) (*models.AnalysisResponse, error) {
+	return o.AnalyzeStream(ctx, req, nil)
+}
+
+// AnalyzeStream performs stock analysis using OpenAI, streaming the reply to chunks;
+// a nil chunks channel waits for the whole reply instead
+func (o *OpenAI) AnalyzeStream(ctx context.Context, req models.AnalysisRequest, chunks chan<- string) (*models.AnalysisResponse, error) {
+	prompt := BuildPrompt(req)
+	content, usage, err := o.complete(ctx, prompt, maxTokens(req.DetailLevel), chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis, err := parseAnalysisResponse(req.Symbol, content)
+	if err != nil {
+		return nil, err
+	}
+	applyUsage(analysis, usage)
+	analysis.Prompt, analysis.RawResponse = prompt, content
+	return analysis, nil
+}
+
+// VerifyKey checks the API key by listing the account's models
+func (o *OpenAI) VerifyKey(ctx context.Context) error {
 	if o.apiKey == "" {
-		return nil, ErrNoAPIKey
+		return ErrNoAPIKey
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(openAIBaseURL, "/chat/completions")+"/models", nil)
+	if err != nil {
+		return err
 	}
+	httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	return verifyKeyRequest(ctx, o.client, httpReq)
+}
 
-	prompt := BuildPrompt(req)
+// Complete sends a single-turn prompt to OpenAI and returns the raw text reply
+func (o *OpenAI) Complete(ctx context.Context, prompt string) (string, error) {
+	content, _, err := o.complete(ctx, prompt, defaultMaxTokens, nil)
+	return content, err
+}
+
+// complete sends a prompt with an output token budget, streaming the reply to chunks
+// when given
+func (o *OpenAI) complete(ctx context.Context, prompt string, maxTokens int, chunks chan<- string) (string, models.AIUsage, error) {
+	if o.apiKey == "" {
+		return "", models.AIUsage{}, ErrNoAPIKey
+	}
 
 	requestBody := map[string]interface{}{
 		"model": o.model,
@@ -52,17 +100,21 @@ func (o *OpenAI) Analyze(ctx context.Context, req models.AnalysisRequest) (*mode
 			{"role": "user", "content": prompt},
 		},
 		"temperature": 0.3,
-		"max_tokens":  1000,
+		"max_tokens":  maxTokens,
+	}
+	if chunks != nil {
+		requestBody["stream"] = true
+		requestBody["stream_options"] = map[string]bool{"include_usage": true}
 	}
 
 	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
-		return nil, err
+		return "", models.AIUsage{}, err
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", openAIBaseURL, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, err
+		return "", models.AIUsage{}, err
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
@@ -70,7 +122,7 @@ func (o *OpenAI) Analyze(ctx context.Context, req models.AnalysisRequest) (*mode
 
 	resp, err := o.client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return "", models.AIUsage{}, requestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
@@ -81,7 +133,10 @@ func (o *OpenAI) Analyze(ctx context.Context, req models.AnalysisRequest) (*mode
 			} `json:"error"`
 		}
 		json.NewDecoder(resp.Body).Decode(&errResp)
-		return nil, fmt.Errorf("%w: %s", ErrAnalysisFailed, errResp.Error.Message)
+		return "", models.AIUsage{}, fmt.Errorf("%w: %s", ErrAnalysisFailed, errResp.Error.Message)
+	}
+	if chunks != nil {
+		return o.readStream(ctx, resp.Body, chunks)
 	}
 
 	var result struct {
@@ -90,38 +145,31 @@ func (o *OpenAI) Analyze(ctx context.Context, req models.AnalysisRequest) (*mode
 				Content string `json:"content"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+		return "", models.AIUsage{}, err
 	}
+	usage := recordUsage(ctx, o.Name(), o.model, result.Usage.PromptTokens, result.Usage.CompletionTokens)
 
 	if len(result.Choices) == 0 {
-		return nil, ErrAnalysisFailed
+		return "", usage, ErrAnalysisFailed
 	}
 
-	return parseAnalysisResponse(req.Symbol, result.Choices[0].Message.Content)
+	return result.Choices[0].Message.Content, usage, nil
 }
 
 // parseAnalysisResponse parses the AI response into an AnalysisResponse
 func parseAnalysisResponse(symbol string, content string) (*models.AnalysisResponse, error) {
-	// Try to extract JSON from the response
-	content = strings.TrimSpace(content)
-
-	// Handle markdown code blocks
-	if strings.HasPrefix(content, "```json") {
-		content = strings.TrimPrefix(content, "```json")
-		content = strings.TrimSuffix(content, "```")
-		content = strings.TrimSpace(content)
-	} else if strings.HasPrefix(content, "```") {
-		content = strings.TrimPrefix(content, "```")
-		content = strings.TrimSuffix(content, "```")
-		content = strings.TrimSpace(content)
-	}
+	content = stripCodeFence(strings.TrimSpace(content))
 
 	var response struct {
 		Action       string              `json:"action"`
-		Confidence   float64             `json:"confidence"`
+		Confidence   *float64            `json:"confidence"`
 		Reasoning    string              `json:"reasoning"`
 		PriceTargets models.PriceTargets `json:"price_targets"`
 		Risks        []string            `json:"risks"`
@@ -129,17 +177,138 @@ func parseAnalysisResponse(symbol string, content string) (*models.AnalysisRespo
 	}
 
 	if err := json.Unmarshal([]byte(content), &response); err != nil {
-		return nil, fmt.Errorf("%w: failed to parse response: %v", ErrAnalysisFailed, err)
+		// Smaller models often wrap the JSON in prose; fall back to the outermost object
+		object, ok := extractJSONObject(content)
+		if !ok {
+			return nil, fmt.Errorf("%w: failed to parse response: %v", ErrAnalysisFailed, err)
+		}
+		if err := json.Unmarshal([]byte(object), &response); err != nil {
+			return nil, fmt.Errorf("%w: failed to parse response: %v", ErrAnalysisFailed, err)
+		}
+	}
+
+	// Reject responses missing required fields instead of saving zero values
+	if response.Confidence == nil {
+		return nil, fmt.Errorf("%w: missing confidence", ErrInvalidAnalysis)
+	}
+	if strings.TrimSpace(response.Reasoning) == "" {
+		return nil, fmt.Errorf("%w: missing reasoning", ErrInvalidAnalysis)
+	}
+	action := strings.ToUpper(strings.TrimSpace(response.Action))
+	if action == "" {
+		// A reasoned answer without a verdict is treated as no change of position
+		action = "HOLD"
+	}
+	if !validActions[action] {
+		return nil, fmt.Errorf("%w: invalid action %q", ErrInvalidAnalysis, response.Action)
+	}
+	confidence := math.Max(0, math.Min(1, *response.Confidence))
+
+	// Blank entries don't count as risks
+	var risks []string
+	for _, risk := range response.Risks {
+		if risk = strings.TrimSpace(risk); risk != "" {
+			risks = append(risks, risk)
+		}
 	}
 
 	return &models.AnalysisResponse{
 		Symbol:       symbol,
-		Action:       response.Action,
-		Confidence:   response.Confidence,
+		Action:       action,
+		Confidence:   confidence,
 		Reasoning:    response.Reasoning,
 		PriceTargets: response.PriceTargets,
-		Risks:        response.Risks,
+		Risks:        risks,
 		Timeframe:    response.Timeframe,
 		GeneratedAt:  time.Now(),
+		Incomplete:   len(risks) == 0,
 	}, nil
 }
+
+// stripCodeFence returns the body of the first markdown code block in text, dropping
+// its language tag, or text unchanged if it has no fence
+func stripCodeFence(text string) string {
+	start := strings.Index(text, "```")
+	if start < 0 {
+		return text
+	}
+	body := text[start+3:]
+	if nl := strings.IndexByte(body, '\n'); nl >= 0 && !strings.ContainsAny(body[:nl], "{[") {
+		body = body[nl+1:]
+	}
+	if end := strings.Index(body, "```"); end >= 0 {
+		body = body[:end]
+	}
+	return strings.TrimSpace(body)
+}
+
+// extractJSONObject returns the first balanced {...} object in text, skipping braces
+// inside JSON strings
+func extractJSONObject(text string) (string, bool) {
+	start := strings.IndexByte(text, '{')
+	if start < 0 {
+		return "", false
+	}
+
+	depth, inString, escaped := 0, false, false
+	for i := start; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && ch == '\\':
+			escaped = true
+		case ch == '"':
+			inString = !inString
+		case inString:
+		case ch == '{':
+			depth++
+		case ch == '}':
+			depth--
+			if depth == 0 {
+				return text[start : i+1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// readStream collects a streamed chat completion, forwarding each content delta
+func (o *OpenAI) readStream(ctx context.Context, body io.Reader, chunks chan<- string) (string, models.AIUsage, error) {
+	var content strings.Builder
+	var promptTokens, completionTokens int
+	err := readEventStream(body, func(data []byte) error {
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		if event.Usage != nil {
+			promptTokens, completionTokens = event.Usage.PromptTokens, event.Usage.CompletionTokens
+		}
+		for _, choice := range event.Choices {
+			content.WriteString(choice.Delta.Content)
+			if err := sendChunk(ctx, chunks, choice.Delta.Content); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	usage := recordUsage(ctx, o.Name(), o.model, promptTokens, completionTokens)
+	if err != nil {
+		return "", usage, err
+	}
+	if content.Len() == 0 {
+		return "", usage, ErrAnalysisFailed
+	}
+	return content.String(), usage, nil
+}
@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseAnalysisResponse(t *testing.T) {
+	cases := []struct {
+		name       string
+		content    string
+		action     string
+		confidence float64
+		risks      []string
+		incomplete bool
+	}{
+		{"plain", `{"action":"buy","confidence":0.7,"reasoning":"Breakout","risks":["earnings next week"," "]}`, "BUY", 0.7, []string{"earnings next week"}, false},
+		{"no risks", `{"action":"SELL","confidence":0.6,"reasoning":"Breakdown","risks":[]}`, "SELL", 0.6, nil, true},
+		{"blank risks only", `{"action":"SELL","confidence":0.6,"reasoning":"Breakdown","risks":["", "  "]}`, "SELL", 0.6, nil, true},
+		{"fenced", "```json\n{\"action\":\"HOLD\",\"confidence\":0.5,\"reasoning\":\"Range\",\"risks\":[\"a\"]}\n```", "HOLD", 0.5, []string{"a"}, false},
+		{"wrapped in prose", `Here is my view: {"action":"WATCH","confidence":1.4,"reasoning":"Wait {for} it","risks":["b"]} Hope that helps.`, "WATCH", 1, []string{"b"}, false},
+		{"no action", `{"confidence":0.4,"reasoning":"Mixed","risks":["c"]}`, "HOLD", 0.4, []string{"c"}, false},
+	}
+	for _, c := range cases {
+		got, err := parseAnalysisResponse("AAPL", c.content)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if got.Symbol != "AAPL" || got.Action != c.action || got.Confidence != c.confidence || !slices.Equal(got.Risks, c.risks) || got.Incomplete != c.incomplete {
+			t.Errorf("%s: got %s at %v with risks %q (incomplete %v), want %s at %v with %q (incomplete %v)",
+				c.name, got.Action, got.Confidence, got.Risks, got.Incomplete, c.action, c.confidence, c.risks, c.incomplete)
+		}
+	}
+}
+
+func TestParseAnalysisResponseRejects(t *testing.T) {
+	cases := []struct {
+		name, content string
+		want          error
+	}{
+		{"not JSON", "I can't analyze that.", ErrAnalysisFailed},
+		{"missing confidence", `{"action":"BUY","reasoning":"Breakout"}`, ErrInvalidAnalysis},
+		{"missing reasoning", `{"action":"BUY","confidence":0.7,"reasoning":" "}`, ErrInvalidAnalysis},
+		{"invalid action", `{"action":"YOLO","confidence":0.7,"reasoning":"Breakout"}`, ErrInvalidAnalysis},
+	}
+	for _, c := range cases {
+		if _, err := parseAnalysisResponse("AAPL", c.content); !errors.Is(err, c.want) {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package ai
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+//go:embed prompts/analysis.tmpl
+var promptFS embed.FS
+
+// defaultPromptName is the template used when no risk profile or trade frequency
+// template matches
+const defaultPromptName = "analysis"
+
+// defaultPrompt is the embedded analysis prompt, the fallback for every template
+var defaultPrompt = template.Must(template.ParseFS(promptFS, "prompts/analysis.tmpl")).Lookup("analysis.tmpl")
+
+// Analysis prompt overrides keyed by template name: fileTemplates are loaded by
+// LoadPromptTemplates and storedTemplates, which win over a file of the same name, by
+// SetStoredPromptTemplates
+var (
+	fileTemplates   = map[string]*template.Template{}
+	storedTemplates = map[string]*template.Template{}
+	promptMu        sync.RWMutex
+)
+
+// promptData is what analysis prompt templates render: the request's fields, its risk
+// profile and trade frequency, and the prompt's preformatted sections
+type promptData struct {
+	models.AnalysisRequest
+	Risk      models.RiskProfile
+	Frequency models.TradeFrequencyProfile
+	Currency  string // the currency prices are in; see RequestCurrency
+	Price     string // current price, formatted in Currency, e.g. "£12.34"
+	Actions   string // the JSON action choices, e.g. "BUY" | "SELL" | "HOLD" | "WATCH"
+	Sections  promptSections
+}
+
+// promptSections are the prompt's optional parts, each empty when the request has
+// nothing for it and otherwise starting on a new line
+type promptSections struct {
+	Session, YearRange, History, Timeframes, Levels, Indicators string
+	VWAP, Benchmark, Position                                   string
+	Crypto, DetailLevel, RiskReview                             string // instructions
+}
+
+// LoadPromptTemplates loads analysis prompt overrides from dir's *.tmpl files. A file
+// is named after what it applies to, most specific first: "<risk>_<frequency>" (e.g.
+// conservative_daily), "<risk>", "<frequency>" or "analysis" for every analysis.
+// Templates are checked by rendering a sample request, so a broken one fails here
+// rather than at analysis time. An empty dir keeps the embedded prompt only.
+func LoadPromptTemplates(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]*template.Template, len(paths))
+	for _, path := range paths {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		tmpl, err := parsePromptTemplate(strings.TrimSuffix(filepath.Base(path), ".tmpl"), string(text))
+		if err != nil {
+			return fmt.Errorf("prompt template %s: %w", path, err)
+		}
+		loaded[tmpl.Name()] = tmpl
+	}
+	promptMu.Lock()
+	fileTemplates = loaded
+	promptMu.Unlock()
+	return nil
+}
+
+// SetStoredPromptTemplates replaces the database-stored prompt overrides with texts,
+// keyed by template name as in LoadPromptTemplates. A stored template wins over a file
+// of the same name. Templates that fail ValidatePromptTemplate are left out and
+// reported in the error; the rest are still used.
+func SetStoredPromptTemplates(texts map[string]string) error {
+	names := make([]string, 0, len(texts))
+	for name := range texts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	loaded := make(map[string]*template.Template, len(texts))
+	var errs []error
+	for _, name := range names {
+		tmpl, err := parsePromptTemplate(name, texts[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("stored prompt template %s: %w", name, err))
+			continue
+		}
+		loaded[name] = tmpl
+	}
+	promptMu.Lock()
+	storedTemplates = loaded
+	promptMu.Unlock()
+	return errors.Join(errs...)
+}
+
+// ValidatePromptTemplate checks that text parses and renders a sample request and that
+// name is one a template can be looked up by
+func ValidatePromptTemplate(name, text string) error {
+	_, err := parsePromptTemplate(name, text)
+	return err
+}
+
+// parsePromptTemplate parses a prompt override, rendering a sample request so a broken
+// template fails when it's loaded rather than at analysis time
+func parsePromptTemplate(name, text string) (*template.Template, error) {
+	if !validPromptName(name) {
+		return nil, errors.New("name must be analysis, a risk profile, a trade frequency or <risk>_<frequency>")
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, samplePromptData()); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// validPromptName reports whether name is one a prompt template can be looked up by
+func validPromptName(name string) bool {
+	if name == defaultPromptName {
+		return true
+	}
+	risk, freq, found := strings.Cut(name, "_")
+	_, knownRisk := models.RiskProfiles[risk]
+	_, knownFreq := models.TradeFrequencyProfiles[freq]
+	if found {
+		return knownRisk && knownFreq
+	}
+	_, isFreq := models.TradeFrequencyProfiles[name]
+	return knownRisk || isFreq
+}
+
+// promptTemplate picks the override for a risk profile and trade frequency, most
+// specific first and a stored one before a file, or the embedded default
+func promptTemplate(risk, freq string) *template.Template {
+	promptMu.RLock()
+	defer promptMu.RUnlock()
+	for _, name := range []string{risk + "_" + freq, risk, freq, defaultPromptName} {
+		if tmpl, ok := storedTemplates[name]; ok {
+			return tmpl
+		}
+		if tmpl, ok := fileTemplates[name]; ok {
+			return tmpl
+		}
+	}
+	return defaultPrompt
+}
+
+// PromptTemplateName names the template BuildPrompt uses for a risk profile and trade
+// frequency, "analysis" for the embedded default
+func PromptTemplateName(risk, freq string) string {
+	tmpl := promptTemplate(risk, freq)
+	if tmpl == defaultPrompt {
+		return defaultPromptName
+	}
+	return tmpl.Name()
+}
+
+// renderPrompt renders the request's prompt template, falling back to the embedded
+// default if it fails so a bad override can't fail the analysis
+func renderPrompt(req models.AnalysisRequest) string {
+	data := newPromptData(req)
+	tmpl := promptTemplate(req.RiskProfile, req.TradeFrequency)
+
+	var prompt strings.Builder
+	err := tmpl.Execute(&prompt, data)
+	if err != nil && tmpl != defaultPrompt {
+		slog.Warn("prompt template failed, using the default", "template", tmpl.Name(), "error", err)
+		prompt.Reset()
+		err = defaultPrompt.Execute(&prompt, data)
+	}
+	if err != nil {
+		// The embedded template renders every request; this would be a bug
+		slog.Error("default prompt template failed", "error", err)
+	}
+	return strings.TrimRight(prompt.String(), "\n")
+}
+
+// RequestCurrency is the currency an analysis request's prices are in: its quote's as
+// the provider reported it, or the one its symbol implies
+func RequestCurrency(req models.AnalysisRequest) string {
+	if req.Quote != nil && req.Quote.Currency != "" {
+		return req.Quote.Currency
+	}
+	return market.SymbolCurrency(req.Symbol)
+}
+
+// newPromptData formats the request's prompt sections
+func newPromptData(req models.AnalysisRequest) promptData {
+	currency := RequestCurrency(req)
+	data := promptData{
+		AnalysisRequest: req,
+		Risk:            models.RiskProfiles[req.RiskProfile],
+		Frequency:       models.TradeFrequencyProfiles[req.TradeFrequency],
+		Currency:        currency,
+		Price:           market.FormatPrice(req.CurrentPrice, currency),
+		Actions:         `"BUY" | "SELL" | "HOLD" | "WATCH"`,
+	}
+	sections := &data.Sections
+	sections.Session = formatSession(req.Quote, currency)
+	sections.YearRange = formatYearRange(req, currency)
+	if len(req.HistoricalData) > 0 {
+		sections.History = formatHistoricalSummary(req.HistoricalData, currency)
+	}
+	if len(req.Timeframes) > 0 {
+		sections.Timeframes = formatTimeframes(req.Timeframes, req.TradeFrequency, currency)
+	}
+	if len(req.Levels) > 0 {
+		sections.Levels = formatLevels(req.Levels, currency)
+	}
+	if req.Indicators != nil {
+		sections.Indicators = formatIndicators(*req.Indicators)
+	}
+	if req.VWAP != nil {
+		sections.VWAP = formatVWAP(*req.VWAP, req.CurrentPrice, currency)
+	}
+	if req.Benchmark != nil {
+		sections.Benchmark = formatBenchmark(req.Symbol, *req.Benchmark)
+	}
+	if req.Position != nil {
+		sections.Position = formatPosition(*req.Position, req.CurrentPrice, currency)
+	}
+	if market.IsCrypto(req.Symbol) {
+		sections.Crypto = cryptoInstruction
+	}
+	sections.DetailLevel = detailLevels[req.DetailLevel].instruction
+	if req.RiskReview {
+		sections.RiskReview = riskReviewInstruction
+		data.Actions = `"SELL" | "HOLD"`
+	}
+	return data
+}
+
+// samplePromptData is a request with every section filled in, for checking templates
+func samplePromptData() promptData {
+	price, vwap, beta, relative := 100.0, 99.5, 1.1, 2.5
+	return newPromptData(models.AnalysisRequest{
+		Symbol:         "SAMPLE",
+		CurrentPrice:   price,
+		HistoricalData: []models.Candle{{Open: 99, High: 101, Low: 98, Close: price, Volume: 1000}},
+		RiskProfile:    "moderate",
+		TradeFrequency: "weekly",
+		UserContext:    "sample notes",
+		DetailLevel:    "detailed",
+		Quote:          &models.Quote{Symbol: "SAMPLE", Price: price, Open: 99, High: 101, Low: 98, PreviousClose: 99},
+		Timeframes:     []models.TimeframeData{{Period: "1y", Candles: []models.Candle{{Close: price}}}},
+		Levels:         []models.PriceLevel{{Kind: "support", Price: 95, Touches: 2}},
+		Indicators:     &models.Indicators{},
+		VWAP:           &vwap,
+		Benchmark:      &models.BenchmarkComparison{Symbol: "SPY", Beta: &beta, Period: "1m", RelativeStrength: &relative},
+		Position:       &models.Position{Symbol: "SAMPLE", Quantity: 10, AvgCost: 90},
+		MarketContext:  "sample sector performance\n",
+		RetryHint:      "sample retry hint",
+		RiskReview:     true,
+
+		TranscriptSummary: "sample transcript summary",
+	})
+}
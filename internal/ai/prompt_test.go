@@ -0,0 +1,42 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"stockmarket/internal/models"
+)
+
+// TestPromptCurrency checks that an LSE prompt and its guardrail messages price
+// everything in pence, with no dollar amounts mixed in
+func TestPromptCurrency(t *testing.T) {
+	vwap := 70.5
+	req := models.AnalysisRequest{
+		Symbol:           "VOD.L",
+		CurrentPrice:     71.5,
+		HistoricalData:   []models.Candle{{Open: 70, High: 72, Low: 69, Close: 71.5, Volume: 1000}},
+		RiskProfile:      "moderate",
+		TradeFrequency:   "weekly",
+		Quote:            &models.Quote{Symbol: "VOD.L", Price: 71.5, Open: 70, High: 72, Low: 69, PreviousClose: 70, Currency: "GBp"},
+		FiftyTwoWeekHigh: 90,
+		FiftyTwoWeekLow:  60,
+		Levels:           []models.PriceLevel{{Kind: "support", Price: 68, Touches: 3}},
+		VWAP:             &vwap,
+		Position:         &models.Position{Symbol: "VOD.L", Quantity: 100, AvgCost: 65},
+	}
+
+	prompt := BuildPrompt(req)
+	for _, want := range []string{"Current Price: 71.50p", "Open 70.00p", "52-Week Range: 60.00p - 90.00p", "support at 68.00p", "VWAP (from today's intraday bars): 70.50p", "average cost of 65.00p"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt lacks %q", want)
+		}
+	}
+	if strings.Contains(prompt, "$") {
+		t.Errorf("prompt mixes in dollar amounts:\n%s", prompt)
+	}
+
+	violations := CheckPriceTargets(models.PriceTargets{Target: 500}, req.CurrentPrice, 3, RequestCurrency(req))
+	if len(violations) != 1 || violations[0] != "target 500.00p vs current 71.50p" {
+		t.Errorf("violations = %q, want the target priced in pence", violations)
+	}
+}
@@ -0,0 +1,88 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"stockmarket/internal/models"
+)
+
+// StreamAnalyzer is implemented by analyzers whose provider can stream the reply
+// while it's generated
+type StreamAnalyzer interface {
+	// AnalyzeStream analyzes like Analyze, sending reply text to chunks as it arrives
+	AnalyzeStream(ctx context.Context, req models.AnalysisRequest, chunks chan<- string) (*models.AnalysisResponse, error)
+}
+
+// AnalyzeStream runs an analysis, sending the reply text to chunks as it arrives.
+// Analyzers that can't stream send the whole reply as a single chunk once it's done.
+// Sends give up when ctx is done, so chunks needn't be drained after a cancel.
+func AnalyzeStream(ctx context.Context, analyzer Analyzer, req models.AnalysisRequest, chunks chan<- string) (*models.AnalysisResponse, error) {
+	if streamer, ok := analyzer.(StreamAnalyzer); ok {
+		return streamer.AnalyzeStream(ctx, req, chunks)
+	}
+	analysis, err := analyzer.Analyze(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := sendChunk(ctx, chunks, analysis.RawResponse); err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
+
+// sendChunk sends non-empty text to chunks unless ctx is done first
+func sendChunk(ctx context.Context, chunks chan<- string, text string) error {
+	if text == "" {
+		return nil
+	}
+	select {
+	case chunks <- text:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// maxStreamLine bounds one line of a streamed reply
+const maxStreamLine = 1 << 20
+
+// readEventStream calls fn with the data of each server-sent event in r until the
+// stream ends or sends OpenAI's "[DONE]" marker
+func readEventStream(r io.Reader, fn func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return nil
+		}
+		if err := fn([]byte(data)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readJSONLines calls fn with each line of a newline-delimited JSON stream, as Ollama sends
+func readJSONLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || !json.Valid(line) {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
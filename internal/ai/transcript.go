@@ -0,0 +1,29 @@
+package ai
+
+import (
+	"context"
+	"strings"
+)
+
+// maxTranscriptChars caps how much transcript text is sent for summarization
+const maxTranscriptChars = 24000
+
+// SummarizeTranscript condenses an earnings-call transcript into sentiment bullet points
+func SummarizeTranscript(ctx context.Context, completer Completer, symbol, quarter, transcript string) (string, error) {
+	if len(transcript) > maxTranscriptChars {
+		transcript = transcript[:maxTranscriptChars]
+	}
+
+	prompt := `You are an equity analyst. Summarize the sentiment of the following ` + symbol + ` earnings call transcript (` + quarter + `).
+
+Respond with 3-6 short bullet points starting with "- " covering management tone, guidance, and notable risks or opportunities. Finish with one line "Overall sentiment: positive | neutral | negative".
+
+Transcript:
+` + transcript
+
+	summary, err := completer.Complete(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(summary), nil
+}
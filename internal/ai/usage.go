@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// ModelPrice is a model's list price in USD per million tokens
+type ModelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// modelPrices are list prices keyed by model-name prefix; the longest matching
+// prefix wins so dated snapshots (e.g. "claude-3-5-sonnet-20241022") resolve
+var modelPrices = map[string]ModelPrice{
+	"gpt-4o":            {2.50, 10.00},
+	"gpt-4o-mini":       {0.15, 0.60},
+	"gpt-4-turbo":       {10.00, 30.00},
+	"gpt-4":             {30.00, 60.00},
+	"gpt-3.5-turbo":     {0.50, 1.50},
+	"claude-opus-4":     {15.00, 75.00},
+	"claude-sonnet-4":   {3.00, 15.00},
+	"claude-3-7-sonnet": {3.00, 15.00},
+	"claude-3-opus":     {15.00, 75.00},
+	"claude-3-sonnet":   {3.00, 15.00},
+	"claude-3-5-sonnet": {3.00, 15.00},
+	"claude-3-5-haiku":  {0.80, 4.00},
+	"claude-3-haiku":    {0.25, 1.25},
+	"gemini-pro":        {0.50, 1.50},
+	"gemini-1.5-pro":    {1.25, 5.00},
+	"gemini-1.5-flash":  {0.075, 0.30},
+}
+
+// unknownModelPrice is charged for models missing from the price table, so a
+// budget cap still applies to them
+var unknownModelPrice = ModelPrice{Input: 10.00, Output: 30.00}
+
+// UsageRecorder, if set, receives the token usage of every completion
+var UsageRecorder func(models.AIUsage)
+
+// noUsageKey marks a context whose completions aren't reported to UsageRecorder
+type noUsageKey struct{}
+
+// WithoutUsage returns a context whose completions aren't reported to UsageRecorder, so
+// dry runs don't count toward usage totals or the monthly budget
+func WithoutUsage(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noUsageKey{}, true)
+}
+
+// Cost estimates the USD cost of a completion
+func Cost(model string, inputTokens, outputTokens int) float64 {
+	price, matched := unknownModelPrice, 0
+	for prefix, p := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > matched {
+			price, matched = p, len(prefix)
+		}
+	}
+	return (float64(inputTokens)*price.Input + float64(outputTokens)*price.Output) / 1e6
+}
+
+// SetModelPrice overrides or adds the price of models matching a name prefix.
+// It must be called before any completions run.
+func SetModelPrice(prefix string, price ModelPrice) {
+	modelPrices[prefix] = price
+}
+
+// recordUsage prices a completion's token usage and reports it to UsageRecorder unless
+// ctx is marked WithoutUsage. Local models are free.
+func recordUsage(ctx context.Context, provider, model string, inputTokens, outputTokens int) models.AIUsage {
+	usage := models.AIUsage{
+		Provider:     provider,
+		Model:        model,
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+		CreatedAt:    time.Now(),
+	}
+	if RequiresAPIKey(provider) {
+		usage.Cost = Cost(model, inputTokens, outputTokens)
+	}
+	if UsageRecorder != nil && ctx.Value(noUsageKey{}) == nil {
+		UsageRecorder(usage)
+	}
+	return usage
+}
+
+// applyUsage records a completion's usage on the analysis it produced
+func applyUsage(analysis *models.AnalysisResponse, usage models.AIUsage) {
+	analysis.PromptTokens = usage.InputTokens
+	analysis.CompletionTokens = usage.OutputTokens
+	analysis.CostUSD = usage.Cost
+}
+
+// AddUsage folds the usage of an earlier, discarded analysis into the one that replaced it,
+// so retried analyses report everything they cost
+func AddUsage(analysis, discarded *models.AnalysisResponse) {
+	analysis.PromptTokens += discarded.PromptTokens
+	analysis.CompletionTokens += discarded.CompletionTokens
+	analysis.CostUSD += discarded.CostUSD
+}
@@ -0,0 +1,19 @@
+package analytics
+
+import "stockmarket/internal/models"
+
+// Beta is the slope of symbol returns against benchmark returns: their covariance
+// divided by the benchmark's variance. The series must be equal-length and aligned
+// by period; ok is false when they're too short or the benchmark has zero variance.
+func Beta(symbolReturns, benchmarkReturns []float64) (beta float64, ok bool) {
+	cov, _, varB, ok := covariance(symbolReturns, benchmarkReturns)
+	if !ok || varB == 0 {
+		return 0, false
+	}
+	return cov / varB, true
+}
+
+// AlignedBeta computes beta from two symbols' daily returns over the days both have
+func AlignedBeta(symbol, benchmark []models.Candle) (beta float64, ok bool) {
+	return Beta(AlignedReturns(symbol, benchmark))
+}
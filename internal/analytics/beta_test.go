@@ -0,0 +1,51 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBeta(t *testing.T) {
+	benchmark := []float64{0.01, -0.02, 0.015, 0.005, -0.01}
+	doubled := make([]float64, len(benchmark))
+	for i, r := range benchmark {
+		doubled[i] = 2 * r
+	}
+
+	for _, tc := range []struct {
+		name              string
+		symbol, benchmark []float64
+		want              float64
+		ok                bool
+	}{
+		{"twice the benchmark", doubled, benchmark, 2, true},
+		{"the benchmark itself", benchmark, benchmark, 1, true},
+		// Deviations (-1, 0, 1) against (-1, 1, 0): covariance 1 over variance 2
+		{"reference", []float64{1, 2, 3}, []float64{1, 3, 2}, 0.5, true},
+		{"flat symbol", []float64{0.01, 0.01, 0.01}, []float64{0.01, -0.02, 0.015}, 0, true},
+		{"mismatched length", doubled, benchmark[:4], 0, false},
+		{"too short", doubled[:2], benchmark[:2], 0, false},
+		{"zero-variance benchmark", doubled[:3], []float64{0.01, 0.01, 0.01}, 0, false},
+	} {
+		beta, ok := Beta(tc.symbol, tc.benchmark)
+		if ok != tc.ok || math.Abs(beta-tc.want) > 1e-9 {
+			t.Errorf("%s: Beta = %v, %v, want %v, %v", tc.name, beta, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+// TestAlignedBeta checks beta from candles: the symbol's daily returns are exactly
+// twice the benchmark's (+20%, -10%, +4%, -20% against +10%, -5%, +2%, -10%)
+func TestAlignedBeta(t *testing.T) {
+	start := time.Date(2024, 3, 4, 21, 0, 0, 0, time.UTC)
+	symbol := daily(start, 100, 120, 108, 112.32, 89.856)
+	benchmark := daily(start, 100, 110, 104.5, 106.59, 95.931)
+
+	if beta, ok := AlignedBeta(symbol, benchmark); !ok || math.Abs(beta-2) > 1e-9 {
+		t.Errorf("AlignedBeta = %v, %v, want 2", beta, ok)
+	}
+	if _, ok := AlignedBeta(symbol, benchmark[3:]); ok {
+		t.Error("AlignedBeta over one shared return, want not ok")
+	}
+}
@@ -0,0 +1,115 @@
+// Package analytics contains pure calculations over market data
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	"stockmarket/internal/models"
+)
+
+// dateKey is the layout used to align candles from different symbols by trading day
+const dateKey = "2006-01-02"
+
+// minOverlap is the fewest shared return observations needed for a correlation
+const minOverlap = 3
+
+// AlignedReturns computes the close-to-close returns of two symbols over only the
+// trading days both have, in date order, so a day missing from one of them can't pair
+// its two-day return with the other's one-day return. Candles may be in any order; the
+// last one of a day is its close, and pairs with a non-positive previous close are skipped.
+func AlignedReturns(a, b []models.Candle) (as, bs []float64) {
+	closesA, closesB := dailyCloses(a), dailyCloses(b)
+	days := make([]string, 0, len(closesA))
+	for day := range closesA {
+		if _, found := closesB[day]; found {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+
+	for i := 1; i < len(days); i++ {
+		prevA, prevB := closesA[days[i-1]], closesB[days[i-1]]
+		if prevA <= 0 || prevB <= 0 {
+			continue
+		}
+		as = append(as, closesA[days[i]]/prevA-1)
+		bs = append(bs, closesB[days[i]]/prevB-1)
+	}
+	return as, bs
+}
+
+// dailyCloses maps each trading day to the close of its last candle
+func dailyCloses(candles []models.Candle) map[string]float64 {
+	sorted := append([]models.Candle{}, candles...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	closes := make(map[string]float64, len(sorted))
+	for _, c := range sorted {
+		closes[c.Timestamp.Format(dateKey)] = c.Close
+	}
+	return closes
+}
+
+// Pearson computes the Pearson correlation coefficient of two equal-length series.
+// ok is false when the series are too short or either has zero variance.
+func Pearson(xs, ys []float64) (r float64, ok bool) {
+	cov, varX, varY, ok := covariance(xs, ys)
+	if !ok || varX == 0 || varY == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(varX*varY), true
+}
+
+// covariance sums the co-deviations of two equal-length series from their means, and
+// each one's squared deviations. ok is false when the series are too short to compare.
+func covariance(xs, ys []float64) (cov, varX, varY float64, ok bool) {
+	n := len(xs)
+	if n != len(ys) || n < minOverlap {
+		return 0, 0, 0, false
+	}
+
+	var meanX, meanY float64
+	for i := 0; i < n; i++ {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+
+	for i := 0; i < n; i++ {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	return cov, varX, varY, true
+}
+
+// AlignedCorrelation correlates two symbols' daily returns over the days both have
+func AlignedCorrelation(a, b []models.Candle) (r float64, ok bool) {
+	return Pearson(AlignedReturns(a, b))
+}
+
+// CorrelationMatrix computes pairwise correlations of daily returns for the given
+// symbols, in order. Entries are nil when two symbols don't overlap enough.
+func CorrelationMatrix(symbols []string, candles map[string][]models.Candle) [][]*float64 {
+	matrix := make([][]*float64, len(symbols))
+	for i := range symbols {
+		matrix[i] = make([]*float64, len(symbols))
+	}
+	for i := range symbols {
+		for j := i; j < len(symbols); j++ {
+			r, ok := AlignedCorrelation(candles[symbols[i]], candles[symbols[j]])
+			if !ok {
+				continue
+			}
+			r = math.Round(r*10000) / 10000
+			matrix[i][j] = &r
+			matrix[j][i] = &r
+		}
+	}
+	return matrix
+}
@@ -0,0 +1,100 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// approxEqual compares computed values to their reference to 1e-9
+func approxEqual(t *testing.T, name string, got, want []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d values, want %d: %v", name, len(got), len(want), got)
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("%s[%d] = %.9f, want %.9f", name, i, got[i], want[i])
+		}
+	}
+}
+
+// daily builds one candle per day from start, skipping days whose close is 0
+func daily(start time.Time, closes ...float64) []models.Candle {
+	var candles []models.Candle
+	for i, c := range closes {
+		if c == 0 {
+			continue
+		}
+		candles = append(candles, models.Candle{Timestamp: start.AddDate(0, 0, i), Close: c})
+	}
+	return candles
+}
+
+func TestPearson(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		xs, ys []float64
+		want   float64
+		ok     bool
+	}{
+		{"proportional", []float64{1, 2, 3}, []float64{2, 4, 6}, 1, true},
+		{"inverse", []float64{1, 2, 3}, []float64{3, 2, 1}, -1, true},
+		// Deviations (-1.5, -0.5, 0.5, 1.5) and (-1.5, 0.5, -0.5, 1.5): covariance 4
+		// over sqrt(5 * 5)
+		{"partial", []float64{1, 2, 3, 4}, []float64{1, 3, 2, 4}, 0.8, true},
+		{"too short", []float64{1, 2}, []float64{2, 4}, 0, false},
+		{"mismatched length", []float64{1, 2, 3}, []float64{1, 2, 3, 4}, 0, false},
+		{"zero variance", []float64{1, 1, 1}, []float64{1, 2, 3}, 0, false},
+	} {
+		r, ok := Pearson(tc.xs, tc.ys)
+		if ok != tc.ok || math.Abs(r-tc.want) > 1e-9 {
+			t.Errorf("%s: Pearson = %v, %v, want %v, %v", tc.name, r, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+// TestAlignedReturnsGap checks that a day missing from one symbol is dropped from both
+// series, so each pair of returns covers the same span. Both symbols move +10%, +10%,
+// +10%, -10% a day; without the gapped day the aligned returns are +10%, +21%, -10%.
+func TestAlignedReturnsGap(t *testing.T) {
+	start := time.Date(2024, 3, 4, 21, 0, 0, 0, time.UTC)
+	a := daily(start, 100, 110, 121, 133.1, 119.79)
+	b := daily(start, 50, 55, 0, 66.55, 59.895)
+
+	as, bs := AlignedReturns(a, b)
+	approxEqual(t, "a", as, []float64{0.1, 0.21, -0.1})
+	approxEqual(t, "b", bs, []float64{0.1, 0.21, -0.1})
+
+	if r, ok := AlignedCorrelation(a, b); !ok || math.Abs(r-1) > 1e-9 {
+		t.Errorf("AlignedCorrelation = %v, %v, want 1", r, ok)
+	}
+}
+
+func TestCorrelationMatrix(t *testing.T) {
+	start := time.Date(2024, 3, 4, 21, 0, 0, 0, time.UTC)
+	candles := map[string][]models.Candle{
+		"AAA":  daily(start, 100, 110, 121, 133.1, 119.79),
+		"BBB":  daily(start, 100, 90, 81, 72.9, 80.19),
+		"NEW":  daily(start.AddDate(0, 0, 3), 10, 11),
+		"FLAT": daily(start, 5, 5, 5, 5, 5),
+	}
+	matrix := CorrelationMatrix([]string{"AAA", "BBB", "NEW", "FLAT"}, candles)
+
+	if matrix[0][0] == nil || *matrix[0][0] != 1 {
+		t.Errorf("AAA with itself = %v, want 1", matrix[0][0])
+	}
+	if matrix[0][1] == nil || *matrix[0][1] != -1 || matrix[1][0] != matrix[0][1] {
+		t.Errorf("AAA with BBB = %v / %v, want -1 both ways", matrix[0][1], matrix[1][0])
+	}
+	for j := range matrix {
+		if matrix[2][j] != nil {
+			t.Errorf("NEW overlaps too little to correlate, got %v at %d", *matrix[2][j], j)
+		}
+		if matrix[3][j] != nil {
+			t.Errorf("FLAT has no variance to correlate, got %v at %d", *matrix[3][j], j)
+		}
+	}
+}
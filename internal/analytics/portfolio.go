@@ -0,0 +1,42 @@
+package analytics
+
+import "stockmarket/internal/models"
+
+// Valuate prices positions at their quotes and totals unrealized P&L. A position
+// without a quote is kept unpriced with its error from errs (or a generic one) and
+// leaves the portfolio Partial; totals then cover only the priced positions.
+func Valuate(positions []models.Position, quotes map[string]models.Quote, errs map[string]string) models.Portfolio {
+	portfolio := models.Portfolio{Positions: make([]models.PortfolioPosition, 0, len(positions))}
+	for _, p := range positions {
+		pp := models.PortfolioPosition{Position: p, CostBasis: p.Quantity * p.AvgCost}
+
+		quote, ok := quotes[p.Symbol]
+		if !ok || quote.Price <= 0 {
+			pp.Error = errs[p.Symbol]
+			if pp.Error == "" {
+				pp.Error = "quote unavailable"
+			}
+			portfolio.Partial = true
+			portfolio.Positions = append(portfolio.Positions, pp)
+			continue
+		}
+
+		price := quote.Price
+		value := p.Quantity * price
+		pl := value - pp.CostBasis
+		pp.Price, pp.MarketValue, pp.UnrealizedPL = &price, &value, &pl
+		if pp.CostBasis > 0 {
+			pct := pl / pp.CostBasis * 100
+			pp.UnrealizedPLPercent = &pct
+		}
+
+		portfolio.CostBasis += pp.CostBasis
+		portfolio.MarketValue += value
+		portfolio.UnrealizedPL += pl
+		portfolio.Positions = append(portfolio.Positions, pp)
+	}
+	if portfolio.CostBasis > 0 {
+		portfolio.UnrealizedPLPercent = portfolio.UnrealizedPL / portfolio.CostBasis * 100
+	}
+	return portfolio
+}
@@ -0,0 +1,27 @@
+package analytics
+
+import (
+	"sort"
+
+	"stockmarket/internal/models"
+)
+
+// PeriodReturn is the close-to-close return over the last n candles, in percent.
+// ok is false when there aren't enough candles. Candles may be in any order.
+func PeriodReturn(candles []models.Candle, n int) (pct float64, ok bool) {
+	if n < 1 || len(candles) <= n {
+		return 0, false
+	}
+
+	sorted := append([]models.Candle{}, candles...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	last := sorted[len(sorted)-1].Close
+	base := sorted[len(sorted)-1-n].Close
+	if base <= 0 {
+		return 0, false
+	}
+	return (last/base - 1) * 100, true
+}
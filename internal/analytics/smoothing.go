@@ -0,0 +1,9 @@
+package analytics
+
+import "math"
+
+// EWMA folds a new observation into an exponentially weighted moving average.
+// alpha is the weight of the new observation, in (0, 1].
+func EWMA(prev, current, alpha float64) float64 {
+	return math.Round((alpha*current+(1-alpha)*prev)*10000) / 10000
+}
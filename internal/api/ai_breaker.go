@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"stockmarket/internal/ai"
+	"stockmarket/internal/apperr"
+)
+
+// errAIUnavailable is returned instead of calling an AI provider whose breaker is open
+var errAIUnavailable = apperr.New(apperr.AIUnavailable, "AI provider temporarily unavailable")
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// aiBreaker is a circuit breaker per AI provider, shared by every request. A run of
+// consecutive failures opens a provider's circuit, and calls then fail fast until the
+// cooldown ends; the first call after it is a trial that closes the circuit on success
+// and reopens it on failure, while other calls keep failing fast.
+type aiBreaker struct {
+	threshold int // consecutive failures that open the circuit; 0 disables the breaker
+	window    time.Duration
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	circuits map[string]*aiCircuit
+}
+
+// aiCircuit is one provider's breaker state
+type aiCircuit struct {
+	state     string
+	failures  int       // consecutive failures while closed
+	firstFail time.Time // when the current run of failures started
+	openedAt  time.Time
+	trial     bool // a half-open trial call is in flight
+}
+
+func newAIBreaker(threshold int, window, cooldown time.Duration) *aiBreaker {
+	return &aiBreaker{threshold: threshold, window: window, cooldown: cooldown, circuits: make(map[string]*aiCircuit)}
+}
+
+// allow reports whether a call to provider may go ahead, returning errAIUnavailable
+// with the time left in the cooldown when its circuit is open
+func (b *aiBreaker) allow(provider string) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[provider]
+	if !ok {
+		return nil
+	}
+	switch c.state {
+	case breakerOpen:
+		if wait := b.cooldown - time.Since(c.openedAt); wait > 0 {
+			return fmt.Errorf("%w (retry in %s)", errAIUnavailable, wait.Round(time.Second))
+		}
+		c.state, c.trial = breakerHalfOpen, true
+		slog.Info("AI circuit breaker half-open, trying a request", "provider", provider)
+		return nil
+	case breakerHalfOpen:
+		if c.trial {
+			return errAIUnavailable
+		}
+		c.trial = true
+	}
+	return nil
+}
+
+// record counts the outcome of an allowed call to provider. Invalid replies mean the
+// provider is up and cancelled calls say nothing about it, so neither is a failure.
+func (b *aiBreaker) record(provider string, err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	cancelled := errors.Is(err, context.Canceled)
+	failed := err != nil && !errors.Is(err, ai.ErrInvalidAnalysis) && !cancelled
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[provider]
+	if !ok {
+		if !failed {
+			return
+		}
+		c = &aiCircuit{state: breakerClosed}
+		b.circuits[provider] = c
+	}
+
+	now := time.Now()
+	switch {
+	case c.state == breakerHalfOpen && failed:
+		c.state, c.openedAt, c.trial = breakerOpen, now, false
+		slog.Warn("AI circuit breaker reopened after a failed trial", "provider", provider, "cooldown", b.cooldown, "error", err)
+	case c.state == breakerHalfOpen && cancelled:
+		c.trial = false // inconclusive; the next call tries again
+	case c.state == breakerHalfOpen:
+		delete(b.circuits, provider)
+		slog.Info("AI circuit breaker closed, provider recovered", "provider", provider)
+	case c.state == breakerOpen:
+		// A call allowed before the circuit opened finished late
+	case cancelled:
+	case !failed:
+		delete(b.circuits, provider)
+	default:
+		if c.failures == 0 || now.Sub(c.firstFail) > b.window {
+			c.failures, c.firstFail = 0, now
+		}
+		c.failures++
+		if c.failures >= b.threshold {
+			c.state, c.openedAt = breakerOpen, now
+			slog.Warn("AI circuit breaker opened", "provider", provider, "failures", c.failures, "cooldown", b.cooldown, "error", err)
+		}
+	}
+}
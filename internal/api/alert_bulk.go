@@ -0,0 +1,318 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"stockmarket/internal/apperr"
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// bulkAlertInput is the body of POST /api/alerts/bulk: the symbols to alert on and the
+// alert each one gets. Price-level and crossing conditions take offset_percent, the
+// distance from each symbol's current price, instead of a price.
+type bulkAlertInput struct {
+	Symbols    []string `json:"symbols,omitempty"`
+	AllTracked bool     `json:"all_tracked,omitempty"` // alert on every tracked symbol instead
+	// Atomic, the default, creates no alerts when any symbol fails; false creates the
+	// ones that pass and reports the others
+	Atomic *bool `json:"atomic,omitempty"`
+
+	Condition        string     `json:"condition"`
+	OffsetPercent    float64    `json:"offset_percent,omitempty"`
+	ReferencePrice   float64    `json:"reference_price,omitempty"`
+	Percent          float64    `json:"percent,omitempty"`
+	VolumeMultiple   float64    `json:"volume_multiple,omitempty"`
+	Recurring        bool       `json:"recurring,omitempty"`
+	CooldownSeconds  int        `json:"cooldown_seconds,omitempty"`
+	Rearm            bool       `json:"rearm,omitempty"`
+	BypassQuietHours bool       `json:"bypass_quiet_hours,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+}
+
+// Per-symbol outcomes of a bulk alert request
+const (
+	bulkAlertCreated = "created"
+	bulkAlertExists  = "exists" // an identical active alert was already there
+	bulkAlertFailed  = "failed"
+	bulkAlertSkipped = "skipped" // valid, but an atomic request failed on another symbol
+)
+
+type bulkAlertResult struct {
+	Symbol  string  `json:"symbol"`
+	Status  string  `json:"status"`
+	AlertID int64   `json:"alert_id,omitempty"`
+	Price   float64 `json:"price,omitempty"` // the computed threshold of price conditions
+	Error   string  `json:"error,omitempty"`
+	Code    string  `json:"code,omitempty"`
+}
+
+type bulkAlertResponse struct {
+	Created []int64           `json:"created"` // IDs of the alerts created
+	Results []bulkAlertResult `json:"results"`
+}
+
+// bulkAlertError is an atomic bulk request's failure, with each symbol's outcome
+type bulkAlertError struct {
+	errorResponse
+	Results []bulkAlertResult `json:"results"`
+}
+
+// bulkAlertEntry is a requested symbol's place in a bulk request's results
+type bulkAlertEntry struct {
+	result int  // index of the symbol's result
+	repeat bool // the symbol was already requested earlier
+}
+
+// entryResults lists a result for every requested symbol in request order. A repeated
+// symbol reports the alert its first request made or found as existing.
+func entryResults(entries []bulkAlertEntry, results []bulkAlertResult) []bulkAlertResult {
+	list := make([]bulkAlertResult, len(entries))
+	for i, entry := range entries {
+		list[i] = results[entry.result]
+		if entry.repeat && list[i].Status == bulkAlertCreated {
+			list[i].Status = bulkAlertExists
+		}
+	}
+	return list
+}
+
+// bulkAlertTemplate returns the alert each symbol gets, with its symbol and price left
+// to fill in, or an invalid_request error naming what's wrong with the input
+func bulkAlertTemplate(input bulkAlertInput) (models.PriceAlert, error) {
+	needsPrice, ok := alertConditions[input.Condition]
+	if !ok {
+		return models.PriceAlert{}, apperr.New(apperr.InvalidRequest, invalidConditionMessage)
+	}
+	if needsPrice {
+		if input.Condition == "below" || input.Condition == "cross_below" {
+			if input.OffsetPercent <= 0 || input.OffsetPercent >= 100 {
+				return models.PriceAlert{}, apperr.New(apperr.InvalidRequest, "offset_percent must be between 0 and 100 for "+input.Condition)
+			}
+		} else if input.OffsetPercent <= 0 || math.IsInf(input.OffsetPercent, 0) {
+			return models.PriceAlert{}, apperr.New(apperr.InvalidRequest, "offset_percent must be positive for "+input.Condition)
+		}
+	}
+	template := models.PriceAlert{
+		Condition:        input.Condition,
+		ReferencePrice:   input.ReferencePrice,
+		Percent:          input.Percent,
+		VolumeMultiple:   input.VolumeMultiple,
+		Recurring:        input.Recurring,
+		CooldownSeconds:  input.CooldownSeconds,
+		Rearm:            input.Rearm,
+		BypassQuietHours: input.BypassQuietHours,
+		ExpiresAt:        input.ExpiresAt,
+	}
+	if msg := alertParamsError(template); msg != "" {
+		return models.PriceAlert{}, apperr.New(apperr.InvalidRequest, msg)
+	}
+	return template, nil
+}
+
+// offsetThreshold is the level offset percent above price for rising conditions and
+// below it for falling ones, rounded like a quoted price
+func offsetThreshold(condition string, price, offset float64) float64 {
+	if condition == "below" || condition == "cross_below" {
+		offset = -offset
+	}
+	level := price * (1 + offset/100)
+	scale := 100.0
+	if level < 1 {
+		scale = 1e6
+	}
+	return math.Round(level*scale) / scale
+}
+
+// handleAlertsBulk creates the same alert on many symbols at once (POST
+// /api/alerts/bulk), from a list or every tracked symbol. Price-level thresholds are
+// computed from one batch quote request, every alert passes the checks POST
+// /api/alerts makes, and the new alerts are saved in one transaction. Symbols with an
+// identical active alert keep it rather than getting a duplicate.
+func (s *Server) handleAlertsBulk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+	var input bulkAlertInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondError(w, http.StatusBadRequest, INVALID_JSON)
+		return
+	}
+	atomic := input.Atomic == nil || *input.Atomic
+	template, err := bulkAlertTemplate(input)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	requested := input.Symbols
+	switch {
+	case input.AllTracked && len(input.Symbols) > 0:
+		respondError(w, http.StatusBadRequest, "Send symbols or all_tracked, not both")
+		return
+	case input.AllTracked:
+		requested = cfg.TrackedSymbols
+	}
+	if len(requested) == 0 {
+		respondError(w, http.StatusBadRequest, "symbols or all_tracked is required")
+		return
+	}
+	if len(requested) > maxBatchQuoteSymbols {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("At most %d symbols are allowed", maxBatchQuoteSymbols))
+		return
+	}
+
+	// Every requested symbol gets a result, in the order given, and alerts[i] is the
+	// alert results[i] is about. A repeated symbol shares its first entry's result.
+	var results []bulkAlertResult
+	var alerts []models.PriceAlert
+	var entries []bulkAlertEntry
+	var firstErr error
+	fail := func(i int, err error) {
+		results[i].Status, results[i].Error, results[i].Code = bulkAlertFailed, err.Error(), cmp.Or(apperr.CodeOf(err), apperr.InvalidRequest)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	seen := make(map[string]int)
+	for _, raw := range requested {
+		symbol, err := market.NormalizeSymbol(raw)
+		if i, ok := seen[symbol]; ok && err == nil {
+			entries = append(entries, bulkAlertEntry{result: i, repeat: true})
+			continue
+		}
+		alert := template
+		alert.Symbol, alert.ProfileID = symbol, cfg.ID
+		entries = append(entries, bulkAlertEntry{result: len(results)})
+		results = append(results, bulkAlertResult{Symbol: symbol})
+		alerts = append(alerts, alert)
+		if err != nil {
+			results[len(results)-1].Symbol = raw
+			fail(len(results)-1, err)
+			continue
+		}
+		seen[symbol] = len(results) - 1
+	}
+	if alertConditions[template.Condition] && len(seen) > 0 {
+		s.priceBulkAlerts(r.Context(), cfg, input.OffsetPercent, alerts, results, fail)
+	}
+	for i := range results {
+		if results[i].Status == "" {
+			if err := prepareAlert(&alerts[i]); err != nil {
+				fail(i, err)
+			}
+		}
+	}
+	if atomic && firstErr != nil {
+		for i := range results {
+			if results[i].Status == "" {
+				results[i].Status = bulkAlertSkipped
+			}
+		}
+		code := cmp.Or(apperr.CodeOf(firstErr), apperr.InvalidRequest)
+		respondJSON(w, apperr.Status(code), bulkAlertError{
+			errorResponse: errorResponse{Error: "No alerts were created: " + firstErr.Error(), Code: code},
+			Results:       entryResults(entries, results),
+		})
+		return
+	}
+
+	s.alertCreateMu.Lock()
+	defer s.alertCreateMu.Unlock()
+
+	active, err := s.db.GetActiveAlerts(cfg.ID)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	var created []models.PriceAlert
+	var createdAt []int // the result index of each created alert
+	for i := range results {
+		if results[i].Status == bulkAlertFailed {
+			continue
+		}
+		for _, existing := range active {
+			if sameAlert(existing, alerts[i]) {
+				results[i].Status, results[i].AlertID = bulkAlertExists, existing.ID
+				break
+			}
+		}
+		if results[i].Status == "" {
+			created = append(created, alerts[i])
+			createdAt = append(createdAt, i)
+		}
+	}
+	if err := s.db.SavePriceAlerts(created); err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := bulkAlertResponse{Created: []int64{}}
+	for j, i := range createdAt {
+		results[i].Status, results[i].AlertID = bulkAlertCreated, created[j].ID
+		response.Created = append(response.Created, created[j].ID)
+	}
+	response.Results = entryResults(entries, results)
+	status := http.StatusOK
+	if len(created) > 0 {
+		status = http.StatusCreated
+	}
+	respondJSON(w, status, response)
+}
+
+// priceBulkAlerts sets each pending price-level alert's threshold offset percent from
+// its symbol's current price, failing the symbols that can't be quoted
+func (s *Server) priceBulkAlerts(ctx context.Context, cfg *models.UserConfig, offset float64, alerts []models.PriceAlert, results []bulkAlertResult, fail func(int, error)) {
+	var symbols []string
+	for i := range results {
+		if results[i].Status != bulkAlertFailed {
+			symbols = append(symbols, alerts[i].Symbol)
+		}
+	}
+
+	var quotes map[string]models.Quote
+	provider, err := s.marketProvider(cfg)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(ctx, s.config.QuoteTimeout)
+		defer cancel()
+		quotes, err = provider.GetQuotes(ctx, symbols)
+	}
+	var batchErr *market.BatchError
+	if errors.As(err, &batchErr) {
+		err = nil
+	}
+	for i := range results {
+		if results[i].Status == bulkAlertFailed {
+			continue
+		}
+		quote, ok := quotes[alerts[i].Symbol]
+		switch {
+		case err != nil:
+			fail(i, err)
+		case !ok:
+			symbolErr := error(market.ErrInvalidSymbol)
+			if batchErr != nil && batchErr.Errors[alerts[i].Symbol] != nil {
+				symbolErr = batchErr.Errors[alerts[i].Symbol]
+			}
+			fail(i, symbolErr)
+		case quote.Price <= 0:
+			fail(i, apperr.New(apperr.ProviderUnavailable, "no current price"))
+		default:
+			alerts[i].Price = offsetThreshold(alerts[i].Condition, quote.Price, offset)
+			results[i].Price = alerts[i].Price
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// alertDuplicateGroup is a set of active alerts on one symbol and condition whose
+// thresholds are within the duplicate tolerance of each other
+type alertDuplicateGroup struct {
+	Symbol    string              `json:"symbol"`
+	Condition string              `json:"condition"`
+	Alerts    []models.PriceAlert `json:"alerts"`
+	// Merged previews the alert POST /api/alerts/merge would make of them
+	Merged models.PriceAlert `json:"merged"`
+}
+
+type alertDuplicatesResponse struct {
+	TolerancePercent float64               `json:"tolerance_percent"`
+	Groups           []alertDuplicateGroup `json:"groups"`
+}
+
+type alertMergeInput struct {
+	IDs []int64 `json:"ids"`
+}
+
+type alertMergeResult struct {
+	Alert      models.PriceAlert `json:"alert"`
+	DeletedIDs []int64           `json:"deleted_ids"`
+}
+
+// alertThreshold returns the level an alert's condition compares against, 0 for
+// conditions without one
+func alertThreshold(alert models.PriceAlert) float64 {
+	switch alert.Condition {
+	case "pct_change_up", "pct_change_down":
+		return alert.Percent
+	case "volume_spike":
+		if alert.VolumeMultiple <= 0 {
+			return defaultVolumeMultiple
+		}
+		return alert.VolumeMultiple
+	}
+	if alertConditions[alert.Condition] {
+		return alert.Price
+	}
+	return 0
+}
+
+// tighterAlert reports whether a fires before b would: the lower level for rising
+// conditions, the higher for falling ones
+func tighterAlert(a, b models.PriceAlert) bool {
+	if a.Condition == "below" || a.Condition == "cross_below" {
+		return alertThreshold(a) > alertThreshold(b)
+	}
+	return alertThreshold(a) < alertThreshold(b)
+}
+
+// mergeableAlerts reports whether two alerts watch for the same thing apart from their
+// thresholds. Percent moves only compare when measured from the same reference price.
+func mergeableAlerts(a, b models.PriceAlert) bool {
+	return a.Symbol == b.Symbol && a.Condition == b.Condition && a.ReferencePrice == b.ReferencePrice
+}
+
+// nearThreshold reports whether two thresholds are within tolerance percent of each other
+func nearThreshold(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance/100*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// findDuplicateAlerts groups active alerts that watch for the same thing at thresholds
+// within tolerance percent, chaining neighbours so 200, 200.1 and 200.2 form one group
+// at 0.1%. Groups come in symbol and condition order, thresholds ascending.
+func findDuplicateAlerts(alerts []models.PriceAlert, tolerance float64) []alertDuplicateGroup {
+	sorted := slices.Clone(alerts)
+	slices.SortStableFunc(sorted, func(a, b models.PriceAlert) int {
+		return cmp.Or(cmp.Compare(a.Symbol, b.Symbol), cmp.Compare(a.Condition, b.Condition),
+			cmp.Compare(a.ReferencePrice, b.ReferencePrice), cmp.Compare(alertThreshold(a), alertThreshold(b)), cmp.Compare(a.ID, b.ID))
+	})
+
+	groups := []alertDuplicateGroup{}
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && mergeableAlerts(sorted[end], sorted[start]) &&
+			nearThreshold(alertThreshold(sorted[end-1]), alertThreshold(sorted[end]), tolerance) {
+			end++
+		}
+		if end-start > 1 {
+			members := sorted[start:end:end]
+			groups = append(groups, alertDuplicateGroup{
+				Symbol:    members[0].Symbol,
+				Condition: members[0].Condition,
+				Alerts:    members,
+				Merged:    mergeAlerts(members),
+			})
+		}
+		start = end
+	}
+	return groups
+}
+
+// mergeAlerts combines alerts watching for the same thing into the one with the
+// tightest threshold (the oldest on a tie), so the merged alert fires whenever the
+// first of them would have. It keeps the union of their notification settings: it
+// recurs, re-arms or bypasses quiet hours if any did, cools down for the shortest
+// cooldown any set, lives until the last of them would have expired, and stays muted
+// only while all of them would have been. The last trigger time carries over so cooldowns hold.
+func mergeAlerts(alerts []models.PriceAlert) models.PriceAlert {
+	merged := alerts[0]
+	for _, alert := range alerts[1:] {
+		if tighterAlert(alert, merged) || (!tighterAlert(merged, alert) && alert.ID < merged.ID) {
+			merged = alert
+		}
+	}
+
+	merged.CooldownSeconds = 0
+	allMuted := true
+	var mutedUntil time.Time
+	for _, alert := range alerts {
+		merged.Recurring = merged.Recurring || alert.Recurring
+		merged.Rearm = merged.Rearm || alert.Rearm
+		merged.BypassQuietHours = merged.BypassQuietHours || alert.BypassQuietHours
+		if alert.CooldownSeconds > 0 && (merged.CooldownSeconds == 0 || alert.CooldownSeconds < merged.CooldownSeconds) {
+			merged.CooldownSeconds = alert.CooldownSeconds
+		}
+		if merged.ExpiresAt != nil && (alert.ExpiresAt == nil || alert.ExpiresAt.After(*merged.ExpiresAt)) {
+			merged.ExpiresAt = alert.ExpiresAt
+		}
+		if !alertMuted(alert) {
+			allMuted = false
+		} else if mutedUntil.IsZero() || alert.MutedUntil.Before(mutedUntil) {
+			mutedUntil = *alert.MutedUntil
+		}
+		if alert.LastTriggeredAt != nil && (merged.LastTriggeredAt == nil || alert.LastTriggeredAt.After(*merged.LastTriggeredAt)) {
+			merged.LastTriggeredAt = alert.LastTriggeredAt
+		}
+	}
+	merged.MutedUntil = nil
+	if allMuted {
+		merged.MutedUntil = &mutedUntil
+	}
+	merged.Recurring = merged.Recurring || merged.CooldownSeconds > 0 || merged.Rearm
+	if !merged.Rearm {
+		merged.Disarmed = false
+	}
+	return merged
+}
+
+// handleAlertDuplicates lists groups of active alerts that look like duplicates
+// (GET /api/alerts/duplicates?tolerance=), tolerance being a percentage that defaults
+// to ALERT_DUPLICATE_TOLERANCE
+func (s *Server) handleAlertDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+	tolerance, err := queryFloat(r.URL.Query().Get("tolerance"), s.config.AlertDuplicateTolerance)
+	if err != nil || tolerance < 0 || math.IsInf(tolerance, 0) || math.IsNaN(tolerance) {
+		respondError(w, http.StatusBadRequest, "tolerance must be a non-negative percentage")
+		return
+	}
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	alerts, err := s.db.GetActiveAlerts(profileID)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, alertDuplicatesResponse{TolerancePercent: tolerance, Groups: findDuplicateAlerts(alerts, tolerance)})
+}
+
+// handleAlertMerge collapses active alerts into one (POST /api/alerts/merge with
+// {"ids": [1, 2]}): the alert mergeAlerts picks is kept, taking the merged settings,
+// and the others are soft-deleted in the same transaction. The alerts must share a
+// symbol and condition, whatever their thresholds.
+func (s *Server) handleAlertMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+	var input alertMergeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondError(w, http.StatusBadRequest, INVALID_JSON)
+		return
+	}
+	slices.Sort(input.IDs)
+	input.IDs = slices.Compact(input.IDs)
+	if len(input.IDs) < 2 {
+		respondError(w, http.StatusBadRequest, "ids must list at least two different alerts")
+		return
+	}
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Creation checks for duplicates, so it mustn't see alerts halfway through a merge
+	s.alertCreateMu.Lock()
+	defer s.alertCreateMu.Unlock()
+
+	active, err := s.db.GetActiveAlerts(profileID)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	alerts := make([]models.PriceAlert, 0, len(input.IDs))
+	for _, id := range input.IDs {
+		i := slices.IndexFunc(active, func(a models.PriceAlert) bool { return a.ID == id })
+		if i < 0 {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("Alert %d not found or not active", id))
+			return
+		}
+		if len(alerts) > 0 && !mergeableAlerts(alerts[0], active[i]) {
+			respondError(w, http.StatusBadRequest, "Only alerts with the same symbol, condition and reference price can be merged")
+			return
+		}
+		alerts = append(alerts, active[i])
+	}
+
+	merged := mergeAlerts(alerts)
+	var deleted []int64
+	for _, id := range input.IDs {
+		if id != merged.ID {
+			deleted = append(deleted, id)
+		}
+	}
+	if err := s.db.MergeAlerts(&merged, deleted); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "Alert not found")
+			return
+		}
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.forgetCrossSides(deleted...)
+
+	respondJSON(w, http.StatusOK, alertMergeResult{Alert: merged, DeletedIDs: deleted})
+}
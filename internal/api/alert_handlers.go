@@ -1,23 +1,188 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"stockmarket/internal/apperr"
+	"stockmarket/internal/market"
 	"stockmarket/internal/models"
 	"stockmarket/internal/web/pages"
 )
 
+// Supported alert conditions. Price-level and crossing conditions need a target price;
+// the others ignore it: 52-week conditions compare against rolling extremes, vwap_cross
+// against the session VWAP, percent moves against a reference price and volume_spike
+// against the 20-day average volume.
+var alertConditions = map[string]bool{
+	"above":           true,
+	"below":           true,
+	"cross_above":     true,
+	"cross_below":     true,
+	"new_52w_high":    false,
+	"new_52w_low":     false,
+	"vwap_cross":      false,
+	"pct_change_up":   false,
+	"pct_change_down": false,
+	"volume_spike":    false,
+}
+
+// invalidConditionMessage rejects a condition missing from alertConditions
+const invalidConditionMessage = "Condition must be 'above', 'below', 'cross_above', 'cross_below', 'new_52w_high', 'new_52w_low', 'vwap_cross', 'pct_change_up', 'pct_change_down' or 'volume_spike'"
+
+// defaultVolumeMultiple is the volume_spike threshold for alerts that don't set one
+const defaultVolumeMultiple = 2.0
+
+const (
+	// IdempotencyKeyHeader lets clients retry alert creation without creating duplicates
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// idempotencyKeyTTL is how long a key keeps returning the alert it created
+	idempotencyKeyTTL = 24 * time.Hour
+
+	// maxIdempotencyKeyLength caps idempotency keys
+	maxIdempotencyKeyLength = 255
+)
+
+// createAlert saves a new alert unless it repeats an earlier request: a key already
+// used within idempotencyKeyTTL returns the alert created with it, and an active alert
+// identical in symbol, condition and thresholds is returned instead of a duplicate.
+// created reports whether a new alert was saved.
+func (s *Server) createAlert(alert *models.PriceAlert, key string) (saved *models.PriceAlert, created bool, err error) {
+	s.alertCreateMu.Lock()
+	defer s.alertCreateMu.Unlock()
+
+	if key != "" {
+		id, err := s.db.GetIdempotentAlertID(alert.ProfileID, key, time.Now().Add(-idempotencyKeyTTL))
+		switch {
+		case err == nil:
+			existing, err := s.db.GetPriceAlert(id, alert.ProfileID)
+			if err == nil {
+				return existing, false, nil
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return nil, false, err
+			}
+			// The alert was deleted since; create it again
+		case !errors.Is(err, sql.ErrNoRows):
+			return nil, false, err
+		}
+	}
+
+	active, err := s.db.GetActiveAlerts(alert.ProfileID)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range active {
+		if sameAlert(active[i], *alert) {
+			saved = &active[i]
+			break
+		}
+	}
+	if saved == nil {
+		if err := s.db.SavePriceAlert(alert); err != nil {
+			return nil, false, err
+		}
+		saved, created = alert, true
+	}
+
+	if key != "" {
+		if err := s.db.SaveIdempotencyKey(alert.ProfileID, key, saved.ID); err != nil {
+			slog.Error("failed to save alert idempotency key", "profile_id", alert.ProfileID, "error", err)
+		}
+	}
+	return saved, created, nil
+}
+
+// sameAlert reports whether two alerts watch the same symbol for the same condition
+// and thresholds
+func sameAlert(a, b models.PriceAlert) bool {
+	return a.Symbol == b.Symbol && a.Condition == b.Condition && a.Price == b.Price &&
+		a.Percent == b.Percent && a.VolumeMultiple == b.VolumeMultiple
+}
+
+// idempotencyKey returns a request's Idempotency-Key, reporting false when it's too long
+func idempotencyKey(r *http.Request) (string, bool) {
+	key := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+	return key, len(key) <= maxIdempotencyKeyLength
+}
+
+// alertParamsError checks the fields specific to move and volume conditions, the
+// cooldown and the expiry, returning a message when they're invalid
+func alertParamsError(alert models.PriceAlert) string {
+	switch {
+	case alert.ReferencePrice < 0:
+		return "reference_price must not be negative"
+	case (alert.Condition == "pct_change_up" || alert.Condition == "pct_change_down") && alert.Percent <= 0:
+		return "percent must be positive for " + alert.Condition
+	case alert.VolumeMultiple < 0:
+		return "volume_multiple must not be negative"
+	case alert.CooldownSeconds < 0:
+		return "cooldown_seconds must not be negative"
+	case alert.ExpiresAt != nil && !alert.ExpiresAt.After(time.Now()):
+		return "expires_at must be in the future"
+	}
+	return ""
+}
+
+// prepareAlert normalizes a new alert's symbol and flags and checks its condition and
+// thresholds, returning an invalid_request error when they're invalid
+func prepareAlert(alert *models.PriceAlert) error {
+	symbol, err := market.NormalizeSymbol(alert.Symbol)
+	if err != nil {
+		return err
+	}
+	alert.Symbol = symbol
+	alert.Disarmed, alert.Expired = false, false
+	alert.Recurring = alert.Recurring || alert.CooldownSeconds > 0 || alert.Rearm
+	needsPrice, ok := alertConditions[alert.Condition]
+	if !ok {
+		return apperr.New(apperr.InvalidRequest, invalidConditionMessage)
+	}
+	if alert.Symbol == "" || (needsPrice && alert.Price <= 0) {
+		return apperr.New(apperr.InvalidRequest, "Symbol and price required")
+	}
+	if msg := alertParamsError(*alert); msg != "" {
+		return apperr.New(apperr.InvalidRequest, msg)
+	}
+	return nil
+}
+
 func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		alerts, err := s.db.GetActiveAlerts()
+		includeDeleted, err := boolQuery(r, "include_deleted")
+		if err != nil {
+			respondErr(w, http.StatusBadRequest, err)
+			return
+		}
+		alerts, err := s.db.GetActiveAlerts(profileID)
 		if err != nil {
-			respondError(w, http.StatusInternalServerError, err.Error())
+			respondErr(w, http.StatusInternalServerError, err)
 			return
 		}
+		if includeDeleted {
+			deleted, err := s.db.GetDeletedAlerts(profileID)
+			if err != nil {
+				respondErr(w, http.StatusInternalServerError, err)
+				return
+			}
+			alerts = append(alerts, deleted...)
+		}
 		respondJSON(w, http.StatusOK, alerts)
 
 	case http.MethodPost:
@@ -27,22 +192,28 @@ func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		alert.Symbol = strings.ToUpper(strings.TrimSpace(alert.Symbol))
-		if alert.Symbol == "" || alert.Price <= 0 {
-			respondError(w, http.StatusBadRequest, "Symbol and price required")
+		alert.ProfileID = profileID
+		if err := prepareAlert(&alert); err != nil {
+			respondErr(w, http.StatusBadRequest, err)
 			return
 		}
-		if alert.Condition != "above" && alert.Condition != "below" {
-			respondError(w, http.StatusBadRequest, "Condition must be 'above' or 'below'")
+		key, ok := idempotencyKey(r)
+		if !ok {
+			respondError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
 			return
 		}
 
-		if err := s.db.SavePriceAlert(&alert); err != nil {
-			respondError(w, http.StatusInternalServerError, err.Error())
+		saved, created, err := s.createAlert(&alert, key)
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
 			return
 		}
 
-		respondJSON(w, http.StatusCreated, alert)
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		respondJSON(w, status, saved)
 
 	default:
 		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
@@ -62,17 +233,31 @@ func (s *Server) handleAlertDelete(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Invalid alert ID")
 		return
 	}
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
 
-	if err := s.db.DeletePriceAlert(id); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+	if err := s.db.DeletePriceAlert(id, profileID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "Alert not found")
+			return
+		}
+		respondErr(w, http.StatusInternalServerError, err)
 		return
 	}
+	s.forgetCrossSides(id)
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
 // handleNotificationChannels handles notification channel CRUD
 func (s *Server) handleAlertsHTMX(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.handleAlerts(w, r)
+		return
+	}
 	if r.Method != http.MethodPost {
 		http.Error(w, METHOD_NOT_ALLOWED, http.StatusMethodNotAllowed)
 		return
@@ -83,28 +268,65 @@ func (s *Server) handleAlertsHTMX(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	symbol := strings.ToUpper(strings.TrimSpace(r.FormValue("symbol")))
+	symbol := strings.TrimSpace(r.FormValue("symbol"))
 	condition := r.FormValue("condition")
 	priceStr := r.FormValue("target_price")
 
-	if symbol == "" || condition == "" || priceStr == "" {
+	needsPrice, ok := alertConditions[condition]
+	if symbol == "" || !ok || (needsPrice && priceStr == "") {
 		htmxError(w, ALL_FIELDS_REQUIRED)
 		return
 	}
+	symbol, err := market.NormalizeSymbol(symbol)
+	if err != nil {
+		htmxError(w, err.Error())
+		return
+	}
+
+	var price float64
+	if needsPrice {
+		var err error
+		price, err = strconv.ParseFloat(priceStr, 64)
+		if err != nil {
+			htmxError(w, INVALID_PRICE)
+			return
+		}
+	}
 
-	price, err := strconv.ParseFloat(priceStr, 64)
+	percent, err := queryFloat(r.FormValue("percent"), 0)
+	if err != nil {
+		htmxError(w, "Invalid percent")
+		return
+	}
+	volumeMultiple, err := queryFloat(r.FormValue("volume_multiple"), 0)
 	if err != nil {
-		htmxError(w, INVALID_PRICE)
+		htmxError(w, "Invalid volume multiple")
 		return
 	}
 
 	alert := &models.PriceAlert{
-		Symbol:    symbol,
-		Condition: condition,
-		Price:     price,
+		Symbol:         symbol,
+		Condition:      condition,
+		Price:          price,
+		Percent:        percent,
+		VolumeMultiple: volumeMultiple,
+	}
+	if msg := alertParamsError(*alert); msg != "" {
+		htmxError(w, msg)
+		return
+	}
+	if alert.ProfileID, err = s.requestProfileID(r); err != nil {
+		htmxError(w, err.Error())
+		return
+	}
+	key, ok := idempotencyKey(r)
+	if !ok {
+		htmxError(w, "Idempotency-Key must be at most 255 characters")
+		return
 	}
 
-	if err := s.db.SavePriceAlert(alert); err != nil {
+	// A repeated submit leaves the alert it repeats in place
+	if _, _, err := s.createAlert(alert, key); err != nil {
 		htmxError(w, err.Error())
 		return
 	}
@@ -113,8 +335,101 @@ func (s *Server) handleAlertsHTMX(w http.ResponseWriter, r *http.Request) {
 	s.renderAlertsList(w, r)
 }
 
+// handleAlertsFromAnalysis creates alerts from an analysis's suggested levels. The body
+// {"sources": ["target", "support"]} selects which suggestions to use; omit it for all.
+// A suggestion matching an active alert returns that alert instead of a duplicate.
+func (s *Server) handleAlertsFromAnalysis(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/alerts/from-analysis/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		respondError(w, http.StatusBadRequest, "Invalid analysis ID")
+		return
+	}
+
+	var input struct {
+		Sources []string `json:"sources"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			respondError(w, http.StatusBadRequest, INVALID_JSON)
+			return
+		}
+	}
+
+	analysis, err := s.db.GetAnalysisResponse(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && analysis.DeletedAt != nil) {
+		respondError(w, http.StatusNotFound, "Analysis not found")
+		return
+	}
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var alerts []models.PriceAlert
+	anyCreated := false
+	for _, suggestion := range analysis.SuggestedAlerts {
+		if len(input.Sources) > 0 && !slices.Contains(input.Sources, suggestion.Source) {
+			continue
+		}
+		alert := models.PriceAlert{
+			ProfileID: profileID,
+			Symbol:    analysis.Symbol,
+			Condition: suggestion.Condition,
+			Price:     suggestion.Price,
+		}
+		if err := prepareAlert(&alert); err != nil {
+			respondErr(w, http.StatusBadRequest, err)
+			return
+		}
+		saved, created, err := s.createAlert(&alert, "")
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		alerts = append(alerts, *saved)
+		anyCreated = anyCreated || created
+	}
+
+	if len(alerts) == 0 {
+		respondError(w, http.StatusBadRequest, "No matching suggested alert levels")
+		return
+	}
+	status := http.StatusOK
+	if anyCreated {
+		status = http.StatusCreated
+	}
+	respondJSON(w, status, alerts)
+}
+
 // handleAlertDeleteHTMX handles deleting alerts and returns updated list
 func (s *Server) handleAlertDeleteHTMX(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/mute") || strings.HasSuffix(r.URL.Path, "/unmute") {
+		s.handleAlertMute(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/restore") {
+		s.handleAlertRestore(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/history") {
+		s.handleAlertHistory(w, r)
+		return
+	}
+	if r.Method == http.MethodPatch {
+		s.handleAlertUpdate(w, r)
+		return
+	}
 	if r.Method != http.MethodDelete {
 		http.Error(w, METHOD_NOT_ALLOWED, http.StatusMethodNotAllowed)
 		return
@@ -126,27 +441,297 @@ func (s *Server) handleAlertDeleteHTMX(w http.ResponseWriter, r *http.Request) {
 		htmxError(w, "Invalid alert ID")
 		return
 	}
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		htmxError(w, err.Error())
+		return
+	}
 
-	if err := s.db.DeletePriceAlert(id); err != nil {
+	if err := s.db.DeletePriceAlert(id, profileID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			htmxErrorStatus(w, http.StatusNotFound, "Alert not found")
+			return
+		}
 		htmxError(w, err.Error())
 		return
 	}
+	s.forgetCrossSides(id)
 
 	s.renderAlertsList(w, r)
 }
 
+// Alert history sizes
+const (
+	defaultAlertHistoryLimit = 50
+	maxAlertHistoryLimit     = 500
+)
+
+// handleAlertHistory lists the times an alert fired, newest first, with the price, day
+// change and volume at each (GET /api/alerts/{id}/history?limit=)
+func (s *Server) handleAlertHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/alerts/"), "/history"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, INVALID_ALERT_ID)
+		return
+	}
+	limit := defaultAlertHistoryLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, maxAlertHistoryLimit)
+		}
+	}
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if _, err := s.db.GetPriceAlert(id, profileID); errors.Is(err, sql.ErrNoRows) {
+		respondError(w, http.StatusNotFound, "Alert not found")
+		return
+	} else if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	triggers, err := s.db.GetAlertTriggers(id, limit)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	if triggers == nil {
+		triggers = []models.AlertTrigger{}
+	}
+	respondJSON(w, http.StatusOK, triggers)
+}
+
+// handleAlertMute mutes an alert for a duration (POST /api/alerts/{id}/mute with
+// {"duration": "2h"}) or unmutes it (POST /api/alerts/{id}/unmute). Muted alerts
+// still trigger but send no notifications.
+func (s *Server) handleAlertMute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/alerts/")
+	idStr, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, INVALID_ALERT_ID)
+		return
+	}
+
+	var until time.Time
+	if action == "mute" {
+		var input struct {
+			Duration string `json:"duration"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			respondError(w, http.StatusBadRequest, INVALID_JSON)
+			return
+		}
+		d, err := time.ParseDuration(input.Duration)
+		if err != nil || d <= 0 {
+			respondError(w, http.StatusBadRequest, "Duration must be a positive duration (e.g. 2h)")
+			return
+		}
+		until = time.Now().Add(d)
+	}
+
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = s.db.MuteAlert(id, profileID, until)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, http.StatusNotFound, "Alert not found")
+		return
+	}
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if until.IsZero() {
+		respondJSON(w, http.StatusOK, map[string]string{"status": "unmuted"})
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"status": "muted", "muted_until": until})
+}
+
+// alertPatch is a partial alert update; only the fields present change. A null
+// expires_at removes the expiry.
+type alertPatch struct {
+	Condition        *string         `json:"condition,omitempty"`
+	Price            *float64        `json:"price,omitempty"`
+	ReferencePrice   *float64        `json:"reference_price,omitempty"`
+	Percent          *float64        `json:"percent,omitempty"`
+	VolumeMultiple   *float64        `json:"volume_multiple,omitempty"`
+	Active           *bool           `json:"active,omitempty"`
+	Recurring        *bool           `json:"recurring,omitempty"`
+	CooldownSeconds  *int            `json:"cooldown_seconds,omitempty"`
+	Rearm            *bool           `json:"rearm,omitempty"`
+	BypassQuietHours *bool           `json:"bypass_quiet_hours,omitempty"`
+	ExpiresAt        json.RawMessage `json:"expires_at,omitempty"` // RFC 3339 time or null
+}
+
+// handleAlertUpdate edits an alert in place (PATCH /api/alerts/{id}), keeping its ID
+// and trigger history. Changing the condition or a threshold re-arms the alert and
+// forgets the side of the old level a crossing alert last saw, so it can't fire on
+// state from before the edit. "active" deactivates or reactivates the alert.
+func (s *Server) handleAlertUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/alerts/"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, INVALID_ALERT_ID)
+		return
+	}
+	var patch alertPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		respondError(w, http.StatusBadRequest, INVALID_JSON)
+		return
+	}
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	existing, err := s.db.GetPriceAlert(id, profileID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, http.StatusNotFound, "Alert not found")
+		return
+	}
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	alert := *existing
+	if patch.Condition != nil {
+		alert.Condition = *patch.Condition
+	}
+	if patch.Price != nil {
+		alert.Price = *patch.Price
+	}
+	if patch.ReferencePrice != nil {
+		alert.ReferencePrice = *patch.ReferencePrice
+	}
+	if patch.Percent != nil {
+		alert.Percent = *patch.Percent
+	}
+	if patch.VolumeMultiple != nil {
+		alert.VolumeMultiple = *patch.VolumeMultiple
+	}
+	if patch.Recurring != nil {
+		alert.Recurring = *patch.Recurring
+	}
+	if patch.CooldownSeconds != nil {
+		alert.CooldownSeconds = *patch.CooldownSeconds
+	}
+	if patch.Rearm != nil {
+		alert.Rearm = *patch.Rearm
+	}
+	if patch.BypassQuietHours != nil {
+		alert.BypassQuietHours = *patch.BypassQuietHours
+	}
+	if len(patch.ExpiresAt) > 0 {
+		alert.ExpiresAt = nil
+		if string(patch.ExpiresAt) != "null" {
+			var expiresAt time.Time
+			if err := json.Unmarshal(patch.ExpiresAt, &expiresAt); err != nil {
+				respondError(w, http.StatusBadRequest, "expires_at must be an RFC 3339 time or null")
+				return
+			}
+			alert.ExpiresAt = &expiresAt
+		}
+	}
+	alert.Recurring = alert.Recurring || alert.CooldownSeconds > 0 || alert.Rearm
+	if !alert.Rearm {
+		alert.Disarmed = false
+	}
+
+	needsPrice, ok := alertConditions[alert.Condition]
+	if !ok {
+		respondError(w, http.StatusBadRequest, invalidConditionMessage)
+		return
+	}
+	if needsPrice && alert.Price <= 0 {
+		respondError(w, http.StatusBadRequest, "price must be positive for "+alert.Condition)
+		return
+	}
+	// An expiry that already passed only matters when it's being set or the alert revived
+	checked := alert
+	if len(patch.ExpiresAt) == 0 && (patch.Active == nil || !*patch.Active) {
+		checked.ExpiresAt = nil
+	}
+	if msg := alertParamsError(checked); msg != "" {
+		respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if patch.Active != nil {
+		alert.Triggered, alert.Expired = !*patch.Active, false
+		if *patch.Active {
+			alert.Disarmed = false
+		}
+	} else if len(patch.ExpiresAt) > 0 && alert.Expired {
+		// A new expiry revives an alert the old one deactivated
+		alert.Expired = false
+	}
+	rethreshold := !sameAlert(alert, *existing) || alert.ReferencePrice != existing.ReferencePrice
+	if rethreshold {
+		alert.Disarmed = false
+	}
+
+	if err := s.db.UpdateAlert(&alert); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "Alert not found")
+			return
+		}
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	if rethreshold {
+		s.forgetCrossSides(alert.ID)
+	}
+
+	respondJSON(w, http.StatusOK, alert)
+}
+
+// alertMuted reports whether an alert's notifications are currently suppressed
+func alertMuted(alert models.PriceAlert) bool {
+	return alert.MutedUntil != nil && time.Now().Before(*alert.MutedUntil)
+}
+
+// alertCoolingDown reports whether an alert fired too recently to fire again
+func alertCoolingDown(alert models.PriceAlert) bool {
+	cooldown := time.Duration(alert.CooldownSeconds) * time.Second
+	return cooldown > 0 && alert.LastTriggeredAt != nil && time.Since(*alert.LastTriggeredAt) < cooldown
+}
+
 func (s *Server) renderAlertsList(w http.ResponseWriter, r *http.Request) {
-	alertsRaw, _ := s.db.GetActiveAlerts()
+	var alertsRaw []models.PriceAlert
+	if profileID, err := s.requestProfileID(r); err == nil {
+		alertsRaw, _ = s.db.GetActiveAlerts(profileID)
+	}
 
 	// Convert to pages.Alert
 	alerts := make([]pages.Alert, len(alertsRaw))
 	for i, a := range alertsRaw {
 		alerts[i] = pages.Alert{
-			ID:          a.ID,
-			Symbol:      a.Symbol,
-			Condition:   a.Condition,
-			TargetPrice: a.Price,
-			Triggered:   a.Triggered,
+			ID:             a.ID,
+			Symbol:         a.Symbol,
+			Condition:      a.Condition,
+			TargetPrice:    a.Price,
+			Triggered:      a.Triggered,
+			Percent:        a.Percent,
+			VolumeMultiple: a.VolumeMultiple,
 		}
 	}
 
@@ -155,3 +740,40 @@ func (s *Server) renderAlertsList(w http.ResponseWriter, r *http.Request) {
 }
 
 // HTMX response helpers
+
+// StartAlertExpirySweep periodically deactivates expired alerts, so they stop counting
+// as active even for symbols that never receive another quote, and drops expired
+// idempotency keys
+func (s *Server) StartAlertExpirySweep(ctx context.Context) {
+	if s.config.AlertExpirySweepInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.AlertExpirySweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sweepExpiredAlerts(time.Now())
+			}
+		}
+	}()
+}
+
+// sweepExpiredAlerts deactivates alerts expired by now and drops old idempotency keys
+func (s *Server) sweepExpiredAlerts(now time.Time) {
+	expired, err := s.db.ExpireAlerts(now)
+	if err != nil {
+		slog.Error("failed to expire alerts", "error", err)
+	} else if len(expired) > 0 {
+		s.forgetCrossSides(expired...)
+		slog.Info("expired alerts", "count", len(expired))
+	}
+	if _, err := s.db.DeleteIdempotencyKeys(now.Add(-idempotencyKeyTTL)); err != nil {
+		slog.Error("failed to delete expired alert idempotency keys", "error", err)
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// TestAlertIdempotencyKeyReplay checks that a resubmitted alert form with the same
+// Idempotency-Key leaves the alert the first submit made instead of adding another,
+// and that an identical active alert isn't duplicated either
+func TestAlertIdempotencyKeyReplay(t *testing.T) {
+	s, mux := newTestServer(t)
+	profileID := testConfig(t, s).ID
+	submit := func(key, price string) {
+		t.Helper()
+		form := url.Values{"symbol": {"AAPL"}, "condition": {"above"}, "target_price": {price}}
+		r := httptest.NewRequest(http.MethodPost, "/api/alerts", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		if rec := serve(mux, r); rec.Code != http.StatusOK {
+			t.Fatalf("submit: status %d: %s", rec.Code, rec.Body)
+		}
+	}
+	active := func() []models.PriceAlert {
+		t.Helper()
+		alerts, err := s.db.GetActiveAlerts(profileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return alerts
+	}
+
+	submit("retry-1", "200")
+	submit("retry-1", "250") // a retry replays the first submit, whatever it now says
+	alerts := active()
+	if len(alerts) != 1 || alerts[0].Price != 200 {
+		t.Fatalf("after a replayed key: alerts = %+v, want just the first at 200", alerts)
+	}
+	first := alerts[0]
+	submit("", "200") // identical to an active alert
+	if alerts := active(); len(alerts) != 1 {
+		t.Fatalf("after an identical alert: %d alerts, want 1", len(alerts))
+	}
+	submit("retry-2", "250")
+	if alerts := active(); len(alerts) != 2 {
+		t.Fatalf("after a new key: %d alerts, want 2", len(alerts))
+	}
+
+	saved, created, err := s.createAlert(&models.PriceAlert{ProfileID: profileID, Symbol: "AAPL", Condition: "above", Price: 999}, "retry-1")
+	if err != nil || created || saved.ID != first.ID {
+		t.Fatalf("replay: got alert %+v created=%v err=%v, want the first alert back", saved, created, err)
+	}
+	if err := s.db.DeletePriceAlert(saved.ID, profileID); err != nil {
+		t.Fatal(err)
+	}
+	saved, created, err = s.createAlert(&models.PriceAlert{ProfileID: profileID, Symbol: "AAPL", Condition: "above", Price: 200}, "retry-1")
+	if err != nil || !created || saved.ID == first.ID {
+		t.Errorf("after deleting the alert: got %+v created=%v err=%v, want it created again", saved, created, err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/alerts", strings.NewReader("symbol=AAPL&condition=above&target_price=1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set(IdempotencyKeyHeader, strings.Repeat("k", maxIdempotencyKeyLength+1))
+	serve(mux, r)
+	if alerts := active(); len(alerts) != 2 {
+		t.Errorf("an overlong key created an alert: %d alerts, want 2", len(alerts))
+	}
+}
+
+// TestCrossSidesForgotten checks that a crossing alert's recorded side is dropped when
+// the alert is deleted or expires
+func TestCrossSidesForgotten(t *testing.T) {
+	s, mux := newTestServer(t)
+	cfg := testConfig(t, s)
+	expiry := time.Now().Add(time.Minute)
+	deleted := models.PriceAlert{ProfileID: cfg.ID, Symbol: "AAPL", Condition: "cross_above", Price: 100}
+	expiring := models.PriceAlert{ProfileID: cfg.ID, Symbol: "MSFT", Condition: "cross_below", Price: 100, ExpiresAt: &expiry}
+	for _, alert := range []*models.PriceAlert{&deleted, &expiring} {
+		if err := prepareAlert(alert); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.db.SavePriceAlert(alert); err != nil {
+			t.Fatal(err)
+		}
+		s.levelCrossed(alert.ID, 101, alert.Price)
+	}
+	if len(s.crossSides) != 2 {
+		t.Fatalf("crossSides = %v, want a side recorded for both alerts", s.crossSides)
+	}
+
+	if rec := serve(mux, httptest.NewRequest(http.MethodDelete, "/api/alerts/"+strconv.FormatInt(deleted.ID, 10), nil)); rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d: %s", rec.Code, rec.Body)
+	}
+	s.sweepExpiredAlerts(expiry.Add(time.Minute))
+	if alert, err := s.db.GetPriceAlert(expiring.ID, cfg.ID); err != nil || !alert.Expired {
+		t.Fatalf("expiring alert = %+v, %v, want it expired", alert, err)
+	}
+
+	if len(s.crossSides) != 0 {
+		t.Errorf("crossSides = %v, want the deleted and expired alerts forgotten", s.crossSides)
+	}
+}
+
+// TestBulkAlertsRepeatedSymbol checks that a symbol listed twice gets a result for each
+// entry, the second pointing at the alert the first created
+func TestBulkAlertsRepeatedSymbol(t *testing.T) {
+	_, mux := newTestServer(t)
+	rec := serve(mux, httptest.NewRequest(http.MethodPost, "/api/alerts/bulk",
+		strings.NewReader(`{"symbols":["AAPL","MSFT","aapl"],"condition":"pct_change_down","percent":5}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var response bulkAlertResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	results := response.Results
+	if len(response.Created) != 2 || len(results) != 3 {
+		t.Fatalf("response = %+v, want 2 alerts created and 3 results", response)
+	}
+	if results[0].Status != bulkAlertCreated || results[2].Symbol != "AAPL" || results[2].Status != bulkAlertExists || results[2].AlertID != results[0].AlertID {
+		t.Errorf("results = %+v, want the repeated AAPL to report the first entry's alert as existing", results)
+	}
+}
+
+// TestAlertsFromAnalysis checks that creating alerts from the same analysis twice
+// returns the existing alerts instead of duplicating them, and that a deleted analysis
+// or a bad ID creates nothing
+func TestAlertsFromAnalysis(t *testing.T) {
+	s, mux := newTestServer(t)
+	profileID := testConfig(t, s).ID
+	analysis := &models.AnalysisResponse{Symbol: "AAPL", Action: "BUY", Confidence: 0.8, SuggestedAlerts: []models.AlertSuggestion{
+		{Source: "target", Condition: "above", Price: 210},
+		{Source: "stop_loss", Condition: "below", Price: 180},
+	}}
+	if err := s.db.SaveAnalysis(analysis); err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/alerts/from-analysis/" + strconv.FormatInt(analysis.ID, 10)
+
+	for _, want := range []int{http.StatusCreated, http.StatusOK} {
+		rec := serve(mux, httptest.NewRequest(http.MethodPost, path, nil))
+		var alerts []models.PriceAlert
+		if rec.Code != want || json.Unmarshal(rec.Body.Bytes(), &alerts) != nil || len(alerts) != 2 {
+			t.Fatalf("status %d, want %d: %s", rec.Code, want, rec.Body)
+		}
+	}
+	if alerts, err := s.db.GetActiveAlerts(profileID); err != nil || len(alerts) != 2 {
+		t.Fatalf("active alerts = %d (%v), want 2", len(alerts), err)
+	}
+
+	if rec := serve(mux, httptest.NewRequest(http.MethodPost, "/api/alerts/from-analysis/0", nil)); rec.Code != http.StatusBadRequest {
+		t.Errorf("ID 0: status %d, want 400", rec.Code)
+	}
+	if err := s.db.DeleteAnalysis(analysis.ID); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(mux, httptest.NewRequest(http.MethodPost, path, nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted analysis: status %d, want 404", rec.Code)
+	}
+}
+
+// TestAlertMessageCurrency checks that a price alert's notification is written in the
+// quote's currency rather than dollars, and the digest in the symbol's
+func TestAlertMessageCurrency(t *testing.T) {
+	s, _ := newTestServer(t)
+	alert := models.PriceAlert{Symbol: "BARC", Condition: "above", Price: 2}
+	quote := models.Quote{Symbol: "BARC", Price: 2.5, Currency: "GBP"}
+
+	fired, message := s.alertTriggered(context.Background(), nil, testConfig(t, s), alert, quote)
+	if want := "BARC is now £2.50 (above £2.00)"; !fired || message != want {
+		t.Errorf("alertTriggered = %v, %q, want true, %q", fired, message, want)
+	}
+
+	digest := buildDigest(time.Now(), nil, []models.PriceAlert{{Symbol: "VOD.L", Condition: "below", Price: 71.5}})
+	if want := "- VOD.L below 71.50p"; !strings.Contains(digest.Message, want) {
+		t.Errorf("digest = %q, want it to contain %q", digest.Message, want)
+	}
+}
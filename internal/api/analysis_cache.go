@@ -0,0 +1,99 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// analysisCache reuses recent analyses for identical requests so a repeated
+// /api/analyze call doesn't pay for a second AI completion
+type analysisCache struct {
+	ttl     time.Duration
+	maxMove float64 // percent the price may move before a cached analysis is stale
+
+	mu      sync.Mutex
+	entries map[string]cachedAnalysis
+}
+
+type cachedAnalysis struct {
+	analysis models.AnalysisResponse
+	price    float64
+	cachedAt time.Time
+}
+
+// analysisCacheKey identifies an analysis request. Everything that shapes the prompt
+// or picks the model is included; the price is rounded to whole units so small
+// ticks still hit, with larger moves caught by maxMove.
+type analysisCacheKey struct {
+	Symbol            string
+	Price             float64
+	RiskProfile       string
+	TradeFrequency    string
+	UserContext       string
+	DetailLevel       string
+	MultiTimeframe    bool
+	IncludeTranscript bool
+	AIProvider        string
+	AIModel           string
+	Benchmark         string
+}
+
+func newAnalysisCache(ttl time.Duration, maxMove float64) *analysisCache {
+	return &analysisCache{ttl: ttl, maxMove: maxMove, entries: make(map[string]cachedAnalysis)}
+}
+
+func (k analysisCacheKey) hash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%.0f|%s|%s|%s|%s|%t|%t|%s|%s|%s",
+		k.Symbol, math.Round(k.Price), k.RiskProfile, k.TradeFrequency, strings.TrimSpace(k.UserContext),
+		k.DetailLevel, k.MultiTimeframe, k.IncludeTranscript, k.AIProvider, k.AIModel, k.Benchmark)))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns a copy of the cached analysis for key, unless it has expired or the
+// price has moved more than maxMove percent since it was made
+func (c *analysisCache) get(key analysisCacheKey) (*models.AnalysisResponse, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	hash := key.hash()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	moved := entry.price > 0 && math.Abs(key.Price-entry.price)/entry.price*100 > c.maxMove
+	if time.Since(entry.cachedAt) >= c.ttl || moved {
+		delete(c.entries, hash)
+		return nil, false
+	}
+
+	analysis := entry.analysis
+	analysis.Cached = true
+	return &analysis, true
+}
+
+// put caches an analysis made at key.Price, dropping expired entries
+func (c *analysisCache) put(key analysisCacheKey, analysis *models.AnalysisResponse) {
+	if c.ttl <= 0 {
+		return
+	}
+	hash := key.hash()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for h, entry := range c.entries {
+		if time.Since(entry.cachedAt) >= c.ttl {
+			delete(c.entries, h)
+		}
+	}
+	c.entries[hash] = cachedAnalysis{analysis: *analysis, price: key.Price, cachedAt: time.Now()}
+}
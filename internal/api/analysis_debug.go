@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"stockmarket/internal/config"
+	"stockmarket/internal/models"
+)
+
+// redactedSecret replaces anything in a stored prompt that looks like an API key
+const redactedSecret = "[REDACTED]"
+
+// apiKeyPattern matches common API key formats (OpenAI/Anthropic "sk-...", Google
+// "AIza...") and key=value style credentials
+var apiKeyPattern = regexp.MustCompile(`\b(sk-[A-Za-z0-9_-]{16,}|AIza[0-9A-Za-z_-]{30,})|(?i)\b((?:api[_-]?key|apikey|token|secret)["']?\s*[:=]\s*["']?)[^\s"'&,]+`)
+
+// saveAnalysis stores an analysis and, with STORE_RAW_PROMPTS set, the prompt and raw
+// reply behind it. Failures are logged; the analysis is still returned to the caller.
+func (s *Server) saveAnalysis(ctx context.Context, analysis *models.AnalysisResponse, cfg *models.UserConfig) {
+	if err := s.db.SaveAnalysis(analysis); err != nil {
+		slog.ErrorContext(ctx, "failed to save analysis", "symbol", analysis.Symbol, "error", err)
+		return
+	}
+	if !s.config.StoreRawPrompts || analysis.Prompt == "" {
+		return
+	}
+
+	secrets := s.knownSecrets(cfg)
+	debug := &models.AnalysisDebug{
+		AnalysisID:  analysis.ID,
+		Prompt:      redactSecrets(analysis.Prompt, secrets),
+		RawResponse: redactSecrets(analysis.RawResponse, secrets),
+	}
+	if err := s.db.SaveAnalysisDebug(debug); err != nil {
+		slog.ErrorContext(ctx, "failed to save analysis prompt", "analysis_id", analysis.ID, "error", err)
+	}
+}
+
+// knownSecrets returns the API keys the server and a profile hold, for redaction
+func (s *Server) knownSecrets(cfg *models.UserConfig) []string {
+	secrets := []string{s.config.APIKey}
+	for _, key := range s.config.ProviderAPIKeys {
+		secrets = append(secrets, key)
+	}
+	if cfg != nil {
+		for _, encrypted := range []string{cfg.MarketDataAPIKey, cfg.AIProviderAPIKey} {
+			if key, err := config.Decrypt(encrypted, s.config.DecryptionKeys()...); err == nil {
+				secrets = append(secrets, key)
+			}
+		}
+	}
+	return secrets
+}
+
+// redactSecrets blanks out the given secrets and anything else shaped like an API key
+func redactSecrets(text string, secrets []string) string {
+	for _, secret := range secrets {
+		// Very short values would redact ordinary words
+		if len(secret) >= 8 {
+			text = strings.ReplaceAll(text, secret, redactedSecret)
+		}
+	}
+	return apiKeyPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if parts := apiKeyPattern.FindStringSubmatch(match); parts[2] != "" {
+			return parts[2] + redactedSecret
+		}
+		return redactedSecret
+	})
+}
+
+// handleAnalysisDebug returns the prompt and raw AI reply stored for an analysis
+// (GET /api/analyses/{id}/debug). Only analyses run with STORE_RAW_PROMPTS have one.
+func (s *Server) handleAnalysisDebug(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/analyses/"), "/debug")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid analysis ID")
+		return
+	}
+
+	debug, err := s.db.GetAnalysisDebug(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, http.StatusNotFound, "No prompt stored for this analysis; set STORE_RAW_PROMPTS to keep them")
+		return
+	}
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, debug)
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"stockmarket/internal/db"
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// maxDiffCells bounds the word-by-word table of a reasoning diff; longer texts are
+// shown as replaced outright
+const maxDiffCells = 1 << 20
+
+// Diff segment operations
+const (
+	diffEqual  = "equal"
+	diffDelete = "delete"
+	diffInsert = "insert"
+)
+
+// handleAnalysisDiff compares two of a symbol's analyses (GET
+// /api/analyses/{symbol}/diff?from={id}&to={id}): the action change, confidence and
+// price deltas, and a word diff of the reasoning. Without to the latest analysis is
+// used, and without from the one before to.
+func (s *Server) handleAnalysisDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	symbol, err := market.NormalizeSymbol(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/analyses/"), "/diff"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	query := r.URL.Query()
+	var fromID, toID int64
+	for _, param := range []struct {
+		name string
+		id   *int64
+	}{{"from", &fromID}, {"to", &toID}} {
+		if v := query.Get(param.name); v != "" {
+			if *param.id, err = strconv.ParseInt(v, 10, 64); err != nil || *param.id <= 0 {
+				respondError(w, http.StatusBadRequest, param.name+" must be an analysis ID")
+				return
+			}
+		}
+	}
+
+	to, err := s.diffAnalysis(symbol, toID, 0)
+	if err == nil {
+		var from *models.AnalysisResponse
+		if from, err = s.diffAnalysis(symbol, fromID, to.ID); err == nil {
+			respondJSON(w, http.StatusOK, diffAnalyses(from, to))
+			return
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, http.StatusNotFound, "Analysis not found for "+symbol)
+		return
+	}
+	respondErr(w, http.StatusInternalServerError, err)
+}
+
+// diffAnalysis loads one side of a diff: analysis id, which must be of symbol and not
+// deleted, or with id 0 the symbol's analysis before analysis before (the latest when
+// before is 0 too). Missing analyses fail with sql.ErrNoRows.
+func (s *Server) diffAnalysis(symbol string, id, before int64) (*models.AnalysisResponse, error) {
+	if id != 0 {
+		analysis, err := s.db.GetAnalysisResponse(id)
+		if err != nil {
+			return nil, err
+		}
+		if analysis.Symbol != symbol || analysis.DeletedAt != nil {
+			return nil, sql.ErrNoRows
+		}
+		return analysis, nil
+	}
+
+	if before != 0 {
+		return s.db.PreviousAnalysis(before)
+	}
+	analyses, err := s.db.FilterAnalyses(db.AnalysisFilter{Symbol: symbol, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(analyses) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &analyses[0], nil
+}
+
+// diffAnalyses compares to against the baseline from
+func diffAnalyses(from, to *models.AnalysisResponse) models.AnalysisDiff {
+	diff := models.AnalysisDiff{
+		From:            from,
+		To:              to,
+		ActionChanged:   from.Action != to.Action,
+		ConfidenceDelta: to.Confidence - from.Confidence,
+		Reasoning:       diffWords(from.Reasoning, to.Reasoning),
+	}
+	if from.Price > 0 && to.Price > 0 {
+		delta := to.Price - from.Price
+		percent := delta / from.Price * 100
+		diff.PriceDelta, diff.PriceChangePercent = &delta, &percent
+	}
+	return diff
+}
+
+// diffWords diffs two texts word by word along their longest common subsequence,
+// merging runs of the same operation into one segment
+func diffWords(a, b string) []models.DiffSegment {
+	aw, bw := strings.Fields(a), strings.Fields(b)
+	segments := []models.DiffSegment{}
+	add := func(op, word string) {
+		if n := len(segments); n > 0 && segments[n-1].Op == op {
+			segments[n-1].Text += " " + word
+			return
+		}
+		segments = append(segments, models.DiffSegment{Op: op, Text: word})
+	}
+
+	if (len(aw)+1)*(len(bw)+1) > maxDiffCells {
+		for _, word := range aw {
+			add(diffDelete, word)
+		}
+		for _, word := range bw {
+			add(diffInsert, word)
+		}
+		return segments
+	}
+
+	// lcs[i][j] is the longest common subsequence of aw[i:] and bw[j:]
+	lcs := make([][]int, len(aw)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bw)+1)
+	}
+	for i := len(aw) - 1; i >= 0; i-- {
+		for j := len(bw) - 1; j >= 0; j-- {
+			if aw[i] == bw[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(aw) && j < len(bw) {
+		switch {
+		case aw[i] == bw[j]:
+			add(diffEqual, aw[i])
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(diffDelete, aw[i])
+			i++
+		default:
+			add(diffInsert, bw[j])
+			j++
+		}
+	}
+	for ; i < len(aw); i++ {
+		add(diffDelete, aw[i])
+	}
+	for ; j < len(bw); j++ {
+		add(diffInsert, bw[j])
+	}
+	return segments
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"stockmarket/internal/models"
+)
+
+func TestDiffWords(t *testing.T) {
+	cases := []struct {
+		name, a, b string
+		want       []models.DiffSegment
+	}{
+		{"replaced and appended", "the stock looks strong today", "the stock looks  weak today and tomorrow", []models.DiffSegment{
+			{Op: diffEqual, Text: "the stock looks"},
+			{Op: diffDelete, Text: "strong"},
+			{Op: diffInsert, Text: "weak"},
+			{Op: diffEqual, Text: "today"},
+			{Op: diffInsert, Text: "and tomorrow"},
+		}},
+		{"unchanged", "hold for now", "hold\nfor now", []models.DiffSegment{{Op: diffEqual, Text: "hold for now"}}},
+		{"from nothing", "", "new thesis", []models.DiffSegment{{Op: diffInsert, Text: "new thesis"}}},
+		{"to nothing", "old thesis", "", []models.DiffSegment{{Op: diffDelete, Text: "old thesis"}}},
+		{"both empty", "", "", []models.DiffSegment{}},
+	}
+	for _, c := range cases {
+		if got := diffWords(c.a, c.b); !slices.Equal(got, c.want) {
+			t.Errorf("%s: diffWords = %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+// TestDiffWordsTooLong checks that texts too long to diff word by word come back as
+// replaced outright
+func TestDiffWordsTooLong(t *testing.T) {
+	a := strings.Repeat("a ", 1100)
+	b := strings.Repeat("b ", 1000) + "a"
+	got := diffWords(a, b)
+	if len(got) != 2 || got[0].Op != diffDelete || got[1].Op != diffInsert || len(strings.Fields(got[0].Text)) != 1100 {
+		t.Errorf("got %d segments, want one delete of every old word then one insert", len(got))
+	}
+}
@@ -1,119 +1,295 @@
 package api
 
 import (
+	"cmp"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"golang.org/x/sync/errgroup"
+
 	"stockmarket/internal/ai"
-	"stockmarket/internal/config"
+	"stockmarket/internal/analytics"
+	"stockmarket/internal/apperr"
+	"stockmarket/internal/db"
+	"stockmarket/internal/indicators"
+	"stockmarket/internal/logging"
 	"stockmarket/internal/market"
 	"stockmarket/internal/models"
 	c "stockmarket/internal/web/components"
 	"stockmarket/internal/web/pages"
 )
 
+// analyzeInput is the optional body of POST /api/analyze/{symbol}
+type analyzeInput struct {
+	UserContext       string `json:"user_context"`
+	MultiTimeframe    bool   `json:"multi_timeframe"`
+	IncludeTranscript bool   `json:"include_transcript"`
+	DetailLevel       string `json:"detail_level"` // "brief" | "standard" | "detailed"
+	Benchmark         string `json:"benchmark"`    // benchmark compared against, e.g. SPY
+
+	// DryRun runs the analysis without saving, caching, forwarding or notifying it,
+	// and without recording its AI usage
+	DryRun bool `json:"dry_run"`
+
+	Tags []string `json:"tags"`
+
+	// Per-request overrides of the saved providers
+	MarketDataProvider string `json:"market_data_provider"`
+	AIProvider         string `json:"ai_provider"`
+	AIModel            string `json:"ai_model"`
+}
+
+// handleAnalyze runs an analysis of a symbol (POST /api/analyze/{symbol}) and returns
+// it. With ?async=true the analysis runs as a job instead: the job is returned at once
+// with a 202 and polled or cancelled at /api/analyze/jobs/{id}.
 func (s *Server) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/stream") {
+		s.handleAnalyzeStream(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/preview") {
+		s.handlePromptPreview(w, r)
+		return
+	}
 	if r.Method != http.MethodPost {
 		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
 		return
 	}
 
-	symbol := strings.TrimPrefix(r.URL.Path, "/api/analyze/")
-	if symbol == "" {
-		respondError(w, http.StatusBadRequest, SYMBOL_REQUIRED)
+	symbol, err := market.NormalizeSymbol(strings.TrimPrefix(r.URL.Path, "/api/analyze/"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
 		return
 	}
-	symbol = strings.ToUpper(symbol)
 
-	var input struct {
-		UserContext string `json:"user_context"`
+	input, err := decodeAnalyzeInput(r)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	if r.URL.Query().Get("dry_run") == "true" {
+		input.DryRun = true
 	}
-	json.NewDecoder(r.Body).Decode(&input)
 
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondErr(w, http.StatusInternalServerError, err)
 		return
 	}
+	symbol = market.ResolveSymbol(symbol, cfg.SymbolAliases)
 
-	// Get market data
-	marketAPIKey := ""
-	if cfg.MarketDataAPIKey != "" {
-		marketAPIKey, _ = config.Decrypt(cfg.MarketDataAPIKey, s.config.EncryptionKey)
+	fresh := r.URL.Query().Get("fresh") == "true"
+	// Refetching market data only matters for a fresh analysis
+	forceRefresh, err := boolQuery(r, "force_refresh")
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	if forceRefresh {
+		ctx, fresh = market.WithForceRefresh(ctx), true
 	}
 
-	provider, err := market.NewProvider(cfg.MarketDataProvider, marketAPIKey)
+	async, err := boolQuery(r, "async")
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "Market provider error: "+err.Error())
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	if async {
+		job := s.analysisJobs.start(context.WithoutCancel(ctx), cfg.ID, symbol, func(ctx context.Context, commit func() bool) (*models.AnalysisResponse, error) {
+			return s.analyze(ctx, cfg, symbol, input, fresh, commit)
+		})
+		respondJSON(w, http.StatusAccepted, job.snapshot())
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
-	defer cancel()
-
-	quote, err := provider.GetQuote(ctx, symbol)
+	analysis, err := s.analyze(ctx, cfg, symbol, input, fresh, nil)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, FAILED_TO_GET_QUOTE+": "+err.Error())
+		respondAnalysisError(w, err)
 		return
 	}
+	respondJSON(w, http.StatusOK, analysis)
+}
+
+// decodeAnalyzeInput reads the optional analyzeInput body of an analysis request, with
+// ?multi_timeframe=true, validating its detail level and benchmark
+func decodeAnalyzeInput(r *http.Request) (analyzeInput, error) {
+	var input analyzeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		return input, errors.New(INVALID_JSON)
+	}
+	if r.URL.Query().Get("multi_timeframe") == "true" {
+		input.MultiTimeframe = true
+	}
+	input.DetailLevel = strings.ToLower(strings.TrimSpace(input.DetailLevel))
+	if !ai.ValidDetailLevel(input.DetailLevel) {
+		return input, errors.New(INVALID_DETAIL_LEVEL)
+	}
+	if input.Benchmark != "" {
+		var err error
+		if input.Benchmark, err = market.NormalizeSymbol(input.Benchmark); err != nil {
+			return input, fmt.Errorf("benchmark: %w", err)
+		}
+	}
+	return input, nil
+}
+
+// analysisError is an analysis failure with the HTTP status it's reported with when
+// the error behind it has no code
+type analysisError struct {
+	status  int
+	message string
+	err     error
+}
+
+func (e *analysisError) Error() string {
+	return e.message
+}
+
+func (e *analysisError) Unwrap() error {
+	return e.err
+}
+
+// analysisErrorStatus is the status and code an error from analyze is reported with:
+// those of the code behind it, else its own status, or 500
+func analysisErrorStatus(err error) (int, string) {
+	if code := apperr.CodeOf(err); code != "" {
+		return apperr.Status(code), code
+	}
+	status := http.StatusInternalServerError
+	var ae *analysisError
+	if errors.As(err, &ae) {
+		status = ae.status
+	}
+	return status, apperr.CodeForStatus(status)
+}
 
-	historical, err := provider.GetHistoricalData(ctx, symbol, "1m")
+// respondAnalysisError reports an error from analyze
+func respondAnalysisError(w http.ResponseWriter, err error) {
+	status, code := analysisErrorStatus(err)
+	respondJSON(w, status, errorResponse{Error: err.Error(), Code: code})
+}
+
+// errAnalysisCancelled is returned by analyze when commit declines to save the analysis
+var errAnalysisCancelled = &analysisError{status: http.StatusConflict, message: "Analysis was cancelled"}
+
+// analyze gathers market data for a symbol and runs an analysis with input's options,
+// bounded by ANALYZE_TIMEOUT. Unless it's a dry run the analysis is then saved, cached,
+// forwarded and notified. A non-nil commit is asked first and returning false abandons
+// the analysis, so a cancelled job never persists or notifies.
+func (s *Server) analyze(ctx context.Context, cfg *models.UserConfig, symbol string, input analyzeInput, fresh bool, commit func() bool) (*models.AnalysisResponse, error) {
+	benchmark, err := s.analysisBenchmark(symbol, input.Benchmark)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, FAILED_TO_GET_HISTORICAL_DATA+": "+err.Error())
-		return
+		return nil, &analysisError{http.StatusBadRequest, err.Error(), err}
 	}
 
-	// Get AI analyzer
-	aiAPIKey := ""
-	if cfg.AIProviderAPIKey != "" {
-		aiAPIKey, _ = config.Decrypt(cfg.AIProviderAPIKey, s.config.EncryptionKey)
+	// Get market data
+	provider, err := s.requestMarketProvider(cfg, input.MarketDataProvider)
+	if err != nil {
+		return nil, &analysisError{providerErrorStatus(err), "Market provider error: " + err.Error(), err}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AnalyzeTimeout)
+	defer cancel()
+	if input.DryRun {
+		ctx = ai.WithoutUsage(ctx)
 	}
 
-	analyzer, err := ai.NewAnalyzer(cfg.AIProvider, aiAPIKey, cfg.AIModel)
+	quote, err := s.fetchQuote(ctx, provider, symbol)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, FAILED_TO_GET_ANALYZE+": "+err.Error())
-		return
+		return nil, &analysisError{http.StatusBadRequest, FAILED_TO_GET_QUOTE + ": " + err.Error(), err}
+	}
+	s.applyYearRange(ctx, provider, quote)
+	applyExtendedHours(cfg, quote)
+
+	// An explicit override wins over the configured model rules
+	aiProvider, aiModel := input.AIProvider, input.AIModel
+	if aiProvider == "" && aiModel == "" {
+		aiProvider, aiModel = s.ruleModel(symbol, cfg.TradeFrequency)
+	}
+
+	// Reuse a recent identical analysis unless the caller wants a fresh one
+	cacheKey := analysisCacheKey{
+		Symbol:            symbol,
+		Price:             quote.Price,
+		RiskProfile:       cfg.RiskTolerance,
+		TradeFrequency:    cfg.TradeFrequency,
+		UserContext:       input.UserContext,
+		DetailLevel:       input.DetailLevel,
+		MultiTimeframe:    input.MultiTimeframe,
+		IncludeTranscript: input.IncludeTranscript,
+		AIProvider:        cmp.Or(aiProvider, cfg.AIProvider),
+		AIModel:           cmp.Or(aiModel, cfg.AIModel),
+		Benchmark:         benchmark,
+	}
+	if !fresh {
+		if cached, ok := s.analysisCache.get(cacheKey); ok {
+			cached.Tags = normalizeTags(input.Tags)
+			cached.DryRun = input.DryRun
+			return cached, nil
+		}
+	}
+
+	analyzer, err := s.requestAnalyzer(cfg, aiProvider, aiModel)
+	if err != nil {
+		return nil, &analysisError{providerErrorStatus(err), FAILED_TO_GET_ANALYZE + ": " + err.Error(), err}
 	}
 
 	// Perform analysis
-	analysisReq := models.AnalysisRequest{
-		Symbol:         symbol,
-		CurrentPrice:   quote.Price,
-		HistoricalData: historical,
-		RiskProfile:    cfg.RiskTolerance,
-		TradeFrequency: cfg.TradeFrequency,
-		UserContext:    input.UserContext,
+	analysisReq, err := s.buildAnalysisRequest(ctx, cfg, provider, analyzer, symbol, quote, input, benchmark)
+	if err != nil {
+		return nil, &analysisError{http.StatusBadRequest, FAILED_TO_GET_HISTORICAL_DATA + ": " + err.Error(), err}
 	}
 
-	analysis, err := analyzer.Analyze(ctx, analysisReq)
+	slog.DebugContext(ctx, "running analysis", "symbol", symbol, "market_provider", provider.Name(),
+		"ai_provider", analyzer.Name(), "model", analyzer.Model())
+	analysis, err := s.runAnalysis(ctx, analyzer, analysisReq)
+	if errors.Is(err, errBudgetExceeded) {
+		return nil, &analysisError{http.StatusPaymentRequired, err.Error(), err}
+	}
+	if errors.Is(err, ai.ErrInvalidAnalysis) {
+		return nil, &analysisError{http.StatusBadGateway, FAILED_TO_GET_ANALYZE + ": " + err.Error(), err}
+	}
+	if errors.Is(err, ai.ErrRateLimited) {
+		return nil, &analysisError{http.StatusTooManyRequests, FAILED_TO_GET_ANALYZE + ": " + err.Error(), err}
+	}
+	if errors.Is(err, errAIUnavailable) {
+		return nil, &analysisError{http.StatusServiceUnavailable, err.Error(), err}
+	}
+	if errors.Is(err, ai.ErrOverloaded) {
+		return nil, &analysisError{http.StatusServiceUnavailable, FAILED_TO_GET_ANALYZE + ": " + err.Error(), err}
+	}
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, FAILED_TO_GET_ANALYZE+": "+err.Error())
-		return
+		slog.ErrorContext(ctx, "analysis failed", "symbol", symbol, "ai_provider", analyzer.Name(), "error", err)
+		return nil, &analysisError{http.StatusInternalServerError, FAILED_TO_GET_ANALYZE + ": " + err.Error(), err}
+	}
+	analysis.Tags = normalizeTags(input.Tags)
+	if input.DryRun {
+		analysis.DryRun = true
+		return analysis, nil
+	}
+	if commit != nil && !commit() {
+		return nil, errAnalysisCancelled
 	}
 
 	// Save analysis
-	if err := s.db.SaveAnalysis(analysis); err != nil {
-		log.Printf("Failed to save analysis: %v", err)
-	}
+	s.saveAnalysis(ctx, analysis, cfg)
+	s.analysisCache.put(cacheKey, analysis)
+	s.forwardAnalysis(analysis)
 
-	// Send notifications if action is BUY or SELL with high confidence
-	if (analysis.Action == "BUY" || analysis.Action == "SELL") && analysis.Confidence >= 0.7 {
-		notification := models.Notification{
-			Type:    strings.ToLower(analysis.Action) + "_signal",
-			Title:   fmt.Sprintf("%s Signal: %s", analysis.Action, symbol),
-			Message: analysis.Reasoning,
-			Symbol:  symbol,
-		}
-		go s.notifyService.SendToChannels(notification, cfg.NotificationChannels)
-	}
+	s.notifySignal(ctx, analysis, cfg)
 
-	respondJSON(w, http.StatusOK, analysis)
+	return analysis, nil
 }
 
 // handleAnalyses returns recent analysis results
@@ -123,54 +299,165 @@ func (s *Server) handleAnalyses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limitStr := r.URL.Query().Get("limit")
-	limit := 50
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
+	filter, err := ParseAnalysisFilter(r, 50)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
 	}
 
-	analyses, err := s.db.GetRecentAnalyses(limit)
+	analyses, err := s.db.FilterAnalyses(filter)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondErr(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, analyses)
 }
 
+// ParseAnalysisFilter reads analysis history filters from the query string: symbol,
+// action, min_confidence, from/to (RFC 3339 or a date, to inclusive of its day),
+// tag, sort (created_at or confidence) and limit
+func ParseAnalysisFilter(r *http.Request, defaultLimit int) (db.AnalysisFilter, error) {
+	q := r.URL.Query()
+	filter := db.AnalysisFilter{
+		Symbol: strings.ToUpper(strings.TrimSpace(q.Get("symbol"))),
+		Action: strings.ToUpper(strings.TrimSpace(q.Get("action"))),
+		Tags:   queryTags(r),
+		Sort:   q.Get("sort"),
+		Limit:  defaultLimit,
+	}
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
+		filter.Limit = l
+	}
+
+	if filter.Action != "" && !ai.ValidAction(filter.Action) {
+		return filter, fmt.Errorf("invalid action: %q", q.Get("action"))
+	}
+	if filter.Sort != "" && !db.ValidAnalysisSort(filter.Sort) {
+		return filter, errors.New("sort must be created_at or confidence")
+	}
+	if v := q.Get("min_confidence"); v != "" {
+		c, err := strconv.ParseFloat(v, 64)
+		if err != nil || c < 0 || c > 1 {
+			return filter, errors.New("min_confidence must be a number between 0 and 1")
+		}
+		filter.MinConfidence = c
+	}
+
+	var err error
+	if v := q.Get("from"); v != "" {
+		if filter.From, err = parseExportTime(v, false); err != nil {
+			return filter, fmt.Errorf("invalid from: %q", v)
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if filter.To, err = parseExportTime(v, true); err != nil {
+			return filter, fmt.Errorf("invalid to: %q", v)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.To.After(filter.From) {
+		return filter, errors.New("to must be after from")
+	}
+	if filter.IncludeDeleted, err = boolQuery(r, "include_deleted"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
 // handleAnalysesForSymbol returns analyses for a specific symbol
 func (s *Server) handleAnalysesForSymbol(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/debug") {
+		s.handleAnalysisDebug(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/restore") {
+		s.handleAnalysisRestore(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/timeline") {
+		s.handleAnalysisTimeline(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/diff") {
+		s.handleAnalysisDiff(w, r)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/analyses/")
+	// All-digit segments are analysis IDs; digit-only tickers need their exchange suffix (e.g. 7203.T)
+	if rest != "" && strings.Trim(rest, "0123456789") == "" {
+		s.handleAnalysisByID(w, r, rest)
+		return
+	}
 	if r.Method != http.MethodGet {
 		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
 		return
 	}
 
-	symbol := strings.TrimPrefix(r.URL.Path, "/api/analyses/")
-	if symbol == "" {
-		respondError(w, http.StatusBadRequest, SYMBOL_REQUIRED)
+	symbol, err := market.NormalizeSymbol(rest)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
 		return
 	}
-	symbol = strings.ToUpper(symbol)
-
-	limitStr := r.URL.Query().Get("limit")
-	limit := 20
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
+	filter, err := ParseAnalysisFilter(r, 20)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
 	}
+	filter.Symbol = symbol
 
-	analyses, err := s.db.GetAnalysesForSymbol(symbol, limit)
+	analyses, err := s.db.FilterAnalyses(filter)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondErr(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, analyses)
 }
 
+// handleAnalysisByID returns one analysis, shaped like the entries of GET /api/analyses
+// (GET /api/analyses/{id}, deleted ones only with ?include_deleted=true), or soft-deletes
+// it (DELETE /api/analyses/{id})
+func (s *Server) handleAnalysisByID(w http.ResponseWriter, r *http.Request, idStr string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		respondError(w, http.StatusBadRequest, "Invalid analysis ID")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := s.db.DeleteAnalysis(id); errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "Analysis not found")
+			return
+		} else if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+		return
+	}
+
+	includeDeleted, err := boolQuery(r, "include_deleted")
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	analysis, err := s.db.GetAnalysisResponse(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && analysis.DeletedAt != nil && !includeDeleted) {
+		respondError(w, http.StatusNotFound, "Analysis not found")
+		return
+	}
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, analysis)
+}
+
 // handleAnalyzeHTMX handles HTMX form submissions for stock analysis
 func (s *Server) handleAnalyzeHTMX(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -186,51 +473,60 @@ func (s *Server) handleAnalyzeHTMX(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	symbol := strings.ToUpper(strings.TrimSpace(r.FormValue("symbol")))
+	symbol, symbolErr := market.NormalizeSymbol(r.FormValue("symbol"))
 	userContext := r.FormValue("context")
+	multiTimeframe := r.FormValue("multi_timeframe") == "on" || r.FormValue("multi_timeframe") == "true"
+	tags := normalizeTags(strings.Split(r.FormValue("tags"), ","))
+	detailLevel := strings.ToLower(strings.TrimSpace(r.FormValue("detail_level")))
 
-	if symbol == "" {
+	if symbolErr != nil {
+		w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_HTML)
+		c.ErrorMessage(symbolErr.Error()).Render(ctx, w)
+		return
+	}
+	if !ai.ValidDetailLevel(detailLevel) {
 		w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_HTML)
-		c.ErrorMessage(SYMBOL_REQUIRED).Render(ctx, w)
+		c.ErrorMessage(INVALID_DETAIL_LEVEL).Render(ctx, w)
 		return
 	}
 
 	// Get config
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
 		w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_HTML)
 		c.ErrorMessage(FAILED_TO_GET_CONFIG).Render(ctx, w)
 		return
 	}
+	symbol = market.ResolveSymbol(symbol, cfg.SymbolAliases)
 
-	// Get market data
-	marketAPIKey := ""
-	if cfg.MarketDataAPIKey != "" {
-		marketAPIKey, _ = config.Decrypt(cfg.MarketDataAPIKey, s.config.EncryptionKey)
-	}
-	provider, err := market.NewProvider(cfg.MarketDataProvider, marketAPIKey)
+	provider, err := s.marketProvider(cfg)
 	if err != nil {
 		w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_HTML)
 		c.ErrorMessage("Market provider error: "+err.Error()).Render(ctx, w)
 		return
 	}
 
-	quote, err := provider.GetQuote(ctx, symbol)
+	quote, err := s.fetchQuote(ctx, provider, symbol)
 	if err != nil {
 		w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_HTML)
 		c.ErrorMessage(FAILED_TO_GET_QUOTE+": "+err.Error()).Render(ctx, w)
 		return
 	}
+	s.applyYearRange(ctx, provider, quote)
+	applyExtendedHours(cfg, quote)
 
-	historical, _ := provider.GetHistoricalData(ctx, symbol, "1d")
+	benchmark, _ := s.analysisBenchmark(symbol, "") // only a requested benchmark can be invalid
+	historical, comparison, _ := s.historyWithBenchmark(ctx, provider, symbol, "1d", benchmark)
 
 	// Get AI analyzer
-	aiAPIKey := cfg.AIProviderAPIKey
-	if aiAPIKey != "" {
-		aiAPIKey, _ = config.Decrypt(aiAPIKey, s.config.EncryptionKey)
+	aiAPIKey, err := s.decryptSecret("AI provider API key", cfg.AIProviderAPIKey)
+	if err != nil {
+		w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_HTML)
+		c.ErrorMessage(FAILED_TO_GET_ANALYZE+": "+err.Error()).Render(ctx, w)
+		return
 	}
 
-	analyzer, err := ai.NewAnalyzer(cfg.AIProvider, aiAPIKey, cfg.AIModel)
+	analyzer, err := s.newAnalyzer(cfg.AIProvider, aiAPIKey, cfg.AIModel)
 	if err != nil {
 		w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_HTML)
 		c.ErrorMessage(FAILED_TO_GET_ANALYZE+": "+err.Error()).Render(ctx, w)
@@ -245,20 +541,33 @@ func (s *Server) handleAnalyzeHTMX(w http.ResponseWriter, r *http.Request) {
 		RiskProfile:    cfg.RiskTolerance,
 		TradeFrequency: cfg.TradeFrequency,
 		UserContext:    userContext,
+		DetailLevel:    detailLevel,
+
+		FiftyTwoWeekHigh: quote.FiftyTwoWeekHigh,
+		FiftyTwoWeekLow:  quote.FiftyTwoWeekLow,
+		Quote:            quote,
+		Benchmark:        comparison,
 	}
+	if multiTimeframe {
+		analysisReq.Timeframes = s.fetchTimeframes(ctx, provider, symbol, cfg.TradeFrequency)
+	}
+	s.addPromptContext(ctx, provider, analyzer, &analysisReq, false)
 
-	analysisCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	analysisCtx, cancel := context.WithTimeout(ctx, s.config.AnalyzeTimeout)
 	defer cancel()
 
-	result, err := analyzer.Analyze(analysisCtx, analysisReq)
+	result, err := s.runAnalysis(analysisCtx, analyzer, analysisReq)
 	if err != nil {
 		w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_HTML)
 		c.ErrorMessage(FAILED_TO_GET_ANALYZE+": "+err.Error()).Render(ctx, w)
 		return
 	}
 
+	result.Tags = tags
+
 	// Save to database
-	s.db.SaveAnalysis(result)
+	s.saveAnalysis(ctx, result, cfg)
+	s.forwardAnalysis(result)
 
 	// Convert to pages.AnalysisResult and render
 	analysisResult := pages.AnalysisResult{
@@ -271,6 +580,7 @@ func (s *Server) handleAnalyzeHTMX(w http.ResponseWriter, r *http.Request) {
 			TargetPrice: result.PriceTargets.Target,
 			StopLoss:    result.PriceTargets.StopLoss,
 			Reasoning:   result.Reasoning,
+			Risks:       result.Risks,
 		},
 		MarketData: &pages.MarketData{
 			Price:         quote.Price,
@@ -284,6 +594,418 @@ func (s *Server) handleAnalyzeHTMX(w http.ResponseWriter, r *http.Request) {
 	pages.AnalysisResultCard(analysisResult).Render(ctx, w)
 }
 
+// requestMarketProvider builds the market data provider for a request, using the saved
+// provider unless override names a different one. Overridden providers use the
+// server-configured API key for that provider.
+func (s *Server) requestMarketProvider(cfg *models.UserConfig, override string) (market.Provider, error) {
+	name := strings.ToLower(strings.TrimSpace(override))
+	if name == "" || name == cfg.MarketDataProvider {
+		return s.marketProvider(cfg)
+	}
+
+	if !slices.Contains(market.Providers, name) {
+		return nil, fmt.Errorf("unknown provider %q (expected one of %s)", name, strings.Join(market.Providers, ", "))
+	}
+	apiKey := s.config.ProviderAPIKeys[name]
+	if apiKey == "" && market.RequiresAPIKey(name) {
+		return nil, fmt.Errorf("no server API key configured for %s", name)
+	}
+	provider, err := s.newMarketProvider(name, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return market.NewCachingProvider(s.routeCrypto(provider), s.quoteCache), nil
+}
+
+// requestAnalyzer builds the AI analyzer for a request, using the saved provider and
+// model unless overridden. Overridden providers use the server-configured API key for
+// that provider and its default model when no model is given.
+func (s *Server) requestAnalyzer(cfg *models.UserConfig, providerOverride, modelOverride string) (ai.Analyzer, error) {
+	name := ai.CanonicalProvider(strings.ToLower(strings.TrimSpace(providerOverride)))
+	model := strings.TrimSpace(modelOverride)
+
+	if name == "" || name == ai.CanonicalProvider(cfg.AIProvider) {
+		if model == "" {
+			model = cfg.AIModel
+		}
+		apiKey, err := s.decryptSecret("AI provider API key", cfg.AIProviderAPIKey)
+		if err != nil {
+			return nil, err
+		}
+		return s.newAnalyzer(cfg.AIProvider, apiKey, model)
+	}
+
+	if !slices.Contains(ai.Providers, name) {
+		return nil, fmt.Errorf("unknown AI provider %q (expected one of %s)", name, strings.Join(ai.Providers, ", "))
+	}
+	apiKey := s.config.ProviderAPIKeys[name]
+	if apiKey == "" && ai.RequiresAPIKey(name) {
+		return nil, fmt.Errorf("no server API key configured for %s", name)
+	}
+	return s.newAnalyzer(name, apiKey, model)
+}
+
+// ruleModel returns the AI provider and model the configured rules assign to a symbol
+// or horizon, preferring symbol rules. Both are empty when no rule matches.
+func (s *Server) ruleModel(symbol, horizon string) (provider, model string) {
+	for _, rule := range s.config.AnalysisModelRules {
+		if rule.Symbol == symbol {
+			return rule.Provider, rule.Model
+		}
+	}
+	for _, rule := range s.config.AnalysisModelRules {
+		if rule.Horizon != "" && rule.Horizon == horizon {
+			return rule.Provider, rule.Model
+		}
+	}
+	return "", ""
+}
+
+// fetchTimeframes concurrently loads the timeframes configured for a trade frequency
+// for a multi-timeframe analysis, shortest first and weighted for that frequency.
+// Timeframes that fail to load are skipped and the rest reweighted.
+func (s *Server) fetchTimeframes(ctx context.Context, provider market.Provider, symbol, tradeFrequency string) []models.TimeframeData {
+	periods := slices.Clone(s.config.TimeframesFor(tradeFrequency))
+	slices.SortStableFunc(periods, market.ComparePeriods)
+
+	loaded := make([]models.TimeframeData, len(periods))
+	var g errgroup.Group
+	for i, period := range periods {
+		g.Go(func() error {
+			ctx, cancel := context.WithTimeout(ctx, s.config.HistoricalTimeout)
+			defer cancel()
+
+			candles, err := market.AdjustedHistory(ctx, provider, symbol, period, "")
+			if err != nil || len(candles) == 0 {
+				slog.WarnContext(ctx, "skipping timeframe", "symbol", symbol, "period", period, "error", err)
+				return nil
+			}
+			loaded[i] = models.TimeframeData{Period: period, Candles: candles}
+			return nil
+		})
+	}
+	g.Wait()
+
+	timeframes := slices.DeleteFunc(loaded, func(tf models.TimeframeData) bool { return tf.Candles == nil })
+	if len(timeframes) > 0 {
+		ai.WeightTimeframes(timeframes, tradeFrequency)
+	}
+	return timeframes
+}
+
+// buildAnalysisRequest gathers what an analysis of symbol at quote with input's options
+// is run with: its history and benchmark comparison, the timeframes input asks for and
+// the prompt context enabled in config. A nil analyzer leaves out an earnings call
+// that has no cached summary. It fails only when the history can't be fetched.
+func (s *Server) buildAnalysisRequest(ctx context.Context, cfg *models.UserConfig, provider market.Provider, analyzer ai.Analyzer, symbol string, quote *models.Quote, input analyzeInput, benchmark string) (models.AnalysisRequest, error) {
+	historical, comparison, err := s.historyWithBenchmark(ctx, provider, symbol, "1m", benchmark)
+	if err != nil {
+		return models.AnalysisRequest{}, err
+	}
+
+	req := models.AnalysisRequest{
+		Symbol:         symbol,
+		CurrentPrice:   quote.Price,
+		HistoricalData: historical,
+		RiskProfile:    cfg.RiskTolerance,
+		TradeFrequency: cfg.TradeFrequency,
+		UserContext:    input.UserContext,
+		DetailLevel:    input.DetailLevel,
+
+		FiftyTwoWeekHigh: quote.FiftyTwoWeekHigh,
+		FiftyTwoWeekLow:  quote.FiftyTwoWeekLow,
+		Quote:            quote,
+		Benchmark:        comparison,
+	}
+	if input.MultiTimeframe {
+		req.Timeframes = s.fetchTimeframes(ctx, provider, symbol, cfg.TradeFrequency)
+	}
+	s.addPromptContext(ctx, provider, analyzer, &req, input.IncludeTranscript)
+	return req, nil
+}
+
+// addPromptContext adds the optional context sections (earnings-call sentiment, the
+// user's position, sector performance and intraday VWAP) enabled in config
+func (s *Server) addPromptContext(ctx context.Context, provider market.Provider, analyzer ai.Analyzer, req *models.AnalysisRequest, includeTranscript bool) {
+	if includeTranscript || s.config.AnalysisTranscriptSentiment {
+		req.TranscriptSummary = s.transcriptSummary(ctx, provider, analyzer, req.Symbol)
+	}
+	if s.config.AnalysisPositionContext {
+		if position, err := s.db.GetPosition(req.Symbol); err == nil {
+			req.Position = position
+		}
+	}
+	if s.config.AnalysisSectorContext {
+		req.MarketContext = formatSectorContext(s.sectorPerformance(ctx, provider))
+	}
+	if s.config.AnalysisVWAP && req.TradeFrequency == "daily" {
+		if cfg, err := s.db.GetProfileConfig(ProfileID(ctx)); err == nil {
+			if vwap, _, err := s.intradayVWAP(ctx, cfg, req.Symbol); err == nil {
+				req.VWAP = &vwap
+			}
+		}
+	}
+}
+
+// maxPromptLevels caps how many support/resistance levels are included in a prompt
+const maxPromptLevels = 6
+
+// addComputedContext adds the sections computed from the request's own history, support
+// and resistance levels and technical indicators, enabled in config
+func (s *Server) addComputedContext(req *models.AnalysisRequest) {
+	if s.config.AnalysisLevels {
+		req.Levels = indicators.SupportResistance(req.HistoricalData)
+		if len(req.Levels) > maxPromptLevels {
+			req.Levels = req.Levels[:maxPromptLevels]
+		}
+	}
+	if s.config.AnalysisIndicators {
+		req.Indicators = indicators.Latest(req.HistoricalData)
+	}
+}
+
+// runAnalysis calls the analyzer and post-processes its output
+func (s *Server) runAnalysis(ctx context.Context, analyzer ai.Analyzer, req models.AnalysisRequest) (*models.AnalysisResponse, error) {
+	if err := s.checkBudget(); err != nil {
+		return nil, err
+	}
+	s.addComputedContext(&req)
+
+	analysis, err := s.guardedAnalysis(ctx, analyzer, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-run a bare HOLD once with a more directive prompt
+	if s.config.AnalysisBareHoldRetry && ai.IsBareHold(analysis, s.config.AnalysisBareHoldConfidence) {
+		slog.InfoContext(ctx, "bare HOLD analysis, retrying with a directive prompt",
+			"symbol", req.Symbol, "confidence", analysis.Confidence)
+		retryReq := req
+		retryReq.RetryHint = ai.DirectiveRetryHint
+		if retry, err := s.guardedAnalysis(ctx, analyzer, retryReq); err == nil {
+			ai.AddUsage(retry, analysis)
+			analysis = retry
+		} else {
+			slog.WarnContext(ctx, "directive retry failed, keeping original analysis", "symbol", req.Symbol, "error", err)
+		}
+	}
+
+	// Every recommendation should carry its caveats; re-run once if the model listed none
+	if analysis.Incomplete && s.config.AnalysisRisksRetry {
+		slog.InfoContext(ctx, "analysis listed no risks, retrying", "symbol", req.Symbol)
+		retryReq := req
+		retryReq.RetryHint = ai.RisksRetryHint
+		retry, err := s.guardedAnalysis(ctx, analyzer, retryReq)
+		switch {
+		case err != nil:
+			slog.WarnContext(ctx, "risks retry failed, keeping incomplete analysis", "symbol", req.Symbol, "error", err)
+		case retry.Incomplete:
+			slog.WarnContext(ctx, "analysis listed no risks on retry, keeping it marked incomplete", "symbol", req.Symbol)
+			ai.AddUsage(analysis, retry)
+		default:
+			ai.AddUsage(retry, analysis)
+			analysis = retry
+		}
+	}
+	analysis.PositionContext = req.Position != nil
+	analysis.Price = req.CurrentPrice
+	if req.Quote != nil {
+		analysis.Currency = req.Quote.Currency
+	}
+	analysis.DetailLevel = req.DetailLevel
+	if analysis.DetailLevel == "" {
+		analysis.DetailLevel = ai.DetailStandard
+	}
+	if req.Benchmark != nil {
+		analysis.Beta = req.Benchmark.Beta
+		analysis.Benchmark = req.Benchmark.Symbol
+	}
+	if dropped := ai.CheckLevelSides(analysis.Action, &analysis.PriceTargets, req.CurrentPrice, analysis.Currency); len(dropped) > 0 {
+		slog.WarnContext(ctx, "dropped price levels on the wrong side of entry", "symbol", req.Symbol, "action", analysis.Action, "levels", strings.Join(dropped, "; "))
+	}
+	analysis.SuggestedAlerts = indicators.SuggestAlertLevels(req.CurrentPrice, analysis.PriceTargets, req.HistoricalData)
+	if s.config.AnalysisCalibration {
+		latest := req.Indicators
+		if latest == nil {
+			latest = indicators.Latest(req.HistoricalData)
+		}
+		if latest != nil {
+			*analysis = ai.Calibrate(*analysis, *latest)
+		}
+	}
+	s.smoothConfidence(analysis)
+	return analysis, nil
+}
+
+// guardedAnalysis calls the analyzer and applies the response and price guardrails to its output
+func (s *Server) guardedAnalysis(ctx context.Context, analyzer ai.Analyzer, req models.AnalysisRequest) (*models.AnalysisResponse, error) {
+	// analyze runs the analyzer once, unless its circuit breaker is open, and records
+	// which timeframes it was given
+	analyze := func() (*models.AnalysisResponse, error) {
+		if err := s.aiBreaker.allow(analyzer.Name()); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		analysis, err := analyzer.Analyze(ctx, req)
+		s.recordAICall(analyzer.Name(), time.Since(start), err)
+		s.aiBreaker.record(analyzer.Name(), err)
+		if err != nil {
+			return nil, err
+		}
+		for _, tf := range req.Timeframes {
+			analysis.Timeframes = append(analysis.Timeframes, tf.Period)
+		}
+		return analysis, nil
+	}
+
+	analysis, err := analyze()
+	for attempt := 1; errors.Is(err, ai.ErrInvalidAnalysis) && attempt <= s.config.AnalysisInvalidRetries; attempt++ {
+		slog.WarnContext(ctx, "invalid analysis response, retrying",
+			"symbol", req.Symbol, "error", err, "attempt", attempt, "max_attempts", s.config.AnalysisInvalidRetries)
+		analysis, err = analyze()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	violations := ai.CheckPriceTargets(analysis.PriceTargets, req.CurrentPrice, s.config.AnalysisMaxPriceMultiple, ai.RequestCurrency(req))
+	if len(violations) == 0 {
+		return analysis, nil
+	}
+	slog.WarnContext(ctx, "analysis failed price guardrail", "symbol", req.Symbol, "violations", strings.Join(violations, "; "))
+
+	switch s.config.AnalysisGuardrailMode {
+	case ai.GuardrailModeReject:
+		return nil, ai.ErrPriceGuardrail
+	case ai.GuardrailModeRetry:
+		retry, err := analyze()
+		if err == nil {
+			ai.AddUsage(retry, analysis)
+			analysis = retry
+			violations = ai.CheckPriceTargets(analysis.PriceTargets, req.CurrentPrice, s.config.AnalysisMaxPriceMultiple, ai.RequestCurrency(req))
+			if len(violations) == 0 {
+				slog.InfoContext(ctx, "analysis passed price guardrail on retry", "symbol", req.Symbol)
+				return analysis, nil
+			}
+			slog.WarnContext(ctx, "analysis failed price guardrail on retry", "symbol", req.Symbol, "violations", strings.Join(violations, "; "))
+		}
+	}
+
+	ai.FlagAnalysis(analysis, violations)
+	return analysis, nil
+}
+
+// smoothConfidence blends the analysis confidence with the symbol's previous smoothed
+// confidence, leaving the raw value in Confidence. It is a no-op when smoothing is disabled.
+func (s *Server) smoothConfidence(analysis *models.AnalysisResponse) {
+	weight := s.config.AnalysisConfidenceSmoothing
+	if weight <= 0 {
+		return
+	}
+
+	smoothed := analysis.Confidence
+	if prev, err := s.db.GetAnalysesForSymbol(analysis.Symbol, 1); err == nil && len(prev) > 0 {
+		prior := prev[0].Confidence
+		if prev[0].SmoothedConfidence != nil {
+			prior = *prev[0].SmoothedConfidence
+		}
+		smoothed = analytics.EWMA(prior, analysis.Confidence, 1-weight)
+	}
+	analysis.SmoothedConfidence = &smoothed
+}
+
+// signalConfidence is the confidence compared against the notification threshold
+func signalConfidence(analysis *models.AnalysisResponse) float64 {
+	if analysis.SmoothedConfidence != nil {
+		return *analysis.SmoothedConfidence
+	}
+	return analysis.Confidence
+}
+
+// notifySignal sends notifications if the profile notifies on the action and the signal
+// meets its confidence threshold. HOLD also needs notify_on_hold.
+func (s *Server) notifySignal(ctx context.Context, analysis *models.AnalysisResponse, cfg *models.UserConfig) {
+	if !slices.Contains(cfg.NotifyOnActions, analysis.Action) || (analysis.Action == "HOLD" && !cfg.NotifyOnHold) {
+		return
+	}
+	if signalConfidence(analysis) < cfg.NotifyMinConfidence {
+		return
+	}
+	message := analysis.Reasoning
+	if levels := ai.LevelSummary(analysis.Symbol, analysis.Action, analysis.PriceTargets, cmp.Or(analysis.Currency, market.SymbolCurrency(analysis.Symbol))); levels != "" {
+		message = levels + "\n\n" + message
+	}
+	notification := models.Notification{
+		Type:    strings.ToLower(analysis.Action) + "_signal",
+		Title:   fmt.Sprintf("%s Signal: %s", analysis.Action, analysis.Symbol),
+		Message: message,
+		Symbol:  analysis.Symbol,
+
+		RequestID: logging.RequestID(ctx),
+	}
+	s.enqueueNotification(cfg.ID, notification, cfg.NotificationChannels)
+}
+
+// analyzeSymbol gathers market data for a symbol, runs and saves an analysis with default options
+func (s *Server) analyzeSymbol(ctx context.Context, cfg *models.UserConfig, provider market.Provider, analyzer ai.Analyzer, symbol string) (*models.AnalysisResponse, error) {
+	quote, err := s.fetchQuote(ctx, provider, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", FAILED_TO_GET_QUOTE, err)
+	}
+	analysis, err := s.analyzeQuote(ctx, cfg, provider, analyzer, quote, false)
+	if err != nil {
+		return nil, err
+	}
+	s.saveAnalysis(ctx, analysis, cfg)
+	s.forwardAnalysis(analysis)
+	return analysis, nil
+}
+
+// analyzeQuote runs an analysis of an already fetched quote with the profile's settings,
+// without saving it. riskReview asks for the downside-focused SELL or HOLD variant.
+func (s *Server) analyzeQuote(ctx context.Context, cfg *models.UserConfig, provider market.Provider, analyzer ai.Analyzer, quote *models.Quote, riskReview bool) (*models.AnalysisResponse, error) {
+	symbol := quote.Symbol
+	s.applyYearRange(ctx, provider, quote)
+	applyExtendedHours(cfg, quote)
+
+	benchmark, _ := s.analysisBenchmark(symbol, "") // only a requested benchmark can be invalid
+	historical, comparison, err := s.historyWithBenchmark(ctx, provider, symbol, "1m", benchmark)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", FAILED_TO_GET_HISTORICAL_DATA, err)
+	}
+
+	analysisReq := models.AnalysisRequest{
+		Symbol:         symbol,
+		CurrentPrice:   quote.Price,
+		HistoricalData: historical,
+		RiskProfile:    cfg.RiskTolerance,
+		TradeFrequency: cfg.TradeFrequency,
+
+		FiftyTwoWeekHigh: quote.FiftyTwoWeekHigh,
+		FiftyTwoWeekLow:  quote.FiftyTwoWeekLow,
+		Quote:            quote,
+		Benchmark:        comparison,
+		RiskReview:       riskReview,
+	}
+	s.addPromptContext(ctx, provider, analyzer, &analysisReq, false)
+
+	slog.DebugContext(ctx, "running analysis", "symbol", symbol, "market_provider", provider.Name(),
+		"ai_provider", analyzer.Name(), "model", analyzer.Model(), "risk_review", riskReview)
+	return s.runAnalysis(ctx, analyzer, analysisReq)
+}
+
+// forwardAnalysis sends an analysis to the outbound webhook, if one is configured
+func (s *Server) forwardAnalysis(analysis *models.AnalysisResponse) {
+	if s.webhook == nil {
+		return
+	}
+	go func() {
+		if err := s.webhook.Forward(analysis); err != nil {
+			slog.Error("failed to forward analysis", "error", err)
+		}
+	}()
+}
+
 // formatVolume formats a volume number for display
 func formatVolume(vol int64) string {
 	switch {
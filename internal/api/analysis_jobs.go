@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// analysisJobRetention is how long a finished analysis job stays available for polling
+const analysisJobRetention = time.Hour
+
+// Analysis job statuses
+const (
+	jobRunning   = "running"
+	jobSaving    = "saving" // finished and being saved; too late to cancel
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// analysisJob is an analysis running in the background for POST /api/analyze/{symbol}?async=true
+type analysisJob struct {
+	id        string
+	profileID int64
+	symbol    string
+	createdAt time.Time
+	cancel    context.CancelFunc
+
+	mu         sync.Mutex
+	status     string
+	finishedAt time.Time
+	analysis   *models.AnalysisResponse
+	err        string
+	errCode    string
+}
+
+// analysisJobView is the JSON shape of a job
+type analysisJobView struct {
+	ID         string                   `json:"id"`
+	Symbol     string                   `json:"symbol"`
+	Status     string                   `json:"status"`
+	CreatedAt  time.Time                `json:"created_at"`
+	FinishedAt *time.Time               `json:"finished_at,omitempty"`
+	Analysis   *models.AnalysisResponse `json:"analysis,omitempty"`
+	Error      string                   `json:"error,omitempty"`
+	ErrorCode  string                   `json:"error_code,omitempty"` // machine-readable class of Error, e.g. "rate_limited"
+}
+
+// snapshot returns the job's current state
+func (j *analysisJob) snapshot() analysisJobView {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	view := analysisJobView{
+		ID:        j.id,
+		Symbol:    j.symbol,
+		Status:    j.status,
+		CreatedAt: j.createdAt,
+		Analysis:  j.analysis,
+		Error:     j.err,
+		ErrorCode: j.errCode,
+	}
+	if !j.finishedAt.IsZero() {
+		finishedAt := j.finishedAt
+		view.FinishedAt = &finishedAt
+	}
+	return view
+}
+
+// commit moves a running job on to saving its analysis, reporting false if it was
+// cancelled first
+func (j *analysisJob) commit() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != jobRunning {
+		return false
+	}
+	j.status = jobSaving
+	return true
+}
+
+// finish records the job's outcome, unless it was cancelled
+func (j *analysisJob) finish(analysis *models.AnalysisResponse, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status == jobCancelled {
+		return
+	}
+	j.finishedAt = time.Now().UTC()
+	switch {
+	case err != nil:
+		j.status, j.err = jobFailed, err.Error()
+		_, j.errCode = analysisErrorStatus(err)
+	default:
+		j.status, j.analysis = jobCompleted, analysis
+	}
+}
+
+// stop cancels a job that hasn't started saving, reporting whether it did
+func (j *analysisJob) stop() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != jobRunning {
+		return false
+	}
+	j.status, j.finishedAt = jobCancelled, time.Now().UTC()
+	j.cancel()
+	return true
+}
+
+// analysisJobs tracks background analyses by job ID
+type analysisJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*analysisJob
+}
+
+// newAnalysisJobs creates an empty job registry
+func newAnalysisJobs() *analysisJobs {
+	return &analysisJobs{jobs: make(map[string]*analysisJob)}
+}
+
+// start runs fn as a new job under a cancellable ctx and returns the job. fn must
+// call commit before saving anything and give up when it returns false.
+func (js *analysisJobs) start(ctx context.Context, profileID int64, symbol string, fn func(ctx context.Context, commit func() bool) (*models.AnalysisResponse, error)) *analysisJob {
+	ctx, cancel := context.WithCancel(ctx)
+	job := &analysisJob{
+		id:        newRequestID(),
+		profileID: profileID,
+		symbol:    symbol,
+		createdAt: time.Now().UTC(),
+		cancel:    cancel,
+		status:    jobRunning,
+	}
+
+	js.mu.Lock()
+	js.prune()
+	js.jobs[job.id] = job
+	js.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		job.finish(fn(ctx, job.commit))
+	}()
+	return job
+}
+
+// get returns a profile's job by ID
+func (js *analysisJobs) get(profileID int64, id string) (*analysisJob, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	job, ok := js.jobs[id]
+	if !ok || job.profileID != profileID {
+		return nil, false
+	}
+	return job, true
+}
+
+// prune drops jobs that finished more than analysisJobRetention ago. js.mu must be held.
+func (js *analysisJobs) prune() {
+	cutoff := time.Now().Add(-analysisJobRetention)
+	for id, job := range js.jobs {
+		job.mu.Lock()
+		expired := !job.finishedAt.IsZero() && job.finishedAt.Before(cutoff)
+		job.mu.Unlock()
+		if expired {
+			delete(js.jobs, id)
+		}
+	}
+}
+
+// handleAnalysisJob reports an analysis job's status and result (GET
+// /api/analyze/jobs/{id}) or cancels it (DELETE). A cancelled job is neither saved nor
+// notified; one that has already finished or started saving can't be cancelled.
+func (s *Server) handleAnalysisJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	job, ok := s.analysisJobs.get(profileID, strings.TrimPrefix(r.URL.Path, "/api/analyze/jobs/"))
+	if !ok {
+		respondError(w, http.StatusNotFound, "Analysis job not found")
+		return
+	}
+
+	if r.Method == http.MethodDelete && !job.stop() {
+		respondError(w, http.StatusConflict, "Analysis job is already "+job.snapshot().Status)
+		return
+	}
+	respondJSON(w, http.StatusOK, job.snapshot())
+}
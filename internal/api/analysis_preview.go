@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"stockmarket/internal/ai"
+	"stockmarket/internal/indicators"
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// handlePromptPreview builds the prompt an analysis of a symbol would send, from the
+// same market data and options as POST /api/analyze/{symbol}, and returns it with the
+// computed indicators (POST /api/analyze/{symbol}/preview). The AI provider is never
+// called, so an earnings call without a cached summary is left out of the prompt.
+func (s *Server) handlePromptPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	symbol, err := market.NormalizeSymbol(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/analyze/"), "/preview"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	input, err := decodeAnalyzeInput(r)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	symbol = market.ResolveSymbol(symbol, cfg.SymbolAliases)
+
+	provider, err := s.requestMarketProvider(cfg, input.MarketDataProvider)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), fmt.Errorf("Market provider error: %w", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.AnalyzeTimeout)
+	defer cancel()
+
+	quote, err := s.fetchQuote(ctx, provider, symbol)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, fmt.Errorf(FAILED_TO_GET_QUOTE+": %w", err))
+		return
+	}
+	s.applyYearRange(ctx, provider, quote)
+	applyExtendedHours(cfg, quote)
+
+	benchmark, err := s.analysisBenchmark(symbol, input.Benchmark)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	// Without an analyzer, transcript sentiment only uses an already cached summary
+	req, err := s.buildAnalysisRequest(ctx, cfg, provider, nil, symbol, quote, input, benchmark)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, fmt.Errorf(FAILED_TO_GET_HISTORICAL_DATA+": %w", err))
+		return
+	}
+	s.addComputedContext(&req)
+
+	preview := models.PromptPreview{
+		Symbol:     symbol,
+		Price:      quote.Price,
+		Template:   ai.PromptTemplateName(req.RiskProfile, req.TradeFrequency),
+		Prompt:     ai.BuildPrompt(req),
+		Indicators: req.Indicators,
+		Levels:     req.Levels,
+	}
+	if preview.Indicators == nil {
+		preview.Indicators = indicators.Latest(req.HistoricalData)
+	}
+	respondJSON(w, http.StatusOK, preview)
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPromptPreviewBody checks that the preview, like the analysis it previews, takes
+// an empty body and rejects a malformed one
+func TestPromptPreviewBody(t *testing.T) {
+	_, mux := newTestServer(t)
+	for _, tc := range []struct {
+		body   string
+		status int
+	}{
+		{"", 200},
+		{`{"detail_level": "brief"}`, 200},
+		{`{"detail_level": `, 400},
+		{`{"detail_level": "verbose"}`, 400},
+	} {
+		rec := serve(mux, httptest.NewRequest("POST", "/api/analyze/AAPL/preview", strings.NewReader(tc.body)))
+		if rec.Code != tc.status {
+			t.Errorf("body %q: status %d, want %d: %s", tc.body, rec.Code, tc.status, rec.Body)
+		}
+		if tc.body == `{"detail_level": ` && !strings.Contains(rec.Body.String(), INVALID_JSON) {
+			t.Errorf("malformed body: %s, want %q", rec.Body, INVALID_JSON)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"stockmarket/internal/ai"
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// streamChunkBuffer is how many reply chunks may queue while the client catches up
+const streamChunkBuffer = 64
+
+// streamingAnalyzer streams every analysis attempt to chunks, so guardrail and retry
+// handling in runAnalysis apply to streamed analyses too. Each attempt after the first
+// is announced with an empty chunk; providers never send empty ones.
+type streamingAnalyzer struct {
+	ai.Analyzer
+	chunks   chan<- string
+	attempts int
+}
+
+// Analyze runs one streamed analysis attempt
+func (a *streamingAnalyzer) Analyze(ctx context.Context, req models.AnalysisRequest) (*models.AnalysisResponse, error) {
+	a.attempts++
+	if a.attempts > 1 {
+		select {
+		case a.chunks <- "":
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return ai.AnalyzeStream(ctx, a.Analyzer, req, a.chunks)
+}
+
+// handleAnalyzeStream runs an analysis and streams the AI reply as server-sent events
+// (GET /api/analyze/{symbol}/stream). Each "token" event carries a JSON string of reply
+// text, "retry" marks a retried attempt whose text replaces what came before, and the
+// stream ends with a "result" event holding the analysis or an "error" event. Query
+// parameters mirror the POST body of /api/analyze/{symbol}.
+func (s *Server) handleAnalyzeStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	symbol, err := market.NormalizeSymbol(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/analyze/"), "/stream"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	query := r.URL.Query()
+	detailLevel := strings.ToLower(strings.TrimSpace(query.Get("detail_level")))
+	if !ai.ValidDetailLevel(detailLevel) {
+		respondError(w, http.StatusBadRequest, INVALID_DETAIL_LEVEL)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	symbol = market.ResolveSymbol(symbol, cfg.SymbolAliases)
+	benchmark, err := s.analysisBenchmark(symbol, query.Get("benchmark"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	provider, err := s.requestMarketProvider(cfg, query.Get("market_data_provider"))
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), fmt.Errorf("Market provider error: %w", err))
+		return
+	}
+
+	dryRun := query.Get("dry_run") == "true"
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.AnalyzeTimeout)
+	defer cancel()
+	if dryRun {
+		ctx = ai.WithoutUsage(ctx)
+	}
+
+	quote, err := s.fetchQuote(ctx, provider, symbol)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, fmt.Errorf(FAILED_TO_GET_QUOTE+": %w", err))
+		return
+	}
+	s.applyYearRange(ctx, provider, quote)
+	applyExtendedHours(cfg, quote)
+
+	historical, comparison, err := s.historyWithBenchmark(ctx, provider, symbol, "1m", benchmark)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, fmt.Errorf(FAILED_TO_GET_HISTORICAL_DATA+": %w", err))
+		return
+	}
+
+	aiProvider, aiModel := query.Get("ai_provider"), query.Get("ai_model")
+	if aiProvider == "" && aiModel == "" {
+		aiProvider, aiModel = s.ruleModel(symbol, cfg.TradeFrequency)
+	}
+	analyzer, err := s.requestAnalyzer(cfg, aiProvider, aiModel)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), fmt.Errorf(FAILED_TO_GET_ANALYZE+": %w", err))
+		return
+	}
+
+	analysisReq := models.AnalysisRequest{
+		Symbol:         symbol,
+		CurrentPrice:   quote.Price,
+		HistoricalData: historical,
+		RiskProfile:    cfg.RiskTolerance,
+		TradeFrequency: cfg.TradeFrequency,
+		UserContext:    query.Get("user_context"),
+		DetailLevel:    detailLevel,
+
+		FiftyTwoWeekHigh: quote.FiftyTwoWeekHigh,
+		FiftyTwoWeekLow:  quote.FiftyTwoWeekLow,
+		Quote:            quote,
+		Benchmark:        comparison,
+	}
+	s.addPromptContext(ctx, provider, analyzer, &analysisReq, query.Get("include_transcript") == "true")
+
+	w.Header().Set(HEADER_CONTENT_TYPE, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep reverse proxies from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	type outcome struct {
+		analysis *models.AnalysisResponse
+		err      error
+	}
+	chunks := make(chan string, streamChunkBuffer)
+	done := make(chan outcome, 1)
+	go func() {
+		analysis, err := s.runAnalysis(ctx, &streamingAnalyzer{Analyzer: analyzer, chunks: chunks}, analysisReq)
+		done <- outcome{analysis, err}
+	}()
+
+	// writeChunk sends one reply chunk, or a retry marker for an empty one
+	writeChunk := func(chunk string) {
+		if chunk == "" {
+			writeSSE(w, flusher, "retry", map[string]string{})
+			return
+		}
+		writeSSE(w, flusher, "token", chunk)
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			// The client went away; the deferred cancel stops the analysis
+			return
+		case chunk := <-chunks:
+			writeChunk(chunk)
+		case out := <-done:
+			// Everything queued was sent before the analysis finished
+			for len(chunks) > 0 {
+				writeChunk(<-chunks)
+			}
+			if out.err != nil {
+				_, code := analysisErrorStatus(out.err)
+				writeSSE(w, flusher, "error", errorResponse{Error: FAILED_TO_GET_ANALYZE + ": " + out.err.Error(), Code: code})
+				return
+			}
+
+			analysis := out.analysis
+			analysis.Tags = normalizeTags(query["tag"])
+			if dryRun {
+				analysis.DryRun = true
+			} else {
+				s.saveAnalysis(ctx, analysis, cfg)
+				s.forwardAnalysis(analysis)
+				s.notifySignal(ctx, analysis, cfg)
+			}
+			writeSSE(w, flusher, "result", analysis)
+			return
+		}
+	}
+}
+
+// writeSSE writes one server-sent event with JSON data and flushes it to the client
+func writeSSE(w http.ResponseWriter, flusher http.Flusher, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		payload, _ = json.Marshal(map[string]string{"error": err.Error()})
+		event = "error"
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	flusher.Flush()
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// handleAnalysisTimeline returns the action, confidence and price of a symbol's stored
+// analyses, oldest first (GET /api/analyses/{symbol}/timeline). ?max_points=N thins the
+// series to at most N evenly spaced points, always keeping the first and last.
+func (s *Server) handleAnalysisTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	symbol, err := market.NormalizeSymbol(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/analyses/"), "/timeline"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	maxPoints := 0
+	if v := r.URL.Query().Get("max_points"); v != "" {
+		if maxPoints, err = strconv.Atoi(v); err != nil || maxPoints < 2 {
+			respondError(w, http.StatusBadRequest, "max_points must be a whole number of at least 2")
+			return
+		}
+	}
+
+	points, err := s.db.GetAnalysisTimeline(symbol)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"symbol": symbol,
+		"total":  len(points),
+		"points": downsampleTimeline(points, maxPoints),
+	})
+}
+
+// downsampleTimeline picks at most maxPoints evenly spaced points, keeping the first and
+// last; maxPoints below 2 leaves the series as it is
+func downsampleTimeline(points []models.TimelinePoint, maxPoints int) []models.TimelinePoint {
+	if maxPoints < 2 || len(points) <= maxPoints {
+		return points
+	}
+	sampled := make([]models.TimelinePoint, 0, maxPoints)
+	last := len(points) - 1
+	for i := range maxPoints {
+		sampled = append(sampled, points[i*last/(maxPoints-1)])
+	}
+	return sampled
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RequireAPIKey rejects /api requests that don't carry the configured API key, in an
+// "Authorization: Bearer" or X-API-Key header. The WebSocket endpoint also accepts it
+// as an api_key query parameter, since browsers can't set headers on the upgrade.
+// /api/health stays open for uptime checks, and without a configured key every
+// request passes.
+func (s *Server) RequireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.APIKey == "" || !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.Header.Get("X-API-Key")
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			key = strings.TrimSpace(token)
+		}
+		if key == "" && r.URL.Path == "/api/ws" {
+			key = r.URL.Query().Get("api_key")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.config.APIKey)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			respondError(w, http.StatusUnauthorized, "Missing or invalid API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// StartAutoAnalysisScheduler analyzes every profile's tracked symbols on the configured
+// schedule, when one is set, by queueing analysis jobs the job workers run. Symbols still
+// waiting from the last run when the next is due aren't queued again.
+func (s *Server) StartAutoAnalysisScheduler(ctx context.Context) {
+	if s.config.AutoAnalysisInterval <= 0 && len(s.config.AutoAnalysisTimes) == 0 {
+		return
+	}
+
+	go func() {
+		for {
+			next := s.nextAutoAnalysisTime(time.Now().In(s.config.Location))
+			slog.Info("next auto-analysis scheduled", "at", next.Format(time.RFC3339))
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				s.runAutoAnalysis()
+			}
+		}
+	}()
+}
+
+// nextAutoAnalysisTime returns when the next scheduled run is due after now
+func (s *Server) nextAutoAnalysisTime(now time.Time) time.Time {
+	if s.config.AutoAnalysisInterval > 0 {
+		return now.Add(s.config.AutoAnalysisInterval)
+	}
+	var next time.Time
+	for _, clock := range s.config.AutoAnalysisTimes {
+		if t := nextDigestTime(now, clock); next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	return next
+}
+
+// runAutoAnalysis queues an analysis job for each profile's tracked symbols, run with
+// its saved providers, saving the analyses and notifying on high-confidence signals.
+// With AUTO_ANALYSIS_GROUPS set only the symbols in those watchlist groups are analyzed.
+// While the market is closed only crypto pairs, which trade around the clock, are
+// analyzed. A symbol whose last scheduled analysis is still waiting isn't queued twice.
+func (s *Server) runAutoAnalysis() {
+	marketOpen := market.IsMarketOpen(time.Now(), market.DefaultExchange)
+	if !marketOpen {
+		slog.Info("auto-analysis: market closed, analyzing crypto pairs only")
+	}
+
+	profiles, err := s.db.ListProfiles()
+	if err != nil {
+		slog.Error("auto-analysis: failed to list profiles", "error", err)
+		return
+	}
+
+	queued := 0
+	for _, profile := range profiles {
+		cfg, err := s.db.GetProfileConfig(profile.ID)
+		if err != nil {
+			slog.Error("auto-analysis: "+FAILED_TO_GET_CONFIG, "profile_id", profile.ID, "error", err)
+			continue
+		}
+		symbols := s.autoAnalysisSymbols(cfg)
+		if !marketOpen {
+			symbols = slices.DeleteFunc(slices.Clone(symbols), func(symbol string) bool { return !market.IsCrypto(symbol) })
+		}
+		queued += len(s.enqueueAnalyses(cfg.ID, symbols))
+	}
+	slog.Info("auto-analysis queued", "jobs", queued)
+}
+
+// autoAnalysisSymbols returns the symbols a scheduled run analyzes for a profile: those
+// in the watchlist groups named by AUTO_ANALYSIS_GROUPS, or its whole watchlist
+func (s *Server) autoAnalysisSymbols(cfg *models.UserConfig) []string {
+	if len(s.config.AutoAnalysisGroups) == 0 {
+		return cfg.TrackedSymbols
+	}
+	var symbols []string
+	for _, section := range watchlistSections(cfg) {
+		if slices.ContainsFunc(s.config.AutoAnalysisGroups, func(name string) bool { return strings.EqualFold(name, section.Name) }) {
+			symbols = append(symbols, section.Symbols...)
+		}
+	}
+	return symbols
+}
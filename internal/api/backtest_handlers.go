@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"stockmarket/internal/backtest"
+	"stockmarket/internal/db"
+	"stockmarket/internal/market"
+)
+
+// Backtest defaults and limits
+const (
+	defaultBacktestCash   = 10000.0
+	defaultBacktestPeriod = "1y"
+	maxBacktestAnalyses   = 1000
+	backtestFastSMA       = 20
+	backtestSlowSMA       = 50
+)
+
+// Signal sources a backtest can replay
+const (
+	BacktestSourceAnalyses = "analyses"  // stored analyses' BUY/SELL actions
+	BacktestSourceSMACross = "sma_cross" // 20/50-day SMA crossovers
+)
+
+// backtestRequest is the optional body of POST /api/backtest/{symbol}
+type backtestRequest struct {
+	Source       string  `json:"source"`
+	Period       string  `json:"period"`
+	StartingCash float64 `json:"starting_cash"`
+	AllowShort   bool    `json:"allow_short"`
+}
+
+// handleBacktest replays signals for a symbol over its price history: either the
+// stored analyses' actions or a moving-average crossover rule
+func (s *Server) handleBacktest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	symbol, err := market.NormalizeSymbol(strings.TrimPrefix(r.URL.Path, "/api/backtest/"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	symbol = market.ResolveSymbol(symbol, cfg.SymbolAliases)
+
+	req := backtestRequest{Source: BacktestSourceAnalyses, Period: defaultBacktestPeriod, StartingCash: defaultBacktestCash}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, INVALID_JSON)
+		return
+	}
+	if req.Source != BacktestSourceAnalyses && req.Source != BacktestSourceSMACross {
+		respondError(w, http.StatusBadRequest, "source must be analyses or sma_cross")
+		return
+	}
+	if req.StartingCash <= 0 {
+		respondError(w, http.StatusBadRequest, "starting_cash must be positive")
+		return
+	}
+
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	candles, err := market.AdjustedHistory(ctx, provider, symbol, req.Period, "")
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	priced := 0
+	for _, c := range candles {
+		if c.Close > 0 {
+			priced++
+		}
+	}
+	if priced < backtest.MinCandles {
+		respondError(w, http.StatusUnprocessableEntity, fmt.Sprintf("Not enough price history for %s over %s", symbol, req.Period))
+		return
+	}
+
+	var signals []backtest.Signal
+	switch req.Source {
+	case BacktestSourceAnalyses:
+		analyses, err := s.db.FilterAnalyses(db.AnalysisFilter{Symbol: symbol, Limit: maxBacktestAnalyses})
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		for _, a := range analyses {
+			signals = append(signals, backtest.Signal{Time: a.GeneratedAt, Action: a.Action})
+		}
+	case BacktestSourceSMACross:
+		signals = backtest.SMACrossSignals(candles, backtestFastSMA, backtestSlowSMA)
+	}
+
+	result := backtest.RunWithOptions(candles, signals, req.StartingCash, backtest.Options{AllowShort: req.AllowShort})
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"symbol":  symbol,
+		"source":  req.Source,
+		"period":  req.Period,
+		"signals": len(signals),
+		"result":  result,
+	})
+}
@@ -0,0 +1,355 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"stockmarket/internal/config"
+	"stockmarket/internal/db"
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// maxBackupSize bounds an imported backup document
+const maxBackupSize = 10 << 20
+
+// handleExportBackup downloads the request profile's settings, active alerts and
+// notification channels as one JSON document (GET /api/export). API keys and Telegram
+// bot tokens are exported as the encrypted blobs stored at rest; ?redact=true leaves
+// them, webhook headers and the URLs of webhook-style channels out.
+func (s *Server) handleExportBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	redact, err := boolQuery(r, "redact")
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	alerts, err := s.db.GetActiveAlerts(cfg.ID)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	backup := models.ConfigBackup{
+		SchemaVersion:        models.ConfigBackupVersion,
+		ExportedAt:           time.Now().UTC(),
+		SecretsRedacted:      redact,
+		Config:               *cfg,
+		Alerts:               alerts,
+		NotificationChannels: cfg.NotificationChannels,
+	}
+	backup.Config.NotificationChannels = nil
+	if backup.Alerts == nil {
+		backup.Alerts = []models.PriceAlert{}
+	}
+	if backup.NotificationChannels == nil {
+		backup.NotificationChannels = []models.NotificationConfig{}
+	}
+	if redact {
+		backup.Config.MarketDataAPIKey, backup.Config.AIProviderAPIKey = "", ""
+		for i, ch := range backup.NotificationChannels {
+			if secretTarget(ch.Type) {
+				backup.NotificationChannels[i].Target = ""
+			}
+			if ch.Webhook != nil && len(ch.Webhook.Headers) > 0 {
+				webhook := *ch.Webhook
+				webhook.Headers = nil
+				backup.NotificationChannels[i].Webhook = &webhook
+			}
+			if ch.Telegram != nil {
+				backup.NotificationChannels[i].Telegram = &models.TelegramConfig{}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="stockai-backup-%s.json"`, time.Now().Format("20060102")))
+	respondJSON(w, http.StatusOK, backup)
+}
+
+// handleImportBackup restores a document from GET /api/export into the request profile
+// (POST /api/import) in one transaction. By default the profile's settings, alerts and
+// notification channels are replaced; with ?merge=true tracked symbols and aliases are
+// merged and alerts and channels are added, skipping ones the profile already has.
+// Settings the backup leaves empty, such as redacted API keys, keep their current value,
+// and channels whose redacted URL can't be restored are skipped.
+func (s *Server) handleImportBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	merge, err := boolQuery(r, "merge")
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBackupSize)).Decode(&raw); err != nil {
+		respondError(w, http.StatusBadRequest, INVALID_JSON)
+		return
+	}
+	var backup models.ConfigBackup
+	var fields struct {
+		Config map[string]json.RawMessage `json:"config"`
+	}
+	if json.Unmarshal(raw, &backup) != nil || json.Unmarshal(raw, &fields) != nil {
+		respondError(w, http.StatusBadRequest, INVALID_JSON)
+		return
+	}
+	if backup.SchemaVersion != models.ConfigBackupVersion {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported schema_version %d (expected %d)", backup.SchemaVersion, models.ConfigBackupVersion))
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	// Backups from before per-profile confidence thresholds keep the current one
+	if _, ok := fields.Config["notify_min_confidence"]; !ok {
+		backup.Config.NotifyMinConfidence = cfg.NotifyMinConfidence
+	}
+	if err := s.applyBackupConfig(cfg, backup.Config, merge); err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var existingAlerts []models.PriceAlert
+	if merge {
+		if existingAlerts, err = s.db.GetActiveAlerts(cfg.ID); err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	alerts := make([]models.PriceAlert, 0, len(backup.Alerts))
+	for i, alert := range backup.Alerts {
+		if alert, err = backupAlert(alert); err != nil {
+			respondErr(w, http.StatusBadRequest, fmt.Errorf("alerts[%d]: %w", i, err))
+			return
+		}
+		if !slices.ContainsFunc(existingAlerts, func(a models.PriceAlert) bool { return sameAlert(a, alert) }) {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	channels := make([]models.NotificationConfig, 0, len(backup.NotificationChannels))
+	skipped := 0
+	for i, ch := range backup.NotificationChannels {
+		if ch.Target == "" && secretTarget(ch.Type) && backup.SecretsRedacted {
+			skipped++
+			continue
+		}
+		// A redacted Telegram channel keeps the bot token of the profile's matching channel
+		if ch.Type == "telegram" && (ch.Telegram == nil || ch.Telegram.BotToken == "") {
+			ch.Telegram = existingTelegram(cfg.NotificationChannels, ch.Target)
+		}
+		if ch.Type == "" || ch.Target == "" {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("notification_channels[%d]: Type and target required", i))
+			return
+		}
+		if msg := channelError(s.notifyService, ch); msg != "" {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("notification_channels[%d]: %s", i, msg))
+			return
+		}
+		if ch.Telegram != nil && !db.PlaintextBotToken(ch.Telegram.BotToken) {
+			if _, err := config.Decrypt(ch.Telegram.BotToken, s.config.DecryptionKeys()...); err != nil {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("notification_channels[%d]: bot token was encrypted with a different ENCRYPTION_KEY; export with ?redact=true and re-enter it", i))
+				return
+			}
+		}
+		if err := s.sealChannel(&ch); err != nil {
+			respondError(w, http.StatusInternalServerError, FAILED_TO_ENCRYPT_API_KEY)
+			return
+		}
+		duplicate := slices.ContainsFunc(cfg.NotificationChannels, func(existing models.NotificationConfig) bool {
+			return existing.Type == ch.Type && existing.Target == ch.Target
+		})
+		if !merge || !duplicate {
+			channels = append(channels, ch)
+		}
+	}
+
+	if err := s.db.ImportBackup(cfg, alerts, channels, !merge); err != nil {
+		if errors.Is(err, db.ErrConfigConflict) {
+			respondError(w, http.StatusConflict, CONFIG_CONFLICT)
+			return
+		}
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":                "imported",
+		"merge":                 merge,
+		"alerts":                len(alerts),
+		"notification_channels": len(channels),
+		"skipped_channels":      skipped,
+		"version":               cfg.Version,
+	})
+}
+
+// applyBackupConfig copies an imported profile's settings onto cfg, validating them the
+// way PUT /api/config does. API keys must decrypt with one of this server's encryption keys.
+func (s *Server) applyBackupConfig(cfg *models.UserConfig, imported models.UserConfig, merge bool) error {
+	for _, key := range []struct{ name, value string }{
+		{"market_data_api_key", imported.MarketDataAPIKey},
+		{"ai_provider_api_key", imported.AIProviderAPIKey},
+	} {
+		if key.value == "" {
+			continue
+		}
+		if _, err := config.Decrypt(key.value, s.config.DecryptionKeys()...); err != nil {
+			return errors.New(key.name + " was encrypted with a different ENCRYPTION_KEY; export with ?redact=true and re-enter the key")
+		}
+	}
+
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&cfg.MarketDataProvider, imported.MarketDataProvider},
+		{&cfg.MarketDataAPIKey, imported.MarketDataAPIKey},
+		{&cfg.MarketDataFallback, imported.MarketDataFallback},
+		{&cfg.AIProvider, imported.AIProvider},
+		{&cfg.AIProviderAPIKey, imported.AIProviderAPIKey},
+		{&cfg.AIModel, imported.AIModel},
+		{&cfg.RiskTolerance, imported.RiskTolerance},
+		{&cfg.TradeFrequency, imported.TradeFrequency},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	if imported.PollingInterval > 0 {
+		cfg.PollingInterval = imported.PollingInterval
+	}
+	if err := validateConfigChoices(cfg); err != nil {
+		return err
+	}
+
+	if imported.NotifyMinConfidence < 0 || imported.NotifyMinConfidence > 1 {
+		return errors.New("notify_min_confidence must be between 0 and 1")
+	}
+	cfg.NotifyMinConfidence = imported.NotifyMinConfidence
+	cfg.NotifyOnHold = imported.NotifyOnHold
+	cfg.IncludeExtendedHours = imported.IncludeExtendedHours
+	if imported.NotifyOnActions != nil {
+		actions, err := normalizeActions(imported.NotifyOnActions)
+		if err != nil {
+			return errors.New("notify_on_actions: " + err.Error())
+		}
+		cfg.NotifyOnActions = actions
+	}
+
+	symbols, err := normalizeSymbols(imported.TrackedSymbols)
+	if err != nil {
+		return errors.New("tracked_symbols: " + err.Error())
+	}
+	aliases, err := normalizeAliases(imported.SymbolAliases)
+	if err != nil {
+		return errors.New("symbol_aliases: " + err.Error())
+	}
+	groups, err := normalizeWatchlistGroups(imported.WatchlistGroups)
+	if err != nil {
+		return errors.New("watchlist_groups: " + err.Error())
+	}
+	if !merge {
+		cfg.TrackedSymbols, cfg.SymbolAliases, cfg.WatchlistGroups = symbols, aliases, groups
+		pruneWatchlistGroups(cfg)
+		return nil
+	}
+	for _, symbol := range symbols {
+		if !slices.Contains(cfg.TrackedSymbols, symbol) {
+			cfg.TrackedSymbols = append(cfg.TrackedSymbols, symbol)
+		}
+	}
+	// Imported groups take in the symbols they list, creating groups that don't exist
+	for _, group := range groups {
+		index := watchlistGroupIndex(cfg, group.Name)
+		if index < 0 {
+			cfg.WatchlistGroups = append(cfg.WatchlistGroups, models.WatchlistGroup{Name: group.Name})
+			index = len(cfg.WatchlistGroups) - 1
+		}
+		members := slices.Clone(cfg.WatchlistGroups[index].Symbols)
+		for _, symbol := range group.Symbols {
+			if slices.Contains(symbols, symbol) && !slices.Contains(members, symbol) {
+				members = append(members, symbol)
+			}
+		}
+		assignWatchlistGroup(cfg, index, members)
+	}
+	if cfg.SymbolAliases == nil {
+		cfg.SymbolAliases = make(map[string]string, len(aliases))
+	}
+	for alias, symbol := range aliases {
+		cfg.SymbolAliases[alias] = symbol
+	}
+	return nil
+}
+
+// backupAlert validates an imported alert the way POST /api/alerts does
+func backupAlert(alert models.PriceAlert) (models.PriceAlert, error) {
+	symbol, err := market.NormalizeSymbol(alert.Symbol)
+	if err != nil {
+		return alert, err
+	}
+	alert.Symbol = symbol
+	alert.Recurring = alert.Recurring || alert.CooldownSeconds > 0 || alert.Rearm
+	needsPrice, ok := alertConditions[alert.Condition]
+	if !ok {
+		return alert, errors.New("unknown condition " + strconv.Quote(alert.Condition))
+	}
+	if needsPrice && alert.Price <= 0 {
+		return alert, errors.New("price required for " + alert.Condition)
+	}
+	if msg := alertParamsError(alert); msg != "" {
+		return alert, errors.New(msg)
+	}
+	return alert, nil
+}
+
+// secretTarget reports whether a channel type's target is a webhook URL, which works as
+// a credential
+func secretTarget(channelType string) bool {
+	return channelType == "webhook" || channelType == "discord" || channelType == "slack"
+}
+
+// existingTelegram returns the bot settings of a profile's telegram channel for a chat, if any
+func existingTelegram(channels []models.NotificationConfig, chatID string) *models.TelegramConfig {
+	for _, ch := range channels {
+		if ch.Type == "telegram" && ch.Target == chatID && ch.Telegram != nil {
+			return ch.Telegram
+		}
+	}
+	return nil
+}
+
+// boolQuery parses an optional boolean query parameter, false when it's absent
+func boolQuery(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New(name + " must be true or false")
+	}
+	return b, nil
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"stockmarket/internal/models"
+)
+
+// TestExportRedactsChannelURLs checks that a redacted export leaves webhook-style
+// channel URLs out, and that importing it skips those channels instead of failing
+func TestExportRedactsChannelURLs(t *testing.T) {
+	s, mux := newTestServer(t)
+	cfg := testConfig(t, s)
+	for _, ch := range []models.NotificationConfig{
+		{Type: "discord", Target: "https://discord.com/api/webhooks/1/hooktoken", Enabled: true, Events: []string{"buy_signal"}},
+		{Type: "email", Target: "me@example.com", Enabled: true, Events: []string{"buy_signal"}},
+	} {
+		if err := s.db.SaveNotificationChannel(cfg.ID, &ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := serve(mux, httptest.NewRequest(http.MethodGet, "/api/export?redact=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: status %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "hooktoken") {
+		t.Errorf("redacted export leaks the webhook URL: %s", rec.Body)
+	}
+	var backup models.ConfigBackup
+	if err := json.Unmarshal(rec.Body.Bytes(), &backup); err != nil {
+		t.Fatal(err)
+	}
+	targets := map[string]string{}
+	for _, ch := range backup.NotificationChannels {
+		targets[ch.Type] = ch.Target
+	}
+	if targets["discord"] != "" || targets["email"] != "me@example.com" {
+		t.Errorf("exported targets = %v, want only the discord URL left out", targets)
+	}
+
+	rec = serve(mux, httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(rec.Body.String())))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import: status %d: %s", rec.Code, rec.Body)
+	}
+	var result struct {
+		Channels int `json:"notification_channels"`
+		Skipped  int `json:"skipped_channels"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Channels != 1 || result.Skipped != 1 {
+		t.Errorf("import = %+v, want the email channel imported and the discord one skipped", result)
+	}
+}
+
+// TestImportKeepsMinConfidence checks that a backup without notify_min_confidence,
+// from before the setting existed, keeps the profile's threshold
+func TestImportKeepsMinConfidence(t *testing.T) {
+	s, mux := newTestServer(t)
+	cfg := testConfig(t, s)
+	cfg.NotifyMinConfidence = 0.55
+	if err := s.db.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		config string
+		want   float64
+	}{
+		{"missing", `{"tracked_symbols":["AAPL"]}`, 0.55},
+		{"set", `{"tracked_symbols":["AAPL"],"notify_min_confidence":0}`, 0},
+	} {
+		body := `{"schema_version":1,"config":` + tc.config + `,"alerts":[],"notification_channels":[]}`
+		if rec := serve(mux, httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(body))); rec.Code != http.StatusOK {
+			t.Fatalf("%s: import status %d: %s", tc.name, rec.Code, rec.Body)
+		}
+		if got := testConfig(t, s).NotifyMinConfidence; got != tc.want {
+			t.Errorf("%s: notify_min_confidence = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	zlibWriters = sync.Pool{New: func() any { return zlib.NewWriter(io.Discard) }}
+)
+
+// resettableWriter is a compressor that can be reused for another response
+type resettableWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Compress gzip- or deflate-compresses JSON responses of at least COMPRESS_MIN_BYTES
+// for clients that accept it. Other content types, such as server-sent events,
+// streamed exports, pages and static assets, pass through untouched, as do WebSocket
+// upgrades and responses that already carry a Content-Encoding.
+func (s *Server) Compress(next http.Handler) http.Handler {
+	if !s.config.CompressResponses {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       acceptedEncoding(r.Header.Get("Accept-Encoding")),
+			minSize:        s.config.CompressMinBytes,
+		}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptedEncoding picks gzip, then deflate, from an Accept-Encoding header, or ""
+// when the client accepts neither
+func acceptedEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[coding] = q > 0
+	}
+	for _, coding := range []string{"gzip", "deflate"} {
+		if ok, listed := accepted[coding]; ok || !listed && accepted["*"] {
+			return coding
+		}
+	}
+	return ""
+}
+
+// compressWriter holds back a response's first minSize bytes to decide whether it is
+// worth compressing, then either compresses or passes it through
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string // "gzip", "deflate" or "" when the client accepts neither
+	minSize  int
+
+	status     int
+	buf        []byte
+	decided    bool
+	compressor resettableWriter
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status == 0 && !w.decided {
+		w.status = status
+	}
+	if w.decided {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize {
+			return len(b), nil
+		}
+		w.decide()
+		if err := w.writeBuffered(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.compressor != nil {
+		return w.compressor.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide sends the headers, compressing when the response is JSON the client can
+// decode and what's buffered reached minSize
+func (w *compressWriter) decide() {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	h := w.Header()
+	mediaType, _, _ := mime.ParseMediaType(h.Get(HEADER_CONTENT_TYPE))
+	if mediaType == CONTENT_TYPE_JSON && h.Get("Content-Encoding") == "" {
+		h.Add("Vary", "Accept-Encoding")
+		if w.encoding != "" && len(w.buf) >= w.minSize && bodyAllowed(w.status) {
+			h.Set("Content-Encoding", w.encoding)
+			h.Del("Content-Length")
+			w.compressor = newCompressor(w.encoding, w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// writeBuffered sends what was held back while deciding
+func (w *compressWriter) writeBuffered() error {
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.compressor != nil {
+		_, err = w.compressor.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close sends a response too small to decide on and finishes any compressed stream
+func (w *compressWriter) close() {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			return // nothing written; net/http sends its default 200
+		}
+		w.decide()
+		w.writeBuffered()
+	}
+	if w.compressor != nil {
+		w.compressor.Close()
+		releaseCompressor(w.encoding, w.compressor)
+		w.compressor = nil
+	}
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide()
+		w.writeBuffered()
+	}
+	if w.compressor != nil {
+		w.compressor.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	w.decided = true // the connection is the handler's now
+	return h.Hijack()
+}
+
+// bodyAllowed reports whether a response with status carries a body
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// newCompressor takes a pooled compressor for encoding writing to w
+func newCompressor(encoding string, w io.Writer) resettableWriter {
+	var c resettableWriter
+	if encoding == "gzip" {
+		c = gzipWriters.Get().(*gzip.Writer)
+	} else {
+		c = zlibWriters.Get().(*zlib.Writer)
+	}
+	c.Reset(w)
+	return c
+}
+
+// releaseCompressor returns a closed compressor to its pool
+func releaseCompressor(encoding string, c resettableWriter) {
+	c.Reset(io.Discard)
+	if encoding == "gzip" {
+		gzipWriters.Put(c)
+	} else {
+		zlibWriters.Put(c)
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"stockmarket/internal/models"
+)
+
+// TestCompressHistoricalRoundTrip checks that historical candles come back compressed
+// for clients that accept it and decode to the same series as uncompressed ones
+func TestCompressHistoricalRoundTrip(t *testing.T) {
+	s, mux := newTestServer(t)
+	s.config.CompressResponses, s.config.CompressMinBytes = true, 256
+	handler := s.Compress(mux)
+
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/historical/AAPL?period=1y", nil)
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := serve(handler, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Accept-Encoding %q: status %d: %s", acceptEncoding, rec.Code, rec.Body)
+		}
+		return rec
+	}
+	decode := func(body io.Reader) []models.Candle {
+		var candles []models.Candle
+		if err := json.NewDecoder(body).Decode(&candles); err != nil {
+			t.Fatal(err)
+		}
+		return candles
+	}
+
+	plain := get("")
+	if enc := plain.Header().Get("Content-Encoding"); enc != "" {
+		t.Fatalf("uncompressed request got Content-Encoding %q", enc)
+	}
+	want := decode(plain.Body)
+	if len(want) == 0 {
+		t.Fatal("no candles")
+	}
+
+	for _, tc := range []struct {
+		accept, encoding string
+		reader           func(io.Reader) (io.Reader, error)
+	}{
+		{"gzip, deflate", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"deflate", "deflate", func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+	} {
+		rec := get(tc.accept)
+		if enc := rec.Header().Get("Content-Encoding"); enc != tc.encoding {
+			t.Fatalf("Accept-Encoding %q: Content-Encoding %q, want %s", tc.accept, enc, tc.encoding)
+		}
+		if vary := strings.Join(rec.Header().Values("Vary"), ", "); !strings.Contains(vary, "Accept-Encoding") {
+			t.Errorf("Accept-Encoding %q: Vary %v lacks Accept-Encoding", tc.accept, vary)
+		}
+		body, err := tc.reader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decode(body); len(got) != len(want) || !got[0].Timestamp.Equal(want[0].Timestamp) {
+			t.Errorf("Accept-Encoding %q: decoded %d candles, want the %d served uncompressed", tc.accept, len(got), len(want))
+		}
+	}
+}
@@ -1,17 +1,53 @@
 package api
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
 	"stockmarket/internal/config"
+	"stockmarket/internal/db"
+	"stockmarket/internal/market"
 	"stockmarket/internal/models"
 	"stockmarket/internal/web/pages"
 )
 
+// configUpdateError reports a failed config update, distinguishing lost-update conflicts
+func configUpdateError(w http.ResponseWriter, err error) {
+	if errors.Is(err, db.ErrConfigConflict) {
+		http.Error(w, CONFIG_CONFLICT, http.StatusConflict)
+		return
+	}
+	http.Error(w, FAILED_TO_UPDATE_CONFIG, http.StatusInternalServerError)
+}
+
+// formConfigVersion applies the config version a settings form was rendered from, so
+// saving it over a change made since fails with db.ErrConfigConflict. A form without
+// one saves over the current config.
+func formConfigVersion(r *http.Request, cfg *models.UserConfig) error {
+	v := r.FormValue("version")
+	if v == "" {
+		return nil
+	}
+	version, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || version < 1 {
+		return errors.New("version must be a positive integer")
+	}
+	cfg.Version = version
+	return nil
+}
+
+// renderConfigVersion sends the saved config's version out-of-band, for the settings
+// page's next save
+func renderConfigVersion(w http.ResponseWriter, r *http.Request, cfg *models.UserConfig) {
+	w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_HTML)
+	pages.ConfigVersion(cfg.Version, true).Render(r.Context(), w)
+}
+
 // handleConfigMarket handles market data provider configuration updates
 func (s *Server) handleConfigMarket(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -26,14 +62,33 @@ func (s *Server) handleConfigMarket(w http.ResponseWriter, r *http.Request) {
 
 	provider := r.FormValue("market_data_provider")
 	apiKey := r.FormValue("market_data_api_key")
+	fallback := r.FormValue("market_data_provider_fallback")
+
+	if fallback != "" && (fallback == provider || !slices.Contains(market.Providers, fallback)) {
+		http.Error(w, "Fallback provider must be a different known provider", http.StatusBadRequest)
+		return
+	}
+	if fallback != "" && market.RequiresAPIKey(fallback) && s.config.ProviderAPIKeys[fallback] == "" {
+		http.Error(w, fmt.Sprintf("Fallback provider %s needs a server API key", fallback), http.StatusBadRequest)
+		return
+	}
 
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
 		http.Error(w, FAILED_TO_GET_CONFIG, http.StatusInternalServerError)
 		return
 	}
+	if err := formConfigVersion(r, cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	cfg.MarketDataProvider = provider
+	cfg.MarketDataFallback = fallback
+	if err := validateConfigChoices(cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Only update API key if a new one is provided
 	if apiKey != "" {
@@ -46,11 +101,11 @@ func (s *Server) handleConfigMarket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := s.db.UpdateConfig(cfg); err != nil {
-		http.Error(w, FAILED_TO_UPDATE_CONFIG, http.StatusInternalServerError)
+		configUpdateError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	renderConfigVersion(w, r, cfg)
 }
 
 // handleConfigAI handles AI provider configuration updates
@@ -69,14 +124,22 @@ func (s *Server) handleConfigAI(w http.ResponseWriter, r *http.Request) {
 	model := r.FormValue("ai_model")
 	apiKey := r.FormValue("ai_provider_api_key")
 
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
 		http.Error(w, FAILED_TO_GET_CONFIG, http.StatusInternalServerError)
 		return
 	}
+	if err := formConfigVersion(r, cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	cfg.AIProvider = provider
 	cfg.AIModel = model
+	if err := validateConfigChoices(cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Only update API key if a new one is provided
 	if apiKey != "" {
@@ -89,11 +152,11 @@ func (s *Server) handleConfigAI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := s.db.UpdateConfig(cfg); err != nil {
-		http.Error(w, FAILED_TO_UPDATE_CONFIG, http.StatusInternalServerError)
+		configUpdateError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	renderConfigVersion(w, r, cfg)
 }
 
 // handleConfigStrategy handles trading strategy configuration updates
@@ -111,21 +174,29 @@ func (s *Server) handleConfigStrategy(w http.ResponseWriter, r *http.Request) {
 	riskTolerance := r.FormValue("risk_tolerance")
 	tradeFrequency := r.FormValue("trade_frequency")
 
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
 		http.Error(w, FAILED_TO_GET_CONFIG, http.StatusInternalServerError)
 		return
 	}
+	if err := formConfigVersion(r, cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	cfg.RiskTolerance = riskTolerance
 	cfg.TradeFrequency = tradeFrequency
+	if err := validateConfigChoices(cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if err := s.db.UpdateConfig(cfg); err != nil {
-		http.Error(w, FAILED_TO_UPDATE_CONFIG, http.StatusInternalServerError)
+		configUpdateError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	renderConfigVersion(w, r, cfg)
 }
 
 // handleConfigWatchlist handles watchlist updates (adding symbols)
@@ -140,18 +211,21 @@ func (s *Server) handleConfigWatchlist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	symbol := strings.ToUpper(strings.TrimSpace(r.FormValue("symbol")))
-
-	if symbol == "" {
-		http.Error(w, "Symbol is required", http.StatusBadRequest)
+	symbol, err := market.NormalizeSymbol(r.FormValue("symbol"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
 		http.Error(w, FAILED_TO_GET_CONFIG, http.StatusInternalServerError)
 		return
 	}
+	if err := formConfigVersion(r, cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Add symbol if not already present
 	for _, existing := range cfg.TrackedSymbols {
@@ -165,11 +239,12 @@ func (s *Server) handleConfigWatchlist(w http.ResponseWriter, r *http.Request) {
 	cfg.TrackedSymbols = append(cfg.TrackedSymbols, symbol)
 
 	if err := s.db.UpdateConfig(cfg); err != nil {
-		http.Error(w, FAILED_TO_UPDATE_CONFIG, http.StatusInternalServerError)
+		configUpdateError(w, err)
 		return
 	}
 
 	s.renderWatchlistSettings(w, r, cfg.TrackedSymbols)
+	pages.ConfigVersion(cfg.Version, true).Render(r.Context(), w)
 }
 
 // handleConfigWatchlistSymbol handles individual symbol deletion
@@ -180,19 +255,21 @@ func (s *Server) handleConfigWatchlistSymbol(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Extract symbol from URL path
-	path := strings.TrimPrefix(r.URL.Path, "/api/config/watchlist/")
-	symbol := strings.ToUpper(strings.TrimSpace(path))
-
-	if symbol == "" {
-		http.Error(w, SYMBOL_REQUIRED, http.StatusBadRequest)
+	symbol, err := market.NormalizeSymbol(strings.TrimPrefix(r.URL.Path, "/api/config/watchlist/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
 		http.Error(w, FAILED_TO_GET_CONFIG, http.StatusInternalServerError)
 		return
 	}
+	if err := formConfigVersion(r, cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Remove symbol from tracked list
 	newSymbols := []string{}
@@ -203,13 +280,15 @@ func (s *Server) handleConfigWatchlistSymbol(w http.ResponseWriter, r *http.Requ
 	}
 
 	cfg.TrackedSymbols = newSymbols
+	pruneWatchlistGroups(cfg)
 
 	if err := s.db.UpdateConfig(cfg); err != nil {
-		http.Error(w, FAILED_TO_UPDATE_CONFIG, http.StatusInternalServerError)
+		configUpdateError(w, err)
 		return
 	}
 
 	s.renderWatchlistSettings(w, r, cfg.TrackedSymbols)
+	pages.ConfigVersion(cfg.Version, true).Render(r.Context(), w)
 }
 
 // renderWatchlistSettings renders the watchlist items using templ
@@ -218,7 +297,7 @@ func (s *Server) renderWatchlistSettings(w http.ResponseWriter, r *http.Request,
 	pages.WatchlistSettingsItemsPartial(symbols).Render(r.Context(), w)
 }
 
-// handleConfigPolling handles polling interval configuration
+// handleConfigPolling handles the polling interval and extended hours settings
 func (s *Server) handleConfigPolling(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, METHOD_NOT_ALLOWED, http.StatusMethodNotAllowed)
@@ -237,20 +316,30 @@ func (s *Server) handleConfigPolling(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
 		http.Error(w, FAILED_TO_GET_CONFIG, http.StatusInternalServerError)
 		return
 	}
+	if err := formConfigVersion(r, cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	cfg.PollingInterval = interval
+	cfg.IncludeExtendedHours = r.FormValue("include_extended_hours") == "on"
 
 	if err := s.db.UpdateConfig(cfg); err != nil {
+		if errors.Is(err, db.ErrConfigConflict) {
+			htmxError(w, CONFIG_CONFLICT)
+			return
+		}
 		htmxError(w, FAILED_TO_UPDATE_CONFIG)
 		return
 	}
 
-	htmxSuccess(w, "Polling interval updated successfully")
+	htmxSuccess(w, "Polling settings updated successfully")
+	pages.ConfigVersion(cfg.Version, true).Render(r.Context(), w)
 }
 
 // handleConfigNotifications handles notification settings updates
@@ -265,7 +354,7 @@ func (s *Server) handleConfigNotifications(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
 		htmxError(w, err.Error())
 		return
@@ -291,6 +380,15 @@ func (s *Server) handleConfigNotifications(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
+	// Handle Slack
+	slackWebhook := r.FormValue("slack_webhook")
+	slackEnabled := r.FormValue("slack_enabled") == "on"
+	if slackWebhook != "" || slackEnabled {
+		if err := s.updateNotificationChannel(cfg.ID, "slack", slackWebhook, slackEnabled); err != nil {
+			updateErrors = append(updateErrors, "slack")
+		}
+	}
+
 	// Handle SMS
 	smsPhone := r.FormValue("sms_phone")
 	smsEnabled := r.FormValue("sms_enabled") == "on"
@@ -317,7 +415,7 @@ func (s *Server) updateNotificationChannel(configID int64, channelType, target s
 	}
 
 	if err := s.db.SaveNotificationChannel(configID, ch); err != nil {
-		log.Printf("Failed to update notification channel %s: %v", channelType, err)
+		slog.Error("failed to update notification channel", "channel", channelType, "error", err)
 		return err
 	}
 	return nil
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"stockmarket/internal/db"
+)
+
+// TestConfigConflict checks that a config update made from a stale version is refused
+// with 409 instead of overwriting the change made since, through the database, the
+// JSON API and the settings forms
+func TestConfigConflict(t *testing.T) {
+	s, mux := newTestServer(t)
+
+	stale := testConfig(t, s)
+	fresh := testConfig(t, s)
+	fresh.RiskTolerance = "aggressive"
+	if err := s.db.UpdateConfig(fresh); err != nil {
+		t.Fatal(err)
+	}
+	stale.RiskTolerance = "conservative"
+	if err := s.db.UpdateConfig(stale); !errors.Is(err, db.ErrConfigConflict) {
+		t.Fatalf("stale UpdateConfig: err = %v, want ErrConfigConflict", err)
+	}
+	if got := testConfig(t, s).RiskTolerance; got != "aggressive" {
+		t.Fatalf("risk tolerance = %s after a refused update, want aggressive", got)
+	}
+
+	body := `{"risk_tolerance":"conservative","version":` + strconv.FormatInt(stale.Version, 10) + `}`
+	if rec := serve(mux, httptest.NewRequest(http.MethodPut, "/api/config", strings.NewReader(body))); rec.Code != http.StatusConflict {
+		t.Errorf("PUT /api/config with a stale version: status %d, want 409: %s", rec.Code, rec.Body)
+	}
+
+	saveStrategy := func(version int64) *httptest.ResponseRecorder {
+		form := url.Values{"risk_tolerance": {"moderate"}, "trade_frequency": {"weekly"}, "version": {strconv.FormatInt(version, 10)}}
+		r := httptest.NewRequest(http.MethodPost, "/api/config/strategy", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serve(mux, r)
+	}
+	if rec := saveStrategy(stale.Version); rec.Code != http.StatusConflict {
+		t.Errorf("settings form with a stale version: status %d, want 409", rec.Code)
+	}
+	current := testConfig(t, s).Version
+	rec := saveStrategy(current)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("settings form with the current version: status %d: %s", rec.Code, rec.Body)
+	}
+	if want := `value="` + strconv.FormatInt(current+1, 10) + `"`; !strings.Contains(rec.Body.String(), want) || !strings.Contains(rec.Body.String(), "hx-swap-oob") {
+		t.Errorf("save response %q doesn't swap in the new version %d", rec.Body, current+1)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/sync/errgroup"
+
+	"stockmarket/internal/models"
+)
+
+// dashboardQuote is one watchlist entry; Error is set when its quote didn't resolve in time
+type dashboardQuote struct {
+	Symbol string        `json:"symbol"`
+	Quote  *models.Quote `json:"quote,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// dashboardResponse aggregates the data behind the dashboard
+type dashboardResponse struct {
+	Quotes       []dashboardQuote `json:"quotes"`
+	SignalsToday int              `json:"signals_today"`
+	ActiveAlerts int              `json:"active_alerts"`
+}
+
+// handleDashboard returns watchlist quotes, or those of the watchlist group named by
+// ?group=, and summary counts in one response. Each quote is fetched concurrently under
+// its own timeout, so a slow or failing symbol is reported with an error instead of
+// holding up the rest.
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	symbols, err := requestWatchlistSymbols(r, cfg)
+	if err != nil {
+		respondErr(w, http.StatusNotFound, err)
+		return
+	}
+
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
+		return
+	}
+
+	quotes := make([]dashboardQuote, len(symbols))
+	var g errgroup.Group
+	for i, symbol := range symbols {
+		g.Go(func() error {
+			ctx, cancel := context.WithTimeout(r.Context(), s.config.DashboardCallTimeout)
+			defer cancel()
+
+			quotes[i] = dashboardQuote{Symbol: symbol}
+			quote, err := provider.GetQuote(ctx, symbol)
+			if err != nil {
+				quotes[i].Error = err.Error()
+				return nil
+			}
+			quotes[i].Quote = quote
+			return nil
+		})
+	}
+	g.Wait()
+
+	resp := dashboardResponse{Quotes: quotes}
+	if recommendations, err := s.db.GetRecommendationsToday(); err == nil {
+		resp.SignalsToday = len(recommendations)
+	}
+	if alerts, err := s.db.GetActiveAlerts(cfg.ID); err == nil {
+		resp.ActiveAlerts = len(alerts)
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
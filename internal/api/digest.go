@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// digestMaxAnalyses bounds how many analyses a single digest lists
+const digestMaxAnalyses = 50
+
+// StartDigestScheduler sends a daily digest of analyses and triggered alerts at the
+// configured time, when the digest is enabled
+func (s *Server) StartDigestScheduler(ctx context.Context) {
+	if !s.config.DigestEnabled {
+		return
+	}
+
+	go func() {
+		for {
+			next := nextDigestTime(time.Now().In(s.config.Location), s.config.DigestTime)
+			slog.Info("next daily digest scheduled", "at", next.Format(time.RFC3339))
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				s.sendDigest(next)
+			}
+		}
+	}()
+}
+
+// nextDigestTime returns the next occurrence of the "HH:MM" clock time after now, in now's location
+func nextDigestTime(now time.Time, clock string) time.Time {
+	t, _ := time.Parse("15:04", clock)
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// sendDigest collects the day's activity up to at and dispatches it as one notification
+// per profile, with that profile's triggered alerts
+func (s *Server) sendDigest(at time.Time) {
+	profiles, err := s.db.ListProfiles()
+	if err != nil {
+		slog.Error("digest: failed to list profiles", "error", err)
+		return
+	}
+
+	dayStart := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	analyses, err := s.db.GetAnalysesSince(dayStart, digestMaxAnalyses)
+	if err != nil {
+		slog.Error("digest: failed to load analyses", "error", err)
+		return
+	}
+
+	for _, profile := range profiles {
+		cfg, err := s.db.GetProfileConfig(profile.ID)
+		if err != nil {
+			slog.Error("digest: "+FAILED_TO_GET_CONFIG, "profile_id", profile.ID, "error", err)
+			continue
+		}
+		alerts, err := s.db.GetAlertsTriggeredSince(profile.ID, dayStart)
+		if err != nil {
+			slog.Error("digest: failed to load alerts", "profile_id", profile.ID, "error", err)
+			continue
+		}
+
+		if len(analyses) == 0 && len(alerts) == 0 {
+			slog.Info("digest: no activity, skipping", "profile_id", profile.ID, "day", dayStart.Format("2006-01-02"))
+			continue
+		}
+
+		s.enqueueNotification(profile.ID, buildDigest(dayStart, analyses, alerts), cfg.NotificationChannels)
+		slog.Info("digest dispatched", "profile_id", profile.ID, "analyses", len(analyses), "alerts", len(alerts))
+	}
+}
+
+// buildDigest formats the day's analyses and triggered alerts as a notification
+func buildDigest(day time.Time, analyses []models.AnalysisResponse, alerts []models.PriceAlert) models.Notification {
+	var b strings.Builder
+	var symbols []string
+	addSymbol := func(symbol string) {
+		if !slices.Contains(symbols, symbol) {
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	fmt.Fprintf(&b, "Analyses (%d):\n", len(analyses))
+	if len(analyses) == 0 {
+		b.WriteString("- none\n")
+	}
+	for _, a := range analyses {
+		addSymbol(a.Symbol)
+		fmt.Fprintf(&b, "- %s: %s (%.0f%% confidence)\n", a.Symbol, a.Action, a.Confidence*100)
+	}
+
+	fmt.Fprintf(&b, "\nTriggered alerts (%d):\n", len(alerts))
+	if len(alerts) == 0 {
+		b.WriteString("- none\n")
+	}
+	for _, a := range alerts {
+		addSymbol(a.Symbol)
+		if alertConditions[a.Condition] {
+			fmt.Fprintf(&b, "- %s %s %s\n", a.Symbol, a.Condition, market.FormatPrice(a.Price, market.SymbolCurrency(a.Symbol)))
+		} else {
+			fmt.Fprintf(&b, "- %s %s\n", a.Symbol, a.Condition)
+		}
+	}
+
+	return models.Notification{
+		Type:    "daily_digest",
+		Title:   "Daily Digest: " + day.Format("Jan 2, 2006"),
+		Message: strings.TrimRight(b.String(), "\n"),
+		Symbol:  strings.Join(symbols, ", "),
+	}
+}
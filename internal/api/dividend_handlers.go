@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+const fundamentalsUnavailable = "Fundamentals are not available from "
+
+// handleDividendScreen filters the watchlist by dividend yield, and optionally by payout
+// ratio and dividend growth streak, returning matches sorted by yield descending
+func (s *Server) handleDividendScreen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	query := r.URL.Query()
+	minYield, err := queryFloat(query.Get("min_yield"), 0)
+	if err != nil || minYield < 0 {
+		respondError(w, http.StatusBadRequest, "min_yield must be a non-negative number")
+		return
+	}
+	maxPayout, err := queryFloat(query.Get("max_payout"), 0)
+	if err != nil || maxPayout < 0 {
+		respondError(w, http.StatusBadRequest, "max_payout must be a non-negative number")
+		return
+	}
+	minYears := 0
+	if v := query.Get("min_increase_years"); v != "" {
+		minYears, err = strconv.Atoi(v)
+		if err != nil || minYears < 0 {
+			respondError(w, http.StatusBadRequest, "min_increase_years must be a non-negative integer")
+			return
+		}
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	provider, err := s.requestMarketProvider(cfg, s.config.FundamentalsProvider)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
+		return
+	}
+	fp, ok := provider.(market.FundamentalsProvider)
+	if !ok {
+		respondError(w, http.StatusNotImplemented, fundamentalsUnavailable+provider.Name())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	var (
+		results     []models.Fundamentals
+		errs        = make(map[string]string)
+		unsupported bool
+		mu          sync.Mutex
+		wg          sync.WaitGroup
+	)
+	for _, symbol := range cfg.TrackedSymbols {
+		wg.Add(1)
+		go func(symbol string) {
+			defer wg.Done()
+			f, err := fp.GetFundamentals(ctx, symbol)
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.Is(err, market.ErrNotSupported) {
+				unsupported = true
+				return
+			}
+			if err != nil {
+				errs[symbol] = err.Error()
+				return
+			}
+			if dividendMatches(*f, minYield, maxPayout, minYears) {
+				results = append(results, *f)
+			}
+		}(symbol)
+	}
+	wg.Wait()
+
+	// Wrapped providers always expose the method, so lack of support surfaces per call
+	if unsupported {
+		respondError(w, http.StatusNotImplemented, fundamentalsUnavailable+provider.Name())
+		return
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return *results[i].DividendYield > *results[j].DividendYield
+	})
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"results": results,
+		"errors":  errs,
+	})
+}
+
+// dividendMatches reports whether fundamentals pass the screen. Symbols without a
+// reported yield never match; the payout and streak filters only exclude symbols
+// whose values are known, so missing data doesn't hide otherwise-qualifying stocks.
+func dividendMatches(f models.Fundamentals, minYield, maxPayout float64, minYears int) bool {
+	if f.DividendYield == nil || *f.DividendYield < minYield || *f.DividendYield == 0 {
+		return false
+	}
+	if maxPayout > 0 && f.PayoutRatio != nil && *f.PayoutRatio > maxPayout {
+		return false
+	}
+	if minYears > 0 && f.ConsecutiveIncreaseYears != nil && *f.ConsecutiveIncreaseYears < minYears {
+		return false
+	}
+	return true
+}
+
+// queryFloat parses an optional numeric query parameter
+func queryFloat(v string, def float64) (float64, error) {
+	if v == "" {
+		return def, nil
+	}
+	return strconv.ParseFloat(v, 64)
+}
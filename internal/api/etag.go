@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// cacheRevalidate is the Cache-Control of ETagged responses that don't set their own:
+// clients may keep them but must check with If-None-Match before reusing one
+const cacheRevalidate = "private, no-cache"
+
+// ETag gives successful GET and HEAD responses a weak ETag hashed from the body and
+// answers a request whose If-None-Match names it with 304 Not Modified and no body,
+// so clients polling an unchanged resource don't download it again. The response is
+// buffered to hash it, so it suits read endpoints with modest bodies, not streams.
+func ETag(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next(w, r)
+			return
+		}
+		ew := &etagWriter{ResponseWriter: w}
+		next(ew, r)
+		ew.finish(r.Header.Get("If-None-Match"))
+	}
+}
+
+// etagWriter holds back a response until it's complete, to hash it
+type etagWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *etagWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// finish sends the held response, or 304 when it's the version ifNoneMatch names.
+// Only 200 responses are tagged; errors pass through as written.
+func (w *etagWriter) finish(ifNoneMatch string) {
+	if w.status == 0 {
+		return // nothing written; net/http sends its default 200
+	}
+	if w.status != http.StatusOK {
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(w.body.Bytes())
+		return
+	}
+
+	sum := sha256.Sum256(w.body.Bytes())
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	h := w.Header()
+	h.Set("ETag", etag)
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", cacheRevalidate)
+	}
+	if etagMatches(ifNoneMatch, etag) {
+		h.Del(HEADER_CONTENT_TYPE)
+		h.Del("Content-Length")
+		w.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+	w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// etagMatches reports whether an If-None-Match header names etag, comparing weakly
+// as If-None-Match does
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// exportFlushEvery is how many JSONL records are written between flushes
+const exportFlushEvery = 500
+
+// handleExportAnalyses streams analyses as JSONL, filtered by ?from=&to=
+func (s *Server) handleExportAnalyses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	from, to, err := exportRange(r)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	write := startJSONL(w, "analyses")
+	if err := s.db.ExportAnalyses(from, to, func(a models.AnalysisResponse) error {
+		return write(a)
+	}); err != nil {
+		slog.Error("analyses export failed", "error", err)
+	}
+}
+
+// analysisCSVHeader is the column row of the analyses CSV export; keep it stable,
+// spreadsheets and scripts key on it
+var analysisCSVHeader = []string{"symbol", "action", "confidence", "price", "created_at", "reasoning"}
+
+// handleAnalysesExport streams analyses as a CSV or JSON download (?format=csv|json,
+// default csv), filtered and sorted like GET /api/analyses but without a default limit
+func (s *Server) handleAnalysesExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	filter, err := ParseAnalysisFilter(r, 0)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "csv":
+		write, finish := startCSV(w, "analyses", analysisCSVHeader)
+		err = s.db.ExportFilteredAnalyses(filter, func(a models.AnalysisResponse) error {
+			return write([]string{
+				a.Symbol,
+				a.Action,
+				strconv.FormatFloat(a.Confidence, 'f', -1, 64),
+				strconv.FormatFloat(a.PriceTargets.Entry, 'f', -1, 64),
+				a.GeneratedAt.UTC().Format(time.RFC3339),
+				a.Reasoning,
+			})
+		})
+		if finishErr := finish(); err == nil {
+			err = finishErr
+		}
+	case "json":
+		write, finish := startJSONArray(w, "analyses")
+		err = s.db.ExportFilteredAnalyses(filter, func(a models.AnalysisResponse) error {
+			return write(a)
+		})
+		if finishErr := finish(); err == nil {
+			err = finishErr
+		}
+	default:
+		respondError(w, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+	if err != nil {
+		slog.Error("analyses export failed", "error", err)
+	}
+}
+
+// handleExportSnapshots streams recorded quote snapshots as JSONL, filtered by ?from=&to=
+func (s *Server) handleExportSnapshots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	from, to, err := exportRange(r)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	write := startJSONL(w, "snapshots")
+	if err := s.db.ExportQuoteSnapshots(from, to, func(q models.QuoteSnapshot) error {
+		return write(q)
+	}); err != nil {
+		slog.Error("snapshots export failed", "error", err)
+	}
+}
+
+// exportRange parses the ?from= and ?to= bounds (YYYY-MM-DD or RFC 3339). A date-only
+// to includes that whole day. Missing bounds default to all time and now.
+func exportRange(r *http.Request) (from, to time.Time, err error) {
+	to = time.Now()
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = parseExportTime(v, false); err != nil {
+			return from, to, fmt.Errorf("invalid from: %q", v)
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = parseExportTime(v, true); err != nil {
+			return from, to, fmt.Errorf("invalid to: %q", v)
+		}
+	}
+	if !to.After(from) {
+		return from, to, errors.New("to must be after from")
+	}
+	return from, to, nil
+}
+
+// parseExportTime parses an export bound; endOfDay moves a date-only value to the next midnight
+func parseExportTime(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.UTC)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// startJSONL sets up a streamed JSONL download and returns a per-record writer
+func startJSONL(w http.ResponseWriter, name string) func(v interface{}) error {
+	w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_JSONL)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.jsonl"`, name, time.Now().Format("20060102")))
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	count := 0
+	return func(v interface{}) error {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		if count++; flusher != nil && count%exportFlushEvery == 0 {
+			flusher.Flush()
+		}
+		return nil
+	}
+}
+
+// startCSV sets up a streamed CSV download, writes its header row and returns a
+// per-row writer and a finish func that flushes what's left
+func startCSV(w http.ResponseWriter, name string, header []string) (write func([]string) error, finish func() error) {
+	w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_CSV)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.csv"`, name, time.Now().Format("20060102")))
+
+	cw := csv.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	headerErr := cw.Write(header)
+	count := 0
+	write = func(row []string) error {
+		if headerErr != nil {
+			return headerErr
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+		if count++; count%exportFlushEvery == 0 {
+			cw.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return cw.Error()
+		}
+		return nil
+	}
+	finish = func() error {
+		cw.Flush()
+		return cw.Error()
+	}
+	return write, finish
+}
+
+// startJSONArray sets up a streamed download of a JSON array and returns a per-element
+// writer and a finish func that closes the array
+func startJSONArray(w http.ResponseWriter, name string) (write func(v interface{}) error, finish func() error) {
+	w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_JSON)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.json"`, name, time.Now().Format("20060102")))
+
+	flusher, _ := w.(http.Flusher)
+	count := 0
+	write = func(v interface{}) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		sep := ","
+		if count == 0 {
+			sep = "["
+		}
+		if _, err := fmt.Fprintf(w, "%s\n%s", sep, b); err != nil {
+			return err
+		}
+		if count++; flusher != nil && count%exportFlushEvery == 0 {
+			flusher.Flush()
+		}
+		return nil
+	}
+	finish = func() error {
+		closing := "\n]\n"
+		if count == 0 {
+			closing = "[]\n"
+		}
+		_, err := fmt.Fprint(w, closing)
+		return err
+	}
+	return write, finish
+}
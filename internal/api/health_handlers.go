@@ -1,116 +1,360 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
 	"net/http"
+	"net/url"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"stockmarket/internal/ai"
+	"stockmarket/internal/apperr"
 	"stockmarket/internal/config"
+	"stockmarket/internal/db"
+	"stockmarket/internal/market"
 	"stockmarket/internal/models"
 )
 
+// Version is the build version reported by /api/health, set at build time with
+// -ldflags "-X stockmarket/internal/api.Version=..."
+var Version = "dev"
+
+// Health check statuses
+const (
+	healthOK       = "ok"
+	healthDown     = "down"
+	healthHealthy  = "healthy"
+	healthDegraded = "degraded" // a non-critical dependency is down
+	healthFailing  = "unhealthy"
+)
+
+// dependencyHealth is the result of checking one subsystem
+type dependencyHealth struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Provider  string `json:"provider,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// handleHealth reports overall status and each dependency's. The database is always
+// checked and is critical: when it's down the response is a 503. ?deep=true also
+// quotes PROVIDER_HEALTH_SYMBOL from the profile's market provider, which spends quota,
+// so a failing provider only degrades the status.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"status": "healthy",
-		"time":   time.Now().Format(time.RFC3339),
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	checks := map[string]dependencyHealth{}
+	status, code := healthHealthy, http.StatusOK
+
+	start := time.Now()
+	dbErr := s.db.Ping(ctx)
+	checks["database"] = checkResult(dbErr, time.Since(start))
+	if dbErr != nil {
+		status, code = healthFailing, http.StatusServiceUnavailable
+	}
+
+	if r.URL.Query().Get("deep") == "true" {
+		provider := s.checkMarketProvider(ctx, r)
+		checks["market"] = provider
+		if provider.Status != healthOK && status == healthHealthy {
+			status = healthDegraded
+		}
+	}
+
+	respondJSON(w, code, map[string]interface{}{
+		"status":      status,
+		"time":        time.Now().Format(time.RFC3339),
+		"version":     Version,
+		"commit":      buildCommit(),
+		"checks":      checks,
+		"quote_cache": s.quoteCache.Stats(),
 	})
 }
 
+// checkMarketProvider quotes the health symbol from the request profile's provider
+// directly, bypassing the cache and fallbacks
+func (s *Server) checkMarketProvider(ctx context.Context, r *http.Request) dependencyHealth {
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		return checkResult(err, 0)
+	}
+	chain, err := s.providerChain(cfg)
+	if err != nil {
+		result := checkResult(err, 0)
+		result.Provider = cfg.MarketDataProvider
+		return result
+	}
+
+	start := time.Now()
+	_, err = chain[0].GetQuote(ctx, s.config.ProviderHealthSymbol)
+	// Request URLs can carry the API key, and /api/health is unauthenticated
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	result := checkResult(err, time.Since(start))
+	result.Provider = chain[0].Name()
+	return result
+}
+
+func checkResult(err error, latency time.Duration) dependencyHealth {
+	result := dependencyHealth{Status: healthOK, LatencyMS: latency.Milliseconds()}
+	if err != nil {
+		result.Status = healthDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// buildCommit is the VCS revision recorded by the Go toolchain, if any
+func buildCommit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
+
+// configUpdate is the body of PUT /api/config; fields left out keep their value
+type configUpdate struct {
+	MarketDataProvider   string            `json:"market_data_provider"`
+	MarketDataAPIKey     string            `json:"market_data_api_key"`
+	AIProvider           string            `json:"ai_provider"`
+	AIProviderAPIKey     string            `json:"ai_provider_api_key"`
+	AIModel              string            `json:"ai_model"`
+	RiskTolerance        string            `json:"risk_tolerance"`
+	TradeFrequency       string            `json:"trade_frequency"`
+	TrackedSymbols       []string          `json:"tracked_symbols"`
+	SymbolAliases        map[string]string `json:"symbol_aliases"`
+	NotifyMinConfidence  *float64          `json:"notify_min_confidence"`
+	NotifyOnActions      []string          `json:"notify_on_actions"`
+	NotifyOnHold         *bool             `json:"notify_on_hold"`
+	IncludeExtendedHours *bool             `json:"include_extended_hours"`
+	Version              *int64            `json:"version"` // version the client last read, if known
+}
+
 // handleConfig handles configuration CRUD
 func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		cfg, err := s.db.GetOrCreateConfig()
+		cfg, err := s.requestConfig(r)
 		if err != nil {
-			respondError(w, http.StatusInternalServerError, err.Error())
+			respondErr(w, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Decrypt API keys for response (masked)
-		if cfg.MarketDataAPIKey != "" {
-			key, _ := config.Decrypt(cfg.MarketDataAPIKey, s.config.EncryptionKey)
-			if len(key) > 4 {
-				cfg.MarketDataAPIKey = key[:4] + "****" + key[len(key)-4:]
-			}
-		}
-		if cfg.AIProviderAPIKey != "" {
-			key, _ := config.Decrypt(cfg.AIProviderAPIKey, s.config.EncryptionKey)
-			if len(key) > 4 {
-				cfg.AIProviderAPIKey = key[:4] + "****" + key[len(key)-4:]
+		// Decrypt API keys for response (masked). A key no configured encryption key opens
+		// is reported as "****" rather than leaking the stored blob.
+		for _, field := range []struct {
+			name  string
+			value *string
+		}{
+			{"market data API key", &cfg.MarketDataAPIKey},
+			{"AI provider API key", &cfg.AIProviderAPIKey},
+		} {
+			key, err := s.decryptSecret(field.name, *field.value)
+			if err != nil {
+				*field.value = "****"
+			} else if len(key) > 4 {
+				*field.value = key[:4] + "****" + key[len(key)-4:]
 			}
 		}
+		cfg.NotificationChannels = s.maskChannels(cfg.NotificationChannels)
 
 		respondJSON(w, http.StatusOK, cfg)
 
 	case http.MethodPut:
-		var input struct {
-			MarketDataProvider string   `json:"market_data_provider"`
-			MarketDataAPIKey   string   `json:"market_data_api_key"`
-			AIProvider         string   `json:"ai_provider"`
-			AIProviderAPIKey   string   `json:"ai_provider_api_key"`
-			AIModel            string   `json:"ai_model"`
-			RiskTolerance      string   `json:"risk_tolerance"`
-			TradeFrequency     string   `json:"trade_frequency"`
-			TrackedSymbols     []string `json:"tracked_symbols"`
-		}
+		var input configUpdate
 
 		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			respondError(w, http.StatusBadRequest, "Invalid JSON")
 			return
 		}
 
-		cfg, err := s.db.GetOrCreateConfig()
+		cfg, err := s.requestConfig(r)
 		if err != nil {
-			respondError(w, http.StatusInternalServerError, err.Error())
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		if input.Version != nil && *input.Version != cfg.Version {
+			respondError(w, http.StatusConflict, CONFIG_CONFLICT)
 			return
 		}
 
 		// Update fields
 		if input.MarketDataProvider != "" {
-			cfg.MarketDataProvider = input.MarketDataProvider
+			cfg.MarketDataProvider = strings.ToLower(strings.TrimSpace(input.MarketDataProvider))
 		}
 		if input.MarketDataAPIKey != "" && !strings.Contains(input.MarketDataAPIKey, "****") {
-			encrypted, _ := config.Encrypt(input.MarketDataAPIKey, s.config.EncryptionKey)
+			encrypted, err := config.Encrypt(input.MarketDataAPIKey, s.config.EncryptionKey)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, FAILED_TO_ENCRYPT_API_KEY)
+				return
+			}
 			cfg.MarketDataAPIKey = encrypted
 		}
 		if input.AIProvider != "" {
-			cfg.AIProvider = input.AIProvider
+			cfg.AIProvider = strings.ToLower(strings.TrimSpace(input.AIProvider))
 		}
 		if input.AIProviderAPIKey != "" && !strings.Contains(input.AIProviderAPIKey, "****") {
-			encrypted, _ := config.Encrypt(input.AIProviderAPIKey, s.config.EncryptionKey)
+			encrypted, err := config.Encrypt(input.AIProviderAPIKey, s.config.EncryptionKey)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, FAILED_TO_ENCRYPT_API_KEY)
+				return
+			}
 			cfg.AIProviderAPIKey = encrypted
 		}
 		if input.AIModel != "" {
-			cfg.AIModel = input.AIModel
+			cfg.AIModel = strings.TrimSpace(input.AIModel)
 		}
 		if input.RiskTolerance != "" {
-			cfg.RiskTolerance = input.RiskTolerance
+			cfg.RiskTolerance = strings.ToLower(strings.TrimSpace(input.RiskTolerance))
 		}
 		if input.TradeFrequency != "" {
-			cfg.TradeFrequency = input.TradeFrequency
+			cfg.TradeFrequency = strings.ToLower(strings.TrimSpace(input.TradeFrequency))
 		}
 		if input.TrackedSymbols != nil {
-			// Normalize symbols to uppercase
-			for i := range input.TrackedSymbols {
-				input.TrackedSymbols[i] = strings.ToUpper(strings.TrimSpace(input.TrackedSymbols[i]))
+			if cfg.TrackedSymbols, err = normalizeSymbols(input.TrackedSymbols); err != nil {
+				respondErr(w, http.StatusBadRequest, fmt.Errorf("tracked_symbols: %w", err))
+				return
+			}
+			pruneWatchlistGroups(cfg)
+		}
+		if input.SymbolAliases != nil {
+			if cfg.SymbolAliases, err = normalizeAliases(input.SymbolAliases); err != nil {
+				respondErr(w, http.StatusBadRequest, fmt.Errorf("symbol_aliases: %w", err))
+				return
+			}
+		}
+		if input.NotifyMinConfidence != nil {
+			if *input.NotifyMinConfidence < 0 || *input.NotifyMinConfidence > 1 {
+				respondError(w, http.StatusBadRequest, "notify_min_confidence must be between 0 and 1")
+				return
+			}
+			cfg.NotifyMinConfidence = *input.NotifyMinConfidence
+		}
+		if input.NotifyOnActions != nil {
+			if cfg.NotifyOnActions, err = normalizeActions(input.NotifyOnActions); err != nil {
+				respondErr(w, http.StatusBadRequest, fmt.Errorf("notify_on_actions: %w", err))
+				return
 			}
-			cfg.TrackedSymbols = input.TrackedSymbols
+		}
+		if input.NotifyOnHold != nil {
+			cfg.NotifyOnHold = *input.NotifyOnHold
+		}
+		if input.IncludeExtendedHours != nil {
+			cfg.IncludeExtendedHours = *input.IncludeExtendedHours
+		}
+		if err := validateConfigChoices(cfg); err != nil {
+			respondErr(w, http.StatusBadRequest, err)
+			return
 		}
 
 		if err := s.db.UpdateConfig(cfg); err != nil {
-			respondError(w, http.StatusInternalServerError, err.Error())
+			if errors.Is(err, db.ErrConfigConflict) {
+				respondError(w, http.StatusConflict, CONFIG_CONFLICT)
+				return
+			}
+			respondErr(w, http.StatusInternalServerError, err)
 			return
 		}
 
-		respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+		respondJSON(w, http.StatusOK, map[string]interface{}{"status": "updated", "version": cfg.Version})
 
 	default:
 		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
 	}
 }
 
-// handleQuote fetches a stock quote
+// normalizeSymbols normalizes and deduplicates tracked symbols, failing on the first
+// invalid one
+func normalizeSymbols(symbols []string) ([]string, error) {
+	result := make([]string, 0, len(symbols))
+	for _, raw := range symbols {
+		symbol, err := market.NormalizeSymbol(raw)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(result, symbol) {
+			result = append(result, symbol)
+		}
+	}
+	return result, nil
+}
+
+// validateConfigChoices checks a profile's providers, model, risk tolerance and trade
+// frequency against the values the server supports, listing the valid ones on a mismatch
+func validateConfigChoices(cfg *models.UserConfig) error {
+	if !slices.Contains(market.Providers, cfg.MarketDataProvider) {
+		return fmt.Errorf("market_data_provider must be one of %s", strings.Join(market.Providers, ", "))
+	}
+	if !slices.Contains(ai.Providers, ai.CanonicalProvider(cfg.AIProvider)) {
+		return fmt.Errorf("ai_provider must be one of %s", strings.Join(ai.Providers, ", "))
+	}
+	if cfg.AIModel != "" {
+		if err := ai.ValidateModel(cfg.AIProvider, cfg.AIModel); err != nil {
+			if known := ai.KnownModels(cfg.AIProvider); len(known) > 0 {
+				return fmt.Errorf("ai_model: %v (expected one of %s)", err, strings.Join(known, ", "))
+			}
+			return errors.New("ai_model: " + err.Error())
+		}
+	}
+	if _, ok := models.RiskProfiles[cfg.RiskTolerance]; !ok {
+		return fmt.Errorf("risk_tolerance must be one of %s", strings.Join(slices.Sorted(maps.Keys(models.RiskProfiles)), ", "))
+	}
+	if _, ok := models.TradeFrequencyProfiles[cfg.TradeFrequency]; !ok {
+		return fmt.Errorf("trade_frequency must be one of %s", strings.Join(slices.Sorted(maps.Keys(models.TradeFrequencyProfiles)), ", "))
+	}
+	return nil
+}
+
+// normalizeAliases uppercases symbol aliases and normalizes their tickers, skipping
+// blank entries; tickers must be valid symbols
+func normalizeAliases(input map[string]string) (map[string]string, error) {
+	aliases := make(map[string]string, len(input))
+	for alias, ticker := range input {
+		alias = strings.ToUpper(strings.TrimSpace(alias))
+		if alias == "" || strings.TrimSpace(ticker) == "" {
+			continue
+		}
+		symbol, err := market.NormalizeSymbol(ticker)
+		if err != nil {
+			return nil, err
+		}
+		aliases[alias] = symbol
+	}
+	return aliases, nil
+}
+
+// normalizeActions uppercases and deduplicates signal actions, failing on unknown ones
+func normalizeActions(input []string) ([]string, error) {
+	actions := make([]string, 0, len(input))
+	for _, action := range input {
+		action = strings.ToUpper(strings.TrimSpace(action))
+		if !ai.ValidAction(action) {
+			return nil, errors.New("unknown action " + strconv.Quote(action))
+		}
+		if !slices.Contains(actions, action) {
+			actions = append(actions, action)
+		}
+	}
+	return actions, nil
+}
+
+// handleProfiles returns the risk tolerance and trade frequency profiles
 func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
@@ -123,4 +367,154 @@ func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// marketProviderInfo describes a supported market data provider
+type marketProviderInfo struct {
+	Name           string `json:"name"`
+	RequiresAPIKey bool   `json:"requires_api_key"`
+}
+
+// aiProviderInfo describes a supported AI provider. Models lists the known models from
+// the price table; it's empty for local providers, which accept any model name.
+type aiProviderInfo struct {
+	Name           string   `json:"name"`
+	RequiresAPIKey bool     `json:"requires_api_key"`
+	DefaultModel   string   `json:"default_model,omitempty"`
+	Models         []string `json:"models"`
+}
+
+// handleProviders lists the market data and AI providers the server supports, from the
+// same registries market.NewProvider and ai.NewAnalyzer use (GET /api/providers)
+func (s *Server) handleProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	marketProviders := make([]marketProviderInfo, len(market.Providers))
+	for i, name := range market.Providers {
+		marketProviders[i] = marketProviderInfo{Name: name, RequiresAPIKey: market.RequiresAPIKey(name)}
+	}
+
+	aiProviders := make([]aiProviderInfo, len(ai.Providers))
+	for i, name := range ai.Providers {
+		info := aiProviderInfo{Name: name, RequiresAPIKey: ai.RequiresAPIKey(name), Models: ai.KnownModels(name)}
+		if info.Models == nil {
+			info.Models = []string{}
+		}
+		// The analyzer an empty model resolves to is the provider's default
+		if analyzer, err := ai.NewAnalyzer(name, "", ""); err == nil {
+			info.DefaultModel = analyzer.Model()
+		}
+		aiProviders[i] = info
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"market_data": marketProviders,
+		"ai":          aiProviders,
+	})
+}
+
+// keyCheckTimeout bounds the probe request of a key validation
+const keyCheckTimeout = 15 * time.Second
+
+// validateKeyInput is the body of POST /api/validate-key
+type validateKeyInput struct {
+	ProviderType string `json:"provider_type"` // "market" or "ai"
+	Provider     string `json:"provider"`
+	APIKey       string `json:"api_key"`
+}
+
+// validateKeyResult is whether a provider accepted a key, and why not if it didn't
+type validateKeyResult struct {
+	Valid     bool   `json:"valid"`
+	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// handleValidateKey checks an API key before it's saved (POST /api/validate-key) by
+// making the cheapest authenticated call the provider has: a quote of
+// PROVIDER_HEALTH_SYMBOL (BTC-USD for crypto-only Binance) for market data, a model
+// listing for AI, which spends no tokens. The key is never stored. A rejected key is
+// still a 200, with valid false and the provider's reason.
+func (s *Server) handleValidateKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+	var input validateKeyInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondError(w, http.StatusBadRequest, INVALID_JSON)
+		return
+	}
+	input.Provider = strings.ToLower(strings.TrimSpace(input.Provider))
+	input.APIKey = strings.TrimSpace(input.APIKey)
+
+	var probe func(context.Context) error
+	switch input.ProviderType {
+	case "market":
+		if !slices.Contains(market.Providers, input.Provider) {
+			respondError(w, http.StatusBadRequest, "Unknown market data provider: "+input.Provider)
+			return
+		}
+		provider, err := s.newMarketProvider(input.Provider, input.APIKey)
+		if err != nil {
+			respondErr(w, http.StatusBadRequest, err)
+			return
+		}
+		symbol := s.config.ProviderHealthSymbol
+		if input.Provider == "binance" {
+			symbol = "BTC-USD"
+		}
+		probe = func(ctx context.Context) error {
+			_, err := provider.GetQuote(ctx, symbol)
+			return err
+		}
+	case "ai":
+		if !slices.Contains(ai.Providers, ai.CanonicalProvider(input.Provider)) {
+			respondError(w, http.StatusBadRequest, "Unknown AI provider: "+input.Provider)
+			return
+		}
+		if ai.CanonicalProvider(input.Provider) == "ensemble" {
+			respondError(w, http.StatusBadRequest, "The ensemble provider has no key of its own; validate each member's")
+			return
+		}
+		analyzer, err := s.newAnalyzer(input.Provider, input.APIKey, "")
+		if err != nil {
+			respondErr(w, http.StatusBadRequest, err)
+			return
+		}
+		verifier, ok := analyzer.(ai.KeyVerifier)
+		if !ok {
+			respondError(w, http.StatusBadRequest, "Keys for "+input.Provider+" can't be checked")
+			return
+		}
+		probe = verifier.VerifyKey
+	default:
+		respondError(w, http.StatusBadRequest, `provider_type must be "market" or "ai"`)
+		return
+	}
+	requiresKey := market.RequiresAPIKey(input.Provider)
+	if input.ProviderType == "ai" {
+		requiresKey = ai.RequiresAPIKey(input.Provider)
+	}
+	if requiresKey && input.APIKey == "" {
+		respondError(w, http.StatusBadRequest, "api_key is required for "+input.Provider)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), keyCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := probe(ctx)
+	result := validateKeyResult{Valid: err == nil, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Error, result.Code = err.Error(), apperr.CodeOf(err)
+		if ctx.Err() != nil {
+			result.Code = apperr.Timeout
+		}
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
 // handleWebSocket handles WebSocket connections for real-time updates
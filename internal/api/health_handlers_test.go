@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"stockmarket/internal/market"
+)
+
+// TestValidateKeyUsesProviderFactory checks that key validation builds its provider
+// with the server's factory, so fakes stand in for the real provider
+func TestValidateKeyUsesProviderFactory(t *testing.T) {
+	var built []string
+	_, mux := newTestServer(t, WithMarketProvider(func(name, apiKey string) (market.Provider, error) {
+		built = append(built, name+":"+apiKey)
+		return market.NewMock(), nil
+	}))
+
+	body := `{"provider_type": "market", "provider": "finnhub", "api_key": "test-key"}`
+	rec := serve(mux, httptest.NewRequest("POST", "/api/validate-key", strings.NewReader(body)))
+	if rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var result validateKeyResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid {
+		t.Errorf("result = %+v, want the fake provider's quote to validate the key", result)
+	}
+	if len(built) != 1 || built[0] != "finnhub:test-key" {
+		t.Errorf("factory built %v, want finnhub with the submitted key", built)
+	}
+}
+
+// TestDeepHealthUsesRequestProfile checks that ?deep=true probes the provider of the
+// profile the request selects, not the default profile's
+func TestDeepHealthUsesRequestProfile(t *testing.T) {
+	var built []string
+	s, mux := newTestServer(t, WithMarketProvider(func(name, apiKey string) (market.Provider, error) {
+		built = append(built, name)
+		return market.NewMock(), nil
+	}))
+	other, err := s.db.CreateProfile("other", testConfig(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := s.db.GetProfileConfig(other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MarketDataProvider = "finnhub"
+	if err := s.db.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/api/health?deep=true", nil)
+	r.Header.Set(ProfileHeader, strconv.FormatInt(other.ID, 10))
+	if rec := serve(s.ResolveProfile(mux), r); rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if !slices.Contains(built, "finnhub") {
+		t.Errorf("factory built %v, want the other profile's finnhub", built)
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+
+	"stockmarket/internal/apperr"
 )
 
 // respondJSON sends a JSON response
@@ -13,9 +17,21 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-// respondError sends an error response
+// respondError sends an error response with the code that fits its status
 func respondError(w http.ResponseWriter, status int, message string) {
-	respondJSON(w, status, map[string]string{"error": message})
+	respondJSON(w, status, errorResponse{Error: message, Code: apperr.CodeForStatus(status)})
+}
+
+// respondErr sends err as an error response. An error with a code is sent with that
+// code and its status; others are sent with status and the code that fits it.
+func respondErr(w http.ResponseWriter, status int, err error) {
+	code := apperr.CodeOf(err)
+	if code != "" {
+		status = apperr.Status(code)
+	} else {
+		code = apperr.CodeForStatus(status)
+	}
+	respondJSON(w, status, errorResponse{Error: err.Error(), Code: code})
 }
 
 // htmxSuccess sends a success notification via HTMX
@@ -26,6 +42,32 @@ func htmxSuccess(w http.ResponseWriter, message string) {
 
 // htmxError sends an error notification via HTMX
 func htmxError(w http.ResponseWriter, message string) {
+	htmxErrorStatus(w, http.StatusBadRequest, message)
+}
+
+// htmxErrorStatus sends an error notification via HTMX with a status other than 400
+func htmxErrorStatus(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("HX-Trigger", fmt.Sprintf(`{"showToast": {"message": "%s", "type": "error"}}`, message))
-	w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(status)
+}
+
+// normalizeTags lowercases and trims tags, dropping empties and duplicates
+func normalizeTags(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// queryTags reads tag filters from repeated or comma-separated ?tag= parameters
+func queryTags(r *http.Request) []string {
+	var tags []string
+	for _, v := range r.URL.Query()["tag"] {
+		tags = append(tags, strings.Split(v, ",")...)
+	}
+	return normalizeTags(tags)
 }
@@ -0,0 +1,462 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+	"stockmarket/internal/notify"
+)
+
+// Background job types
+const (
+	jobAnalysis     = "analysis"
+	jobNotification = "notification"
+	jobPrune        = "prune"
+)
+
+// jobTypes lists the job types, each run by its own workers
+var jobTypes = []string{jobAnalysis, jobNotification, jobPrune}
+
+// jobPollInterval is how often an idle worker looks for jobs that came due, such as
+// retries, without being woken by a new one
+const jobPollInterval = time.Second
+
+// jobSweepInterval is how often finished jobs past JOB_RETENTION are deleted
+const jobSweepInterval = time.Hour
+
+// Job list sizes
+const (
+	defaultJobListLimit = 50
+	maxJobListLimit     = 500
+)
+
+// analysisJobPayload is the symbol an analysis job analyzes with its profile's settings
+type analysisJobPayload struct {
+	Symbol string `json:"symbol"`
+}
+
+// notificationJobPayload is a notification job's notification, sent to its profile's
+// channels as they stand when the job runs. ChannelIDs narrows a retry to the channels
+// that failed.
+type notificationJobPayload struct {
+	Notification     models.Notification `json:"notification"`
+	BypassQuietHours bool                `json:"bypass_quiet_hours,omitempty"`
+	RequestID        string              `json:"request_id,omitempty"`
+	ChannelIDs       []int64             `json:"channel_ids,omitempty"`
+}
+
+// pruneJobPayload is the retention window a prune job applies
+type pruneJobPayload struct {
+	Days int `json:"days"`
+}
+
+// partialJobError is a failed attempt that got part of the job done; payload is what
+// a retry has left to do
+type partialJobError struct {
+	err     error
+	payload json.RawMessage
+}
+
+func (e *partialJobError) Error() string {
+	return e.err.Error()
+}
+
+func (e *partialJobError) Unwrap() error {
+	return e.err
+}
+
+// enqueueJob adds a job to the durable queue and wakes a worker for it. It reports
+// false, adding nothing, when a pending job has the same type and key.
+func (s *Server) enqueueJob(job models.Job, payload interface{}) (models.Job, bool, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return job, false, err
+	}
+	job.Payload, job.MaxAttempts = data, s.config.JobMaxAttempts
+	added, err := s.db.EnqueueJob(&job)
+	if err != nil || !added {
+		return job, false, err
+	}
+	s.wakeJobWorker(job.Type)
+	return job, true, nil
+}
+
+// wakeJobWorker tells an idle worker of a job type to look for due jobs
+func (s *Server) wakeJobWorker(jobType string) {
+	select {
+	case s.jobWake[jobType] <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueNotification queues a notification to a profile's channels as a job, so it's
+// delivered even if the server restarts first. If the job can't be saved it goes
+// straight to the in-memory dispatch queue instead.
+func (s *Server) enqueueNotification(profileID int64, notification models.Notification, channels []models.NotificationConfig) {
+	if len(channels) == 0 {
+		return
+	}
+	payload := notificationJobPayload{Notification: notification, BypassQuietHours: notification.BypassQuietHours, RequestID: notification.RequestID}
+	if _, _, err := s.enqueueJob(models.Job{Type: jobNotification, ProfileID: profileID}, payload); err != nil {
+		slog.Error("failed to queue notification job, dispatching it directly", "type", notification.Type, "profile_id", profileID, "error", err)
+		s.notifyService.Enqueue(notification, s.openChannels(channels))
+	}
+}
+
+// enqueueAnalyses queues an analysis job per symbol for a profile and returns the IDs of
+// those added; a symbol with an analysis still waiting keeps that one
+func (s *Server) enqueueAnalyses(profileID int64, symbols []string) []int64 {
+	ids := []int64{}
+	for _, symbol := range symbols {
+		job := models.Job{Type: jobAnalysis, ProfileID: profileID, Key: fmt.Sprintf("%d:%s", profileID, symbol)}
+		job, added, err := s.enqueueJob(job, analysisJobPayload{Symbol: symbol})
+		if err != nil {
+			slog.Error("failed to queue analysis job", "profile_id", profileID, "symbol", symbol, "error", err)
+			continue
+		}
+		if added {
+			ids = append(ids, job.ID)
+		}
+	}
+	return ids
+}
+
+// StartJobWorkers requeues the jobs the last shutdown interrupted, then runs queued jobs
+// until ctx ends: analyses one at a time, as scheduled runs always were, notifications
+// on NOTIFY_WORKERS workers so they never wait behind an analysis, and prunes one at a
+// time. Finished jobs are deleted once they're older than JOB_RETENTION.
+func (s *Server) StartJobWorkers(ctx context.Context) {
+	if n, err := s.db.RequeueRunningJobs(); err != nil {
+		slog.Error("failed to requeue interrupted jobs", "error", err)
+	} else if n > 0 {
+		slog.Info("requeued jobs interrupted by the last shutdown", "jobs", n)
+	}
+
+	lanes := map[string]struct {
+		workers int
+		run     func(context.Context, *models.Job) error
+	}{
+		jobAnalysis:     {1, s.runAnalysisJob},
+		jobNotification: {s.config.NotifyWorkers, s.runNotificationJob},
+		jobPrune:        {1, s.runPruneJob},
+	}
+	for jobType, lane := range lanes {
+		for range lane.workers {
+			go s.runJobWorker(ctx, jobType, lane.run)
+		}
+	}
+
+	if s.config.JobRetention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(jobSweepInterval)
+		defer ticker.Stop()
+		for {
+			if n, err := s.db.DeleteFinishedJobs(time.Now().Add(-s.config.JobRetention)); err != nil {
+				slog.Error("failed to delete finished jobs", "error", err)
+			} else if n > 0 {
+				slog.Info("deleted finished jobs", "jobs", n)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runJobWorker claims and runs due jobs of one type until ctx ends
+func (s *Server) runJobWorker(ctx context.Context, jobType string, run func(context.Context, *models.Job) error) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		job, err := s.db.ClaimJob(jobType, time.Now())
+		if err == nil {
+			// Another idle worker may take the next job while this one runs
+			s.wakeJobWorker(jobType)
+			s.runJob(ctx, job, run)
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("failed to claim job", "type", jobType, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-s.jobWake[jobType]:
+		case <-ticker.C:
+		}
+	}
+}
+
+// errJobHeld is returned by a job that handed part of its work to an in-memory queue,
+// such as a notification held for quiet hours. The job stays running until that work
+// finishes and records its own outcome; if the server stops first, the next start
+// requeues it.
+var errJobHeld = errors.New("job held in memory")
+
+// runJob runs a claimed job and records how it went, unless the job is held
+func (s *Server) runJob(ctx context.Context, job *models.Job, run func(context.Context, *models.Job) error) {
+	start := time.Now()
+	err := run(ctx, job)
+	if errors.Is(err, errJobHeld) {
+		slog.Debug("job held", "job_id", job.ID, "type", job.Type)
+		return
+	}
+	s.finishJob(ctx, job, start, err)
+}
+
+// finishJob records how a job's attempt went: done; pending again after the retry
+// backoff while it has attempts left; or failed. A job cut short by shutdown is pending
+// again right away, to run on the next start.
+func (s *Server) finishJob(ctx context.Context, job *models.Job, start time.Time, err error) {
+	logArgs := []any{"job_id", job.ID, "type", job.Type, "attempt", job.Attempts, "duration_ms", time.Since(start).Milliseconds()}
+
+	var saveErr error
+	switch {
+	case err == nil:
+		saveErr = s.db.CompleteJob(job.ID)
+		slog.Debug("job done", logArgs...)
+	case ctx.Err() != nil:
+		saveErr = s.db.RetryJob(job.ID, "interrupted by shutdown", time.Now(), nil)
+	case job.Attempts < job.MaxAttempts:
+		var partial *partialJobError
+		var payload json.RawMessage
+		if errors.As(err, &partial) {
+			payload = partial.payload
+		}
+		wait := s.config.JobRetryBackoff << min(job.Attempts-1, 16)
+		slog.Warn("job failed, retrying", append(logArgs, "retry_in", wait, "error", err)...)
+		saveErr = s.db.RetryJob(job.ID, err.Error(), time.Now().Add(wait), payload)
+	default:
+		slog.Error("job failed", append(logArgs, "error", err)...)
+		saveErr = s.db.FailJob(job.ID, err.Error())
+	}
+	if saveErr != nil {
+		slog.Error("failed to record job outcome", "job_id", job.ID, "error", saveErr)
+	}
+}
+
+// runAnalysisJob analyzes a symbol with the job's profile's saved providers, saving,
+// broadcasting and notifying on the analysis. When the market data provider is rate
+// limited the other queued analyses wait out the retry backoff too, leaving what's left
+// of the budget for interactive use.
+func (s *Server) runAnalysisJob(ctx context.Context, job *models.Job) error {
+	var payload analysisJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+	cfg, err := s.db.GetProfileConfig(job.ProfileID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", FAILED_TO_GET_CONFIG, err)
+	}
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		return err
+	}
+	analyzer, err := s.requestAnalyzer(cfg, "", "")
+	if err != nil {
+		return fmt.Errorf("%s: %w", FAILED_TO_GET_ANALYZE, err)
+	}
+
+	ctx, cancel := context.WithTimeout(withProfile(ctx, cfg.ID), s.config.AnalyzeTimeout)
+	defer cancel()
+	analysis, err := s.analyzeSymbol(ctx, cfg, provider, analyzer, payload.Symbol)
+	if errors.Is(err, market.ErrRateLimited) {
+		if n, _ := s.db.DelayJobs(jobAnalysis, time.Now().Add(s.config.JobRetryBackoff)); n > 0 {
+			slog.Warn("market data rate limited, delaying queued analyses", "jobs", n, "delay", s.config.JobRetryBackoff)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.notifySignal(ctx, analysis, cfg)
+	s.BroadcastAnalysis(cfg.ID, analysis)
+	return nil
+}
+
+// runNotificationJob sends a notification to the job's profile's channels. When a rate
+// limit queues it or quiet hours hold it for some channels the job stays running, down
+// to just those channels, until they've had it, so a restart in the meantime sends it
+// to them again rather than losing it. A retry goes only to the channels that failed so
+// the others don't get it twice.
+func (s *Server) runNotificationJob(ctx context.Context, job *models.Job) error {
+	var payload notificationJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+	cfg, err := s.db.GetProfileConfig(job.ProfileID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", FAILED_TO_GET_CONFIG, err)
+	}
+	channels := cfg.NotificationChannels
+	if len(payload.ChannelIDs) > 0 {
+		channels = slices.DeleteFunc(slices.Clone(channels), func(ch models.NotificationConfig) bool {
+			return !slices.Contains(payload.ChannelIDs, ch.ID)
+		})
+	}
+	notification := payload.Notification
+	notification.BypassQuietHours, notification.RequestID = payload.BypassQuietHours, payload.RequestID
+
+	start := time.Now()
+	tracker := &heldNotification{outcomes: make(map[int64]error)}
+	sendCtx, cancel := context.WithTimeout(ctx, s.config.NotifySendTimeout)
+	defer cancel()
+	results, held := s.notifyService.SendToChannelsTracked(sendCtx, notification, s.openChannels(channels), tracker.release)
+	for _, id := range held {
+		delete(results, id)
+	}
+	if len(held) == 0 {
+		return notificationJobResult(payload, results)
+	}
+
+	// Keep only the held channels in the payload, so if the server stops before
+	// they've had the notification the requeued job goes to just them
+	pending := payload
+	pending.ChannelIDs = slices.Sorted(slices.Values(held))
+	if data, err := json.Marshal(pending); err == nil {
+		if err := s.db.UpdateJobPayload(job.ID, data); err != nil {
+			slog.Error("failed to save held notification job", "job_id", job.ID, "error", err)
+		}
+	}
+	tracker.wait(held, func(outcomes map[int64]error) {
+		maps.Copy(results, outcomes)
+		// The outcomes are final, so a shutdown starting meanwhile mustn't requeue the job
+		s.finishJob(context.WithoutCancel(ctx), job, start, notificationJobResult(payload, results))
+	})
+	return errJobHeld
+}
+
+// notificationJobResult is a notification job's outcome from its channels' results:
+// nil when none failed, otherwise an error whose payload retries just the failed ones.
+// Notifications quiet hours suppressed or a full queue dropped count as handled.
+func notificationJobResult(payload notificationJobPayload, results map[int64]error) error {
+	var failed []int64
+	var firstErr error
+	for id, err := range results {
+		if err == nil || errors.Is(err, notify.ErrQuietHours) || errors.Is(err, notify.ErrDropped) {
+			continue
+		}
+		failed = append(failed, id)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	slices.Sort(failed)
+	payload.ChannelIDs = failed
+	retry, _ := json.Marshal(payload)
+	return &partialJobError{
+		err:     fmt.Errorf("%d of %d channels failed, one with: %w", len(failed), len(results), firstErr),
+		payload: retry,
+	}
+}
+
+// heldNotification collects the outcomes of a notification job's held channels as the
+// notify service releases them, which can start before the job knows which are held
+type heldNotification struct {
+	mu       sync.Mutex
+	held     []int64
+	outcomes map[int64]error
+	done     func(map[int64]error)
+}
+
+// release records a held channel's outcome
+func (h *heldNotification) release(channelID int64, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.outcomes[channelID] = err
+	h.check()
+}
+
+// wait calls done with the outcomes once every one of held has been released
+func (h *heldNotification) wait(held []int64, done func(map[int64]error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.held, h.done = held, done
+	h.check()
+}
+
+// check calls done if every held channel has an outcome; callers hold mu
+func (h *heldNotification) check() {
+	if h.done == nil {
+		return
+	}
+	for _, id := range h.held {
+		if _, ok := h.outcomes[id]; !ok {
+			return
+		}
+	}
+	done := h.done
+	h.done = nil
+	go done(maps.Clone(h.outcomes))
+}
+
+// runPruneJob prunes analyses and quote snapshots past the job's retention window
+func (s *Server) runPruneJob(ctx context.Context, job *models.Job) error {
+	var payload pruneJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+	_, err := s.pruneOldData(payload.Days)
+	return err
+}
+
+// handleJobs lists the request profile's background jobs and the server-wide ones, such
+// as retention prunes, newest first, with their status, attempts and last error (GET
+// /api/jobs?status=&type=&limit=). Analyses started with POST /api/analyze/{symbol}?async=true
+// aren't queued here; they run straight away in memory and are tracked at
+// /api/analyze/jobs/{id}.
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	limit := defaultJobListLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, maxJobListLimit)
+		}
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.JobPending, models.JobRunning, models.JobDone, models.JobFailed:
+	default:
+		respondError(w, http.StatusBadRequest, "status must be pending, running, done or failed")
+		return
+	}
+	jobType := r.URL.Query().Get("type")
+	if jobType != "" && !slices.Contains(jobTypes, jobType) {
+		respondError(w, http.StatusBadRequest, "type must be analysis, notification or prune")
+		return
+	}
+
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	jobs, err := s.db.GetJobs(profileID, limit, status, jobType)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, jobs)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// jobStatus returns the status of a profile's only job of a type
+func jobStatus(t *testing.T, s *Server, profileID int64, jobType string) string {
+	t.Helper()
+	jobs, err := s.db.GetJobs(profileID, 10, "", jobType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("%d %s jobs, want 1", len(jobs), jobType)
+	}
+	return jobs[0].Status
+}
+
+// TestThrottledNotificationJobWaits checks that a notification job a rate limit queues
+// in memory stays running until the queue sends it
+func TestThrottledNotificationJobWaits(t *testing.T) {
+	s, _ := newTestServer(t)
+	var received atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { received.Add(1) }))
+	defer hook.Close()
+
+	cfg := testConfig(t, s)
+	channel := models.NotificationConfig{Type: "webhook", Target: hook.URL, Enabled: true, Events: []string{"buy_signal"}}
+	if err := s.db.SaveNotificationChannel(cfg.ID, &channel); err != nil {
+		t.Fatal(err)
+	}
+	s.notifyService.SetRateLimit("webhook", 1, 300*time.Millisecond, 10, "drop")
+
+	notification := models.Notification{Type: "buy_signal", Symbol: "AAPL", Title: "Buy", Message: "test"}
+	run := func() {
+		t.Helper()
+		if _, _, err := s.enqueueJob(models.Job{Type: jobNotification, ProfileID: cfg.ID}, notificationJobPayload{Notification: notification}); err != nil {
+			t.Fatal(err)
+		}
+		job, err := s.db.ClaimJob(jobNotification, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.runJob(context.Background(), job, s.runNotificationJob)
+	}
+
+	run() // takes the only token
+	if _, err := s.db.DeleteFinishedJobs(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	run() // queued by the rate limit
+	if status := jobStatus(t, s, cfg.ID, jobNotification); status != models.JobRunning {
+		t.Fatalf("throttled job is %s, want running until it's sent", status)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for jobStatus(t, s, cfg.ID, jobNotification) != models.JobDone {
+		if time.Now().After(deadline) {
+			t.Fatalf("throttled job still %s after the rate limit passed", jobStatus(t, s, cfg.ID, jobNotification))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := received.Load(); n != 2 {
+		t.Errorf("webhook received %d notifications, want 2", n)
+	}
+}
+
+func TestJobsScopedToProfile(t *testing.T) {
+	s, mux := newTestServer(t)
+	owner := testConfig(t, s)
+	other, err := s.db.CreateProfile("other", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range []models.Job{
+		{Type: jobAnalysis, ProfileID: owner.ID, Key: "mine"},
+		{Type: jobAnalysis, ProfileID: other.ID, Key: "theirs"},
+		{Type: jobPrune, Key: "retention"},
+	} {
+		if _, err := s.db.EnqueueJob(&job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/jobs", nil)
+	r.Header.Set(ProfileHeader, strconv.FormatInt(other.ID, 10))
+	rec := serve(s.ResolveProfile(mux), r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var jobs []models.Job
+	if err := json.Unmarshal(rec.Body.Bytes(), &jobs); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, job := range jobs {
+		keys = append(keys, job.Key)
+	}
+	slices.Sort(keys)
+	if want := []string{"retention", "theirs"}; !slices.Equal(keys, want) {
+		t.Errorf("other profile's jobs = %v, want %v", keys, want)
+	}
+}
+
+// TestRetentionPruneQueuedAtStartup checks that the first retention prune is queued
+// when the pruner starts instead of one interval later
+func TestRetentionPruneQueuedAtStartup(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.config.DataRetentionDays = 30
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.startRetentionPrune(ctx)
+	if status := jobStatus(t, s, 0, jobPrune); status != models.JobPending {
+		t.Errorf("prune job status = %q, want it queued", status)
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"stockmarket/internal/apperr"
+	"stockmarket/internal/config"
+)
+
+// errUndecryptableSecret reports a stored API key no configured encryption key opens.
+// It's a server misconfiguration, so handlers answer it with a 500 rather than a 400.
+var errUndecryptableSecret = apperr.New(apperr.Internal, "stored API key could not be decrypted; the encryption key may have changed")
+
+// decryptSecret decrypts a stored API key with ENCRYPTION_KEY or one of
+// ENCRYPTION_OLD_KEYS; an empty value decrypts to an empty key. Failures are logged and
+// wrap errUndecryptableSecret.
+func (s *Server) decryptSecret(name, encrypted string) (string, error) {
+	if encrypted == "" {
+		return "", nil
+	}
+	key, err := config.Decrypt(encrypted, s.config.DecryptionKeys()...)
+	if err != nil {
+		slog.Error("failed to decrypt stored api key", "key", name, "error", err)
+		return "", fmt.Errorf("%s: %w (check ENCRYPTION_KEY and ENCRYPTION_OLD_KEYS, or re-enter the key in settings)", name, errUndecryptableSecret)
+	}
+	return key, nil
+}
+
+// providerErrorStatus is the status for a failure to build or call a market or AI
+// provider: the one for the error's code, e.g. 500 when a stored key can't be decrypted
+// or 429 when the provider is rate limiting, and 400 for errors without a code
+func providerErrorStatus(err error) int {
+	if code := apperr.CodeOf(err); code != "" {
+		return apperr.Status(code)
+	}
+	return http.StatusBadRequest
+}
+
+// CheckStoredSecrets tries to decrypt every profile's stored API keys at startup and
+// logs a prominent error for each one that can't be read, so a wrong or missing
+// ENCRYPTION_KEY shows up before the first provider call fails
+func (s *Server) CheckStoredSecrets() {
+	profiles, err := s.db.ListProfiles()
+	if err != nil {
+		slog.Error("failed to check stored api keys", "error", err)
+		return
+	}
+
+	unreadable := 0
+	for _, profile := range profiles {
+		cfg, err := s.db.GetProfileConfig(profile.ID)
+		if err != nil {
+			slog.Error("failed to check stored api keys", "profile_id", profile.ID, "error", err)
+			continue
+		}
+		for _, key := range []struct{ name, value string }{
+			{"market_data_api_key", cfg.MarketDataAPIKey},
+			{"ai_provider_api_key", cfg.AIProviderAPIKey},
+		} {
+			if key.value == "" {
+				continue
+			}
+			if _, err := config.Decrypt(key.value, s.config.DecryptionKeys()...); err != nil {
+				unreadable++
+				slog.Error("stored api key can't be decrypted", "profile_id", profile.ID, "key", key.name)
+			}
+		}
+	}
+	if unreadable == 0 {
+		return
+	}
+
+	hint := "ENCRYPTION_KEY may have changed; set it to the key these were saved with, or list that key in ENCRYPTION_OLD_KEYS"
+	if s.config.EncryptionKeyGenerated {
+		hint = "ENCRYPTION_KEY is not set, so a throwaway key is in use; set it to the key these were saved with"
+	}
+	slog.Error("stored api keys can't be decrypted; providers using them will fail until this is fixed or the keys are re-entered",
+		"count", unreadable, "hint", hint)
+}
+
+// handleRotateKey re-encrypts every stored API key and Telegram bot token under the
+// current ENCRYPTION_KEY (POST /api/admin/rotate-key). To rotate, restart with the new
+// key as ENCRYPTION_KEY and the old one in ENCRYPTION_OLD_KEYS, call this, then drop the
+// old key.
+func (s *Server) handleRotateKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	rewrapped, err := s.db.RewrapSecrets(s.config.OldEncryptionKeys, s.config.EncryptionKey)
+	if errors.Is(err, config.ErrUndecryptable) {
+		respondError(w, http.StatusConflict, "Key rotation failed, nothing was changed: "+err.Error()+"; add the key it was encrypted with to ENCRYPTION_OLD_KEYS")
+		return
+	} else if err != nil {
+		respondError(w, http.StatusInternalServerError, "Key rotation failed, nothing was changed: "+err.Error())
+		return
+	}
+
+	slog.Info("rewrapped stored secrets", "count", rewrapped, "old_keys", len(s.config.OldEncryptionKeys))
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "rotated",
+		"rewrapped": rewrapped,
+	})
+}
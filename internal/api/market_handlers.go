@@ -2,12 +2,18 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
 	"strings"
 	"time"
 
-	"stockmarket/internal/config"
+	"stockmarket/internal/analytics"
+	"stockmarket/internal/indicators"
 	"stockmarket/internal/market"
+	"stockmarket/internal/models"
 )
 
 // handleQuote fetches a quote for a symbol
@@ -17,43 +23,138 @@ func (s *Server) handleQuote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	symbol := strings.TrimPrefix(r.URL.Path, "/api/quote/")
-	if symbol == "" {
-		respondError(w, http.StatusBadRequest, SYMBOL_REQUIRED)
+	symbol, err := market.NormalizeSymbol(strings.TrimPrefix(r.URL.Path, "/api/quote/"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
 		return
 	}
-	symbol = strings.ToUpper(symbol)
 
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondErr(w, http.StatusInternalServerError, err)
 		return
 	}
+	symbol = market.ResolveSymbol(symbol, cfg.SymbolAliases)
 
-	// Decrypt API key
-	apiKey := ""
-	if cfg.MarketDataAPIKey != "" {
-		apiKey, _ = config.Decrypt(cfg.MarketDataAPIKey, s.config.EncryptionKey)
-	}
-
-	provider, err := market.NewProvider(cfg.MarketDataProvider, apiKey)
+	provider, err := s.marketProvider(cfg)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+		respondErr(w, providerErrorStatus(err), err)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.QuoteTimeout)
 	defer cancel()
 
 	quote, err := provider.GetQuote(ctx, symbol)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+		respondErr(w, http.StatusBadRequest, err)
 		return
 	}
+	s.applyYearRange(ctx, provider, quote)
 
 	respondJSON(w, http.StatusOK, quote)
 }
 
+// fetchQuote fetches a quote under QUOTE_TIMEOUT, within whatever deadline ctx already has
+func (s *Server) fetchQuote(ctx context.Context, provider market.Provider, symbol string) (*models.Quote, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.QuoteTimeout)
+	defer cancel()
+	return provider.GetQuote(ctx, symbol)
+}
+
+// applyExtendedHours prices a quote at its extended-hours trade for analyses and
+// alerts when the profile includes extended hours
+func applyExtendedHours(cfg *models.UserConfig, quote *models.Quote) {
+	if cfg.IncludeExtendedHours {
+		market.UseExtendedHours(quote)
+	}
+}
+
+// maxBatchQuoteSymbols caps how many symbols one /api/quotes request may include
+const maxBatchQuoteSymbols = 50
+
+// handleQuotes fetches quotes for several symbols at once, listed in ?symbols= or taken
+// from the watchlist group named by ?group=. Symbols that fail are listed under
+// "errors" instead of failing the whole request.
+func (s *Server) handleQuotes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var symbols []string
+	seen := make(map[string]bool)
+	for _, sym := range strings.Split(r.URL.Query().Get("symbols"), ",") {
+		if strings.TrimSpace(sym) == "" {
+			continue
+		}
+		if sym, err = market.NormalizeSymbol(market.ResolveSymbol(sym, cfg.SymbolAliases)); err != nil {
+			respondErr(w, http.StatusBadRequest, fmt.Errorf("symbols: %w", err))
+			return
+		}
+		if !seen[sym] {
+			seen[sym] = true
+			symbols = append(symbols, sym)
+		}
+	}
+	// Without symbols, quote a watchlist group
+	if len(symbols) == 0 && r.URL.Query().Get("group") != "" {
+		if symbols, err = requestWatchlistSymbols(r, cfg); err != nil {
+			respondErr(w, http.StatusNotFound, err)
+			return
+		}
+		if len(symbols) == 0 {
+			respondJSON(w, http.StatusOK, map[string]interface{}{"quotes": map[string]models.Quote{}, "errors": map[string]string{}})
+			return
+		}
+	}
+	if len(symbols) == 0 {
+		respondError(w, http.StatusBadRequest, "symbols or group is required")
+		return
+	}
+	if len(symbols) > maxBatchQuoteSymbols {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("At most %d symbols are allowed", maxBatchQuoteSymbols))
+		return
+	}
+
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.QuoteTimeout)
+	defer cancel()
+
+	quotes, err := provider.GetQuotes(ctx, symbols)
+	errs := make(map[string]string)
+	var batchErr *market.BatchError
+	if errors.As(err, &batchErr) {
+		for symbol, symbolErr := range batchErr.Errors {
+			errs[symbol] = symbolErr.Error()
+		}
+	} else if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	for symbol, quote := range quotes {
+		s.applyYearRange(ctx, provider, &quote)
+		quotes[symbol] = quote
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"quotes": quotes,
+		"errors": errs,
+	})
+}
+
 // handleHistorical fetches historical data
 func (s *Server) handleHistorical(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -61,43 +162,298 @@ func (s *Server) handleHistorical(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	symbol := strings.TrimPrefix(r.URL.Path, "/api/historical/")
-	if symbol == "" {
-		respondError(w, http.StatusBadRequest, SYMBOL_REQUIRED)
+	symbol, err := market.NormalizeSymbol(strings.TrimPrefix(r.URL.Path, "/api/historical/"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
 		return
 	}
-	symbol = strings.ToUpper(symbol)
 
 	period := r.URL.Query().Get("period")
 	if period == "" {
 		period = "1m" // Default to 1 month
 	}
+	interval := r.URL.Query().Get("interval")
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := market.ValidateInterval(cfg.MarketDataProvider, period, interval); err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
 
-	cfg, err := s.db.GetOrCreateConfig()
+	provider, err := s.marketProvider(cfg)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondErr(w, providerErrorStatus(err), err)
 		return
 	}
 
-	apiKey := ""
-	if cfg.MarketDataAPIKey != "" {
-		apiKey, _ = config.Decrypt(cfg.MarketDataAPIKey, s.config.EncryptionKey)
+	forceRefresh, err := boolQuery(r, "force_refresh")
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.HistoricalTimeout)
+	defer cancel()
+	if forceRefresh {
+		ctx = market.WithForceRefresh(ctx)
 	}
 
-	provider, err := market.NewProvider(cfg.MarketDataProvider, apiKey)
+	candles, err := provider.GetHistoricalData(ctx, symbol, period, interval)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Adjusted closes are included unless adjusted=false asks for the raw series only
+	if r.URL.Query().Get("adjusted") == "false" {
+		raw := make([]models.Candle, len(candles))
+		for i, c := range candles {
+			c.AdjClose = 0
+			raw[i] = c
+		}
+		candles = raw
+	} else {
+		candles = market.WithAdjClose(ctx, provider, symbol, candles)
+	}
+
+	// The same candles are served from the history cache for HISTORICAL_CACHE_TTL, so
+	// clients may reuse them that long without asking again, unless the newest bar may
+	// still be trading; those keep ETag's revalidate-every-time default
+	if ttl := s.config.HistoricalCacheTTL; ttl >= time.Second && !forceRefresh && market.EndsBeforeToday(symbol, period, interval, candles, time.Now()) {
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ttl.Seconds())))
+		w.Header().Add("Vary", ProfileHeader+", Cookie")
+	}
+	respondJSON(w, http.StatusOK, candles)
+}
+
+// handleLevels returns support/resistance levels detected from a symbol's history
+func (s *Server) handleLevels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	symbol, err := market.NormalizeSymbol(strings.TrimPrefix(r.URL.Path, "/api/levels/"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "6m"
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	candles, err := provider.GetHistoricalData(ctx, symbol, period)
+	candles, err := market.AdjustedHistory(ctx, provider, symbol, period, "")
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+		respondErr(w, http.StatusBadRequest, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, candles)
+	levels := indicators.SupportResistance(candles)
+	if levels == nil {
+		levels = []models.PriceLevel{}
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"symbol": symbol,
+		"period": period,
+		"levels": levels,
+	})
+}
+
+// tradingDaysPerMonth is the lookback used for the benchmark comparison's monthly returns
+const tradingDaysPerMonth = 21
+
+// handleBeta returns a symbol's beta against a benchmark
+func (s *Server) handleBeta(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	symbol, err := market.NormalizeSymbol(strings.TrimPrefix(r.URL.Path, "/api/beta/"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "1y"
+	}
+	benchmark := s.config.BenchmarkSymbol
+	if raw := r.URL.Query().Get("benchmark"); raw != "" {
+		if benchmark, err = market.NormalizeSymbol(raw); err != nil {
+			respondErr(w, http.StatusBadRequest, fmt.Errorf("benchmark: %w", err))
+			return
+		}
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	comparison := s.benchmarkComparison(ctx, provider, symbol, benchmark, period)
+	if comparison == nil {
+		respondError(w, http.StatusBadRequest, FAILED_TO_GET_HISTORICAL_DATA)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"symbol":           symbol,
+		"benchmark":        benchmark,
+		"period":           period,
+		"beta":             comparison.Beta,
+		"symbol_return":    comparison.SymbolReturn,
+		"benchmark_return": comparison.BenchmarkReturn,
+	})
+}
+
+// benchmarkComparison computes a symbol's beta and monthly return alongside the
+// benchmark's from daily history over period. It returns nil when either history fails to load.
+func (s *Server) benchmarkComparison(ctx context.Context, provider market.Provider, symbol, benchmark, period string) *models.BenchmarkComparison {
+	symbolCandles, err := market.AdjustedHistory(ctx, provider, symbol, period, "")
+	if err != nil {
+		slog.Warn("skipping benchmark comparison", "symbol", symbol, "error", err)
+		return nil
+	}
+	benchmarkCandles, err := market.AdjustedHistory(ctx, provider, benchmark, period, "")
+	if err != nil {
+		slog.Warn("skipping benchmark comparison", "symbol", symbol, "benchmark", benchmark, "error", err)
+		return nil
+	}
+
+	round := func(v float64) *float64 {
+		v = math.Round(v*100) / 100
+		return &v
+	}
+	comparison := &models.BenchmarkComparison{Symbol: benchmark}
+	if beta, ok := analytics.AlignedBeta(symbolCandles, benchmarkCandles); ok {
+		comparison.Beta = round(beta)
+	}
+	if ret, ok := analytics.PeriodReturn(symbolCandles, tradingDaysPerMonth); ok {
+		comparison.SymbolReturn = round(ret)
+	}
+	if ret, ok := analytics.PeriodReturn(benchmarkCandles, tradingDaysPerMonth); ok {
+		comparison.BenchmarkReturn = round(ret)
+	}
+	return comparison
+}
+
+// maxCorrelationSymbols caps how many symbols a correlation request may include
+const maxCorrelationSymbols = 20
+
+// handleCorrelation computes a pairwise correlation matrix of daily returns
+func (s *Server) handleCorrelation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "6m"
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Default to the watchlist when no symbols are given
+	var symbols []string
+	seen := make(map[string]bool)
+	raw := cfg.TrackedSymbols
+	if q := r.URL.Query().Get("symbols"); q != "" {
+		raw = strings.Split(q, ",")
+	}
+	for _, sym := range raw {
+		if strings.TrimSpace(sym) == "" {
+			continue
+		}
+		if sym, err = market.NormalizeSymbol(market.ResolveSymbol(sym, cfg.SymbolAliases)); err != nil {
+			respondErr(w, http.StatusBadRequest, fmt.Errorf("symbols: %w", err))
+			return
+		}
+		if !seen[sym] {
+			seen[sym] = true
+			symbols = append(symbols, sym)
+		}
+	}
+	if len(symbols) < 2 {
+		respondError(w, http.StatusBadRequest, "At least two symbols are required")
+		return
+	}
+	if len(symbols) > maxCorrelationSymbols {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("At most %d symbols are allowed", maxCorrelationSymbols))
+		return
+	}
+
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+
+	candles := make(map[string][]models.Candle, len(symbols))
+	for _, sym := range symbols {
+		data, err := market.AdjustedHistory(ctx, provider, sym, period, "")
+		if err != nil {
+			respondErr(w, http.StatusBadRequest, fmt.Errorf(FAILED_TO_GET_HISTORICAL_DATA+" for %s: %w", sym, err))
+			return
+		}
+		candles[sym] = data
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"symbols": symbols,
+		"period":  period,
+		"matrix":  analytics.CorrelationMatrix(symbols, candles),
+	})
+}
+
+// applyYearRange adds 52-week range context to a quote, falling back to a year of
+// daily candles when the provider doesn't report the range itself
+func (s *Server) applyYearRange(ctx context.Context, provider market.Provider, quote *models.Quote) {
+	if !s.config.Quote52WeekRange {
+		return
+	}
+
+	var candles []models.Candle
+	if quote.FiftyTwoWeekHigh == 0 {
+		candles, _ = market.AdjustedHistory(ctx, provider, quote.Symbol, "1y", "")
+	}
+	market.ApplyYearRange(quote, candles)
 }
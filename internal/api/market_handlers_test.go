@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestQuerySymbolsValidated checks that symbols taken from query parameters are
+// normalized like path symbols, so none reaches a provider URL unchecked
+func TestQuerySymbolsValidated(t *testing.T) {
+	_, mux := newTestServer(t)
+	for _, tc := range []struct {
+		name, path string
+		want       string // in the error
+	}{
+		{"quotes traversal", "/api/quotes?symbols=AAPL," + url.QueryEscape("../../v2/secret"), "symbols"},
+		{"quotes query string", "/api/quotes?symbols=" + url.QueryEscape("AAPL?apikey=x"), "symbols"},
+		{"quotes blank", "/api/quotes?symbols=" + url.QueryEscape(" , ,"), "symbols or group is required"},
+		{"correlation traversal", "/api/correlation?symbols=AAPL," + url.QueryEscape("../MSFT"), "symbols"},
+		{"correlation blank", "/api/correlation?symbols=AAPL," + url.QueryEscape("  "), "At least two symbols"},
+		{"beta benchmark traversal", "/api/beta/AAPL?benchmark=" + url.QueryEscape("../SPY"), "benchmark"},
+		{"beta benchmark slash", "/api/beta/AAPL?benchmark=" + url.QueryEscape("SPY/x"), "benchmark"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(mux, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", rec.Code, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tc.want) {
+				t.Errorf("error %s doesn't mention %q", rec.Body, tc.want)
+			}
+		})
+	}
+
+	// Surrounding space and case are normalized away rather than rejected
+	rec := serve(mux, httptest.NewRequest(http.MethodGet, "/api/quotes?symbols="+url.QueryEscape(" aapl ,msft"), nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"AAPL"`) {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAnalysisBenchmarkValidated(t *testing.T) {
+	s, _ := newTestServer(t)
+	for _, requested := range []string{"../SPY", "SPY/../x", "SPY?x=1"} {
+		if _, err := s.analysisBenchmark("AAPL", requested); err == nil {
+			t.Errorf("benchmark %q accepted", requested)
+		}
+	}
+	if benchmark, err := s.analysisBenchmark("AAPL", " qqq "); err != nil || benchmark != "QQQ" {
+		t.Errorf("benchmark = %q, %v; want QQQ", benchmark, err)
+	}
+	if benchmark, err := s.analysisBenchmark("SPY", "spy"); err != nil || benchmark != "" {
+		t.Errorf("benchmark against itself = %q, %v; want none", benchmark, err)
+	}
+}
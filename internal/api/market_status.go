@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// handleMarketStatus reports whether the market is open and when it next opens and
+// closes (GET /api/market-status?exchange=NASDAQ, default NYSE). CRYPTO is always open.
+func (s *Server) handleMarketStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	exchange := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("exchange")))
+	if exchange == "" {
+		exchange = market.DefaultExchange
+	}
+	if !slices.Contains(market.Exchanges, exchange) && exchange != market.CryptoExchange {
+		respondError(w, http.StatusBadRequest, "Exchange must be one of "+strings.Join(market.Exchanges, ", ")+" or "+market.CryptoExchange)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, marketStatus(time.Now(), exchange))
+}
+
+// marketStatus describes exchange's trading state at now
+func marketStatus(now time.Time, exchange string) models.MarketStatus {
+	return models.MarketStatus{
+		Exchange:      exchange,
+		Open:          market.IsMarketOpen(now, exchange),
+		ExtendedHours: market.ExtendedHours,
+		NextOpen:      market.NextMarketOpen(now, exchange),
+		NextClose:     market.NextMarketClose(now, exchange),
+	}
+}
+
+// marketWindowRecheck is how often a paused stream looks again at whether a profile has
+// turned on extended hours since the last session boundary
+const marketWindowRecheck = 5 * time.Minute
+
+// marketIdle reports whether background market data work should pause because the
+// market is closed and MARKET_HOURS_ONLY is set
+func (s *Server) marketIdle(now time.Time) bool {
+	return s.config.MarketHoursOnly && !market.IsSessionOpen(now, market.DefaultExchange, s.extendedHoursWanted())
+}
+
+// extendedHoursWanted reports whether the pre- and post-market windows count as open
+// for background work: with MARKET_EXTENDED_HOURS, or when any profile includes extended hours
+// in its analyses and alerts
+func (s *Server) extendedHoursWanted() bool {
+	if market.ExtendedHours {
+		return true
+	}
+	wanted, err := s.db.AnyExtendedHours()
+	if err != nil {
+		slog.Warn("checking profiles for extended hours failed", "error", err)
+	}
+	return wanted
+}
+
+// streamQuotesWhileOpen runs a provider's quote stream. With MARKET_HOURS_ONLY set,
+// stock symbols are dropped from the stream while the market is closed so no quota is
+// spent on them overnight; crypto pairs trade around the clock and keep streaming. The
+// window widens to the pre- and post-market sessions while a profile includes extended
+// hours. Each change in the market's status is reported through status.
+func (s *Server) streamQuotesWhileOpen(ctx context.Context, provider market.Provider, sub *market.Subscription, ch chan<- models.Quote, status func(models.MarketStatus)) error {
+	if !s.config.MarketHoursOnly {
+		return provider.StreamQuotes(ctx, sub, ch)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var open atomic.Bool
+	gated, refresh := sub.Filter(ctx, func(symbol string) bool { return open.Load() || market.IsCrypto(symbol) })
+	streamErr := make(chan error, 1)
+	go func() { streamErr <- provider.StreamQuotes(ctx, gated, ch) }()
+
+	var last models.MarketStatus
+	for first := true; ; first = false {
+		now := time.Now()
+		if current := marketStatus(now, market.DefaultExchange); first || current != last {
+			status(current)
+			last = current
+		}
+		extended := s.extendedHoursWanted()
+		if streaming := market.IsSessionOpen(now, market.DefaultExchange, extended); first || streaming != open.Load() {
+			open.Store(streaming)
+			refresh()
+		}
+
+		wait := time.Until(market.NextSessionChange(now, market.DefaultExchange, extended))
+		if !market.ExtendedHours {
+			wait = min(wait, marketWindowRecheck)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case err := <-streamErr:
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// metricsWindow is how far back the counts and latency percentiles of /api/metrics reach
+const metricsWindow = time.Hour
+
+// metricsBucketWidth is the span of each per-series count bucket
+const metricsBucketWidth = time.Minute
+
+// metricsBuckets is how many count buckets cover metricsWindow
+const metricsBuckets = int64(metricsWindow / metricsBucketWidth)
+
+// metricsMaxSamples caps the latencies kept per series; a busier series' percentiles
+// cover its most recent samples
+const metricsMaxSamples = 1024
+
+// maxMetricSeries caps how many endpoints and providers are tracked, so the collector
+// stays bounded whatever names it is handed
+const maxMetricSeries = 512
+
+// metricKind is what a metric series measures
+type metricKind int
+
+const (
+	metricEndpoint metricKind = iota // API requests, named "METHOD /route/pattern"
+	metricAI                         // AI analysis calls, named by provider
+	metricMarket                     // market data HTTP calls, named by provider
+)
+
+// metricOutcome classifies a recorded call
+type metricOutcome int
+
+const (
+	outcomeOK metricOutcome = iota
+	outcomeClientError
+	outcomeError
+)
+
+// metricKey identifies a metric series
+type metricKey struct {
+	kind metricKind
+	name string
+}
+
+// metricBucket counts one series' calls within a metricsBucketWidth slot
+type metricBucket struct {
+	slot                        int64
+	count, errors, clientErrors int
+}
+
+// metricSample is one call's latency, stamped in Unix nanoseconds
+type metricSample struct {
+	at      int64
+	latency time.Duration
+}
+
+// metricSeries holds one endpoint's or provider's window counts, a ring of recent
+// latencies and running totals
+type metricSeries struct {
+	buckets     [metricsBuckets]metricBucket
+	samples     [metricsMaxSamples]metricSample
+	next        int // ring slot for the next sample
+	total       uint64
+	totalErrors uint64
+	latencySum  time.Duration // over every call, for Prometheus summaries
+}
+
+// metricsCollector keeps request, AI and market call metrics in memory. It is safe for
+// concurrent use and its size is bounded by maxMetricSeries.
+type metricsCollector struct {
+	since  time.Time
+	series map[metricKey]*metricSeries
+	mu     sync.Mutex
+}
+
+func newMetricsCollector() *metricsCollector {
+	return &metricsCollector{since: time.Now(), series: make(map[metricKey]*metricSeries)}
+}
+
+// record adds one call to a series; new series past maxMetricSeries are dropped
+func (c *metricsCollector) record(kind metricKind, name string, latency time.Duration, outcome metricOutcome) {
+	now := time.Now()
+	slot := now.UnixNano() / int64(metricsBucketWidth)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := metricKey{kind, name}
+	s, ok := c.series[key]
+	if !ok {
+		if len(c.series) >= maxMetricSeries {
+			return
+		}
+		s = &metricSeries{}
+		c.series[key] = s
+	}
+
+	b := &s.buckets[slot%metricsBuckets]
+	if b.slot != slot {
+		*b = metricBucket{slot: slot}
+	}
+	b.count++
+	switch outcome {
+	case outcomeError:
+		b.errors++
+		s.totalErrors++
+	case outcomeClientError:
+		b.clientErrors++
+	}
+
+	s.samples[s.next] = metricSample{at: now.UnixNano(), latency: latency}
+	s.next = (s.next + 1) % metricsMaxSamples
+	s.total++
+	s.latencySum += latency
+}
+
+// metricEntry is a series' stats at one moment, with what Prometheus needs besides
+type metricEntry struct {
+	kind       metricKind
+	stats      models.MetricStats
+	latencySum time.Duration
+}
+
+// collect summarizes every series, sorted by kind then name
+func (c *metricsCollector) collect() []metricEntry {
+	now := time.Now()
+	slot := now.UnixNano() / int64(metricsBucketWidth)
+	cutoff := now.Add(-metricsWindow).UnixNano()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]metricEntry, 0, len(c.series))
+	latencies := make([]time.Duration, 0, metricsMaxSamples)
+	for key, s := range c.series {
+		stats := models.MetricStats{Name: key.name, Total: s.total, TotalErrors: s.totalErrors}
+		for _, b := range s.buckets {
+			if b.slot > slot-metricsBuckets {
+				stats.Count += b.count
+				stats.Errors += b.errors
+				stats.ClientErrors += b.clientErrors
+			}
+		}
+
+		latencies = latencies[:0]
+		for _, sample := range s.samples {
+			if sample.at > cutoff {
+				latencies = append(latencies, sample.latency)
+			}
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		stats.P50Ms = durationMs(percentileDuration(latencies, 0.50))
+		stats.P95Ms = durationMs(percentileDuration(latencies, 0.95))
+
+		entries = append(entries, metricEntry{kind: key.kind, stats: stats, latencySum: s.latencySum})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].kind != entries[j].kind {
+			return entries[i].kind < entries[j].kind
+		}
+		return entries[i].stats.Name < entries[j].stats.Name
+	})
+	return entries
+}
+
+// snapshot returns the collector's metrics grouped by kind
+func (c *metricsCollector) snapshot() models.MetricsSnapshot {
+	snap := models.MetricsSnapshot{
+		WindowSeconds: int(metricsWindow / time.Second),
+		Since:         c.since,
+		Endpoints:     []models.MetricStats{},
+		AI:            []models.MetricStats{},
+		Market:        []models.MetricStats{},
+	}
+	for _, e := range c.collect() {
+		switch e.kind {
+		case metricEndpoint:
+			snap.Endpoints = append(snap.Endpoints, e.stats)
+		case metricAI:
+			snap.AI = append(snap.AI, e.stats)
+		case metricMarket:
+			snap.Market = append(snap.Market, e.stats)
+		}
+	}
+	return snap
+}
+
+// percentileDuration returns the nearest-rank q-th percentile of sorted latencies
+func percentileDuration(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+// durationMs converts d to milliseconds, rounded to the microsecond
+func durationMs(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// metricMethods are the request methods endpoint series are split by; anything else
+// is counted as OTHER so clients can't mint series
+var metricMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// statusOutcome classifies an API response status
+func statusOutcome(status int) metricOutcome {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return outcomeError
+	case status >= http.StatusBadRequest:
+		return outcomeClientError
+	}
+	return outcomeOK
+}
+
+// instrument records each request to the route pattern's metrics, split by method
+func (s *Server) instrument(pattern string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		handler(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		method := r.Method
+		if !metricMethods[method] {
+			method = "OTHER"
+		}
+		s.metrics.record(metricEndpoint, method+" "+pattern, time.Since(start), statusOutcome(rec.status))
+	}
+}
+
+// recordAICall records the latency and outcome of one AI analysis call
+func (s *Server) recordAICall(provider string, latency time.Duration, err error) {
+	outcome := outcomeOK
+	if err != nil {
+		outcome = outcomeError
+	}
+	s.metrics.record(metricAI, provider, latency, outcome)
+}
+
+// RecordMarketCall records one market data HTTP call, retries included; status is 0
+// when no response arrived. Failures and throttling count as errors, other 4xx
+// responses as client errors. It is installed as market.CallRecorder at startup.
+func (s *Server) RecordMarketCall(provider string, status int, latency time.Duration, err error) {
+	outcome := statusOutcome(status)
+	if err != nil || status == http.StatusTooManyRequests {
+		outcome = outcomeError
+	}
+	s.metrics.record(metricMarket, provider, latency, outcome)
+}
+
+// handleMetrics returns per-endpoint request metrics and AI and market call latencies
+// over the last hour, plus totals since startup (GET /api/metrics)
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+	respondJSON(w, http.StatusOK, s.metrics.snapshot())
+}
+
+// handlePrometheusMetrics serves the metrics in the Prometheus text format (GET
+// /metrics, registered when METRICS_PROMETHEUS is set)
+func (s *Server) handlePrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writePrometheusMetrics(w, s.metrics.collect())
+}
+
+// prometheusFamily names the Prometheus metrics of one metric kind: <prefix>s_total,
+// <prefix>_errors_total and the <prefix>_duration_seconds summary
+type prometheusFamily struct {
+	prefix string
+	help   string
+	labels func(name string) string
+}
+
+var prometheusFamilies = []struct {
+	kind metricKind
+	prometheusFamily
+}{
+	{metricEndpoint, prometheusFamily{"stockai_http_request", "API requests", endpointLabels}},
+	{metricAI, prometheusFamily{"stockai_ai_call", "AI analysis calls", providerLabels}},
+	{metricMarket, prometheusFamily{"stockai_market_call", "market data HTTP calls", providerLabels}},
+}
+
+// endpointLabels splits an endpoint series name into method and route labels
+func endpointLabels(name string) string {
+	method, route, _ := strings.Cut(name, " ")
+	return fmt.Sprintf(`method="%s",route="%s"`, prometheusEscape(method), prometheusEscape(route))
+}
+
+// providerLabels labels a provider series
+func providerLabels(name string) string {
+	return fmt.Sprintf(`provider="%s"`, prometheusEscape(name))
+}
+
+var prometheusEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusEscape escapes a label value
+func prometheusEscape(v string) string {
+	return prometheusEscaper.Replace(v)
+}
+
+// writePrometheusMetrics writes entries as Prometheus counters and latency summaries.
+// Totals count since startup; the quantiles cover the last metricsWindow.
+func writePrometheusMetrics(w io.Writer, entries []metricEntry) {
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	for _, family := range prometheusFamilies {
+		var series []metricEntry
+		for _, e := range entries {
+			if e.kind == family.kind {
+				series = append(series, e)
+			}
+		}
+
+		fmt.Fprintf(out, "# HELP %ss_total %s since startup.\n# TYPE %ss_total counter\n", family.prefix, family.help, family.prefix)
+		for _, e := range series {
+			fmt.Fprintf(out, "%ss_total{%s} %d\n", family.prefix, family.labels(e.stats.Name), e.stats.Total)
+		}
+		fmt.Fprintf(out, "# HELP %s_errors_total Failed %s since startup.\n# TYPE %s_errors_total counter\n", family.prefix, family.help, family.prefix)
+		for _, e := range series {
+			fmt.Fprintf(out, "%s_errors_total{%s} %d\n", family.prefix, family.labels(e.stats.Name), e.stats.TotalErrors)
+		}
+		fmt.Fprintf(out, "# HELP %s_duration_seconds Latency of %s; quantiles cover the last %s.\n# TYPE %s_duration_seconds summary\n",
+			family.prefix, family.help, metricsWindow, family.prefix)
+		for _, e := range series {
+			labels := family.labels(e.stats.Name)
+			fmt.Fprintf(out, "%s_duration_seconds{%s,quantile=\"0.5\"} %g\n", family.prefix, labels, e.stats.P50Ms/1000)
+			fmt.Fprintf(out, "%s_duration_seconds{%s,quantile=\"0.95\"} %g\n", family.prefix, labels, e.stats.P95Ms/1000)
+			fmt.Fprintf(out, "%s_duration_seconds_sum{%s} %g\n", family.prefix, labels, e.latencySum.Seconds())
+			fmt.Fprintf(out, "%s_duration_seconds_count{%s} %d\n", family.prefix, labels, e.stats.Total)
+		}
+	}
+}
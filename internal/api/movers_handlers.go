@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// maxMoversAutoAnalyze caps how many movers one request may queue for analysis
+const maxMoversAutoAnalyze = 10
+
+// moversEntry is a cached movers list
+type moversEntry struct {
+	movers    []models.Mover
+	fetchedAt time.Time
+}
+
+// handleMovers returns the day's top gainers, losers or most active stocks.
+// ?analyze=N queues background analyses of the top N movers.
+func (s *Server) handleMovers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	moverType := r.URL.Query().Get("type")
+	if moverType == "" {
+		moverType = market.MoversGainers
+	}
+	if moverType != market.MoversGainers && moverType != market.MoversLosers && moverType != market.MoversMostActive {
+		respondError(w, http.StatusBadRequest, "Type must be 'gainers', 'losers' or 'most_active'")
+		return
+	}
+
+	analyzeN := 0
+	if v := r.URL.Query().Get("analyze"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxMoversAutoAnalyze {
+			respondError(w, http.StatusBadRequest, "analyze must be between 0 and "+strconv.Itoa(maxMoversAutoAnalyze))
+			return
+		}
+		analyzeN = n
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	movers, err := s.movers(ctx, provider, moverType)
+	if err == market.ErrNotSupported {
+		respondError(w, http.StatusNotImplemented, "Movers are not available from "+provider.Name())
+		return
+	}
+	if err != nil {
+		respondErr(w, http.StatusBadGateway, err)
+		return
+	}
+
+	var queued []string
+	for i := 0; i < analyzeN && i < len(movers); i++ {
+		queued = append(queued, movers[i].Symbol)
+	}
+	if len(queued) > 0 {
+		s.enqueueAnalyses(cfg.ID, queued)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"type":      moverType,
+		"provider":  provider.Name(),
+		"movers":    movers,
+		"analyzing": queued,
+	})
+}
+
+// movers returns a movers list, served from a short-lived cache
+func (s *Server) movers(ctx context.Context, provider market.Provider, moverType string) ([]models.Mover, error) {
+	key := provider.Name() + ":" + moverType
+
+	s.moversMu.Lock()
+	entry, ok := s.moversCache[key]
+	s.moversMu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < s.config.MoversCacheTTL {
+		return entry.movers, nil
+	}
+
+	mp, ok := provider.(market.MoversProvider)
+	if !ok {
+		return nil, market.ErrNotSupported
+	}
+	movers, err := mp.GetMovers(ctx, moverType)
+	if err != nil {
+		return nil, err
+	}
+
+	s.moversMu.Lock()
+	s.moversCache[key] = moversEntry{movers: movers, fetchedAt: time.Now()}
+	s.moversMu.Unlock()
+	return movers, nil
+}
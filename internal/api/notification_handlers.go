@@ -1,24 +1,35 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"stockmarket/internal/config"
+	"stockmarket/internal/db"
 	"stockmarket/internal/models"
+	"stockmarket/internal/notify"
 )
 
 func (s *Server) handleNotificationChannels(w http.ResponseWriter, r *http.Request) {
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondErr(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	switch r.Method {
 	case http.MethodGet:
-		respondJSON(w, http.StatusOK, cfg.NotificationChannels)
+		respondJSON(w, http.StatusOK, s.maskChannels(cfg.NotificationChannels))
 
 	case http.MethodPost:
 		var channel models.NotificationConfig
@@ -31,13 +42,25 @@ func (s *Server) handleNotificationChannels(w http.ResponseWriter, r *http.Reque
 			respondError(w, http.StatusBadRequest, "Type and target required")
 			return
 		}
+		if msg := channelError(s.notifyService, channel); msg != "" {
+			respondError(w, http.StatusBadRequest, msg)
+			return
+		}
+		if channel.Symbols, err = normalizeSymbolFilter(channel.Symbols); err != nil {
+			respondErr(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.sealChannel(&channel); err != nil {
+			respondError(w, http.StatusInternalServerError, FAILED_TO_ENCRYPT_API_KEY)
+			return
+		}
 
 		if err := s.db.SaveNotificationChannel(cfg.ID, &channel); err != nil {
-			respondError(w, http.StatusInternalServerError, err.Error())
+			respondErr(w, http.StatusInternalServerError, err)
 			return
 		}
 
-		respondJSON(w, http.StatusCreated, channel)
+		respondJSON(w, http.StatusCreated, s.maskChannels([]models.NotificationConfig{channel})[0])
 
 	case http.MethodPut:
 		var channel models.NotificationConfig
@@ -50,13 +73,37 @@ func (s *Server) handleNotificationChannels(w http.ResponseWriter, r *http.Reque
 			respondError(w, http.StatusBadRequest, "Channel ID required")
 			return
 		}
+		// A blank or masked bot token, as GET returns it, keeps the stored one
+		if channel.Telegram != nil && (channel.Telegram.BotToken == "" || strings.Contains(channel.Telegram.BotToken, "****")) {
+			for _, existing := range cfg.NotificationChannels {
+				if existing.ID == channel.ID {
+					channel.Telegram = existing.Telegram
+				}
+			}
+		}
+		if msg := channelError(s.notifyService, channel); msg != "" {
+			respondError(w, http.StatusBadRequest, msg)
+			return
+		}
+		if channel.Symbols, err = normalizeSymbolFilter(channel.Symbols); err != nil {
+			respondErr(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.sealChannel(&channel); err != nil {
+			respondError(w, http.StatusInternalServerError, FAILED_TO_ENCRYPT_API_KEY)
+			return
+		}
 
 		if err := s.db.SaveNotificationChannel(cfg.ID, &channel); err != nil {
-			respondError(w, http.StatusInternalServerError, err.Error())
+			if errors.Is(err, sql.ErrNoRows) {
+				respondError(w, http.StatusNotFound, "Channel not found")
+				return
+			}
+			respondErr(w, http.StatusInternalServerError, err)
 			return
 		}
 
-		respondJSON(w, http.StatusOK, channel)
+		respondJSON(w, http.StatusOK, s.maskChannels([]models.NotificationConfig{channel})[0])
 
 	default:
 		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
@@ -77,12 +124,221 @@ func (s *Server) handleNotificationChannelDelete(w http.ResponseWriter, r *http.
 		return
 	}
 
-	if err := s.db.DeleteNotificationChannel(id); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.db.DeleteNotificationChannel(id, cfg.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "Channel not found")
+			return
+		}
+		respondErr(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// handleNotificationChannelTest sends a synthetic notification through one saved
+// channel (POST /api/notification-channels/{id}/test) and reports whether it was
+// delivered, or the notifier's error, so channel settings can be checked without
+// waiting for a real alert
+func (s *Server) handleNotificationChannelTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid channel ID")
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var channel *models.NotificationConfig
+	for i := range cfg.NotificationChannels {
+		if cfg.NotificationChannels[i].ID == id {
+			channel = &cfg.NotificationChannels[i]
+			break
+		}
+	}
+	if channel == nil {
+		respondError(w, http.StatusNotFound, "Channel not found")
+		return
+	}
+	if !s.notifyService.HasNotifier(channel.Type) {
+		respondError(w, http.StatusBadRequest, "No notifier registered for channel type: "+channel.Type)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	notification := models.Notification{
+		Type:    "test",
+		Title:   "Test notification",
+		Message: "This is a test from StockAI. If you can read it, your " + channel.Type + " channel is set up correctly.",
+		Symbol:  "TEST",
+		SentAt:  time.Now(),
+	}
+	if err := s.notifyService.SendTest(ctx, notification, s.openChannels([]models.NotificationConfig{*channel})[0]); err != nil {
+		respondErr(w, http.StatusBadGateway, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+}
+
+// defaultNotificationLogLimit is how many delivery outcomes the log returns by default
+const defaultNotificationLogLimit = 50
+
+// recordDelivery stores the outcome of sending a notification to a channel
+func (s *Server) recordDelivery(d models.NotificationDelivery) {
+	if err := s.db.SaveNotificationDelivery(&d); err != nil {
+		slog.Error("failed to record delivery", "type", d.NotificationType, "channel_id", d.ChannelID, "error", err)
+	}
+}
+
+// handleNotificationLog lists recent notification deliveries, newest first, with
+// optional ?limit= and ?status=delivered|failed|queued
+func (s *Server) handleNotificationLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	limit := defaultNotificationLogLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", "delivered", "failed", "queued", "deferred", "suppressed":
+	default:
+		respondError(w, http.StatusBadRequest, "status must be delivered, failed, queued, deferred or suppressed")
+		return
+	}
+
+	deliveries, err := s.db.GetNotificationDeliveries(limit, status)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, deliveries)
+}
+
 // handleProfiles returns available risk and frequency profiles
+
+// normalizeSymbolFilter normalizes a channel's symbol filter, dropping it when it
+// lists nothing
+func normalizeSymbolFilter(filter *models.SymbolFilter) (*models.SymbolFilter, error) {
+	if filter == nil || len(filter.Include) == 0 && len(filter.Exclude) == 0 {
+		return nil, nil
+	}
+	include, err := normalizeSymbols(filter.Include)
+	if err != nil {
+		return nil, fmt.Errorf("symbols.include: %w", err)
+	}
+	exclude, err := normalizeSymbols(filter.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("symbols.exclude: %w", err)
+	}
+	return &models.SymbolFilter{Include: include, Exclude: exclude}, nil
+}
+
+// sealChannel encrypts a Telegram channel's bot token for storage, like the profile's
+// API keys. A token that's already encrypted, such as one from a backup, is kept.
+func (s *Server) sealChannel(channel *models.NotificationConfig) error {
+	if channel.Telegram == nil || !db.PlaintextBotToken(channel.Telegram.BotToken) {
+		return nil
+	}
+	encrypted, err := config.Encrypt(channel.Telegram.BotToken, s.config.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	channel.Telegram = &models.TelegramConfig{BotToken: encrypted}
+	return nil
+}
+
+// openChannels returns copies of channels with their bot tokens decrypted, for sending.
+// A token that can't be decrypted is blanked, so sending to it fails with a missing
+// token instead of calling Telegram with the ciphertext.
+func (s *Server) openChannels(channels []models.NotificationConfig) []models.NotificationConfig {
+	opened := slices.Clone(channels)
+	for i, channel := range opened {
+		if channel.Telegram == nil || db.PlaintextBotToken(channel.Telegram.BotToken) {
+			continue
+		}
+		token, err := s.decryptSecret("telegram bot token", channel.Telegram.BotToken)
+		if err != nil {
+			token = ""
+		}
+		opened[i].Telegram = &models.TelegramConfig{BotToken: token}
+	}
+	return opened
+}
+
+// maskChannels returns copies of channels with their bot tokens masked the way GET
+// /api/config masks API keys, for responses
+func (s *Server) maskChannels(channels []models.NotificationConfig) []models.NotificationConfig {
+	masked := s.openChannels(channels)
+	for i, channel := range masked {
+		if channel.Telegram != nil && channel.Telegram.BotToken != "" {
+			masked[i].Telegram = &models.TelegramConfig{BotToken: maskSecret(channel.Telegram.BotToken)}
+		}
+	}
+	return masked
+}
+
+// maskSecret shows the first and last four characters of a decrypted secret, or "****"
+// for short ones
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return secret[:4] + "****" + secret[len(secret)-4:]
+}
+
+// telegramChatID matches a Telegram chat: a numeric ID (negative for groups) or a public @channelname
+var telegramChatID = regexp.MustCompile(`^(-?[0-9]+|@[A-Za-z][A-Za-z0-9_]{4,31})$`)
+
+// channelError checks that a channel has a registered notifier and a usable target,
+// returning a message when it doesn't
+func channelError(service *notify.Service, channel models.NotificationConfig) string {
+	if !service.HasNotifier(channel.Type) {
+		return "Unknown channel type: " + channel.Type
+	}
+	if (channel.Type == "slack" || channel.Type == "discord") && !strings.HasPrefix(channel.Target, "https://") {
+		return "Target must be an https:// webhook URL for " + channel.Type
+	}
+	if channel.Type == "webhook" {
+		if !strings.HasPrefix(channel.Target, "https://") && !strings.HasPrefix(channel.Target, "http://") {
+			return "Target must be an http:// or https:// URL for webhook"
+		}
+		if err := notify.ValidateWebhookConfig(channel.Webhook); err != nil {
+			return err.Error()
+		}
+	}
+	if channel.Type == "telegram" {
+		if !telegramChatID.MatchString(channel.Target) {
+			return "Target must be a numeric chat ID or @channelname for telegram"
+		}
+		if channel.Telegram == nil || strings.TrimSpace(channel.Telegram.BotToken) == "" {
+			return "telegram.bot_token is required for telegram"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"stockmarket/internal/models"
+)
+
+// TestChannelsScopedToProfile checks that one profile can't update or delete another
+// profile's notification channels or alerts
+func TestChannelsScopedToProfile(t *testing.T) {
+	s, mux := newTestServer(t)
+	owner := testConfig(t, s)
+	channel := models.NotificationConfig{Type: "discord", Target: "https://discord.com/api/webhooks/1/a", Enabled: true, Events: []string{"buy_signal"}}
+	if err := s.db.SaveNotificationChannel(owner.ID, &channel); err != nil {
+		t.Fatal(err)
+	}
+	alert := models.PriceAlert{ProfileID: owner.ID, Symbol: "AAPL", Condition: "above", Price: 100}
+	if err := s.db.SavePriceAlert(&alert); err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.db.CreateProfile("other", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channelPath := "/api/notification-channels/" + strconv.FormatInt(channel.ID, 10)
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPut, "/api/notification-channels",
+			strings.NewReader(`{"id":`+strconv.FormatInt(channel.ID, 10)+`,"type":"discord","target":"https://discord.com/api/webhooks/2/b","enabled":true,"events":["sell_signal"]}`)),
+		httptest.NewRequest(http.MethodDelete, channelPath, nil),
+		httptest.NewRequest(http.MethodDelete, "/api/alerts/"+strconv.FormatInt(alert.ID, 10), nil),
+		httptest.NewRequest(http.MethodDelete, "/api/alerts/999999", nil),
+	}
+	handler := s.ResolveProfile(mux)
+	for _, r := range requests {
+		r.Header.Set(ProfileHeader, strconv.FormatInt(other.ID, 10))
+		if rec := serve(handler, r); rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s as another profile: status %d, want 404: %s", r.Method, r.URL.Path, rec.Code, rec.Body)
+		}
+	}
+
+	cfg, err := s.db.GetProfileConfig(owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.NotificationChannels) != 1 || cfg.NotificationChannels[0].Target != channel.Target {
+		t.Fatalf("owner's channels = %+v, want the original channel untouched", cfg.NotificationChannels)
+	}
+	if _, err := s.db.GetPriceAlert(alert.ID, owner.ID); err != nil {
+		t.Fatalf("owner's alert: %v", err)
+	}
+
+	if rec := serve(mux, httptest.NewRequest(http.MethodDelete, channelPath, nil)); rec.Code != http.StatusOK {
+		t.Fatalf("owner deleting its channel: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+// TestTelegramBotTokenEncrypted checks that bot tokens are stored encrypted, masked in
+// every response and decrypted for sending
+func TestTelegramBotTokenEncrypted(t *testing.T) {
+	s, mux := newTestServer(t)
+	const token = "123456:ABC-DEF1234ghIkl-zyx57W2v1u123ew11"
+
+	rec := serve(mux, httptest.NewRequest(http.MethodPost, "/api/notification-channels",
+		strings.NewReader(`{"type":"telegram","target":"-1001234","enabled":true,"events":["buy_signal"],"telegram":{"bot_token":"`+token+`"}}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), token) {
+		t.Errorf("create response leaks the bot token: %s", rec.Body)
+	}
+
+	stored := testConfig(t, s).NotificationChannels
+	if len(stored) != 1 || stored[0].Telegram == nil || strings.Contains(stored[0].Telegram.BotToken, token) {
+		t.Fatalf("stored channels = %+v, want the bot token encrypted", stored)
+	}
+	if opened := s.openChannels(stored); opened[0].Telegram.BotToken != token {
+		t.Errorf("decrypted bot token = %q, want %q", opened[0].Telegram.BotToken, token)
+	}
+
+	for _, path := range []string{"/api/notification-channels", "/api/config"} {
+		rec := serve(mux, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %s", path, rec.Code, rec.Body)
+		}
+		body := rec.Body.String()
+		if strings.Contains(body, token) || strings.Contains(body, stored[0].Telegram.BotToken) {
+			t.Errorf("GET %s leaks the bot token: %s", path, body)
+		}
+		if !strings.Contains(body, "1234****ew11") {
+			t.Errorf("GET %s doesn't show the masked bot token: %s", path, body)
+		}
+	}
+
+	// Sending back the masked token keeps the stored one
+	id := strconv.FormatInt(stored[0].ID, 10)
+	rec = serve(mux, httptest.NewRequest(http.MethodPut, "/api/notification-channels",
+		strings.NewReader(`{"id":`+id+`,"type":"telegram","target":"-1005678","enabled":true,"events":["buy_signal"],"telegram":{"bot_token":"1234****ew11"}}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status %d: %s", rec.Code, rec.Body)
+	}
+	if opened := s.openChannels(testConfig(t, s).NotificationChannels); opened[0].Telegram.BotToken != token || opened[0].Target != "-1005678" {
+		t.Errorf("after update channel = %+v, want the new target and the original token", opened[0])
+	}
+}
+
+// TestNotificationChannelTestRoute checks that channel tests have their own route,
+// separate from deleting a channel
+func TestNotificationChannelTestRoute(t *testing.T) {
+	_, mux := newTestServer(t)
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPost, "/api/notification-channels/999/test", http.StatusNotFound},
+		{http.MethodPost, "/api/notification-channels/abc/test", http.StatusBadRequest},
+		{http.MethodDelete, "/api/notification-channels/999/test", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/notification-channels/999", http.StatusMethodNotAllowed},
+	} {
+		if rec := serve(mux, httptest.NewRequest(tc.method, tc.path, nil)); rec.Code != tc.want {
+			t.Errorf("%s %s: status %d, want %d: %s", tc.method, tc.path, rec.Code, tc.want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// Content types of non-JSON responses
+const (
+	contentTypeHTML  = "text/html"
+	contentTypeForm  = "application/x-www-form-urlencoded"
+	contentTypeSSE   = "text/event-stream"
+	contentTypeJSONL = "application/x-ndjson"
+	contentTypeCSV   = "text/csv"
+)
+
+// openAPIParam is a query parameter of an operation. Path parameters come from the
+// {name} segments of the path: {id} is an integer, anything else a string.
+type openAPIParam struct {
+	name        string
+	typ         string // JSON schema type; "" is a string
+	description string
+}
+
+// openAPIOperation describes one method on one path. body and response are zero values
+// of the JSON shapes sent and returned, reflected into schemas through their json tags;
+// a nil response is a JSON object. produces and consumes override JSON for HTML
+// fragments, streams, downloads and form posts.
+type openAPIOperation struct {
+	method      string
+	path        string
+	summary     string
+	query       []openAPIParam
+	body        interface{}
+	response    interface{}
+	consumes    string
+	produces    string
+	status      int // success status; 0 is 200
+	description string
+}
+
+// statusResponse is the {"status": ...} reply of deletes, restores and tests
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+// errorResponse is the body respondError sends
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"` // machine-readable error class, e.g. "rate_limited"; see internal/apperr
+}
+
+// Query parameters shared by several operations
+var (
+	includeDeletedParam = openAPIParam{"include_deleted", "boolean", "Include soft-deleted entries that haven't been purged yet"}
+	periodParam         = openAPIParam{"period", "", "1d, 5d, 1m, 3m, 6m, 1y or 5y"}
+	fromParam           = openAPIParam{"from", "", "Start date (YYYY-MM-DD) or RFC 3339 time"}
+	toParam             = openAPIParam{"to", "", "End date (YYYY-MM-DD, inclusive) or RFC 3339 time"}
+	tagParam            = openAPIParam{"tag", "", "Tag filter; repeat or comma-separate for several"}
+	forceRefreshParam   = openAPIParam{"force_refresh", "boolean", "Refetch historical data from the provider instead of the cache"}
+	groupParam          = openAPIParam{"group", "", "Only the symbols in this watchlist group (Ungrouped for those in none)"}
+)
+
+// openAPIOperations lists every API operation. A route added to SetupRoutes must be
+// described here too; SetupRoutes warns about any that isn't.
+var openAPIOperations = []openAPIOperation{
+	{method: "GET", path: "/api/health", summary: "Health check with build version, database status and cache counts",
+		query: []openAPIParam{{"deep", "boolean", "Also quote the saved market provider"}}},
+	{method: "GET", path: "/api/openapi.json", summary: "This OpenAPI document"},
+
+	{method: "GET", path: "/api/config", summary: "Current settings", response: models.UserConfig{}},
+	{method: "PUT", path: "/api/config", summary: "Update settings; a stale version gets 409 Conflict",
+		body: configUpdate{}, response: struct {
+			Status  string `json:"status"`
+			Version int64  `json:"version"`
+		}{}},
+	{method: "POST", path: "/api/config/market", summary: "Save the market data provider (settings form)", consumes: contentTypeForm, produces: contentTypeHTML},
+	{method: "POST", path: "/api/config/ai", summary: "Save the AI provider and model (settings form)", consumes: contentTypeForm, produces: contentTypeHTML},
+	{method: "POST", path: "/api/config/strategy", summary: "Save risk tolerance and trade frequency (settings form)", consumes: contentTypeForm, produces: contentTypeHTML},
+	{method: "POST", path: "/api/config/watchlist", summary: "Add a symbol to the watchlist (settings form)", consumes: contentTypeForm, produces: contentTypeHTML},
+	{method: "DELETE", path: "/api/config/watchlist/{symbol}", summary: "Remove a symbol from the watchlist", produces: contentTypeHTML},
+	{method: "GET", path: "/api/watchlist/groups", summary: "Watchlist groups with their tracked symbols, then Ungrouped", response: []models.WatchlistGroup{}},
+	{method: "POST", path: "/api/watchlist/groups", summary: "Create a watchlist group, moving its symbols out of other groups; 409 Conflict if the name is taken",
+		body: watchlistGroupInput{}, response: models.WatchlistGroup{}, status: http.StatusCreated},
+	{method: "PUT", path: "/api/watchlist/groups/{name}", summary: "Rename a watchlist group or replace its symbols", body: watchlistGroupInput{}, response: models.WatchlistGroup{}},
+	{method: "DELETE", path: "/api/watchlist/groups/{name}", summary: "Delete a watchlist group; its symbols stay tracked, ungrouped", response: statusResponse{}},
+	{method: "POST", path: "/api/watchlist/groups/{name}/analyze", summary: "Queue an analysis job for each of a watchlist group's symbols", status: http.StatusAccepted},
+	{method: "POST", path: "/api/config/polling", summary: "Save the polling interval and extended hours (settings form)", consumes: contentTypeForm, produces: contentTypeHTML},
+	{method: "POST", path: "/api/config/notifications", summary: "Save notification preferences (settings form)", consumes: contentTypeForm, produces: contentTypeHTML},
+	{method: "GET", path: "/api/config/profiles", summary: "Configuration profiles and the active_id"},
+	{method: "POST", path: "/api/config/profiles", summary: "Create a profile; 409 Conflict if the name is taken",
+		body: struct {
+			Name string `json:"name"`
+		}{}, response: models.Profile{}, status: http.StatusCreated},
+	{method: "POST", path: "/api/config/profiles/switch", summary: "Make a profile the web UI's active one",
+		body: struct {
+			ID int64 `json:"id"`
+		}{}, response: models.Profile{}},
+
+	{method: "GET", path: "/api/quote/{symbol}", summary: "Latest quote", response: models.Quote{}},
+	{method: "GET", path: "/api/quotes", summary: "Batch quotes keyed by symbol, with failed symbols under errors",
+		query: []openAPIParam{{"symbols", "", "Comma-separated symbols"}, groupParam}, response: struct {
+			Quotes map[string]models.Quote `json:"quotes"`
+			Errors map[string]string       `json:"errors,omitempty"`
+		}{}},
+	{method: "GET", path: "/api/historical/{symbol}", summary: "Candles over a period, newest first",
+		query:    []openAPIParam{periodParam, {"interval", "", "1min, 5min, 15min, 30min, 60min or daily"}, {"adjusted", "boolean", "Split- and dividend-adjusted prices"}, forceRefreshParam},
+		response: []models.Candle{}},
+	{method: "GET", path: "/api/levels/{symbol}", summary: "Support and resistance levels", query: []openAPIParam{periodParam}},
+	{method: "GET", path: "/api/vwap/{symbol}", summary: "Current-session VWAP and the distance of the latest price from it"},
+	{method: "GET", path: "/api/beta/{symbol}", summary: "Beta of daily returns against a benchmark",
+		query: []openAPIParam{periodParam, {"benchmark", "", "Benchmark symbol (default BENCHMARK_SYMBOL)"}}},
+	{method: "GET", path: "/api/correlation", summary: "Pairwise correlation of daily returns",
+		query: []openAPIParam{{"symbols", "", "Comma-separated symbols (default the watchlist)"}, periodParam}},
+	{method: "GET", path: "/api/transcript/{symbol}", summary: "Earnings-call transcript (Alpha Vantage only)",
+		query: []openAPIParam{{"quarter", "", "Quarter such as 2024Q1"}}, response: models.EarningsTranscript{}},
+	{method: "GET", path: "/api/metrics", summary: "Per-endpoint request counts, errors and p50/p95 latency, and AI and market call latency, over the last hour",
+		response: models.MetricsSnapshot{}},
+	{method: "GET", path: "/api/provider-health", summary: "Up/down state of each market data provider", response: []models.ProviderHealth{}},
+	{method: "GET", path: "/api/providers", summary: "Supported market data and AI providers"},
+	{method: "POST", path: "/api/validate-key", summary: "Check a provider API key with a cheap authenticated call, without saving it",
+		body: validateKeyInput{}, response: validateKeyResult{}},
+	{method: "GET", path: "/api/market-status", summary: "Whether an exchange is open, with its next open and close",
+		query: []openAPIParam{{"exchange", "", "NYSE, NASDAQ or CRYPTO"}}, response: models.MarketStatus{}},
+	{method: "GET", path: "/api/dashboard", summary: "Watchlist quotes with today's signal and active alert counts", query: []openAPIParam{groupParam}, response: dashboardResponse{}},
+	{method: "GET", path: "/api/overview", summary: "Every tracked symbol's quote and latest analysis, group by group", query: []openAPIParam{groupParam}, response: models.MarketOverview{}},
+	{method: "GET", path: "/api/movers", summary: "Top gainers, losers or most active symbols",
+		query: []openAPIParam{{"type", "", "gainers, losers or most_active"}, {"analyze", "integer", "Analyze the top N in the background"}}},
+	{method: "GET", path: "/api/search", summary: "Search for symbols by ticker or company name",
+		query: []openAPIParam{{"q", "", "Ticker or company name, e.g. apple"}, {"limit", "integer", "Maximum matches (default 10, at most 50)"}}, response: SymbolSearchResult{}},
+	{method: "GET", path: "/api/sectors", summary: "Daily and weekly return of each sector ETF", response: []models.SectorPerformance{}},
+	{method: "GET", path: "/api/dividend-screen", summary: "Watchlist symbols by dividend yield",
+		query: []openAPIParam{{"min_yield", "number", "Minimum yield (%)"}, {"max_payout", "number", "Maximum payout ratio (%)"}, {"min_increase_years", "integer", "Minimum years of dividend increases"}}},
+
+	{method: "POST", path: "/api/analyze/{symbol}", summary: "Run an AI analysis",
+		query: []openAPIParam{{"fresh", "boolean", "Skip the analysis cache"}, {"multi_timeframe", "boolean", "Analyze daily, weekly and monthly data"}, {"dry_run", "boolean", "Don't save, forward or notify the analysis"},
+			{"async", "boolean", "Start the analysis as a job and return the job with a 202"}, forceRefreshParam},
+		body: analyzeInput{}, response: models.AnalysisResponse{}},
+	{method: "GET", path: "/api/analyze/jobs/{job}", summary: "Status and result of an analysis job", response: analysisJobView{}},
+	{method: "DELETE", path: "/api/analyze/jobs/{job}", summary: "Cancel a running analysis job; it isn't saved or notified", response: analysisJobView{}},
+	{method: "GET", path: "/api/analyze/{symbol}/stream", summary: "Run an analysis and stream the AI reply as server-sent events",
+		query: []openAPIParam{{"detail_level", "", "brief, standard or detailed"}, {"benchmark", "", "Benchmark compared against (default BENCHMARK_SYMBOL)"}, {"market_data_provider", "", "Market provider override"},
+			{"ai_provider", "", "AI provider override"}, {"ai_model", "", "AI model override"}, {"user_context", "", "Extra context for the prompt"},
+			{"include_transcript", "boolean", "Add the latest earnings call to the prompt"}, {"dry_run", "boolean", "Don't save, forward or notify the analysis"}, tagParam},
+		produces:    contentTypeSSE,
+		description: "token events carry reply text, retry marks a retried attempt, and the stream ends with a result event (the analysis) or an error event."},
+	{method: "POST", path: "/api/analyze/{symbol}/preview", summary: "Build the analysis prompt without calling the AI",
+		query: []openAPIParam{{"multi_timeframe", "boolean", "Analyze daily, weekly and monthly data"}}, body: analyzeInput{}, response: models.PromptPreview{}},
+	{method: "POST", path: "/api/analyze/portfolio", summary: "Risk review of every tracked symbol, most urgent exits first",
+		query: []openAPIParam{{"save", "boolean", "Save the analyses under a batch tag"}}, response: models.RiskReview{}},
+	{method: "POST", path: "/api/analyze", summary: "Run an analysis from the quick-analyze form", consumes: contentTypeForm, produces: contentTypeHTML},
+	{method: "GET", path: "/api/analyses", summary: "Recent analyses matching every filter",
+		query: []openAPIParam{{"symbol", "", "Symbol"}, {"action", "", "BUY, SELL or HOLD"}, {"min_confidence", "number", "Minimum confidence (0-1)"}, fromParam, toParam, tagParam,
+			{"sort", "", "Sort order"}, {"limit", "integer", "Maximum results"}, includeDeletedParam},
+		response: []models.AnalysisResponse{}},
+	{method: "GET", path: "/api/analyses/{analysis}", summary: "One analysis by its numeric ID, or a symbol's recent analyses",
+		query: []openAPIParam{tagParam, includeDeletedParam}, response: models.AnalysisResponse{},
+		description: "A numeric path segment returns that analysis; a symbol returns an array of its recent analyses."},
+	{method: "DELETE", path: "/api/analyses/{analysis}", summary: "Soft-delete an analysis by its numeric ID", response: statusResponse{}},
+	{method: "POST", path: "/api/analyses/{id}/restore", summary: "Restore a deleted analysis", response: statusResponse{}},
+	{method: "GET", path: "/api/analyses/{id}/debug", summary: "Prompt and raw AI reply of an analysis run with STORE_RAW_PROMPTS", response: models.AnalysisDebug{}},
+	{method: "GET", path: "/api/analyses/{symbol}/timeline", summary: "A symbol's analyses oldest first as chart points",
+		query: []openAPIParam{{"max_points", "integer", "Downsample to at most this many points (at least 2)"}}, response: struct {
+			Symbol string                 `json:"symbol"`
+			Total  int                    `json:"total"`
+			Points []models.TimelinePoint `json:"points"`
+		}{}},
+	{method: "GET", path: "/api/analyses/{symbol}/diff", summary: "What changed between two of a symbol's analyses",
+		query:    []openAPIParam{{"from", "integer", "Baseline analysis ID (default: the one before to)"}, {"to", "integer", "Analysis ID compared against from (default: the latest)"}},
+		response: models.AnalysisDiff{}},
+	{method: "GET", path: "/api/analyses/export", summary: "Download analyses as CSV or JSON",
+		query: []openAPIParam{{"format", "", "csv or json"}, fromParam, toParam}, produces: contentTypeCSV},
+	{method: "GET", path: "/api/usage", summary: "AI token usage and estimated spend per model", query: []openAPIParam{fromParam, toParam}},
+
+	{method: "GET", path: "/api/alerts", summary: "Active alerts", query: []openAPIParam{includeDeletedParam}, response: []models.PriceAlert{}},
+	{method: "POST", path: "/api/alerts", summary: "Create an alert from the alerts form (symbol, condition, target_price)", consumes: contentTypeForm, produces: contentTypeHTML},
+	{method: "PATCH", path: "/api/alerts/{id}", summary: "Edit an alert's condition, thresholds, lifetime or active state; only the fields sent change",
+		body: alertPatch{}, response: models.PriceAlert{},
+		description: "Changing the condition or a threshold re-arms the alert. expires_at takes an RFC 3339 time, or null to remove the expiry."},
+	{method: "DELETE", path: "/api/alerts/{id}", summary: "Soft-delete an alert", produces: contentTypeHTML},
+	{method: "GET", path: "/api/alerts/{id}/history", summary: "Every time an alert fired, newest first, with the market at that moment",
+		query: []openAPIParam{{"limit", "integer", "Maximum results (default 50, at most 500)"}}, response: []models.AlertTrigger{}},
+	{method: "POST", path: "/api/alerts/{id}/restore", summary: "Restore a deleted alert", response: statusResponse{}},
+	{method: "POST", path: "/api/alerts/{id}/mute", summary: "Suppress an alert's notifications for a while",
+		body: struct {
+			Duration string `json:"duration"`
+		}{}, response: struct {
+			Status     string    `json:"status"`
+			MutedUntil time.Time `json:"muted_until"`
+		}{}},
+	{method: "POST", path: "/api/alerts/{id}/unmute", summary: "Resume an alert's notifications", response: statusResponse{}},
+	{method: "POST", path: "/api/alerts/from-analysis/{id}", summary: "Create alerts from an analysis's suggested_alerts",
+		body: struct {
+			Sources []string `json:"sources,omitempty"`
+		}{}, response: []models.PriceAlert{}, status: http.StatusCreated,
+		description: "A suggestion matching an active alert returns that alert instead, with 200 when none were new."},
+	{method: "GET", path: "/api/alerts/duplicates", summary: "Groups of active alerts on the same symbol and condition with thresholds within a tolerance",
+		query: []openAPIParam{{"tolerance", "number", "Percent two thresholds may differ by (default: ALERT_DUPLICATE_TOLERANCE)"}}, response: alertDuplicatesResponse{}},
+	{method: "POST", path: "/api/alerts/merge", summary: "Merge active alerts on the same symbol and condition into the one with the tightest threshold, deleting the others",
+		body: alertMergeInput{}, response: alertMergeResult{}},
+	{method: "POST", path: "/api/alerts/bulk", summary: "Create the same alert on several symbols, or every tracked one, in one transaction",
+		body: bulkAlertInput{}, response: bulkAlertResponse{}, status: http.StatusCreated,
+		description: "Price-level and crossing conditions take offset_percent from each symbol's current price. With atomic (the default) any failing symbol creates nothing and the error lists each symbol's result."},
+
+	{method: "GET", path: "/api/export/analyses.jsonl", summary: "Stream analyses as JSONL", query: []openAPIParam{fromParam, toParam}, produces: contentTypeJSONL},
+	{method: "GET", path: "/api/export/snapshots.jsonl", summary: "Stream recorded quote snapshots as JSONL", query: []openAPIParam{fromParam, toParam}, produces: contentTypeJSONL},
+	{method: "GET", path: "/api/export", summary: "Download the profile's settings, alerts and channels as a backup",
+		query: []openAPIParam{{"redact", "boolean", "Leave API keys, webhook headers, webhook URLs and bot tokens out"}}, response: models.ConfigBackup{}},
+	{method: "POST", path: "/api/import", summary: "Restore a backup from GET /api/export",
+		query: []openAPIParam{{"merge", "boolean", "Add to the profile instead of replacing it"}}, body: models.ConfigBackup{}},
+	{method: "POST", path: "/api/admin/rotate-key", summary: "Re-encrypt every stored API key under ENCRYPTION_KEY"},
+	{method: "POST", path: "/api/admin/prune", summary: "Delete analyses and quote snapshots past the retention window now",
+		query: []openAPIParam{{"days", "integer", "Retention in days (default DATA_RETENTION_DAYS)"}}},
+	{method: "GET", path: "/api/admin/prompt-templates", summary: "Analysis prompt overrides stored in the database", response: []models.PromptTemplate{}},
+	{method: "PUT", path: "/api/admin/prompt-templates/{name}", summary: "Store a prompt override, used before a PROMPT_TEMPLATES_DIR file of the same name",
+		body: promptTemplateInput{}, response: statusResponse{},
+		description: "The name is analysis, a risk profile, a trade frequency or <risk>_<frequency>. A template that fails to parse or render a sample request is rejected with 400."},
+	{method: "DELETE", path: "/api/admin/prompt-templates/{name}", summary: "Remove a stored prompt override", response: statusResponse{}},
+
+	{method: "GET", path: "/api/positions", summary: "Held positions", response: []models.Position{}},
+	{method: "POST", path: "/api/positions", summary: "Set a position", body: models.Position{}, response: models.Position{}, status: http.StatusCreated},
+	{method: "GET", path: "/api/positions/{symbol}", summary: "One position", response: models.Position{}},
+	{method: "DELETE", path: "/api/positions/{symbol}", summary: "Remove a position", response: statusResponse{}},
+	{method: "GET", path: "/api/portfolio", summary: "Positions valued at live quotes with unrealized P&L", response: models.Portfolio{}},
+	{method: "GET", path: "/api/portfolio/partial", summary: "Portfolio summary fragment", produces: contentTypeHTML},
+
+	{method: "POST", path: "/api/backtest/{symbol}", summary: "Replay signals over price history", body: backtestRequest{}},
+
+	{method: "GET", path: "/api/notification-channels", summary: "Notification channels", response: []models.NotificationConfig{}},
+	{method: "POST", path: "/api/notification-channels", summary: "Add a notification channel",
+		body: models.NotificationConfig{}, response: models.NotificationConfig{}, status: http.StatusCreated},
+	{method: "PUT", path: "/api/notification-channels", summary: "Update a notification channel by its id",
+		body: models.NotificationConfig{}, response: models.NotificationConfig{}},
+	{method: "DELETE", path: "/api/notification-channels/{id}", summary: "Remove a notification channel", response: statusResponse{}},
+	{method: "POST", path: "/api/notification-channels/{id}/test", summary: "Send a test notification; 502 with the delivery error if it fails", response: statusResponse{}},
+	{method: "GET", path: "/api/notifications/log", summary: "Recent notification deliveries, newest first",
+		query: []openAPIParam{{"status", "", "delivered, failed, queued, deferred or suppressed"}, {"limit", "integer", "Maximum results"}}, response: []models.NotificationDelivery{}},
+
+	{method: "GET", path: "/api/jobs", summary: "The profile's and server-wide background jobs, newest first, with their status, attempts and last error",
+		query: []openAPIParam{{"status", "", "pending, running, done or failed"}, {"type", "", "analysis, notification or prune"}, {"limit", "integer", "Maximum results, at most 500"}}, response: []models.Job{}},
+
+	{method: "GET", path: "/api/ws", summary: "WebSocket of price updates, alert_triggered and analysis_complete messages",
+		query: []openAPIParam{{"client_id", "", "Stable ID that restores the last subscription"}}, status: http.StatusSwitchingProtocols},
+	{method: "GET", path: "/api/profiles", summary: "Risk tolerance and trade frequency profiles"},
+}
+
+// openAPIDocument renders openAPIOperations once as an OpenAPI 3 document
+var openAPIDocument = sync.OnceValue(func() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]map[string]interface{}{}
+	for _, op := range openAPIOperations {
+		if paths[op.path] == nil {
+			paths[op.path] = map[string]interface{}{}
+		}
+		paths[op.path][strings.ToLower(op.method)] = op.render(schemas)
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "StockAI API",
+			"version": Version,
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+})
+
+// handleOpenAPI serves the OpenAPI document (GET /api/openapi.json)
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+	respondJSON(w, http.StatusOK, openAPIDocument())
+}
+
+// openAPIPathParam matches the {name} segments of an operation path
+var openAPIPathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// render builds the operation object, adding reflected schemas to schemas
+func (op openAPIOperation) render(schemas map[string]interface{}) map[string]interface{} {
+	var params []interface{}
+	for _, m := range openAPIPathParam.FindAllStringSubmatch(op.path, -1) {
+		typ := "string"
+		if m[1] == "id" {
+			typ = "integer"
+		}
+		params = append(params, map[string]interface{}{
+			"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": typ},
+		})
+	}
+	for _, p := range op.query {
+		typ := p.typ
+		if typ == "" {
+			typ = "string"
+		}
+		params = append(params, map[string]interface{}{
+			"name": p.name, "in": "query", "description": p.description, "schema": map[string]interface{}{"type": typ},
+		})
+	}
+
+	out := map[string]interface{}{"summary": op.summary}
+	if op.description != "" {
+		out["description"] = op.description
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+	switch {
+	case op.consumes != "":
+		out["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{op.consumes: map[string]interface{}{"schema": map[string]interface{}{"type": "object"}}},
+		}
+	case op.body != nil:
+		out["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{CONTENT_TYPE_JSON: map[string]interface{}{"schema": schemaFor(reflect.TypeOf(op.body), schemas)}},
+		}
+	}
+
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case status == http.StatusSwitchingProtocols:
+	case op.produces != "":
+		success["content"] = map[string]interface{}{op.produces: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	case op.response != nil:
+		success["content"] = map[string]interface{}{CONTENT_TYPE_JSON: map[string]interface{}{"schema": schemaFor(reflect.TypeOf(op.response), schemas)}}
+	default:
+		success["content"] = map[string]interface{}{CONTENT_TYPE_JSON: map[string]interface{}{"schema": map[string]interface{}{"type": "object"}}}
+	}
+	errorSchema := schemaFor(reflect.TypeOf(errorResponse{}), schemas)
+	out["responses"] = map[string]interface{}{
+		strconv.Itoa(status): success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content":     map[string]interface{}{CONTENT_TYPE_JSON: map[string]interface{}{"schema": errorSchema}},
+		},
+	}
+	return out
+}
+
+// timeType is reflected as a date-time string rather than a struct
+var timeType = reflect.TypeOf(time.Time{})
+
+// rawMessageType is reflected as any JSON value rather than bytes
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// schemaFor reflects a Go type into a JSON schema following encoding/json's rules.
+// Named structs become components referenced by name.
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == rawMessageType {
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaFor(t.Elem(), schemas)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = nil // placeholder so recursive types terminate
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema reflects a struct's exported, json-tagged fields into an object schema.
+// Fields without omitempty are listed as required.
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for _, field := range reflect.VisibleFields(t) {
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" || (field.Anonymous && tag == "") {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaFor(field.Type, schemas)
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// openAPIMissingRoutes returns the registered route patterns the document doesn't
+// describe. An exact pattern needs its own path; a subtree pattern ("/api/x/") needs a
+// path beneath it.
+func openAPIMissingRoutes(patterns []string) []string {
+	var missing []string
+	for _, pattern := range patterns {
+		covered := slices.ContainsFunc(openAPIOperations, func(op openAPIOperation) bool {
+			if strings.HasSuffix(pattern, "/") {
+				return strings.HasPrefix(op.path, pattern) && len(op.path) > len(pattern)
+			}
+			return op.path == pattern
+		})
+		if !covered {
+			missing = append(missing, pattern)
+		}
+	}
+	return missing
+}
+
+// checkOpenAPICoverage warns about each registered route the OpenAPI document leaves out
+func checkOpenAPICoverage(patterns []string) {
+	for _, pattern := range openAPIMissingRoutes(patterns) {
+		slog.Warn("route missing from the OpenAPI document", "route", pattern)
+	}
+}
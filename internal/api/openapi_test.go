@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// TestOpenAPICoversRoutes checks that every route SetupRoutes registers is described
+// in the OpenAPI document, so new endpoints can't be left out of it
+func TestOpenAPICoversRoutes(t *testing.T) {
+	s, mux := newTestServer(t)
+	if len(s.routes) == 0 {
+		t.Fatal("SetupRoutes recorded no routes")
+	}
+	if missing := openAPIMissingRoutes(s.routes); len(missing) > 0 {
+		t.Errorf("routes missing from the OpenAPI document: %v", missing)
+	}
+	if got := openAPIMissingRoutes([]string{"/api/quote/", "/api/undocumented", "/api/undocumented/"}); !slices.Equal(got, []string{"/api/undocumented", "/api/undocumented/"}) {
+		t.Errorf("missing = %v, want the two undocumented routes", got)
+	}
+
+	rec := serve(mux, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var doc struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI == "" || doc.Paths["/api/alerts"]["post"] == nil || doc.Paths["/api/quote/{symbol}"]["get"] == nil {
+		t.Errorf("document lacks the alert and quote operations: openapi %q, %d paths", doc.OpenAPI, len(doc.Paths))
+	}
+}
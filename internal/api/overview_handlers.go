@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// overviewWorkers bounds the per-symbol lookups an overview runs at once
+const overviewWorkers = 8
+
+// handleOverview returns quotes and the latest analysis for every tracked symbol, or
+// those in the watchlist group named by ?group=, plus the active alert count in one
+// response (GET /api/overview)
+func (s *Server) handleOverview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	group := r.URL.Query().Get("group")
+	if group != "" {
+		if _, err := watchlistSection(cfg, group); err != nil {
+			respondErr(w, http.StatusNotFound, err)
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, s.Overview(r.Context(), cfg, group))
+}
+
+// Overview assembles a profile's market overview, listing its tracked symbols group by
+// group; a non-empty group limits it to that watchlist group. Quotes are fetched in one
+// batch under DASHBOARD_CALL_TIMEOUT while the latest analyses load concurrently; a
+// symbol whose quote failed still appears, with QuoteError and its last analysis.
+func (s *Server) Overview(ctx context.Context, cfg *models.UserConfig, group string) *models.MarketOverview {
+	overview := &models.MarketOverview{
+		Symbols:     []models.SymbolOverview{},
+		GeneratedAt: time.Now().UTC(),
+	}
+	var symbols []string
+	for _, section := range watchlistSections(cfg) {
+		if group != "" {
+			if !strings.EqualFold(section.Name, strings.TrimSpace(group)) {
+				continue
+			}
+			overview.Group = section.Name
+		}
+		for _, symbol := range section.Symbols {
+			overview.Symbols = append(overview.Symbols, models.SymbolOverview{Symbol: symbol, Group: section.Name})
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	var quotes map[string]models.Quote
+	var quotesErr error
+	var g errgroup.Group
+	g.SetLimit(overviewWorkers)
+	g.Go(func() error {
+		provider, err := s.marketProvider(cfg)
+		if err != nil {
+			quotesErr = err
+			return nil
+		}
+		quoteCtx, cancel := context.WithTimeout(ctx, s.config.DashboardCallTimeout)
+		defer cancel()
+		quotes, quotesErr = provider.GetQuotes(quoteCtx, symbols)
+		return nil
+	})
+	for i := range overview.Symbols {
+		entry := &overview.Symbols[i]
+		g.Go(func() error {
+			analyses, err := s.db.GetAnalysesForSymbol(entry.Symbol, 1)
+			if err != nil {
+				slog.WarnContext(ctx, "failed to load latest analysis", "symbol", entry.Symbol, "error", err)
+			} else if len(analyses) > 0 {
+				entry.LatestAnalysis = &analyses[0]
+			}
+			return nil
+		})
+	}
+	if alerts, err := s.db.GetActiveAlerts(cfg.ID); err != nil {
+		slog.WarnContext(ctx, "failed to count active alerts", "error", err)
+	} else {
+		overview.ActiveAlerts = len(alerts)
+	}
+	g.Wait()
+
+	var batchErr *market.BatchError
+	errors.As(quotesErr, &batchErr)
+	for i := range overview.Symbols {
+		entry := &overview.Symbols[i]
+		if quote, ok := quotes[entry.Symbol]; ok {
+			entry.Quote = &quote
+		} else if batchErr != nil && batchErr.Errors[entry.Symbol] != nil {
+			entry.QuoteError = batchErr.Errors[entry.Symbol].Error()
+		} else if quotesErr != nil {
+			entry.QuoteError = quotesErr.Error()
+		} else {
+			entry.QuoteError = "no quote returned"
+		}
+	}
+	return overview
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"stockmarket/internal/analytics"
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+	"stockmarket/internal/web/pages"
+)
+
+// handlePositions lists positions or creates/replaces one
+func (s *Server) handlePositions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		positions, err := s.db.GetPositions()
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, positions)
+
+	case http.MethodPost:
+		var position models.Position
+		if err := json.NewDecoder(r.Body).Decode(&position); err != nil {
+			respondError(w, http.StatusBadRequest, INVALID_JSON)
+			return
+		}
+
+		cfg, err := s.requestConfig(r)
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		symbol, err := market.NormalizeSymbol(position.Symbol)
+		if err != nil {
+			respondErr(w, http.StatusBadRequest, err)
+			return
+		}
+		position.Symbol = market.ResolveSymbol(symbol, cfg.SymbolAliases)
+		if position.Quantity <= 0 || position.AvgCost <= 0 {
+			respondError(w, http.StatusBadRequest, "Symbol, positive quantity and avg_cost required")
+			return
+		}
+
+		if err := s.db.SavePosition(&position); err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		respondJSON(w, http.StatusCreated, position)
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+	}
+}
+
+// handlePosition gets or removes the position for a symbol
+func (s *Server) handlePosition(w http.ResponseWriter, r *http.Request) {
+	symbol, err := market.NormalizeSymbol(strings.TrimPrefix(r.URL.Path, "/api/positions/"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		position, err := s.db.GetPosition(symbol)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "Position not found")
+			return
+		}
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, position)
+
+	case http.MethodDelete:
+		if err := s.db.DeletePosition(symbol); err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+	}
+}
+
+// portfolio values every held position with one batch quote request. Symbols whose
+// quote fails are left unpriced rather than failing the whole portfolio.
+func (s *Server) portfolio(ctx context.Context) (models.Portfolio, error) {
+	positions, err := s.db.GetPositions()
+	if err != nil || len(positions) == 0 {
+		return analytics.Valuate(positions, nil, nil), err
+	}
+
+	cfg, err := s.db.GetProfileConfig(ProfileID(ctx))
+	if err != nil {
+		return models.Portfolio{}, err
+	}
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		return models.Portfolio{}, err
+	}
+
+	symbols := make([]string, len(positions))
+	for i, p := range positions {
+		symbols[i] = p.Symbol
+	}
+
+	quotes, err := provider.GetQuotes(ctx, symbols)
+	errs := make(map[string]string)
+	var batchErr *market.BatchError
+	if errors.As(err, &batchErr) {
+		for symbol, symbolErr := range batchErr.Errors {
+			errs[symbol] = symbolErr.Error()
+		}
+	} else if err != nil {
+		for _, symbol := range symbols {
+			errs[symbol] = err.Error()
+		}
+	}
+	return analytics.Valuate(positions, quotes, errs), nil
+}
+
+// handlePortfolio returns every position with its unrealized P&L and portfolio totals
+func (s *Server) handlePortfolio(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	portfolio, err := s.portfolio(ctx)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, portfolio)
+}
+
+// handlePortfolioHTMX renders the dashboard portfolio partial
+func (s *Server) handlePortfolioHTMX(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	portfolio, err := s.portfolio(ctx)
+	if err != nil {
+		htmxError(w, err.Error())
+		return
+	}
+
+	summary := pages.PortfolioSummary{
+		Value:     portfolio.MarketValue,
+		PL:        portfolio.UnrealizedPL,
+		PLPercent: portfolio.UnrealizedPLPercent,
+		Partial:   portfolio.Partial,
+	}
+	for i, p := range portfolio.Positions {
+		row := pages.PortfolioRow{
+			Symbol:   p.Symbol,
+			Quantity: p.Quantity,
+			AvgCost:  p.AvgCost,
+			Currency: market.SymbolCurrency(p.Symbol),
+			Priced:   p.MarketValue != nil,
+			Error:    p.Error,
+		}
+		if i == 0 {
+			summary.Currency = row.Currency
+		} else if row.Currency != summary.Currency {
+			summary.Currency = ""
+		}
+		if row.Priced {
+			row.Price, row.Value, row.PL = *p.Price, *p.MarketValue, *p.UnrealizedPL
+			if p.UnrealizedPLPercent != nil {
+				row.PLPercent = *p.UnrealizedPLPercent
+			}
+		}
+		summary.Rows = append(summary.Rows, row)
+	}
+
+	w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_HTML)
+	pages.PortfolioPartial(summary).Render(r.Context(), w)
+}
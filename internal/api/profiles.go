@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"stockmarket/internal/db"
+	"stockmarket/internal/models"
+)
+
+const (
+	// ProfileHeader selects the configuration profile a request acts on
+	ProfileHeader = "X-Profile-ID"
+
+	// profileParam selects the profile as a query parameter (e.g. for the WebSocket
+	// upgrade) or, once switched to, as a cookie for the web UI
+	profileParam = "profile_id"
+
+	// maxProfileNameLength caps profile names
+	maxProfileNameLength = 50
+)
+
+type profileContextKey struct{}
+
+// ProfileID returns the profile selected for a request, or 0 for the default profile
+func ProfileID(ctx context.Context) int64 {
+	id, _ := ctx.Value(profileContextKey{}).(int64)
+	return id
+}
+
+// ResolveProfile selects the configuration profile for a request from the X-Profile-ID
+// header, then the profile_id query parameter, then the profile_id cookie set by
+// switching profiles. Requests without one use the default profile, so single-user
+// setups work as before. Unknown profiles are rejected.
+func (s *Server) ResolveProfile(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.Header.Get(ProfileHeader)
+		if raw == "" {
+			raw = r.URL.Query().Get(profileParam)
+		}
+		if raw == "" {
+			if cookie, err := r.Cookie(profileParam); err == nil {
+				raw = cookie.Value
+			}
+		}
+		if raw == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil || id <= 0 {
+			respondError(w, http.StatusBadRequest, "Invalid profile ID")
+			return
+		}
+		if _, err := s.db.GetProfileConfig(id); errors.Is(err, db.ErrProfileNotFound) {
+			respondErr(w, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withProfile(r.Context(), id)))
+	})
+}
+
+// requestConfig returns the config of the profile selected for a request
+func (s *Server) requestConfig(r *http.Request) (*models.UserConfig, error) {
+	return s.db.GetProfileConfig(ProfileID(r.Context()))
+}
+
+// handleConfigProfiles lists profiles (GET) or creates one (POST {"name": ...}). New
+// profiles start with default settings but the current profile's providers and keys.
+func (s *Server) handleConfigProfiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		profiles, err := s.db.ListProfiles()
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		activeID, err := s.requestProfileID(r)
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"profiles":  profiles,
+			"active_id": activeID,
+		})
+
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		if name == "" || len(name) > maxProfileNameLength {
+			respondError(w, http.StatusBadRequest, "Profile name must be 1 to 50 characters")
+			return
+		}
+
+		cfg, err := s.requestConfig(r)
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		profile, err := s.db.CreateProfile(name, cfg)
+		if errors.Is(err, db.ErrProfileExists) {
+			respondErr(w, http.StatusConflict, err)
+			return
+		} else if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, profile)
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+	}
+}
+
+// handleConfigProfileSwitch makes a profile ({"id": ...}) the active one for the web
+// UI by setting the profile_id cookie. API clients send X-Profile-ID instead.
+func (s *Server) handleConfigProfileSwitch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+		respondError(w, http.StatusBadRequest, "Invalid profile ID")
+		return
+	}
+	cfg, err := s.db.GetProfileConfig(req.ID)
+	if errors.Is(err, db.ErrProfileNotFound) {
+		respondErr(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     profileParam,
+		Value:    strconv.FormatInt(cfg.ID, 10),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	respondJSON(w, http.StatusOK, models.Profile{ID: cfg.ID, Name: cfg.Name, CreatedAt: cfg.CreatedAt})
+}
+
+// requestProfileID returns the ID of the profile selected for a request, resolving the
+// default profile to its stored ID so alerts can be scoped by it
+func (s *Server) requestProfileID(r *http.Request) (int64, error) {
+	if id := ProfileID(r.Context()); id != 0 {
+		return id, nil
+	}
+	cfg, err := s.db.GetOrCreateConfig()
+	if err != nil {
+		return 0, err
+	}
+	return cfg.ID, nil
+}
+
+// withProfile selects a profile on a context, for work done on a profile's behalf
+// outside a request
+func withProfile(ctx context.Context, profileID int64) context.Context {
+	return context.WithValue(ctx, profileContextKey{}, profileID)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"stockmarket/internal/ai"
+	"stockmarket/internal/models"
+)
+
+// promptTemplateInput is the body of PUT /api/admin/prompt-templates/{name}
+type promptTemplateInput struct {
+	Template string `json:"template"`
+}
+
+// LoadStoredPromptTemplates hands the prompt overrides stored in the database to the
+// ai package, where they win over PROMPT_TEMPLATES_DIR files of the same name. A stored
+// template that no longer renders is logged and skipped.
+func (s *Server) LoadStoredPromptTemplates() error {
+	templates, err := s.db.GetPromptTemplates()
+	if err != nil {
+		return err
+	}
+	texts := make(map[string]string, len(templates))
+	for _, t := range templates {
+		texts[t.Name] = t.Template
+	}
+	if err := ai.SetStoredPromptTemplates(texts); err != nil {
+		slog.Warn("skipping stored prompt templates", "error", err)
+	}
+	return nil
+}
+
+// handlePromptTemplates lists the stored prompt overrides (GET /api/admin/prompt-templates)
+func (s *Server) handlePromptTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+	templates, err := s.db.GetPromptTemplates()
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	if templates == nil {
+		templates = []models.PromptTemplate{}
+	}
+	respondJSON(w, http.StatusOK, templates)
+}
+
+// handlePromptTemplate sets or removes a stored prompt override
+// (PUT/DELETE /api/admin/prompt-templates/{name}). A template is checked against a
+// sample request before it's saved, so a broken one is rejected rather than stored.
+func (s *Server) handlePromptTemplate(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/admin/prompt-templates/")
+
+	switch r.Method {
+	case http.MethodPut:
+		var input promptTemplateInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			respondError(w, http.StatusBadRequest, INVALID_JSON)
+			return
+		}
+		if err := ai.ValidatePromptTemplate(name, input.Template); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid prompt template: "+err.Error())
+			return
+		}
+		if err := s.db.SavePromptTemplate(name, input.Template); err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err := s.LoadStoredPromptTemplates(); err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]string{"status": "saved"})
+
+	case http.MethodDelete:
+		err := s.db.DeletePromptTemplate(name)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "Prompt template not found")
+			return
+		}
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err := s.LoadStoredPromptTemplates(); err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+	}
+}
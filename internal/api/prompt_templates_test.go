@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"stockmarket/internal/ai"
+)
+
+// TestStoredPromptTemplates checks that a stored prompt override is validated before
+// it's saved, is used by the next prompt without a restart, and goes away when deleted
+func TestStoredPromptTemplates(t *testing.T) {
+	_, mux := newTestServer(t)
+	t.Cleanup(func() { ai.SetStoredPromptTemplates(nil) })
+
+	for _, tc := range []struct {
+		name, body string
+		status     int
+	}{
+		{"analysis", `{"template": "stored prompt for {{.Symbol}}"}`, 200},
+		{"analysis", `{"template": "{{.Symbol"}`, 400},
+		{"analysis", `{"template": "{{.NoSuchField}}"}`, 400},
+		{"bullish", `{"template": "prompt"}`, 400},
+		{"analysis", `{"template": `, 400},
+	} {
+		rec := serve(mux, httptest.NewRequest("PUT", "/api/admin/prompt-templates/"+tc.name, strings.NewReader(tc.body)))
+		if rec.Code != tc.status {
+			t.Errorf("PUT %s %s: status %d, want %d: %s", tc.name, tc.body, rec.Code, tc.status, rec.Body)
+		}
+	}
+
+	rec := serve(mux, httptest.NewRequest("GET", "/api/admin/prompt-templates", nil))
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), `"name":"analysis"`) {
+		t.Errorf("list: status %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(mux, httptest.NewRequest("POST", "/api/analyze/AAPL/preview", nil))
+	if !strings.Contains(rec.Body.String(), "stored prompt for AAPL") {
+		t.Errorf("preview doesn't use the stored template: %s", rec.Body)
+	}
+
+	if rec := serve(mux, httptest.NewRequest("DELETE", "/api/admin/prompt-templates/analysis", nil)); rec.Code != 200 {
+		t.Errorf("delete: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(mux, httptest.NewRequest("DELETE", "/api/admin/prompt-templates/analysis", nil)); rec.Code != 404 {
+		t.Errorf("second delete: status %d, want 404", rec.Code)
+	}
+	rec = serve(mux, httptest.NewRequest("POST", "/api/analyze/AAPL/preview", nil))
+	if strings.Contains(rec.Body.String(), "stored prompt for AAPL") {
+		t.Errorf("preview still uses the deleted template: %s", rec.Body)
+	}
+}
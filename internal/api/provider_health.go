@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// marketProvider builds the market data provider for the saved config, backed by the
+// shared quote cache. When fallbacks are configured it wraps a health-aware chain with
+// the saved provider first.
+func (s *Server) marketProvider(cfg *models.UserConfig) (market.Provider, error) {
+	chain, err := s.providerChain(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 1 {
+		return market.NewCachingProvider(s.routeCrypto(chain[0]), s.quoteCache), nil
+	}
+	return market.NewCachingProvider(s.routeCrypto(market.NewFallback(s.health, chain...)), s.quoteCache), nil
+}
+
+// routeCrypto sends crypto pairs to CRYPTO_PROVIDER, unless p already is that provider
+// or it can't be built. The mock provider generates crypto pairs itself, so offline
+// demos never reach out to a real exchange.
+func (s *Server) routeCrypto(p market.Provider) market.Provider {
+	name := s.config.CryptoProvider
+	if name == "" || p.Name() == name || p.Name() == "mock" {
+		return p
+	}
+	key := s.config.ProviderAPIKeys[name]
+	if key == "" && market.RequiresAPIKey(name) {
+		return p
+	}
+	crypto, err := s.newMarketProvider(name, key)
+	if err != nil {
+		return p
+	}
+	return market.NewCryptoRouter(p, crypto)
+}
+
+// providerChain builds the saved provider followed by the saved fallback and then each
+// server-configured fallback. Fallbacks use server-configured API keys and are skipped
+// when a required key is missing.
+func (s *Server) providerChain(cfg *models.UserConfig) ([]market.Provider, error) {
+	apiKey, err := s.decryptSecret("market data API key", cfg.MarketDataAPIKey)
+	if err != nil {
+		return nil, err
+	}
+	primary, err := s.newMarketProvider(cfg.MarketDataProvider, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := []market.Provider{primary}
+	names := []string{cfg.MarketDataProvider}
+	fallbacks := s.config.MarketDataFallbacks
+	if cfg.MarketDataFallback != "" {
+		fallbacks = append([]string{cfg.MarketDataFallback}, fallbacks...)
+	}
+	for _, name := range fallbacks {
+		if slices.Contains(names, name) {
+			continue
+		}
+		key := s.config.ProviderAPIKeys[name]
+		if key == "" && market.RequiresAPIKey(name) {
+			continue
+		}
+		p, err := s.newMarketProvider(name, key)
+		if err != nil {
+			continue
+		}
+		chain = append(chain, p)
+		names = append(names, name)
+	}
+	return chain, nil
+}
+
+// StartProviderHealthProbe periodically probes each configured market data provider
+// with a lightweight quote request so fallback ordering tracks recoveries
+func (s *Server) StartProviderHealthProbe(ctx context.Context) {
+	if s.config.ProviderHealthInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.ProviderHealthInterval)
+		defer ticker.Stop()
+
+		s.probeProviders(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.probeProviders(ctx)
+			}
+		}
+	}()
+}
+
+// probeProviders records one health probe per provider in the chain
+func (s *Server) probeProviders(ctx context.Context) {
+	cfg, err := s.db.GetOrCreateConfig()
+	if err != nil {
+		return
+	}
+	chain, err := s.providerChain(cfg)
+	if err != nil {
+		return
+	}
+
+	for _, p := range chain {
+		probeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		start := time.Now()
+		_, err := p.GetQuote(probeCtx, s.config.ProviderHealthSymbol)
+		cancel()
+
+		latency := time.Since(start)
+		wasUp := s.health.Up(p.Name())
+		s.health.Record(p.Name(), err, latency)
+		if err != nil && wasUp {
+			slog.Warn("provider is down", "provider", p.Name(), "error", err)
+		} else if err == nil && !wasUp {
+			slog.Info("provider recovered", "provider", p.Name())
+		}
+		slog.Debug("probed provider", "provider", p.Name(), "latency_ms", latency.Milliseconds(), "error", err)
+	}
+}
+
+// handleProviderHealth returns the last known health of each market data provider
+func (s *Server) handleProviderHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.health.Snapshot())
+}
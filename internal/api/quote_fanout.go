@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// quoteMailbox holds one consumer's undelivered streamed quotes, the newest per symbol.
+// A consumer that falls behind skips straight to each symbol's latest quote instead of
+// stalling the stream or losing symbols, and putting a quote never blocks.
+type quoteMailbox struct {
+	name  string        // the consumer, for logs
+	ready chan struct{} // signalled when quotes are waiting
+
+	mu      sync.Mutex
+	pending map[string]models.Quote
+	order   []string // pending symbols, oldest first
+	behind  bool     // a pending quote was replaced since the last take
+}
+
+func newQuoteMailbox(name string) *quoteMailbox {
+	return &quoteMailbox{
+		name:    name,
+		ready:   make(chan struct{}, 1),
+		pending: make(map[string]models.Quote),
+	}
+}
+
+// put queues a quote, replacing its symbol's undelivered one. It reports whether the
+// consumer just fell behind: the first replacement since the consumer last caught up.
+func (m *quoteMailbox) put(quote models.Quote) bool {
+	m.mu.Lock()
+	_, replaced := m.pending[quote.Symbol]
+	if !replaced {
+		m.order = append(m.order, quote.Symbol)
+	}
+	m.pending[quote.Symbol] = quote
+	fellBehind := replaced && !m.behind
+	if replaced {
+		m.behind = true
+	}
+	m.mu.Unlock()
+
+	select {
+	case m.ready <- struct{}{}:
+	default:
+	}
+	return fellBehind
+}
+
+// take removes and returns the waiting quotes in the order their symbols arrived
+func (m *quoteMailbox) take() []models.Quote {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	quotes := make([]models.Quote, 0, len(m.order))
+	for _, symbol := range m.order {
+		quotes = append(quotes, m.pending[symbol])
+		delete(m.pending, symbol)
+	}
+	m.order = m.order[:0]
+	m.behind = false
+	return quotes
+}
+
+// quoteDeduper drops a stream's repeated quotes: it passes a symbol's first quote, then
+// only ones whose volume changed or whose price or extended-hours price moved more than
+// epsilon from the last quote passed. Flagged discontinuities always pass.
+type quoteDeduper struct {
+	epsilon float64
+
+	mu   sync.Mutex
+	last map[string]models.Quote
+}
+
+func newQuoteDeduper(epsilon float64) *quoteDeduper {
+	return &quoteDeduper{epsilon: epsilon, last: make(map[string]models.Quote)}
+}
+
+// changed reports whether a quote should be passed on, remembering it if so. A nil
+// deduper passes everything.
+func (d *quoteDeduper) changed(quote models.Quote) bool {
+	if d == nil {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	last, seen := d.last[quote.Symbol]
+	if seen && quote.Discontinuity == "" && quote.Volume == last.Volume && math.Abs(quote.Price-last.Price) <= d.epsilon &&
+		math.Abs(quote.ExtendedHoursPrice-last.ExtendedHoursPrice) <= d.epsilon {
+		return false
+	}
+	d.last[quote.Symbol] = quote
+	return true
+}
+
+// reset forgets every symbol, so each one's next quote passes; called when the
+// subscription changes so newly subscribed symbols get a price right away
+func (d *quoteDeduper) reset() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	clear(d.last)
+	d.mu.Unlock()
+}
+
+// fanOutQuotes reads a connection's provider stream until ctx ends, flags split-driven
+// jumps once with detector, drops repeats with dedupe (nil keeps them) and hands every
+// other quote to each mailbox. The provider is never held up by a slow consumer; it
+// just sees fewer, fresher quotes.
+func fanOutQuotes(ctx context.Context, clientID uint64, in <-chan models.Quote, detector *market.DiscontinuityDetector, dedupe *quoteDeduper, mailboxes ...*quoteMailbox) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case quote := <-in:
+			detector.Check(&quote)
+			if !dedupe.changed(quote) {
+				continue
+			}
+			for _, mailbox := range mailboxes {
+				if mailbox.put(quote) {
+					slog.Warn("websocket quote consumer behind, skipping to latest quotes", "client_id", clientID, "consumer", mailbox.name, "symbol", quote.Symbol)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// TestFanOutQuotesEveryConsumer checks that the client and the alert checker each see
+// every symbol's quotes, and that one falling behind gets each symbol's latest quote
+// rather than losing symbols or holding up the other
+func TestFanOutQuotesEveryConsumer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan models.Quote)
+	client, alerts := newQuoteMailbox("client"), newQuoteMailbox("alerts")
+	done := make(chan struct{})
+	go func() {
+		fanOutQuotes(ctx, 1, in, nil, nil, client, alerts)
+		close(done)
+	}()
+
+	// The client keeps up, reading after each quote; the alert checker reads only at the end
+	symbols := []string{"AAPL", "MSFT", "BTC-USD"}
+	var seenByClient []models.Quote
+	for round := 1; round <= 3; round++ {
+		for _, symbol := range symbols {
+			in <- models.Quote{Symbol: symbol, Price: float64(100 * round)}
+			select {
+			case <-client.ready:
+			case <-time.After(time.Second):
+				t.Fatalf("client never signalled for %s", symbol)
+			}
+			seenByClient = append(seenByClient, client.take()...)
+		}
+	}
+	cancel()
+	<-done
+
+	if len(seenByClient) != 9 {
+		t.Errorf("client saw %d quotes, want all 9", len(seenByClient))
+	}
+	latest := alerts.take()
+	if len(latest) != len(symbols) {
+		t.Fatalf("alert checker got %d quotes, want one per symbol: %+v", len(latest), latest)
+	}
+	for i, quote := range latest {
+		if quote.Symbol != symbols[i] || quote.Price != 300 {
+			t.Errorf("alert checker quote %d = %s at %v, want %s at its latest 300", i, quote.Symbol, quote.Price, symbols[i])
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ipSweepInterval is how often idle per-client buckets are dropped
+const ipSweepInterval = time.Minute
+
+// ipRateLimiter is a token bucket per client IP
+type ipRateLimiter struct {
+	burst float64
+	rate  float64 // tokens per second
+
+	mu        sync.Mutex
+	buckets   map[string]*ipBucket
+	lastSweep time.Time
+}
+
+type ipBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newIPRateLimiter allows each client perMinute requests a minute with bursts of up
+// to burst (perMinute when unset). It returns nil, which allows everything, for a
+// non-positive perMinute.
+func newIPRateLimiter(perMinute, burst int) *ipRateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &ipRateLimiter{
+		burst:     float64(burst),
+		rate:      float64(perMinute) / 60,
+		buckets:   make(map[string]*ipBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token for client, or reports how long until one is available
+func (l *ipRateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &ipBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(b.tokens+now.Sub(b.last).Seconds()*l.rate, l.burst)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops buckets idle long enough to have refilled, since a fresh bucket is
+// identical, so memory stays bounded by recently active clients; callers hold mu
+func (l *ipRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < ipSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// RateLimit applies per-client request limits to /api routes: the analyze endpoints,
+// which spend AI credits, use the stricter analyze limit and the rest, including
+// analysis job polling, share the general one. /api/health is exempt. Clients over their limit get a 429 with
+// Retry-After.
+func (s *Server) RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := s.apiLimiter
+		switch {
+		case !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/health":
+			limiter = nil
+		case strings.HasPrefix(r.URL.Path, "/api/analyze/jobs/"):
+		case r.URL.Path == "/api/analyze" || strings.HasPrefix(r.URL.Path, "/api/analyze/"):
+			limiter = s.analyzeLimiter
+		}
+		if limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ok, wait := limiter.allow(s.clientIP(r)); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respondError(w, http.StatusTooManyRequests, "Rate limit exceeded; retry later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP identifies the client for rate limiting. X-Forwarded-For is only
+// honored behind a trusted proxy, since clients can set it to anything.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.config.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"stockmarket/internal/analytics"
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// analysisBenchmark is the benchmark an analysis compares against: the requested one,
+// else BENCHMARK_SYMBOL when ANALYSIS_BENCHMARK is on. It's empty when there's nothing
+// to compare, including a symbol against itself, and fails when the requested
+// benchmark isn't a valid symbol.
+func (s *Server) analysisBenchmark(symbol, requested string) (string, error) {
+	benchmark := ""
+	if strings.TrimSpace(requested) != "" {
+		var err error
+		if benchmark, err = market.NormalizeSymbol(requested); err != nil {
+			return "", fmt.Errorf("benchmark: %w", err)
+		}
+	} else if s.config.AnalysisBenchmark {
+		benchmark = s.config.BenchmarkSymbol
+	}
+	if benchmark == symbol {
+		return "", nil
+	}
+	return benchmark, nil
+}
+
+// historyWithBenchmark fetches a symbol's history over period alongside its comparison
+// with the benchmark, through the same (caching) provider, under HISTORICAL_TIMEOUT.
+// The comparison is benchmarkComparison's plus the symbol's relative strength over
+// period. Only the symbol's history is required: when the benchmark is empty or fails
+// to load the comparison is nil.
+func (s *Server) historyWithBenchmark(ctx context.Context, provider market.Provider, symbol, period, benchmark string) ([]models.Candle, *models.BenchmarkComparison, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.HistoricalTimeout)
+	defer cancel()
+
+	var historical, benchmarkCandles []models.Candle
+	var comparison *models.BenchmarkComparison
+	var g errgroup.Group
+	g.Go(func() error {
+		var err error
+		historical, err = market.AdjustedHistory(ctx, provider, symbol, period, "")
+		return err
+	})
+	if benchmark != "" {
+		g.Go(func() error {
+			var err error
+			if benchmarkCandles, err = market.AdjustedHistory(ctx, provider, benchmark, period, ""); err != nil {
+				slog.WarnContext(ctx, "skipping relative strength", "symbol", symbol, "benchmark", benchmark, "error", err)
+			}
+			return nil
+		})
+		g.Go(func() error {
+			comparison = s.benchmarkComparison(ctx, provider, symbol, benchmark, "1y")
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, nil, err
+	}
+
+	if relative, ok := relativeStrength(historical, benchmarkCandles); ok {
+		if comparison == nil {
+			comparison = &models.BenchmarkComparison{Symbol: benchmark}
+		}
+		comparison.Period = period
+		comparison.RelativeStrength = &relative
+	}
+	return historical, comparison, nil
+}
+
+// relativeStrength is the symbol's return minus the benchmark's, in percentage points,
+// over the bars both candle series cover; false when either is too short
+func relativeStrength(symbolCandles, benchmarkCandles []models.Candle) (float64, bool) {
+	n := min(len(symbolCandles), len(benchmarkCandles)) - 1
+	symbolReturn, ok := analytics.PeriodReturn(symbolCandles, n)
+	if !ok {
+		return 0, false
+	}
+	benchmarkReturn, ok := analytics.PeriodReturn(benchmarkCandles, n)
+	if !ok {
+		return 0, false
+	}
+	return math.Round((symbolReturn-benchmarkReturn)*100) / 100, true
+}
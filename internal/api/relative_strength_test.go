@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"stockmarket/internal/models"
+)
+
+// TestAnalysisBenchmarkComparison checks that an analysis compares against the
+// requested benchmark, or BENCHMARK_SYMBOL by default, in a single prompt section that
+// carries the beta and the relative strength together
+func TestAnalysisBenchmarkComparison(t *testing.T) {
+	s, mux := newTestServer(t)
+	if benchmark, _ := s.analysisBenchmark("AAPL", ""); benchmark != "SPY" {
+		t.Fatalf("default benchmark = %q, want SPY", benchmark)
+	}
+
+	for _, tc := range []struct{ body, benchmark string }{
+		{`{}`, "SPY"},
+		{`{"benchmark": "qqq"}`, "QQQ"},
+	} {
+		rec := serve(mux, httptest.NewRequest("POST", "/api/analyze/AAPL/preview", strings.NewReader(tc.body)))
+		if rec.Code != 200 {
+			t.Fatalf("%s: status %d: %s", tc.body, rec.Code, rec.Body)
+		}
+		var preview models.PromptPreview
+		if err := json.NewDecoder(rec.Body).Decode(&preview); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := strings.Count(preview.Prompt, "Benchmark Comparison"); n != 1 {
+			t.Errorf("%s: %d benchmark sections in the prompt, want 1", tc.body, n)
+		}
+		for _, want := range []string{"Benchmark Comparison (" + tc.benchmark + ")", "Beta vs " + tc.benchmark, "Relative strength over 1m"} {
+			if !strings.Contains(preview.Prompt, want) {
+				t.Errorf("%s: prompt is missing %q", tc.body, want)
+			}
+		}
+	}
+
+	cfg := testConfig(t, s)
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, comparison, err := s.historyWithBenchmark(t.Context(), provider, "AAPL", "1m", "QQQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comparison == nil || comparison.Symbol != "QQQ" || comparison.Period != "1m" || comparison.RelativeStrength == nil || comparison.Beta == nil {
+		t.Fatalf("comparison = %+v, want QQQ with a beta and 1m relative strength", comparison)
+	}
+	if _, comparison, _ := s.historyWithBenchmark(t.Context(), provider, "AAPL", "1m", ""); comparison != nil {
+		t.Errorf("comparison without a benchmark = %+v, want nil", comparison)
+	}
+}
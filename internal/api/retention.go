@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"stockmarket/internal/db"
+	"stockmarket/internal/models"
+)
+
+// retentionPruneInterval is how often data past DATA_RETENTION_DAYS is pruned
+const retentionPruneInterval = 6 * time.Hour
+
+// startRetentionPrune queues a prune job for analyses, quote snapshots and cached
+// history older than DATA_RETENTION_DAYS at startup and then periodically; it does
+// nothing when retention is 0
+func (s *Server) startRetentionPrune(ctx context.Context) {
+	if s.config.DataRetentionDays <= 0 {
+		return
+	}
+
+	s.queueRetentionPrune()
+	go func() {
+		ticker := time.NewTicker(retentionPruneInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.queueRetentionPrune()
+			}
+		}
+	}()
+}
+
+// queueRetentionPrune queues a DATA_RETENTION_DAYS prune job
+func (s *Server) queueRetentionPrune() {
+	job := models.Job{Type: jobPrune, Key: "retention"}
+	if _, _, err := s.enqueueJob(job, pruneJobPayload{Days: s.config.DataRetentionDays}); err != nil {
+		slog.Error("failed to queue retention prune", "error", err)
+	}
+}
+
+// pruneOldData removes analyses, quote snapshots and cached history older than days,
+// logging what it removed
+func (s *Server) pruneOldData(days int) (db.PruneResult, error) {
+	result, err := s.db.PruneBefore(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		slog.Error("failed to prune old data", "retention_days", days, "analyses", result.Analyses, "quote_snapshots", result.QuoteSnapshots, "historical_cache", result.HistoricalCache, "error", err)
+		return result, err
+	}
+	if result.Analyses > 0 || result.QuoteSnapshots > 0 || result.HistoricalCache > 0 {
+		slog.Info("pruned old data", "retention_days", days, "analyses", result.Analyses, "quote_snapshots", result.QuoteSnapshots, "historical_cache", result.HistoricalCache)
+	}
+	return result, nil
+}
+
+// handlePrune prunes analyses, quote snapshots and cached history past the retention
+// window now (POST /api/admin/prune). ?days= overrides DATA_RETENTION_DAYS, and is
+// required when retention is off. Analyses tagged "keep" or of a symbol with an open
+// position stay.
+func (s *Server) handlePrune(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	days := s.config.DataRetentionDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, http.StatusBadRequest, "days must be a positive integer")
+			return
+		}
+		days = n
+	}
+	if days <= 0 {
+		respondError(w, http.StatusBadRequest, "DATA_RETENTION_DAYS is 0 (keep forever); pass ?days= to prune")
+		return
+	}
+
+	result, err := s.pruneOldData(days)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":           "pruned",
+		"retention_days":   days,
+		"analyses":         result.Analyses,
+		"quote_snapshots":  result.QuoteSnapshots,
+		"historical_cache": result.HistoricalCache,
+	})
+}
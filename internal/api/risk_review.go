@@ -0,0 +1,134 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// riskReviewTag marks analyses saved by a risk review; each review also gets its own batch tag
+const riskReviewTag = "risk-review"
+
+// handleRiskReview reviews every tracked symbol for an exit (POST /api/analyze/portfolio).
+// Quotes are fetched in one batch, then each symbol gets a downside-focused SELL or HOLD
+// analysis, at most RISK_REVIEW_WORKERS at a time. Results come back most urgent first:
+// SELLs by confidence, then HOLDs from least to most confident, then symbols that failed.
+// With ?save=true the analyses are saved tagged with the review's batch tag.
+func (s *Server) handleRiskReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	save, err := boolQuery(r, "save")
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(cfg.TrackedSymbols) == 0 {
+		respondError(w, http.StatusBadRequest, "No symbols tracked. Add symbols in Settings.")
+		return
+	}
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), fmt.Errorf("Market provider error: %w", err))
+		return
+	}
+	analyzer, err := s.requestAnalyzer(cfg, "", "")
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), fmt.Errorf(FAILED_TO_GET_ANALYZE+": %w", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+
+	review := models.RiskReview{
+		Symbols:     make([]models.RiskReviewEntry, len(cfg.TrackedSymbols)),
+		GeneratedAt: time.Now().UTC(),
+	}
+	if save {
+		review.Batch = riskReviewTag + "-" + review.GeneratedAt.Format("20060102-150405")
+	}
+
+	quotes, quotesErr := provider.GetQuotes(ctx, cfg.TrackedSymbols)
+	var batchErr *market.BatchError
+	if quotesErr != nil && !errors.As(quotesErr, &batchErr) {
+		respondError(w, http.StatusBadGateway, FAILED_TO_GET_QUOTE+": "+quotesErr.Error())
+		return
+	}
+
+	var g errgroup.Group
+	g.SetLimit(s.config.RiskReviewWorkers)
+	for i, symbol := range cfg.TrackedSymbols {
+		entry := &review.Symbols[i]
+		entry.Symbol = symbol
+		quote, ok := quotes[symbol]
+		if !ok {
+			entry.Error = "no quote returned"
+			if batchErr != nil && batchErr.Errors[symbol] != nil {
+				entry.Error = FAILED_TO_GET_QUOTE + ": " + batchErr.Errors[symbol].Error()
+			}
+			continue
+		}
+		g.Go(func() error {
+			analysis, err := s.analyzeQuote(ctx, cfg, provider, analyzer, &quote, true)
+			if err != nil {
+				slog.WarnContext(ctx, "risk review failed", "symbol", symbol, "error", err)
+				entry.Error = err.Error()
+				return nil
+			}
+			// Anything short of an exit call is a hold in a risk review
+			if analysis.Action != "SELL" {
+				analysis.Action = "HOLD"
+			}
+			if save {
+				analysis.Tags = []string{riskReviewTag, review.Batch}
+				s.saveAnalysis(ctx, analysis, cfg)
+				entry.AnalysisID = analysis.ID
+			}
+			entry.Action = analysis.Action
+			entry.Confidence = analysis.Confidence
+			entry.Price = analysis.Price
+			entry.StopLoss = analysis.PriceTargets.StopLoss
+			entry.Reasoning = analysis.Reasoning
+			entry.Risks = analysis.Risks
+			return nil
+		})
+	}
+	g.Wait()
+
+	slices.SortStableFunc(review.Symbols, func(a, b models.RiskReviewEntry) int {
+		return cmp.Compare(riskReviewUrgency(b), riskReviewUrgency(a))
+	})
+	respondJSON(w, http.StatusOK, review)
+}
+
+// riskReviewUrgency orders review entries: SELLs above HOLDs, surer SELLs and less sure
+// HOLDs first, and failed symbols last
+func riskReviewUrgency(entry models.RiskReviewEntry) float64 {
+	switch {
+	case entry.Error != "":
+		return -1
+	case entry.Action == "SELL":
+		return 1 + entry.Confidence
+	default:
+		return 1 - entry.Confidence
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// Symbol search limits; provider results are cached for an hour since listings rarely
+// change and autocomplete asks again on every pause in typing
+const (
+	defaultSearchLimit   = 10
+	maxSearchLimit       = 50
+	maxSearchQueryLength = 64
+	searchCacheTTL       = time.Hour
+	maxSearchCache       = 1000
+)
+
+// builtinSearchSource is the source of results from the built-in symbol list
+const builtinSearchSource = "builtin"
+
+// symbolSearchEntry is a cached provider search
+type symbolSearchEntry struct {
+	matches   []models.SymbolMatch
+	fetchedAt time.Time
+}
+
+// SymbolSearchResult is the answer to a symbol search
+type SymbolSearchResult struct {
+	Query   string               `json:"query"`
+	Source  string               `json:"source"` // the provider searched, or "builtin"
+	Matches []models.SymbolMatch `json:"matches"`
+	// ProviderError is why the provider's search failed, when the built-in list
+	// answered in its place
+	ProviderError string `json:"provider_error,omitempty"`
+}
+
+// SearchSymbols looks up tickers by symbol or company name with the profile's market
+// data provider, answering from the built-in symbol list when the provider has no
+// search endpoint or its search fails. At most limit matches are returned.
+func (s *Server) SearchSymbols(ctx context.Context, cfg *models.UserConfig, query string, limit int) (*SymbolSearchResult, error) {
+	query = strings.TrimSpace(query)
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SymbolSearchResult{Query: query, Source: builtinSearchSource}
+	matches, err := s.providerSymbolSearch(ctx, provider, query)
+	switch {
+	case err == nil:
+		result.Source = provider.Name()
+	case !errors.Is(err, market.ErrNotSupported):
+		slog.WarnContext(ctx, "symbol search failed, using the built-in list", "provider", provider.Name(), "query", query, "error", err)
+		result.ProviderError = err.Error()
+		fallthrough
+	default:
+		matches = market.SearchKnownSymbols(query, limit)
+	}
+	result.Matches = matches[:min(len(matches), limit)]
+	return result, nil
+}
+
+// providerSymbolSearch searches with provider, served from a cache. Only matches with
+// symbols NormalizeSymbol accepts are returned, so any of them can be tracked.
+func (s *Server) providerSymbolSearch(ctx context.Context, provider market.Provider, query string) ([]models.SymbolMatch, error) {
+	ss, ok := provider.(market.SymbolSearcher)
+	if !ok {
+		return nil, market.ErrNotSupported
+	}
+	key := provider.Name() + ":" + strings.ToLower(query)
+
+	s.searchMu.Lock()
+	entry, ok := s.searchCache[key]
+	s.searchMu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < searchCacheTTL {
+		return entry.matches, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.QuoteTimeout)
+	defer cancel()
+	matches, err := ss.SearchSymbols(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	matches = market.NormalizeMatches(matches)
+
+	s.searchMu.Lock()
+	if len(s.searchCache) >= maxSearchCache {
+		for k, e := range s.searchCache {
+			if time.Since(e.fetchedAt) >= searchCacheTTL {
+				delete(s.searchCache, k)
+			}
+		}
+		if len(s.searchCache) >= maxSearchCache {
+			clear(s.searchCache)
+		}
+	}
+	s.searchCache[key] = symbolSearchEntry{matches: matches, fetchedAt: time.Now()}
+	s.searchMu.Unlock()
+	return matches, nil
+}
+
+// handleSymbolSearch finds tickers by symbol or company name (GET
+// /api/search?q=apple&limit=), for autocomplete
+func (s *Server) handleSymbolSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		respondError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if len(query) > maxSearchQueryLength {
+		respondError(w, http.StatusBadRequest, "q must be at most "+strconv.Itoa(maxSearchQueryLength)+" characters")
+		return
+	}
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			respondError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxSearchLimit))
+			return
+		}
+		limit = n
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	result, err := s.SearchSymbols(r.Context(), cfg, query, limit)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
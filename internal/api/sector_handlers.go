@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"stockmarket/internal/analytics"
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// tradingDaysPerWeek is the lookback used for weekly sector returns
+const tradingDaysPerWeek = 5
+
+// sectorEntry is a cached sector performance load
+type sectorEntry struct {
+	results   []models.SectorPerformance
+	fetchedAt time.Time
+}
+
+// handleSectors returns daily and weekly performance for each configured sector ETF
+func (s *Server) handleSectors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	respondJSON(w, http.StatusOK, s.sectorPerformance(ctx, provider))
+}
+
+// sectorPerformance computes sector returns from the configured sector ETFs, served
+// from a short-lived cache per provider. Sectors whose data fails to load are returned
+// with an error, and a load with any failures isn't cached so the next request retries.
+func (s *Server) sectorPerformance(ctx context.Context, provider market.Provider) []models.SectorPerformance {
+	s.sectorsMu.Lock()
+	entry, ok := s.sectors[provider.Name()]
+	s.sectorsMu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < s.config.SectorCacheTTL {
+		return entry.results
+	}
+
+	results := make([]models.SectorPerformance, len(s.config.SectorETFs))
+	var wg sync.WaitGroup
+	for i, etf := range s.config.SectorETFs {
+		wg.Add(1)
+		go func(i int, sector, symbol string) {
+			defer wg.Done()
+			results[i] = fetchSector(ctx, provider, sector, symbol)
+		}(i, etf.Sector, etf.Symbol)
+	}
+	wg.Wait()
+
+	if slices.ContainsFunc(results, func(sp models.SectorPerformance) bool { return sp.Error != "" }) {
+		return results
+	}
+	s.sectorsMu.Lock()
+	s.sectors[provider.Name()] = sectorEntry{results: results, fetchedAt: time.Now()}
+	s.sectorsMu.Unlock()
+	return results
+}
+
+// fetchSector loads one sector ETF's daily change and weekly return
+func fetchSector(ctx context.Context, provider market.Provider, sector, symbol string) models.SectorPerformance {
+	perf := models.SectorPerformance{Sector: sector, Symbol: symbol}
+
+	quote, err := provider.GetQuote(ctx, symbol)
+	if err != nil {
+		slog.Warn("failed to load sector", "sector", sector, "symbol", symbol, "error", err)
+		perf.Error = err.Error()
+		return perf
+	}
+	perf.Price = quote.Price
+	perf.DailyReturn = math.Round(quote.ChangePercent*100) / 100
+
+	if candles, err := market.AdjustedHistory(ctx, provider, symbol, "1m", ""); err == nil {
+		if weekly, ok := analytics.PeriodReturn(candles, tradingDaysPerWeek); ok {
+			weekly = math.Round(weekly*100) / 100
+			perf.WeeklyReturn = &weekly
+		}
+	}
+	return perf
+}
+
+// formatSectorContext summarizes sector performance for the analysis prompt
+func formatSectorContext(sectors []models.SectorPerformance) string {
+	summary := ""
+	for _, sp := range sectors {
+		if sp.Error != "" {
+			continue
+		}
+		summary += fmt.Sprintf("- %s (%s): %+.2f%% today", sp.Sector, sp.Symbol, sp.DailyReturn)
+		if sp.WeeklyReturn != nil {
+			summary += fmt.Sprintf(", %+.2f%% this week", *sp.WeeklyReturn)
+		}
+		summary += "\n"
+	}
+	return summary
+}
@@ -1,13 +1,21 @@
 package api
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gorilla/websocket"
 
+	"stockmarket/internal/ai"
 	"stockmarket/internal/config"
 	"stockmarket/internal/db"
+	"stockmarket/internal/market"
 	"stockmarket/internal/notify"
 )
 
@@ -16,8 +24,10 @@ const (
 	HEADER_CONTENT_TYPE = "Content-Type"
 
 	// Content Types
-	CONTENT_TYPE_HTML = "text/html"
-	CONTENT_TYPE_JSON = "application/json"
+	CONTENT_TYPE_HTML  = "text/html"
+	CONTENT_TYPE_JSON  = "application/json"
+	CONTENT_TYPE_JSONL = "application/x-ndjson"
+	CONTENT_TYPE_CSV   = "text/csv"
 
 	// HTTP Status Codes
 	METHOD_NOT_ALLOWED = "Method not allowed"
@@ -35,7 +45,10 @@ const (
 	FAILED_TO_GET_HISTORICAL_DATA = "Failed to get historical data"
 	FAILED_TO_GET_QUOTE           = "Failed to get quote"
 	FAILED_TO_UPDATE_CONFIG       = "Failed to update config"
+	BUDGET_EXCEEDED               = "BUDGET_EXCEEDED: monthly AI budget reached"
+	CONFIG_CONFLICT               = "Config was modified by another update; reload and retry"
 	INVALID_ALERT_ID              = "Invalid alert ID"
+	INVALID_DETAIL_LEVEL          = "detail_level must be one of brief, standard, detailed"
 	INVALID_POLLING_INTERVAL      = "Invalid polling interval"
 	INVALID_PRICE                 = "Invalid price"
 	SYMBOL_REQUIRED               = "Symbol is required"
@@ -46,82 +59,264 @@ type Server struct {
 	db            *db.DB
 	config        *config.Config
 	notifyService *notify.Service
-	clients       map[*websocket.Conn]bool
+	webhook       *notify.AnalysisWebhook
+	health        *market.HealthTracker
+	quoteCache    *market.QuoteCache            // shared by every provider built per request
+	discontinuity *market.DiscontinuityDetector // shared by the background polling service
+	yearRanges    map[string]yearRange          // daily-cached 52-week extremes for alerts
+	yearRangesMu  sync.Mutex
+	crossSides    map[int64]int // last side of the level (+1 above, -1 below) seen per crossing alert
+	crossSidesMu  sync.Mutex
+	moversCache   map[string]moversEntry // briefly cached screener results
+	moversMu      sync.Mutex
+	searchCache   map[string]symbolSearchEntry // provider search results by provider and query
+	searchMu      sync.Mutex
+	sectors       map[string]sectorEntry // cached sector ETF performance by provider
+	sectorsMu     sync.Mutex
+	clients       map[*websocket.Conn]*wsClient // connected clients broadcasts are queued for
 	clientsMu     sync.RWMutex
+	wsSessions    map[string]wsSubscriptionState // last subscriptions by client-presented session ID
+	wsSessionsMu  sync.Mutex
+	nextClientID  atomic.Uint64
 	upgrader      websocket.Upgrader
+
+	alertCreateMu sync.Mutex               // serializes alert creation so double submits can't both pass the duplicate checks
+	jobWake       map[string]chan struct{} // wakes an idle worker of each job type when one is queued
+
+	routes         []string       // the patterns SetupRoutes registered, for the OpenAPI coverage check
+	apiLimiter     *ipRateLimiter // nil when unlimited
+	analyzeLimiter *ipRateLimiter
+	analysisCache  *analysisCache
+	analysisJobs   *analysisJobs
+	metrics        *metricsCollector
+	aiBreaker      *aiBreaker
+
+	newMarketProvider MarketProviderFactory
+	newAnalyzer       AnalyzerFactory
+}
+
+// MarketProviderFactory builds a market data provider by name with its API key
+type MarketProviderFactory func(name, apiKey string) (market.Provider, error)
+
+// AnalyzerFactory builds an AI analyzer by provider name with its API key and model
+type AnalyzerFactory func(provider, apiKey, model string) (ai.Analyzer, error)
+
+// ServerOption customizes a Server built by NewServer
+type ServerOption func(*Server)
+
+// WithMarketProvider makes the server build market data providers with factory
+// instead of market.NewProvider, e.g. to serve fakes without network access
+func WithMarketProvider(factory MarketProviderFactory) ServerOption {
+	return func(s *Server) {
+		s.newMarketProvider = factory
+	}
+}
+
+// WithAnalyzer makes the server build AI analyzers with factory instead of ai.NewAnalyzer
+func WithAnalyzer(factory AnalyzerFactory) ServerOption {
+	return func(s *Server) {
+		s.newAnalyzer = factory
+	}
 }
 
 // NewServer creates a new API server
-func NewServer(database *db.DB, cfg *config.Config) *Server {
+func NewServer(database *db.DB, cfg *config.Config, opts ...ServerOption) *Server {
 	// Initialize notification service with notifiers
-	notifyService := notify.NewService()
+	notifyService := notify.NewService(cfg.NotifyWorkers, cfg.NotifyQueueSize)
 	notifyService.RegisterNotifier(notify.NewEmailNotifier(map[string]string{}))
 	notifyService.RegisterNotifier(notify.NewDiscordNotifier())
 	notifyService.RegisterNotifier(notify.NewSMSNotifier(map[string]string{}))
+	notifyService.RegisterNotifier(notify.NewSlackNotifier())
+	notifyService.RegisterNotifier(notify.NewWebhookNotifier())
+	notifyService.RegisterNotifier(notify.NewTelegramNotifier())
+	notifyService.SetDeliveryPolicy(cfg.NotifySendTimeout, cfg.NotifyRetries, cfg.NotifyRetryBackoff)
+	for channel, limit := range cfg.NotifyRateLimits {
+		notifyService.SetRateLimit(channel, limit.Burst, limit.Interval, limit.QueueSize, limit.Overflow)
+	}
+	if cfg.QuietHoursStart != "" {
+		if err := notifyService.SetQuietHours(cfg.QuietHoursStart, cfg.QuietHoursEnd, cfg.QuietHoursLocation, cfg.QuietHoursMode); err != nil {
+			slog.Error("quiet hours disabled", "error", err)
+		}
+	}
+
+	// Outbound analysis webhook is optional
+	var webhook *notify.AnalysisWebhook
+	if cfg.AnalysisWebhookURL != "" {
+		webhook = notify.NewAnalysisWebhook(cfg.AnalysisWebhookURL, cfg.AnalysisWebhookActions, cfg.AnalysisWebhookMinConfidence)
+	}
+
+	s := &Server{
+		db:             database,
+		config:         cfg,
+		notifyService:  notifyService,
+		webhook:        webhook,
+		health:         market.NewHealthTracker(),
+		quoteCache:     market.NewQuoteCache(cfg.QuoteCacheTTL, cfg.HistoricalCacheTTL, cfg.FundamentalsCacheTTL),
+		discontinuity:  market.NewDiscontinuityDetector(cfg.StreamSplitTolerance),
+		yearRanges:     make(map[string]yearRange),
+		crossSides:     make(map[int64]int),
+		moversCache:    make(map[string]moversEntry),
+		searchCache:    make(map[string]symbolSearchEntry),
+		sectors:        make(map[string]sectorEntry),
+		clients:        make(map[*websocket.Conn]*wsClient),
+		wsSessions:     make(map[string]wsSubscriptionState),
+		jobWake:        make(map[string]chan struct{}),
+		apiLimiter:     newIPRateLimiter(cfg.APIRateLimit, cfg.APIRateBurst),
+		analyzeLimiter: newIPRateLimiter(cfg.AnalyzeRateLimit, cfg.AnalyzeRateBurst),
+		analysisCache:  newAnalysisCache(cfg.AnalysisCacheTTL, cfg.AnalysisCacheMaxMove),
+		analysisJobs:   newAnalysisJobs(),
+		metrics:        newMetricsCollector(),
+		aiBreaker:      newAIBreaker(cfg.AIBreakerThreshold, cfg.AIBreakerWindow, cfg.AIBreakerCooldown),
 
-	return &Server{
-		db:            database,
-		config:        cfg,
-		notifyService: notifyService,
-		clients:       make(map[*websocket.Conn]bool),
-		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins in development
-			},
-		},
+		newMarketProvider: market.NewProvider,
+		newAnalyzer:       ai.NewAnalyzer,
+	}
+	for _, jobType := range jobTypes {
+		s.jobWake[jobType] = make(chan struct{}, 1)
+	}
+	s.upgrader.CheckOrigin = s.checkWebSocketOrigin
+	for _, opt := range opts {
+		opt(s)
+	}
+	if cfg.HistoricalCachePersist {
+		s.quoteCache.SetHistoryStore(database)
 	}
+	notifyService.SetDeliveryRecorder(s.recordDelivery)
+	return s
 }
 
-// SetupRoutes sets up all API routes
+// DrainNotifications flushes queued notifications before shutdown, bounded by ctx
+func (s *Server) DrainNotifications(ctx context.Context) {
+	s.notifyService.Drain(ctx)
+}
+
+// SetupRoutes sets up all API routes, each recorded in the request metrics, and warns
+// about any the OpenAPI document misses
 func (s *Server) SetupRoutes(mux *http.ServeMux) {
-	// Health check
-	mux.HandleFunc("/api/health", s.handleHealth)
+	var patterns []string
+	handle := func(pattern string, handler http.HandlerFunc) {
+		patterns = append(patterns, pattern)
+		mux.HandleFunc(pattern, s.instrument(pattern, handler))
+	}
+
+	// Health check, metrics and API description
+	handle("/api/health", s.handleHealth)
+	handle("/api/metrics", s.handleMetrics)
+	handle("/api/openapi.json", s.handleOpenAPI)
+	if s.config.MetricsPrometheus {
+		mux.HandleFunc("/metrics", s.handlePrometheusMetrics)
+	}
 
 	// Configuration (JSON API)
-	mux.HandleFunc("/api/config", s.handleConfig)
+	handle("/api/config", ETag(s.handleConfig))
 
 	// Configuration (HTMX form handlers)
-	mux.HandleFunc("/api/config/market", s.handleConfigMarket)
-	mux.HandleFunc("/api/config/ai", s.handleConfigAI)
-	mux.HandleFunc("/api/config/strategy", s.handleConfigStrategy)
-	mux.HandleFunc("/api/config/watchlist", s.handleConfigWatchlist)
-	mux.HandleFunc("/api/config/watchlist/", s.handleConfigWatchlistSymbol)
-	mux.HandleFunc("/api/config/polling", s.handleConfigPolling)
-	mux.HandleFunc("/api/config/notifications", s.handleConfigNotifications)
+	handle("/api/config/market", s.handleConfigMarket)
+	handle("/api/config/ai", s.handleConfigAI)
+	handle("/api/config/strategy", s.handleConfigStrategy)
+	handle("/api/config/watchlist", s.handleConfigWatchlist)
+	handle("/api/config/watchlist/", s.handleConfigWatchlistSymbol)
+	handle("/api/watchlist/groups", s.handleWatchlistGroups)
+	handle("/api/watchlist/groups/", s.handleWatchlistGroup)
+	handle("/api/config/polling", s.handleConfigPolling)
+	handle("/api/config/notifications", s.handleConfigNotifications)
+	handle("/api/config/profiles", s.handleConfigProfiles)
+	handle("/api/config/profiles/switch", s.handleConfigProfileSwitch)
 
 	// Market data
-	mux.HandleFunc("/api/quote/", s.handleQuote)
-	mux.HandleFunc("/api/historical/", s.handleHistorical)
+	handle("/api/quote/", s.handleQuote)
+	handle("/api/quotes", s.handleQuotes)
+	handle("/api/historical/", ETag(s.handleHistorical))
+	handle("/api/levels/", s.handleLevels)
+	handle("/api/vwap/", s.handleVWAP)
+	handle("/api/beta/", s.handleBeta)
+	handle("/api/correlation", s.handleCorrelation)
+	handle("/api/transcript/", s.handleTranscript)
+	handle("/api/provider-health", s.handleProviderHealth)
+	handle("/api/providers", s.handleProviders)
+	handle("/api/validate-key", s.handleValidateKey)
+	handle("/api/market-status", s.handleMarketStatus)
+	handle("/api/dashboard", s.handleDashboard)
+	handle("/api/overview", s.handleOverview)
+	handle("/api/movers", s.handleMovers)
+	handle("/api/search", s.handleSymbolSearch)
+	handle("/api/sectors", s.handleSectors)
+	handle("/api/dividend-screen", s.handleDividendScreen)
 
 	// Analysis (JSON API)
-	mux.HandleFunc("/api/analyze/", s.handleAnalyze)
-	mux.HandleFunc("/api/analyses", s.handleAnalyses)
-	mux.HandleFunc("/api/analyses/", s.handleAnalysesForSymbol)
+	handle("/api/analyze/", s.handleAnalyze)
+	handle("/api/analyze/portfolio", s.handleRiskReview)
+	handle("/api/analyze/jobs/", s.handleAnalysisJob)
+	handle("/api/analyses", ETag(s.handleAnalyses))
+	handle("/api/usage", s.handleUsage)
+	handle("/api/analyses/", s.handleAnalysesForSymbol)
+	handle("/api/analyses/export", s.handleAnalysesExport)
 
 	// Analysis (HTMX)
-	mux.HandleFunc("/api/analyze", s.handleAnalyzeHTMX)
+	handle("/api/analyze", s.handleAnalyzeHTMX)
 
 	// Alerts (JSON API)
-	mux.HandleFunc("/api/alerts", s.handleAlertsHTMX)       // Changed to HTMX handler
-	mux.HandleFunc("/api/alerts/", s.handleAlertDeleteHTMX) // Changed to HTMX handler
+	handle("/api/alerts", s.handleAlertsHTMX)       // Changed to HTMX handler
+	handle("/api/alerts/", s.handleAlertDeleteHTMX) // Changed to HTMX handler
+	handle("/api/alerts/from-analysis/", s.handleAlertsFromAnalysis)
+	handle("/api/alerts/duplicates", s.handleAlertDuplicates)
+	handle("/api/alerts/merge", s.handleAlertMerge)
+	handle("/api/alerts/bulk", s.handleAlertsBulk)
+
+	// Bulk export
+	handle("/api/export/analyses.jsonl", s.handleExportAnalyses)
+	handle("/api/export/snapshots.jsonl", s.handleExportSnapshots)
+	handle("/api/export", s.handleExportBackup)
+	handle("/api/import", s.handleImportBackup)
+	handle("/api/admin/rotate-key", s.handleRotateKey)
+	handle("/api/admin/prune", s.handlePrune)
+	handle("/api/admin/prompt-templates", s.handlePromptTemplates)
+	handle("/api/admin/prompt-templates/", s.handlePromptTemplate)
+
+	// Positions
+	handle("/api/positions", s.handlePositions)
+	handle("/api/positions/", s.handlePosition)
+	handle("/api/portfolio", s.handlePortfolio)
+	handle("/api/portfolio/partial", s.handlePortfolioHTMX)
+
+	// Backtesting
+	handle("/api/backtest/", s.handleBacktest)
 
 	// Notification channels
-	mux.HandleFunc("/api/notification-channels", s.handleNotificationChannels)
-	mux.HandleFunc("/api/notification-channels/", s.handleNotificationChannelDelete)
+	handle("/api/notification-channels", s.handleNotificationChannels)
+	handle("/api/notification-channels/", s.handleNotificationChannelDelete)
+	handle("/api/notification-channels/{id}/test", s.handleNotificationChannelTest)
+	handle("/api/notifications/log", s.handleNotificationLog)
+
+	// Background jobs
+	handle("/api/jobs", s.handleJobs)
 
 	// WebSocket for real-time updates
-	mux.HandleFunc("/api/ws", s.handleWebSocket)
+	handle("/api/ws", s.handleWebSocket)
 
 	// Risk and frequency profiles
-	mux.HandleFunc("/api/profiles", s.handleProfiles)
+	handle("/api/profiles", s.handleProfiles)
+
+	s.routes = patterns
+	checkOpenAPICoverage(patterns)
 }
 
-// CORS middleware
-func corsMiddleware(next http.Handler) http.Handler {
+// CORS adds CORS headers for allowed origins. A request's Origin is echoed back when
+// it's in CORS_ALLOWED_ORIGINS; "*" there, or no origins configured in development,
+// allows any origin. Other origins get no CORS headers, so browsers block them.
+func (s *Server) CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		if origin := s.allowedOrigin(r.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if origin != "*" {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Profile-ID, X-Request-ID, Idempotency-Key, If-None-Match, HX-Request, HX-Target, HX-Trigger")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, ETag")
+		}
+		// The response depends on Origin whenever it's echoed back
+		w.Header().Add("Vary", "Origin")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -131,3 +326,32 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request origin, or
+// "" when the origin isn't allowed
+func (s *Server) allowedOrigin(origin string) string {
+	allowed := s.config.CORSAllowedOrigins
+	if len(allowed) == 0 && s.config.Environment == "development" {
+		return "*"
+	}
+	if slices.Contains(allowed, "*") {
+		return "*"
+	}
+	if origin != "" && slices.Contains(allowed, strings.ToLower(strings.TrimSuffix(origin, "/"))) {
+		return origin
+	}
+	return ""
+}
+
+// checkWebSocketOrigin allows a WebSocket upgrade from the server's own pages, from
+// clients that send no Origin, and from the origins CORS allows
+func (s *Server) checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return s.allowedOrigin(origin) != ""
+}
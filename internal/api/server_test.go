@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"stockmarket/internal/config"
+	"stockmarket/internal/db"
+	"stockmarket/internal/models"
+)
+
+// newTestServer builds a Server with its routes on a fresh database and the default
+// configuration, the default profile set to the mock market and AI providers. opts can
+// swap the provider factories for fakes.
+func newTestServer(t *testing.T, opts ...ServerOption) (*Server, *http.ServeMux) {
+	t.Helper()
+	database, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userConfig, err := database.GetOrCreateConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userConfig.MarketDataProvider, userConfig.AIProvider = "mock", "mock"
+	if err := database.UpdateConfig(userConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(database, cfg, opts...)
+	mux := http.NewServeMux()
+	s.SetupRoutes(mux)
+	return s, mux
+}
+
+// testConfig returns the test server's default profile config
+func testConfig(t *testing.T, s *Server) *models.UserConfig {
+	t.Helper()
+	cfg, err := s.db.GetOrCreateConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// serve sends a request through handler and returns the recorded response
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	return rec
+}
+
+// TestWebSocketOrigin checks that WebSocket upgrades are held to the CORS allow-list,
+// apart from the server's own pages and clients that send no Origin
+func TestWebSocketOrigin(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.config.CORSAllowedOrigins = []string{"https://app.example.com"}
+
+	for _, tc := range []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://example.com", true},
+		{"https://app.example.com", true},
+		{"https://evil.example.net", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/api/ws", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if got := s.upgrader.CheckOrigin(r); got != tc.want {
+			t.Errorf("origin %q: allowed = %v, want %v", tc.origin, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deletedPurgeInterval is how often soft-deleted rows past SOFT_DELETE_RETENTION are purged
+const deletedPurgeInterval = time.Hour
+
+// handleAlertRestore restores a deleted alert (POST /api/alerts/{id}/restore)
+func (s *Server) handleAlertRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/alerts/"), "/restore")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, INVALID_ALERT_ID)
+		return
+	}
+	profileID, err := s.requestProfileID(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.db.RestorePriceAlert(id, profileID); errors.Is(err, sql.ErrNoRows) {
+		respondError(w, http.StatusNotFound, "No deleted alert with that ID")
+		return
+	} else if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "restored"})
+}
+
+// handleAnalysisRestore restores a deleted analysis (POST /api/analyses/{id}/restore)
+func (s *Server) handleAnalysisRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/analyses/"), "/restore")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid analysis ID")
+		return
+	}
+
+	if err := s.db.RestoreAnalysis(id); errors.Is(err, sql.ErrNoRows) {
+		respondError(w, http.StatusNotFound, "No deleted analysis with that ID")
+		return
+	} else if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "restored"})
+}
+
+// StartDeletedPurge periodically hard-deletes alerts and analyses that were soft-deleted
+// longer than SOFT_DELETE_RETENTION ago
+func (s *Server) StartDeletedPurge(ctx context.Context) {
+	if s.config.SoftDeleteRetention <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(deletedPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				alerts, analyses, err := s.db.PurgeDeleted(time.Now().Add(-s.config.SoftDeleteRetention))
+				if err != nil {
+					slog.Error("failed to purge deleted rows", "error", err)
+				} else if alerts > 0 || analyses > 0 {
+					slog.Info("purged deleted rows", "alerts", alerts, "analyses", analyses)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"stockmarket/internal/ai"
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// handleTranscript returns the raw earnings-call transcript for a symbol
+func (s *Server) handleTranscript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	symbol, err := market.NormalizeSymbol(strings.TrimPrefix(r.URL.Path, "/api/transcript/"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	symbol = market.ResolveSymbol(symbol, cfg.SymbolAliases)
+
+	quarter := strings.ToUpper(r.URL.Query().Get("quarter"))
+	if quarter == "" {
+		quarter = market.PreviousQuarter(time.Now())
+	}
+
+	provider, err := s.marketProvider(cfg)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	transcript, err := s.loadTranscript(ctx, provider, symbol, quarter)
+	if err == market.ErrNotSupported {
+		respondError(w, http.StatusNotImplemented, "Transcripts are not available from "+provider.Name())
+		return
+	}
+	if err != nil {
+		respondErr(w, http.StatusNotFound, fmt.Errorf("Transcript not available: %w", err))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, transcript)
+}
+
+// loadTranscript returns a transcript from the database cache, fetching and caching it on a miss
+func (s *Server) loadTranscript(ctx context.Context, provider market.Provider, symbol, quarter string) (*models.EarningsTranscript, error) {
+	if cached, err := s.db.GetTranscript(symbol, quarter); err == nil {
+		return cached, nil
+	}
+
+	tp, ok := provider.(market.TranscriptProvider)
+	if !ok {
+		return nil, market.ErrNotSupported
+	}
+
+	transcript, err := tp.GetEarningsTranscript(ctx, symbol, quarter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.SaveTranscript(transcript); err != nil {
+		slog.Error("failed to cache transcript", "symbol", symbol, "quarter", quarter, "error", err)
+	}
+	return transcript, nil
+}
+
+// transcriptSummary returns a sentiment summary of the latest earnings call for the
+// analysis prompt. It returns "" (and the analysis proceeds without it) when the
+// transcript or summarization is unavailable.
+func (s *Server) transcriptSummary(ctx context.Context, provider market.Provider, analyzer ai.Analyzer, symbol string) string {
+	quarter := market.PreviousQuarter(time.Now())
+
+	transcript, err := s.loadTranscript(ctx, provider, symbol, quarter)
+	if err != nil {
+		slog.Warn("skipping transcript sentiment", "symbol", symbol, "quarter", quarter, "error", err)
+		return ""
+	}
+	if transcript.Summary != "" {
+		return transcript.Summary
+	}
+
+	completer, ok := analyzer.(ai.Completer)
+	if !ok {
+		return ""
+	}
+	if err := s.checkBudget(); err != nil {
+		slog.Warn("skipping transcript summary", "symbol", symbol, "quarter", quarter, "error", err)
+		return ""
+	}
+
+	summary, err := ai.SummarizeTranscript(ctx, completer, symbol, quarter, transcript.Transcript)
+	if err != nil {
+		slog.Error("failed to summarize transcript", "symbol", symbol, "quarter", quarter, "error", err)
+		return ""
+	}
+
+	transcript.Summary = summary
+	if err := s.db.SaveTranscript(transcript); err != nil {
+		slog.Error("failed to cache transcript summary", "symbol", symbol, "quarter", quarter, "error", err)
+	}
+	return summary
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"stockmarket/internal/apperr"
+	"stockmarket/internal/models"
+)
+
+// errBudgetExceeded is returned instead of calling the AI provider once the monthly cap is reached
+var errBudgetExceeded = apperr.New(apperr.BudgetExceeded, BUDGET_EXCEEDED)
+
+// RecordUsage stores the token usage of an AI completion
+func (s *Server) RecordUsage(u models.AIUsage) {
+	if err := s.db.SaveAIUsage(u); err != nil {
+		slog.Error("failed to record AI usage", "provider", u.Provider, "model", u.Model, "error", err)
+	}
+}
+
+// monthStart is the start of the current calendar month in the configured timezone
+func (s *Server) monthStart() time.Time {
+	now := time.Now().In(s.config.Location)
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, s.config.Location)
+}
+
+// checkBudget returns errBudgetExceeded when this month's AI spend has reached the cap
+func (s *Server) checkBudget() error {
+	if s.config.AIMonthlyBudget <= 0 {
+		return nil
+	}
+	spend, err := s.db.GetAISpendSince(s.monthStart())
+	if err != nil {
+		slog.Warn("failed to load AI spend, allowing call", "error", err)
+		return nil
+	}
+	if spend >= s.config.AIMonthlyBudget {
+		return fmt.Errorf("%w ($%.2f of $%.2f spent this month)", errBudgetExceeded, spend, s.config.AIMonthlyBudget)
+	}
+	return nil
+}
+
+// handleUsage reports AI token usage and estimated spend in a ?from=&to= range
+// (default: this month), both per model and totalled across saved analyses
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	from, to, err := exportRange(r)
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+	if r.URL.Query().Get("from") == "" {
+		from = s.monthStart()
+	}
+
+	usage, err := s.db.GetAIUsageBetween(from, to)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	analyses, err := s.db.GetAnalysisUsage(from, to)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var spend float64
+	for _, u := range usage {
+		spend += u.Cost
+	}
+	if usage == nil {
+		usage = []models.AIUsage{}
+	}
+
+	resp := map[string]interface{}{
+		"month_start": s.monthStart(), // the start of the budget month, whatever the range
+		"from":        from,
+		"to":          to,
+		"spend":       spend,
+		"by_model":    usage,
+		"analyses":    analyses,
+	}
+	if s.config.AIMonthlyBudget > 0 {
+		monthSpend, err := s.db.GetAISpendSince(s.monthStart())
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err)
+			return
+		}
+		resp["budget"] = s.config.AIMonthlyBudget
+		resp["remaining"] = max(s.config.AIMonthlyBudget-monthSpend, 0)
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestUsageMonthStart checks that /api/usage keeps reporting month_start alongside the
+// requested range
+func TestUsageMonthStart(t *testing.T) {
+	s, mux := newTestServer(t)
+	rec := serve(mux, httptest.NewRequest(http.MethodGet, "/api/usage?from=2024-01-01T00:00:00Z", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		MonthStart time.Time `json:"month_start"`
+		From       time.Time `json:"from"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.MonthStart.Equal(s.monthStart()) {
+		t.Errorf("month_start = %v, want %v", resp.MonthStart, s.monthStart())
+	}
+	if resp.From.Year() != 2024 {
+		t.Errorf("from = %v, want the requested 2024-01-01", resp.From)
+	}
+}
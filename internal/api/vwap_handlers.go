@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"stockmarket/internal/indicators"
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// handleVWAP returns a symbol's current-session VWAP and where the latest price sits against it
+func (s *Server) handleVWAP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	symbol, err := market.NormalizeSymbol(strings.TrimPrefix(r.URL.Path, "/api/vwap/"))
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	vwap, candles, err := s.intradayVWAP(ctx, cfg, symbol)
+	if err != nil {
+		respondErr(w, providerErrorStatus(err), err)
+		return
+	}
+
+	last := candles[0]
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"symbol":       symbol,
+		"vwap":         vwap,
+		"price":        last.Close,
+		"distance_pct": (last.Close/vwap - 1) * 100,
+		"as_of":        last.Timestamp,
+	})
+}
+
+// intradayVWAP computes a symbol's current-session VWAP from one day of 5-minute bars
+// fetched from the intraday provider, returning the bars with it, newest first as
+// providers send them
+func (s *Server) intradayVWAP(ctx context.Context, cfg *models.UserConfig, symbol string) (float64, []models.Candle, error) {
+	provider, err := s.requestMarketProvider(cfg, s.config.IntradayProvider)
+	if err != nil {
+		return 0, nil, err
+	}
+	candles, err := market.AdjustedHistory(ctx, provider, symbol, "1d", "")
+	if err != nil {
+		return 0, nil, err
+	}
+	ascending := slices.Clone(candles)
+	slices.Reverse(ascending)
+	vwap, err := indicators.VWAP(ascending)
+	if err != nil {
+		return 0, nil, err
+	}
+	return vwap[len(vwap)-1], candles, nil
+}
+
+// levelCrossed records which side of a level (VWAP or a crossing alert's price) a price
+// is on for an alert and reports whether it moved to the other side since the last
+// check. The first check only sets the side, and a price at the level keeps it.
+func (s *Server) levelCrossed(alertID int64, price, level float64) (string, bool) {
+	side := int(math.Copysign(1, price-level))
+	if price == level {
+		return "", false
+	}
+
+	s.crossSidesMu.Lock()
+	defer s.crossSidesMu.Unlock()
+	prev, seen := s.crossSides[alertID]
+	s.crossSides[alertID] = side
+	if !seen || prev == side {
+		return "", false
+	}
+	if side > 0 {
+		return "above", true
+	}
+	return "below", true
+}
+
+// forgetCrossSides drops the recorded sides of alerts that were deleted, merged away,
+// expired, fired for good or given a new level
+func (s *Server) forgetCrossSides(alertIDs ...int64) {
+	s.crossSidesMu.Lock()
+	defer s.crossSidesMu.Unlock()
+	for _, id := range alertIDs {
+		delete(s.crossSides, id)
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"stockmarket/internal/market"
+	"stockmarket/internal/models"
+)
+
+// historyProvider is the mock provider serving fixed candles, newest first as real
+// providers send them
+type historyProvider struct {
+	*market.Mock
+	candles []models.Candle
+}
+
+func (p *historyProvider) GetHistoricalData(ctx context.Context, symbol, period, interval string) ([]models.Candle, error) {
+	return p.candles, nil
+}
+
+func TestVWAPUsesLatestSession(t *testing.T) {
+	start := time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+	// Typical prices 9, 10 and 11 oldest first, so the session's VWAP is 4000/400 = 10,
+	// after a bar from the previous session that mustn't count
+	candles := []models.Candle{
+		{Timestamp: start.Add(10 * time.Minute), High: 12, Low: 10, Close: 11, Volume: 100},
+		{Timestamp: start.Add(5 * time.Minute), High: 11, Low: 9, Close: 10, Volume: 200},
+		{Timestamp: start, High: 10, Low: 8, Close: 9, Volume: 100},
+		{Timestamp: start.Add(-18 * time.Hour), High: 20, Low: 18, Close: 19, Volume: 500},
+	}
+	provider := &historyProvider{Mock: market.NewMock(), candles: candles}
+	_, mux := newTestServer(t, WithMarketProvider(func(name, apiKey string) (market.Provider, error) {
+		return provider, nil
+	}))
+
+	rec := serve(mux, httptest.NewRequest("GET", "/api/vwap/AAPL", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got struct {
+		VWAP  float64   `json:"vwap"`
+		Price float64   `json:"price"`
+		AsOf  time.Time `json:"as_of"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got.VWAP-10) > 1e-9 {
+		t.Errorf("vwap = %v, want 10", got.VWAP)
+	}
+	if got.Price != 11 || !got.AsOf.Equal(candles[0].Timestamp) {
+		t.Errorf("price %v as of %v, want the newest bar's 11 as of %v", got.Price, got.AsOf, candles[0].Timestamp)
+	}
+}
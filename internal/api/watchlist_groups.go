@@ -0,0 +1,328 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"stockmarket/internal/apperr"
+	"stockmarket/internal/db"
+	"stockmarket/internal/models"
+)
+
+// maxWatchlistGroupName bounds the length of a watchlist group's name
+const maxWatchlistGroupName = 40
+
+var (
+	errWatchlistGroupNotFound = apperr.New(apperr.NotFound, "Watchlist group not found")
+	errWatchlistGroupExists   = apperr.New(apperr.Conflict, "Watchlist group already exists")
+)
+
+// watchlistGroupInput is the body of POST /api/watchlist/groups and
+// PUT /api/watchlist/groups/{name}; on PUT, fields left out keep their value
+type watchlistGroupInput struct {
+	Name    string   `json:"name"`
+	Symbols []string `json:"symbols"`
+}
+
+// watchlistSections splits a profile's tracked symbols into its watchlist groups, in
+// their order, followed by "Ungrouped" with the tracked symbols in none. Group members
+// that are no longer tracked are left out; every section is listed, even when empty.
+func watchlistSections(cfg *models.UserConfig) []models.WatchlistGroup {
+	grouped := make(map[string]bool)
+	sections := make([]models.WatchlistGroup, 0, len(cfg.WatchlistGroups)+1)
+	for _, group := range cfg.WatchlistGroups {
+		section := models.WatchlistGroup{Name: group.Name, Symbols: []string{}}
+		for _, symbol := range group.Symbols {
+			if !grouped[symbol] && slices.Contains(cfg.TrackedSymbols, symbol) {
+				grouped[symbol] = true
+				section.Symbols = append(section.Symbols, symbol)
+			}
+		}
+		sections = append(sections, section)
+	}
+
+	ungrouped := models.WatchlistGroup{Name: models.UngroupedWatchlistGroup, Symbols: []string{}}
+	for _, symbol := range cfg.TrackedSymbols {
+		if !grouped[symbol] {
+			ungrouped.Symbols = append(ungrouped.Symbols, symbol)
+		}
+	}
+	return append(sections, ungrouped)
+}
+
+// watchlistSection returns the section of a profile's watchlist named name, matched
+// case-insensitively; "Ungrouped" is the tracked symbols in no group
+func watchlistSection(cfg *models.UserConfig, name string) (models.WatchlistGroup, error) {
+	for _, section := range watchlistSections(cfg) {
+		if strings.EqualFold(section.Name, strings.TrimSpace(name)) {
+			return section, nil
+		}
+	}
+	return models.WatchlistGroup{}, errWatchlistGroupNotFound
+}
+
+// requestWatchlistSymbols returns the tracked symbols a request covers: those in the
+// watchlist group named by its "group" parameter, or the whole watchlist without one
+func requestWatchlistSymbols(r *http.Request, cfg *models.UserConfig) ([]string, error) {
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		return cfg.TrackedSymbols, nil
+	}
+	section, err := watchlistSection(cfg, group)
+	if err != nil {
+		return nil, err
+	}
+	return section.Symbols, nil
+}
+
+// watchlistGroupIndex returns the index of the group named name, matched
+// case-insensitively, or -1
+func watchlistGroupIndex(cfg *models.UserConfig, name string) int {
+	return slices.IndexFunc(cfg.WatchlistGroups, func(group models.WatchlistGroup) bool {
+		return strings.EqualFold(group.Name, strings.TrimSpace(name))
+	})
+}
+
+// validateWatchlistGroupName trims a group name and checks it can be used in a URL path
+// and doesn't take the reserved "Ungrouped"
+func validateWatchlistGroupName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "", errors.New("name is required")
+	case len(name) > maxWatchlistGroupName:
+		return "", fmt.Errorf("name must be at most %d characters", maxWatchlistGroupName)
+	case strings.Contains(name, "/"):
+		return "", errors.New("name can't contain '/'")
+	case strings.EqualFold(name, models.UngroupedWatchlistGroup):
+		return "", fmt.Errorf("%q is reserved for symbols in no group", models.UngroupedWatchlistGroup)
+	}
+	return name, nil
+}
+
+// assignWatchlistGroup makes symbols the members of the group at index, moving them out
+// of any other group. Symbols that aren't tracked yet are added to the watchlist.
+func assignWatchlistGroup(cfg *models.UserConfig, index int, symbols []string) {
+	for i := range cfg.WatchlistGroups {
+		if i != index {
+			cfg.WatchlistGroups[i].Symbols = slices.DeleteFunc(cfg.WatchlistGroups[i].Symbols, func(symbol string) bool {
+				return slices.Contains(symbols, symbol)
+			})
+		}
+	}
+	cfg.WatchlistGroups[index].Symbols = symbols
+	for _, symbol := range symbols {
+		if !slices.Contains(cfg.TrackedSymbols, symbol) {
+			cfg.TrackedSymbols = append(cfg.TrackedSymbols, symbol)
+		}
+	}
+}
+
+// pruneWatchlistGroups drops symbols that are no longer tracked from every group, so
+// re-adding one later doesn't bring back its old group
+func pruneWatchlistGroups(cfg *models.UserConfig) {
+	for i := range cfg.WatchlistGroups {
+		cfg.WatchlistGroups[i].Symbols = slices.DeleteFunc(cfg.WatchlistGroups[i].Symbols, func(symbol string) bool {
+			return !slices.Contains(cfg.TrackedSymbols, symbol)
+		})
+	}
+}
+
+// normalizeWatchlistGroups validates imported watchlist groups, normalizing their
+// symbols; a symbol listed in several groups stays in the first
+func normalizeWatchlistGroups(groups []models.WatchlistGroup) ([]models.WatchlistGroup, error) {
+	result := make([]models.WatchlistGroup, 0, len(groups))
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		name, err := validateWatchlistGroupName(group.Name)
+		if err != nil {
+			return nil, err
+		}
+		if slices.IndexFunc(result, func(g models.WatchlistGroup) bool { return strings.EqualFold(g.Name, name) }) >= 0 {
+			return nil, fmt.Errorf("group %q is listed twice", name)
+		}
+		symbols, err := normalizeSymbols(group.Symbols)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %w", name, err)
+		}
+		symbols = slices.DeleteFunc(symbols, func(symbol string) bool { return seen[symbol] })
+		for _, symbol := range symbols {
+			seen[symbol] = true
+		}
+		result = append(result, models.WatchlistGroup{Name: name, Symbols: symbols})
+	}
+	return result, nil
+}
+
+// handleWatchlistGroups lists a profile's watchlist sections (GET /api/watchlist/groups)
+// or creates a group (POST /api/watchlist/groups)
+func (s *Server) handleWatchlistGroups(w http.ResponseWriter, r *http.Request) {
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, http.StatusOK, watchlistSections(cfg))
+
+	case http.MethodPost:
+		var input watchlistGroupInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			respondError(w, http.StatusBadRequest, INVALID_JSON)
+			return
+		}
+		name, err := validateWatchlistGroupName(input.Name)
+		if err != nil {
+			respondErr(w, http.StatusBadRequest, err)
+			return
+		}
+		if watchlistGroupIndex(cfg, name) >= 0 {
+			respondErr(w, http.StatusConflict, errWatchlistGroupExists)
+			return
+		}
+		symbols, err := normalizeSymbols(input.Symbols)
+		if err != nil {
+			respondErr(w, http.StatusBadRequest, fmt.Errorf("symbols: %w", err))
+			return
+		}
+
+		cfg.WatchlistGroups = append(cfg.WatchlistGroups, models.WatchlistGroup{Name: name})
+		assignWatchlistGroup(cfg, len(cfg.WatchlistGroups)-1, symbols)
+		s.saveWatchlistGroup(w, cfg, name, http.StatusCreated)
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+	}
+}
+
+// handleWatchlistGroup updates (PUT) or deletes (DELETE) one watchlist group, or starts
+// an analysis of its symbols (POST /api/watchlist/groups/{name}/analyze)
+func (s *Server) handleWatchlistGroup(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/analyze") {
+		s.handleWatchlistGroupAnalyze(w, r)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	index := watchlistGroupIndex(cfg, strings.TrimPrefix(r.URL.Path, "/api/watchlist/groups/"))
+
+	switch r.Method {
+	case http.MethodPut:
+		if index < 0 {
+			respondErr(w, http.StatusNotFound, errWatchlistGroupNotFound)
+			return
+		}
+		var input watchlistGroupInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			respondError(w, http.StatusBadRequest, INVALID_JSON)
+			return
+		}
+		if input.Name != "" {
+			name, err := validateWatchlistGroupName(input.Name)
+			if err != nil {
+				respondErr(w, http.StatusBadRequest, err)
+				return
+			}
+			if other := watchlistGroupIndex(cfg, name); other >= 0 && other != index {
+				respondErr(w, http.StatusConflict, errWatchlistGroupExists)
+				return
+			}
+			cfg.WatchlistGroups[index].Name = name
+		}
+		if input.Symbols != nil {
+			symbols, err := normalizeSymbols(input.Symbols)
+			if err != nil {
+				respondErr(w, http.StatusBadRequest, fmt.Errorf("symbols: %w", err))
+				return
+			}
+			assignWatchlistGroup(cfg, index, symbols)
+		}
+		s.saveWatchlistGroup(w, cfg, cfg.WatchlistGroups[index].Name, http.StatusOK)
+
+	case http.MethodDelete:
+		if index < 0 {
+			respondErr(w, http.StatusNotFound, errWatchlistGroupNotFound)
+			return
+		}
+		// Its symbols stay tracked, under "Ungrouped"
+		cfg.WatchlistGroups = slices.Delete(cfg.WatchlistGroups, index, index+1)
+		if err := s.db.UpdateConfig(cfg); err != nil {
+			respondWatchlistUpdateError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+	}
+}
+
+// handleWatchlistGroupAnalyze queues an analysis job for each of a watchlist group's
+// symbols (POST /api/watchlist/groups/{name}/analyze), regardless of market hours;
+// "Ungrouped" analyzes the symbols in no group. Symbols already waiting for an analysis
+// keep that job.
+func (s *Server) handleWatchlistGroupAnalyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED)
+		return
+	}
+
+	cfg, err := s.requestConfig(r)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/watchlist/groups/"), "/analyze")
+	section, err := watchlistSection(cfg, name)
+	if err != nil {
+		respondErr(w, http.StatusNotFound, err)
+		return
+	}
+	if len(section.Symbols) == 0 {
+		respondError(w, http.StatusBadRequest, "Watchlist group has no symbols")
+		return
+	}
+	jobs := s.enqueueAnalyses(cfg.ID, section.Symbols)
+
+	respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":  "queued",
+		"jobs":    jobs,
+		"group":   section.Name,
+		"symbols": section.Symbols,
+	})
+}
+
+// saveWatchlistGroup stores a profile's changed watchlist groups and responds with the
+// section of the group named name
+func (s *Server) saveWatchlistGroup(w http.ResponseWriter, cfg *models.UserConfig, name string, status int) {
+	if err := s.db.UpdateConfig(cfg); err != nil {
+		respondWatchlistUpdateError(w, err)
+		return
+	}
+	section, err := watchlistSection(cfg, name)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, status, section)
+}
+
+// respondWatchlistUpdateError reports a failed config update, asking the client to retry
+// when another update got there first
+func respondWatchlistUpdateError(w http.ResponseWriter, err error) {
+	if errors.Is(err, db.ErrConfigConflict) {
+		respondError(w, http.StatusConflict, CONFIG_CONFLICT)
+		return
+	}
+	respondErr(w, http.StatusInternalServerError, err)
+}
@@ -1,13 +1,19 @@
 package api
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"stockmarket/internal/apperr"
 	"stockmarket/internal/config"
 	"stockmarket/internal/market"
 	"stockmarket/internal/models"
@@ -17,62 +23,79 @@ import (
 
 const (
 	PRICE_ALERT = "Price Alert: %s"
+
+	// maxLoggedMessageBytes caps how much of a malformed client frame is logged
+	maxLoggedMessageBytes = 200
+
+	// wsWriteTimeout bounds every write so a dead connection can't block broadcasts
+	wsWriteTimeout = 10 * time.Second
+
+	// wsSendBuffer is how many broadcasts may queue for a client before new ones are dropped
+	wsSendBuffer = 64
 )
 
+// wsClient is a connected WebSocket client as broadcasts see it. Broadcasts are queued
+// on send and written by the client's own goroutine, so a slow client only delays itself.
+type wsClient struct {
+	id           uint64
+	profileID    int64
+	writeMu      *sync.Mutex          // serializes writes to the connection
+	subscription *market.Subscription // streamed quote symbols; broadcasts about others are skipped
+	send         chan interface{}
+}
+
+// clientMessage is a control message sent by a WebSocket client
+type clientMessage struct {
+	Type    string   `json:"type"`
+	Symbols []string `json:"symbols,omitempty"` // for subscribe and subscribe_trades
+}
+
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		slog.Warn("websocket upgrade failed", "error", err)
 		return
 	}
-	log.Printf("WebSocket client connected from %s", r.RemoteAddr)
+	clientID := s.nextClientID.Add(1)
+	slog.Info("websocket client connected", "client_id", clientID, "remote", r.RemoteAddr)
 
-	s.clientsMu.Lock()
-	s.clients[conn] = true
-	s.clientsMu.Unlock()
+	// Mutex for safe writes to websocket, shared with broadcasts
+	writeMu := &sync.Mutex{}
 
 	defer func() {
-		s.clientsMu.Lock()
-		delete(s.clients, conn)
-		s.clientsMu.Unlock()
 		conn.Close()
-		log.Printf("WebSocket client disconnected from %s", r.RemoteAddr)
+		slog.Info("websocket client disconnected", "client_id", clientID, "remote", r.RemoteAddr)
 	}()
 
 	// Get user config for tracked symbols
-	cfg, err := s.db.GetOrCreateConfig()
+	cfg, err := s.requestConfig(r)
 	if err != nil {
-		log.Printf(FAILED_TO_GET_CONFIG, err)
-		conn.WriteJSON(map[string]string{"type": "error", "message": FAILED_TO_GET_CONFIG})
+		slog.Error(FAILED_TO_GET_CONFIG, "error", err)
+		writeJSON(conn, map[string]string{"type": "error", "message": FAILED_TO_GET_CONFIG})
 		return
 	}
 
-	if len(cfg.TrackedSymbols) == 0 {
-		// Send initial message
-		conn.WriteJSON(map[string]string{"type": "info", "message": "No symbols tracked. Add symbols in Settings."})
-		// Keep connection alive, wait for updates
-		for {
-			_, _, err := conn.ReadMessage()
-			if err != nil {
-				break
-			}
-		}
-		return
+	// A client presenting a known session ID gets its last subscription back
+	session := s.sessionID(r.URL.Query().Get("client_id"))
+	state, restored := s.restoreSubscription(session)
+	if !restored {
+		state = wsSubscriptionState{Symbols: cfg.TrackedSymbols}
 	}
 
-	// Send initial message
-	conn.WriteJSON(map[string]string{"type": "info", "message": fmt.Sprintf("Tracking %d symbols", len(cfg.TrackedSymbols))})
-
-	// Decrypt API key
-	apiKey := ""
-	if cfg.MarketDataAPIKey != "" {
-		apiKey, _ = config.Decrypt(cfg.MarketDataAPIKey, s.config.EncryptionKey)
+	// Send initial message; clients can change the streamed symbols with a subscribe message
+	switch {
+	case restored:
+		writeJSON(conn, map[string]interface{}{"type": "subscribed", "symbols": state.Symbols, "restored": true})
+	case len(cfg.TrackedSymbols) == 0:
+		writeJSON(conn, map[string]string{"type": "info", "message": "No symbols tracked. Add symbols in Settings."})
+	default:
+		writeJSON(conn, map[string]string{"type": "info", "message": fmt.Sprintf("Tracking %d symbols", len(cfg.TrackedSymbols))})
 	}
 
 	// Create market data provider
-	provider, err := market.NewProvider(cfg.MarketDataProvider, apiKey)
+	provider, err := s.marketProvider(cfg)
 	if err != nil {
-		conn.WriteJSON(map[string]string{"type": "error", "message": "Provider error: " + err.Error()})
+		writeJSON(conn, map[string]string{"type": "error", "message": "Provider error: " + err.Error()})
 		return
 	}
 
@@ -81,144 +104,496 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
-	// Start streaming quotes from provider
+	// Start streaming quotes from provider, starting with the watchlist or restored symbols
+	subscription := market.NewSubscription(state.Symbols)
+	subscription.OnSymbolStatus(func(status market.SymbolStatus) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if status.Err == nil {
+			writeJSON(conn, map[string]string{"type": "symbol_recovered", "symbol": status.Symbol})
+			return
+		}
+		slog.Warn("streamed symbol failed, retrying", "client_id", clientID, "symbol", status.Symbol, "retry_in", status.RetryIn, "error", status.Err)
+		writeJSON(conn, map[string]interface{}{
+			"type":     "symbol_error",
+			"symbol":   status.Symbol,
+			"message":  status.Err.Error(),
+			"code":     cmp.Or(apperr.CodeOf(status.Err), apperr.ProviderUnavailable),
+			"retry_in": int(status.RetryIn.Round(time.Second) / time.Second),
+		})
+	})
+	var dedupe *quoteDeduper
+	if s.config.StreamDedupe {
+		dedupe = newQuoteDeduper(s.config.StreamPriceEpsilon)
+	}
+
+	// Broadcasts reach the client once it's streaming, for its profile and symbols
+	client := &wsClient{id: clientID, profileID: cfg.ID, writeMu: writeMu, subscription: subscription, send: make(chan interface{}, wsSendBuffer)}
+	s.clientsMu.Lock()
+	s.clients[conn] = client
+	s.clientsMu.Unlock()
+	defer func() {
+		s.clientsMu.Lock()
+		delete(s.clients, conn)
+		s.clientsMu.Unlock()
+	}()
+	go func() {
+		s.writeBroadcasts(ctx, conn, client)
+		cancel()
+	}()
+
 	go func() {
-		err := provider.StreamQuotes(ctx, cfg.TrackedSymbols, providerCh)
+		err := s.streamQuotesWhileOpen(ctx, provider, subscription, providerCh, func(status models.MarketStatus) {
+			writeMu.Lock()
+			writeJSON(conn, map[string]interface{}{"type": "market_status", "status": status})
+			writeMu.Unlock()
+		})
 		if err != nil && err != context.Canceled {
-			log.Printf("Stream error: %v", err)
+			slog.Error("stream error", "client_id", clientID, "error", err)
 		}
 	}()
 
-	// Read goroutine to detect client disconnect
-	go func() {
-		for {
-			_, _, err := conn.ReadMessage()
-			if err != nil {
-				cancel()
-				return
+	// Heartbeat: a missed pong lets the read deadline expire, which ends the
+	// read goroutine and cancels the connection
+	if interval := s.config.WSHeartbeatInterval; interval > 0 {
+		pongWait := 2 * interval
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(pongWait))
+		})
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+						slog.Debug("websocket ping failed", "client_id", clientID, "error", err)
+						cancel()
+						return
+					}
+				}
 			}
-		}
+		}()
+	}
+
+	// Read goroutine to handle control messages and detect client disconnect
+	go func() {
+		s.readClientMessages(ctx, conn, clientID, writeMu, subscription, dedupe, session, state)
+		cancel()
 	}()
 
-	// Mutex for safe writes to websocket
-	var writeMu sync.Mutex
+	// The client and the alert checker each get every symbol's quotes, so a slow
+	// client can't hold up alerts (or the provider) and vice versa. The detector for
+	// split-driven price jumps runs once, ahead of both.
+	detector := market.NewDiscontinuityDetector(s.config.StreamSplitTolerance)
+	toClient, toAlerts := newQuoteMailbox("client"), newQuoteMailbox("alerts")
+	go fanOutQuotes(ctx, clientID, providerCh, detector, dedupe, toClient, toAlerts)
+	go s.checkStreamedAlerts(ctx, provider, cfg, toAlerts)
 
-	// Process quotes and check alerts
+	// Send quotes to the client
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case quote := <-providerCh:
-			// Send quote to client
+		case <-toClient.ready:
+			for _, quote := range toClient.take() {
+				writeMu.Lock()
+				err := writeJSON(conn, map[string]interface{}{
+					"type":  "quote",
+					"quote": quote,
+				})
+				writeMu.Unlock()
+
+				if err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// checkStreamedAlerts checks a connection's streamed quotes against the profile's
+// alerts until ctx ends
+func (s *Server) checkStreamedAlerts(ctx context.Context, provider market.Provider, cfg *models.UserConfig, quotes *quoteMailbox) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-quotes.ready:
+			for _, quote := range quotes.take() {
+				// Don't let corporate-action jumps trigger price alerts
+				if quote.Discontinuity != "" {
+					slog.Warn("skipping alerts", "symbol", quote.Symbol, "reason", quote.Discontinuity)
+					continue
+				}
+				applyExtendedHours(cfg, &quote)
+				if age, stale := s.quoteStale(quote); stale {
+					slog.Warn("skipping alerts for stale quote", "symbol", quote.Symbol, "age", age.Round(time.Second))
+					continue
+				}
+				s.checkAndTriggerAlerts(ctx, provider, quote, cfg)
+			}
+		}
+	}
+}
+
+// readClientMessages reads control messages from a client until the connection fails.
+// Subscribe messages update the connection's quote subscription, and every change is
+// saved under the client's session ID for reconnects, and resets dedupe so the new
+// symbols' first quotes go through. Malformed frames are logged and handled per the
+// configured policy instead of tearing down the connection.
+func (s *Server) readClientMessages(ctx context.Context, conn *websocket.Conn, clientID uint64, writeMu *sync.Mutex, subscription *market.Subscription, dedupe *quoteDeduper, session string, state wsSubscriptionState) {
+	// stopTrades ends the client's trade subscription, if any
+	stopTrades := func() {}
+	if state.TradesOn {
+		stopTrades = s.streamTrades(ctx, conn, clientID, writeMu, state.Trades)
+	}
+	defer func() { stopTrades() }()
+
+	// Saving on disconnect starts the session's idle period
+	s.saveSubscription(session, state)
+	defer func() { s.saveSubscription(session, state) }()
+
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if msgType != websocket.TextMessage {
+			s.handleMalformedMessage(conn, clientID, writeMu, data, "unsupported frame type")
+			continue
+		}
+
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.handleMalformedMessage(conn, clientID, writeMu, data, "invalid JSON")
+			continue
+		}
+
+		switch msg.Type {
+		case "ping":
+			writeMu.Lock()
+			err = writeJSON(conn, map[string]string{"type": "pong"})
+			writeMu.Unlock()
+		case "subscribe":
+			symbols, subErr := s.subscriptionSymbols(msg.Symbols)
 			writeMu.Lock()
-			err := conn.WriteJSON(map[string]interface{}{
-				"type":  "quote",
-				"quote": quote,
-			})
+			if subErr != nil {
+				err = writeJSON(conn, map[string]string{"type": "error", "message": subErr.Error()})
+			} else {
+				dedupe.reset()
+				subscription.Set(symbols)
+				state.Symbols = symbols
+				err = writeJSON(conn, map[string]interface{}{"type": "subscribed", "symbols": symbols})
+			}
 			writeMu.Unlock()
+			s.saveSubscription(session, state)
+		case "subscribe_trades":
+			stopTrades()
+			stopTrades = s.streamTrades(ctx, conn, clientID, writeMu, msg.Symbols)
+			state.TradesOn, state.Trades = true, msg.Symbols
+			s.saveSubscription(session, state)
+		case "unsubscribe_trades":
+			stopTrades()
+			stopTrades = func() {}
+			state.TradesOn, state.Trades = false, nil
+			s.saveSubscription(session, state)
+		case "":
+			s.handleMalformedMessage(conn, clientID, writeMu, data, "missing message type")
+		default:
+			s.handleMalformedMessage(conn, clientID, writeMu, data, "unknown message type: "+msg.Type)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
 
-			if err != nil {
+// subscriptionSymbols normalizes and de-duplicates a client's requested symbols,
+// rejecting sets larger than the per-connection limit
+func (s *Server) subscriptionSymbols(symbols []string) ([]string, error) {
+	seen := make(map[string]bool, len(symbols))
+	normalized := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		if strings.TrimSpace(symbol) == "" {
+			continue
+		}
+		symbol, err := market.NormalizeSymbol(symbol)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[symbol] {
+			seen[symbol] = true
+			normalized = append(normalized, symbol)
+		}
+	}
+	if limit := s.config.WSMaxSubscriptions; limit > 0 && len(normalized) > limit {
+		return nil, fmt.Errorf("Subscription limit exceeded: %d symbols requested, at most %d allowed per connection", len(normalized), limit)
+	}
+	return normalized, nil
+}
+
+// streamTrades forwards trade prints for symbols (default: the watchlist) to a client
+// until the returned stop function is called or ctx ends. Providers without a trades
+// feed are reported to the client as an error.
+func (s *Server) streamTrades(ctx context.Context, conn *websocket.Conn, clientID uint64, writeMu *sync.Mutex, symbols []string) func() {
+	sendError := func(message string) {
+		writeMu.Lock()
+		writeJSON(conn, map[string]string{"type": "error", "message": message})
+		writeMu.Unlock()
+	}
+
+	cfg, err := s.db.GetProfileConfig(ProfileID(ctx))
+	if err != nil {
+		sendError(FAILED_TO_GET_CONFIG)
+		return func() {}
+	}
+	provider, err := s.requestMarketProvider(cfg, s.config.TradesProvider)
+	if err != nil {
+		sendError("Provider error: " + err.Error())
+		return func() {}
+	}
+	tp, ok := provider.(market.TradeProvider)
+	if !ok {
+		sendError("Trades are not supported by " + provider.Name())
+		return func() {}
+	}
+
+	if len(symbols) == 0 {
+		symbols = cfg.TrackedSymbols
+	}
+	symbols, err = s.subscriptionSymbols(symbols)
+	if err != nil {
+		sendError(err.Error())
+		return func() {}
+	}
+
+	tradeCtx, cancel := context.WithCancel(ctx)
+	tradeCh := make(chan models.Trade, 256)
+	go func() {
+		err := tp.StreamTrades(tradeCtx, symbols, tradeCh)
+		if errors.Is(err, market.ErrNotSupported) {
+			sendError("Trades are not supported by " + provider.Name())
+		} else if err != nil && tradeCtx.Err() == nil {
+			slog.Error("trade stream error", "client_id", clientID, "error", err)
+			sendError("Trade stream error: " + err.Error())
+		}
+		cancel()
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-tradeCtx.Done():
 				return
+			case trade := <-tradeCh:
+				writeMu.Lock()
+				err := writeJSON(conn, map[string]interface{}{
+					"type":  "trade",
+					"trade": trade,
+				})
+				writeMu.Unlock()
+				if err != nil {
+					cancel()
+					return
+				}
 			}
-
-			// Check alerts for this quote
-			s.checkAndTriggerAlerts(quote, cfg, conn, &writeMu)
 		}
+	}()
+
+	slog.Debug("websocket client subscribed to trades", "client_id", clientID, "symbols", symbols)
+	return cancel
+}
+
+// handleMalformedMessage logs a bad client frame and optionally reports it back to the client
+func (s *Server) handleMalformedMessage(conn *websocket.Conn, clientID uint64, writeMu *sync.Mutex, data []byte, reason string) {
+	if len(data) > maxLoggedMessageBytes {
+		data = data[:maxLoggedMessageBytes]
+	}
+	slog.Debug("websocket client sent malformed message", "client_id", clientID, "reason", reason, "data", string(data))
+
+	if s.config.WSMalformedMessagePolicy == config.WSMalformedPolicyIgnore {
+		return
+	}
+
+	writeMu.Lock()
+	writeJSON(conn, map[string]string{"type": "error", "message": "Malformed message: " + reason})
+	writeMu.Unlock()
+}
+
+// quoteStale reports whether a quote is too old to trigger alerts, and its age.
+// Quotes without a timestamp are never considered stale.
+func (s *Server) quoteStale(quote models.Quote) (time.Duration, bool) {
+	if s.config.AlertMaxQuoteAge <= 0 || quote.Timestamp.IsZero() {
+		return 0, false
 	}
+	age := time.Since(quote.Timestamp)
+	return age, age > s.config.AlertMaxQuoteAge
 }
 
-// checkAndTriggerAlerts checks if any price alerts should be triggered for a quote
-func (s *Server) checkAndTriggerAlerts(quote models.Quote, cfg *models.UserConfig, conn *websocket.Conn, writeMu *sync.Mutex) {
-	alerts, err := s.db.GetActiveAlerts()
+// checkAndTriggerAlerts checks if any price alerts should be triggered for a streamed
+// quote. The polling service checks them too, so alerts fire without a connection.
+func (s *Server) checkAndTriggerAlerts(ctx context.Context, provider market.Provider, quote models.Quote, cfg *models.UserConfig) {
+	alerts, err := s.db.GetActiveAlerts(cfg.ID)
 	if err != nil {
 		return
 	}
+	s.evaluateAlerts(ctx, provider, cfg, alerts, quote, "stream")
+}
 
+// evaluateAlerts fires the alerts on a quote's symbol that it triggers, pushing each to
+// the profile's WebSocket clients and sending its notifications. source names the check
+// ("stream" or "poll") in the logs.
+func (s *Server) evaluateAlerts(ctx context.Context, provider market.Provider, cfg *models.UserConfig, alerts []models.PriceAlert, quote models.Quote, source string) {
 	for _, alert := range alerts {
 		if alert.Symbol != quote.Symbol {
 			continue
 		}
 
-		var triggered bool
-		switch alert.Condition {
-		case "above":
-			triggered = quote.Price >= alert.Price
-		case "below":
-			triggered = quote.Price <= alert.Price
+		message, fired := s.fireAlert(ctx, provider, cfg, alert, quote)
+		if !fired {
+			continue
+		}
+		s.recordAlertTrigger(alert, quote, message, source)
+		if alertMuted(alert) {
+			slog.Info("alert triggered while muted, skipping notifications", "alert_id", alert.ID, "source", source)
+			continue
 		}
 
-		if triggered {
-			// Mark alert as triggered in database
-			s.db.TriggerAlert(alert.ID)
+		s.BroadcastAlert(cfg.ID, alert, quote.Price, message)
 
-			// Create alert message
-			message := fmt.Sprintf("%s is now $%.2f (%s $%.2f)", alert.Symbol, quote.Price, alert.Condition, alert.Price)
+		notification := models.Notification{
+			Type:    "price_alert",
+			Title:   fmt.Sprintf(PRICE_ALERT, alert.Symbol),
+			Message: message + "\n" + alertSnapshot(quote),
+			Symbol:  alert.Symbol,
 
-			// Send alert to this WebSocket client
-			writeMu.Lock()
-			conn.WriteJSON(map[string]interface{}{
-				"type":    "alert",
-				"title":   fmt.Sprintf(PRICE_ALERT, alert.Symbol),
-				"message": message,
-				"symbol":  alert.Symbol,
-				"price":   quote.Price,
-			})
-			writeMu.Unlock()
+			BypassQuietHours: alert.BypassQuietHours,
+		}
+		s.enqueueNotification(cfg.ID, notification, cfg.NotificationChannels)
 
-			// Also broadcast to all other clients
-			s.BroadcastAlert(alert.Symbol, message)
+		slog.Info("alert triggered", "alert_id", alert.ID, "symbol", alert.Symbol, "source", source, "message", message)
+	}
+}
 
-			// Send external notifications
-			notification := models.Notification{
-				Type:    "price_alert",
-				Title:   fmt.Sprintf(PRICE_ALERT, alert.Symbol),
-				Message: message,
-				Symbol:  alert.Symbol,
-			}
-			go s.notifyService.SendToChannels(notification, cfg.NotificationChannels)
+// recordAlertTrigger adds a firing to the alert's history with the quote it fired on
+func (s *Server) recordAlertTrigger(alert models.PriceAlert, quote models.Quote, message, source string) {
+	trigger := &models.AlertTrigger{
+		AlertID:       alert.ID,
+		Symbol:        alert.Symbol,
+		Price:         quote.Price,
+		PreviousClose: quote.PreviousClose,
+		ChangePercent: quote.ChangePercent,
+		Volume:        quote.Volume,
+		Source:        source,
+		Message:       message,
+		TriggeredAt:   time.Now(),
+	}
+	if err := s.db.SaveAlertTrigger(trigger); err != nil {
+		slog.Error("failed to record alert trigger", "alert_id", alert.ID, "error", err)
+	}
+}
 
-			log.Printf("Alert triggered: %s", message)
-		}
+// alertSnapshot describes the market at an alert's trigger, e.g. "Price $190.00, day
+// change +1.45% from $187.30, volume 48.20M", leaving out what the provider didn't report
+func alertSnapshot(quote models.Quote) string {
+	parts := []string{"Price " + market.FormatPrice(quote.Price, quote.Currency)}
+	if quote.PreviousClose > 0 {
+		parts = append(parts, fmt.Sprintf("day change %+.2f%% from %s", quote.ChangePercent, market.FormatPrice(quote.PreviousClose, quote.Currency)))
+	}
+	if quote.Volume > 0 {
+		parts = append(parts, "volume "+formatVolume(quote.Volume))
 	}
+	return strings.Join(parts, ", ")
 }
 
-// BroadcastAlert sends an alert message to all connected WebSocket clients
-func (s *Server) BroadcastAlert(symbol, message string) {
-	s.clientsMu.Lock()
-	defer s.clientsMu.Unlock()
+// BroadcastAlert pushes an alert_triggered message to a profile's clients streaming the symbol
+func (s *Server) BroadcastAlert(profileID int64, alert models.PriceAlert, price float64, message string) {
+	s.broadcast(profileID, alert.Symbol, map[string]interface{}{
+		"type":      "alert_triggered",
+		"alert_id":  alert.ID,
+		"condition": alert.Condition,
+		"title":     fmt.Sprintf(PRICE_ALERT, alert.Symbol),
+		"message":   message,
+		"symbol":    alert.Symbol,
+		"price":     price,
+	})
+}
 
-	msg := map[string]interface{}{
-		"type":    "alert",
-		"title":   fmt.Sprintf(PRICE_ALERT, symbol),
-		"message": message,
-		"symbol":  symbol,
-	}
+// BroadcastAnalysis pushes an analysis_complete message to a profile's clients streaming the symbol
+func (s *Server) BroadcastAnalysis(profileID int64, analysis *models.AnalysisResponse) {
+	s.broadcast(profileID, analysis.Symbol, map[string]interface{}{
+		"type":     "analysis_complete",
+		"analysis": analysis,
+	})
+}
+
+// BroadcastToClients sends a message to every connected WebSocket client streaming
+// symbol, or to all of them when symbol is empty
+func (s *Server) BroadcastToClients(symbol string, msg interface{}) {
+	s.broadcast(0, symbol, msg)
+}
+
+// broadcast queues msg for the clients of a profile (any when profileID is 0) that stream
+// symbol (any when it's empty). It never waits on a client: one whose queue is full
+// misses the message.
+func (s *Server) broadcast(profileID int64, symbol string, msg interface{}) {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
 
-	for conn := range s.clients {
-		if err := conn.WriteJSON(msg); err != nil {
-			// Mark for removal but don't modify map during iteration
-			log.Printf("WebSocket write error: %v", err)
+	for _, client := range s.clients {
+		if profileID != 0 && client.profileID != profileID {
+			continue
+		}
+		if symbol != "" && !slices.Contains(client.subscription.Symbols(), symbol) {
+			continue
+		}
+		select {
+		case client.send <- msg:
+		default:
+			slog.Warn("websocket client too slow, dropping broadcast", "client_id", client.id)
 		}
 	}
 }
 
-// BroadcastToClients sends a message to all connected WebSocket clients
-func (s *Server) BroadcastToClients(msg interface{}) {
-	s.clientsMu.Lock()
-	defer s.clientsMu.Unlock()
-
-	for conn := range s.clients {
-		if err := conn.WriteJSON(msg); err != nil {
-			log.Printf("WebSocket write error: %v", err)
+// writeBroadcasts writes a client's queued broadcasts until ctx ends or a write fails
+func (s *Server) writeBroadcasts(ctx context.Context, conn *websocket.Conn, client *wsClient) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-client.send:
+			client.writeMu.Lock()
+			err := writeJSON(conn, msg)
+			client.writeMu.Unlock()
+			if err != nil {
+				slog.Warn("websocket write error", "client_id", client.id, "error", err)
+				return
+			}
 		}
 	}
 }
 
-// StartPollingService starts a background service that polls market data
-// and checks alerts even when no WebSocket clients are connected
+// writeJSON writes a message to conn with a write deadline; callers serialize writes
+func writeJSON(conn *websocket.Conn, msg interface{}) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return conn.WriteJSON(msg)
+}
+
+// alertPollInterval is how often the polling service checks every profile's alerts
+const alertPollInterval = 30 * time.Second
+
+// StartPollingService starts a background service that polls market data and checks
+// alerts whether or not any WebSocket clients are connected, along with the
+// DATA_RETENTION_DAYS prune
 func (s *Server) StartPollingService(ctx context.Context) {
+	s.startRetentionPrune(ctx)
+
 	go func() {
-		ticker := time.NewTicker(30 * time.Second)
+		ticker := time.NewTicker(alertPollInterval)
 		defer ticker.Stop()
 
 		for {
@@ -232,80 +607,266 @@ func (s *Server) StartPollingService(ctx context.Context) {
 	}()
 }
 
-// pollAndCheckAlerts polls market data and checks alerts
+// pollAndCheckAlerts polls market data and checks alerts for every profile, idling
+// except for crypto pairs while the market is closed
 func (s *Server) pollAndCheckAlerts(ctx context.Context) {
-	cfg, err := s.db.GetOrCreateConfig()
-	if err != nil || len(cfg.TrackedSymbols) == 0 {
+	cryptoOnly := s.marketIdle(time.Now())
+	profiles, err := s.db.ListProfiles()
+	if err != nil {
 		return
 	}
+	for _, profile := range profiles {
+		s.pollProfileAlerts(ctx, profile.ID, cryptoOnly)
+	}
+}
 
-	// Check if polling is enabled
-	if cfg.PollingInterval <= 0 {
+// pollProfileAlerts fetches one batch of quotes for every symbol a profile has active
+// alerts on, plus its tracked symbols when polling is enabled, broadcasts them and
+// checks the alerts against them. With cryptoOnly, only crypto pairs are polled.
+func (s *Server) pollProfileAlerts(ctx context.Context, profileID int64, cryptoOnly bool) {
+	cfg, err := s.db.GetProfileConfig(profileID)
+	if err != nil {
+		return
+	}
+	alerts, err := s.db.GetActiveAlerts(cfg.ID)
+	if err != nil {
+		slog.Error("failed to load alerts for polling", "profile_id", cfg.ID, "error", err)
 		return
 	}
 
-	// Decrypt API key
-	apiKey := ""
-	if cfg.MarketDataAPIKey != "" {
-		apiKey, _ = config.Decrypt(cfg.MarketDataAPIKey, s.config.EncryptionKey)
+	var symbols []string
+	for _, alert := range alerts {
+		if !slices.Contains(symbols, alert.Symbol) {
+			symbols = append(symbols, alert.Symbol)
+		}
+	}
+	if cfg.PollingInterval > 0 {
+		for _, symbol := range cfg.TrackedSymbols {
+			if !slices.Contains(symbols, symbol) {
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	if cryptoOnly {
+		symbols = slices.DeleteFunc(symbols, func(symbol string) bool { return !market.IsCrypto(symbol) })
+	}
+	if len(symbols) == 0 {
+		return
 	}
 
-	// Create market data provider
-	provider, err := market.NewProvider(cfg.MarketDataProvider, apiKey)
+	provider, err := s.marketProvider(cfg)
 	if err != nil {
+		slog.Error("polling: market provider error", "profile_id", cfg.ID, "error", err)
 		return
 	}
+	quotes, err := provider.GetQuotes(ctx, symbols)
+	var batchErr *market.BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		slog.Warn("polling: failed to get quotes", "profile_id", cfg.ID, "error", err)
+		return
+	}
+	if batchErr != nil {
+		for symbol, symbolErr := range batchErr.Errors {
+			slog.Warn("polling: failed to get quote", "symbol", symbol, "error", symbolErr)
+		}
+	}
 
-	// Get quotes for all tracked symbols
-	for _, symbol := range cfg.TrackedSymbols {
-		quote, err := provider.GetQuote(ctx, symbol)
-		if err != nil {
+	for _, symbol := range symbols {
+		quote, ok := quotes[symbol]
+		if !ok {
 			continue
 		}
+		s.discontinuity.Check(&quote)
+
+		if s.config.QuoteSnapshots {
+			if err := s.db.SaveQuoteSnapshot(&quote); err != nil {
+				slog.Error("failed to save quote snapshot", "symbol", quote.Symbol, "error", err)
+			}
+		}
 
-		// Broadcast quote to all connected clients
-		s.BroadcastToClients(map[string]interface{}{
+		// Broadcast quote to the clients streaming the symbol
+		s.BroadcastToClients(quote.Symbol, map[string]interface{}{
 			"type":  "quote",
 			"quote": quote,
 		})
 
-		// Check alerts
-		alerts, err := s.db.GetActiveAlerts()
-		if err != nil {
+		// Don't let corporate-action jumps trigger price alerts
+		if quote.Discontinuity != "" {
+			slog.Warn("skipping alerts (polling)", "symbol", quote.Symbol, "reason", quote.Discontinuity)
+			continue
+		}
+		applyExtendedHours(cfg, &quote)
+		if age, stale := s.quoteStale(quote); stale {
+			slog.Warn("skipping alerts for stale quote (polling)", "symbol", quote.Symbol, "age", age.Round(time.Second))
 			continue
 		}
 
-		for _, alert := range alerts {
-			if alert.Symbol != quote.Symbol {
-				continue
-			}
+		s.evaluateAlerts(ctx, provider, cfg, alerts, quote, "poll")
+	}
+}
 
-			var triggered bool
-			switch alert.Condition {
-			case "above":
-				triggered = quote.Price >= alert.Price
-			case "below":
-				triggered = quote.Price <= alert.Price
+// fireAlert evaluates an alert against a quote and records it as fired, returning the
+// notification message. Alerts in their cooldown are skipped and disarmed re-arm alerts
+// re-arm once their condition stops matching. The database update decides which of
+// several concurrent checks (streams and polling) delivers the notification.
+func (s *Server) fireAlert(ctx context.Context, provider market.Provider, cfg *models.UserConfig, alert models.PriceAlert, quote models.Quote) (string, bool) {
+	if alertCoolingDown(alert) {
+		return "", false
+	}
+	triggered, message := s.alertTriggered(ctx, provider, cfg, alert, quote)
+	if alert.Disarmed {
+		if !triggered {
+			if err := s.db.RearmAlert(alert.ID); err != nil {
+				slog.Error("failed to re-arm alert", "alert_id", alert.ID, "error", err)
 			}
+		}
+		return "", false
+	}
+	if !triggered {
+		return "", false
+	}
 
-			if triggered {
-				s.db.TriggerAlert(alert.ID)
-				message := fmt.Sprintf("%s is now $%.2f (%s $%.2f)", alert.Symbol, quote.Price, alert.Condition, alert.Price)
+	fired, err := s.db.TriggerAlert(alert.ID)
+	if err != nil {
+		slog.Error("failed to record alert as triggered", "alert_id", alert.ID, "error", err)
+		return "", false
+	}
+	if fired && !alert.Recurring {
+		s.forgetCrossSides(alert.ID)
+	}
+	return message, fired
+}
 
-				// Broadcast alert to all clients
-				s.BroadcastAlert(alert.Symbol, message)
+// alertTriggered evaluates an alert against a quote, returning whether it fired and the
+// notification message. Conditions whose reference data is unavailable don't fire.
+func (s *Server) alertTriggered(ctx context.Context, provider market.Provider, cfg *models.UserConfig, alert models.PriceAlert, quote models.Quote) (bool, string) {
+	// price writes an amount in the quote's currency
+	price := func(amount float64) string { return market.FormatPrice(amount, quote.Currency) }
+
+	switch alert.Condition {
+	case "above", "below":
+		message := fmt.Sprintf("%s is now %s (%s %s)", alert.Symbol, price(quote.Price), alert.Condition, price(alert.Price))
+		if alert.Condition == "above" {
+			return quote.Price >= alert.Price, message
+		}
+		return quote.Price <= alert.Price, message
+	case "cross_above", "cross_below":
+		// Only a move from the other side fires, so a price already past the target
+		// (including the first one seen) doesn't
+		side, crossed := s.levelCrossed(alert.ID, quote.Price, alert.Price)
+		if crossed && "cross_"+side == alert.Condition {
+			return true, fmt.Sprintf("%s crossed %s %s (now %s)", alert.Symbol, side, price(alert.Price), price(quote.Price))
+		}
+	case "pct_change_up", "pct_change_down":
+		ref := alert.ReferencePrice
+		if ref <= 0 {
+			ref = quote.PreviousClose
+		}
+		if ref <= 0 || alert.Percent <= 0 {
+			return false, ""
+		}
+		move := (quote.Price/ref - 1) * 100
+		if (alert.Condition == "pct_change_up" && move >= alert.Percent) ||
+			(alert.Condition == "pct_change_down" && move <= -alert.Percent) {
+			return true, fmt.Sprintf("%s moved %+.2f%% to %s (from %s)", alert.Symbol, move, price(quote.Price), price(ref))
+		}
+	case "volume_spike":
+		// Providers that don't report volume leave it zero, which never counts as a spike
+		if quote.Volume <= 0 {
+			return false, ""
+		}
+		extremes, ok := s.yearExtremes(ctx, provider, quote.Symbol)
+		if !ok || extremes.avgVolume <= 0 {
+			return false, ""
+		}
+		multiple := alert.VolumeMultiple
+		if multiple <= 0 {
+			multiple = defaultVolumeMultiple
+		}
+		if ratio := float64(quote.Volume) / extremes.avgVolume; ratio >= multiple {
+			return true, fmt.Sprintf("%s volume %d is %.1fx its 20-day average", alert.Symbol, quote.Volume, ratio)
+		}
+	case "new_52w_high", "new_52w_low":
+		extremes, ok := s.yearExtremes(ctx, provider, quote.Symbol)
+		if !ok {
+			return false, ""
+		}
+		if alert.Condition == "new_52w_high" && quote.Price > extremes.high {
+			return true, fmt.Sprintf("%s made a new 52-week high at %s (prior high %s)", alert.Symbol, price(quote.Price), price(extremes.high))
+		}
+		if alert.Condition == "new_52w_low" && quote.Price < extremes.low {
+			return true, fmt.Sprintf("%s made a new 52-week low at %s (prior low %s)", alert.Symbol, price(quote.Price), price(extremes.low))
+		}
+	case "vwap_cross":
+		vwap, _, err := s.intradayVWAP(ctx, cfg, quote.Symbol)
+		if err != nil {
+			slog.Warn("failed to get VWAP", "symbol", quote.Symbol, "error", err)
+			return false, ""
+		}
+		if side, crossed := s.levelCrossed(alert.ID, quote.Price, vwap); crossed {
+			return true, fmt.Sprintf("%s crossed %s VWAP at %s (VWAP %s)", alert.Symbol, side, price(quote.Price), price(vwap))
+		}
+	}
+	return false, ""
+}
 
-				// Send external notifications
-				notification := models.Notification{
-					Type:    "price_alert",
-					Title:   fmt.Sprintf(PRICE_ALERT, alert.Symbol),
-					Message: message,
-					Symbol:  alert.Symbol,
-				}
-				go s.notifyService.SendToChannels(notification, cfg.NotificationChannels)
+// avgVolumeDays is how many prior sessions volume_spike alerts average over
+const avgVolumeDays = 20
 
-				log.Printf("Alert triggered (polling): %s", message)
-			}
+// yearRange holds cached 52-week extremes and average volume for a symbol
+type yearRange struct {
+	high, low float64
+	avgVolume float64 // mean daily volume over the last avgVolumeDays sessions
+	day       string  // trading day the extremes were computed on
+}
+
+// yearExtremes returns the rolling 52-week high/low and average volume for a symbol,
+// computed from historical data at most once per day so alert checks don't refetch every poll
+func (s *Server) yearExtremes(ctx context.Context, provider market.Provider, symbol string) (yearRange, bool) {
+	today := time.Now().Format("2006-01-02")
+
+	s.yearRangesMu.Lock()
+	cached, ok := s.yearRanges[symbol]
+	s.yearRangesMu.Unlock()
+	if ok && cached.day == today {
+		return cached, true
+	}
+
+	candles, err := market.AdjustedHistory(ctx, provider, symbol, "1y", "")
+	if err != nil || len(candles) == 0 {
+		slog.Warn("failed to get 52-week range", "symbol", symbol, "error", err)
+		return yearRange{}, false
+	}
+
+	// Exclude today's candle so a fresh extreme isn't compared against itself
+	extremes := yearRange{day: today}
+	var volumes []int64
+	for _, c := range candles {
+		if c.Timestamp.Format("2006-01-02") == today || c.High <= 0 || c.Low <= 0 {
+			continue
+		}
+		volumes = append(volumes, c.Volume)
+		if extremes.high == 0 || c.High > extremes.high {
+			extremes.high = c.High
 		}
+		if extremes.low == 0 || c.Low < extremes.low {
+			extremes.low = c.Low
+		}
+	}
+	if extremes.high == 0 {
+		return yearRange{}, false
 	}
+	if len(volumes) > avgVolumeDays {
+		volumes = volumes[:avgVolumeDays] // candles are newest first
+	}
+	var total int64
+	for _, v := range volumes {
+		total += v
+	}
+	extremes.avgVolume = float64(total) / float64(len(volumes))
+
+	s.yearRangesMu.Lock()
+	s.yearRanges[symbol] = extremes
+	s.yearRangesMu.Unlock()
+	return extremes, true
 }
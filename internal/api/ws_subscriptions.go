@@ -0,0 +1,65 @@
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+// maxSessionIDLength bounds client-chosen session IDs kept in memory
+const maxSessionIDLength = 128
+
+// wsSubscriptionState is what a WebSocket client is subscribed to, kept per session ID
+// so a reconnecting client gets the same streams back without re-subscribing
+type wsSubscriptionState struct {
+	Symbols  []string // streamed quote symbols
+	TradesOn bool     // whether trades were subscribed
+	Trades   []string // symbols requested for trades; empty means the watchlist
+	savedAt  time.Time
+}
+
+// sessionID reads the stable client ID a WebSocket client presents on connect.
+// Restoring is disabled when the subscription TTL is zero.
+func (s *Server) sessionID(raw string) string {
+	id := strings.TrimSpace(raw)
+	if s.config.WSSubscriptionTTL <= 0 || len(id) > maxSessionIDLength {
+		return ""
+	}
+	return id
+}
+
+// restoreSubscription returns a session's last subscription if it hasn't expired
+func (s *Server) restoreSubscription(session string) (wsSubscriptionState, bool) {
+	if session == "" {
+		return wsSubscriptionState{}, false
+	}
+	s.wsSessionsMu.Lock()
+	defer s.wsSessionsMu.Unlock()
+
+	state, ok := s.wsSessions[session]
+	if !ok || time.Since(state.savedAt) > s.config.WSSubscriptionTTL {
+		delete(s.wsSessions, session)
+		return wsSubscriptionState{}, false
+	}
+	return state, true
+}
+
+// saveSubscription records a session's subscription and restarts its idle period,
+// dropping other sessions that have expired
+func (s *Server) saveSubscription(session string, state wsSubscriptionState) {
+	if session == "" {
+		return
+	}
+	s.wsSessionsMu.Lock()
+	defer s.wsSessionsMu.Unlock()
+
+	now := time.Now()
+	for id, stored := range s.wsSessions {
+		if now.Sub(stored.savedAt) > s.config.WSSubscriptionTTL {
+			delete(s.wsSessions, id)
+		}
+	}
+	state.Symbols = append([]string{}, state.Symbols...)
+	state.Trades = append([]string{}, state.Trades...)
+	state.savedAt = now
+	s.wsSessions[session] = state
+}
@@ -0,0 +1,137 @@
+// Package apperr defines errors that carry a machine-readable code, so API clients can
+// tell error classes apart (and decide whether to retry) without parsing messages. The
+// market, ai and db packages build their sentinel errors with it; wrapping one with
+// fmt.Errorf's %w keeps its code.
+package apperr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Error codes, as sent in the "code" field of API error responses
+const (
+	InvalidRequest       = "invalid_request"       // malformed or out-of-range input
+	InvalidSymbol        = "invalid_symbol"        // missing, malformed or unknown symbol
+	Unauthorized         = "unauthorized"          // the request lacks a valid server API key
+	NotFound             = "not_found"             // the resource doesn't exist
+	MethodNotAllowed     = "method_not_allowed"    // the route doesn't take this method
+	Conflict             = "conflict"              // conflicts with a concurrent change or an existing resource
+	RateLimited          = "rate_limited"          // the server or an upstream provider is rate limiting; retry later
+	MissingAPIKey        = "missing_api_key"       // a provider needs an API key that isn't configured
+	BudgetExceeded       = "budget_exceeded"       // the monthly AI budget is spent
+	NotSupported         = "not_supported"         // the provider or server doesn't offer this
+	ProviderUnavailable  = "provider_unavailable"  // a market data provider failed or replied with an error
+	ProviderUnauthorized = "provider_unauthorized" // the provider plan or key doesn't cover the endpoint
+	AIError              = "ai_error"              // the AI provider failed or gave an unusable reply
+	AIUnavailable        = "ai_unavailable"        // the AI provider is overloaded or its circuit breaker is open; retry later
+	Timeout              = "timeout"               // the request ran out of time
+	Unavailable          = "unavailable"           // the server can't serve this right now
+	Internal             = "internal"              // an unexpected server-side failure
+)
+
+// statuses are the HTTP statuses errors with each code are reported with
+var statuses = map[string]int{
+	InvalidRequest:       http.StatusBadRequest,
+	InvalidSymbol:        http.StatusBadRequest,
+	Unauthorized:         http.StatusUnauthorized,
+	NotFound:             http.StatusNotFound,
+	MethodNotAllowed:     http.StatusMethodNotAllowed,
+	Conflict:             http.StatusConflict,
+	RateLimited:          http.StatusTooManyRequests,
+	MissingAPIKey:        http.StatusBadRequest,
+	BudgetExceeded:       http.StatusPaymentRequired,
+	NotSupported:         http.StatusNotImplemented,
+	ProviderUnavailable:  http.StatusBadGateway,
+	ProviderUnauthorized: http.StatusBadGateway,
+	AIError:              http.StatusBadGateway,
+	AIUnavailable:        http.StatusServiceUnavailable,
+	Timeout:              http.StatusGatewayTimeout,
+	Unavailable:          http.StatusServiceUnavailable,
+	Internal:             http.StatusInternalServerError,
+}
+
+// Error is an error with a code
+type Error struct {
+	Code    string
+	message string
+	err     error // wrapped error, if any
+}
+
+// New returns an error with code and message
+func New(code, message string) *Error {
+	return &Error{Code: code, message: message}
+}
+
+// Wrap returns an error with code that reads as err's message followed by message and
+// still matches err with errors.Is, e.g. Wrap(RateLimited, ErrAnalysisFailed, "rate
+// limited") gives "analysis failed: rate limited". The new code replaces err's.
+func Wrap(code string, err error, message string) *Error {
+	return &Error{Code: code, message: message, err: err}
+}
+
+func (e *Error) Error() string {
+	if e.err != nil {
+		return e.err.Error() + ": " + e.message
+	}
+	return e.message
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// CodeOf returns the code of the outermost coded error in err's chain, Timeout for
+// deadline errors and "" for other errors
+func CodeOf(err error) string {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout
+	}
+	return ""
+}
+
+// Status returns the HTTP status for code, 500 for unknown codes
+func Status(code string) int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeForStatus returns the code that best describes an error reported with an HTTP
+// status, for errors that don't carry one
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusRequestEntityTooLarge:
+		return InvalidRequest
+	case http.StatusUnauthorized:
+		return Unauthorized
+	case http.StatusPaymentRequired:
+		return BudgetExceeded
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusMethodNotAllowed:
+		return MethodNotAllowed
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusNotImplemented:
+		return NotSupported
+	case http.StatusBadGateway:
+		return ProviderUnavailable
+	case http.StatusServiceUnavailable:
+		return Unavailable
+	case http.StatusGatewayTimeout:
+		return Timeout
+	}
+	if status >= 500 {
+		return Internal
+	}
+	return InvalidRequest
+}
@@ -0,0 +1,216 @@
+// Package backtest replays trading signals over historical candles to see how
+// following them would have performed.
+package backtest
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"stockmarket/internal/indicators"
+	"stockmarket/internal/models"
+)
+
+// MinCandles is the fewest priced candles a backtest needs to mean anything
+const MinCandles = 2
+
+// Signal is a trading decision at a point in time. Only BUY and SELL act; other
+// actions (HOLD, WATCH) leave the position as it is.
+type Signal struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+}
+
+// Options adjust a simulation
+type Options struct {
+	// AllowShort lets a SELL open a short position. Without it SELL only closes a
+	// long, so cash never goes negative; with it, covering a short that has more than
+	// doubled can.
+	AllowShort bool
+}
+
+// Trade is one closed round trip
+type Trade struct {
+	Side       string    `json:"side"` // "long" or "short"
+	Shares     float64   `json:"shares"`
+	EntryTime  time.Time `json:"entry_time"`
+	EntryPrice float64   `json:"entry_price"`
+	ExitTime   time.Time `json:"exit_time"`
+	ExitPrice  float64   `json:"exit_price"`
+	PL         float64   `json:"pl"`
+}
+
+// EquityPoint is the portfolio's value at a candle's close
+type EquityPoint struct {
+	Time   time.Time `json:"time"`
+	Equity float64   `json:"equity"`
+}
+
+// Result summarizes a simulation. Returns, drawdown and win rate are fractions
+// (0.1 is 10%); an open position at the end is valued at the last close but isn't
+// counted as a trade.
+type Result struct {
+	StartingCash float64       `json:"starting_cash"`
+	FinalEquity  float64       `json:"final_equity"`
+	TotalReturn  float64       `json:"total_return"`
+	MaxDrawdown  float64       `json:"max_drawdown"`
+	WinRate      float64       `json:"win_rate"`
+	Trades       []Trade       `json:"trades"`
+	OpenShares   float64       `json:"open_shares"` // negative when short
+	Cash         float64       `json:"cash"`
+	EquityCurve  []EquityPoint `json:"equity_curve"`
+}
+
+// Run simulates following signals with startingCash, long only. See RunWithOptions.
+func Run(candles []models.Candle, signals []Signal, startingCash float64) Result {
+	return RunWithOptions(candles, signals, startingCash, Options{})
+}
+
+// RunWithOptions simulates following signals over candles in any order, trading
+// whole shares at the close of the first candle at or after each signal. A BUY
+// covers any short and invests all cash; a SELL closes any long and, when shorting
+// is allowed, opens a short worth the current equity. Candles without a positive
+// close are skipped, and with fewer than MinCandles the cash is returned untouched.
+func RunWithOptions(candles []models.Candle, signals []Signal, startingCash float64, opts Options) Result {
+	bars := make([]models.Candle, 0, len(candles))
+	for _, c := range candles {
+		if c.Close > 0 {
+			bars = append(bars, c)
+		}
+	}
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Timestamp.Before(bars[j].Timestamp) })
+
+	pending := append([]Signal{}, signals...)
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].Time.Before(pending[j].Time) })
+
+	result := Result{StartingCash: startingCash, Cash: startingCash, FinalEquity: startingCash, Trades: []Trade{}}
+	if len(bars) < MinCandles || startingCash <= 0 {
+		return result
+	}
+
+	var (
+		cash   = startingCash
+		shares float64 // negative when short
+		open   Trade
+		peak   = startingCash
+		next   int
+	)
+	closePosition := func(bar models.Candle) {
+		open.ExitTime, open.ExitPrice = bar.Timestamp, bar.Close
+		if shares > 0 {
+			cash += shares * bar.Close
+			open.PL = (bar.Close - open.EntryPrice) * shares
+		} else {
+			cash += shares * bar.Close // buying back costs cash
+			open.PL = (open.EntryPrice - bar.Close) * -shares
+		}
+		result.Trades = append(result.Trades, open)
+		shares = 0
+	}
+	openPosition := func(bar models.Candle, side string, qty float64) {
+		if qty <= 0 {
+			return
+		}
+		open = Trade{Side: side, Shares: qty, EntryTime: bar.Timestamp, EntryPrice: bar.Close}
+		if side == "long" {
+			cash -= qty * bar.Close
+			shares = qty
+		} else {
+			cash += qty * bar.Close
+			shares = -qty
+		}
+	}
+
+	for _, bar := range bars {
+		// Skip signals from before the history starts; act on the latest one due
+		action := ""
+		for next < len(pending) && !pending[next].Time.After(bar.Timestamp) {
+			if a := pending[next].Action; a == "BUY" || a == "SELL" {
+				action = a
+			}
+			next++
+		}
+
+		switch {
+		case action == "BUY" && shares <= 0:
+			if shares < 0 {
+				closePosition(bar)
+			}
+			openPosition(bar, "long", math.Floor(cash/bar.Close))
+		case action == "SELL" && shares >= 0:
+			if shares > 0 {
+				closePosition(bar)
+			}
+			if opts.AllowShort && cash > 0 {
+				openPosition(bar, "short", math.Floor(cash/bar.Close))
+			}
+		}
+
+		equity := cash + shares*bar.Close
+		result.EquityCurve = append(result.EquityCurve, EquityPoint{Time: bar.Timestamp, Equity: equity})
+		if equity > peak {
+			peak = equity
+		}
+		if dd := (peak - equity) / peak; dd > result.MaxDrawdown {
+			result.MaxDrawdown = dd
+		}
+	}
+
+	last := result.EquityCurve[len(result.EquityCurve)-1]
+	result.FinalEquity = last.Equity
+	result.TotalReturn = last.Equity/startingCash - 1
+	result.OpenShares = shares
+	result.Cash = cash
+
+	wins := 0
+	for _, t := range result.Trades {
+		if t.PL > 0 {
+			wins++
+		}
+	}
+	if len(result.Trades) > 0 {
+		result.WinRate = float64(wins) / float64(len(result.Trades))
+	}
+	return result
+}
+
+// SMACrossSignals derives signals from a moving-average crossover: BUY when the fast
+// SMA closes above the slow one after being at or below it, SELL on the reverse.
+// It returns nil when there isn't enough history for the slow average or fast isn't
+// shorter than slow.
+func SMACrossSignals(candles []models.Candle, fast, slow int) []Signal {
+	if fast >= slow {
+		return nil
+	}
+	sorted := append([]models.Candle{}, candles...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+	closes := make([]float64, len(sorted))
+	for i, c := range sorted {
+		closes[i] = c.Close
+	}
+
+	fastSMA, err := indicators.SMA(closes, fast)
+	if err != nil {
+		return nil
+	}
+	slowSMA, err := indicators.SMA(closes, slow)
+	if err != nil {
+		return nil
+	}
+
+	// Both series end on the last close; align the fast one to the slow one's start
+	fastSMA = fastSMA[len(fastSMA)-len(slowSMA):]
+	offset := len(sorted) - len(slowSMA)
+
+	var signals []Signal
+	for i := 1; i < len(slowSMA); i++ {
+		above, wasAbove := fastSMA[i] > slowSMA[i], fastSMA[i-1] > slowSMA[i-1]
+		switch {
+		case above && !wasAbove:
+			signals = append(signals, Signal{Time: sorted[offset+i].Timestamp, Action: "BUY"})
+		case !above && wasAbove:
+			signals = append(signals, Signal{Time: sorted[offset+i].Timestamp, Action: "SELL"})
+		}
+	}
+	return signals
+}
@@ -7,7 +7,20 @@ import (
 	"encoding/base64"
 	"errors"
 	"io"
+	"math"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockmarket/internal/logging"
+)
+
+// WebSocket malformed message policies
+const (
+	WSMalformedPolicyError  = "error"  // reply with an error frame and keep the connection
+	WSMalformedPolicyIgnore = "ignore" // drop the message silently and keep the connection
 )
 
 // Config holds application configuration
@@ -16,6 +29,346 @@ type Config struct {
 	DatabasePath  string
 	EncryptionKey []byte // 32 bytes for AES-256
 	Environment   string
+
+	// OldEncryptionKeys are previous ENCRYPTION_KEY values still accepted for decryption
+	// while stored secrets are rewrapped under EncryptionKey
+	OldEncryptionKeys [][]byte
+	// EncryptionKeyGenerated is set when ENCRYPTION_KEY was unset and a throwaway key is in use
+	EncryptionKeyGenerated bool
+
+	LogLevel  string // "debug" | "info" | "warn" | "error"
+	LogFormat string // "text" | "json"
+
+	// APIKey, when set, is required on every /api request except /api/health
+	APIKey string
+
+	// CORSAllowedOrigins are the origins allowed to make cross-origin requests ("*" for
+	// any); when empty, development allows any origin and other environments none
+	CORSAllowedOrigins []string
+
+	// Per-client request limits (requests per minute, 0 disables); analyze endpoints
+	// have their own since each call spends AI credits
+	APIRateLimit     int
+	APIRateBurst     int
+	AnalyzeRateLimit int
+	AnalyzeRateBurst int
+	// TrustProxyHeaders identifies clients by X-Forwarded-For instead of the peer address
+	TrustProxyHeaders bool
+
+	// CompressResponses gzip/deflate-compresses JSON responses of at least CompressMinBytes
+	CompressResponses bool
+	CompressMinBytes  int
+
+	// WSMalformedMessagePolicy controls how unparseable client frames are handled
+	WSMalformedMessagePolicy string
+
+	// Outbound analysis webhook (disabled when URL is empty)
+	AnalysisWebhookURL           string
+	AnalysisWebhookActions       []string // empty forwards every action
+	AnalysisWebhookMinConfidence float64
+
+	// Quote52WeekRange adds 52-week high/low context to quotes and analysis prompts
+	Quote52WeekRange bool
+
+	// NotifyDrainTimeout bounds how long shutdown waits for queued notifications
+	NotifyDrainTimeout time.Duration
+
+	// Notification dispatch pool: concurrent senders and how many notifications may
+	// wait for one before new ones are dropped
+	NotifyWorkers   int
+	NotifyQueueSize int
+
+	// Notification delivery: the time allowed to send one notification to all its
+	// channels, and how often a transient failure is retried with doubling backoff
+	NotifySendTimeout  time.Duration
+	NotifyRetries      int
+	NotifyRetryBackoff time.Duration
+
+	// Background job queue: how many times a job runs before it's marked failed, the
+	// wait before its first retry (doubled each attempt), and how long finished jobs
+	// are kept (0 keeps them)
+	JobMaxAttempts  int
+	JobRetryBackoff time.Duration
+	JobRetention    time.Duration
+
+	// Price guardrails for AI output (multiple <= 1 disables the check)
+	AnalysisMaxPriceMultiple float64
+	AnalysisGuardrailMode    string // "flag" | "reject" | "retry"
+
+	// AnalysisInvalidRetries is how many times to re-run an analysis whose response is missing required fields
+	AnalysisInvalidRetries int
+
+	// PromptTemplatesDir holds analysis prompt template overrides (empty uses the built-in prompt)
+	PromptTemplatesDir string
+
+	// Retry a low-confidence HOLD with no real reasoning once with a more directive prompt
+	AnalysisBareHoldRetry      bool
+	AnalysisBareHoldConfidence float64 // HOLDs below this confidence are candidates
+
+	// AnalysisRisksRetry re-runs an analysis once when the model lists no risks, a second
+	// paid AI call, so it is off by default
+	AnalysisRisksRetry bool
+
+	// AnalysisCalibration scales down BUY/SELL confidence the computed indicators contradict
+	AnalysisCalibration bool
+
+	// AnalysisConfidenceSmoothing is the EWMA weight given to a symbol's prior confidence (0 disables)
+	AnalysisConfidenceSmoothing float64
+
+	// AnalysisPositionContext adds the user's position in the symbol to analysis prompts
+	AnalysisPositionContext bool
+
+	// AnalysisTranscriptSentiment adds earnings-call sentiment to every analysis
+	AnalysisTranscriptSentiment bool
+
+	// AnalysisTimeframes are the periods fetched for multi-timeframe analysis, by
+	// trade frequency
+	AnalysisTimeframes map[string][]string
+
+	// StoreRawPrompts keeps each analysis's prompt and raw AI reply for debugging
+	StoreRawPrompts bool
+
+	// ProviderAPIKeys are server-configured API keys by provider name, used for
+	// per-request provider overrides
+	ProviderAPIKeys map[string]string
+
+	// AlertMaxQuoteAge is the oldest quote that may trigger a price alert (0 disables the check)
+	AlertMaxQuoteAge time.Duration
+
+	// AlertExpirySweepInterval is how often expired alerts are deactivated (0 disables the sweep)
+	AlertExpirySweepInterval time.Duration
+
+	// AlertDuplicateTolerance is how far apart, in percent, two alerts' thresholds may be
+	// for GET /api/alerts/duplicates to flag them as duplicates
+	AlertDuplicateTolerance float64
+
+	// SoftDeleteRetention is how long deleted alerts and analyses can be restored
+	// before they're purged (0 keeps them forever)
+	SoftDeleteRetention time.Duration
+
+	// MetricsPrometheus also serves the request metrics in the Prometheus text format at /metrics
+	MetricsPrometheus bool
+
+	// DataRetentionDays is how many days of analyses and quote snapshots are kept before
+	// they're pruned (0 keeps them forever)
+	DataRetentionDays int
+
+	// MarketDataFallbacks are providers tried, in order, when the saved provider fails
+	MarketDataFallbacks []string
+
+	// ProviderClockSkewThreshold is how far in the future a provider timestamp may be before it is logged
+	ProviderClockSkewThreshold time.Duration
+
+	// Provider health probing (interval 0 disables)
+	ProviderHealthInterval time.Duration
+	ProviderHealthSymbol   string
+
+	// NotifyRateLimits are outbound limits by channel type (e.g. "sms")
+	NotifyRateLimits map[string]ChannelRateLimit
+
+	// Location is the timezone for scheduled jobs such as the daily digest
+	Location *time.Location
+
+	// Quiet hours hold back notifications between two "HH:MM" times in
+	// QuietHoursLocation; unset start and end disable them
+	QuietHoursStart    string
+	QuietHoursEnd      string
+	QuietHoursLocation *time.Location
+	QuietHoursMode     string // "defer", "digest" or "drop"
+
+	// Daily digest of analyses and triggered alerts
+	DigestEnabled bool
+	DigestTime    string // "HH:MM" in Location
+
+	// Scheduled analysis of every profile's tracked symbols, either every
+	// AutoAnalysisInterval or daily at each of AutoAnalysisTimes ("HH:MM" in
+	// Location); both unset disables it
+	AutoAnalysisInterval time.Duration
+	AutoAnalysisTimes    []string
+	// AutoAnalysisGroups limits scheduled runs to the symbols in these watchlist
+	// groups ("Ungrouped" for those in none); empty analyzes whole watchlists
+	AutoAnalysisGroups []string
+
+	// RiskReviewWorkers bounds the analyses a portfolio risk review runs at once
+	RiskReviewWorkers int
+
+	// Market hours: with MarketHoursOnly, background polling and quote streams idle
+	// while the market is closed
+	MarketHoursOnly     bool
+	MarketExtendedHours bool     // count pre-market and after-hours as open
+	MarketHolidays      []string // extra closed dates, "YYYY-MM-DD"
+
+	// QuoteSnapshots records each polled quote for export
+	QuoteSnapshots bool
+
+	// SectorETFs are the sector funds used for sector performance, in display order
+	SectorETFs     []SectorETF
+	SectorCacheTTL time.Duration
+
+	// AnalysisSectorContext adds sector performance to analysis prompts
+	AnalysisSectorContext bool
+
+	// AnalysisLevels adds detected support/resistance levels to analysis prompts
+	AnalysisLevels bool
+
+	// AnalysisIndicators adds RSI, moving averages and MACD to analysis prompts
+	AnalysisIndicators bool
+
+	// AnalysisVWAP adds current-session VWAP, from an extra intraday fetch, to daily
+	// analysis prompts
+	AnalysisVWAP bool
+
+	// LevelClusterTolerance is how close swing points must be (fraction of price) to form one level
+	LevelClusterTolerance float64
+
+	// ProviderRetryAttempts and ProviderRetryBaseDelay tune retries of transient
+	// market provider failures (429/5xx and connection errors)
+	ProviderRetryAttempts  int
+	ProviderRetryBaseDelay time.Duration
+
+	// ProviderRateLimits are request budgets by market provider name, shared by all
+	// requests to that provider
+	ProviderRateLimits map[string]ProviderRateLimit
+	// ProviderRateLimitWait is how long a request may wait for budget before failing (0 fails fast)
+	ProviderRateLimitWait time.Duration
+
+	// AnalysisBenchmark adds a comparison against BenchmarkSymbol (returns, beta and
+	// relative strength) to analyses that don't request their own benchmark
+	AnalysisBenchmark bool
+	BenchmarkSymbol   string
+
+	// AnalysisModelRules pick the AI model per symbol or horizon; symbol rules win
+	AnalysisModelRules []ModelRule
+
+	// EnsembleMembers are the models the "ensemble" AI provider consults, each given
+	// EnsembleMemberTimeout to answer (0 leaves it to the analysis timeout)
+	EnsembleMembers       []EnsembleMember
+	EnsembleMemberTimeout time.Duration
+
+	// OllamaBaseURL is the local Ollama server used by the "ollama" AI provider
+	OllamaBaseURL string
+
+	// AIModelPrices override the built-in per-model token prices, keyed by model-name prefix
+	AIModelPrices map[string]ModelPrice
+
+	// StreamPollInterval overrides the providers' quote streaming cadence (0 keeps their defaults)
+	StreamPollInterval time.Duration
+
+	// WSHeartbeatInterval is how often WebSocket clients are pinged; a client that
+	// misses two intervals without a pong is disconnected (0 disables)
+	WSHeartbeatInterval time.Duration
+
+	// WSSubscriptionTTL is how long a disconnected client's subscriptions are kept for it
+	// to reclaim by reconnecting with the same client_id (0 disables)
+	WSSubscriptionTTL time.Duration
+
+	// WSMaxSubscriptions caps how many symbols one WebSocket connection may subscribe to (0 disables)
+	WSMaxSubscriptions int
+
+	// TradesProvider is the market data provider used for WebSocket trade subscriptions
+	// (empty uses the saved provider)
+	TradesProvider string
+
+	// CryptoProvider is the market data provider crypto pairs like BTC-USD are routed
+	// to, whatever provider the profile saved; BinanceBaseURL is Binance's API root
+	CryptoProvider string
+	BinanceBaseURL string
+
+	// MockSeed picks the price series the mock market data provider generates
+	MockSeed int64
+
+	// AnalysisCacheTTL is how long an analysis is reused for an identical request (0
+	// disables); AnalysisCacheMaxMove is the price move, in percent, that invalidates it
+	AnalysisCacheTTL     time.Duration
+	AnalysisCacheMaxMove float64
+
+	// QuoteCacheTTL and HistoricalCacheTTL are how long provider responses are reused (0 disables)
+	QuoteCacheTTL      time.Duration
+	HistoricalCacheTTL time.Duration
+	// HistoricalCachePersist keeps historical candles in the database, so only their
+	// newest bars are refetched, even after a restart
+	HistoricalCachePersist bool
+
+	// FundamentalsProvider serves dividend fundamentals for screening (empty uses the
+	// saved provider); FundamentalsCacheTTL is how long they are reused (0 disables)
+	FundamentalsProvider string
+	FundamentalsCacheTTL time.Duration
+
+	// IntradayProvider serves the intraday bars behind VWAP (empty uses the saved provider)
+	IntradayProvider string
+
+	// AIMonthlyBudget is the monthly AI spend cap in USD (0 disables)
+	AIMonthlyBudget float64
+
+	// AIBreakerThreshold consecutive AI provider failures within AIBreakerWindow open the
+	// provider's circuit, failing analyses fast for AIBreakerCooldown (0 disables)
+	AIBreakerThreshold int
+	AIBreakerWindow    time.Duration
+	AIBreakerCooldown  time.Duration
+
+	// DashboardCallTimeout bounds each provider call made by the dashboard endpoint
+	DashboardCallTimeout time.Duration
+
+	// Request timeouts: QuoteTimeout and HistoricalTimeout bound market data fetches,
+	// AnalyzeTimeout a whole analysis including its fetches and the AI call
+	QuoteTimeout      time.Duration
+	HistoricalTimeout time.Duration
+	AnalyzeTimeout    time.Duration
+
+	// MoversCacheTTL is how long gainers/losers lists are cached
+	MoversCacheTTL time.Duration
+
+	// StreamSplitTolerance is how close a price jump must be to a split ratio to be flagged (0 disables)
+	StreamSplitTolerance float64
+
+	// StreamDedupe skips streamed quotes that repeat the last one sent for their symbol:
+	// volume unchanged and price within StreamPriceEpsilon of it
+	StreamDedupe       bool
+	StreamPriceEpsilon float64
+}
+
+// ChannelRateLimit is a token-bucket limit for one notification channel type
+type ChannelRateLimit struct {
+	Burst     int           // notifications allowed per interval
+	Interval  time.Duration // refill period for the full burst
+	QueueSize int           // throttled notifications held before overflow
+	Overflow  string        // "drop" | "digest"
+}
+
+// ProviderRateLimit is a token-bucket limit for one market data provider
+type ProviderRateLimit struct {
+	Count    int           // requests allowed per interval
+	Interval time.Duration // refill period for Count requests
+	Burst    int           // requests allowed back to back; defaults to Count
+}
+
+// SectorETF maps a market sector to the ETF used to measure it
+type SectorETF struct {
+	Sector string
+	Symbol string
+}
+
+// defaultAnalysisTimeframes are the periods multi-timeframe analysis fetches per trade
+// frequency: intraday plus daily for day traders, longer trends for swing traders
+var defaultAnalysisTimeframes = map[string][]string{
+	"daily":  {"5d", "6m"},
+	"weekly": {"1m", "1y"},
+	"swing":  {"6m", "5y"},
+}
+
+// defaultSectorETFs are the SPDR Select Sector funds
+var defaultSectorETFs = []SectorETF{
+	{"Technology", "XLK"},
+	{"Financials", "XLF"},
+	{"Health Care", "XLV"},
+	{"Consumer Discretionary", "XLY"},
+	{"Consumer Staples", "XLP"},
+	{"Energy", "XLE"},
+	{"Industrials", "XLI"},
+	{"Materials", "XLB"},
+	{"Utilities", "XLU"},
+	{"Real Estate", "XLRE"},
+	{"Communication Services", "XLC"},
 }
 
 // Load loads configuration from environment variables
@@ -35,6 +388,471 @@ func Load() (*Config, error) {
 		env = "development"
 	}
 
+	logLevel := strings.ToLower(getEnv("LOG_LEVEL", "info"))
+	if _, ok := logging.ParseLevel(logLevel); !ok {
+		return nil, errors.New("LOG_LEVEL must be 'debug', 'info', 'warn' or 'error'")
+	}
+	logFormat := strings.ToLower(getEnv("LOG_FORMAT", logging.FormatText))
+	if logFormat != logging.FormatText && logFormat != logging.FormatJSON {
+		return nil, errors.New("LOG_FORMAT must be 'text' or 'json'")
+	}
+
+	corsAllowedOrigins := getEnvList("CORS_ALLOWED_ORIGINS", false)
+	for i, origin := range corsAllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return nil, errors.New("CORS_ALLOWED_ORIGINS must be a comma-separated list of origins (e.g. https://app.example.com) or *")
+		}
+		corsAllowedOrigins[i] = strings.ToLower(u.Scheme + "://" + u.Host)
+	}
+
+	wsMalformedPolicy := getEnv("WS_MALFORMED_MESSAGE_POLICY", WSMalformedPolicyError)
+	if wsMalformedPolicy != WSMalformedPolicyError && wsMalformedPolicy != WSMalformedPolicyIgnore {
+		return nil, errors.New("WS_MALFORMED_MESSAGE_POLICY must be 'error' or 'ignore'")
+	}
+
+	webhookMinConfidence, err := getEnvFloat("ANALYSIS_WEBHOOK_MIN_CONFIDENCE", 0)
+	if err != nil || webhookMinConfidence < 0 || webhookMinConfidence > 1 {
+		return nil, errors.New("ANALYSIS_WEBHOOK_MIN_CONFIDENCE must be a number between 0 and 1")
+	}
+
+	quote52WeekRange, err := getEnvBool("QUOTE_52W_RANGE", true)
+	if err != nil {
+		return nil, errors.New("QUOTE_52W_RANGE must be a boolean")
+	}
+
+	notifyDrainTimeout, err := getEnvDuration("NOTIFY_DRAIN_TIMEOUT", 10*time.Second)
+	if err != nil || notifyDrainTimeout < 0 {
+		return nil, errors.New("NOTIFY_DRAIN_TIMEOUT must be a non-negative duration, e.g. 10s")
+	}
+	notifyWorkers, err := getEnvInt("NOTIFY_WORKERS", 4)
+	if err != nil || notifyWorkers <= 0 {
+		return nil, errors.New("NOTIFY_WORKERS must be a positive integer")
+	}
+	notifyQueueSize, err := getEnvInt("NOTIFY_QUEUE_SIZE", 100)
+	if err != nil || notifyQueueSize <= 0 {
+		return nil, errors.New("NOTIFY_QUEUE_SIZE must be a positive integer")
+	}
+	notifySendTimeout, err := getEnvDuration("NOTIFY_SEND_TIMEOUT", 30*time.Second)
+	if err != nil || notifySendTimeout <= 0 {
+		return nil, errors.New("NOTIFY_SEND_TIMEOUT must be a positive duration, e.g. 30s")
+	}
+	jobMaxAttempts, err := getEnvInt("JOB_MAX_ATTEMPTS", 3)
+	if err != nil || jobMaxAttempts <= 0 {
+		return nil, errors.New("JOB_MAX_ATTEMPTS must be a positive integer")
+	}
+	jobRetryBackoff, err := getEnvDuration("JOB_RETRY_BACKOFF", 30*time.Second)
+	if err != nil || jobRetryBackoff <= 0 {
+		return nil, errors.New("JOB_RETRY_BACKOFF must be a positive duration, e.g. 30s")
+	}
+	jobRetention, err := getEnvDuration("JOB_RETENTION", 7*24*time.Hour)
+	if err != nil || jobRetention < 0 {
+		return nil, errors.New("JOB_RETENTION must be a non-negative duration, e.g. 168h")
+	}
+	apiRateLimit, err := getEnvInt("API_RATE_LIMIT", 0)
+	if err != nil || apiRateLimit < 0 {
+		return nil, errors.New("API_RATE_LIMIT must be a non-negative integer")
+	}
+	apiRateBurst, err := getEnvInt("API_RATE_BURST", 0)
+	if err != nil || apiRateBurst < 0 {
+		return nil, errors.New("API_RATE_BURST must be a non-negative integer")
+	}
+	analyzeRateLimit, err := getEnvInt("ANALYZE_RATE_LIMIT", 0)
+	if err != nil || analyzeRateLimit < 0 {
+		return nil, errors.New("ANALYZE_RATE_LIMIT must be a non-negative integer")
+	}
+	analyzeRateBurst, err := getEnvInt("ANALYZE_RATE_BURST", 0)
+	if err != nil || analyzeRateBurst < 0 {
+		return nil, errors.New("ANALYZE_RATE_BURST must be a non-negative integer")
+	}
+	trustProxyHeaders, err := getEnvBool("TRUST_PROXY_HEADERS", false)
+	if err != nil {
+		return nil, errors.New("TRUST_PROXY_HEADERS must be true or false")
+	}
+	compressResponses, err := getEnvBool("COMPRESS_RESPONSES", true)
+	if err != nil {
+		return nil, errors.New("COMPRESS_RESPONSES must be true or false")
+	}
+	compressMinBytes, err := getEnvInt("COMPRESS_MIN_BYTES", 1024)
+	if err != nil || compressMinBytes < 0 {
+		return nil, errors.New("COMPRESS_MIN_BYTES must be a non-negative integer")
+	}
+
+	notifyRetries, err := getEnvInt("NOTIFY_RETRIES", 2)
+	if err != nil || notifyRetries < 0 {
+		return nil, errors.New("NOTIFY_RETRIES must be a non-negative integer")
+	}
+	notifyRetryBackoff, err := getEnvDuration("NOTIFY_RETRY_BACKOFF", 500*time.Millisecond)
+	if err != nil || notifyRetryBackoff < 0 {
+		return nil, errors.New("NOTIFY_RETRY_BACKOFF must be a non-negative duration, e.g. 500ms")
+	}
+
+	maxPriceMultiple, err := getEnvFloat("ANALYSIS_MAX_PRICE_MULTIPLE", 3)
+	if err != nil {
+		return nil, errors.New("ANALYSIS_MAX_PRICE_MULTIPLE must be a number")
+	}
+
+	guardrailMode := getEnv("ANALYSIS_GUARDRAIL_MODE", "flag")
+	if guardrailMode != "flag" && guardrailMode != "reject" && guardrailMode != "retry" {
+		return nil, errors.New("ANALYSIS_GUARDRAIL_MODE must be 'flag', 'reject' or 'retry'")
+	}
+
+	invalidRetries, err := getEnvInt("ANALYSIS_INVALID_RETRIES", 1)
+	if err != nil || invalidRetries < 0 {
+		return nil, errors.New("ANALYSIS_INVALID_RETRIES must be a non-negative integer")
+	}
+
+	bareHoldRetry, err := getEnvBool("ANALYSIS_BARE_HOLD_RETRY", false)
+	if err != nil {
+		return nil, errors.New("ANALYSIS_BARE_HOLD_RETRY must be a boolean")
+	}
+	bareHoldConfidence, err := getEnvFloat("ANALYSIS_BARE_HOLD_CONFIDENCE", 0.5)
+	if err != nil || bareHoldConfidence < 0 || bareHoldConfidence > 1 {
+		return nil, errors.New("ANALYSIS_BARE_HOLD_CONFIDENCE must be a number between 0 and 1")
+	}
+
+	storeRawPrompts, err := getEnvBool("STORE_RAW_PROMPTS", false)
+	if err != nil {
+		return nil, errors.New("STORE_RAW_PROMPTS must be a boolean")
+	}
+
+	risksRetry, err := getEnvBool("ANALYSIS_RISKS_RETRY", false)
+	if err != nil {
+		return nil, errors.New("ANALYSIS_RISKS_RETRY must be a boolean")
+	}
+
+	calibration, err := getEnvBool("ANALYSIS_CALIBRATION", false)
+	if err != nil {
+		return nil, errors.New("ANALYSIS_CALIBRATION must be true or false")
+	}
+
+	confidenceSmoothing, err := getEnvFloat("ANALYSIS_CONFIDENCE_SMOOTHING", 0)
+	if err != nil || confidenceSmoothing < 0 || confidenceSmoothing >= 1 {
+		return nil, errors.New("ANALYSIS_CONFIDENCE_SMOOTHING must be a number between 0 and 1 (exclusive)")
+	}
+
+	positionContext, err := getEnvBool("ANALYSIS_POSITION_CONTEXT", false)
+	if err != nil {
+		return nil, errors.New("ANALYSIS_POSITION_CONTEXT must be a boolean")
+	}
+
+	transcriptSentiment, err := getEnvBool("ANALYSIS_TRANSCRIPT_SENTIMENT", false)
+	if err != nil {
+		return nil, errors.New("ANALYSIS_TRANSCRIPT_SENTIMENT must be a boolean")
+	}
+
+	// ANALYSIS_TIMEFRAMES applies to every frequency without its own ANALYSIS_TIMEFRAMES_<FREQ>
+	analysisTimeframes := make(map[string][]string, len(defaultAnalysisTimeframes))
+	sharedTimeframes := getEnvList("ANALYSIS_TIMEFRAMES", false)
+	for frequency, periods := range defaultAnalysisTimeframes {
+		if len(sharedTimeframes) > 0 {
+			periods = sharedTimeframes
+		}
+		if own := getEnvList("ANALYSIS_TIMEFRAMES_"+strings.ToUpper(frequency), false); len(own) > 0 {
+			periods = own
+		}
+		analysisTimeframes[frequency] = periods
+	}
+
+	splitTolerance, err := getEnvFloat("STREAM_SPLIT_TOLERANCE", 0.03)
+	if err != nil || splitTolerance < 0 || splitTolerance >= 0.2 {
+		return nil, errors.New("STREAM_SPLIT_TOLERANCE must be a number between 0 and 0.2")
+	}
+	streamDedupe, err := getEnvBool("STREAM_DEDUPE", true)
+	if err != nil {
+		return nil, errors.New("STREAM_DEDUPE must be true or false")
+	}
+	streamPriceEpsilon, err := getEnvFloat("STREAM_PRICE_EPSILON", 0)
+	if err != nil || streamPriceEpsilon < 0 {
+		return nil, errors.New("STREAM_PRICE_EPSILON must be a non-negative number")
+	}
+	mockSeed, err := getEnvInt("MOCK_SEED", 1)
+	if err != nil {
+		return nil, errors.New("MOCK_SEED must be an integer")
+	}
+
+	alertMaxQuoteAge, err := getEnvDuration("ALERT_MAX_QUOTE_AGE", 0)
+	if err != nil || alertMaxQuoteAge < 0 {
+		return nil, errors.New("ALERT_MAX_QUOTE_AGE must be a non-negative duration (e.g. 15m)")
+	}
+
+	alertExpirySweep, err := getEnvDuration("ALERT_EXPIRY_SWEEP_INTERVAL", time.Minute)
+	if err != nil || alertExpirySweep < 0 {
+		return nil, errors.New("ALERT_EXPIRY_SWEEP_INTERVAL must be a non-negative duration (e.g. 1m)")
+	}
+	alertDuplicateTolerance, err := getEnvFloat("ALERT_DUPLICATE_TOLERANCE", 0.1)
+	if err != nil || alertDuplicateTolerance < 0 {
+		return nil, errors.New("ALERT_DUPLICATE_TOLERANCE must be a non-negative percentage")
+	}
+
+	softDeleteRetention, err := getEnvDuration("SOFT_DELETE_RETENTION", 30*24*time.Hour)
+	if err != nil || softDeleteRetention < 0 {
+		return nil, errors.New("SOFT_DELETE_RETENTION must be a non-negative duration (e.g. 720h)")
+	}
+
+	metricsPrometheus, err := getEnvBool("METRICS_PROMETHEUS", false)
+	if err != nil {
+		return nil, errors.New("METRICS_PROMETHEUS must be true or false")
+	}
+
+	dataRetentionDays, err := getEnvInt("DATA_RETENTION_DAYS", 0)
+	if err != nil || dataRetentionDays < 0 {
+		return nil, errors.New("DATA_RETENTION_DAYS must be a non-negative integer")
+	}
+
+	clockSkewThreshold, err := getEnvDuration("PROVIDER_CLOCK_SKEW_THRESHOLD", 5*time.Second)
+	if err != nil || clockSkewThreshold < 0 {
+		return nil, errors.New("PROVIDER_CLOCK_SKEW_THRESHOLD must be a non-negative duration (e.g. 5s)")
+	}
+
+	providerHealthInterval, err := getEnvDuration("PROVIDER_HEALTH_INTERVAL", time.Minute)
+	if err != nil || providerHealthInterval < 0 {
+		return nil, errors.New("PROVIDER_HEALTH_INTERVAL must be a non-negative duration (e.g. 1m)")
+	}
+
+	throttleQueue, err := getEnvInt("NOTIFY_THROTTLE_QUEUE", 20)
+	if err != nil || throttleQueue < 1 {
+		return nil, errors.New("NOTIFY_THROTTLE_QUEUE must be a positive integer")
+	}
+	notifyRateLimits, err := parseRateLimits(os.Getenv("NOTIFY_RATE_LIMITS"), throttleQueue)
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := time.LoadLocation(getEnv("TIMEZONE", "America/New_York"))
+	if err != nil {
+		return nil, errors.New("TIMEZONE must be an IANA timezone name (e.g. America/New_York)")
+	}
+
+	quietStart, quietEnd := getEnv("QUIET_HOURS_START", ""), getEnv("QUIET_HOURS_END", "")
+	if (quietStart == "") != (quietEnd == "") {
+		return nil, errors.New("QUIET_HOURS_START and QUIET_HOURS_END must be set together")
+	}
+	for _, clock := range []string{quietStart, quietEnd} {
+		if _, err := time.Parse("15:04", clock); clock != "" && err != nil {
+			return nil, errors.New("QUIET_HOURS_START and QUIET_HOURS_END must be 24-hour times like 22:00")
+		}
+	}
+	if quietStart != "" && quietStart == quietEnd {
+		return nil, errors.New("QUIET_HOURS_START and QUIET_HOURS_END must differ")
+	}
+	quietLocation := location
+	if name := os.Getenv("QUIET_HOURS_TIMEZONE"); name != "" {
+		if quietLocation, err = time.LoadLocation(name); err != nil {
+			return nil, errors.New("QUIET_HOURS_TIMEZONE must be an IANA timezone name (e.g. Europe/London)")
+		}
+	}
+	quietMode := getEnv("QUIET_HOURS_MODE", "defer")
+	switch quietMode {
+	case "defer", "digest", "drop":
+	default:
+		return nil, errors.New("QUIET_HOURS_MODE must be defer, digest or drop")
+	}
+
+	digestEnabled, err := getEnvBool("DIGEST_ENABLED", false)
+	if err != nil {
+		return nil, errors.New("DIGEST_ENABLED must be a boolean")
+	}
+	digestTime := getEnv("DIGEST_TIME", "17:00")
+	if _, err := time.Parse("15:04", digestTime); err != nil {
+		return nil, errors.New("DIGEST_TIME must be a 24-hour time like 17:00")
+	}
+
+	autoAnalysisInterval, autoAnalysisTimes, err := parseAutoAnalysisSchedule(os.Getenv("AUTO_ANALYSIS_SCHEDULE"))
+	if err != nil {
+		return nil, err
+	}
+	riskReviewWorkers, err := getEnvInt("RISK_REVIEW_WORKERS", 2)
+	if err != nil || riskReviewWorkers <= 0 {
+		return nil, errors.New("RISK_REVIEW_WORKERS must be a positive integer")
+	}
+
+	marketHoursOnly, err := getEnvBool("MARKET_HOURS_ONLY", true)
+	if err != nil {
+		return nil, errors.New("MARKET_HOURS_ONLY must be a boolean")
+	}
+	marketExtendedHours, err := getEnvBool("MARKET_EXTENDED_HOURS", false)
+	if err != nil {
+		return nil, errors.New("MARKET_EXTENDED_HOURS must be a boolean")
+	}
+	marketHolidays := getEnvList("MARKET_HOLIDAYS", false)
+	for _, date := range marketHolidays {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, errors.New("MARKET_HOLIDAYS must be a comma-separated list of dates like 2026-11-27")
+		}
+	}
+
+	quoteSnapshots, err := getEnvBool("QUOTE_SNAPSHOTS", false)
+	if err != nil {
+		return nil, errors.New("QUOTE_SNAPSHOTS must be a boolean")
+	}
+
+	sectorETFs := defaultSectorETFs
+	if spec := os.Getenv("SECTOR_ETFS"); spec != "" {
+		sectorETFs = nil
+		for _, entry := range strings.Split(spec, ",") {
+			sector, symbol, ok := strings.Cut(entry, "=")
+			sector, symbol = strings.TrimSpace(sector), strings.ToUpper(strings.TrimSpace(symbol))
+			if !ok || sector == "" || symbol == "" {
+				return nil, errors.New(`SECTOR_ETFS entries must look like "Technology=XLK"`)
+			}
+			sectorETFs = append(sectorETFs, SectorETF{Sector: sector, Symbol: symbol})
+		}
+	}
+	sectorCacheTTL, err := getEnvDuration("SECTOR_CACHE_TTL", 15*time.Minute)
+	if err != nil || sectorCacheTTL < 0 {
+		return nil, errors.New("SECTOR_CACHE_TTL must be a non-negative duration (e.g. 15m)")
+	}
+	sectorContext, err := getEnvBool("ANALYSIS_SECTOR_CONTEXT", false)
+	if err != nil {
+		return nil, errors.New("ANALYSIS_SECTOR_CONTEXT must be a boolean")
+	}
+
+	analysisLevels, err := getEnvBool("ANALYSIS_LEVELS", true)
+	if err != nil {
+		return nil, errors.New("ANALYSIS_LEVELS must be a boolean")
+	}
+	analysisIndicators, err := getEnvBool("ANALYSIS_INDICATORS", true)
+	if err != nil {
+		return nil, errors.New("ANALYSIS_INDICATORS must be a boolean")
+	}
+	analysisVWAP, err := getEnvBool("ANALYSIS_VWAP", false)
+	if err != nil {
+		return nil, errors.New("ANALYSIS_VWAP must be a boolean")
+	}
+	levelTolerance, err := getEnvFloat("LEVELS_CLUSTER_TOLERANCE", 0.015)
+	if err != nil || levelTolerance < 0 || levelTolerance >= 1 {
+		return nil, errors.New("LEVELS_CLUSTER_TOLERANCE must be a number between 0 and 1")
+	}
+
+	retryAttempts, err := getEnvInt("PROVIDER_RETRY_ATTEMPTS", 3)
+	if err != nil || retryAttempts < 1 {
+		return nil, errors.New("PROVIDER_RETRY_ATTEMPTS must be a positive integer")
+	}
+	retryBaseDelay, err := getEnvDuration("PROVIDER_RETRY_BASE_DELAY", 500*time.Millisecond)
+	if err != nil || retryBaseDelay <= 0 {
+		return nil, errors.New("PROVIDER_RETRY_BASE_DELAY must be a positive duration (e.g. 500ms)")
+	}
+	providerRateLimits, err := parseProviderRateLimits(os.Getenv("PROVIDER_RATE_LIMITS"))
+	if err != nil {
+		return nil, err
+	}
+	rateLimitWait, err := getEnvDuration("PROVIDER_RATE_LIMIT_WAIT", 0)
+	if err != nil || rateLimitWait < 0 {
+		return nil, errors.New("PROVIDER_RATE_LIMIT_WAIT must be a non-negative duration (e.g. 10s)")
+	}
+
+	modelPrices, err := parseModelPrices(os.Getenv("AI_MODEL_PRICES"))
+	if err != nil {
+		return nil, err
+	}
+
+	modelRules, err := parseModelRules(os.Getenv("ANALYSIS_MODEL_RULES"))
+	if err != nil {
+		return nil, err
+	}
+	ensembleMembers, err := parseEnsembleMembers(os.Getenv("AI_ENSEMBLE_MEMBERS"))
+	if err != nil {
+		return nil, err
+	}
+	ensembleMemberTimeout, err := getEnvDuration("AI_ENSEMBLE_MEMBER_TIMEOUT", 0)
+	if err != nil || ensembleMemberTimeout < 0 {
+		return nil, errors.New("AI_ENSEMBLE_MEMBER_TIMEOUT must be a non-negative duration (e.g. 40s)")
+	}
+
+	streamPollInterval, err := getEnvDuration("STREAM_POLL_INTERVAL", 0)
+	if err != nil || streamPollInterval < 0 {
+		return nil, errors.New("STREAM_POLL_INTERVAL must be a non-negative duration (e.g. 5s)")
+	}
+
+	wsHeartbeatInterval, err := getEnvDuration("WS_HEARTBEAT_INTERVAL", 30*time.Second)
+	if err != nil || wsHeartbeatInterval < 0 {
+		return nil, errors.New("WS_HEARTBEAT_INTERVAL must be a non-negative duration (e.g. 30s)")
+	}
+
+	wsSubscriptionTTL, err := getEnvDuration("WS_SUBSCRIPTION_TTL", 10*time.Minute)
+	if err != nil || wsSubscriptionTTL < 0 {
+		return nil, errors.New("WS_SUBSCRIPTION_TTL must be a non-negative duration (e.g. 10m)")
+	}
+
+	wsMaxSubscriptions, err := getEnvInt("WS_MAX_SUBSCRIPTIONS", 50)
+	if err != nil || wsMaxSubscriptions < 0 {
+		return nil, errors.New("WS_MAX_SUBSCRIPTIONS must be a non-negative integer")
+	}
+
+	analysisBenchmark, err := getEnvBool("ANALYSIS_BENCHMARK", true)
+	if err != nil {
+		return nil, errors.New("ANALYSIS_BENCHMARK must be a boolean")
+	}
+
+	analysisCacheTTL, err := getEnvDuration("ANALYSIS_CACHE_TTL", 10*time.Minute)
+	if err != nil || analysisCacheTTL < 0 {
+		return nil, errors.New("ANALYSIS_CACHE_TTL must be a non-negative duration (e.g. 10m)")
+	}
+	analysisCacheMaxMove, err := getEnvFloat("ANALYSIS_CACHE_MAX_MOVE", 0.5)
+	if err != nil || analysisCacheMaxMove < 0 {
+		return nil, errors.New("ANALYSIS_CACHE_MAX_MOVE must be a non-negative percentage")
+	}
+
+	quoteCacheTTL, err := getEnvDuration("QUOTE_CACHE_TTL", 15*time.Second)
+	if err != nil || quoteCacheTTL < 0 {
+		return nil, errors.New("QUOTE_CACHE_TTL must be a non-negative duration (e.g. 15s)")
+	}
+	historicalCacheTTL, err := getEnvDuration("HISTORICAL_CACHE_TTL", 5*time.Minute)
+	if err != nil || historicalCacheTTL < 0 {
+		return nil, errors.New("HISTORICAL_CACHE_TTL must be a non-negative duration (e.g. 5m)")
+	}
+	historicalCachePersist, err := getEnvBool("HISTORICAL_CACHE_PERSIST", true)
+	if err != nil {
+		return nil, errors.New("HISTORICAL_CACHE_PERSIST must be a boolean")
+	}
+	fundamentalsCacheTTL, err := getEnvDuration("FUNDAMENTALS_CACHE_TTL", 24*time.Hour)
+	if err != nil || fundamentalsCacheTTL < 0 {
+		return nil, errors.New("FUNDAMENTALS_CACHE_TTL must be a non-negative duration (e.g. 24h)")
+	}
+
+	aiMonthlyBudget, err := getEnvFloat("AI_MONTHLY_BUDGET", 0)
+	if err != nil || aiMonthlyBudget < 0 {
+		return nil, errors.New("AI_MONTHLY_BUDGET must be a non-negative number")
+	}
+	aiBreakerThreshold, err := getEnvInt("AI_BREAKER_THRESHOLD", 5)
+	if err != nil || aiBreakerThreshold < 0 {
+		return nil, errors.New("AI_BREAKER_THRESHOLD must be a non-negative integer")
+	}
+	aiBreakerWindow, err := getEnvDuration("AI_BREAKER_WINDOW", time.Minute)
+	if err != nil || aiBreakerWindow <= 0 {
+		return nil, errors.New("AI_BREAKER_WINDOW must be a positive duration (e.g. 1m)")
+	}
+	aiBreakerCooldown, err := getEnvDuration("AI_BREAKER_COOLDOWN", 30*time.Second)
+	if err != nil || aiBreakerCooldown <= 0 {
+		return nil, errors.New("AI_BREAKER_COOLDOWN must be a positive duration (e.g. 30s)")
+	}
+
+	dashboardCallTimeout, err := getEnvDuration("DASHBOARD_CALL_TIMEOUT", 3*time.Second)
+	if err != nil || dashboardCallTimeout <= 0 {
+		return nil, errors.New("DASHBOARD_CALL_TIMEOUT must be a positive duration (e.g. 3s)")
+	}
+	quoteTimeout, err := getEnvDuration("QUOTE_TIMEOUT", 30*time.Second)
+	if err != nil || quoteTimeout <= 0 {
+		return nil, errors.New("QUOTE_TIMEOUT must be a positive duration (e.g. 30s)")
+	}
+	historicalTimeout, err := getEnvDuration("HISTORICAL_TIMEOUT", 30*time.Second)
+	if err != nil || historicalTimeout <= 0 {
+		return nil, errors.New("HISTORICAL_TIMEOUT must be a positive duration (e.g. 30s)")
+	}
+	analyzeTimeout, err := getEnvDuration("ANALYZE_TIMEOUT", 60*time.Second)
+	if err != nil || analyzeTimeout <= 0 {
+		return nil, errors.New("ANALYZE_TIMEOUT must be a positive duration (e.g. 60s)")
+	}
+
+	moversCacheTTL, err := getEnvDuration("MOVERS_CACHE_TTL", 5*time.Minute)
+	if err != nil || moversCacheTTL < 0 {
+		return nil, errors.New("MOVERS_CACHE_TTL must be a non-negative duration (e.g. 5m)")
+	}
+
 	// Encryption key - in production, this should come from a secure source
 	encKeyStr := os.Getenv("ENCRYPTION_KEY")
 	var encKey []byte
@@ -51,15 +869,486 @@ func Load() (*Config, error) {
 			return nil, err
 		}
 	}
+	var oldEncKeys [][]byte
+	for _, item := range getEnvList("ENCRYPTION_OLD_KEYS", false) {
+		key, err := base64.StdEncoding.DecodeString(item)
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("ENCRYPTION_OLD_KEYS must be a comma-separated list of base64-encoded 32-byte keys")
+		}
+		oldEncKeys = append(oldEncKeys, key)
+	}
 
 	return &Config{
-		Port:          port,
-		DatabasePath:  dbPath,
-		EncryptionKey: encKey,
-		Environment:   env,
+		Port:                   port,
+		DatabasePath:           dbPath,
+		EncryptionKey:          encKey,
+		OldEncryptionKeys:      oldEncKeys,
+		EncryptionKeyGenerated: encKeyStr == "",
+		Environment:            env,
+		LogLevel:               logLevel,
+		LogFormat:              logFormat,
+
+		APIKey:            os.Getenv("API_KEY"),
+		APIRateLimit:      apiRateLimit,
+		APIRateBurst:      apiRateBurst,
+		AnalyzeRateLimit:  analyzeRateLimit,
+		AnalyzeRateBurst:  analyzeRateBurst,
+		TrustProxyHeaders: trustProxyHeaders,
+		CompressResponses: compressResponses,
+		CompressMinBytes:  compressMinBytes,
+
+		CORSAllowedOrigins: corsAllowedOrigins,
+
+		WSMalformedMessagePolicy: wsMalformedPolicy,
+		WSMaxSubscriptions:       wsMaxSubscriptions,
+		StreamPollInterval:       streamPollInterval,
+		WSHeartbeatInterval:      wsHeartbeatInterval,
+		WSSubscriptionTTL:        wsSubscriptionTTL,
+
+		AnalysisWebhookURL:           os.Getenv("ANALYSIS_WEBHOOK_URL"),
+		AnalysisWebhookActions:       getEnvList("ANALYSIS_WEBHOOK_ACTIONS", true),
+		AnalysisWebhookMinConfidence: webhookMinConfidence,
+
+		Quote52WeekRange:   quote52WeekRange,
+		NotifyDrainTimeout: notifyDrainTimeout,
+		NotifyWorkers:      notifyWorkers,
+		NotifyQueueSize:    notifyQueueSize,
+		NotifySendTimeout:  notifySendTimeout,
+		NotifyRetries:      notifyRetries,
+		NotifyRetryBackoff: notifyRetryBackoff,
+		JobMaxAttempts:     jobMaxAttempts,
+		JobRetryBackoff:    jobRetryBackoff,
+		JobRetention:       jobRetention,
+
+		AnalysisMaxPriceMultiple: maxPriceMultiple,
+		AnalysisGuardrailMode:    guardrailMode,
+		AnalysisInvalidRetries:   invalidRetries,
+		PromptTemplatesDir:       os.Getenv("PROMPT_TEMPLATES_DIR"),
+
+		AnalysisBareHoldRetry:       bareHoldRetry,
+		AnalysisBareHoldConfidence:  bareHoldConfidence,
+		AnalysisRisksRetry:          risksRetry,
+		AnalysisCalibration:         calibration,
+		AnalysisConfidenceSmoothing: confidenceSmoothing,
+		AnalysisPositionContext:     positionContext,
+		AnalysisTranscriptSentiment: transcriptSentiment,
+		AnalysisTimeframes:          analysisTimeframes,
+		StoreRawPrompts:             storeRawPrompts,
+		AnalysisModelRules:          modelRules,
+		EnsembleMembers:             ensembleMembers,
+		EnsembleMemberTimeout:       ensembleMemberTimeout,
+		AIModelPrices:               modelPrices,
+		OllamaBaseURL:               getEnv("OLLAMA_BASE_URL", "http://localhost:11434"),
+		StreamSplitTolerance:        splitTolerance,
+		StreamDedupe:                streamDedupe,
+		StreamPriceEpsilon:          streamPriceEpsilon,
+		AlertMaxQuoteAge:            alertMaxQuoteAge,
+		AlertExpirySweepInterval:    alertExpirySweep,
+		AlertDuplicateTolerance:     alertDuplicateTolerance,
+		SoftDeleteRetention:         softDeleteRetention,
+		MetricsPrometheus:           metricsPrometheus,
+		DataRetentionDays:           dataRetentionDays,
+
+		MarketDataFallbacks:        getEnvList("MARKET_DATA_FALLBACKS", false),
+		ProviderClockSkewThreshold: clockSkewThreshold,
+		ProviderHealthInterval:     providerHealthInterval,
+		ProviderHealthSymbol:       strings.ToUpper(getEnv("PROVIDER_HEALTH_SYMBOL", "SPY")),
+		ProviderRetryAttempts:      retryAttempts,
+		ProviderRetryBaseDelay:     retryBaseDelay,
+		ProviderRateLimits:         providerRateLimits,
+		ProviderRateLimitWait:      rateLimitWait,
+
+		ProviderAPIKeys:  loadProviderAPIKeys(),
+		NotifyRateLimits: notifyRateLimits,
+
+		Location:      location,
+		DigestEnabled: digestEnabled,
+		DigestTime:    digestTime,
+
+		QuietHoursStart:    quietStart,
+		QuietHoursEnd:      quietEnd,
+		QuietHoursLocation: quietLocation,
+		QuietHoursMode:     quietMode,
+
+		AutoAnalysisInterval: autoAnalysisInterval,
+		AutoAnalysisTimes:    autoAnalysisTimes,
+		AutoAnalysisGroups:   getEnvList("AUTO_ANALYSIS_GROUPS", false),
+		RiskReviewWorkers:    riskReviewWorkers,
+
+		MarketHoursOnly:     marketHoursOnly,
+		MarketExtendedHours: marketExtendedHours,
+		MarketHolidays:      marketHolidays,
+
+		QuoteSnapshots: quoteSnapshots,
+		MoversCacheTTL: moversCacheTTL,
+
+		SectorETFs:            sectorETFs,
+		SectorCacheTTL:        sectorCacheTTL,
+		AnalysisSectorContext: sectorContext,
+
+		AnalysisLevels:         analysisLevels,
+		AnalysisIndicators:     analysisIndicators,
+		AnalysisVWAP:           analysisVWAP,
+		LevelClusterTolerance:  levelTolerance,
+		AnalysisBenchmark:      analysisBenchmark,
+		BenchmarkSymbol:        strings.ToUpper(getEnv("BENCHMARK_SYMBOL", "SPY")),
+		TradesProvider:         strings.ToLower(os.Getenv("TRADES_PROVIDER")),
+		CryptoProvider:         strings.ToLower(getEnv("CRYPTO_PROVIDER", "binance")),
+		BinanceBaseURL:         strings.TrimRight(getEnv("BINANCE_BASE_URL", "https://api.binance.com"), "/"),
+		MockSeed:               int64(mockSeed),
+		AnalysisCacheTTL:       analysisCacheTTL,
+		AnalysisCacheMaxMove:   analysisCacheMaxMove,
+		QuoteCacheTTL:          quoteCacheTTL,
+		HistoricalCacheTTL:     historicalCacheTTL,
+		HistoricalCachePersist: historicalCachePersist,
+		AIMonthlyBudget:        aiMonthlyBudget,
+		AIBreakerThreshold:     aiBreakerThreshold,
+		AIBreakerWindow:        aiBreakerWindow,
+		AIBreakerCooldown:      aiBreakerCooldown,
+		DashboardCallTimeout:   dashboardCallTimeout,
+		QuoteTimeout:           quoteTimeout,
+		HistoricalTimeout:      historicalTimeout,
+		AnalyzeTimeout:         analyzeTimeout,
+
+		FundamentalsProvider: strings.ToLower(os.Getenv("FUNDAMENTALS_PROVIDER")),
+		FundamentalsCacheTTL: fundamentalsCacheTTL,
+
+		IntradayProvider: strings.ToLower(os.Getenv("INTRADAY_PROVIDER")),
 	}, nil
 }
 
+// ModelRule routes analyses of a symbol, or at a trading horizon, to a specific AI model.
+// Exactly one of Symbol and Horizon is set.
+type ModelRule struct {
+	Symbol   string
+	Horizon  string // trade frequency, e.g. "daily"
+	Provider string
+	Model    string
+}
+
+// parseModelRules parses rules like "symbol:TSLA=claude/claude-3-opus-20240229,horizon:daily=openai/gpt-4o-mini"
+func parseModelRules(spec string) ([]ModelRule, error) {
+	var rules []ModelRule
+	errInvalid := errors.New(`ANALYSIS_MODEL_RULES entries must look like "symbol:TSLA=openai/gpt-4o" or "horizon:daily=openai/gpt-4o-mini"`)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		match, target, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, errInvalid
+		}
+		kind, value, ok := strings.Cut(match, ":")
+		value = strings.TrimSpace(value)
+		if !ok || value == "" {
+			return nil, errInvalid
+		}
+		provider, model, ok := strings.Cut(strings.TrimSpace(target), "/")
+		if !ok || provider == "" || model == "" {
+			return nil, errInvalid
+		}
+
+		rule := ModelRule{Provider: strings.ToLower(provider), Model: model}
+		switch strings.ToLower(strings.TrimSpace(kind)) {
+		case "symbol":
+			rule.Symbol = strings.ToUpper(value)
+		case "horizon":
+			rule.Horizon = strings.ToLower(value)
+		default:
+			return nil, errInvalid
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// EnsembleMember is one AI model the ensemble provider consults, with its vote's weight
+type EnsembleMember struct {
+	Provider string
+	Model    string
+	Weight   float64
+}
+
+// parseEnsembleMembers parses members like "openai/gpt-4o=2,claude/claude-sonnet-4-5";
+// weights default to 1. An ensemble needs at least two members.
+func parseEnsembleMembers(spec string) ([]EnsembleMember, error) {
+	var members []EnsembleMember
+	errInvalid := errors.New(`AI_ENSEMBLE_MEMBERS entries must look like "openai/gpt-4o" or "openai/gpt-4o=2" (a positive weight)`)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		target, weightStr, hasWeight := strings.Cut(entry, "=")
+		provider, model, ok := strings.Cut(strings.TrimSpace(target), "/")
+		if !ok || provider == "" || model == "" {
+			return nil, errInvalid
+		}
+		member := EnsembleMember{Provider: strings.ToLower(provider), Model: model, Weight: 1}
+		if hasWeight {
+			weight, err := strconv.ParseFloat(strings.TrimSpace(weightStr), 64)
+			if err != nil || weight <= 0 || math.IsInf(weight, 0) {
+				return nil, errInvalid
+			}
+			member.Weight = weight
+		}
+		members = append(members, member)
+	}
+	if len(members) == 1 {
+		return nil, errors.New("AI_ENSEMBLE_MEMBERS needs at least two members")
+	}
+	return members, nil
+}
+
+// ModelPrice is a model's price in USD per million input and output tokens
+type ModelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// parseModelPrices parses per-million-token prices like "gpt-4o=2.5/10,claude-3-opus=15/75"
+func parseModelPrices(spec string) (map[string]ModelPrice, error) {
+	prices := make(map[string]ModelPrice)
+	errInvalid := errors.New(`AI_MODEL_PRICES entries must look like "gpt-4o=2.5/10" (USD per million input/output tokens)`)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		model, price, ok := strings.Cut(entry, "=")
+		model = strings.TrimSpace(model)
+		if !ok || model == "" {
+			return nil, errInvalid
+		}
+		in, out, ok := strings.Cut(price, "/")
+		if !ok {
+			return nil, errInvalid
+		}
+		input, err := strconv.ParseFloat(strings.TrimSpace(in), 64)
+		if err != nil || input < 0 {
+			return nil, errInvalid
+		}
+		output, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+		if err != nil || output < 0 {
+			return nil, errInvalid
+		}
+		prices[model] = ModelPrice{Input: input, Output: output}
+	}
+	return prices, nil
+}
+
+// parseRateLimits parses channel limits like "sms=5/1m:digest,discord=30/1m".
+// The overflow policy defaults to "drop".
+func parseRateLimits(spec string, queueSize int) (map[string]ChannelRateLimit, error) {
+	limits := make(map[string]ChannelRateLimit)
+	errInvalid := errors.New(`NOTIFY_RATE_LIMITS entries must look like "sms=5/1m" or "sms=5/1m:digest"`)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		channel, rule, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, errInvalid
+		}
+		rule, overflow, _ := strings.Cut(rule, ":")
+		if overflow == "" {
+			overflow = "drop"
+		}
+		burstStr, intervalStr, ok := strings.Cut(rule, "/")
+		if !ok {
+			return nil, errInvalid
+		}
+
+		burst, err := strconv.Atoi(strings.TrimSpace(burstStr))
+		if err != nil || burst < 1 {
+			return nil, errInvalid
+		}
+		interval, err := time.ParseDuration(strings.TrimSpace(intervalStr))
+		if err != nil || interval <= 0 {
+			return nil, errInvalid
+		}
+		if overflow != "drop" && overflow != "digest" {
+			return nil, errInvalid
+		}
+
+		limits[strings.ToLower(strings.TrimSpace(channel))] = ChannelRateLimit{
+			Burst:     burst,
+			Interval:  interval,
+			QueueSize: queueSize,
+			Overflow:  overflow,
+		}
+	}
+	return limits, nil
+}
+
+// minAutoAnalysisInterval keeps an interval schedule from spending AI budget nonstop
+const minAutoAnalysisInterval = 15 * time.Minute
+
+// parseAutoAnalysisSchedule parses an auto-analysis schedule: an interval like "2h", or
+// daily clock times like "09:45,15:30". An empty spec disables the schedule.
+func parseAutoAnalysisSchedule(spec string) (time.Duration, []string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return 0, nil, nil
+	}
+	errInvalid := errors.New(`AUTO_ANALYSIS_SCHEDULE must be an interval of at least 15m like "2h", or 24-hour times like "09:45,15:30"`)
+
+	if interval, err := time.ParseDuration(spec); err == nil {
+		if interval < minAutoAnalysisInterval {
+			return 0, nil, errInvalid
+		}
+		return interval, nil, nil
+	}
+
+	var times []string
+	for _, clock := range strings.Split(spec, ",") {
+		clock = strings.TrimSpace(clock)
+		if _, err := time.Parse("15:04", clock); err != nil {
+			return 0, nil, errInvalid
+		}
+		times = append(times, clock)
+	}
+	return 0, times, nil
+}
+
+// parseProviderRateLimits parses provider limits like "alphavantage=5/1m,finnhub=60/1m:10",
+// where the optional suffix is the burst size
+func parseProviderRateLimits(spec string) (map[string]ProviderRateLimit, error) {
+	limits := make(map[string]ProviderRateLimit)
+	errInvalid := errors.New(`PROVIDER_RATE_LIMITS entries must look like "alphavantage=5/1m" or "finnhub=60/1m:10"`)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		provider, rule, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, errInvalid
+		}
+		rule, burstStr, hasBurst := strings.Cut(rule, ":")
+		countStr, intervalStr, ok := strings.Cut(rule, "/")
+		if !ok {
+			return nil, errInvalid
+		}
+
+		count, err := strconv.Atoi(strings.TrimSpace(countStr))
+		if err != nil || count < 1 {
+			return nil, errInvalid
+		}
+		interval, err := time.ParseDuration(strings.TrimSpace(intervalStr))
+		if err != nil || interval <= 0 {
+			return nil, errInvalid
+		}
+		burst := count
+		if hasBurst {
+			burst, err = strconv.Atoi(strings.TrimSpace(burstStr))
+			if err != nil || burst < 1 {
+				return nil, errInvalid
+			}
+		}
+
+		limits[strings.ToLower(strings.TrimSpace(provider))] = ProviderRateLimit{
+			Count:    count,
+			Interval: interval,
+			Burst:    burst,
+		}
+	}
+	return limits, nil
+}
+
+// providerAPIKeyEnv maps provider names to the environment variables holding their API keys
+var providerAPIKeyEnv = map[string]string{
+	"openai":       "OPENAI_API_KEY",
+	"claude":       "ANTHROPIC_API_KEY",
+	"gemini":       "GEMINI_API_KEY",
+	"alphavantage": "ALPHAVANTAGE_API_KEY",
+	"finnhub":      "FINNHUB_API_KEY",
+	"polygon":      "POLYGON_API_KEY",
+}
+
+// loadProviderAPIKeys reads the server-configured provider API keys that are set
+func loadProviderAPIKeys() map[string]string {
+	keys := make(map[string]string)
+	for provider, env := range providerAPIKeyEnv {
+		if v := os.Getenv(env); v != "" {
+			keys[provider] = v
+		}
+	}
+	return keys
+}
+
+// getEnv returns the environment variable value or a fallback when unset
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// getEnvFloat parses a float environment variable, returning fallback when unset
+func getEnvFloat(key string, fallback float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// getEnvInt parses an integer environment variable, returning fallback when unset
+func getEnvInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// getEnvBool parses a boolean environment variable, returning fallback when unset
+func getEnvBool(key string, fallback bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// getEnvDuration parses a duration environment variable (e.g. "30s"), returning fallback when unset
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// getEnvList splits a comma-separated environment variable, dropping empty entries
+func getEnvList(key string, upper bool) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if upper {
+			item = strings.ToUpper(item)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
 // Encrypt encrypts plaintext using AES-256-GCM
 func Encrypt(plaintext string, key []byte) (string, error) {
 	block, err := aes.NewCipher(key)
@@ -81,13 +1370,41 @@ func Encrypt(plaintext string, key []byte) (string, error) {
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// Decrypt decrypts ciphertext using AES-256-GCM
-func Decrypt(ciphertext string, key []byte) (string, error) {
+// ErrUndecryptable is returned by Decrypt when none of the keys opens the ciphertext
+var ErrUndecryptable = errors.New("ciphertext can't be decrypted with any configured encryption key")
+
+// TimeframesFor returns the multi-timeframe analysis periods for a trade frequency,
+// using the weekly ones for a frequency without its own
+func (c *Config) TimeframesFor(tradeFrequency string) []string {
+	if periods, ok := c.AnalysisTimeframes[tradeFrequency]; ok {
+		return periods
+	}
+	return c.AnalysisTimeframes["weekly"]
+}
+
+// DecryptionKeys returns the keys stored secrets may be encrypted with: the current
+// ENCRYPTION_KEY first, then each of ENCRYPTION_OLD_KEYS
+func (c *Config) DecryptionKeys() [][]byte {
+	return append([][]byte{c.EncryptionKey}, c.OldEncryptionKeys...)
+}
+
+// Decrypt decrypts ciphertext using AES-256-GCM, trying each key in turn
+func Decrypt(ciphertext string, keys ...[]byte) (string, error) {
 	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return "", err
 	}
 
+	for _, key := range keys {
+		if plaintext, err := decryptWith(data, key); err == nil {
+			return plaintext, nil
+		}
+	}
+	return "", ErrUndecryptable
+}
+
+// decryptWith opens base64-decoded AES-256-GCM data with one key
+func decryptWith(data, key []byte) (string, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
@@ -1,32 +1,72 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
+	"stockmarket/internal/apperr"
+	"stockmarket/internal/config"
 	"stockmarket/internal/models"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// ErrConfigConflict is returned by UpdateConfig when the config was changed since it was read
+var ErrConfigConflict = apperr.New(apperr.Conflict, "config was modified by another update")
+
+// ErrProfileNotFound is returned for a config profile that doesn't exist
+var ErrProfileNotFound = apperr.New(apperr.NotFound, "profile not found")
+
+// ErrProfileExists is returned by CreateProfile when the name is already taken
+var ErrProfileExists = apperr.New(apperr.Conflict, "a profile with that name already exists")
+
+// DefaultProfileName names the profile created on first run, which requests without a
+// profile use
+const DefaultProfileName = "default"
+
 // DB wraps the database connection
 type DB struct {
 	conn *sql.DB
+	// writer is a single connection every write goes through, so the app's own writes
+	// queue up instead of failing with "database is locked"
+	writer *sql.DB
+	// ctx is cancelled by Close, ending write retries still waiting for the lock
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Config cache with TTL, by profile ID (0 is the default profile)
+	configCache   map[int64]cachedConfig
+	configCacheMu sync.RWMutex
+}
 
-	// Config cache with TTL
-	configCache     *models.UserConfig
-	configCacheTime time.Time
-	configCacheMu   sync.RWMutex
+type cachedConfig struct {
+	config   *models.UserConfig
+	cachedAt time.Time
 }
 
 // configCacheTTL is how long to cache config before refreshing
 const configCacheTTL = 5 * time.Second
 
+// dsnOptions enable WAL, so reads don't block on the writer, foreign keys, and a busy
+// timeout for locks held by other processes
+const dsnOptions = "?_journal_mode=WAL&_foreign_keys=on&_busy_timeout=5000"
+
+// lockRetries and lockRetryDelay bound how often a write that still found the database
+// locked after the busy timeout is retried; the delay grows with each attempt
+const (
+	lockRetries    = 3
+	lockRetryDelay = 100 * time.Millisecond
+)
+
 // New creates a new database connection and initializes schema
 func New(path string) (*DB, error) {
-	conn, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_foreign_keys=on&_busy_timeout=5000")
+	conn, err := sql.Open("sqlite3", path+dsnOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -44,155 +84,155 @@ func New(path string) (*DB, error) {
 		return nil, err
 	}
 
-	db := &DB{conn: conn}
-	if err := db.migrate(); err != nil {
+	// SQLite allows one writer at a time; a single pooled connection serializes ours
+	writer, err := sql.Open("sqlite3", path+dsnOptions)
+	if err != nil {
 		conn.Close()
 		return nil, err
 	}
+	writer.SetMaxOpenConns(1)
+	writer.SetMaxIdleConns(1)
+	writer.SetConnMaxLifetime(0)
+
+	db := &DB{conn: conn, writer: writer, configCache: make(map[int64]cachedConfig)}
+	db.ctx, db.cancel = context.WithCancel(context.Background())
+	if err := db.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	return db, nil
 }
 
-// Close closes the database connection
-func (db *DB) Close() error {
-	return db.conn.Close()
-}
-
-// migrate runs database migrations
-func (db *DB) migrate() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS user_config (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		market_data_provider TEXT DEFAULT 'alphavantage',
-		market_data_api_key TEXT DEFAULT '',
-		ai_provider TEXT DEFAULT 'openai',
-		ai_provider_api_key TEXT DEFAULT '',
-		ai_model TEXT DEFAULT 'gpt-4o',
-		risk_tolerance TEXT DEFAULT 'moderate',
-		trade_frequency TEXT DEFAULT 'weekly',
-		tracked_symbols TEXT DEFAULT '[]',
-		polling_interval INTEGER DEFAULT 30,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS notification_channels (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		config_id INTEGER NOT NULL,
-		type TEXT NOT NULL,
-		target TEXT NOT NULL,
-		enabled INTEGER DEFAULT 1,
-		events TEXT DEFAULT '[]',
-		FOREIGN KEY (config_id) REFERENCES user_config(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS analysis_results (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		symbol TEXT NOT NULL,
-		action TEXT NOT NULL,
-		confidence REAL NOT NULL,
-		reasoning TEXT NOT NULL,
-		price_targets TEXT NOT NULL,
-		risks TEXT NOT NULL,
-		timeframe TEXT NOT NULL,
-		generated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS price_alerts (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		symbol TEXT NOT NULL,
-		condition TEXT NOT NULL,
-		price REAL NOT NULL,
-		triggered INTEGER DEFAULT 0,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS notifications (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		type TEXT NOT NULL,
-		title TEXT NOT NULL,
-		message TEXT NOT NULL,
-		symbol TEXT NOT NULL,
-		channels TEXT NOT NULL,
-		sent_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_analysis_symbol ON analysis_results(symbol);
-	CREATE INDEX IF NOT EXISTS idx_analysis_generated ON analysis_results(generated_at);
-	CREATE INDEX IF NOT EXISTS idx_alerts_symbol ON price_alerts(symbol);
-	`
-
-	_, err := db.conn.Exec(schema)
-	if err != nil {
-		return err
+// isLocked reports whether err is SQLite's "database is locked" or "table is locked"
+func isLocked(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// execRetry runs a write on the writer connection, retrying while the database is locked
+// so a busy moment doesn't lose the write. Closing the database stops the retries.
+func (db *DB) execRetry(query string, args ...interface{}) (sql.Result, error) {
+	result, err := db.writer.ExecContext(db.ctx, query, args...)
+	for attempt := 1; attempt <= lockRetries && isLocked(err); attempt++ {
+		timer := time.NewTimer(time.Duration(attempt) * lockRetryDelay)
+		select {
+		case <-db.ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+		result, err = db.writer.ExecContext(db.ctx, query, args...)
 	}
+	return result, err
+}
 
-	// Run column migrations (ignore errors for existing columns)
-	db.conn.Exec(`ALTER TABLE user_config ADD COLUMN polling_interval INTEGER DEFAULT 30`)
+// Ping checks the database answers a trivial query
+func (db *DB) Ping(ctx context.Context) error {
+	var one int
+	return db.conn.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
 
-	return nil
+// Close stops pending write retries and closes the database connections
+func (db *DB) Close() error {
+	db.cancel()
+	return errors.Join(db.writer.Close(), db.conn.Close())
 }
 
-// GetOrCreateConfig gets the user config or creates a default one (with caching)
+// GetOrCreateConfig gets the default profile's config, creating it on first run (with caching)
 func (db *DB) GetOrCreateConfig() (*models.UserConfig, error) {
+	return db.GetProfileConfig(0)
+}
+
+// GetProfileConfig gets a profile's config (with caching). Profile 0 is the default
+// profile, created on first run; other unknown IDs return ErrProfileNotFound.
+func (db *DB) GetProfileConfig(profileID int64) (*models.UserConfig, error) {
 	// Check cache first
 	db.configCacheMu.RLock()
-	if db.configCache != nil && time.Since(db.configCacheTime) < configCacheTTL {
-		// Return a copy to prevent mutation
-		cached := *db.configCache
-		cached.TrackedSymbols = append([]string{}, db.configCache.TrackedSymbols...)
-		cached.NotificationChannels = append([]models.NotificationConfig{}, db.configCache.NotificationChannels...)
+	if entry, ok := db.configCache[profileID]; ok && time.Since(entry.cachedAt) < configCacheTTL {
 		db.configCacheMu.RUnlock()
-		return &cached, nil
+		// Return a copy to prevent mutation
+		return copyConfig(entry.config), nil
 	}
 	db.configCacheMu.RUnlock()
 
 	// Cache miss - fetch from DB
-	config, err := db.fetchConfigFromDB()
+	config, err := db.fetchConfigFromDB(profileID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Update cache
 	db.configCacheMu.Lock()
-	db.configCache = config
-	db.configCacheTime = time.Now()
+	db.configCache[profileID] = cachedConfig{config: config, cachedAt: time.Now()}
 	db.configCacheMu.Unlock()
 
-	// Return a copy
+	return copyConfig(config), nil
+}
+
+// copyConfig returns a copy of a config whose slices and maps can be mutated freely
+func copyConfig(config *models.UserConfig) *models.UserConfig {
 	result := *config
 	result.TrackedSymbols = append([]string{}, config.TrackedSymbols...)
 	result.NotificationChannels = append([]models.NotificationConfig{}, config.NotificationChannels...)
-	return &result, nil
+	result.SymbolAliases = copyAliases(config.SymbolAliases)
+	result.WatchlistGroups = make([]models.WatchlistGroup, len(config.WatchlistGroups))
+	for i, group := range config.WatchlistGroups {
+		result.WatchlistGroups[i] = models.WatchlistGroup{Name: group.Name, Symbols: append([]string{}, group.Symbols...)}
+	}
+	result.NotifyOnActions = append([]string{}, config.NotifyOnActions...)
+	return &result
+}
+
+// copyAliases returns a copy of an alias map so cached config can't be mutated
+func copyAliases(aliases map[string]string) map[string]string {
+	result := make(map[string]string, len(aliases))
+	for k, v := range aliases {
+		result[k] = v
+	}
+	return result
 }
 
-// fetchConfigFromDB retrieves config directly from database
-func (db *DB) fetchConfigFromDB() (*models.UserConfig, error) {
+// fetchConfigFromDB retrieves a profile's config directly from database; profile 0 is
+// the default profile, the oldest one
+func (db *DB) fetchConfigFromDB(profileID int64) (*models.UserConfig, error) {
 	var config models.UserConfig
-	var trackedSymbolsJSON string
+	var trackedSymbolsJSON, symbolAliasesJSON, watchlistGroupsJSON, notifyOnActionsJSON string
 
+	where := `WHERE id = ?`
+	args := []interface{}{profileID}
+	if profileID == 0 {
+		where = `ORDER BY id LIMIT 1`
+		args = nil
+	}
 	err := db.conn.QueryRow(`
-		SELECT id, market_data_provider, market_data_api_key, ai_provider,
-		       ai_provider_api_key, ai_model, risk_tolerance, trade_frequency,
-		       tracked_symbols, COALESCE(polling_interval, 30), created_at, updated_at
-		FROM user_config LIMIT 1
-	`).Scan(
-		&config.ID, &config.MarketDataProvider, &config.MarketDataAPIKey,
+		SELECT id, COALESCE(name, ''), market_data_provider, market_data_api_key, COALESCE(market_data_provider_fallback, ''),
+		       ai_provider, ai_provider_api_key, ai_model, risk_tolerance, trade_frequency,
+		       tracked_symbols, COALESCE(polling_interval, 30), COALESCE(symbol_aliases, '{}'),
+		       COALESCE(watchlist_groups, '[]'), COALESCE(notify_min_confidence, 0.7), COALESCE(notify_on_actions, '["BUY","SELL"]'),
+		       COALESCE(notify_on_hold, 0), COALESCE(include_extended_hours, 0), COALESCE(version, 1), created_at, updated_at
+		FROM user_config `+where, args...).Scan(
+		&config.ID, &config.Name, &config.MarketDataProvider, &config.MarketDataAPIKey, &config.MarketDataFallback,
 		&config.AIProvider, &config.AIProviderAPIKey, &config.AIModel,
 		&config.RiskTolerance, &config.TradeFrequency, &trackedSymbolsJSON,
-		&config.PollingInterval, &config.CreatedAt, &config.UpdatedAt,
+		&config.PollingInterval, &symbolAliasesJSON, &watchlistGroupsJSON, &config.NotifyMinConfidence, &notifyOnActionsJSON,
+		&config.NotifyOnHold, &config.IncludeExtendedHours, &config.Version, &config.CreatedAt, &config.UpdatedAt,
 	)
 
+	if err == sql.ErrNoRows && profileID != 0 {
+		return nil, ErrProfileNotFound
+	}
 	if err == sql.ErrNoRows {
 		// Create default config
-		result, err := db.conn.Exec(`
-			INSERT INTO user_config (tracked_symbols, polling_interval) VALUES ('[]', 30)
-		`)
+		result, err := db.writer.Exec(`
+			INSERT INTO user_config (name, tracked_symbols, polling_interval) VALUES (?, '[]', 30)
+		`, DefaultProfileName)
 		if err != nil {
 			return nil, err
 		}
 		id, _ := result.LastInsertId()
 		config.ID = id
+		config.Name = DefaultProfileName
 		config.MarketDataProvider = "alphavantage"
 		config.AIProvider = "openai"
 		config.AIModel = "gpt-4o"
@@ -200,6 +240,11 @@ func (db *DB) fetchConfigFromDB() (*models.UserConfig, error) {
 		config.TradeFrequency = "weekly"
 		config.TrackedSymbols = []string{}
 		config.PollingInterval = 30
+		config.SymbolAliases = map[string]string{}
+		config.WatchlistGroups = []models.WatchlistGroup{}
+		config.NotifyMinConfidence = models.DefaultNotifyMinConfidence
+		config.NotifyOnActions = append([]string{}, models.DefaultNotifyOnActions...)
+		config.Version = 1
 		config.CreatedAt = time.Now()
 		config.UpdatedAt = time.Now()
 		return &config, nil
@@ -210,6 +255,9 @@ func (db *DB) fetchConfigFromDB() (*models.UserConfig, error) {
 
 	// Parse tracked symbols
 	json.Unmarshal([]byte(trackedSymbolsJSON), &config.TrackedSymbols)
+	json.Unmarshal([]byte(symbolAliasesJSON), &config.SymbolAliases)
+	json.Unmarshal([]byte(watchlistGroupsJSON), &config.WatchlistGroups)
+	json.Unmarshal([]byte(notifyOnActionsJSON), &config.NotifyOnActions)
 
 	// Default polling interval if not set
 	if config.PollingInterval == 0 {
@@ -226,14 +274,29 @@ func (db *DB) fetchConfigFromDB() (*models.UserConfig, error) {
 	return &config, nil
 }
 
-// UpdateConfig updates the user configuration
+// UpdateConfig updates the user configuration. The update only applies if config.Version
+// still matches the stored version, otherwise ErrConfigConflict is returned; on success
+// config.Version is advanced to the new version.
 func (db *DB) UpdateConfig(config *models.UserConfig) error {
 	trackedSymbolsJSON, _ := json.Marshal(config.TrackedSymbols)
+	symbolAliasesJSON, _ := json.Marshal(config.SymbolAliases)
+	if config.SymbolAliases == nil {
+		symbolAliasesJSON = []byte("{}")
+	}
+	watchlistGroupsJSON, _ := json.Marshal(config.WatchlistGroups)
+	if config.WatchlistGroups == nil {
+		watchlistGroupsJSON = []byte("[]")
+	}
+	notifyOnActionsJSON, _ := json.Marshal(config.NotifyOnActions)
+	if config.NotifyOnActions == nil {
+		notifyOnActionsJSON = []byte("[]")
+	}
 
-	_, err := db.conn.Exec(`
+	result, err := db.execRetry(`
 		UPDATE user_config SET
 			market_data_provider = ?,
 			market_data_api_key = ?,
+			market_data_provider_fallback = ?,
 			ai_provider = ?,
 			ai_provider_api_key = ?,
 			ai_model = ?,
@@ -241,34 +304,326 @@ func (db *DB) UpdateConfig(config *models.UserConfig) error {
 			trade_frequency = ?,
 			tracked_symbols = ?,
 			polling_interval = ?,
+			symbol_aliases = ?,
+			watchlist_groups = ?,
+			notify_min_confidence = ?,
+			notify_on_actions = ?,
+			notify_on_hold = ?,
+			include_extended_hours = ?,
+			version = COALESCE(version, 1) + 1,
 			updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
+		WHERE id = ? AND COALESCE(version, 1) = ?
 	`,
-		config.MarketDataProvider, config.MarketDataAPIKey,
+		config.MarketDataProvider, config.MarketDataAPIKey, config.MarketDataFallback,
 		config.AIProvider, config.AIProviderAPIKey, config.AIModel,
 		config.RiskTolerance, config.TradeFrequency, string(trackedSymbolsJSON),
-		config.PollingInterval, config.ID,
+		config.PollingInterval, string(symbolAliasesJSON), string(watchlistGroupsJSON), config.NotifyMinConfidence,
+		string(notifyOnActionsJSON), config.NotifyOnHold, config.IncludeExtendedHours, config.ID, config.Version,
 	)
-
-	// Invalidate cache on update
-	if err == nil {
-		db.InvalidateConfigCache()
+	if err != nil {
+		return err
 	}
 
-	return err
+	// Invalidate cache on any outcome so a conflicting caller re-reads the current version
+	db.InvalidateConfigCache()
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrConfigConflict
+	}
+	config.Version++
+	return nil
 }
 
 // InvalidateConfigCache clears the config cache
 func (db *DB) InvalidateConfigCache() {
 	db.configCacheMu.Lock()
-	db.configCache = nil
+	clear(db.configCache)
 	db.configCacheMu.Unlock()
 }
 
+// ListProfiles lists the config profiles, oldest (the default) first
+func (db *DB) ListProfiles() ([]models.Profile, error) {
+	// Make sure the default profile exists on a fresh database
+	if _, err := db.GetOrCreateConfig(); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(`SELECT id, COALESCE(name, ''), created_at FROM user_config ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []models.Profile
+	for rows.Next() {
+		var p models.Profile
+		if err := rows.Scan(&p.ID, &p.Name, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// AnyExtendedHours reports whether any profile has include_extended_hours set
+func (db *DB) AnyExtendedHours() (bool, error) {
+	var found bool
+	err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_config WHERE include_extended_hours = 1)`).Scan(&found)
+	return found, err
+}
+
+// CreateProfile creates a profile with default settings, except the market data and
+// AI providers and their keys, which are copied from template so a new household
+// member doesn't have to enter them again
+func (db *DB) CreateProfile(name string, template *models.UserConfig) (*models.Profile, error) {
+	var exists bool
+	if err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_config WHERE name = ?)`, name).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrProfileExists
+	}
+
+	result, err := db.writer.Exec(`
+		INSERT INTO user_config (name, market_data_provider, market_data_api_key, market_data_provider_fallback,
+			ai_provider, ai_provider_api_key, ai_model, tracked_symbols, polling_interval)
+		VALUES (?, ?, ?, ?, ?, ?, ?, '[]', 30)
+	`, name, template.MarketDataProvider, template.MarketDataAPIKey, template.MarketDataFallback,
+		template.AIProvider, template.AIProviderAPIKey, template.AIModel)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return &models.Profile{ID: id, Name: name, CreatedAt: time.Now()}, nil
+}
+
+// ImportBackup stores a profile's imported settings, alerts and notification channels in
+// one transaction. With replace set the profile's existing alerts are soft-deleted and
+// its channels deleted first. Like UpdateConfig it fails with ErrConfigConflict when config.Version
+// no longer matches, and advances config.Version on success.
+func (db *DB) ImportBackup(config *models.UserConfig, alerts []models.PriceAlert, channels []models.NotificationConfig, replace bool) error {
+	trackedSymbolsJSON, _ := json.Marshal(config.TrackedSymbols)
+	symbolAliasesJSON, _ := json.Marshal(config.SymbolAliases)
+	if config.SymbolAliases == nil {
+		symbolAliasesJSON = []byte("{}")
+	}
+	watchlistGroupsJSON, _ := json.Marshal(config.WatchlistGroups)
+	if config.WatchlistGroups == nil {
+		watchlistGroupsJSON = []byte("[]")
+	}
+	notifyOnActionsJSON, _ := json.Marshal(config.NotifyOnActions)
+	if config.NotifyOnActions == nil {
+		notifyOnActionsJSON = []byte("[]")
+	}
+
+	tx, err := db.writer.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Invalidate on any outcome, as UpdateConfig does
+	defer db.InvalidateConfigCache()
+
+	result, err := tx.Exec(`
+		UPDATE user_config SET
+			market_data_provider = ?, market_data_api_key = ?, market_data_provider_fallback = ?,
+			ai_provider = ?, ai_provider_api_key = ?, ai_model = ?,
+			risk_tolerance = ?, trade_frequency = ?, tracked_symbols = ?, polling_interval = ?,
+			symbol_aliases = ?, watchlist_groups = ?, notify_min_confidence = ?, notify_on_actions = ?, notify_on_hold = ?,
+			include_extended_hours = ?, version = COALESCE(version, 1) + 1,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND COALESCE(version, 1) = ?
+	`,
+		config.MarketDataProvider, config.MarketDataAPIKey, config.MarketDataFallback,
+		config.AIProvider, config.AIProviderAPIKey, config.AIModel,
+		config.RiskTolerance, config.TradeFrequency, string(trackedSymbolsJSON), config.PollingInterval,
+		string(symbolAliasesJSON), string(watchlistGroupsJSON), config.NotifyMinConfidence, string(notifyOnActionsJSON), config.NotifyOnHold,
+		config.IncludeExtendedHours, config.ID, config.Version,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrConfigConflict
+	}
+
+	if replace {
+		// Replaced alerts are soft-deleted, so they can still be restored
+		if _, err := tx.Exec(`UPDATE price_alerts SET deleted_at = ? WHERE profile_id = ? AND deleted_at IS NULL`,
+			time.Now().UTC(), config.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM notification_channels WHERE config_id = ?`, config.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range alerts {
+		if _, err := tx.Exec(`
+			INSERT INTO price_alerts (profile_id, symbol, condition, price, reference_price, percent, volume_multiple, cooldown_seconds, rearm,
+				recurring, expires_at, muted_until, bypass_quiet_hours)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, config.ID, a.Symbol, a.Condition, a.Price, a.ReferencePrice, a.Percent, a.VolumeMultiple,
+			a.CooldownSeconds, a.Rearm, a.Recurring, nullableTime(a.ExpiresAt), nullableTime(a.MutedUntil), a.BypassQuietHours); err != nil {
+			return err
+		}
+	}
+
+	for _, ch := range channels {
+		eventsJSON, _ := json.Marshal(ch.Events)
+		if _, err := tx.Exec(`
+			INSERT INTO notification_channels (config_id, type, target, enabled, events, symbols, webhook, telegram)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, config.ID, ch.Type, ch.Target, ch.Enabled, string(eventsJSON), optionalJSON(ch.Symbols), optionalJSON(ch.Webhook), optionalJSON(ch.Telegram)); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	config.Version++
+	return nil
+}
+
+// RewrapSecrets re-encrypts every profile's stored API keys and Telegram bot tokens
+// under newKey in one transaction, decrypting each with newKey or any of oldKeys. It
+// returns how many secrets were rewrapped; if any can't be decrypted nothing is changed
+// and the error names the profile and column, or the channel. Bot tokens stored in
+// plaintext, from before they were encrypted, are encrypted.
+func (db *DB) RewrapSecrets(oldKeys [][]byte, newKey []byte) (int, error) {
+	tx, err := db.writer.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	defer db.InvalidateConfigCache()
+
+	rows, err := tx.Query(`SELECT id, COALESCE(market_data_api_key, ''), COALESCE(ai_provider_api_key, '') FROM user_config`)
+	if err != nil {
+		return 0, err
+	}
+	type profileKeys struct {
+		id                         int64
+		marketDataAPIKey, aiAPIKey string
+	}
+	var profiles []profileKeys
+	for rows.Next() {
+		var p profileKeys
+		if err := rows.Scan(&p.id, &p.marketDataAPIKey, &p.aiAPIKey); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		profiles = append(profiles, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	keys := append([][]byte{newKey}, oldKeys...)
+	rewrap := func(profileID int64, column, encrypted string) (string, error) {
+		if encrypted == "" {
+			return "", nil
+		}
+		plaintext, err := config.Decrypt(encrypted, keys...)
+		if err != nil {
+			return "", fmt.Errorf("profile %d %s: %w", profileID, column, err)
+		}
+		return config.Encrypt(plaintext, newKey)
+	}
+
+	rewrapped := 0
+	for _, p := range profiles {
+		marketDataAPIKey, err := rewrap(p.id, "market_data_api_key", p.marketDataAPIKey)
+		if err != nil {
+			return 0, err
+		}
+		aiAPIKey, err := rewrap(p.id, "ai_provider_api_key", p.aiAPIKey)
+		if err != nil {
+			return 0, err
+		}
+		if marketDataAPIKey == "" && aiAPIKey == "" {
+			continue
+		}
+		// Bump the version so a PUT /api/config based on the old blobs fails with a conflict
+		if _, err := tx.Exec(`
+			UPDATE user_config SET market_data_api_key = ?, ai_provider_api_key = ?,
+				version = COALESCE(version, 1) + 1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, marketDataAPIKey, aiAPIKey, p.id); err != nil {
+			return 0, err
+		}
+		for _, key := range []string{marketDataAPIKey, aiAPIKey} {
+			if key != "" {
+				rewrapped++
+			}
+		}
+	}
+
+	rows, err = tx.Query(`SELECT id, telegram FROM notification_channels WHERE COALESCE(telegram, '') != ''`)
+	if err != nil {
+		return 0, err
+	}
+	type channelToken struct {
+		id       int64
+		telegram models.TelegramConfig
+	}
+	var tokens []channelToken
+	for rows.Next() {
+		var c channelToken
+		var telegramJSON string
+		if err := rows.Scan(&c.id, &telegramJSON); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if json.Unmarshal([]byte(telegramJSON), &c.telegram) == nil && c.telegram.BotToken != "" {
+			tokens = append(tokens, c)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, c := range tokens {
+		plaintext := c.telegram.BotToken
+		if !PlaintextBotToken(plaintext) {
+			if plaintext, err = config.Decrypt(plaintext, keys...); err != nil {
+				return 0, fmt.Errorf("notification channel %d bot token: %w", c.id, err)
+			}
+		}
+		if c.telegram.BotToken, err = config.Encrypt(plaintext, newKey); err != nil {
+			return 0, err
+		}
+		telegramJSON, _ := json.Marshal(c.telegram)
+		if _, err := tx.Exec(`UPDATE notification_channels SET telegram = ? WHERE id = ?`, string(telegramJSON), c.id); err != nil {
+			return 0, err
+		}
+		rewrapped++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return rewrapped, nil
+}
+
+// PlaintextBotToken reports whether a stored Telegram bot token is unencrypted. Tokens
+// have a colon after the bot's ID, which base64 ciphertext never does; channels saved
+// before tokens were encrypted hold plaintext ones.
+func PlaintextBotToken(token string) bool {
+	return strings.Contains(token, ":")
+}
+
 // GetNotificationChannels gets all notification channels for a config
 func (db *DB) GetNotificationChannels(configID int64) ([]models.NotificationConfig, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, type, target, enabled, events FROM notification_channels WHERE config_id = ?
+		SELECT id, type, target, enabled, events, COALESCE(symbols, ''), webhook, COALESCE(telegram, '') FROM notification_channels WHERE config_id = ?
 	`, configID)
 	if err != nil {
 		return nil, err
@@ -279,20 +634,31 @@ func (db *DB) GetNotificationChannels(configID int64) ([]models.NotificationConf
 	for rows.Next() {
 		var ch models.NotificationConfig
 		var enabled int
-		var eventsJSON string
-		if err := rows.Scan(&ch.ID, &ch.Type, &ch.Target, &enabled, &eventsJSON); err != nil {
+		var eventsJSON, symbolsJSON, webhookJSON, telegramJSON string
+		if err := rows.Scan(&ch.ID, &ch.Type, &ch.Target, &enabled, &eventsJSON, &symbolsJSON, &webhookJSON, &telegramJSON); err != nil {
 			return nil, err
 		}
 		ch.Enabled = enabled == 1
 		json.Unmarshal([]byte(eventsJSON), &ch.Events)
+		if symbolsJSON != "" {
+			json.Unmarshal([]byte(symbolsJSON), &ch.Symbols)
+		}
+		if webhookJSON != "" {
+			json.Unmarshal([]byte(webhookJSON), &ch.Webhook)
+		}
+		if telegramJSON != "" {
+			json.Unmarshal([]byte(telegramJSON), &ch.Telegram)
+		}
 		channels = append(channels, ch)
 	}
 	return channels, nil
 }
 
-// SaveNotificationChannel saves a notification channel
+// SaveNotificationChannel saves a notification channel. Updating returns sql.ErrNoRows
+// when the channel isn't one of configID's.
 func (db *DB) SaveNotificationChannel(configID int64, ch *models.NotificationConfig) error {
 	eventsJSON, _ := json.Marshal(ch.Events)
+	symbolsJSON, webhookJSON, telegramJSON := optionalJSON(ch.Symbols), optionalJSON(ch.Webhook), optionalJSON(ch.Telegram)
 	enabled := 0
 	if ch.Enabled {
 		enabled = 1
@@ -301,19 +667,19 @@ func (db *DB) SaveNotificationChannel(configID int64, ch *models.NotificationCon
 	var err error
 	if ch.ID == 0 {
 		var result sql.Result
-		result, err = db.conn.Exec(`
-			INSERT INTO notification_channels (config_id, type, target, enabled, events)
-			VALUES (?, ?, ?, ?, ?)
-		`, configID, ch.Type, ch.Target, enabled, string(eventsJSON))
+		result, err = db.writer.Exec(`
+			INSERT INTO notification_channels (config_id, type, target, enabled, events, symbols, webhook, telegram)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, configID, ch.Type, ch.Target, enabled, string(eventsJSON), symbolsJSON, webhookJSON, telegramJSON)
 		if err != nil {
 			return err
 		}
 		ch.ID, _ = result.LastInsertId()
 	} else {
-		_, err = db.conn.Exec(`
-			UPDATE notification_channels SET type = ?, target = ?, enabled = ?, events = ?
-			WHERE id = ?
-		`, ch.Type, ch.Target, enabled, string(eventsJSON), ch.ID)
+		err = expectRow(db.writer.Exec(`
+			UPDATE notification_channels SET type = ?, target = ?, enabled = ?, events = ?, symbols = ?, webhook = ?, telegram = ?
+			WHERE id = ? AND config_id = ?
+		`, ch.Type, ch.Target, enabled, string(eventsJSON), symbolsJSON, webhookJSON, telegramJSON, ch.ID, configID))
 	}
 
 	// Invalidate config cache since notification channels are part of config
@@ -324,9 +690,13 @@ func (db *DB) SaveNotificationChannel(configID int64, ch *models.NotificationCon
 	return err
 }
 
-// DeleteNotificationChannel deletes a notification channel
-func (db *DB) DeleteNotificationChannel(id int64) error {
-	_, err := db.conn.Exec(`DELETE FROM notification_channels WHERE id = ?`, id)
+// DeleteNotificationChannel deletes one of a profile's notification channels,
+// returning sql.ErrNoRows when it has no such channel
+func (db *DB) DeleteNotificationChannel(id, configID int64) error {
+	err := expectRow(db.writer.Exec(`DELETE FROM notification_channels WHERE id = ? AND config_id = ?`, id, configID))
+	if err == nil {
+		db.InvalidateConfigCache()
+	}
 	return err
 }
 
@@ -334,12 +704,31 @@ func (db *DB) DeleteNotificationChannel(id int64) error {
 func (db *DB) SaveAnalysis(analysis *models.AnalysisResponse) error {
 	priceTargetsJSON, _ := json.Marshal(analysis.PriceTargets)
 	risksJSON, _ := json.Marshal(analysis.Risks)
+	timeframesJSON, _ := json.Marshal(analysis.Timeframes)
+	if analysis.Timeframes == nil {
+		timeframesJSON = []byte("[]")
+	}
+	tagsJSON, _ := json.Marshal(analysis.Tags)
+	if analysis.Tags == nil {
+		tagsJSON = []byte("[]")
+	}
+	suggestionsJSON, _ := json.Marshal(analysis.SuggestedAlerts)
+	if analysis.SuggestedAlerts == nil {
+		suggestionsJSON = []byte("[]")
+	}
+	ensembleJSON, _ := json.Marshal(analysis.Ensemble)
+	if analysis.Ensemble == nil {
+		ensembleJSON = []byte("[]")
+	}
 
-	result, err := db.conn.Exec(`
-		INSERT INTO analysis_results (symbol, action, confidence, reasoning, price_targets, risks, timeframe)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+	result, err := db.execRetry(`
+		INSERT INTO analysis_results (symbol, action, confidence, reasoning, price_targets, risks, timeframe, timeframes, smoothed_confidence, raw_confidence, tags, position_context, suggested_alerts, beta, benchmark, detail_level,
+		                              prompt_tokens, completion_tokens, cost_usd, price, ensemble)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, analysis.Symbol, analysis.Action, analysis.Confidence, analysis.Reasoning,
-		string(priceTargetsJSON), string(risksJSON), analysis.Timeframe)
+		string(priceTargetsJSON), string(risksJSON), analysis.Timeframe, string(timeframesJSON), analysis.SmoothedConfidence, analysis.RawConfidence, string(tagsJSON), analysis.PositionContext, string(suggestionsJSON),
+		analysis.Beta, analysis.Benchmark, analysis.DetailLevel,
+		analysis.PromptTokens, analysis.CompletionTokens, analysis.CostUSD, analysis.Price, string(ensembleJSON))
 	if err != nil {
 		return err
 	}
@@ -347,125 +736,1187 @@ func (db *DB) SaveAnalysis(analysis *models.AnalysisResponse) error {
 	return nil
 }
 
-// GetRecentAnalyses gets recent analysis results
-func (db *DB) GetRecentAnalyses(limit int) ([]models.AnalysisResponse, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, symbol, action, confidence, reasoning, price_targets, risks, timeframe, generated_at
-		FROM analysis_results ORDER BY generated_at DESC LIMIT ?
-	`, limit)
+// notDeleted is the condition excluding soft-deleted rows
+const notDeleted = "deleted_at IS NULL"
+
+// GetRecentAnalyses gets recent analysis results, optionally only those carrying every given tag
+func (db *DB) GetRecentAnalyses(limit int, tags ...string) ([]models.AnalysisResponse, error) {
+	return db.queryAnalyses(notDeleted, nil, tags, "", limit)
+}
+
+// GetAnalysesSince gets analysis results generated at or after since, newest first
+func (db *DB) GetAnalysesSince(since time.Time, limit int) ([]models.AnalysisResponse, error) {
+	return db.queryAnalyses("generated_at >= ? AND "+notDeleted, []interface{}{since.UTC()}, nil, "", limit)
+}
+
+// GetAnalysesForSymbol gets analysis results for a specific symbol, optionally only
+// those carrying every given tag
+func (db *DB) GetAnalysesForSymbol(symbol string, limit int, tags ...string) ([]models.AnalysisResponse, error) {
+	return db.queryAnalyses("symbol = ? AND "+notDeleted, []interface{}{symbol}, tags, "", limit)
+}
+
+// AnalysisFilter narrows an analysis history query. Zero values don't filter; To is
+// exclusive.
+type AnalysisFilter struct {
+	Symbol        string
+	Action        string
+	MinConfidence float64
+	From          time.Time
+	To            time.Time
+	Tags          []string
+	Sort          string // a key of analysisSorts; empty sorts by created_at
+	Limit         int
+
+	IncludeDeleted bool // also match soft-deleted analyses
+}
+
+// analysisSorts maps the sort keys an AnalysisFilter accepts to ORDER BY clauses
+var analysisSorts = map[string]string{
+	"created_at": "generated_at DESC, id DESC",
+	"confidence": "confidence DESC, generated_at DESC",
+}
+
+// ValidAnalysisSort reports whether sort is an accepted AnalysisFilter.Sort
+func ValidAnalysisSort(sort string) bool {
+	_, ok := analysisSorts[sort]
+	return ok
+}
+
+// FilterAnalyses gets analysis results matching every set field of a filter
+func (db *DB) FilterAnalyses(f AnalysisFilter) ([]models.AnalysisResponse, error) {
+	where, args := f.where()
+	return db.queryAnalyses(where, args, f.Tags, analysisSorts[f.Sort], f.Limit)
+}
+
+// ExportFilteredAnalyses streams analysis results matching a filter in its sort order
+// without buffering them; a zero Limit exports every match
+func (db *DB) ExportFilteredAnalyses(f AnalysisFilter, fn func(models.AnalysisResponse) error) error {
+	where, args := f.where()
+	query, args := analysisQuery(where, args, f.Tags, analysisSorts[f.Sort])
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+	return db.eachAnalysis(query, args, fn)
+}
+
+// where builds the SQL condition and arguments for a filter's fields other than tags
+func (f AnalysisFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if !f.IncludeDeleted {
+		conds = append(conds, notDeleted)
+	}
+	if f.Symbol != "" {
+		conds = append(conds, "symbol = ?")
+		args = append(args, f.Symbol)
+	}
+	if f.Action != "" {
+		conds = append(conds, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.MinConfidence > 0 {
+		conds = append(conds, "confidence >= ?")
+		args = append(args, f.MinConfidence)
+	}
+	if !f.From.IsZero() {
+		conds = append(conds, "generated_at >= ?")
+		args = append(args, f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "generated_at < ?")
+		args = append(args, f.To.UTC())
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// queryAnalyses loads analysis results matching an optional WHERE condition and tags,
+// in the given order (newest first when empty)
+func (db *DB) queryAnalyses(where string, args []interface{}, tags []string, order string, limit int) ([]models.AnalysisResponse, error) {
+	query, args := analysisQuery(where, args, tags, order)
+	query += " LIMIT ?"
+	args = append(args, limit)
+
+	var results []models.AnalysisResponse
+	err := db.eachAnalysis(query, args, func(r models.AnalysisResponse) error {
+		results = append(results, r)
+		return nil
+	})
+	return results, err
+}
+
+// analysisQuery builds an analysisColumns query for an optional WHERE condition and
+// tags, in the given order (newest first when empty)
+func analysisQuery(where string, args []interface{}, tags []string, order string) (string, []interface{}) {
+	query := analysisColumns + ` WHERE 1=1`
+	if where != "" {
+		query += " AND " + where
+	}
+	for _, tag := range tags {
+		query += " AND EXISTS (SELECT 1 FROM json_each(analysis_results.tags) WHERE value = ?)"
+		args = append(args, tag)
+	}
+	if order == "" {
+		order = analysisSorts["created_at"]
+	}
+	return query + " ORDER BY " + order, args
+}
+
+// analysisColumns selects every analysis_results column scanned by eachAnalysis
+const analysisColumns = `SELECT id, symbol, action, confidence, reasoning, price_targets, risks, timeframe,
+		       COALESCE(timeframes, '[]'), smoothed_confidence, raw_confidence, COALESCE(tags, '[]'),
+		       COALESCE(position_context, 0), COALESCE(suggested_alerts, '[]'), beta, COALESCE(benchmark, ''),
+		       COALESCE(detail_level, 'standard'), COALESCE(prompt_tokens, 0), COALESCE(completion_tokens, 0),
+		       COALESCE(cost_usd, 0), COALESCE(price, 0), generated_at, deleted_at, COALESCE(ensemble, '[]')
+		FROM analysis_results`
+
+// eachAnalysis runs an analysisColumns query and calls fn for each row without
+// buffering the result set; an error from fn stops the iteration
+func (db *DB) eachAnalysis(query string, args []interface{}, fn func(models.AnalysisResponse) error) error {
+	rows, err := db.conn.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var results []models.AnalysisResponse
 	for rows.Next() {
 		var r models.AnalysisResponse
-		var priceTargetsJSON, risksJSON string
+		var priceTargetsJSON, risksJSON, timeframesJSON, tagsJSON, suggestionsJSON, ensembleJSON string
+		var deletedAt sql.NullTime
 		if err := rows.Scan(&r.ID, &r.Symbol, &r.Action, &r.Confidence, &r.Reasoning,
-			&priceTargetsJSON, &risksJSON, &r.Timeframe, &r.GeneratedAt); err != nil {
-			return nil, err
+			&priceTargetsJSON, &risksJSON, &r.Timeframe, &timeframesJSON, &r.SmoothedConfidence, &r.RawConfidence,
+			&tagsJSON, &r.PositionContext, &suggestionsJSON, &r.Beta, &r.Benchmark, &r.DetailLevel,
+			&r.PromptTokens, &r.CompletionTokens, &r.CostUSD, &r.Price, &r.GeneratedAt, &deletedAt, &ensembleJSON); err != nil {
+			return err
 		}
+		if deletedAt.Valid {
+			r.DeletedAt = &deletedAt.Time
+		}
+		json.Unmarshal([]byte(suggestionsJSON), &r.SuggestedAlerts)
 		json.Unmarshal([]byte(priceTargetsJSON), &r.PriceTargets)
 		json.Unmarshal([]byte(risksJSON), &r.Risks)
-		results = append(results, r)
+		json.Unmarshal([]byte(timeframesJSON), &r.Timeframes)
+		json.Unmarshal([]byte(tagsJSON), &r.Tags)
+		json.Unmarshal([]byte(ensembleJSON), &r.Ensemble)
+		if err := fn(r); err != nil {
+			return err
+		}
 	}
-	return results, nil
+	return rows.Err()
 }
 
-// GetAnalysesForSymbol gets analysis results for a specific symbol
-func (db *DB) GetAnalysesForSymbol(symbol string, limit int) ([]models.AnalysisResponse, error) {
+// GetAnalysisTimeline gets the action, confidence and price of a symbol's analyses,
+// oldest first, leaving out deleted ones
+func (db *DB) GetAnalysisTimeline(symbol string) ([]models.TimelinePoint, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, symbol, action, confidence, reasoning, price_targets, risks, timeframe, generated_at
-		FROM analysis_results WHERE symbol = ? ORDER BY generated_at DESC LIMIT ?
-	`, symbol, limit)
+		SELECT id, generated_at, action, confidence, COALESCE(price, 0)
+		FROM analysis_results
+		WHERE symbol = ? AND `+notDeleted+`
+		ORDER BY generated_at, id
+	`, symbol)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var results []models.AnalysisResponse
+	points := []models.TimelinePoint{}
 	for rows.Next() {
-		var r models.AnalysisResponse
-		var priceTargetsJSON, risksJSON string
-		if err := rows.Scan(&r.ID, &r.Symbol, &r.Action, &r.Confidence, &r.Reasoning,
-			&priceTargetsJSON, &risksJSON, &r.Timeframe, &r.GeneratedAt); err != nil {
+		var p models.TimelinePoint
+		if err := rows.Scan(&p.ID, &p.CreatedAt, &p.Action, &p.Confidence, &p.Price); err != nil {
 			return nil, err
 		}
-		json.Unmarshal([]byte(priceTargetsJSON), &r.PriceTargets)
-		json.Unmarshal([]byte(risksJSON), &r.Risks)
-		results = append(results, r)
+		points = append(points, p)
 	}
-	return results, nil
+	return points, rows.Err()
 }
 
-// SavePriceAlert saves a price alert
-func (db *DB) SavePriceAlert(alert *models.PriceAlert) error {
-	result, err := db.conn.Exec(`
-		INSERT INTO price_alerts (symbol, condition, price) VALUES (?, ?, ?)
-	`, alert.Symbol, alert.Condition, alert.Price)
+// GetAnalysisResponse gets a single analysis result, soft-deleted or not, returning
+// sql.ErrNoRows when missing
+func (db *DB) GetAnalysisResponse(id int64) (*models.AnalysisResponse, error) {
+	var found *models.AnalysisResponse
+	err := db.eachAnalysis(analysisColumns+` WHERE id = ?`, []interface{}{id}, func(r models.AnalysisResponse) error {
+		found = &r
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	alert.ID, _ = result.LastInsertId()
-	return nil
+	if found == nil {
+		return nil, sql.ErrNoRows
+	}
+	return found, nil
 }
 
-// GetActiveAlerts gets all untriggered price alerts
-func (db *DB) GetActiveAlerts() ([]models.PriceAlert, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, symbol, condition, price, triggered, created_at
-		FROM price_alerts WHERE triggered = 0
-	`)
+// PreviousAnalysis returns the live analysis of the same symbol saved just before
+// analysis id, or sql.ErrNoRows when there's none
+func (db *DB) PreviousAnalysis(id int64) (*models.AnalysisResponse, error) {
+	results, err := db.queryAnalyses(notDeleted+` AND EXISTS (SELECT 1 FROM analysis_results cur WHERE cur.id = ?
+		AND analysis_results.symbol = cur.symbol
+		AND (analysis_results.generated_at < cur.generated_at
+			OR (analysis_results.generated_at = cur.generated_at AND analysis_results.id < cur.id)))`,
+		[]interface{}{id}, nil, "", 1)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var alerts []models.PriceAlert
-	for rows.Next() {
-		var a models.PriceAlert
-		var triggered int
-		if err := rows.Scan(&a.ID, &a.Symbol, &a.Condition, &a.Price, &triggered, &a.CreatedAt); err != nil {
-			return nil, err
-		}
-		a.Triggered = triggered == 1
-		alerts = append(alerts, a)
+	if len(results) == 0 {
+		return nil, sql.ErrNoRows
 	}
-	return alerts, nil
+	return &results[0], nil
 }
 
-// TriggerAlert marks an alert as triggered
-func (db *DB) TriggerAlert(id int64) error {
-	_, err := db.conn.Exec(`UPDATE price_alerts SET triggered = 1 WHERE id = ?`, id)
-	return err
+// DeleteAnalysis soft-deletes an analysis result, returning sql.ErrNoRows when it's
+// missing or already deleted
+func (db *DB) DeleteAnalysis(id int64) error {
+	return expectRow(db.writer.Exec(`UPDATE analysis_results SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, time.Now().UTC(), id))
 }
 
-// DeletePriceAlert deletes a price alert
-func (db *DB) DeletePriceAlert(id int64) error {
-	_, err := db.conn.Exec(`DELETE FROM price_alerts WHERE id = ?`, id)
-	return err
+// RestoreAnalysis undoes DeleteAnalysis, returning sql.ErrNoRows when the analysis
+// isn't soft-deleted
+func (db *DB) RestoreAnalysis(id int64) error {
+	return expectRow(db.writer.Exec(`UPDATE analysis_results SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`, id))
 }
 
-// SaveNotification saves a notification record
-func (db *DB) SaveNotification(n *models.Notification) error {
-	channelsJSON, _ := json.Marshal(n.Channels)
-	result, err := db.conn.Exec(`
-		INSERT INTO notifications (type, title, message, symbol, channels) VALUES (?, ?, ?, ?, ?)
-	`, n.Type, n.Title, n.Message, n.Symbol, string(channelsJSON))
+// PurgeDeleted hard-deletes alerts, with their trigger history, and analyses
+// soft-deleted before the given time, returning how many alerts and analyses
+func (db *DB) PurgeDeleted(before time.Time) (alerts, analyses int64, err error) {
+	result, err := db.writer.Exec(`DELETE FROM price_alerts WHERE deleted_at < ?`, before.UTC())
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
-	n.ID, _ = result.LastInsertId()
-	return nil
+	alerts, _ = result.RowsAffected()
+	if alerts > 0 {
+		if _, err := db.writer.Exec(`DELETE FROM alert_triggers WHERE alert_id NOT IN (SELECT id FROM price_alerts)`); err != nil {
+			return alerts, 0, err
+		}
+	}
+	result, err = db.writer.Exec(`DELETE FROM analysis_results WHERE deleted_at < ?`, before.UTC())
+	if err != nil {
+		return alerts, 0, err
+	}
+	analyses, _ = result.RowsAffected()
+	return alerts, analyses, nil
+}
+
+// KeepTag marks an analysis that data retention never prunes
+const KeepTag = "keep"
+
+// pruneBatchSize bounds the rows one retention delete removes, so other writers get the
+// database between batches
+const pruneBatchSize = 500
+
+// prunableAnalyses selects a batch of analyses older than a cutoff, except those tagged
+// KeepTag and those of symbols with an open position
+const prunableAnalyses = `
+	SELECT id FROM analysis_results
+	WHERE generated_at < ?
+	AND NOT EXISTS (SELECT 1 FROM positions WHERE positions.symbol = analysis_results.symbol AND positions.quantity != 0)
+	AND NOT EXISTS (SELECT 1 FROM json_each(analysis_results.tags) WHERE value = '` + KeepTag + `')
+	LIMIT ?`
+
+// PruneResult counts the rows a retention prune removed
+type PruneResult struct {
+	Analyses        int64 `json:"analyses"`
+	QuoteSnapshots  int64 `json:"quote_snapshots"`
+	HistoricalCache int64 `json:"historical_cache"`
+}
+
+// PruneBefore deletes analyses (with their debug records), quote snapshots and cached
+// history fetched before before, in batches of pruneBatchSize. Analyses tagged KeepTag
+// or of a symbol with an open position are kept.
+func (db *DB) PruneBefore(before time.Time) (PruneResult, error) {
+	var result PruneResult
+	for {
+		n, err := db.pruneAnalysisBatch(before.UTC())
+		result.Analyses += n
+		if err != nil {
+			return result, err
+		}
+		if n < pruneBatchSize {
+			break
+		}
+	}
+	for {
+		res, err := db.writer.Exec(`
+			DELETE FROM quote_snapshots WHERE id IN (SELECT id FROM quote_snapshots WHERE quoted_at < ? LIMIT ?)
+		`, before.UTC(), pruneBatchSize)
+		if err != nil {
+			return result, err
+		}
+		n, _ := res.RowsAffected()
+		result.QuoteSnapshots += n
+		if n < pruneBatchSize {
+			break
+		}
+	}
+	for {
+		res, err := db.writer.Exec(`
+			DELETE FROM historical_cache WHERE rowid IN (SELECT rowid FROM historical_cache WHERE fetched_at < ? LIMIT ?)
+		`, before.UTC(), pruneBatchSize)
+		if err != nil {
+			return result, err
+		}
+		n, _ := res.RowsAffected()
+		result.HistoricalCache += n
+		if n < pruneBatchSize {
+			return result, nil
+		}
+	}
+}
+
+// pruneAnalysisBatch deletes one batch of prunable analyses and their debug records
+func (db *DB) pruneAnalysisBatch(before time.Time) (int64, error) {
+	tx, err := db.writer.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM analysis_debug WHERE analysis_id IN (`+prunableAnalyses+`)`, before, pruneBatchSize); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`DELETE FROM analysis_results WHERE id IN (`+prunableAnalyses+`)`, before, pruneBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return n, tx.Commit()
+}
+
+// expectRow turns an update that changed no rows into sql.ErrNoRows
+func expectRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SaveAnalysisDebug stores the prompt and raw reply behind an analysis
+func (db *DB) SaveAnalysisDebug(debug *models.AnalysisDebug) error {
+	_, err := db.writer.Exec(`
+		INSERT OR REPLACE INTO analysis_debug (analysis_id, prompt, raw_response) VALUES (?, ?, ?)
+	`, debug.AnalysisID, debug.Prompt, debug.RawResponse)
+	return err
+}
+
+// GetAnalysisDebug gets the prompt and raw reply behind an analysis, returning
+// sql.ErrNoRows when none was stored
+func (db *DB) GetAnalysisDebug(analysisID int64) (*models.AnalysisDebug, error) {
+	var debug models.AnalysisDebug
+	err := db.conn.QueryRow(`
+		SELECT analysis_id, prompt, raw_response, created_at FROM analysis_debug WHERE analysis_id = ?
+	`, analysisID).Scan(&debug.AnalysisID, &debug.Prompt, &debug.RawResponse, &debug.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &debug, nil
+}
+
+// ExportAnalyses streams analyses generated in [from, to) oldest first, including
+// soft-deleted ones (with deleted_at set) so the export stays a complete audit trail
+func (db *DB) ExportAnalyses(from, to time.Time, fn func(models.AnalysisResponse) error) error {
+	return db.eachAnalysis(analysisColumns+` WHERE generated_at >= ? AND generated_at < ? ORDER BY generated_at`,
+		[]interface{}{from.UTC(), to.UTC()}, fn)
+}
+
+// SaveQuoteSnapshot records a point-in-time quote
+func (db *DB) SaveQuoteSnapshot(q *models.Quote) error {
+	_, err := db.writer.Exec(`
+		INSERT INTO quote_snapshots (symbol, price, change_percent, volume, quoted_at) VALUES (?, ?, ?, ?, ?)
+	`, q.Symbol, q.Price, q.ChangePercent, q.Volume, q.Timestamp.UTC())
+	return err
+}
+
+// SaveAIUsage records one AI completion's token usage
+func (db *DB) SaveAIUsage(u models.AIUsage) error {
+	_, err := db.writer.Exec(`
+		INSERT INTO ai_usage (provider, model, input_tokens, output_tokens, cost, created_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, u.Provider, u.Model, u.InputTokens, u.OutputTokens, u.Cost, u.CreatedAt.UTC())
+	return err
+}
+
+// GetAIUsageBetween totals AI usage per provider and model in [from, to)
+func (db *DB) GetAIUsageBetween(from, to time.Time) ([]models.AIUsage, error) {
+	rows, err := db.conn.Query(`
+		SELECT provider, model, SUM(input_tokens), SUM(output_tokens), SUM(cost)
+		FROM ai_usage WHERE created_at >= ? AND created_at < ?
+		GROUP BY provider, model ORDER BY SUM(cost) DESC
+	`, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []models.AIUsage
+	for rows.Next() {
+		var u models.AIUsage
+		if err := rows.Scan(&u.Provider, &u.Model, &u.InputTokens, &u.OutputTokens, &u.Cost); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// GetAnalysisUsage totals the token usage and cost of analyses generated in [from, to)
+func (db *DB) GetAnalysisUsage(from, to time.Time) (models.AnalysisUsageTotals, error) {
+	var totals models.AnalysisUsageTotals
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost_usd), 0)
+		FROM analysis_results WHERE generated_at >= ? AND generated_at < ?
+	`, from.UTC(), to.UTC()).Scan(&totals.Analyses, &totals.PromptTokens, &totals.CompletionTokens, &totals.CostUSD)
+	return totals, err
+}
+
+// GetAISpendSince returns the total estimated AI cost since a time
+func (db *DB) GetAISpendSince(since time.Time) (float64, error) {
+	var spend float64
+	err := db.conn.QueryRow(`SELECT COALESCE(SUM(cost), 0) FROM ai_usage WHERE created_at >= ?`, since.UTC()).Scan(&spend)
+	return spend, err
+}
+
+// ExportQuoteSnapshots streams quote snapshots quoted in [from, to) oldest first
+func (db *DB) ExportQuoteSnapshots(from, to time.Time, fn func(models.QuoteSnapshot) error) error {
+	rows, err := db.conn.Query(`
+		SELECT symbol, price, change_percent, volume, quoted_at
+		FROM quote_snapshots WHERE quoted_at >= ? AND quoted_at < ? ORDER BY quoted_at
+	`, from.UTC(), to.UTC())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var q models.QuoteSnapshot
+		if err := rows.Scan(&q.Symbol, &q.Price, &q.ChangePercent, &q.Volume, &q.QuotedAt); err != nil {
+			return err
+		}
+		if err := fn(q); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// insertAlertSQL inserts a new price alert
+const insertAlertSQL = `
+	INSERT INTO price_alerts (profile_id, symbol, condition, price, reference_price, percent, volume_multiple, cooldown_seconds, rearm,
+		recurring, expires_at, bypass_quiet_hours)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+// insertAlertArgs are an alert's values for insertAlertSQL
+func insertAlertArgs(alert *models.PriceAlert) []interface{} {
+	return []interface{}{alert.ProfileID, alert.Symbol, alert.Condition, alert.Price, alert.ReferencePrice, alert.Percent, alert.VolumeMultiple,
+		alert.CooldownSeconds, alert.Rearm, alert.Recurring, nullableTime(alert.ExpiresAt), alert.BypassQuietHours}
+}
+
+// SavePriceAlert saves a price alert
+func (db *DB) SavePriceAlert(alert *models.PriceAlert) error {
+	result, err := db.writer.Exec(insertAlertSQL, insertAlertArgs(alert)...)
+	if err != nil {
+		return err
+	}
+	alert.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// SavePriceAlerts saves several price alerts in one transaction, so either all of
+// them are saved or none are
+func (db *DB) SavePriceAlerts(alerts []models.PriceAlert) error {
+	tx, err := db.writer.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, len(alerts))
+	for i := range alerts {
+		result, err := tx.Exec(insertAlertSQL, insertAlertArgs(&alerts[i])...)
+		if err != nil {
+			return err
+		}
+		ids[i], _ = result.LastInsertId()
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for i := range alerts {
+		alerts[i].ID = ids[i]
+	}
+	return nil
+}
+
+// UpdateAlert saves an edited alert's condition, thresholds, lifetime and state,
+// returning sql.ErrNoRows when its profile has no such alert. The symbol, mute and
+// trigger history are left as they are.
+func (db *DB) UpdateAlert(alert *models.PriceAlert) error {
+	return expectRow(db.writer.Exec(`
+		UPDATE price_alerts SET condition = ?, price = ?, reference_price = ?, percent = ?, volume_multiple = ?,
+			cooldown_seconds = ?, rearm = ?, recurring = ?, expires_at = ?, triggered = ?, expired = ?, disarmed = ?,
+			bypass_quiet_hours = ?
+		WHERE id = ? AND profile_id = ? AND deleted_at IS NULL
+	`, alert.Condition, alert.Price, alert.ReferencePrice, alert.Percent, alert.VolumeMultiple,
+		alert.CooldownSeconds, alert.Rearm, alert.Recurring, nullableTime(alert.ExpiresAt), alert.Triggered, alert.Expired, alert.Disarmed,
+		alert.BypassQuietHours, alert.ID, alert.ProfileID))
+}
+
+// GetActiveAlerts gets a profile's price alerts that are neither deactivated nor past their expiry
+func (db *DB) GetActiveAlerts(profileID int64) ([]models.PriceAlert, error) {
+	rows, err := db.conn.Query(alertColumns+` WHERE profile_id = ? AND triggered = 0 AND expired = 0 AND (expires_at IS NULL OR expires_at > ?)
+		AND deleted_at IS NULL`, profileID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanAlerts(rows)
+}
+
+// GetDeletedAlerts gets a profile's soft-deleted alerts that haven't been purged yet,
+// most recently deleted first
+func (db *DB) GetDeletedAlerts(profileID int64) ([]models.PriceAlert, error) {
+	rows, err := db.conn.Query(alertColumns+` WHERE profile_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`, profileID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAlerts(rows)
+}
+
+// GetPriceAlert gets one of a profile's price alerts, returning sql.ErrNoRows when the
+// profile has no such alert
+func (db *DB) GetPriceAlert(id, profileID int64) (*models.PriceAlert, error) {
+	rows, err := db.conn.Query(alertColumns+` WHERE id = ? AND profile_id = ? AND deleted_at IS NULL`, id, profileID)
+	if err != nil {
+		return nil, err
+	}
+	alerts, err := scanAlerts(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(alerts) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &alerts[0], nil
+}
+
+// GetIdempotentAlertID returns the alert a profile created with an idempotency key at
+// or after since, returning sql.ErrNoRows when the key is unused or older
+func (db *DB) GetIdempotentAlertID(profileID int64, key string, since time.Time) (int64, error) {
+	var id int64
+	err := db.conn.QueryRow(`
+		SELECT alert_id FROM alert_idempotency_keys WHERE profile_id = ? AND key = ? AND created_at >= ?
+	`, profileID, key, since.UTC()).Scan(&id)
+	return id, err
+}
+
+// SaveIdempotencyKey records the alert a profile created with an idempotency key,
+// replacing an expired use of the same key
+func (db *DB) SaveIdempotencyKey(profileID int64, key string, alertID int64) error {
+	_, err := db.writer.Exec(`
+		INSERT OR REPLACE INTO alert_idempotency_keys (profile_id, key, alert_id, created_at) VALUES (?, ?, ?, ?)
+	`, profileID, key, alertID, time.Now().UTC())
+	return err
+}
+
+// DeleteIdempotencyKeys removes idempotency keys used before the given time, returning how many
+func (db *DB) DeleteIdempotencyKeys(before time.Time) (int64, error) {
+	result, err := db.writer.Exec(`DELETE FROM alert_idempotency_keys WHERE created_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetAlertsTriggeredSince gets a profile's alerts that triggered at or after since
+func (db *DB) GetAlertsTriggeredSince(profileID int64, since time.Time) ([]models.PriceAlert, error) {
+	rows, err := db.conn.Query(alertColumns+` WHERE profile_id = ? AND triggered_at >= ? AND deleted_at IS NULL ORDER BY triggered_at`,
+		profileID, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanAlerts(rows)
+}
+
+// optionalJSON stores optional channel settings as JSON, or "" when unset
+func optionalJSON[T any](v *T) string {
+	if v == nil {
+		return ""
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// nullableTime stores an optional time as UTC, or NULL when unset
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// alertColumns selects the price_alerts columns read by scanAlerts
+const alertColumns = `SELECT id, COALESCE(profile_id, 0), symbol, condition, price, triggered, created_at, muted_until,
+	COALESCE(reference_price, 0), COALESCE(percent, 0), COALESCE(volume_multiple, 0),
+	COALESCE(cooldown_seconds, 0), COALESCE(rearm, 0), COALESCE(disarmed, 0), triggered_at,
+	COALESCE(recurring, 0), COALESCE(expired, 0), expires_at, deleted_at, COALESCE(bypass_quiet_hours, 0)
+	FROM price_alerts`
+
+// scanAlerts reads alert rows selected with alertColumns
+func scanAlerts(rows *sql.Rows) ([]models.PriceAlert, error) {
+	defer rows.Close()
+
+	var alerts []models.PriceAlert
+	for rows.Next() {
+		var a models.PriceAlert
+		var triggered int
+		var mutedUntil, triggeredAt, expiresAt, deletedAt sql.NullTime
+		if err := rows.Scan(&a.ID, &a.ProfileID, &a.Symbol, &a.Condition, &a.Price, &triggered, &a.CreatedAt, &mutedUntil,
+			&a.ReferencePrice, &a.Percent, &a.VolumeMultiple,
+			&a.CooldownSeconds, &a.Rearm, &a.Disarmed, &triggeredAt,
+			&a.Recurring, &a.Expired, &expiresAt, &deletedAt, &a.BypassQuietHours); err != nil {
+			return nil, err
+		}
+		if deletedAt.Valid {
+			a.DeletedAt = &deletedAt.Time
+		}
+		if expiresAt.Valid {
+			a.ExpiresAt = &expiresAt.Time
+		}
+		a.Triggered = triggered == 1
+		if mutedUntil.Valid {
+			a.MutedUntil = &mutedUntil.Time
+		}
+		if triggeredAt.Valid {
+			a.LastTriggeredAt = &triggeredAt.Time
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// TriggerAlert records that an alert fired. One-shot alerts are deactivated; recurring
+// alerts stay active, and re-arm alerts are disarmed until RearmAlert. It reports false
+// when the alert can't fire now, e.g. because a concurrent check already fired it or it
+// has expired, so only one caller sends notifications.
+func (db *DB) TriggerAlert(id int64) (bool, error) {
+	result, err := db.execRetry(`
+		UPDATE price_alerts SET
+			triggered = CASE WHEN recurring = 1 THEN 0 ELSE 1 END,
+			disarmed = rearm,
+			triggered_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND triggered = 0 AND disarmed = 0 AND expired = 0 AND deleted_at IS NULL
+			AND (expires_at IS NULL OR expires_at > ?)
+			AND (cooldown_seconds <= 0 OR triggered_at IS NULL
+				OR triggered_at <= datetime('now', '-' || cooldown_seconds || ' seconds'))
+	`, id, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
+
+// ExpireAlerts deactivates active alerts whose expiry has passed, returning their IDs
+func (db *DB) ExpireAlerts(now time.Time) ([]int64, error) {
+	rows, err := db.writer.Query(`
+		UPDATE price_alerts SET expired = 1
+		WHERE triggered = 0 AND expired = 0 AND expires_at IS NOT NULL AND expires_at <= ?
+		RETURNING id
+	`, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SaveAlertTrigger records an alert firing in its history
+func (db *DB) SaveAlertTrigger(t *models.AlertTrigger) error {
+	result, err := db.writer.Exec(`
+		INSERT INTO alert_triggers (alert_id, symbol, price, previous_close, change_percent, volume, source, message, triggered_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.AlertID, t.Symbol, t.Price, t.PreviousClose, t.ChangePercent, t.Volume, t.Source, t.Message, t.TriggeredAt.UTC())
+	if err != nil {
+		return err
+	}
+	t.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetAlertTriggers returns up to limit of an alert's firings, newest first
+func (db *DB) GetAlertTriggers(alertID int64, limit int) ([]models.AlertTrigger, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, alert_id, symbol, price, COALESCE(previous_close, 0), COALESCE(change_percent, 0), COALESCE(volume, 0),
+			source, message, triggered_at
+		FROM alert_triggers WHERE alert_id = ? ORDER BY triggered_at DESC, id DESC LIMIT ?
+	`, alertID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var triggers []models.AlertTrigger
+	for rows.Next() {
+		var t models.AlertTrigger
+		if err := rows.Scan(&t.ID, &t.AlertID, &t.Symbol, &t.Price, &t.PreviousClose, &t.ChangePercent, &t.Volume,
+			&t.Source, &t.Message, &t.TriggeredAt); err != nil {
+			return nil, err
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, rows.Err()
+}
+
+// RearmAlert lets a disarmed re-arm alert fire again
+func (db *DB) RearmAlert(id int64) error {
+	_, err := db.writer.Exec(`UPDATE price_alerts SET disarmed = 0 WHERE id = ?`, id)
+	return err
+}
+
+// MuteAlert suppresses a profile's alert's notifications until the given time, returning
+// sql.ErrNoRows when the profile has no such alert. A zero time unmutes it.
+func (db *DB) MuteAlert(id, profileID int64, until time.Time) error {
+	var mutedUntil interface{}
+	if !until.IsZero() {
+		mutedUntil = until.UTC()
+	}
+	result, err := db.writer.Exec(`UPDATE price_alerts SET muted_until = ? WHERE id = ? AND profile_id = ? AND deleted_at IS NULL`,
+		mutedUntil, id, profileID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeletePriceAlert soft-deletes one of a profile's price alerts; it stops firing and
+// can be restored until it's purged. It returns sql.ErrNoRows when the profile has no
+// such alert, or it's already deleted.
+func (db *DB) DeletePriceAlert(id, profileID int64) error {
+	return expectRow(db.writer.Exec(`UPDATE price_alerts SET deleted_at = ? WHERE id = ? AND profile_id = ? AND deleted_at IS NULL`,
+		time.Now().UTC(), id, profileID))
+}
+
+// MergeAlerts saves keep with the settings merged into it from the alerts in mergedIDs
+// and soft-deletes those in one transaction, pointing their idempotency keys at keep.
+// Unlike UpdateAlert it also saves the mute and last trigger time. It returns
+// sql.ErrNoRows, changing nothing, when keep's profile lacks keep or any of the others.
+func (db *DB) MergeAlerts(keep *models.PriceAlert, mergedIDs []int64) error {
+	tx, err := db.writer.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := expectRow(tx.Exec(`
+		UPDATE price_alerts SET condition = ?, price = ?, reference_price = ?, percent = ?, volume_multiple = ?,
+			cooldown_seconds = ?, rearm = ?, recurring = ?, expires_at = ?, triggered = ?, expired = ?, disarmed = ?,
+			bypass_quiet_hours = ?, muted_until = ?, triggered_at = ?
+		WHERE id = ? AND profile_id = ? AND deleted_at IS NULL
+	`, keep.Condition, keep.Price, keep.ReferencePrice, keep.Percent, keep.VolumeMultiple,
+		keep.CooldownSeconds, keep.Rearm, keep.Recurring, nullableTime(keep.ExpiresAt), keep.Triggered, keep.Expired, keep.Disarmed,
+		keep.BypassQuietHours, nullableTime(keep.MutedUntil), nullableTime(keep.LastTriggeredAt),
+		keep.ID, keep.ProfileID)); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, id := range mergedIDs {
+		if err := expectRow(tx.Exec(`UPDATE price_alerts SET deleted_at = ? WHERE id = ? AND profile_id = ? AND deleted_at IS NULL`,
+			now, id, keep.ProfileID)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE alert_idempotency_keys SET alert_id = ? WHERE alert_id = ? AND profile_id = ?`,
+			keep.ID, id, keep.ProfileID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RestorePriceAlert undoes DeletePriceAlert, returning sql.ErrNoRows when the profile
+// has no such soft-deleted alert
+func (db *DB) RestorePriceAlert(id, profileID int64) error {
+	return expectRow(db.writer.Exec(`UPDATE price_alerts SET deleted_at = NULL WHERE id = ? AND profile_id = ? AND deleted_at IS NOT NULL`,
+		id, profileID))
+}
+
+// SaveNotification saves a notification record
+func (db *DB) SaveNotification(n *models.Notification) error {
+	channelsJSON, _ := json.Marshal(n.Channels)
+	result, err := db.writer.Exec(`
+		INSERT INTO notifications (type, title, message, symbol, channels) VALUES (?, ?, ?, ?, ?)
+	`, n.Type, n.Title, n.Message, n.Symbol, string(channelsJSON))
+	if err != nil {
+		return err
+	}
+	n.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// SaveNotificationDelivery records the outcome of sending a notification to a channel
+func (db *DB) SaveNotificationDelivery(d *models.NotificationDelivery) error {
+	result, err := db.writer.Exec(`
+		INSERT INTO notification_deliveries
+			(notification_type, title, symbol, channel_id, channel_type, status, attempts, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, d.NotificationType, d.Title, d.Symbol, d.ChannelID, d.ChannelType, d.Status, d.Attempts, d.Error, d.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	d.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetNotificationDeliveries gets the most recent delivery outcomes, newest first,
+// optionally only those with a status
+func (db *DB) GetNotificationDeliveries(limit int, status string) ([]models.NotificationDelivery, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, notification_type, title, symbol, channel_id, channel_type, status, attempts, COALESCE(error, ''), created_at
+		FROM notification_deliveries
+		WHERE ? = '' OR status = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.NotificationDelivery{}
+	for rows.Next() {
+		var d models.NotificationDelivery
+		if err := rows.Scan(&d.ID, &d.NotificationType, &d.Title, &d.Symbol, &d.ChannelID, &d.ChannelType,
+			&d.Status, &d.Attempts, &d.Error, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// jobColumns are the columns scanJob reads, in order
+const jobColumns = `id, type, profile_id, key, payload, status, attempts, max_attempts, last_error, run_at, created_at, started_at, finished_at`
+
+// scanJob scans a row of jobColumns
+func scanJob(row interface{ Scan(...interface{}) error }) (*models.Job, error) {
+	var j models.Job
+	var payload string
+	var startedAt, finishedAt sql.NullTime
+	if err := row.Scan(&j.ID, &j.Type, &j.ProfileID, &j.Key, &payload, &j.Status, &j.Attempts, &j.MaxAttempts,
+		&j.LastError, &j.RunAt, &j.CreatedAt, &startedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	j.Payload = json.RawMessage(payload)
+	if startedAt.Valid {
+		j.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		j.FinishedAt = &finishedAt.Time
+	}
+	return &j, nil
+}
+
+// EnqueueJob adds a pending job, due at its RunAt or right away. A job with a key is
+// only added when no pending job has the same type and key; it reports whether the job
+// was added, setting its ID.
+func (db *DB) EnqueueJob(job *models.Job) (bool, error) {
+	now := time.Now().UTC()
+	if job.RunAt.IsZero() {
+		job.RunAt = now
+	}
+	if len(job.Payload) == 0 {
+		job.Payload = json.RawMessage("{}")
+	}
+	job.Status, job.CreatedAt = models.JobPending, now
+	result, err := db.execRetry(`
+		INSERT INTO jobs (type, profile_id, key, payload, status, max_attempts, run_at, created_at)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE ? = '' OR NOT EXISTS (SELECT 1 FROM jobs WHERE type = ? AND key = ? AND status = ?)
+	`, job.Type, job.ProfileID, job.Key, string(job.Payload), models.JobPending, job.MaxAttempts, job.RunAt.UTC(), now,
+		job.Key, job.Type, job.Key, models.JobPending)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	job.ID, _ = result.LastInsertId()
+	return true, nil
+}
+
+// ClaimJob marks the longest-due pending job of a type running, counting the attempt,
+// and returns it, or sql.ErrNoRows when none is due
+func (db *DB) ClaimJob(jobType string, now time.Time) (*models.Job, error) {
+	tx, err := db.writer.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRow(`
+		SELECT id FROM jobs WHERE status = ? AND type = ? AND run_at <= ? ORDER BY run_at, id LIMIT 1
+	`, models.JobPending, jobType, now.UTC()).Scan(&id); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE jobs SET status = ?, attempts = attempts + 1, started_at = ? WHERE id = ?`,
+		models.JobRunning, now.UTC(), id); err != nil {
+		return nil, err
+	}
+	job, err := scanJob(tx.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	return job, tx.Commit()
+}
+
+// CompleteJob marks a running job done
+func (db *DB) CompleteJob(id int64) error {
+	_, err := db.execRetry(`UPDATE jobs SET status = ?, finished_at = ? WHERE id = ?`, models.JobDone, time.Now().UTC(), id)
+	return err
+}
+
+// RetryJob records a job's failed attempt and makes it pending again at runAt. A
+// non-nil payload replaces the job's, e.g. to leave out the part that succeeded.
+func (db *DB) RetryJob(id int64, lastError string, runAt time.Time, payload json.RawMessage) error {
+	var newPayload interface{}
+	if payload != nil {
+		newPayload = string(payload)
+	}
+	_, err := db.execRetry(`UPDATE jobs SET status = ?, last_error = ?, run_at = ?, payload = COALESCE(?, payload) WHERE id = ?`,
+		models.JobPending, lastError, runAt.UTC(), newPayload, id)
+	return err
+}
+
+// UpdateJobPayload replaces a job's payload, e.g. to narrow a running job to the part
+// it has left
+func (db *DB) UpdateJobPayload(id int64, payload json.RawMessage) error {
+	_, err := db.execRetry(`UPDATE jobs SET payload = ? WHERE id = ?`, string(payload), id)
+	return err
+}
+
+// FailJob marks a job failed for good
+func (db *DB) FailJob(id int64, lastError string) error {
+	_, err := db.execRetry(`UPDATE jobs SET status = ?, last_error = ?, finished_at = ? WHERE id = ?`,
+		models.JobFailed, lastError, time.Now().UTC(), id)
+	return err
+}
+
+// RequeueRunningJobs makes the jobs a stopped server left running pending again,
+// returning how many. Call it before any worker starts.
+func (db *DB) RequeueRunningJobs() (int64, error) {
+	result, err := db.execRetry(`UPDATE jobs SET status = ? WHERE status = ?`, models.JobPending, models.JobRunning)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DelayJobs makes the pending jobs of a type due before until wait for it, returning how many
+func (db *DB) DelayJobs(jobType string, until time.Time) (int64, error) {
+	result, err := db.execRetry(`UPDATE jobs SET run_at = ? WHERE status = ? AND type = ? AND run_at < ?`,
+		until.UTC(), models.JobPending, jobType, until.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetJobs gets a profile's most recent jobs and the server-wide ones (profile 0),
+// newest first, optionally only those with a status or of a type
+func (db *DB) GetJobs(profileID int64, limit int, status, jobType string) ([]models.Job, error) {
+	rows, err := db.conn.Query(`
+		SELECT `+jobColumns+` FROM jobs
+		WHERE profile_id IN (?, 0) AND (? = '' OR status = ?) AND (? = '' OR type = ?)
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, profileID, status, status, jobType, jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// DeleteFinishedJobs deletes done and failed jobs that finished before the given time,
+// returning how many
+func (db *DB) DeleteFinishedJobs(before time.Time) (int64, error) {
+	result, err := db.execRetry(`DELETE FROM jobs WHERE status IN (?, ?) AND finished_at < ?`, models.JobDone, models.JobFailed, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetTranscript gets a cached earnings-call transcript, returning sql.ErrNoRows when not cached
+func (db *DB) GetTranscript(symbol, quarter string) (*models.EarningsTranscript, error) {
+	var t models.EarningsTranscript
+	err := db.conn.QueryRow(`
+		SELECT symbol, quarter, transcript, COALESCE(summary, ''), fetched_at
+		FROM earnings_transcripts WHERE symbol = ? AND quarter = ?
+	`, symbol, quarter).Scan(&t.Symbol, &t.Quarter, &t.Transcript, &t.Summary, &t.FetchedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SaveTranscript caches an earnings-call transcript (transcripts don't change once published)
+func (db *DB) SaveTranscript(t *models.EarningsTranscript) error {
+	_, err := db.writer.Exec(`
+		INSERT INTO earnings_transcripts (symbol, quarter, transcript, summary) VALUES (?, ?, ?, ?)
+		ON CONFLICT(symbol, quarter) DO UPDATE SET transcript = excluded.transcript, summary = excluded.summary
+	`, t.Symbol, t.Quarter, t.Transcript, t.Summary)
+	return err
+}
+
+// GetPromptTemplates gets the stored analysis prompt overrides by name
+func (db *DB) GetPromptTemplates() ([]models.PromptTemplate, error) {
+	rows, err := db.conn.Query(`SELECT name, template, updated_at FROM prompt_templates ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []models.PromptTemplate
+	for rows.Next() {
+		var t models.PromptTemplate
+		if err := rows.Scan(&t.Name, &t.Template, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// SavePromptTemplate creates or replaces the stored prompt override called name
+func (db *DB) SavePromptTemplate(name, text string) error {
+	_, err := db.writer.Exec(`
+		INSERT INTO prompt_templates (name, template, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(name) DO UPDATE SET template = excluded.template, updated_at = excluded.updated_at
+	`, name, text)
+	return err
+}
+
+// DeletePromptTemplate removes a stored prompt override, returning sql.ErrNoRows when
+// there's none called name
+func (db *DB) DeletePromptTemplate(name string) error {
+	return expectRow(db.writer.Exec(`DELETE FROM prompt_templates WHERE name = ?`, name))
+}
+
+// GetCachedHistory gets the candles last fetched from provider for a symbol, period and
+// interval with when they were fetched, returning sql.ErrNoRows when none are cached
+func (db *DB) GetCachedHistory(provider, symbol, period, interval string) ([]models.Candle, time.Time, error) {
+	var candlesJSON string
+	var fetchedAt time.Time
+	err := db.conn.QueryRow(`
+		SELECT candles, fetched_at FROM historical_cache
+		WHERE provider = ? AND symbol = ? AND period = ? AND interval = ?
+	`, provider, symbol, period, interval).Scan(&candlesJSON, &fetchedAt)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var candles []models.Candle
+	if err := json.Unmarshal([]byte(candlesJSON), &candles); err != nil {
+		return nil, time.Time{}, err
+	}
+	return candles, fetchedAt, nil
+}
+
+// SaveCachedHistory stores the candles fetched from provider for a symbol, period and
+// interval, replacing the ones cached before
+func (db *DB) SaveCachedHistory(provider, symbol, period, interval string, candles []models.Candle, fetchedAt time.Time) error {
+	candlesJSON, err := json.Marshal(candles)
+	if err != nil {
+		return err
+	}
+	_, err = db.execRetry(`
+		INSERT INTO historical_cache (provider, symbol, period, interval, candles, fetched_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(provider, symbol, period, interval) DO UPDATE SET candles = excluded.candles, fetched_at = excluded.fetched_at
+	`, provider, symbol, period, interval, string(candlesJSON), fetchedAt.UTC())
+	return err
+}
+
+// GetPositions gets all held positions
+func (db *DB) GetPositions() ([]models.Position, error) {
+	rows, err := db.conn.Query(`SELECT symbol, quantity, avg_cost, opened_at, updated_at FROM positions ORDER BY symbol`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []models.Position
+	for rows.Next() {
+		var p models.Position
+		if err := rows.Scan(&p.Symbol, &p.Quantity, &p.AvgCost, &p.OpenedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, nil
+}
+
+// GetPosition gets the position for a symbol, returning sql.ErrNoRows when none is held
+func (db *DB) GetPosition(symbol string) (*models.Position, error) {
+	var p models.Position
+	err := db.conn.QueryRow(`
+		SELECT symbol, quantity, avg_cost, opened_at, updated_at FROM positions WHERE symbol = ?
+	`, symbol).Scan(&p.Symbol, &p.Quantity, &p.AvgCost, &p.OpenedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SavePosition creates or replaces the position for a symbol. A zero OpenedAt means
+// now for a new position and keeps the original date for an existing one.
+func (db *DB) SavePosition(p *models.Position) error {
+	var openedAt *time.Time
+	if !p.OpenedAt.IsZero() {
+		openedAt = &p.OpenedAt
+	}
+	_, err := db.writer.Exec(`
+		INSERT INTO positions (symbol, quantity, avg_cost, opened_at, updated_at)
+		VALUES (?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), CURRENT_TIMESTAMP)
+		ON CONFLICT(symbol) DO UPDATE SET quantity = excluded.quantity, avg_cost = excluded.avg_cost,
+			opened_at = COALESCE(?, positions.opened_at, excluded.opened_at), updated_at = CURRENT_TIMESTAMP
+	`, p.Symbol, p.Quantity, p.AvgCost, nullableTime(openedAt), nullableTime(openedAt))
+	return err
+}
+
+// DeletePosition removes the position for a symbol
+func (db *DB) DeletePosition(symbol string) error {
+	_, err := db.writer.Exec(`DELETE FROM positions WHERE symbol = ?`, symbol)
+	return err
 }
 
 // GetRecommendationsToday gets all recommendations from today
 func (db *DB) GetRecommendationsToday() ([]models.Recommendation, error) {
 	today := time.Now().Truncate(24 * time.Hour)
 	rows, err := db.conn.Query(`
-		SELECT id, symbol, action, confidence, reasoning, '', 0, '', generated_at, 'unknown'
-		FROM analysis_results WHERE generated_at >= ?
+		SELECT id, symbol, action, confidence, reasoning, '', 0, '', generated_at, 'unknown', risks, price_targets
+		FROM analysis_results WHERE generated_at >= ? AND deleted_at IS NULL
 	`, today)
 	if err != nil {
 		return nil, err
@@ -475,11 +1926,15 @@ func (db *DB) GetRecommendationsToday() ([]models.Recommendation, error) {
 	var recs []models.Recommendation
 	for rows.Next() {
 		var r models.Recommendation
-		var reasoning string
+		var reasoning, risksJSON, priceTargetsJSON string
 		if err := rows.Scan(&r.ID, &r.Symbol, &r.Action, &r.Confidence, &reasoning,
-			&r.Timeframe, &r.TargetPrice, &r.Reasoning, &r.CreatedAt, &r.AIProvider); err != nil {
+			&r.Timeframe, &r.TargetPrice, &r.Reasoning, &r.CreatedAt, &r.AIProvider, &risksJSON, &priceTargetsJSON); err != nil {
 			return nil, err
 		}
+		json.Unmarshal([]byte(risksJSON), &r.Risks)
+		var targets models.PriceTargets
+		json.Unmarshal([]byte(priceTargetsJSON), &targets)
+		r.EntryPrice, r.TargetPrice, r.StopLoss = targets.Entry, targets.Target, targets.StopLoss
 		if r.Reasoning == "" {
 			r.Reasoning = reasoning
 		}
@@ -491,8 +1946,8 @@ func (db *DB) GetRecommendationsToday() ([]models.Recommendation, error) {
 // GetRecentRecommendations gets recent recommendations
 func (db *DB) GetRecentRecommendations(limit int) ([]models.Recommendation, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, symbol, action, confidence, reasoning, '', 0, '', generated_at, 'unknown'
-		FROM analysis_results ORDER BY generated_at DESC LIMIT ?
+		SELECT id, symbol, action, confidence, reasoning, '', 0, '', generated_at, 'unknown', risks, price_targets
+		FROM analysis_results WHERE deleted_at IS NULL ORDER BY generated_at DESC LIMIT ?
 	`, limit)
 	if err != nil {
 		return nil, err
@@ -502,11 +1957,15 @@ func (db *DB) GetRecentRecommendations(limit int) ([]models.Recommendation, erro
 	var recs []models.Recommendation
 	for rows.Next() {
 		var r models.Recommendation
-		var reasoning string
+		var reasoning, risksJSON, priceTargetsJSON string
 		if err := rows.Scan(&r.ID, &r.Symbol, &r.Action, &r.Confidence, &reasoning,
-			&r.Timeframe, &r.TargetPrice, &r.Reasoning, &r.CreatedAt, &r.AIProvider); err != nil {
+			&r.Timeframe, &r.TargetPrice, &r.Reasoning, &r.CreatedAt, &r.AIProvider, &risksJSON, &priceTargetsJSON); err != nil {
 			return nil, err
 		}
+		json.Unmarshal([]byte(risksJSON), &r.Risks)
+		var targets models.PriceTargets
+		json.Unmarshal([]byte(priceTargetsJSON), &targets)
+		r.EntryPrice, r.TargetPrice, r.StopLoss = targets.Entry, targets.Target, targets.StopLoss
 		if r.Reasoning == "" {
 			r.Reasoning = reasoning
 		}
@@ -517,8 +1976,8 @@ func (db *DB) GetRecentRecommendations(limit int) ([]models.Recommendation, erro
 
 // GetFilteredRecommendations gets recommendations with filters
 func (db *DB) GetFilteredRecommendations(action string, minConfidence float64, symbol string) ([]models.Recommendation, error) {
-	query := `SELECT id, symbol, action, confidence, reasoning, '', 0, '', generated_at, 'unknown'
-		FROM analysis_results WHERE 1=1`
+	query := `SELECT id, symbol, action, confidence, reasoning, '', 0, '', generated_at, 'unknown', risks, price_targets
+		FROM analysis_results WHERE deleted_at IS NULL`
 	args := []interface{}{}
 
 	if action != "" {
@@ -544,11 +2003,15 @@ func (db *DB) GetFilteredRecommendations(action string, minConfidence float64, s
 	var recs []models.Recommendation
 	for rows.Next() {
 		var r models.Recommendation
-		var reasoning string
+		var reasoning, risksJSON, priceTargetsJSON string
 		if err := rows.Scan(&r.ID, &r.Symbol, &r.Action, &r.Confidence, &reasoning,
-			&r.Timeframe, &r.TargetPrice, &r.Reasoning, &r.CreatedAt, &r.AIProvider); err != nil {
+			&r.Timeframe, &r.TargetPrice, &r.Reasoning, &r.CreatedAt, &r.AIProvider, &risksJSON, &priceTargetsJSON); err != nil {
 			return nil, err
 		}
+		json.Unmarshal([]byte(risksJSON), &r.Risks)
+		var targets models.PriceTargets
+		json.Unmarshal([]byte(priceTargetsJSON), &targets)
+		r.EntryPrice, r.TargetPrice, r.StopLoss = targets.Entry, targets.Target, targets.StopLoss
 		if r.Reasoning == "" {
 			r.Reasoning = reasoning
 		}
@@ -560,29 +2023,35 @@ func (db *DB) GetFilteredRecommendations(action string, minConfidence float64, s
 // GetAnalysis gets a single analysis by ID
 func (db *DB) GetAnalysis(id int64) (*models.Analysis, error) {
 	var a models.Analysis
-	var priceTargetsJSON, risksJSON string
+	var priceTargetsJSON, risksJSON, tagsJSON string
 	err := db.conn.QueryRow(`
-		SELECT id, symbol, action, confidence, reasoning, price_targets, risks, timeframe, generated_at
-		FROM analysis_results WHERE id = ?
+		SELECT id, symbol, action, confidence, reasoning, price_targets, risks, timeframe,
+		       COALESCE(tags, '[]'), generated_at
+		FROM analysis_results WHERE id = ? AND deleted_at IS NULL
 	`, id).Scan(&a.ID, &a.Symbol, &a.Recommendation.Action, &a.Recommendation.Confidence,
-		&a.Recommendation.Reasoning, &priceTargetsJSON, &risksJSON, &a.Recommendation.Timeframe, &a.CreatedAt)
+		&a.Recommendation.Reasoning, &priceTargetsJSON, &risksJSON, &a.Recommendation.Timeframe,
+		&tagsJSON, &a.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
+	json.Unmarshal([]byte(risksJSON), &a.Recommendation.Risks)
+	json.Unmarshal([]byte(tagsJSON), &a.Tags)
 
 	a.AIProvider = "unknown"
 	return &a, nil
 }
 
-// GetConfig returns the app config for the settings page
-func (db *DB) GetConfig() (*models.AppConfig, error) {
-	uc, err := db.GetOrCreateConfig()
+// GetConfig returns a profile's app config for the settings page
+func (db *DB) GetConfig(profileID int64) (*models.AppConfig, error) {
+	uc, err := db.GetProfileConfig(profileID)
 	if err != nil {
 		return nil, err
 	}
 
 	config := &models.AppConfig{
+		ProfileID:          uc.ID,
 		MarketDataProvider: uc.MarketDataProvider,
+		MarketDataFallback: uc.MarketDataFallback,
 		HasMarketAPIKey:    uc.MarketDataAPIKey != "",
 		AIProvider:         uc.AIProvider,
 		HasAIAPIKey:        uc.AIProviderAPIKey != "",
@@ -591,6 +2060,8 @@ func (db *DB) GetConfig() (*models.AppConfig, error) {
 		TradeFrequency:     uc.TradeFrequency,
 		TrackedSymbols:     uc.TrackedSymbols,
 		PollingInterval:    uc.PollingInterval,
+		ExtendedHours:      uc.IncludeExtendedHours,
+		Version:            uc.Version,
 	}
 
 	// Get notification channels
@@ -603,6 +2074,9 @@ func (db *DB) GetConfig() (*models.AppConfig, error) {
 		case "discord":
 			config.DiscordWebhook = ch.Target
 			config.DiscordEnabled = ch.Enabled
+		case "slack":
+			config.SlackWebhook = ch.Target
+			config.SlackEnabled = ch.Enabled
 		case "sms":
 			config.SMSPhone = ch.Target
 			config.SMSEnabled = ch.Enabled
@@ -0,0 +1,448 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration is one versioned schema change. Each runs in a transaction with its
+// schema_migrations row, so it is either fully applied or not at all.
+type migration struct {
+	version     int
+	description string
+	apply       func(tx *sql.Tx) error
+}
+
+// migrations are applied in order; append new ones with the next version and never
+// edit one that has shipped
+var migrations = []migration{
+	{1, "initial schema", execStatements(initialSchema)},
+	{2, "columns added before versioned migrations", migrateLegacyColumns},
+	{3, "configuration profiles", migrateProfiles},
+	{4, "signal notification settings", migrateNotifySettings},
+	{5, "raw analysis prompts", execStatements(analysisDebugSchema)},
+	{6, "alert idempotency keys", execStatements(`
+		CREATE TABLE IF NOT EXISTS alert_idempotency_keys (
+			profile_id INTEGER NOT NULL,
+			key TEXT NOT NULL,
+			alert_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (profile_id, key)
+		)
+	`)},
+	{7, "soft deletes", migrateSoftDeletes},
+	{8, "analysis prices", migrateAnalysisPrices},
+	{9, "telegram channels", migrateTelegramChannels},
+	{10, "channel symbol filters", migrateChannelSymbols},
+	{11, "raw analysis confidence", migrateRawConfidence},
+	{12, "alert trigger history", execStatements(`
+		CREATE TABLE IF NOT EXISTS alert_triggers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alert_id INTEGER NOT NULL,
+			symbol TEXT NOT NULL,
+			price REAL NOT NULL,
+			previous_close REAL,
+			change_percent REAL,
+			volume INTEGER,
+			source TEXT NOT NULL,
+			message TEXT NOT NULL,
+			triggered_at DATETIME NOT NULL
+		)
+	`, `CREATE INDEX IF NOT EXISTS idx_alert_triggers_alert ON alert_triggers(alert_id, triggered_at)`)},
+	{13, "watchlist groups", migrateWatchlistGroups},
+	{14, "historical data cache", execStatements(`
+		CREATE TABLE IF NOT EXISTS historical_cache (
+			provider TEXT NOT NULL,
+			symbol TEXT NOT NULL,
+			period TEXT NOT NULL,
+			interval TEXT NOT NULL,
+			candles TEXT NOT NULL,
+			fetched_at DATETIME NOT NULL,
+			PRIMARY KEY (provider, symbol, period, interval)
+		)
+	`)},
+	{15, "extended hours setting", migrateExtendedHours},
+	{16, "alert quiet hours override", migrateAlertQuietHours},
+	{17, "ensemble verdicts", migrateEnsembleVerdicts},
+	{18, "background job queue", execStatements(`
+		CREATE TABLE IF NOT EXISTS jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			type TEXT NOT NULL,
+			profile_id INTEGER NOT NULL DEFAULT 0,
+			key TEXT NOT NULL DEFAULT '',
+			payload TEXT NOT NULL DEFAULT '{}',
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL,
+			last_error TEXT NOT NULL DEFAULT '',
+			run_at DATETIME NOT NULL,
+			created_at DATETIME NOT NULL,
+			started_at DATETIME,
+			finished_at DATETIME
+		)
+	`, `CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs(status, type, run_at)`)},
+	{19, "prompt templates", execStatements(`
+		CREATE TABLE IF NOT EXISTS prompt_templates (
+			name TEXT PRIMARY KEY,
+			template TEXT NOT NULL,
+			updated_at DATETIME NOT NULL
+		)
+	`)},
+}
+
+// initialSchema is the schema as it stood when versioned migrations were introduced.
+// It only creates what's missing, so existing databases are adopted as they are.
+const initialSchema = `
+	CREATE TABLE IF NOT EXISTS user_config (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		market_data_provider TEXT DEFAULT 'alphavantage',
+		market_data_api_key TEXT DEFAULT '',
+		ai_provider TEXT DEFAULT 'openai',
+		ai_provider_api_key TEXT DEFAULT '',
+		ai_model TEXT DEFAULT 'gpt-4o',
+		risk_tolerance TEXT DEFAULT 'moderate',
+		trade_frequency TEXT DEFAULT 'weekly',
+		tracked_symbols TEXT DEFAULT '[]',
+		polling_interval INTEGER DEFAULT 30,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS notification_channels (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		config_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		target TEXT NOT NULL,
+		enabled INTEGER DEFAULT 1,
+		events TEXT DEFAULT '[]',
+		FOREIGN KEY (config_id) REFERENCES user_config(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS analysis_results (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		symbol TEXT NOT NULL,
+		action TEXT NOT NULL,
+		confidence REAL NOT NULL,
+		reasoning TEXT NOT NULL,
+		price_targets TEXT NOT NULL,
+		risks TEXT NOT NULL,
+		timeframe TEXT NOT NULL,
+		generated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS price_alerts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		symbol TEXT NOT NULL,
+		condition TEXT NOT NULL,
+		price REAL NOT NULL,
+		triggered INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS notifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type TEXT NOT NULL,
+		title TEXT NOT NULL,
+		message TEXT NOT NULL,
+		symbol TEXT NOT NULL,
+		channels TEXT NOT NULL,
+		sent_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS notification_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		notification_type TEXT NOT NULL,
+		title TEXT NOT NULL,
+		symbol TEXT NOT NULL,
+		channel_id INTEGER NOT NULL,
+		channel_type TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL,
+		error TEXT DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS earnings_transcripts (
+		symbol TEXT NOT NULL,
+		quarter TEXT NOT NULL,
+		transcript TEXT NOT NULL,
+		summary TEXT DEFAULT '',
+		fetched_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (symbol, quarter)
+	);
+
+	CREATE TABLE IF NOT EXISTS positions (
+		symbol TEXT PRIMARY KEY,
+		quantity REAL NOT NULL,
+		avg_cost REAL NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS quote_snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		symbol TEXT NOT NULL,
+		price REAL NOT NULL,
+		change_percent REAL,
+		volume INTEGER,
+		quoted_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS ai_usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL,
+		input_tokens INTEGER NOT NULL,
+		output_tokens INTEGER NOT NULL,
+		cost REAL NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_ai_usage_created ON ai_usage(created_at);
+	CREATE INDEX IF NOT EXISTS idx_deliveries_created ON notification_deliveries(created_at);
+	CREATE INDEX IF NOT EXISTS idx_snapshots_quoted ON quote_snapshots(quoted_at);
+	CREATE INDEX IF NOT EXISTS idx_analysis_symbol ON analysis_results(symbol);
+	CREATE INDEX IF NOT EXISTS idx_analysis_generated ON analysis_results(generated_at);
+	CREATE INDEX IF NOT EXISTS idx_alerts_symbol ON price_alerts(symbol);
+`
+
+// legacyColumns were added to existing databases by ad-hoc ALTERs before versioned
+// migrations; older databases may have any subset of them
+var legacyColumns = []struct {
+	table, column, definition string
+}{
+	{"user_config", "polling_interval", "INTEGER DEFAULT 30"},
+	{"user_config", "symbol_aliases", "TEXT DEFAULT '{}'"},
+	{"user_config", "version", "INTEGER DEFAULT 1"},
+	{"user_config", "market_data_provider_fallback", "TEXT DEFAULT ''"},
+	{"analysis_results", "timeframes", "TEXT DEFAULT '[]'"},
+	{"analysis_results", "smoothed_confidence", "REAL"},
+	{"analysis_results", "tags", "TEXT DEFAULT '[]'"},
+	{"analysis_results", "position_context", "INTEGER DEFAULT 0"},
+	{"price_alerts", "triggered_at", "DATETIME"},
+	{"analysis_results", "suggested_alerts", "TEXT DEFAULT '[]'"},
+	{"price_alerts", "muted_until", "DATETIME"},
+	{"analysis_results", "beta", "REAL"},
+	{"analysis_results", "benchmark", "TEXT DEFAULT ''"},
+	{"analysis_results", "detail_level", "TEXT DEFAULT 'standard'"},
+	{"analysis_results", "prompt_tokens", "INTEGER DEFAULT 0"},
+	{"analysis_results", "completion_tokens", "INTEGER DEFAULT 0"},
+	{"analysis_results", "cost_usd", "REAL DEFAULT 0"},
+	{"price_alerts", "reference_price", "REAL DEFAULT 0"},
+	{"price_alerts", "percent", "REAL DEFAULT 0"},
+	{"price_alerts", "volume_multiple", "REAL DEFAULT 0"},
+	{"price_alerts", "cooldown_seconds", "INTEGER DEFAULT 0"},
+	{"price_alerts", "rearm", "INTEGER DEFAULT 0"},
+	{"price_alerts", "disarmed", "INTEGER DEFAULT 0"},
+	{"price_alerts", "recurring", "INTEGER DEFAULT 0"},
+	{"price_alerts", "expires_at", "DATETIME"},
+	{"price_alerts", "expired", "INTEGER DEFAULT 0"},
+	{"notification_channels", "webhook", "TEXT DEFAULT ''"},
+	{"positions", "opened_at", "DATETIME"},
+}
+
+// migrateLegacyColumns adds whichever legacy columns are missing and backfills them
+func migrateLegacyColumns(tx *sql.Tx) error {
+	for _, c := range legacyColumns {
+		if err := addColumn(tx, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	return execStatements(
+		// Positions saved before opened_at was tracked were opened no later than their last update
+		`UPDATE positions SET opened_at = updated_at WHERE opened_at IS NULL`,
+		// Alerts with a cooldown or re-arm predate the recurring flag and repeated implicitly
+		`UPDATE price_alerts SET recurring = 1 WHERE recurring = 0 AND (cooldown_seconds > 0 OR rearm = 1)`,
+	)(tx)
+}
+
+// migrateProfiles names the config rows so each is a profile, and gives alerts an
+// owning profile. Existing alerts belong to the oldest (default) profile.
+func migrateProfiles(tx *sql.Tx) error {
+	if err := addColumn(tx, "user_config", "name", "TEXT DEFAULT 'default'"); err != nil {
+		return err
+	}
+	if err := addColumn(tx, "price_alerts", "profile_id", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	return execStatements(
+		`UPDATE user_config SET name = 'profile-' || id WHERE id <> (SELECT MIN(id) FROM user_config)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_user_config_name ON user_config(name)`,
+		`UPDATE price_alerts SET profile_id = COALESCE((SELECT MIN(id) FROM user_config), 0) WHERE profile_id = 0`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_profile ON price_alerts(profile_id)`,
+	)(tx)
+}
+
+// migrateNotifySettings adds the per-profile thresholds for signal notifications,
+// defaulting to the previously hard-coded BUY/SELL at 0.7 confidence or more
+func migrateNotifySettings(tx *sql.Tx) error {
+	if err := addColumn(tx, "user_config", "notify_min_confidence", "REAL DEFAULT 0.7"); err != nil {
+		return err
+	}
+	if err := addColumn(tx, "user_config", "notify_on_actions", `TEXT DEFAULT '["BUY","SELL"]'`); err != nil {
+		return err
+	}
+	return addColumn(tx, "user_config", "notify_on_hold", "INTEGER DEFAULT 0")
+}
+
+// migrateSoftDeletes lets alerts and analyses be deleted and restored until they're purged
+func migrateSoftDeletes(tx *sql.Tx) error {
+	if err := addColumn(tx, "price_alerts", "deleted_at", "DATETIME"); err != nil {
+		return err
+	}
+	return addColumn(tx, "analysis_results", "deleted_at", "DATETIME")
+}
+
+// migrateAnalysisPrices keeps the quote each analysis was made at; earlier ones stay 0
+func migrateAnalysisPrices(tx *sql.Tx) error {
+	return addColumn(tx, "analysis_results", "price", "REAL DEFAULT 0")
+}
+
+// migrateTelegramChannels keeps the bot settings of telegram notification channels
+func migrateTelegramChannels(tx *sql.Tx) error {
+	return addColumn(tx, "notification_channels", "telegram", "TEXT DEFAULT ''")
+}
+
+// migrateChannelSymbols keeps the symbol filters of notification channels
+func migrateChannelSymbols(tx *sql.Tx) error {
+	return addColumn(tx, "notification_channels", "symbols", "TEXT DEFAULT ''")
+}
+
+// migrateRawConfidence keeps the model's confidence of calibrated analyses; others stay NULL
+func migrateRawConfidence(tx *sql.Tx) error {
+	return addColumn(tx, "analysis_results", "raw_confidence", "REAL")
+}
+
+// migrateWatchlistGroups keeps each profile's named watchlist sections; existing
+// profiles start with none, so all their symbols are ungrouped
+func migrateWatchlistGroups(tx *sql.Tx) error {
+	return addColumn(tx, "user_config", "watchlist_groups", "TEXT DEFAULT '[]'")
+}
+
+// migrateExtendedHours adds the per-profile choice of pricing analyses and alerts at
+// pre-market and after-hours trades, off by default
+func migrateExtendedHours(tx *sql.Tx) error {
+	return addColumn(tx, "user_config", "include_extended_hours", "INTEGER DEFAULT 0")
+}
+
+// migrateAlertQuietHours adds the flag letting an alert notify during quiet hours
+func migrateAlertQuietHours(tx *sql.Tx) error {
+	return addColumn(tx, "price_alerts", "bypass_quiet_hours", "INTEGER DEFAULT 0")
+}
+
+// migrateEnsembleVerdicts adds the individual models' verdicts behind ensemble analyses
+func migrateEnsembleVerdicts(tx *sql.Tx) error {
+	return addColumn(tx, "analysis_results", "ensemble", "TEXT DEFAULT '[]'")
+}
+
+// analysisDebugSchema holds the prompts and raw replies behind analyses, kept apart
+// from analysis_results since they're large and only stored when STORE_RAW_PROMPTS is set
+const analysisDebugSchema = `
+	CREATE TABLE IF NOT EXISTS analysis_debug (
+		analysis_id INTEGER PRIMARY KEY,
+		prompt TEXT NOT NULL,
+		raw_response TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (analysis_id) REFERENCES analysis_results(id) ON DELETE CASCADE
+	)
+`
+
+// migrate applies pending migrations in order, stopping at the first failure
+func (db *DB) migrate() error {
+	_, err := db.writer.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		if err := db.applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+		}
+	}
+	return nil
+}
+
+// appliedMigrations returns the versions recorded in schema_migrations
+func (db *DB) appliedMigrations() (map[int]bool, error) {
+	rows, err := db.conn.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// applyMigration runs a migration and records it in one transaction
+func (db *DB) applyMigration(m migration) error {
+	tx, err := db.writer.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.apply(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, description) VALUES (?, ?)`, m.version, m.description); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// execStatements returns a migration step running each statement in turn
+func execStatements(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// addColumn adds a column unless the table already has it
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf(`SELECT name FROM pragma_table_info('%s')`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
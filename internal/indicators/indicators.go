@@ -0,0 +1,233 @@
+// Package indicators computes technical indicators and price levels from price history.
+//
+// Inputs are ordered oldest first. Outputs follow TA-Lib conventions: warm-up
+// values are dropped, so each result is shorter than its input and its last
+// element lines up with the last close.
+package indicators
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"stockmarket/internal/models"
+)
+
+// ErrInsufficientData is returned when there are fewer closes than an indicator's period needs
+var ErrInsufficientData = errors.New("not enough data for indicator period")
+
+// ErrInvalidPeriod is returned for periods below 1
+var ErrInvalidPeriod = errors.New("indicator period must be at least 1")
+
+// ErrNoVolume is returned by VWAP when none of the candles traded any volume
+var ErrNoVolume = errors.New("candles have no traded volume")
+
+// Standard MACD periods
+const (
+	MACDFast   = 12
+	MACDSlow   = 26
+	MACDSignal = 9
+)
+
+// SMA is the simple moving average over period closes
+func SMA(closes []float64, period int) ([]float64, error) {
+	if err := checkPeriod(len(closes), period); err != nil {
+		return nil, err
+	}
+
+	result := make([]float64, 0, len(closes)-period+1)
+	sum := 0.0
+	for i, c := range closes {
+		sum += c
+		if i >= period {
+			sum -= closes[i-period]
+		}
+		if i >= period-1 {
+			result = append(result, sum/float64(period))
+		}
+	}
+	return result, nil
+}
+
+// EMA is the exponential moving average over period closes, seeded with the SMA of
+// the first period closes
+func EMA(closes []float64, period int) ([]float64, error) {
+	if err := checkPeriod(len(closes), period); err != nil {
+		return nil, err
+	}
+	return ema(closes, period, mean(closes[:period])), nil
+}
+
+// RSI is Wilder's relative strength index over period closes
+func RSI(closes []float64, period int) ([]float64, error) {
+	if err := checkPeriod(len(closes)-1, period); err != nil {
+		return nil, err
+	}
+
+	var avgGain, avgLoss float64
+	for i := 1; i <= period; i++ {
+		gain, loss := change(closes[i-1], closes[i])
+		avgGain += gain
+		avgLoss += loss
+	}
+	avgGain /= float64(period)
+	avgLoss /= float64(period)
+
+	result := make([]float64, 0, len(closes)-period)
+	result = append(result, rsi(avgGain, avgLoss))
+	for i := period + 1; i < len(closes); i++ {
+		gain, loss := change(closes[i-1], closes[i])
+		avgGain = (avgGain*float64(period-1) + gain) / float64(period)
+		avgLoss = (avgLoss*float64(period-1) + loss) / float64(period)
+		result = append(result, rsi(avgGain, avgLoss))
+	}
+	return result, nil
+}
+
+// MACD computes the 12/26/9 MACD line, its signal line and the histogram. As in
+// TA-Lib, the fast EMA is seeded from the last 12 closes of the slow EMA's seed
+// window so both start on the same close, and all three results are aligned to
+// the signal line.
+func MACD(closes []float64) (macd, signal, hist []float64, err error) {
+	if err := checkPeriod(len(closes), MACDSlow+MACDSignal-1); err != nil {
+		return nil, nil, nil, err
+	}
+
+	start := MACDSlow - 1
+	slow := ema(closes, MACDSlow, mean(closes[:MACDSlow]))
+	fast := ema(closes[start-MACDFast+1:], MACDFast, mean(closes[start-MACDFast+1:start+1]))
+
+	line := make([]float64, len(slow))
+	for i := range slow {
+		line[i] = fast[i] - slow[i]
+	}
+
+	signal = ema(line, MACDSignal, mean(line[:MACDSignal]))
+	macd = line[MACDSignal-1:]
+	hist = make([]float64, len(signal))
+	for i := range signal {
+		hist[i] = macd[i] - signal[i]
+	}
+	return macd, signal, hist, nil
+}
+
+// VWAP is the volume-weighted average of each candle's typical price, (high+low+close)/3,
+// anchored to the session: it restarts on each new calendar day of the timestamps, so
+// a multi-day intraday series yields each day's own VWAP. Unlike the close-based
+// indicators there is no warm-up; bars before a session's first traded volume take
+// their own typical price.
+func VWAP(candles []models.Candle) ([]float64, error) {
+	if err := checkPeriod(len(candles), 1); err != nil {
+		return nil, err
+	}
+
+	result := make([]float64, len(candles))
+	var (
+		day         string
+		priceVolume float64
+		volume      int64
+		traded      bool
+	)
+	for i, c := range candles {
+		if d := c.Timestamp.Format("2006-01-02"); d != day {
+			day, priceVolume, volume = d, 0, 0
+		}
+		typical := (c.High + c.Low + c.Close) / 3
+		priceVolume += typical * float64(c.Volume)
+		volume += c.Volume
+		if volume == 0 {
+			result[i] = typical
+			continue
+		}
+		traded = true
+		result[i] = priceVolume / float64(volume)
+	}
+	if !traded {
+		return nil, ErrNoVolume
+	}
+	return result, nil
+}
+
+// Latest computes the most recent value of each standard indicator from candles in any
+// order. Indicators without enough history are left nil.
+func Latest(candles []models.Candle) *models.Indicators {
+	sorted := append([]models.Candle{}, candles...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+	closes := make([]float64, len(sorted))
+	for i, c := range sorted {
+		closes[i] = c.Close
+	}
+
+	var ind models.Indicators
+	ind.RSI14 = last(RSI(closes, 14))
+	ind.SMA20 = last(SMA(closes, 20))
+	ind.SMA50 = last(SMA(closes, 50))
+	ind.EMA12 = last(EMA(closes, MACDFast))
+	ind.EMA26 = last(EMA(closes, MACDSlow))
+	if macd, signal, hist, err := MACD(closes); err == nil {
+		ind.MACD = &macd[len(macd)-1]
+		ind.MACDSignal = &signal[len(signal)-1]
+		ind.MACDHist = &hist[len(hist)-1]
+	}
+	return &ind
+}
+
+// checkPeriod validates a period against the number of available values
+func checkPeriod(n, period int) error {
+	if period < 1 {
+		return ErrInvalidPeriod
+	}
+	if n < period {
+		return fmt.Errorf("%w: need %d values, have %d", ErrInsufficientData, period, max(n, 0))
+	}
+	return nil
+}
+
+// ema applies exponential smoothing from values[period-1] on, starting from seed
+func ema(values []float64, period int, seed float64) []float64 {
+	k := 2 / float64(period+1)
+	result := make([]float64, 0, len(values)-period+1)
+	result = append(result, seed)
+	prev := seed
+	for _, v := range values[period:] {
+		prev = (v-prev)*k + prev
+		result = append(result, prev)
+	}
+	return result
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// change splits a close-to-close move into its gain and loss parts
+func change(prev, cur float64) (gain, loss float64) {
+	d := cur - prev
+	if d > 0 {
+		return d, 0
+	}
+	return 0, -d
+}
+
+// rsi converts average gain and loss to an index value; a flat series is 0, as in TA-Lib
+func rsi(avgGain, avgLoss float64) float64 {
+	if avgGain+avgLoss == 0 {
+		return 0
+	}
+	return 100 * avgGain / (avgGain + avgLoss)
+}
+
+// last returns the final value of an indicator series, or nil if it failed
+func last(values []float64, err error) *float64 {
+	if err != nil || len(values) == 0 {
+		return nil
+	}
+	v := values[len(values)-1]
+	return &v
+}
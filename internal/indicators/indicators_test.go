@@ -0,0 +1,174 @@
+package indicators
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// approxEqual compares indicator values to their reference to 1e-6
+func approxEqual(t *testing.T, name string, got, want []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d values, want %d: %v", name, len(got), len(want), got)
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-6 {
+			t.Errorf("%s[%d] = %.6f, want %.6f", name, i, got[i], want[i])
+		}
+	}
+}
+
+func bar(ts time.Time, high, low, close float64, volume int64) models.Candle {
+	return models.Candle{Timestamp: ts, Open: close, High: high, Low: low, Close: close, Volume: volume}
+}
+
+func TestVWAP(t *testing.T) {
+	day1 := time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	// Typical prices 9, 10, 11 then 19 on the next day. The reference values are the
+	// running sums of typical*volume over volume: 900/100, 2900/300, 4000/400, and the
+	// second session restarting at 950/50.
+	candles := []models.Candle{
+		bar(day1, 10, 8, 9, 100),
+		bar(day1.Add(5*time.Minute), 11, 9, 10, 200),
+		bar(day1.Add(10*time.Minute), 12, 10, 11, 100),
+		bar(day2, 20, 18, 19, 50),
+	}
+	got, err := VWAP(candles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approxEqual(t, "VWAP", got, []float64{9, 29.0 / 3, 10, 19})
+}
+
+func TestVWAPLeadingZeroVolume(t *testing.T) {
+	start := time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+	candles := []models.Candle{
+		bar(start, 6, 3, 3, 0), // typical 4, no volume yet
+		bar(start.Add(time.Minute), 12, 6, 9, 10),
+		bar(start.Add(2*time.Minute), 6, 3, 3, 30),
+	}
+	got, err := VWAP(candles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approxEqual(t, "VWAP", got, []float64{4, 9, 5.25})
+}
+
+func TestVWAPNoVolume(t *testing.T) {
+	start := time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+	_, err := VWAP([]models.Candle{bar(start, 2, 1, 1.5, 0), bar(start.Add(time.Minute), 2, 1, 1.5, 0)})
+	if !errors.Is(err, ErrNoVolume) {
+		t.Fatalf("err = %v, want ErrNoVolume", err)
+	}
+	if _, err := VWAP(nil); !errors.Is(err, ErrInsufficientData) {
+		t.Fatalf("empty input: err = %v, want ErrInsufficientData", err)
+	}
+}
+
+// stockChartsCloses is the 30-day series from StockCharts' moving average worked example
+var stockChartsCloses = []float64{
+	22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29,
+	22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63,
+	23.82, 23.87, 23.65, 23.19, 23.10, 23.33, 22.68, 23.10, 22.40, 22.17,
+}
+
+func TestSMA(t *testing.T) {
+	got, err := SMA(stockChartsCloses, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approxEqual(t, "SMA", got, []float64{
+		22.221, 22.209, 22.229, 22.259, 22.303, 22.421, 22.613, 22.765, 22.905, 23.076,
+		23.21, 23.377, 23.525, 23.652, 23.71, 23.684, 23.612, 23.505, 23.432, 23.277, 23.131,
+	})
+}
+
+func TestEMA(t *testing.T) {
+	got, err := EMA(stockChartsCloses, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// StockCharts publishes these rounded to cents: 22.22, 22.21, 22.24, 22.27, ...
+	approxEqual(t, "EMA", got, []float64{
+		22.221, 22.208091, 22.241165, 22.266408, 22.328879, 22.516356, 22.7952, 22.9688,
+		23.125382, 23.275312, 23.339801, 23.42711, 23.507635, 23.53352, 23.471062,
+		23.403596, 23.390215, 23.261085, 23.231797, 23.080561, 22.915004,
+	})
+}
+
+func TestRSI(t *testing.T) {
+	// Wilder's 14-period example as used by StockCharts; TA-Lib gives 70.46 for the
+	// first value where the worked example, rounding as it goes, shows 70.53
+	closes := []float64{
+		44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+		45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+	}
+	got, err := RSI(closes, 14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approxEqual(t, "RSI", got, []float64{70.464135, 66.249619, 66.480942, 69.346853, 66.294713, 57.915021})
+
+	flat, err := RSI([]float64{5, 5, 5}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approxEqual(t, "RSI flat", flat, []float64{0})
+}
+
+func TestMACD(t *testing.T) {
+	closes := []float64{
+		100.0, 102.28, 104.44, 106.35, 107.93, 109.09, 109.78, 109.97, 109.67, 108.92,
+		107.79, 106.35, 104.73, 103.03, 101.39, 99.93, 98.75, 97.94, 97.58, 97.71,
+		98.33, 99.43, 100.96, 102.83, 104.96, 107.23, 109.52, 111.7, 113.66, 115.28,
+		116.5, 117.26, 117.51, 117.28, 116.59, 115.5, 114.1, 112.49, 110.8, 109.14,
+	}
+	macd, signal, hist, err := MACD(closes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approxEqual(t, "MACD", macd, []float64{2.714364, 2.898343, 2.922506, 2.79645, 2.537388, 2.170688, 1.726228})
+	approxEqual(t, "signal", signal, []float64{0.185413, 0.727999, 1.1669, 1.49281, 1.701726, 1.795518, 1.78166})
+	approxEqual(t, "hist", hist, []float64{2.528951, 2.170344, 1.755605, 1.30364, 0.835662, 0.37517, -0.055432})
+}
+
+func TestPeriodErrors(t *testing.T) {
+	closes := []float64{1, 2, 3}
+	if _, err := SMA(closes, 4); !errors.Is(err, ErrInsufficientData) {
+		t.Errorf("SMA: err = %v, want ErrInsufficientData", err)
+	}
+	if _, err := EMA(closes, 0); !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("EMA: err = %v, want ErrInvalidPeriod", err)
+	}
+	// RSI needs period changes, so period+1 closes
+	if _, err := RSI(closes, 3); !errors.Is(err, ErrInsufficientData) {
+		t.Errorf("RSI: err = %v, want ErrInsufficientData", err)
+	}
+	if _, _, _, err := MACD(make([]float64, MACDSlow+MACDSignal-2)); !errors.Is(err, ErrInsufficientData) {
+		t.Errorf("MACD: err = %v, want ErrInsufficientData", err)
+	}
+}
+
+func TestLatestShortHistory(t *testing.T) {
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	var candles []models.Candle
+	// newest first, as providers return them
+	for i := 29; i >= 0; i-- {
+		candles = append(candles, bar(start.AddDate(0, 0, i), stockChartsCloses[i], stockChartsCloses[i], stockChartsCloses[i], 100))
+	}
+	ind := Latest(candles)
+	if ind.SMA20 == nil || math.Abs(*ind.SMA20-mean(stockChartsCloses[10:])) > 1e-9 {
+		t.Errorf("SMA20 = %v, want the mean of the last 20 closes", ind.SMA20)
+	}
+	if ind.RSI14 == nil || ind.EMA26 == nil {
+		t.Errorf("RSI14 = %v, EMA26 = %v, want both set from 30 closes", ind.RSI14, ind.EMA26)
+	}
+	if ind.SMA50 != nil || ind.MACD != nil {
+		t.Errorf("SMA50 = %v, MACD = %v, want nil without enough history", ind.SMA50, ind.MACD)
+	}
+}
@@ -0,0 +1,138 @@
+package indicators
+
+import (
+	"math"
+	"sort"
+
+	"stockmarket/internal/models"
+)
+
+// pivotWindow is how many candles on each side a swing high/low must dominate
+const pivotWindow = 2
+
+// LevelClusterTolerance is how close (as a fraction of price) swing points must be
+// to merge into one support/resistance level
+var LevelClusterTolerance = 0.015
+
+// SwingLevels finds swing lows (support) and swing highs (resistance): candles whose
+// low/high is the most extreme within pivotWindow candles on either side. Candles
+// may be in any order.
+func SwingLevels(candles []models.Candle) (support, resistance []float64) {
+	sorted := append([]models.Candle{}, candles...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	for i := pivotWindow; i < len(sorted)-pivotWindow; i++ {
+		isLow, isHigh := true, true
+		for j := i - pivotWindow; j <= i+pivotWindow; j++ {
+			if j == i {
+				continue
+			}
+			if sorted[j].Low <= sorted[i].Low {
+				isLow = false
+			}
+			if sorted[j].High >= sorted[i].High {
+				isHigh = false
+			}
+		}
+		if isLow {
+			support = append(support, sorted[i].Low)
+		}
+		if isHigh {
+			resistance = append(resistance, sorted[i].High)
+		}
+	}
+	return support, resistance
+}
+
+// SupportResistance merges swing lows into support levels and swing highs into
+// resistance levels, clustering points within LevelClusterTolerance of each other.
+// Levels are ordered by touches (most significant first), then by price.
+func SupportResistance(candles []models.Candle) []models.PriceLevel {
+	support, resistance := SwingLevels(candles)
+	levels := append(clusterLevels("support", support), clusterLevels("resistance", resistance)...)
+	sort.SliceStable(levels, func(i, j int) bool {
+		if levels[i].Touches != levels[j].Touches {
+			return levels[i].Touches > levels[j].Touches
+		}
+		return levels[i].Price < levels[j].Price
+	})
+	return levels
+}
+
+// clusterLevels groups ascending prices whose distance from the running cluster mean
+// is within LevelClusterTolerance
+func clusterLevels(kind string, prices []float64) []models.PriceLevel {
+	sorted := append([]float64{}, prices...)
+	sort.Float64s(sorted)
+
+	var levels []models.PriceLevel
+	var sum float64
+	var count int
+	flush := func() {
+		if count > 0 {
+			levels = append(levels, models.PriceLevel{
+				Kind:    kind,
+				Price:   math.Round(sum/float64(count)*100) / 100,
+				Touches: count,
+			})
+		}
+		sum, count = 0, 0
+	}
+	for _, p := range sorted {
+		if count > 0 {
+			mean := sum / float64(count)
+			if p-mean > mean*LevelClusterTolerance {
+				flush()
+			}
+		}
+		sum += p
+		count++
+	}
+	flush()
+	return levels
+}
+
+// SuggestAlertLevels proposes alert levels for an analysis: its target and stop-loss,
+// plus the nearest support level below and resistance level above the current price.
+// Each suggestion's condition is the direction the price must move to reach it.
+func SuggestAlertLevels(currentPrice float64, targets models.PriceTargets, candles []models.Candle) []models.AlertSuggestion {
+	if currentPrice <= 0 {
+		return nil
+	}
+
+	var suggestions []models.AlertSuggestion
+	add := func(source string, price float64) {
+		if price <= 0 || price == currentPrice {
+			return
+		}
+		condition := "above"
+		if price < currentPrice {
+			condition = "below"
+		}
+		suggestions = append(suggestions, models.AlertSuggestion{
+			Source:    source,
+			Condition: condition,
+			Price:     math.Round(price*100) / 100,
+		})
+	}
+
+	add("target", targets.Target)
+	add("stop_loss", targets.StopLoss)
+
+	nearestSupport, nearestResistance := 0.0, math.Inf(1)
+	for _, level := range SupportResistance(candles) {
+		switch {
+		case level.Kind == "support" && level.Price < currentPrice && level.Price > nearestSupport:
+			nearestSupport = level.Price
+		case level.Kind == "resistance" && level.Price > currentPrice && level.Price < nearestResistance:
+			nearestResistance = level.Price
+		}
+	}
+	add("support", nearestSupport)
+	if !math.IsInf(nearestResistance, 1) {
+		add("resistance", nearestResistance)
+	}
+	return suggestions
+}
@@ -0,0 +1,100 @@
+package indicators
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// zigzag is a daily series with swing lows at 100 and 100.5 and swing highs at 110
+// and 115, oldest first
+func zigzag() []models.Candle {
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	bars := [][2]float64{
+		{106, 104}, {104, 102}, {102, 100}, {105, 103}, {108, 106}, {110, 108}, {107, 105},
+		{104, 102}, {102, 100.5}, {105, 103}, {108, 106}, {115, 113}, {108, 106}, {106, 104},
+	}
+	candles := make([]models.Candle, len(bars))
+	for i, b := range bars {
+		candles[i] = bar(start.AddDate(0, 0, i), b[0], b[1], (b[0]+b[1])/2, 100)
+	}
+	return candles
+}
+
+func TestSupportResistance(t *testing.T) {
+	want := []models.PriceLevel{
+		{Kind: "support", Price: 100.25, Touches: 2},
+		{Kind: "resistance", Price: 110, Touches: 1},
+		{Kind: "resistance", Price: 115, Touches: 1},
+	}
+	candles := zigzag()
+	if got := SupportResistance(candles); !reflect.DeepEqual(got, want) {
+		t.Errorf("SupportResistance = %+v, want %+v", got, want)
+	}
+
+	// providers return candles newest first; the levels don't depend on the order
+	slices.Reverse(candles)
+	if got := SupportResistance(candles); !reflect.DeepEqual(got, want) {
+		t.Errorf("newest first: SupportResistance = %+v, want %+v", got, want)
+	}
+}
+
+func TestSupportResistanceTolerance(t *testing.T) {
+	defer func(tolerance float64) { LevelClusterTolerance = tolerance }(LevelClusterTolerance)
+	LevelClusterTolerance = 0.05
+
+	want := []models.PriceLevel{
+		{Kind: "support", Price: 100.25, Touches: 2},
+		{Kind: "resistance", Price: 112.5, Touches: 2},
+	}
+	if got := SupportResistance(zigzag()); !reflect.DeepEqual(got, want) {
+		t.Errorf("SupportResistance = %+v, want %+v", got, want)
+	}
+}
+
+func TestSupportResistanceShortSeries(t *testing.T) {
+	// a swing point needs pivotWindow candles on each side
+	if got := SupportResistance(zigzag()[:2*pivotWindow]); len(got) != 0 {
+		t.Errorf("SupportResistance = %+v, want no levels", got)
+	}
+}
+
+func TestSuggestAlertLevels(t *testing.T) {
+	got := SuggestAlertLevels(107, models.PriceTargets{Entry: 107, Target: 120.004, StopLoss: 101}, zigzag())
+	want := []models.AlertSuggestion{
+		{Source: "target", Condition: "above", Price: 120},
+		{Source: "stop_loss", Condition: "below", Price: 101},
+		{Source: "support", Condition: "below", Price: 100.25},
+		{Source: "resistance", Condition: "above", Price: 110},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SuggestAlertLevels = %+v, want %+v", got, want)
+	}
+}
+
+func TestSuggestAlertLevelsOutsideRange(t *testing.T) {
+	// above every level there's no resistance to suggest, and a broken resistance isn't
+	// offered as support; missing targets are skipped
+	got := SuggestAlertLevels(130, models.PriceTargets{}, zigzag())
+	want := []models.AlertSuggestion{{Source: "support", Condition: "below", Price: 100.25}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SuggestAlertLevels = %+v, want %+v", got, want)
+	}
+
+	// a level at the current price needs no move to reach it
+	got = SuggestAlertLevels(110, models.PriceTargets{Target: 110}, zigzag())
+	want = []models.AlertSuggestion{
+		{Source: "support", Condition: "below", Price: 100.25},
+		{Source: "resistance", Condition: "above", Price: 115},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("at a level: SuggestAlertLevels = %+v, want %+v", got, want)
+	}
+
+	if got := SuggestAlertLevels(0, models.PriceTargets{Target: 120}, zigzag()); got != nil {
+		t.Errorf("no price: SuggestAlertLevels = %+v, want nil", got)
+	}
+}
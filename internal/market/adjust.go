@@ -0,0 +1,91 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// AdjustForSplits returns a copy of newest-first candles with AdjClose filled in. When
+// the provider already supplied adjusted closes they're kept as they are. Otherwise
+// closes before each of splits are scaled by its ratio; with no splits AdjClose
+// equals Close.
+func AdjustForSplits(candles []models.Candle, splits []models.Split) []models.Candle {
+	adjusted := make([]models.Candle, len(candles))
+	copy(adjusted, candles)
+	for _, c := range adjusted {
+		if c.AdjClose > 0 {
+			return adjusted
+		}
+	}
+
+	for i, c := range adjusted {
+		factor := 1.0
+		for _, split := range splits {
+			if split.Ratio > 0 && c.Timestamp.Before(split.Date) {
+				factor /= split.Ratio
+			}
+		}
+		adjusted[i].AdjClose = c.Close * factor
+	}
+	return adjusted
+}
+
+// AdjustedPrices returns a copy of candles with each bar's open, high, low and close
+// scaled by its AdjClose, so indicators see one continuous series across splits.
+// Candles without an AdjClose are left as they are.
+func AdjustedPrices(candles []models.Candle) []models.Candle {
+	adjusted := make([]models.Candle, len(candles))
+	for i, c := range candles {
+		if c.AdjClose > 0 && c.Close > 0 {
+			factor := c.AdjClose / c.Close
+			c.Open *= factor
+			c.High *= factor
+			c.Low *= factor
+			c.Close = c.AdjClose
+		}
+		adjusted[i] = c
+	}
+	return adjusted
+}
+
+// WithAdjClose fills in the AdjClose of candles p fetched for symbol, from the splits
+// p lists when it didn't adjust them itself. When p can't list splits, or the lookup
+// fails, AdjClose equals Close.
+func WithAdjClose(ctx context.Context, p Provider, symbol string, candles []models.Candle) []models.Candle {
+	for _, c := range candles {
+		if c.AdjClose > 0 {
+			return AdjustForSplits(candles, nil)
+		}
+	}
+
+	var splits []models.Split
+	if sp, ok := p.(SplitProvider); ok && len(candles) > 0 {
+		var err error
+		splits, err = sp.GetSplits(ctx, symbol)
+		if err != nil && !errors.Is(err, ErrNotSupported) {
+			slog.WarnContext(ctx, "market: split lookup failed, closes are unadjusted", "provider", p.Name(), "symbol", symbol, "error", err)
+		}
+	}
+	return AdjustForSplits(candles, splits)
+}
+
+// AdjustedHistory fetches candles like GetHistoricalData, adjusted for splits (and the
+// dividends the provider includes) with AdjustedPrices, for analyses and indicators
+func AdjustedHistory(ctx context.Context, p Provider, symbol string, period string, interval string) ([]models.Candle, error) {
+	candles, err := p.GetHistoricalData(ctx, symbol, period, interval)
+	if err != nil {
+		return nil, err
+	}
+	return AdjustedPrices(WithAdjClose(ctx, p, symbol, candles)), nil
+}
+
+// splitDate returns midnight on the exchange's calendar day of t, when a split
+// takes effect
+func splitDate(t time.Time) time.Time {
+	y, m, d := t.In(exchangeLocation).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, exchangeLocation)
+}
@@ -0,0 +1,125 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// splitLister is a provider with raw prices and a fixed split list
+type splitLister struct {
+	*Mock
+	splits []models.Split
+}
+
+func (s *splitLister) GetSplits(context.Context, string) ([]models.Split, error) {
+	return s.splits, nil
+}
+
+// dailyBars returns newest-first daily candles closing at closes, oldest first, from
+// 2024-06-05 on the exchange's calendar
+func dailyBars(closes ...float64) []models.Candle {
+	start := time.Date(2024, 6, 5, 0, 0, 0, 0, exchangeLocation)
+	candles := make([]models.Candle, len(closes))
+	for i, c := range closes {
+		candles[len(closes)-1-i] = models.Candle{Timestamp: start.AddDate(0, 0, i), Open: c, High: c + 1, Low: c - 1, Close: c}
+	}
+	return candles
+}
+
+func adjCloses(candles []models.Candle) []float64 {
+	out := make([]float64, len(candles))
+	for i, c := range candles {
+		out[i] = c.AdjClose
+	}
+	return out
+}
+
+func assertCloses(t *testing.T, name string, got, want []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %v, want %v", name, got, want)
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Fatalf("%s: got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestAdjustForSplits(t *testing.T) {
+	// 400, 404 before a 4-for-1 split on 2024-06-07, then 101, 102
+	candles := dailyBars(400, 404, 101, 102)
+	split := models.Split{Date: time.Date(2024, 6, 7, 0, 0, 0, 0, exchangeLocation), Ratio: 4}
+
+	assertCloses(t, "4-for-1", adjCloses(AdjustForSplits(candles, []models.Split{split})), []float64{102, 101, 101, 100})
+	assertCloses(t, "no splits", adjCloses(AdjustForSplits(candles, nil)), []float64{102, 101, 404, 400})
+
+	reverse := models.Split{Date: split.Date, Ratio: 0.1}
+	assertCloses(t, "1-for-10 reverse", adjCloses(AdjustForSplits(dailyBars(2, 3, 30, 31), []models.Split{reverse})), []float64{31, 30, 30, 20})
+
+	// A provider's own adjusted closes are kept, and the input is left alone
+	provided := dailyBars(10, 11)
+	provided[0].AdjClose, provided[1].AdjClose = 10.5, 9.5
+	assertCloses(t, "provider adjusted", adjCloses(AdjustForSplits(provided, []models.Split{split})), []float64{10.5, 9.5})
+	if candles[0].AdjClose != 0 {
+		t.Error("AdjustForSplits modified its input")
+	}
+}
+
+func TestAdjustedHistoryScalesPrices(t *testing.T) {
+	split := models.Split{Date: time.Date(2024, 6, 7, 0, 0, 0, 0, exchangeLocation), Ratio: 4}
+	p := &splitLister{Mock: NewMock(), splits: []models.Split{split}}
+
+	candles := AdjustedPrices(WithAdjClose(context.Background(), p, "AAPL", dailyBars(400, 404, 101, 102)))
+	assertCloses(t, "closes", []float64{candles[0].Close, candles[1].Close, candles[2].Close, candles[3].Close}, []float64{102, 101, 101, 100})
+	if oldest := candles[3]; oldest.Open != 100 || oldest.High != 100.25 || oldest.Low != 99.75 {
+		t.Errorf("pre-split bar = %+v, want open 100, high 100.25, low 99.75", oldest)
+	}
+	if newest := candles[0]; newest.Open != 102 || newest.High != 103 {
+		t.Errorf("post-split bar = %+v, want it unscaled", newest)
+	}
+
+	// Without a split list the closes are taken as they are
+	raw := WithAdjClose(context.Background(), NewMock(), "AAPL", dailyBars(400, 101))
+	assertCloses(t, "no split provider", adjCloses(raw), []float64{101, 400})
+}
+
+func TestPolygonGetSplits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/reference/splits" || r.URL.Query().Get("ticker") != "AAPL" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"status": "OK", "results": []map[string]any{
+			{"execution_date": "2020-08-31", "split_from": 1, "split_to": 4},
+			{"execution_date": "2014-06-09", "split_from": 1, "split_to": 7},
+		}})
+	}))
+	defer server.Close()
+	p := NewPolygon("key")
+	p.baseURL = server.URL
+
+	splits, err := p.GetSplits(context.Background(), "AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.Split{
+		{Date: time.Date(2020, 8, 31, 0, 0, 0, 0, exchangeLocation), Ratio: 4},
+		{Date: time.Date(2014, 6, 9, 0, 0, 0, 0, exchangeLocation), Ratio: 7},
+	}
+	if len(splits) != len(want) {
+		t.Fatalf("splits = %v, want %v", splits, want)
+	}
+	for i := range want {
+		if !splits[i].Date.Equal(want[i].Date) || splits[i].Ratio != want[i].Ratio {
+			t.Errorf("split %d = %v, want %v", i, splits[i], want[i])
+		}
+	}
+}
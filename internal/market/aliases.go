@@ -0,0 +1,36 @@
+package market
+
+import "strings"
+
+// DefaultSymbolAliases maps common company names to their ticker symbols
+var DefaultSymbolAliases = map[string]string{
+	"APPLE":     "AAPL",
+	"GOOGLE":    "GOOGL",
+	"ALPHABET":  "GOOGL",
+	"MICROSOFT": "MSFT",
+	"AMAZON":    "AMZN",
+	"FACEBOOK":  "META",
+	"TESLA":     "TSLA",
+	"NVIDIA":    "NVDA",
+	"NETFLIX":   "NFLX",
+	"BERKSHIRE": "BRK-B",
+	"COCACOLA":  "KO",
+	"DISNEY":    "DIS",
+	"INTEL":     "INTC",
+	"BITCOIN":   "BTC-USD",
+	"ETHEREUM":  "ETH-USD",
+}
+
+// ResolveSymbol maps an alias to its ticker. Custom aliases take precedence over the
+// defaults; when nothing matches the input is returned unchanged (upper-cased).
+func ResolveSymbol(input string, custom map[string]string) string {
+	symbol := strings.ToUpper(strings.TrimSpace(input))
+
+	if ticker, ok := custom[symbol]; ok && ticker != "" {
+		return strings.ToUpper(ticker)
+	}
+	if ticker, ok := DefaultSymbolAliases[symbol]; ok {
+		return ticker
+	}
+	return symbol
+}
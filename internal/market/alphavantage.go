@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -44,7 +45,7 @@ func (av *AlphaVantage) GetQuote(ctx context.Context, symbol string) (*models.Qu
 		return nil, err
 	}
 
-	resp, err := av.client.Do(req)
+	resp, err := doWithRetry(av.Name(), av.client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -88,8 +89,16 @@ func (av *AlphaVantage) GetQuote(ctx context.Context, symbol string) (*models.Qu
 	change, _ := strconv.ParseFloat(result.GlobalQuote.Change, 64)
 	changePercent, _ := strconv.ParseFloat(strings.TrimSuffix(result.GlobalQuote.ChangePercent, "%"), 64)
 
+	// GLOBAL_QUOTE only reports the (US/Eastern) trading day; treat a previous day's quote as of that day
+	timestamp := time.Now().In(exchangeLocation)
+	if day, err := time.ParseInLocation("2006-01-02", result.GlobalQuote.LatestTradingDay, exchangeLocation); err == nil &&
+		day.Format("2006-01-02") < timestamp.Format("2006-01-02") {
+		timestamp = day
+	}
+
 	return &models.Quote{
 		Symbol:        symbol,
+		Currency:      SymbolCurrency(symbol),
 		Price:         price,
 		Open:          open,
 		High:          high,
@@ -98,29 +107,58 @@ func (av *AlphaVantage) GetQuote(ctx context.Context, symbol string) (*models.Qu
 		PreviousClose: prevClose,
 		Change:        change,
 		ChangePercent: changePercent,
-		Timestamp:     time.Now(),
+		Timestamp:     normalizeTimestamp(av.Name(), timestamp),
 	}, nil
 }
 
+// GetQuotes fetches quotes for several symbols with a bounded concurrent fan-out
+func (av *AlphaVantage) GetQuotes(ctx context.Context, symbols []string) (map[string]models.Quote, error) {
+	return fanOutQuotes(ctx, symbols, av.GetQuote)
+}
+
+// alphaVantageIntervals maps intraday Intervals to Alpha Vantage series intervals
+var alphaVantageIntervals = map[string]string{
+	Interval1Min:  "1min",
+	Interval5Min:  "5min",
+	Interval15Min: "15min",
+	Interval1Hour: "60min",
+}
+
 // GetHistoricalData fetches historical OHLCV data
-func (av *AlphaVantage) GetHistoricalData(ctx context.Context, symbol string, period string) ([]models.Candle, error) {
+func (av *AlphaVantage) GetHistoricalData(ctx context.Context, symbol string, period string, interval string) ([]models.Candle, error) {
+	if err := ValidateInterval(av.Name(), period, interval); err != nil {
+		return nil, err
+	}
+
 	// Map period to Alpha Vantage function
 	function := "TIME_SERIES_DAILY"
 	outputSize := "compact" // 100 data points
+	barSize := "5min"
 
 	switch period {
 	case "1d", "5d":
 		function = "TIME_SERIES_INTRADAY"
 	case "1m", "3m":
 		outputSize = "compact"
-	case "1y", "5y":
+	case "6m", "1y", "5y":
+		outputSize = "full"
+	}
+	switch interval {
+	case "":
+	case Interval1Day:
+		function = "TIME_SERIES_DAILY"
+	default:
+		// A compact intraday series can be shorter than the period, so fetch the
+		// full month and trim it below
+		function = "TIME_SERIES_INTRADAY"
 		outputSize = "full"
+		barSize = alphaVantageIntervals[interval]
 	}
 
 	var url string
 	if function == "TIME_SERIES_INTRADAY" {
-		url = fmt.Sprintf("%s?function=%s&symbol=%s&interval=5min&outputsize=%s&apikey=%s",
-			alphaVantageBaseURL, function, symbol, outputSize, av.apiKey)
+		url = fmt.Sprintf("%s?function=%s&symbol=%s&interval=%s&outputsize=%s&apikey=%s",
+			alphaVantageBaseURL, function, symbol, barSize, outputSize, av.apiKey)
 	} else {
 		url = fmt.Sprintf("%s?function=%s&symbol=%s&outputsize=%s&apikey=%s",
 			alphaVantageBaseURL, function, symbol, outputSize, av.apiKey)
@@ -131,7 +169,7 @@ func (av *AlphaVantage) GetHistoricalData(ctx context.Context, symbol string, pe
 		return nil, err
 	}
 
-	resp, err := av.client.Do(req)
+	resp, err := doWithRetry(av.Name(), av.client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -172,13 +210,14 @@ func (av *AlphaVantage) GetHistoricalData(ctx context.Context, symbol string, pe
 			continue
 		}
 
-		// Parse timestamp
+		// Parse timestamp (Alpha Vantage reports US/Eastern local times)
 		var timestamp time.Time
 		if strings.Contains(dateStr, " ") {
-			timestamp, _ = time.Parse("2006-01-02 15:04:05", dateStr)
+			timestamp, _ = time.ParseInLocation("2006-01-02 15:04:05", dateStr, exchangeLocation)
 		} else {
-			timestamp, _ = time.Parse("2006-01-02", dateStr)
+			timestamp, _ = time.ParseInLocation("2006-01-02", dateStr, exchangeLocation)
 		}
+		timestamp = normalizeTimestamp(av.Name(), timestamp)
 
 		open, _ := strconv.ParseFloat(dataMap["1. open"].(string), 64)
 		high, _ := strconv.ParseFloat(dataMap["2. high"].(string), 64)
@@ -186,14 +225,20 @@ func (av *AlphaVantage) GetHistoricalData(ctx context.Context, symbol string, pe
 		close, _ := strconv.ParseFloat(dataMap["4. close"].(string), 64)
 		volume, _ := strconv.ParseInt(dataMap["5. volume"].(string), 10, 64)
 
-		candles = append(candles, models.Candle{
+		candle := models.Candle{
 			Timestamp: timestamp,
 			Open:      open,
 			High:      high,
 			Low:       low,
 			Close:     close,
 			Volume:    volume,
-		})
+		}
+		// Intraday series are split and dividend adjusted by default; the free daily
+		// series is raw and is adjusted by AdjustForSplits instead
+		if function == "TIME_SERIES_INTRADAY" {
+			candle.AdjClose = close
+		}
+		candles = append(candles, candle)
 	}
 
 	// Sort by timestamp (newest first) - O(n log n)
@@ -201,31 +246,285 @@ func (av *AlphaVantage) GetHistoricalData(ctx context.Context, symbol string, pe
 		return candles[i].Timestamp.After(candles[j].Timestamp)
 	})
 
+	if interval != "" {
+		candles = trimToPeriod(candles, period)
+	}
 	return candles, nil
 }
 
-// StreamQuotes streams real-time quotes (Alpha Vantage doesn't support real-time streaming in free tier)
-func (av *AlphaVantage) StreamQuotes(ctx context.Context, symbols []string, ch chan<- models.Quote) error {
-	// Alpha Vantage doesn't support WebSocket streaming, so we poll
-	ticker := time.NewTicker(15 * time.Second) // Rate limit friendly
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
-			for _, symbol := range symbols {
-				quote, err := av.GetQuote(ctx, symbol)
-				if err != nil {
-					continue // Skip on error
-				}
-				select {
-				case ch <- *quote:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-			}
+// GetEarningsTranscript fetches an earnings-call transcript for a quarter (e.g. "2024Q1")
+func (av *AlphaVantage) GetEarningsTranscript(ctx context.Context, symbol string, quarter string) (*models.EarningsTranscript, error) {
+	url := fmt.Sprintf("%s?function=EARNINGS_CALL_TRANSCRIPT&symbol=%s&quarter=%s&apikey=%s",
+		alphaVantageBaseURL, symbol, quarter, av.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doWithRetry(av.Name(), av.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Symbol     string `json:"symbol"`
+		Quarter    string `json:"quarter"`
+		Transcript []struct {
+			Speaker string `json:"speaker"`
+			Title   string `json:"title"`
+			Content string `json:"content"`
+		} `json:"transcript"`
+		Note        string `json:"Note"`
+		Information string `json:"Information"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if result.Note != "" && strings.Contains(result.Note, "API call frequency") {
+		return nil, ErrRateLimited
+	}
+	if len(result.Transcript) == 0 {
+		return nil, ErrInvalidSymbol
+	}
+
+	var sb strings.Builder
+	for _, part := range result.Transcript {
+		sb.WriteString(part.Speaker)
+		if part.Title != "" {
+			sb.WriteString(" (" + part.Title + ")")
+		}
+		sb.WriteString(": " + part.Content + "\n\n")
+	}
+
+	return &models.EarningsTranscript{
+		Symbol:     symbol,
+		Quarter:    quarter,
+		Transcript: strings.TrimSpace(sb.String()),
+		FetchedAt:  time.Now(),
+	}, nil
+}
+
+// GetFundamentals fetches dividend yield and payout ratio from the company overview and
+// derives the dividend growth streak from the dividend history. A failed history lookup
+// leaves the streak unset rather than failing the whole request.
+func (av *AlphaVantage) GetFundamentals(ctx context.Context, symbol string) (*models.Fundamentals, error) {
+	url := fmt.Sprintf("%s?function=OVERVIEW&symbol=%s&apikey=%s", alphaVantageBaseURL, symbol, av.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doWithRetry(av.Name(), av.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Symbol        string `json:"Symbol"`
+		DividendYield string `json:"DividendYield"` // fraction, e.g. "0.0044", or "None"
+		PayoutRatio   string `json:"PayoutRatio"`
+		Note          string `json:"Note"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if result.Note != "" && strings.Contains(result.Note, "API call frequency") {
+		return nil, ErrRateLimited
+	}
+	if result.Symbol == "" {
+		return nil, ErrInvalidSymbol
+	}
+
+	fundamentals := &models.Fundamentals{
+		Symbol:        symbol,
+		DividendYield: parsePercent(result.DividendYield),
+		PayoutRatio:   parsePercent(result.PayoutRatio),
+		FetchedAt:     time.Now(),
+	}
+	if years, err := av.dividendIncreaseYears(ctx, symbol); err == nil {
+		fundamentals.ConsecutiveIncreaseYears = &years
+	}
+	return fundamentals, nil
+}
+
+// dividendIncreaseYears counts consecutive completed calendar years in which the
+// total dividend paid rose over the prior year
+func (av *AlphaVantage) dividendIncreaseYears(ctx context.Context, symbol string) (int, error) {
+	url := fmt.Sprintf("%s?function=DIVIDENDS&symbol=%s&apikey=%s", alphaVantageBaseURL, symbol, av.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := doWithRetry(av.Name(), av.client, req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data []struct {
+			ExDividendDate string `json:"ex_dividend_date"`
+			Amount         string `json:"amount"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	if len(result.Data) == 0 {
+		return 0, ErrNotSupported
+	}
+
+	totals := make(map[int]float64)
+	for _, d := range result.Data {
+		date, err := time.Parse("2006-01-02", d.ExDividendDate)
+		if err != nil {
+			continue
 		}
+		amount, _ := strconv.ParseFloat(d.Amount, 64)
+		totals[date.Year()] += amount
+	}
+
+	// The current year is still in progress, so start from the last full year
+	years := 0
+	for year := time.Now().Year() - 1; totals[year-1] > 0 && totals[year] > totals[year-1]; year-- {
+		years++
+	}
+	return years, nil
+}
+
+// parsePercent converts an Alpha Vantage fraction string ("0.0250") to a percent,
+// returning nil for missing values ("None", "-")
+func parsePercent(s string) *float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	v *= 100
+	return &v
+}
+
+// GetMovers fetches the day's top gainers, losers or most actively traded US stocks
+func (av *AlphaVantage) GetMovers(ctx context.Context, moverType string) ([]models.Mover, error) {
+	url := fmt.Sprintf("%s?function=TOP_GAINERS_LOSERS&apikey=%s", alphaVantageBaseURL, av.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doWithRetry(av.Name(), av.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	type entry struct {
+		Ticker           string `json:"ticker"`
+		Price            string `json:"price"`
+		ChangeAmount     string `json:"change_amount"`
+		ChangePercentage string `json:"change_percentage"`
+		Volume           string `json:"volume"`
+	}
+	var result struct {
+		TopGainers         []entry `json:"top_gainers"`
+		TopLosers          []entry `json:"top_losers"`
+		MostActivelyTraded []entry `json:"most_actively_traded"`
+		Note               string  `json:"Note"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if result.Note != "" && strings.Contains(result.Note, "API call frequency") {
+		return nil, ErrRateLimited
+	}
+
+	var entries []entry
+	switch moverType {
+	case MoversGainers:
+		entries = result.TopGainers
+	case MoversLosers:
+		entries = result.TopLosers
+	case MoversMostActive:
+		entries = result.MostActivelyTraded
+	default:
+		return nil, ErrNotSupported
+	}
+
+	movers := make([]models.Mover, 0, len(entries))
+	for i, e := range entries {
+		price, _ := strconv.ParseFloat(e.Price, 64)
+		change, _ := strconv.ParseFloat(e.ChangeAmount, 64)
+		changePercent, _ := strconv.ParseFloat(strings.TrimSuffix(e.ChangePercentage, "%"), 64)
+		volume, _ := strconv.ParseInt(e.Volume, 10, 64)
+		movers = append(movers, models.Mover{
+			Rank:          i + 1,
+			Symbol:        e.Ticker,
+			Price:         price,
+			Change:        change,
+			ChangePercent: changePercent,
+			Volume:        volume,
+		})
+	}
+	return movers, nil
+}
+
+// SearchSymbols looks up tickers by symbol or company name with Alpha Vantage's symbol
+// search, which reports each match's region in place of its exchange
+func (av *AlphaVantage) SearchSymbols(ctx context.Context, query string) ([]models.SymbolMatch, error) {
+	searchURL := fmt.Sprintf("%s?function=SYMBOL_SEARCH&keywords=%s&apikey=%s", alphaVantageBaseURL, url.QueryEscape(query), av.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
+	if err != nil {
+		return nil, err
 	}
+
+	resp, err := doWithRetry(av.Name(), av.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		BestMatches []struct {
+			Symbol string `json:"1. symbol"`
+			Name   string `json:"2. name"`
+			Type   string `json:"3. type"`
+			Region string `json:"4. region"`
+		} `json:"bestMatches"`
+		Note string `json:"Note"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Note != "" && strings.Contains(result.Note, "API call frequency") {
+		return nil, ErrRateLimited
+	}
+
+	matches := make([]models.SymbolMatch, 0, len(result.BestMatches))
+	for _, m := range result.BestMatches {
+		matches = append(matches, models.SymbolMatch{
+			Symbol:   m.Symbol,
+			Name:     m.Name,
+			Exchange: m.Region,
+			Type:     matchType(m.Type),
+		})
+	}
+	return matches, nil
+}
+
+// StreamQuotes streams real-time quotes (Alpha Vantage doesn't support real-time streaming in free tier)
+func (av *AlphaVantage) StreamQuotes(ctx context.Context, sub *Subscription, ch chan<- models.Quote) error {
+	// Alpha Vantage doesn't support WebSocket streaming, so we poll
+	return pollQuotes(ctx, sub, pollIntervals[av.Name()], av.GetQuote, ch)
 }
@@ -0,0 +1,78 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"stockmarket/internal/models"
+)
+
+// batchQuoteWorkers bounds concurrent upstream requests when a provider has no batch endpoint
+const batchQuoteWorkers = 5
+
+// BatchError reports the symbols a GetQuotes call couldn't fetch. The quotes that
+// did succeed are still returned alongside it.
+type BatchError struct {
+	Errors map[string]error
+}
+
+func (e *BatchError) Error() string {
+	symbols := make([]string, 0, len(e.Errors))
+	for symbol := range e.Errors {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	parts := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		parts[i] = fmt.Sprintf("%s: %v", symbol, e.Errors[symbol])
+	}
+	return "failed to fetch " + strings.Join(parts, "; ")
+}
+
+// fanOutQuotes fetches quotes one symbol at a time with at most batchQuoteWorkers in
+// flight, for providers without an upstream batch endpoint. Symbols not started before
+// ctx is done fail with its error.
+func fanOutQuotes(ctx context.Context, symbols []string, getQuote func(context.Context, string) (*models.Quote, error)) (map[string]models.Quote, error) {
+	quotes := make(map[string]models.Quote, len(symbols))
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchQuoteWorkers)
+
+	for i, symbol := range symbols {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			wg.Wait()
+			for _, symbol := range symbols[i:] {
+				errs[symbol] = err
+			}
+			return quotes, &BatchError{Errors: errs}
+		}
+		wg.Add(1)
+		go func(symbol string) {
+			defer func() { <-sem; wg.Done() }()
+			quote, err := getQuote(ctx, symbol)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[symbol] = err
+				return
+			}
+			quotes[symbol] = *quote
+		}(symbol)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return quotes, &BatchError{Errors: errs}
+	}
+	return quotes, nil
+}
@@ -0,0 +1,55 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// TestFanOutQuotesCancelled checks that a cancelled batch stops waiting for a worker
+// slot and fails the symbols it never started
+func TestFanOutQuotesCancelled(t *testing.T) {
+	symbols := make([]string, 3*batchQuoteWorkers)
+	for i := range symbols {
+		symbols[i] = fmt.Sprintf("SYM%d", i)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{}, len(symbols))
+	block := func(ctx context.Context, symbol string) (*models.Quote, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := fanOutQuotes(ctx, symbols, block)
+		done <- err
+	}()
+	for range batchQuoteWorkers {
+		<-started
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		var batchErr *BatchError
+		if !errors.As(err, &batchErr) || len(batchErr.Errors) != len(symbols) {
+			t.Fatalf("err = %v, want every symbol failed", err)
+		}
+		for symbol, err := range batchErr.Errors {
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: err = %v, want context.Canceled", symbol, err)
+			}
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fanOutQuotes still blocked after its context was cancelled")
+	}
+	if len(started) > 0 {
+		t.Errorf("%d symbols started after cancellation", len(started))
+	}
+}
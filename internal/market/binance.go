@@ -0,0 +1,293 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// BinanceBaseURL is the Binance REST API root, set from config at startup (e.g. to
+// https://api.binance.us where binance.com is unavailable)
+var BinanceBaseURL = "https://api.binance.com"
+
+// binanceKlineLimit is the most candles Binance returns per klines request
+const binanceKlineLimit = 1000
+
+// Binance implements the Provider interface for crypto pairs from Binance's public
+// market data API, which needs no API key
+type Binance struct {
+	client *http.Client
+}
+
+// NewBinance creates a new Binance provider
+func NewBinance() *Binance {
+	return &Binance{
+		client: sharedHTTPClient,
+	}
+}
+
+// Name returns the provider name
+func (b *Binance) Name() string {
+	return "binance"
+}
+
+// binanceSymbol converts a pair like BTC-USD to Binance's BTCUSDT. Binance quotes
+// dollars in USDT, so USD pairs map to it.
+func binanceSymbol(symbol string) (string, error) {
+	if !IsCrypto(symbol) {
+		return "", fmt.Errorf("%w: %s is not a crypto pair", ErrInvalidSymbol, symbol)
+	}
+	base, quote, _ := strings.Cut(symbol, "-")
+	if quote == "USD" {
+		quote = "USDT"
+	}
+	return base + quote, nil
+}
+
+// binanceTicker is a 24-hour rolling window ticker; Binance sends numbers as strings
+type binanceTicker struct {
+	Symbol             string `json:"symbol"`
+	PriceChange        string `json:"priceChange"`
+	PriceChangePercent string `json:"priceChangePercent"`
+	LastPrice          string `json:"lastPrice"`
+	OpenPrice          string `json:"openPrice"`
+	HighPrice          string `json:"highPrice"`
+	LowPrice           string `json:"lowPrice"`
+	Volume             string `json:"volume"`
+	CloseTime          int64  `json:"closeTime"`
+}
+
+// quote converts the ticker to a quote for symbol. The 24-hour window's open stands in
+// for the previous close, as crypto has no session close.
+func (t binanceTicker) quote(provider, symbol string) models.Quote {
+	return models.Quote{
+		Symbol:        symbol,
+		Price:         binanceFloat(t.LastPrice),
+		Open:          binanceFloat(t.OpenPrice),
+		High:          binanceFloat(t.HighPrice),
+		Low:           binanceFloat(t.LowPrice),
+		Volume:        int64(binanceFloat(t.Volume)),
+		PreviousClose: binanceFloat(t.OpenPrice),
+		Change:        binanceFloat(t.PriceChange),
+		ChangePercent: binanceFloat(t.PriceChangePercent),
+		Timestamp:     normalizeTimestamp(provider, time.UnixMilli(t.CloseTime)),
+		Currency:      cryptoCurrency(symbol),
+	}
+}
+
+// binanceFloat parses one of Binance's string-encoded numbers, zero if malformed
+func binanceFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+// get sends a GET to a Binance endpoint and decodes the JSON reply into out
+func (b *Binance) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", BinanceBaseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := doWithRetry(b.Name(), b.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 418 means the IP was banned for ignoring 429s
+	if resp.StatusCode == 429 || resp.StatusCode == 418 {
+		return ErrRateLimited
+	}
+	if resp.StatusCode != 200 {
+		var apiErr struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Code == -1121 {
+			return ErrInvalidSymbol
+		}
+		if apiErr.Msg != "" {
+			return fmt.Errorf("%w: %s", ErrAPIError, apiErr.Msg)
+		}
+		return ErrAPIError
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// GetQuote fetches the current quote for a crypto pair
+func (b *Binance) GetQuote(ctx context.Context, symbol string) (*models.Quote, error) {
+	pair, err := binanceSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	var ticker binanceTicker
+	if err := b.get(ctx, "/api/v3/ticker/24hr", url.Values{"symbol": {pair}}, &ticker); err != nil {
+		return nil, err
+	}
+	quote := ticker.quote(b.Name(), symbol)
+	return &quote, nil
+}
+
+// GetQuotes fetches quotes for several pairs in one ticker request. Symbols that
+// aren't crypto pairs are reported in the *BatchError; one unknown pair fails the
+// whole request on Binance's side, so the batch then falls back to one request each.
+func (b *Binance) GetQuotes(ctx context.Context, symbols []string) (map[string]models.Quote, error) {
+	quotes := make(map[string]models.Quote, len(symbols))
+	errs := make(map[string]error)
+	bySymbol := make(map[string]string, len(symbols))
+	pairs := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		pair, err := binanceSymbol(symbol)
+		if err != nil {
+			errs[symbol] = err
+			continue
+		}
+		bySymbol[pair] = symbol
+		pairs = append(pairs, pair)
+	}
+
+	if len(pairs) > 0 {
+		encoded, _ := json.Marshal(pairs)
+		var tickers []binanceTicker
+		err := b.get(ctx, "/api/v3/ticker/24hr", url.Values{"symbols": {string(encoded)}}, &tickers)
+		if errors.Is(err, ErrInvalidSymbol) {
+			valid := make([]string, 0, len(pairs))
+			for _, pair := range pairs {
+				valid = append(valid, bySymbol[pair])
+			}
+			got, fanErr := fanOutQuotes(ctx, valid, b.GetQuote)
+			for symbol, quote := range got {
+				quotes[symbol] = quote
+			}
+			var batchErr *BatchError
+			if errors.As(fanErr, &batchErr) {
+				for symbol, symbolErr := range batchErr.Errors {
+					errs[symbol] = symbolErr
+				}
+			}
+		} else if err != nil {
+			if len(errs) == 0 {
+				return nil, err
+			}
+			for _, pair := range pairs {
+				errs[bySymbol[pair]] = err
+			}
+		} else {
+			for _, ticker := range tickers {
+				if symbol, ok := bySymbol[ticker.Symbol]; ok {
+					quotes[symbol] = ticker.quote(b.Name(), symbol)
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return quotes, &BatchError{Errors: errs}
+	}
+	return quotes, nil
+}
+
+// binanceIntervals maps Intervals to Binance kline intervals
+var binanceIntervals = map[string]string{
+	Interval1Min:  "1m",
+	Interval5Min:  "5m",
+	Interval15Min: "15m",
+	Interval1Hour: "1h",
+	Interval1Day:  "1d",
+}
+
+// GetHistoricalData fetches historical OHLCV data for a crypto pair. Bar sizes follow
+// Yahoo's: 1d (5m bars), 5d (15m bars), 1m through 1y (daily bars) and 5y (weekly
+// bars), with anything else falling back to one month of daily bars. A non-empty
+// interval overrides the bar size. Long ranges are fetched a page at a time.
+func (b *Binance) GetHistoricalData(ctx context.Context, symbol string, period string, barInterval string) ([]models.Candle, error) {
+	if err := ValidateInterval(b.Name(), period, barInterval); err != nil {
+		return nil, err
+	}
+	pair, err := binanceSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := "1d"
+	switch period {
+	case "1d":
+		interval = "5m"
+	case "5d":
+		interval = "15m"
+	case "5y":
+		interval = "1w"
+	}
+	if barInterval != "" {
+		interval = binanceIntervals[barInterval]
+	}
+	length, ok := periodLengths[period]
+	if !ok {
+		length = periodLengths["1m"]
+	}
+
+	var candles []models.Candle
+	start := time.Now().Add(-length).UnixMilli()
+	for {
+		var klines [][]json.RawMessage
+		query := url.Values{
+			"symbol":    {pair},
+			"interval":  {interval},
+			"startTime": {strconv.FormatInt(start, 10)},
+			"limit":     {strconv.Itoa(binanceKlineLimit)},
+		}
+		if err := b.get(ctx, "/api/v3/klines", query, &klines); err != nil {
+			return nil, err
+		}
+
+		for _, k := range klines {
+			// [open time, open, high, low, close, volume, close time, ...]
+			if len(k) < 6 {
+				continue
+			}
+			var openTime int64
+			var open, high, low, close_, volume string
+			if json.Unmarshal(k[0], &openTime) != nil || json.Unmarshal(k[1], &open) != nil ||
+				json.Unmarshal(k[2], &high) != nil || json.Unmarshal(k[3], &low) != nil ||
+				json.Unmarshal(k[4], &close_) != nil || json.Unmarshal(k[5], &volume) != nil {
+				return nil, ErrAPIError
+			}
+			candles = append(candles, models.Candle{
+				Timestamp: normalizeTimestamp(b.Name(), time.UnixMilli(openTime)),
+				Open:      binanceFloat(open),
+				High:      binanceFloat(high),
+				Low:       binanceFloat(low),
+				Close:     binanceFloat(close_),
+				Volume:    int64(binanceFloat(volume)),
+			})
+			start = openTime + 1
+		}
+		if len(klines) < binanceKlineLimit {
+			break
+		}
+	}
+	if len(candles) == 0 {
+		return nil, ErrInvalidSymbol
+	}
+
+	// Reverse to get newest first
+	for i, j := 0, len(candles)-1; i < j; i, j = i+1, j-1 {
+		candles[i], candles[j] = candles[j], candles[i]
+	}
+
+	return candles, nil
+}
+
+// StreamQuotes streams real-time quotes via polling
+func (b *Binance) StreamQuotes(ctx context.Context, sub *Subscription, ch chan<- models.Quote) error {
+	return pollQuotes(ctx, sub, pollIntervals[b.Name()], b.GetQuote, ch)
+}
@@ -0,0 +1,254 @@
+package market
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// CacheStats are hit/miss counts of a quote cache
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+type cachedQuote struct {
+	quote     models.Quote
+	fetchedAt time.Time
+}
+
+type cachedFundamentals struct {
+	fundamentals models.Fundamentals
+	fetchedAt    time.Time
+}
+
+type cachedCandles struct {
+	candles   []models.Candle
+	fetchedAt time.Time
+}
+
+// QuoteCache is a TTL store for quotes, historical data and fundamentals, keyed
+// by provider and symbol. It is safe for concurrent use and is shared by the CachingProvider
+// wrappers built per request, so repeated calls hit the upstream API once per TTL.
+type QuoteCache struct {
+	quoteTTL        time.Duration
+	historyTTL      time.Duration
+	fundamentalsTTL time.Duration
+
+	quotes       map[string]cachedQuote
+	history      map[string]cachedCandles
+	fundamentals map[string]cachedFundamentals
+	mu           sync.Mutex
+
+	historyStore HistoryStore // persists historical data behind the in-memory copy; nil for none
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewQuoteCache creates a cache; a zero TTL disables caching for that data
+func NewQuoteCache(quoteTTL, historyTTL, fundamentalsTTL time.Duration) *QuoteCache {
+	return &QuoteCache{
+		quoteTTL:        quoteTTL,
+		historyTTL:      historyTTL,
+		fundamentalsTTL: fundamentalsTTL,
+		quotes:          make(map[string]cachedQuote),
+		history:         make(map[string]cachedCandles),
+		fundamentals:    make(map[string]cachedFundamentals),
+	}
+}
+
+// Stats returns the cache's hit/miss counts
+func (c *QuoteCache) Stats() CacheStats {
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// CachingProvider is a Provider that serves quotes, historical data and fundamentals from a
+// QuoteCache when fresh, falling through to the wrapped provider otherwise
+type CachingProvider struct {
+	Provider
+	cache *QuoteCache
+}
+
+// NewCachingProvider wraps a provider with a shared cache
+func NewCachingProvider(p Provider, cache *QuoteCache) *CachingProvider {
+	return &CachingProvider{Provider: p, cache: cache}
+}
+
+// Stats returns the shared cache's hit/miss counts
+func (cp *CachingProvider) Stats() CacheStats {
+	return cp.cache.Stats()
+}
+
+// GetQuote returns a cached quote younger than the quote TTL, fetching it otherwise
+func (cp *CachingProvider) GetQuote(ctx context.Context, symbol string) (*models.Quote, error) {
+	c := cp.cache
+	if c.quoteTTL <= 0 {
+		return cp.Provider.GetQuote(ctx, symbol)
+	}
+
+	key := cp.Name() + ":" + symbol
+	c.mu.Lock()
+	entry, ok := c.quotes[key]
+	c.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < c.quoteTTL {
+		c.hits.Add(1)
+		quote := entry.quote
+		return &quote, nil
+	}
+	c.misses.Add(1)
+
+	quote, err := cp.Provider.GetQuote(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.quotes[key] = cachedQuote{quote: *quote, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return quote, nil
+}
+
+// GetQuotes serves fresh symbols from the cache and batch-fetches the rest
+func (cp *CachingProvider) GetQuotes(ctx context.Context, symbols []string) (map[string]models.Quote, error) {
+	c := cp.cache
+	if c.quoteTTL <= 0 {
+		return cp.Provider.GetQuotes(ctx, symbols)
+	}
+
+	quotes := make(map[string]models.Quote, len(symbols))
+	var missing []string
+	c.mu.Lock()
+	for _, symbol := range symbols {
+		entry, ok := c.quotes[cp.Name()+":"+symbol]
+		if ok && time.Since(entry.fetchedAt) < c.quoteTTL {
+			quotes[symbol] = entry.quote
+		} else {
+			missing = append(missing, symbol)
+		}
+	}
+	c.mu.Unlock()
+	c.hits.Add(uint64(len(quotes)))
+	if len(missing) == 0 {
+		return quotes, nil
+	}
+	c.misses.Add(uint64(len(missing)))
+
+	fetched, err := cp.Provider.GetQuotes(ctx, missing)
+	now := time.Now()
+	c.mu.Lock()
+	for symbol, quote := range fetched {
+		c.quotes[cp.Name()+":"+symbol] = cachedQuote{quote: quote, fetchedAt: now}
+		quotes[symbol] = quote
+	}
+	c.mu.Unlock()
+	return quotes, err
+}
+
+// GetHistoricalData returns cached candles younger than the historical TTL, otherwise
+// those of the history store brought up to date, or fetched ones without a store.
+// WithForceRefresh skips both.
+func (cp *CachingProvider) GetHistoricalData(ctx context.Context, symbol string, period string, interval string) ([]models.Candle, error) {
+	c := cp.cache
+	fetch := cp.Provider.GetHistoricalData
+	if c.historyStore != nil {
+		fetch = cp.persistedHistory
+	}
+	if c.historyTTL <= 0 {
+		return fetch(ctx, symbol, period, interval)
+	}
+
+	key := cp.Name() + ":" + symbol + ":" + period + ":" + interval
+	c.mu.Lock()
+	entry, ok := c.history[key]
+	c.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < c.historyTTL && !forceRefresh(ctx) {
+		c.hits.Add(1)
+		return append([]models.Candle{}, entry.candles...), nil
+	}
+	c.misses.Add(1)
+
+	candles, err := fetch(ctx, symbol, period, interval)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.history[key] = cachedCandles{candles: append([]models.Candle{}, candles...), fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return candles, nil
+}
+
+// GetMovers passes through to the wrapped provider's screener
+func (cp *CachingProvider) GetMovers(ctx context.Context, moverType string) ([]models.Mover, error) {
+	if mp, ok := cp.Provider.(MoversProvider); ok {
+		return mp.GetMovers(ctx, moverType)
+	}
+	return nil, ErrNotSupported
+}
+
+// SearchSymbols passes through to the wrapped provider's symbol search
+func (cp *CachingProvider) SearchSymbols(ctx context.Context, query string) ([]models.SymbolMatch, error) {
+	if ss, ok := cp.Provider.(SymbolSearcher); ok {
+		return ss.SearchSymbols(ctx, query)
+	}
+	return nil, ErrNotSupported
+}
+
+// StreamTrades passes through to the wrapped provider's trades feed
+func (cp *CachingProvider) StreamTrades(ctx context.Context, symbols []string, ch chan<- models.Trade) error {
+	if tp, ok := cp.Provider.(TradeProvider); ok {
+		return tp.StreamTrades(ctx, symbols, ch)
+	}
+	return ErrNotSupported
+}
+
+// GetEarningsTranscript passes through to the wrapped provider's transcripts
+func (cp *CachingProvider) GetEarningsTranscript(ctx context.Context, symbol string, quarter string) (*models.EarningsTranscript, error) {
+	if tp, ok := cp.Provider.(TranscriptProvider); ok {
+		return tp.GetEarningsTranscript(ctx, symbol, quarter)
+	}
+	return nil, ErrNotSupported
+}
+
+// GetSplits passes through to the wrapped provider's split list
+func (cp *CachingProvider) GetSplits(ctx context.Context, symbol string) ([]models.Split, error) {
+	if sp, ok := cp.Provider.(SplitProvider); ok {
+		return sp.GetSplits(ctx, symbol)
+	}
+	return nil, ErrNotSupported
+}
+
+// GetFundamentals returns cached fundamentals younger than the fundamentals TTL,
+// fetching them from the wrapped provider otherwise
+func (cp *CachingProvider) GetFundamentals(ctx context.Context, symbol string) (*models.Fundamentals, error) {
+	fp, ok := cp.Provider.(FundamentalsProvider)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	c := cp.cache
+	if c.fundamentalsTTL <= 0 {
+		return fp.GetFundamentals(ctx, symbol)
+	}
+
+	key := cp.Name() + ":" + symbol
+	c.mu.Lock()
+	entry, ok := c.fundamentals[key]
+	c.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < c.fundamentalsTTL {
+		c.hits.Add(1)
+		fundamentals := entry.fundamentals
+		return &fundamentals, nil
+	}
+	c.misses.Add(1)
+
+	fundamentals, err := fp.GetFundamentals(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.fundamentals[key] = cachedFundamentals{fundamentals: *fundamentals, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return fundamentals, nil
+}
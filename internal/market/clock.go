@@ -0,0 +1,41 @@
+package market
+
+import (
+	"log/slog"
+	"time"
+	_ "time/tzdata" // exchange timezones must resolve even without system zoneinfo
+)
+
+// ClockSkewThreshold is how far in the future a provider timestamp may be before
+// the skew is logged. It is set from config at startup.
+var ClockSkewThreshold = 5 * time.Second
+
+// exchangeLocation is the US exchange timezone used by providers that report local times
+var exchangeLocation = mustLoadLocation("America/New_York")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// normalizeTimestamp converts a provider timestamp to UTC and clamps timestamps in
+// the future to now, so staleness checks don't treat a skewed clock as fresh data
+func normalizeTimestamp(provider string, t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+
+	t = t.UTC()
+	now := time.Now().UTC()
+	if skew := t.Sub(now); skew > 0 {
+		if skew > ClockSkewThreshold {
+			slog.Warn("provider timestamp is in the future, clamping to now",
+				"provider", provider, "timestamp", t.Format(time.RFC3339), "skew", skew.Round(time.Second))
+		}
+		return now
+	}
+	return t
+}
@@ -0,0 +1,195 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"stockmarket/internal/models"
+)
+
+// CryptoExchange is the exchange name of crypto pairs, which trade around the clock
+const CryptoExchange = "CRYPTO"
+
+// cryptoQuoteCurrencies are the quote currencies that mark a BASE-QUOTE symbol as a
+// crypto pair, e.g. BTC-USD or ETH-BTC
+var cryptoQuoteCurrencies = []string{"USD", "USDT", "USDC", "EUR", "BTC", "ETH"}
+
+// IsCrypto reports whether symbol is a crypto pair like BTC-USD. Share classes such as
+// BRK-B don't match, as their suffix isn't a quote currency.
+func IsCrypto(symbol string) bool {
+	base, quote, ok := strings.Cut(strings.ToUpper(symbol), "-")
+	return ok && base != "" && base != quote && slices.Contains(cryptoQuoteCurrencies, quote)
+}
+
+// SymbolExchange returns the exchange whose hours apply to symbol: CryptoExchange for
+// crypto pairs and DefaultExchange otherwise
+func SymbolExchange(symbol string) string {
+	if IsCrypto(symbol) {
+		return CryptoExchange
+	}
+	return DefaultExchange
+}
+
+// CryptoRouter is a Provider that serves crypto pairs from a crypto provider and
+// everything else from the primary provider
+type CryptoRouter struct {
+	primary Provider
+	crypto  Provider
+}
+
+// NewCryptoRouter routes crypto symbols to crypto and the rest to primary
+func NewCryptoRouter(primary, crypto Provider) *CryptoRouter {
+	return &CryptoRouter{primary: primary, crypto: crypto}
+}
+
+// Name returns the primary provider's name
+func (r *CryptoRouter) Name() string {
+	return r.primary.Name()
+}
+
+// providerFor returns the provider that serves symbol
+func (r *CryptoRouter) providerFor(symbol string) Provider {
+	if IsCrypto(symbol) {
+		return r.crypto
+	}
+	return r.primary
+}
+
+// splitSymbols separates crypto pairs from other symbols
+func splitSymbols(symbols []string) (stocks, crypto []string) {
+	for _, symbol := range symbols {
+		if IsCrypto(symbol) {
+			crypto = append(crypto, symbol)
+		} else {
+			stocks = append(stocks, symbol)
+		}
+	}
+	return stocks, crypto
+}
+
+// GetQuote fetches a quote from the provider that serves symbol
+func (r *CryptoRouter) GetQuote(ctx context.Context, symbol string) (*models.Quote, error) {
+	return r.providerFor(symbol).GetQuote(ctx, symbol)
+}
+
+// GetQuotes batch-fetches stocks and crypto pairs from their providers, merging the
+// results and any *BatchError failures
+func (r *CryptoRouter) GetQuotes(ctx context.Context, symbols []string) (map[string]models.Quote, error) {
+	stocks, crypto := splitSymbols(symbols)
+	if len(crypto) == 0 {
+		return r.primary.GetQuotes(ctx, stocks)
+	}
+	if len(stocks) == 0 {
+		return r.crypto.GetQuotes(ctx, crypto)
+	}
+
+	quotes := make(map[string]models.Quote, len(symbols))
+	errs := make(map[string]error)
+	for _, batch := range []struct {
+		provider Provider
+		symbols  []string
+	}{{r.primary, stocks}, {r.crypto, crypto}} {
+		got, err := batch.provider.GetQuotes(ctx, batch.symbols)
+		for symbol, quote := range got {
+			quotes[symbol] = quote
+		}
+		var batchErr *BatchError
+		switch {
+		case errors.As(err, &batchErr):
+			for symbol, symbolErr := range batchErr.Errors {
+				errs[symbol] = symbolErr
+			}
+		case err != nil:
+			for _, symbol := range batch.symbols {
+				errs[symbol] = err
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return quotes, &BatchError{Errors: errs}
+	}
+	return quotes, nil
+}
+
+// GetHistoricalData fetches candles from the provider that serves symbol
+func (r *CryptoRouter) GetHistoricalData(ctx context.Context, symbol string, period string, interval string) ([]models.Candle, error) {
+	return r.providerFor(symbol).GetHistoricalData(ctx, symbol, period, interval)
+}
+
+// StreamQuotes runs the primary and crypto streams side by side, each on its share of
+// the subscription, re-splitting the symbols whenever the subscription changes
+func (r *CryptoRouter) StreamQuotes(ctx context.Context, sub *Subscription, ch chan<- models.Quote) error {
+	stocks, crypto := splitSymbols(sub.Symbols())
+	stockSub, cryptoSub := sub.split(stocks), sub.split(crypto)
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return r.primary.StreamQuotes(ctx, stockSub, ch) })
+	g.Go(func() error { return r.crypto.StreamQuotes(ctx, cryptoSub, ch) })
+	g.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-sub.changed:
+				stocks, crypto := splitSymbols(sub.Symbols())
+				stockSub.Set(stocks)
+				cryptoSub.Set(crypto)
+			}
+		}
+	})
+	return g.Wait()
+}
+
+// GetMovers passes through to the primary provider's screener
+func (r *CryptoRouter) GetMovers(ctx context.Context, moverType string) ([]models.Mover, error) {
+	if mp, ok := r.primary.(MoversProvider); ok {
+		return mp.GetMovers(ctx, moverType)
+	}
+	return nil, ErrNotSupported
+}
+
+// SearchSymbols passes through to the primary provider's symbol search
+func (r *CryptoRouter) SearchSymbols(ctx context.Context, query string) ([]models.SymbolMatch, error) {
+	if ss, ok := r.primary.(SymbolSearcher); ok {
+		return ss.SearchSymbols(ctx, query)
+	}
+	return nil, ErrNotSupported
+}
+
+// StreamTrades passes through to the primary provider's trades feed
+func (r *CryptoRouter) StreamTrades(ctx context.Context, symbols []string, ch chan<- models.Trade) error {
+	if tp, ok := r.primary.(TradeProvider); ok {
+		return tp.StreamTrades(ctx, symbols, ch)
+	}
+	return ErrNotSupported
+}
+
+// GetEarningsTranscript passes stock symbols through to the primary provider; crypto
+// pairs have no earnings calls
+func (r *CryptoRouter) GetEarningsTranscript(ctx context.Context, symbol string, quarter string) (*models.EarningsTranscript, error) {
+	if tp, ok := r.primary.(TranscriptProvider); ok && !IsCrypto(symbol) {
+		return tp.GetEarningsTranscript(ctx, symbol, quarter)
+	}
+	return nil, ErrNotSupported
+}
+
+// GetSplits passes stock symbols through to the primary provider; crypto pairs don't split
+func (r *CryptoRouter) GetSplits(ctx context.Context, symbol string) ([]models.Split, error) {
+	if sp, ok := r.primary.(SplitProvider); ok && !IsCrypto(symbol) {
+		return sp.GetSplits(ctx, symbol)
+	}
+	return nil, ErrNotSupported
+}
+
+// GetFundamentals passes stock symbols through to the primary provider; crypto pairs
+// pay no dividends
+func (r *CryptoRouter) GetFundamentals(ctx context.Context, symbol string) (*models.Fundamentals, error) {
+	if fp, ok := r.primary.(FundamentalsProvider); ok && !IsCrypto(symbol) {
+		return fp.GetFundamentals(ctx, symbol)
+	}
+	return nil, ErrNotSupported
+}
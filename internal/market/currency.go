@@ -0,0 +1,94 @@
+package market
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is assumed for quotes whose provider doesn't report a currency
+const DefaultCurrency = "USD"
+
+// currencyFormat is how amounts in one currency are written
+type currencyFormat struct {
+	prefix, suffix string
+	decimals       int
+}
+
+// currencyFormats maps the currency codes providers report to their symbols. GBp (also
+// reported as GBX) is pence sterling, which LSE prices are quoted in. Other codes are
+// written after the amount, e.g. "12.34 SEK".
+var currencyFormats = map[string]currencyFormat{
+	"USD": {prefix: "$", decimals: 2},
+	"GBP": {prefix: "£", decimals: 2},
+	"GBp": {suffix: "p", decimals: 2},
+	"GBX": {suffix: "p", decimals: 2},
+	"EUR": {prefix: "€", decimals: 2},
+	"JPY": {prefix: "¥", decimals: 0},
+	"AUD": {prefix: "A$", decimals: 2},
+	"CAD": {prefix: "CA$", decimals: 2},
+	"HKD": {prefix: "HK$", decimals: 2},
+	"INR": {prefix: "₹", decimals: 2},
+	"BTC": {suffix: " BTC", decimals: 8},
+	"ETH": {suffix: " ETH", decimals: 8},
+}
+
+// FormatPrice writes amount in currency with its symbol and decimal places, e.g.
+// "£12.34" for GBP or "1234.50p" for GBp; an empty currency is DefaultCurrency
+func FormatPrice(amount float64, currency string) string {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	format, ok := currencyFormats[currency]
+	if !ok {
+		format, ok = currencyFormats[strings.ToUpper(currency)]
+	}
+	if !ok {
+		format = currencyFormat{suffix: " " + strings.ToUpper(currency), decimals: 2}
+	}
+
+	number := strconv.FormatFloat(amount, 'f', format.decimals, 64)
+	if rest, negative := strings.CutPrefix(number, "-"); negative {
+		return "-" + format.prefix + rest + format.suffix
+	}
+	return format.prefix + number + format.suffix
+}
+
+// suffixCurrencies are the currencies of listings on exchanges written with a symbol
+// suffix, e.g. VOD.L in pence on the LSE
+var suffixCurrencies = map[string]string{
+	".L":  "GBp",
+	".TO": "CAD",
+	".V":  "CAD",
+	".AX": "AUD",
+	".T":  "JPY",
+	".HK": "HKD",
+	".NS": "INR",
+	".BO": "INR",
+	".DE": "EUR",
+	".PA": "EUR",
+	".AS": "EUR",
+	".MI": "EUR",
+	".MC": "EUR",
+}
+
+// SymbolCurrency is the currency a symbol's prices are in when its provider doesn't
+// report one: a crypto pair's quote currency, the currency of the exchange its suffix
+// names, or DefaultCurrency
+func SymbolCurrency(symbol string) string {
+	if IsCrypto(symbol) {
+		return cryptoCurrency(symbol)
+	}
+	if i := strings.LastIndex(symbol, "."); i > 0 {
+		if currency, ok := suffixCurrencies[strings.ToUpper(symbol[i:])]; ok {
+			return currency
+		}
+	}
+	return DefaultCurrency
+}
+
+// cryptoCurrency returns the quote currency of a crypto pair like BTC-USD, which its
+// prices are in
+func cryptoCurrency(symbol string) string {
+	_, quote, _ := strings.Cut(strings.ToUpper(symbol), "-")
+	return quote
+}
@@ -0,0 +1,38 @@
+package market
+
+import "testing"
+
+func TestFormatPrice(t *testing.T) {
+	for _, c := range []struct {
+		amount   float64
+		currency string
+		want     string
+	}{
+		{12.345, "GBP", "£12.35"},
+		{-3.5, "GBP", "-£3.50"},
+		{1234.5, "GBp", "1234.50p"},
+		{1234.5, "GBX", "1234.50p"},
+		{187.2, "USD", "$187.20"},
+		{187.2, "", "$187.20"},
+		{12.5, "SEK", "12.50 SEK"},
+	} {
+		if got := FormatPrice(c.amount, c.currency); got != c.want {
+			t.Errorf("FormatPrice(%v, %q) = %q, want %q", c.amount, c.currency, got, c.want)
+		}
+	}
+}
+
+func TestSymbolCurrency(t *testing.T) {
+	for symbol, want := range map[string]string{
+		"VOD.L":   "GBp",
+		"vod.l":   "GBp",
+		"BHP.AX":  "AUD",
+		"AAPL":    "USD",
+		"BRK.B":   "USD",
+		"BTC-EUR": "EUR",
+	} {
+		if got := SymbolCurrency(symbol); got != want {
+			t.Errorf("SymbolCurrency(%q) = %q, want %q", symbol, got, want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package market
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"stockmarket/internal/models"
+)
+
+// splitRatios are the common forward split ratios; reverse splits use their inverse
+var splitRatios = []float64{1.5, 2, 3, 4, 5, 8, 10, 20}
+
+// DiscontinuityDetector flags streamed quotes whose price jump matches a stock split
+// ratio, so downstream consumers (alerts) can ignore corporate-action-driven moves
+type DiscontinuityDetector struct {
+	tolerance float64
+	last      map[string]float64
+	mu        sync.Mutex
+}
+
+// NewDiscontinuityDetector creates a detector. tolerance is how close (as a fraction)
+// a price ratio must be to a split ratio to be flagged; 0 disables detection.
+func NewDiscontinuityDetector(tolerance float64) *DiscontinuityDetector {
+	return &DiscontinuityDetector{
+		tolerance: tolerance,
+		last:      make(map[string]float64),
+	}
+}
+
+// Check annotates the quote when its move from the previous quote looks like a split.
+// The quote always becomes the new baseline for its symbol.
+func (d *DiscontinuityDetector) Check(quote *models.Quote) {
+	if d == nil || d.tolerance <= 0 || quote.Price <= 0 {
+		return
+	}
+
+	d.mu.Lock()
+	prev, ok := d.last[quote.Symbol]
+	d.last[quote.Symbol] = quote.Price
+	d.mu.Unlock()
+
+	if !ok || prev <= 0 {
+		return
+	}
+
+	ratio := prev / quote.Price
+	for _, r := range splitRatios {
+		if math.Abs(ratio/r-1) <= d.tolerance {
+			quote.Discontinuity = fmt.Sprintf("possible %s split", formatSplitRatio(r, false))
+			return
+		}
+		if math.Abs(ratio*r-1) <= d.tolerance {
+			quote.Discontinuity = fmt.Sprintf("possible %s reverse split", formatSplitRatio(r, true))
+			return
+		}
+	}
+}
+
+// formatSplitRatio renders a split ratio like "2:1", "3:2" or, for reverse splits, "1:10"
+func formatSplitRatio(r float64, reverse bool) string {
+	num, den := r, 1.0
+	if r != math.Trunc(r) {
+		num, den = r*2, 2
+	}
+	if reverse {
+		num, den = den, num
+	}
+	return fmt.Sprintf("%g:%g", num, den)
+}
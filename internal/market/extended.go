@@ -0,0 +1,40 @@
+package market
+
+import (
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// setExtendedHours records a trade at price and tradedAt on quote as its extended-hours
+// price when it happened in the pre-market or after-hours window, and clears the
+// extended-hours fields when it didn't, so they're never set during the regular session
+func setExtendedHours(quote *models.Quote, price float64, tradedAt time.Time) {
+	quote.ExtendedHoursPrice, quote.ExtendedHoursChangePercent, quote.ExtendedHoursTimestamp = 0, 0, nil
+	if price <= 0 || tradedAt.IsZero() || !InExtendedSession(tradedAt, SymbolExchange(quote.Symbol)) {
+		return
+	}
+	quote.ExtendedHoursPrice = price
+	if quote.Price > 0 {
+		quote.ExtendedHoursChangePercent = (price/quote.Price - 1) * 100
+	}
+	quote.ExtendedHoursTimestamp = &tradedAt
+}
+
+// UseExtendedHours prices quote at its extended-hours trade, when it has one, for
+// analyses and alerts that count extended hours: the price, time and change from the
+// previous close become the trade's, and the extended-hours fields are cleared
+func UseExtendedHours(quote *models.Quote) {
+	if quote.ExtendedHoursPrice <= 0 {
+		return
+	}
+	quote.Price = quote.ExtendedHoursPrice
+	if quote.ExtendedHoursTimestamp != nil {
+		quote.Timestamp = *quote.ExtendedHoursTimestamp
+	}
+	if quote.PreviousClose > 0 {
+		quote.Change = quote.Price - quote.PreviousClose
+		quote.ChangePercent = quote.Change / quote.PreviousClose * 100
+	}
+	quote.ExtendedHoursPrice, quote.ExtendedHoursChangePercent, quote.ExtendedHoursTimestamp = 0, 0, nil
+}
@@ -0,0 +1,294 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// Fallback is a Provider that tries a chain of providers in order of preference,
+// preferring those the health tracker reports as up so a dead primary isn't
+// retried first on every request
+type Fallback struct {
+	providers []Provider
+	health    *HealthTracker
+}
+
+// NewFallback creates a fallback provider. providers are in configured preference
+// order, primary first.
+func NewFallback(health *HealthTracker, providers ...Provider) *Fallback {
+	return &Fallback{providers: providers, health: health}
+}
+
+// Name returns the name of the currently preferred provider
+func (f *Fallback) Name() string {
+	return f.ordered()[0].Name()
+}
+
+// ordered returns the providers with healthy ones first, keeping configured order otherwise
+func (f *Fallback) ordered() []Provider {
+	ordered := append([]Provider{}, f.providers...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return f.health.Up(ordered[i].Name()) && !f.health.Up(ordered[j].Name())
+	})
+	return ordered
+}
+
+// GetQuote fetches a quote from the first provider that succeeds
+func (f *Fallback) GetQuote(ctx context.Context, symbol string) (*models.Quote, error) {
+	var errs []error
+	for _, p := range f.ordered() {
+		start := time.Now()
+		quote, err := p.GetQuote(ctx, symbol)
+		if err == nil {
+			f.health.Record(p.Name(), nil, time.Since(start))
+			logServed(ctx, "quote", symbol, p, len(errs))
+			return quote, nil
+		}
+		if !errors.Is(err, ErrInvalidSymbol) {
+			f.health.Record(p.Name(), err, time.Since(start))
+			slog.WarnContext(ctx, "market: quote failed", "provider", p.Name(), "symbol", symbol, "error", err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// logServed notes which provider answered once earlier ones failed, so a flaky
+// primary shows up in the logs. Logging with the request's context ties these to the
+// request they were made for.
+func logServed(ctx context.Context, request, symbol string, p Provider, failed int) {
+	if failed > 0 {
+		slog.InfoContext(ctx, "market: "+request+" served by fallback",
+			"provider", p.Name(), "symbol", symbol, "failed_providers", failed)
+	}
+}
+
+// GetQuotes fetches quotes from the preferred provider, retrying symbols that failed
+// on the next provider in the chain. Symbols no provider could fetch are reported in
+// a *BatchError.
+func (f *Fallback) GetQuotes(ctx context.Context, symbols []string) (map[string]models.Quote, error) {
+	quotes := make(map[string]models.Quote, len(symbols))
+	errs := make(map[string]error)
+	remaining := symbols
+	for _, p := range f.ordered() {
+		if len(remaining) == 0 {
+			break
+		}
+		start := time.Now()
+		got, err := p.GetQuotes(ctx, remaining)
+		for symbol, quote := range got {
+			quotes[symbol] = quote
+			delete(errs, symbol)
+		}
+
+		var batchErr *BatchError
+		if err != nil && !errors.As(err, &batchErr) {
+			batchErr = &BatchError{Errors: make(map[string]error)}
+			for _, symbol := range remaining {
+				batchErr.Errors[symbol] = err
+			}
+		}
+		if len(got) > 0 || err == nil {
+			f.health.Record(p.Name(), nil, time.Since(start))
+		} else {
+			f.health.Record(p.Name(), err, time.Since(start))
+		}
+		if batchErr == nil {
+			break
+		}
+		slog.WarnContext(ctx, "market: quotes failed, trying next provider",
+			"provider", p.Name(), "failed", len(batchErr.Errors), "requested", len(remaining))
+
+		remaining = nil
+		for symbol, symbolErr := range batchErr.Errors {
+			errs[symbol] = fmt.Errorf("%s: %w", p.Name(), symbolErr)
+			if !errors.Is(symbolErr, ErrInvalidSymbol) {
+				remaining = append(remaining, symbol)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return quotes, &BatchError{Errors: errs}
+	}
+	return quotes, nil
+}
+
+// GetHistoricalData fetches historical data from the first provider that succeeds
+func (f *Fallback) GetHistoricalData(ctx context.Context, symbol string, period string, interval string) ([]models.Candle, error) {
+	var errs []error
+	for _, p := range f.ordered() {
+		start := time.Now()
+		candles, err := p.GetHistoricalData(ctx, symbol, period, interval)
+		if err == nil {
+			f.health.Record(p.Name(), nil, time.Since(start))
+			logServed(ctx, "history", symbol, p, len(errs))
+			return candles, nil
+		}
+		if !errors.Is(err, ErrInvalidSymbol) && !errors.Is(err, ErrUnsupportedInterval) {
+			f.health.Record(p.Name(), err, time.Since(start))
+			slog.WarnContext(ctx, "market: history failed", "provider", p.Name(), "symbol", symbol, "error", err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Fallback streaming: how often a running stream checks whether another provider has
+// become preferred, and how long it waits before retrying after a stream fails
+const (
+	fallbackStreamCheck = 30 * time.Second
+	fallbackStreamRetry = 2 * time.Second
+)
+
+// StreamQuotes streams from the preferred provider's own StreamQuotes, so a provider
+// with a push feed streams over it. Symbols that fail to fetch mark the provider down,
+// and once another provider is preferred, or the stream fails, the stream moves to
+// the next provider in the chain.
+func (f *Fallback) StreamQuotes(ctx context.Context, sub *Subscription, ch chan<- models.Quote) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	follow, _ := sub.Filter(ctx, func(string) bool { return true })
+
+	var streaming Provider
+	report := sub.onStatus
+	follow.onStatus = func(status SymbolStatus) {
+		if !errors.Is(status.Err, ErrInvalidSymbol) {
+			f.health.Record(streaming.Name(), status.Err, 0)
+		}
+		if report != nil {
+			report(status)
+		}
+	}
+
+	for {
+		streaming = f.ordered()[0]
+		err := f.streamFrom(ctx, streaming, follow, ch)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			slog.InfoContext(ctx, "market: stream moving to preferred provider", "from", streaming.Name(), "to", f.Name())
+			continue
+		}
+
+		f.health.Record(streaming.Name(), err, 0)
+		slog.WarnContext(ctx, "market: stream failed, trying next provider", "provider", streaming.Name(), "error", err)
+		retry := time.NewTimer(fallbackStreamRetry)
+		select {
+		case <-ctx.Done():
+			retry.Stop()
+			return ctx.Err()
+		case <-retry.C:
+		}
+	}
+}
+
+// streamFrom runs p's stream until it fails or another provider becomes preferred,
+// returning nil in the latter case
+func (f *Fallback) streamFrom(ctx context.Context, p Provider, sub *Subscription, ch chan<- models.Quote) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- p.StreamQuotes(ctx, sub, ch) }()
+
+	check := time.NewTicker(fallbackStreamCheck)
+	defer check.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err == nil {
+				err = errors.New("stream ended")
+			}
+			return err
+		case <-check.C:
+			if f.Name() != p.Name() {
+				cancel()
+				<-done
+				return nil
+			}
+		}
+	}
+}
+
+// GetMovers fetches movers from the first provider with a screener
+func (f *Fallback) GetMovers(ctx context.Context, moverType string) ([]models.Mover, error) {
+	for _, p := range f.ordered() {
+		if mp, ok := p.(MoversProvider); ok {
+			return mp.GetMovers(ctx, moverType)
+		}
+	}
+	return nil, ErrNotSupported
+}
+
+// SearchSymbols searches with the first provider with a search endpoint that succeeds
+func (f *Fallback) SearchSymbols(ctx context.Context, query string) ([]models.SymbolMatch, error) {
+	var errs []error
+	for _, p := range f.ordered() {
+		if ss, ok := p.(SymbolSearcher); ok {
+			matches, err := ss.SearchSymbols(ctx, query)
+			if err == nil {
+				return matches, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil, ErrNotSupported
+	}
+	return nil, errors.Join(errs...)
+}
+
+// StreamTrades streams trades from the first provider with a trades feed
+func (f *Fallback) StreamTrades(ctx context.Context, symbols []string, ch chan<- models.Trade) error {
+	for _, p := range f.ordered() {
+		if tp, ok := p.(TradeProvider); ok {
+			return tp.StreamTrades(ctx, symbols, ch)
+		}
+	}
+	return ErrNotSupported
+}
+
+// GetEarningsTranscript fetches a transcript from the first provider that supports them
+func (f *Fallback) GetEarningsTranscript(ctx context.Context, symbol string, quarter string) (*models.EarningsTranscript, error) {
+	for _, p := range f.ordered() {
+		if tp, ok := p.(TranscriptProvider); ok {
+			return tp.GetEarningsTranscript(ctx, symbol, quarter)
+		}
+	}
+	return nil, ErrNotSupported
+}
+
+// GetFundamentals fetches fundamentals from the first provider that supports them
+func (f *Fallback) GetFundamentals(ctx context.Context, symbol string) (*models.Fundamentals, error) {
+	for _, p := range f.ordered() {
+		if fp, ok := p.(FundamentalsProvider); ok {
+			return fp.GetFundamentals(ctx, symbol)
+		}
+	}
+	return nil, ErrNotSupported
+}
+
+// GetSplits lists splits from the first provider with a split list that succeeds
+func (f *Fallback) GetSplits(ctx context.Context, symbol string) ([]models.Split, error) {
+	var errs []error
+	for _, p := range f.ordered() {
+		if sp, ok := p.(SplitProvider); ok {
+			splits, err := sp.GetSplits(ctx, symbol)
+			if err == nil {
+				return splits, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil, ErrNotSupported
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,57 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// stubStreamer is a provider whose stream fails with err, or sends one quote and
+// waits when err is nil
+type stubStreamer struct {
+	*Mock
+	name string
+	err  error
+}
+
+func (s *stubStreamer) Name() string { return s.name }
+
+func (s *stubStreamer) StreamQuotes(ctx context.Context, sub *Subscription, ch chan<- models.Quote) error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, symbol := range sub.Symbols() {
+		ch <- models.Quote{Symbol: symbol, Price: 42}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// TestFallbackStreamDelegates checks that the fallback streams through the preferred
+// provider's own StreamQuotes and moves down the chain when that stream fails
+func TestFallbackStreamDelegates(t *testing.T) {
+	health := NewHealthTracker()
+	primary := &stubStreamer{Mock: NewMock(), name: "primary", err: errors.New("feed down")}
+	secondary := &stubStreamer{Mock: NewMock(), name: "secondary"}
+	f := NewFallback(health, primary, secondary)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan models.Quote, 1)
+	go f.StreamQuotes(ctx, NewSubscription([]string{"AAPL"}), ch)
+
+	select {
+	case quote := <-ch:
+		if quote.Symbol != "AAPL" || quote.Price != 42 {
+			t.Fatalf("quote = %+v, want the secondary's AAPL at 42", quote)
+		}
+	case <-ctx.Done():
+		t.Fatal("no quote streamed after the primary's stream failed")
+	}
+	if health.Up("primary") {
+		t.Error("primary still reported up after its stream failed")
+	}
+}
@@ -1,28 +1,49 @@
 package market
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sync"
 	"time"
 
 	"stockmarket/internal/models"
+
+	"github.com/gorilla/websocket"
 )
 
 const finnhubBaseURL = "https://finnhub.io/api/v1"
 
+const finnhubWSURL = "wss://ws.finnhub.io"
+
 // Finnhub implements the Provider interface for Finnhub API
 type Finnhub struct {
 	apiKey string
 	client *http.Client
+
+	volumes   map[string]streamVolume // session volume for streamed quotes, by symbol
+	volumesMu sync.Mutex
 }
 
+// streamVolume is a symbol's session volume and when it was summed
+type streamVolume struct {
+	volume int64
+	at     time.Time
+}
+
+// streamVolumeTTL is how long a streamed symbol's session volume is reused, so filling
+// it in doesn't double the Finnhub calls on every poll
+const streamVolumeTTL = time.Minute
+
 // NewFinnhub creates a new Finnhub provider
 func NewFinnhub(apiKey string) *Finnhub {
 	return &Finnhub{
-		apiKey: apiKey,
-		client: sharedHTTPClient,
+		apiKey:  apiKey,
+		client:  sharedHTTPClient,
+		volumes: make(map[string]streamVolume),
 	}
 }
 
@@ -40,7 +61,7 @@ func (f *Finnhub) GetQuote(ctx context.Context, symbol string) (*models.Quote, e
 		return nil, err
 	}
 
-	resp, err := f.client.Do(req)
+	resp, err := doWithRetry(f.Name(), f.client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -74,6 +95,7 @@ func (f *Finnhub) GetQuote(ctx context.Context, symbol string) (*models.Quote, e
 
 	return &models.Quote{
 		Symbol:        symbol,
+		Currency:      SymbolCurrency(symbol),
 		Price:         result.C,
 		Open:          result.O,
 		High:          result.H,
@@ -82,12 +104,126 @@ func (f *Finnhub) GetQuote(ctx context.Context, symbol string) (*models.Quote, e
 		PreviousClose: result.Pc,
 		Change:        result.D,
 		ChangePercent: result.Dp,
-		Timestamp:     time.Unix(result.T, 0),
+		Timestamp:     normalizeTimestamp(f.Name(), time.Unix(result.T, 0)),
 	}, nil
 }
 
+// GetFundamentals fetches the indicated dividend yield and payout ratio from Finnhub's
+// basic financials. Finnhub doesn't report dividend growth streaks.
+func (f *Finnhub) GetFundamentals(ctx context.Context, symbol string) (*models.Fundamentals, error) {
+	url := fmt.Sprintf("%s/stock/metric?symbol=%s&metric=all&token=%s", finnhubBaseURL, symbol, f.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doWithRetry(f.Name(), f.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return nil, ErrRateLimited
+	}
+	if resp.StatusCode != 200 {
+		return nil, ErrAPIError
+	}
+
+	var result struct {
+		Metric map[string]interface{} `json:"metric"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.Metric) == 0 {
+		return nil, ErrInvalidSymbol
+	}
+
+	metric := func(name string) *float64 {
+		if v, ok := result.Metric[name].(float64); ok {
+			return &v
+		}
+		return nil
+	}
+	return &models.Fundamentals{
+		Symbol:        symbol,
+		DividendYield: metric("dividendYieldIndicatedAnnual"),
+		PayoutRatio:   metric("payoutRatioTTM"),
+		FetchedAt:     time.Now(),
+	}, nil
+}
+
+// SearchSymbols looks up tickers by symbol or company name with Finnhub's symbol
+// lookup, which doesn't report exchanges
+func (f *Finnhub) SearchSymbols(ctx context.Context, query string) ([]models.SymbolMatch, error) {
+	searchURL := fmt.Sprintf("%s/search?q=%s&token=%s", finnhubBaseURL, url.QueryEscape(query), f.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doWithRetry(f.Name(), f.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return nil, ErrRateLimited
+	}
+	if resp.StatusCode == 401 || resp.StatusCode == 403 {
+		return nil, ErrNotAuthorized
+	}
+	if resp.StatusCode != 200 {
+		return nil, ErrAPIError
+	}
+
+	var result struct {
+		Result []struct {
+			Description   string `json:"description"`
+			DisplaySymbol string `json:"displaySymbol"`
+			Symbol        string `json:"symbol"`
+			Type          string `json:"type"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	matches := make([]models.SymbolMatch, 0, len(result.Result))
+	for _, r := range result.Result {
+		matches = append(matches, models.SymbolMatch{
+			Symbol: cmp.Or(r.DisplaySymbol, r.Symbol),
+			Name:   r.Description,
+			Type:   matchType(r.Type),
+		})
+	}
+	return matches, nil
+}
+
+// GetQuotes fetches quotes for several symbols with a bounded concurrent fan-out
+func (f *Finnhub) GetQuotes(ctx context.Context, symbols []string) (map[string]models.Quote, error) {
+	return fanOutQuotes(ctx, symbols, f.GetQuote)
+}
+
+// finnhubResolutions maps Intervals to Finnhub candle resolutions
+var finnhubResolutions = map[string]string{
+	Interval1Min:  "1",
+	Interval5Min:  "5",
+	Interval15Min: "15",
+	Interval1Hour: "60",
+	Interval1Day:  "D",
+}
+
 // GetHistoricalData fetches historical OHLCV data
-func (f *Finnhub) GetHistoricalData(ctx context.Context, symbol string, period string) ([]models.Candle, error) {
+func (f *Finnhub) GetHistoricalData(ctx context.Context, symbol string, period string, interval string) ([]models.Candle, error) {
+	if err := ValidateInterval(f.Name(), period, interval); err != nil {
+		return nil, err
+	}
+
 	// Calculate time range based on period
 	resolution := "D"
 	var from, to time.Time
@@ -106,6 +242,9 @@ func (f *Finnhub) GetHistoricalData(ctx context.Context, symbol string, period s
 	case "3m":
 		resolution = "D"
 		from = to.AddDate(0, -3, 0)
+	case "6m":
+		resolution = "D"
+		from = to.AddDate(0, -6, 0)
 	case "1y":
 		resolution = "D"
 		from = to.AddDate(-1, 0, 0)
@@ -116,6 +255,9 @@ func (f *Finnhub) GetHistoricalData(ctx context.Context, symbol string, period s
 		resolution = "D"
 		from = to.AddDate(0, -1, 0)
 	}
+	if interval != "" {
+		resolution = finnhubResolutions[interval]
+	}
 
 	url := fmt.Sprintf("%s/stock/candle?symbol=%s&resolution=%s&from=%d&to=%d&token=%s",
 		finnhubBaseURL, symbol, resolution, from.Unix(), to.Unix(), f.apiKey)
@@ -125,7 +267,7 @@ func (f *Finnhub) GetHistoricalData(ctx context.Context, symbol string, period s
 		return nil, err
 	}
 
-	resp, err := f.client.Do(req)
+	resp, err := doWithRetry(f.Name(), f.client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -153,6 +295,9 @@ func (f *Finnhub) GetHistoricalData(ctx context.Context, symbol string, period s
 		return nil, ErrInvalidSymbol
 	}
 
+	// Finnhub adjusts daily and longer bars for splits, but not intraday ones
+	splitAdjusted := resolution == "D" || resolution == "W"
+
 	var candles []models.Candle
 	for i := len(result.T) - 1; i >= 0; i-- {
 		var volume int64
@@ -160,39 +305,115 @@ func (f *Finnhub) GetHistoricalData(ctx context.Context, symbol string, period s
 			volume = result.V[i]
 		}
 
-		candles = append(candles, models.Candle{
-			Timestamp: time.Unix(result.T[i], 0),
+		candle := models.Candle{
+			Timestamp: normalizeTimestamp(f.Name(), time.Unix(result.T[i], 0)),
 			Open:      result.O[i],
 			High:      result.H[i],
 			Low:       result.L[i],
 			Close:     result.C[i],
 			Volume:    volume,
-		})
+		}
+		if splitAdjusted {
+			candle.AdjClose = candle.Close
+		}
+		candles = append(candles, candle)
 	}
 
 	return candles, nil
 }
 
 // StreamQuotes streams real-time quotes via polling
-func (f *Finnhub) StreamQuotes(ctx context.Context, symbols []string, ch chan<- models.Quote) error {
-	ticker := time.NewTicker(5 * time.Second) // Finnhub has better rate limits
-	defer ticker.Stop()
+func (f *Finnhub) StreamQuotes(ctx context.Context, sub *Subscription, ch chan<- models.Quote) error {
+	return pollQuotes(ctx, sub, pollIntervals[f.Name()], f.streamQuote, ch)
+}
+
+// streamQuote fetches a quote and fills in the session volume, which Finnhub's quote
+// endpoint omits, from today's 5-minute candles. Volume stays zero if they can't be fetched.
+func (f *Finnhub) streamQuote(ctx context.Context, symbol string) (*models.Quote, error) {
+	quote, err := f.GetQuote(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	f.volumesMu.Lock()
+	cached, ok := f.volumes[symbol]
+	f.volumesMu.Unlock()
+	if !ok || time.Since(cached.at) > streamVolumeTTL {
+		candles, err := f.GetHistoricalData(ctx, symbol, "1d", "")
+		if err != nil {
+			return quote, nil
+		}
+		cached = streamVolume{volume: sessionVolume(candles), at: time.Now()}
+		f.volumesMu.Lock()
+		f.volumes[symbol] = cached
+		f.volumesMu.Unlock()
+	}
+	quote.Volume = cached.volume
+	return quote, nil
+}
+
+// sessionVolume sums the volume of the candles on the same day as the last one
+func sessionVolume(candles []models.Candle) int64 {
+	if len(candles) == 0 {
+		return 0
+	}
+	day := candles[len(candles)-1].Timestamp.Format("2006-01-02")
+	var total int64
+	for _, c := range candles {
+		if c.Timestamp.Format("2006-01-02") == day {
+			total += c.Volume
+		}
+	}
+	return total
+}
+
+// StreamTrades streams individual trade prints from Finnhub's WebSocket feed
+func (f *Finnhub) StreamTrades(ctx context.Context, symbols []string, ch chan<- models.Trade) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, finnhubWSURL+"?token="+f.apiKey, nil)
+	if err != nil {
+		return fmt.Errorf("%w: trades feed: %v", ErrAPIError, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for _, symbol := range symbols {
+		if err := conn.WriteJSON(map[string]string{"type": "subscribe", "symbol": symbol}); err != nil {
+			return err
+		}
+	}
 
 	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
-			for _, symbol := range symbols {
-				quote, err := f.GetQuote(ctx, symbol)
-				if err != nil {
-					continue
-				}
-				select {
-				case ch <- *quote:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
+		var msg struct {
+			Type string `json:"type"`
+			Data []struct {
+				Symbol string  `json:"s"`
+				Price  float64 `json:"p"`
+				Volume float64 `json:"v"`
+				Time   int64   `json:"t"` // milliseconds
+			} `json:"data"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if msg.Type != "trade" {
+			continue
+		}
+
+		for _, d := range msg.Data {
+			trade := models.Trade{
+				Symbol:    d.Symbol,
+				Price:     d.Price,
+				Size:      d.Volume,
+				Timestamp: normalizeTimestamp(f.Name(), time.UnixMilli(d.Time)),
+			}
+			select {
+			case ch <- trade:
+			case <-ctx.Done():
+				return ctx.Err()
 			}
 		}
 	}
@@ -0,0 +1,74 @@
+package market
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// HealthTracker records the up/down state of market data providers from probes
+// and live requests
+type HealthTracker struct {
+	status map[string]*models.ProviderHealth
+	mu     sync.RWMutex
+}
+
+// NewHealthTracker creates an empty health tracker; unprobed providers are treated as up
+func NewHealthTracker() *HealthTracker {
+	return &HealthTracker{status: make(map[string]*models.ProviderHealth)}
+}
+
+// Record stores the outcome of a request to the named provider
+func (h *HealthTracker) Record(name string, err error, latency time.Duration) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st, ok := h.status[name]
+	if !ok {
+		st = &models.ProviderHealth{Provider: name}
+		h.status[name] = st
+	}
+	st.CheckedAt = time.Now()
+	st.LatencyMs = latency.Milliseconds()
+	if err != nil {
+		st.Up = false
+		st.LastError = err.Error()
+		st.ConsecutiveFailures++
+		return
+	}
+	st.Up = true
+	st.LastError = ""
+	st.ConsecutiveFailures = 0
+}
+
+// Up reports whether the named provider is believed healthy
+func (h *HealthTracker) Up(name string) bool {
+	if h == nil {
+		return true
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	st, ok := h.status[name]
+	return !ok || st.Up
+}
+
+// Snapshot returns the health of every tracked provider, sorted by name
+func (h *HealthTracker) Snapshot() []models.ProviderHealth {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	out := make([]models.ProviderHealth, 0, len(h.status))
+	for _, st := range h.status {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Provider < out[j].Provider })
+	return out
+}
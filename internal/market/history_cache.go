@@ -0,0 +1,226 @@
+package market
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// HistoryStore persists fetched candles, so history that can no longer change is served
+// without asking the provider again, even across restarts
+type HistoryStore interface {
+	// GetCachedHistory returns sql.ErrNoRows when nothing is cached
+	GetCachedHistory(provider, symbol, period, interval string) ([]models.Candle, time.Time, error)
+	SaveCachedHistory(provider, symbol, period, interval string, candles []models.Candle, fetchedAt time.Time) error
+}
+
+// historyTailBars is how many of the newest cached candles a refresh compares with the
+// provider's, to notice when a split or dividend has rewritten the adjusted series
+const historyTailBars = 5
+
+type forceRefreshKey struct{}
+
+// WithForceRefresh returns a context whose historical data requests skip the caches and
+// refetch the whole series from the provider
+func WithForceRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceRefreshKey{}, true)
+}
+
+// forceRefresh reports whether ctx asks to skip the caches
+func forceRefresh(ctx context.Context) bool {
+	force, _ := ctx.Value(forceRefreshKey{}).(bool)
+	return force
+}
+
+// SetHistoryStore makes the cache persist historical data to store. Only the newest
+// candles of a persisted series are ever refetched: a series is served as it is while
+// it's younger than the historical TTL or the symbol's market hasn't opened since it
+// was fetched, and is otherwise brought up to date with a short request covering the
+// bars since, merged over the older candles.
+func (c *QuoteCache) SetHistoryStore(store HistoryStore) {
+	c.historyStore = store
+}
+
+// persistedHistory returns candles from the history store, fetching whatever part of
+// them can have changed since they were stored
+func (cp *CachingProvider) persistedHistory(ctx context.Context, symbol, period, interval string) ([]models.Candle, error) {
+	store, name := cp.cache.historyStore, cp.Name()
+	if forceRefresh(ctx) {
+		return cp.fetchHistory(ctx, symbol, period, interval)
+	}
+	cached, fetchedAt, err := store.GetCachedHistory(name, symbol, period, interval)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && len(cached) == 0) {
+		return cp.fetchHistory(ctx, symbol, period, interval)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "failed to load cached historical data", "symbol", symbol, "error", err)
+		return cp.fetchHistory(ctx, symbol, period, interval)
+	}
+
+	now := time.Now()
+	if now.Sub(fetchedAt) < cp.cache.historyTTL || !sessionSince(symbol, fetchedAt, now) {
+		return cached, nil
+	}
+
+	barInterval := historyBarInterval(interval, cached)
+	tailPeriod := historyTailPeriod(name, period, barInterval, now.Sub(cached[0].Timestamp))
+	if tailPeriod == "" {
+		return cp.fetchHistory(ctx, symbol, period, interval)
+	}
+	tail, err := cp.Provider.GetHistoricalData(ctx, symbol, tailPeriod, barInterval)
+	if err != nil {
+		return nil, err
+	}
+	merged, ok := mergeHistoryTail(cached, tail)
+	if !ok {
+		// The adjusted history changed, so the older candles are out of date too
+		return cp.fetchHistory(ctx, symbol, period, interval)
+	}
+	cp.saveHistory(ctx, symbol, period, interval, merged, now)
+	return merged, nil
+}
+
+// fetchHistory fetches the whole series from the provider and stores it
+func (cp *CachingProvider) fetchHistory(ctx context.Context, symbol, period, interval string) ([]models.Candle, error) {
+	candles, err := cp.Provider.GetHistoricalData(ctx, symbol, period, interval)
+	if err != nil {
+		return nil, err
+	}
+	cp.saveHistory(ctx, symbol, period, interval, candles, time.Now())
+	return candles, nil
+}
+
+// saveHistory stores candles, logging rather than failing the request when it can't
+func (cp *CachingProvider) saveHistory(ctx context.Context, symbol, period, interval string, candles []models.Candle, fetchedAt time.Time) {
+	if len(candles) == 0 {
+		return
+	}
+	if err := cp.cache.historyStore.SaveCachedHistory(cp.Name(), symbol, period, interval, candles, fetchedAt); err != nil {
+		slog.WarnContext(ctx, "failed to cache historical data", "symbol", symbol, "error", err)
+	}
+}
+
+// sessionSince reports whether symbol's market may have traded between from and to, so
+// candles fetched at from may be missing bars or have an unfinished last bar. Crypto
+// trades around the clock.
+func sessionSince(symbol string, from, to time.Time) bool {
+	if IsCrypto(symbol) {
+		return true
+	}
+	exchange := SymbolExchange(symbol)
+	return IsMarketOpen(from, exchange) || !NextMarketOpen(from, exchange).After(to)
+}
+
+// intervalDurations are the bar lengths of each interval
+var intervalDurations = map[string]time.Duration{
+	Interval1Min:  time.Minute,
+	Interval5Min:  5 * time.Minute,
+	Interval15Min: 15 * time.Minute,
+	Interval1Hour: time.Hour,
+	Interval1Day:  24 * time.Hour,
+}
+
+// historyBarInterval returns the interval of cached candles: the requested one, or for
+// the provider's default the one matching the shortest gap between the newest bars.
+// It returns "" when no interval matches, such as for weekly bars.
+func historyBarInterval(interval string, candles []models.Candle) string {
+	if interval != "" {
+		return interval
+	}
+	var gap time.Duration
+	for i := 1; i < len(candles) && i <= historyTailBars*2; i++ {
+		if g := candles[i-1].Timestamp.Sub(candles[i].Timestamp); g > 0 && (gap == 0 || g < gap) {
+			gap = g
+		}
+	}
+	for _, candidate := range Intervals {
+		length := intervalDurations[candidate]
+		// Daily bars are a day apart give or take a daylight saving shift
+		if gap == length || (candidate == Interval1Day && gap >= 20*time.Hour && gap <= 28*time.Hour) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// EndsBeforeToday reports whether candles, newest first, are daily or longer bars the
+// newest of which is dated before today in exchange time, so none of them is still
+// trading. Intraday bars, the 1d period and crypto, which trades every day, never do.
+func EndsBeforeToday(symbol, period, interval string, candles []models.Candle, now time.Time) bool {
+	if len(candles) == 0 || period == "1d" || IsCrypto(symbol) {
+		return false
+	}
+	if length, ok := intervalDurations[historyBarInterval(interval, candles)]; ok && length < 24*time.Hour {
+		return false
+	}
+	newest, today := candles[0].Timestamp.In(exchangeLocation), now.In(exchangeLocation)
+	return newest.Before(time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, exchangeLocation))
+}
+
+// historyTailPeriod returns the shortest period the named provider serves interval bars
+// over that still reaches back past the newest cached bar, age ago, so the bars since
+// can be fetched on their own. It returns "" when no period shorter than the series'
+// own does, and the whole series should be refetched.
+func historyTailPeriod(provider, period, interval string, age time.Duration) string {
+	if _, ok := periodLengths[period]; !ok || interval == "" {
+		return ""
+	}
+	for _, candidate := range periods {
+		if ComparePeriods(candidate, period) >= 0 {
+			return ""
+		}
+		if periodLengths[candidate] > age+intervalDurations[interval] && ValidateInterval(provider, candidate, interval) == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// mergeHistoryTail replaces the cached candles a freshly fetched tail covers with the
+// tail's, dropping as many of the oldest as the window has moved on. It reports false
+// when a candle both have differs by more than rounding, meaning the provider has since
+// re-adjusted its history, or when the tail doesn't reach back to the newest cached
+// candle.
+func mergeHistoryTail(cached, tail []models.Candle) ([]models.Candle, bool) {
+	if len(tail) == 0 {
+		return cached, true
+	}
+	// The tail has to reach back to the newest cached bar, or bars would go missing
+	oldest := tail[len(tail)-1].Timestamp
+	if oldest.After(cached[0].Timestamp) {
+		return nil, false
+	}
+	// The newest cached bar may have been unfinished when fetched, so it isn't compared
+	compared := 0
+	for _, candle := range tail {
+		i := slices.IndexFunc(cached[1:], func(c models.Candle) bool { return c.Timestamp.Equal(candle.Timestamp) })
+		if i < 0 || compared >= historyTailBars {
+			continue
+		}
+		compared++
+		if !samePrice(cached[i+1].Close, candle.Close) || !samePrice(cached[i+1].AdjClose, candle.AdjClose) {
+			return nil, false
+		}
+	}
+
+	// The window moves on by as much as the newest bar did, as the provider's would
+	start := cached[len(cached)-1].Timestamp.Add(tail[0].Timestamp.Sub(cached[0].Timestamp))
+	merged := slices.Clone(tail)
+	for _, candle := range cached {
+		if candle.Timestamp.Before(oldest) && !candle.Timestamp.Before(start) {
+			merged = append(merged, candle)
+		}
+	}
+	return merged, true
+}
+
+// samePrice reports whether two prices agree to within rounding
+func samePrice(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-6*math.Max(math.Abs(a), math.Abs(b))
+}
@@ -0,0 +1,78 @@
+package market
+
+import (
+	"testing"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+func TestHistoryTailPeriod(t *testing.T) {
+	cases := []struct {
+		period, interval string
+		age              time.Duration
+		want             string
+	}{
+		{"1y", Interval1Day, 2 * 24 * time.Hour, "5d"},
+		{"1y", Interval1Day, 10 * 24 * time.Hour, "1m"},
+		{"1m", Interval1Min, time.Hour, "1d"},
+		{"1m", Interval1Day, 40 * 24 * time.Hour, ""}, // no shorter period reaches back
+		{"5y", "", time.Hour, ""},                     // the bar length is unknown
+		{"10y", Interval1Day, time.Hour, ""},
+	}
+	for _, c := range cases {
+		if got := historyTailPeriod("yahoo", c.period, c.interval, c.age); got != c.want {
+			t.Errorf("historyTailPeriod(%s, %s, %s) = %q, want %q", c.period, c.interval, c.age, got, c.want)
+		}
+	}
+}
+
+func TestMergeHistoryTail(t *testing.T) {
+	cached := dailyBars(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	fresh := dailyBars(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12)
+
+	merged, ok := mergeHistoryTail(cached, fresh[:4])
+	if !ok {
+		t.Fatal("merge refused a consistent tail")
+	}
+	if len(merged) != len(cached) {
+		t.Fatalf("merged %d candles, want the window of %d moved on two days", len(merged), len(cached))
+	}
+	for i, c := range merged {
+		if want := fresh[i]; !c.Timestamp.Equal(want.Timestamp) || c.Close != want.Close {
+			t.Errorf("merged[%d] = %s at %v, want %s at %v", i, c.Timestamp.Format(time.DateOnly), c.Close, want.Timestamp.Format(time.DateOnly), want.Close)
+		}
+	}
+
+	readjusted := dailyBars(1, 2, 3, 4, 5, 6, 7, 8, 4.5, 10, 11, 12)
+	if _, ok := mergeHistoryTail(cached, readjusted[:4]); ok {
+		t.Error("merge accepted a tail whose overlapping close changed")
+	}
+	if _, ok := mergeHistoryTail(cached, fresh[:1]); ok {
+		t.Error("merge accepted a tail that doesn't reach the newest cached candle")
+	}
+	if got, ok := mergeHistoryTail(cached, nil); !ok || len(got) != len(cached) {
+		t.Error("an empty tail should leave the cache as it was")
+	}
+}
+
+func TestEndsBeforeToday(t *testing.T) {
+	daily := dailyBars(1, 2, 3) // newest on 2024-06-07, a Friday
+	saturday := time.Date(2024, 6, 8, 12, 0, 0, 0, exchangeLocation)
+	if !EndsBeforeToday("AAPL", "1m", Interval1Day, daily, saturday) {
+		t.Error("daily bars ending on Friday should be complete on Saturday")
+	}
+	if !EndsBeforeToday("AAPL", "1m", "", daily, saturday) {
+		t.Error("the provider's default daily bars should count as daily")
+	}
+	if EndsBeforeToday("AAPL", "1m", Interval1Day, daily, daily[0].Timestamp.Add(15*time.Hour)) {
+		t.Error("a bar from today may still be trading")
+	}
+	if EndsBeforeToday("AAPL", "1d", Interval1Day, daily, saturday) || EndsBeforeToday("BTC-USD", "1m", Interval1Day, daily, saturday) {
+		t.Error("the 1d period and crypto should never count as complete")
+	}
+	intraday := []models.Candle{{Timestamp: daily[0].Timestamp.Add(time.Hour)}, {Timestamp: daily[0].Timestamp}}
+	if EndsBeforeToday("AAPL", "5d", "", intraday, saturday) {
+		t.Error("intraday bars should never count as complete")
+	}
+}
@@ -0,0 +1,137 @@
+package market
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/scmhub/calendar"
+)
+
+// DefaultExchange is used for an empty or unknown exchange name
+const DefaultExchange = "NYSE"
+
+// exchangeCalendars are the trading calendars (immutable, safe to share) of the
+// supported exchanges. Both follow the US equities holidays and early closes.
+var exchangeCalendars = map[string]*calendar.Calendar{
+	"NYSE":   calendar.XNYS(),
+	"NASDAQ": calendar.XNAS(),
+}
+
+// Exchanges lists the exchanges IsMarketOpen knows
+var Exchanges = []string{"NYSE", "NASDAQ"}
+
+// Market-hours settings, set from config at startup
+var (
+	// MarketHolidays are extra closed dates ("2006-01-02", in exchange time) on top of
+	// the exchange calendar, e.g. an unscheduled closure
+	MarketHolidays []string
+	// ExtendedHours counts pre-market (from 04:00 ET) and after-hours (until 20:00 ET,
+	// 17:00 on early-close days) as open
+	ExtendedHours bool
+)
+
+const (
+	preMarketOpen        = 4 * time.Hour
+	afterHoursClose      = 20 * time.Hour
+	earlyAfterHoursClose = 17 * time.Hour
+)
+
+// IsMarketOpen reports whether exchange is trading at now: a weekday that's neither an
+// exchange nor a configured holiday, within the 9:30–16:00 ET session (13:00 on
+// early-close days), widened to the pre- and post-market windows with ExtendedHours.
+// CryptoExchange is always open.
+func IsMarketOpen(now time.Time, exchange string) bool {
+	return IsSessionOpen(now, exchange, ExtendedHours)
+}
+
+// IsSessionOpen is IsMarketOpen counting the pre- and post-market windows as open when
+// extended, whatever ExtendedHours says
+func IsSessionOpen(now time.Time, exchange string, extended bool) bool {
+	if strings.EqualFold(exchange, CryptoExchange) {
+		return true
+	}
+	opensAt, closesAt, ok := session(now, exchange, extended)
+	return ok && !now.Before(opensAt) && now.Before(closesAt)
+}
+
+// NextMarketOpen returns when exchange's next session starts after now
+func NextMarketOpen(now time.Time, exchange string) time.Time {
+	return nextSessionTime(now, exchange, ExtendedHours, func(opensAt, _ time.Time) time.Time { return opensAt })
+}
+
+// NextMarketClose returns when exchange's current or next session ends
+func NextMarketClose(now time.Time, exchange string) time.Time {
+	return nextSessionTime(now, exchange, ExtendedHours, func(_, closesAt time.Time) time.Time { return closesAt })
+}
+
+// NextSessionChange returns when exchange next opens or closes after now, counting the
+// pre- and post-market windows when extended
+func NextSessionChange(now time.Time, exchange string, extended bool) time.Time {
+	if IsSessionOpen(now, exchange, extended) {
+		return nextSessionTime(now, exchange, extended, func(_, closesAt time.Time) time.Time { return closesAt })
+	}
+	return nextSessionTime(now, exchange, extended, func(opensAt, _ time.Time) time.Time { return opensAt })
+}
+
+// nextSessionTime scans forward from now's date for the first session boundary after now.
+// Two weeks comfortably covers the longest run of closures. CryptoExchange has no
+// sessions, so it gets the zero time.
+func nextSessionTime(now time.Time, exchange string, extended bool, boundary func(opensAt, closesAt time.Time) time.Time) time.Time {
+	if strings.EqualFold(exchange, CryptoExchange) {
+		return time.Time{}
+	}
+	day := now.In(exchangeLocation)
+	for i := 0; i < 14; i++ {
+		if opensAt, closesAt, ok := session(day.AddDate(0, 0, i), exchange, extended); ok {
+			if t := boundary(opensAt, closesAt); t.After(now) {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// InExtendedSession reports whether t falls in exchange's pre-market or after-hours
+// window but outside its regular session, whether or not ExtendedHours counts those
+// windows as open. Crypto has no extended hours.
+func InExtendedSession(t time.Time, exchange string) bool {
+	if strings.EqualFold(exchange, CryptoExchange) {
+		return false
+	}
+	opensAt, closesAt, ok := session(t, exchange, true)
+	if !ok || t.Before(opensAt) || !t.Before(closesAt) {
+		return false
+	}
+	regularOpen, regularClose, _ := session(t, exchange, false)
+	return t.Before(regularOpen) || !t.Before(regularClose)
+}
+
+// session returns the trading session on t's date in exchange time, widened to the pre-
+// and post-market windows when extended, or false when the exchange is closed all day
+func session(t time.Time, exchange string, extended bool) (opensAt, closesAt time.Time, ok bool) {
+	cal, known := exchangeCalendars[strings.ToUpper(exchange)]
+	if !known {
+		cal = exchangeCalendars[DefaultExchange]
+	}
+
+	t = t.In(exchangeLocation)
+	if !cal.IsBusinessDay(t) || slices.Contains(MarketHolidays, t.Format("2006-01-02")) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, exchangeLocation)
+	hours := cal.Session()
+	opensAt, closesAt = day.Add(hours.Open), day.Add(hours.Close)
+	earlyClose := cal.IsEarlyClose(t)
+	if earlyClose {
+		closesAt = day.Add(hours.EarlyClose)
+	}
+	if extended {
+		opensAt, closesAt = day.Add(preMarketOpen), day.Add(afterHoursClose)
+		if earlyClose {
+			closesAt = day.Add(earlyAfterHoursClose)
+		}
+	}
+	return opensAt, closesAt, true
+}
@@ -0,0 +1,33 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionExtendedWindow(t *testing.T) {
+	et := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 5, hour, minute, 0, 0, exchangeLocation) // a Tuesday
+	}
+	cases := []struct {
+		now      time.Time
+		extended bool
+		open     bool
+		next     time.Time
+	}{
+		{et(7, 0), false, false, et(9, 30)},
+		{et(7, 0), true, true, et(20, 0)},
+		{et(3, 0), true, false, et(4, 0)},
+		{et(17, 0), false, false, time.Date(2024, 3, 6, 9, 30, 0, 0, exchangeLocation)},
+		{et(17, 0), true, true, et(20, 0)},
+		{et(12, 0), false, true, et(16, 0)},
+	}
+	for _, c := range cases {
+		if got := IsSessionOpen(c.now, DefaultExchange, c.extended); got != c.open {
+			t.Errorf("IsSessionOpen(%s, extended=%v) = %v, want %v", c.now.Format(time.Kitchen), c.extended, got, c.open)
+		}
+		if got := NextSessionChange(c.now, DefaultExchange, c.extended); !got.Equal(c.next) {
+			t.Errorf("NextSessionChange(%s, extended=%v) = %s, want %s", c.now.Format(time.Kitchen), c.extended, got, c.next)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package market
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"stockmarket/internal/apperr"
+	"stockmarket/internal/models"
+)
+
+// Candle intervals accepted by GetHistoricalData. An empty interval lets the
+// provider pick its default bar size for the period.
+const (
+	Interval1Min  = "1min"
+	Interval5Min  = "5min"
+	Interval15Min = "15min"
+	Interval1Hour = "1h"
+	Interval1Day  = "1d"
+)
+
+// Intervals lists the supported intervals, finest first
+var Intervals = []string{Interval1Min, Interval5Min, Interval15Min, Interval1Hour, Interval1Day}
+
+// periods are the history lengths providers understand, shortest first
+var periods = []string{"1d", "5d", "1m", "3m", "6m", "1y", "5y"}
+
+// ErrUnsupportedInterval is returned for an interval a provider can't serve over the
+// requested period
+var ErrUnsupportedInterval = apperr.New(apperr.InvalidRequest, "unsupported interval")
+
+// intervalLimits are the longest period each provider serves an interval over. They
+// follow the providers' own intraday history limits, and rule out requests like
+// 1min bars over a year that would return tens of thousands of points.
+var intervalLimits = map[string]map[string]string{
+	"yahoo": {
+		Interval1Min:  "5d", // Yahoo keeps 1-minute bars for about a week
+		Interval5Min:  "1m", // and other intraday bars for 60 days
+		Interval15Min: "1m",
+		Interval1Hour: "1y",
+		Interval1Day:  "5y",
+	},
+	"alphavantage": {
+		Interval1Min:  "1d", // intraday series cover the latest month at most
+		Interval5Min:  "5d",
+		Interval15Min: "1m",
+		Interval1Hour: "1m",
+		Interval1Day:  "5y",
+	},
+	"finnhub": {
+		Interval1Min:  "5d",
+		Interval5Min:  "1m",
+		Interval15Min: "3m",
+		Interval1Hour: "1y",
+		Interval1Day:  "5y",
+	},
+	"polygon": {
+		Interval1Min:  "5d",
+		Interval5Min:  "1m",
+		Interval15Min: "3m",
+		Interval1Hour: "1y",
+		Interval1Day:  "5y",
+	},
+	"binance": { // paged 1000 bars at a time, so limits only bound the page count
+		Interval1Min:  "5d",
+		Interval5Min:  "1m",
+		Interval15Min: "3m",
+		Interval1Hour: "1y",
+		Interval1Day:  "5y",
+	},
+	"mock": { // intraday bars walk each whole day, so long spans are slow to generate
+		Interval1Min:  "5d",
+		Interval5Min:  "1m",
+		Interval15Min: "3m",
+		Interval1Hour: "3m",
+		Interval1Day:  "5y",
+	},
+}
+
+// ValidInterval reports whether interval is one of Intervals
+func ValidInterval(interval string) bool {
+	return slices.Contains(Intervals, interval)
+}
+
+// ValidateInterval checks that the named provider can serve interval bars over period.
+// An empty interval is always valid. The error lists the provider's supported pairs.
+func ValidateInterval(provider, period, interval string) error {
+	if interval == "" {
+		return nil
+	}
+	limits, ok := intervalLimits[provider]
+	if !ok {
+		return fmt.Errorf("%w: unknown provider %s", ErrUnsupportedInterval, provider)
+	}
+	if !ValidInterval(interval) {
+		return fmt.Errorf("%w %q: must be one of %s", ErrUnsupportedInterval, interval, strings.Join(Intervals, ", "))
+	}
+	p := slices.Index(periods, period)
+	if p < 0 {
+		return fmt.Errorf("%w: unknown period %q, must be one of %s", ErrUnsupportedInterval, period, strings.Join(periods, ", "))
+	}
+	if p > slices.Index(periods, limits[interval]) {
+		return fmt.Errorf("%w: %s %s bars over %s; supported: %s", ErrUnsupportedInterval, provider, interval, period, SupportedIntervals(provider))
+	}
+	return nil
+}
+
+// SupportedIntervals describes the interval/period pairs a provider serves, e.g.
+// "1min up to 5d, 5min up to 1m, ..."
+func SupportedIntervals(provider string) string {
+	limits := intervalLimits[provider]
+	pairs := make([]string, 0, len(Intervals))
+	for _, interval := range Intervals {
+		if longest, ok := limits[interval]; ok {
+			pairs = append(pairs, interval+" up to "+longest)
+		}
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// periodLengths approximate each period for trimming history to it
+var periodLengths = map[string]time.Duration{
+	"1d": 24 * time.Hour,
+	"5d": 7 * 24 * time.Hour, // five sessions span a weekend
+	"1m": 31 * 24 * time.Hour,
+	"3m": 92 * 24 * time.Hour,
+	"6m": 183 * 24 * time.Hour,
+	"1y": 366 * 24 * time.Hour,
+	"5y": 5 * 366 * 24 * time.Hour,
+}
+
+// ComparePeriods orders periods by length, for sorting them shortest first. Unknown
+// periods sort after known ones.
+func ComparePeriods(a, b string) int {
+	la, aok := periodLengths[a]
+	lb, bok := periodLengths[b]
+	switch {
+	case aok && bok:
+		return cmp.Compare(la, lb)
+	case aok:
+		return -1
+	case bok:
+		return 1
+	}
+	return 0
+}
+
+// trimToPeriod keeps newest-first candles within period of the latest one, for
+// providers that return a fixed number of bars regardless of the period asked for.
+// Measuring from the latest bar keeps "1d" meaningful over a weekend.
+func trimToPeriod(candles []models.Candle, period string) []models.Candle {
+	length, ok := periodLengths[period]
+	if !ok || len(candles) == 0 {
+		return candles
+	}
+	cutoff := candles[0].Timestamp.Add(-length)
+	for i, c := range candles {
+		if !c.Timestamp.After(cutoff) {
+			return candles[:i]
+		}
+	}
+	return candles
+}
@@ -0,0 +1,339 @@
+package market
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"slices"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// MockSeed picks the mock provider's price series; runs with the same seed see the
+// same prices for every symbol. Set from config at startup.
+var MockSeed int64 = 1
+
+// mockEpoch is the first day of every mock price series
+var mockEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	mockStep        = 5 * time.Second // resolution of the intraday walk
+	mockStepsPerDay = int(24 * time.Hour / mockStep)
+	mockDrift       = 0.0003 // mean daily return
+	mockStockVol    = 0.02   // widest daily move, as a share of the price
+	mockCryptoVol   = 0.04
+)
+
+// Mock implements the Provider interface with generated prices, for demos and offline
+// use; it makes no network calls and needs no API key. Each symbol follows its own
+// random walk seeded from the symbol and MockSeed, one close a day since mockEpoch and
+// a 5-second walk within each day between consecutive closes, so quotes, candles and
+// streamed ticks agree with each other and repeat exactly across runs. Stock candles
+// skip weekends; crypto pairs trade every day.
+type Mock struct{}
+
+// NewMock creates a new mock provider
+func NewMock() *Mock {
+	return &Mock{}
+}
+
+// Name returns the provider name
+func (m *Mock) Name() string {
+	return "mock"
+}
+
+// mockSeries is one symbol's generated price history up to a day
+type mockSeries struct {
+	seed   uint64
+	vol    float64
+	volume float64   // typical daily volume
+	closes []float64 // closes[d] is the close of day d after mockEpoch
+	crypto bool
+}
+
+// newMockSeries generates symbol's daily closes through day
+func newMockSeries(symbol string, day int) *mockSeries {
+	h := fnv.New64a()
+	h.Write([]byte(symbol))
+	s := &mockSeries{seed: h.Sum64() ^ splitmix(uint64(MockSeed)), vol: mockStockVol, crypto: IsCrypto(symbol)}
+
+	// Starting prices and volumes are spread log-uniformly: $5-$500 and 100k-10M
+	// shares for stocks, $0.50-$50,000 and 1k-1M units for crypto
+	low, high, minVolume, maxVolume := 5.0, 500.0, 1e5, 1e7
+	if s.crypto {
+		s.vol = mockCryptoVol
+		low, high, minVolume, maxVolume = 0.5, 50000.0, 1e3, 1e6
+	}
+	s.volume = logUniform(minVolume, maxVolume, mockNoise(s.seed, 0, 1))
+
+	s.closes = make([]float64, day+1)
+	price := logUniform(low, high, mockNoise(s.seed, 0, 0))
+	for d := range s.closes {
+		if d > 0 {
+			price *= 1 + mockDrift + s.vol*mockNoise(s.seed, uint64(d), 0)
+		}
+		s.closes[d] = price
+	}
+	return s
+}
+
+// open is a day's opening price: the previous day's close
+func (s *mockSeries) open(day int) float64 {
+	if day == 0 {
+		return s.closes[0]
+	}
+	return s.closes[day-1]
+}
+
+// path walks day from its open to its close in mockStep steps, as a Brownian bridge
+// pinned at both ends so intraday prices always meet the daily closes
+func (s *mockSeries) path(day int) []float64 {
+	open, close_ := s.open(day), s.closes[day]
+	size := s.vol * open * math.Sqrt(3/float64(mockStepsPerDay)) / 2
+
+	walk := make([]float64, mockStepsPerDay+1)
+	for k := 1; k <= mockStepsPerDay; k++ {
+		walk[k] = walk[k-1] + size*mockNoise(s.seed, uint64(day), 2, uint64(k))
+	}
+	prices := make([]float64, mockStepsPerDay+1)
+	for k := range prices {
+		t := float64(k) / float64(mockStepsPerDay)
+		prices[k] = open + (close_-open)*t + walk[k] - t*walk[mockStepsPerDay]
+	}
+	return prices
+}
+
+// dayVolume is a day's total volume
+func (s *mockSeries) dayVolume(day int) float64 {
+	return s.volume * (1 + 0.5*mockNoise(s.seed, uint64(day), 1))
+}
+
+// volumeThrough is the volume traded on day up to step k
+func (s *mockSeries) volumeThrough(day, k int) int64 {
+	return int64(s.dayVolume(day) * float64(k) / float64(mockStepsPerDay))
+}
+
+// mockPosition is the day after mockEpoch and step within it that t falls in
+func mockPosition(t time.Time) (day, step int) {
+	since := t.Sub(mockEpoch)
+	if since < 0 {
+		return 0, 0
+	}
+	day = int(since / (24 * time.Hour))
+	step = int(since % (24 * time.Hour) / mockStep)
+	return day, step
+}
+
+// mockTime is the start of step on day
+func mockTime(day, step int) time.Time {
+	return mockEpoch.AddDate(0, 0, day).Add(time.Duration(step) * mockStep)
+}
+
+// GetQuote generates the current quote for a symbol from today's walk so far
+func (m *Mock) GetQuote(ctx context.Context, symbol string) (*models.Quote, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	day, step := mockPosition(time.Now())
+	s := newMockSeries(symbol, day)
+	path := s.path(day)
+
+	price, open, previous := mockRound(path[step]), mockRound(path[0]), mockRound(s.open(day))
+	quote := &models.Quote{
+		Symbol:        symbol,
+		Price:         price,
+		Open:          open,
+		High:          mockRound(slices.Max(path[:step+1])),
+		Low:           mockRound(slices.Min(path[:step+1])),
+		Volume:        s.volumeThrough(day, step),
+		PreviousClose: previous,
+		Change:        mockRound(price - previous),
+		ChangePercent: (price/previous - 1) * 100,
+		Timestamp:     normalizeTimestamp(m.Name(), mockTime(day, step)),
+		Currency:      SymbolCurrency(symbol),
+	}
+	return quote, nil
+}
+
+// GetQuotes generates quotes for several symbols
+func (m *Mock) GetQuotes(ctx context.Context, symbols []string) (map[string]models.Quote, error) {
+	return fanOutQuotes(ctx, symbols, m.GetQuote)
+}
+
+// mockBarSteps are the walk steps in each intraday interval
+var mockBarSteps = map[string]int{
+	Interval1Min:  int(time.Minute / mockStep),
+	Interval5Min:  int(5 * time.Minute / mockStep),
+	Interval15Min: int(15 * time.Minute / mockStep),
+	Interval1Hour: int(time.Hour / mockStep),
+}
+
+// GetHistoricalData generates OHLCV candles for a symbol, newest first. Bar sizes
+// follow Yahoo's: 1d (5m bars), 5d (15m bars), 1m through 1y (daily bars) and 5y
+// (weekly bars), with anything else falling back to one month of daily bars. A
+// non-empty interval overrides the bar size.
+func (m *Mock) GetHistoricalData(ctx context.Context, symbol string, period string, barInterval string) ([]models.Candle, error) {
+	if err := ValidateInterval(m.Name(), period, barInterval); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	interval := barInterval
+	if interval == "" {
+		switch period {
+		case "1d":
+			interval = Interval5Min
+		case "5d":
+			interval = Interval15Min
+		case "5y":
+			interval = "1w"
+		default:
+			interval = Interval1Day
+		}
+	}
+	length, ok := periodLengths[period]
+	if !ok {
+		length = periodLengths["1m"]
+	}
+
+	now := time.Now()
+	day, step := mockPosition(now)
+	first, firstStep := mockPosition(now.Add(-length))
+	s := newMockSeries(symbol, day)
+
+	var candles []models.Candle
+	if steps, ok := mockBarSteps[interval]; ok {
+		candles = s.intradayCandles(first, firstStep, day, step, steps)
+	} else {
+		candles = s.dailyCandles(first, day, step)
+		if interval == "1w" {
+			candles = weeklyCandles(candles)
+		}
+	}
+	for i := range candles {
+		candles[i].Timestamp = normalizeTimestamp(m.Name(), candles[i].Timestamp)
+	}
+	slices.Reverse(candles)
+	return candles, nil
+}
+
+// trades reports whether the series has bars on day; stocks don't trade at weekends
+func (s *mockSeries) trades(day int) bool {
+	weekday := mockTime(day, 0).Weekday()
+	return s.crypto || weekday != time.Saturday && weekday != time.Sunday
+}
+
+// intradayCandles builds bars of steps walk steps from the one holding firstStep on
+// day first through the one holding lastStep on day last, oldest first
+func (s *mockSeries) intradayCandles(first, firstStep, last, lastStep, steps int) []models.Candle {
+	var candles []models.Candle
+	for day := first; day <= last; day++ {
+		if !s.trades(day) {
+			continue
+		}
+		path := s.path(day)
+		begin, end, limit := 0, mockStepsPerDay, mockStepsPerDay
+		if day == first {
+			begin = firstStep / steps * steps
+		}
+		if day == last {
+			end, limit = lastStep, lastStep+1
+		}
+		for start := begin; start < limit; start += steps {
+			stop := min(start+steps, end)
+			bar := path[start : stop+1]
+			candles = append(candles, models.Candle{
+				Timestamp: mockTime(day, start),
+				Open:      mockRound(bar[0]),
+				High:      mockRound(slices.Max(bar)),
+				Low:       mockRound(slices.Min(bar)),
+				Close:     mockRound(bar[len(bar)-1]),
+				Volume:    s.volumeThrough(day, stop) - s.volumeThrough(day, start),
+			})
+		}
+	}
+	return candles
+}
+
+// dailyCandles builds one bar a day from first through last, oldest first. Finished
+// days get a high and low a random distance beyond their open and close, rather
+// than walking every day; the last day is the walk so far through step.
+func (s *mockSeries) dailyCandles(first, last, step int) []models.Candle {
+	var candles []models.Candle
+	for day := first; day <= last; day++ {
+		if !s.trades(day) {
+			continue
+		}
+		candle := models.Candle{Timestamp: mockTime(day, 0), Open: s.open(day), Close: s.closes[day]}
+		if day == last {
+			path := s.path(day)[:step+1]
+			candle.Close, candle.High, candle.Low = path[step], slices.Max(path), slices.Min(path)
+			candle.Volume = s.volumeThrough(day, step)
+		} else {
+			spread := s.vol / 2
+			candle.High = math.Max(candle.Open, candle.Close) * (1 + spread*math.Abs(mockNoise(s.seed, uint64(day), 3)))
+			candle.Low = math.Min(candle.Open, candle.Close) * (1 - spread*math.Abs(mockNoise(s.seed, uint64(day), 4)))
+			candle.Volume = int64(s.dayVolume(day))
+		}
+		candle.Open, candle.High, candle.Low, candle.Close = mockRound(candle.Open), mockRound(candle.High), mockRound(candle.Low), mockRound(candle.Close)
+		candles = append(candles, candle)
+	}
+	return candles
+}
+
+// weeklyCandles merges daily candles, oldest first, into weeks starting on Monday
+func weeklyCandles(daily []models.Candle) []models.Candle {
+	var weeks []models.Candle
+	for _, c := range daily {
+		monday := c.Timestamp.AddDate(0, 0, -(int(c.Timestamp.Weekday())+6)%7)
+		if n := len(weeks); n > 0 && weeks[n-1].Timestamp.Equal(monday) {
+			week := &weeks[n-1]
+			week.High, week.Low = math.Max(week.High, c.High), math.Min(week.Low, c.Low)
+			week.Close = c.Close
+			week.Volume += c.Volume
+			continue
+		}
+		c.Timestamp = monday
+		weeks = append(weeks, c)
+	}
+	return weeks
+}
+
+// StreamQuotes streams generated ticks, stepping through the walk every few seconds
+func (m *Mock) StreamQuotes(ctx context.Context, sub *Subscription, ch chan<- models.Quote) error {
+	return pollQuotes(ctx, sub, pollIntervals[m.Name()], m.GetQuote, ch)
+}
+
+// mockRound rounds a generated price to cents, or to six decimals below a dollar
+func mockRound(price float64) float64 {
+	scale := 100.0
+	if price < 1 {
+		scale = 1e6
+	}
+	return math.Round(price*scale) / scale
+}
+
+// logUniform maps noise in [-1, 1) onto [low, high) evenly on a log scale
+func logUniform(low, high, noise float64) float64 {
+	return math.Exp(math.Log(low) + (noise+1)/2*(math.Log(high)-math.Log(low)))
+}
+
+// mockNoise is a deterministic pseudo-random value in [-1, 1) for a seed and keys
+func mockNoise(seed uint64, keys ...uint64) float64 {
+	h := seed
+	for _, k := range keys {
+		h = splitmix(h ^ k)
+	}
+	return float64(h>>11)/(1<<53)*2 - 1
+}
+
+// splitmix is the SplitMix64 finalizer, which spreads every input bit over the output
+func splitmix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
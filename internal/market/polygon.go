@@ -0,0 +1,621 @@
+package market
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"stockmarket/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+const polygonBaseURL = "https://api.polygon.io"
+
+const polygonWSURL = "wss://socket.polygon.io/stocks"
+
+// Streaming timings: how long the feed may take to answer the auth, and how long to
+// wait before reconnecting a feed that dropped
+const (
+	polygonAuthTimeout    = 10 * time.Second
+	polygonReconnectDelay = 2 * time.Second
+)
+
+// Polygon implements the Provider interface for the Polygon.io API
+type Polygon struct {
+	apiKey  string
+	client  *http.Client
+	baseURL string
+	wsURL   string
+}
+
+// NewPolygon creates a new Polygon provider
+func NewPolygon(apiKey string) *Polygon {
+	return &Polygon{
+		apiKey:  apiKey,
+		client:  sharedHTTPClient,
+		baseURL: polygonBaseURL,
+		wsURL:   polygonWSURL,
+	}
+}
+
+// Name returns the provider name
+func (p *Polygon) Name() string {
+	return "polygon"
+}
+
+// polygonSnapshot is a ticker in Polygon's snapshot responses
+type polygonSnapshot struct {
+	Ticker           string  `json:"ticker"`
+	TodaysChange     float64 `json:"todaysChange"`
+	TodaysChangePerc float64 `json:"todaysChangePerc"`
+	Updated          int64   `json:"updated"` // nanoseconds
+	Day              struct {
+		O float64 `json:"o"`
+		H float64 `json:"h"`
+		L float64 `json:"l"`
+		C float64 `json:"c"`
+		V float64 `json:"v"`
+	} `json:"day"`
+	PrevDay struct {
+		C float64 `json:"c"`
+	} `json:"prevDay"`
+	LastTrade struct {
+		P float64 `json:"p"`
+		T int64   `json:"t"` // nanoseconds
+	} `json:"lastTrade"`
+	LastQuote struct {
+		Ask float64 `json:"P"`
+		Bid float64 `json:"p"`
+	} `json:"lastQuote"`
+}
+
+// quote converts a snapshot to a Quote. The day bar is empty before the session
+// opens, so the price falls back to the last trade and then the previous close. A last
+// trade outside the regular session is the extended-hours price instead, leaving the
+// price at the session's close.
+func (s *polygonSnapshot) quote(provider string) *models.Quote {
+	price := cmp.Or(s.LastTrade.P, s.Day.C, s.PrevDay.C)
+	updated := s.Updated
+	if updated == 0 {
+		updated = s.LastTrade.T
+	}
+	var timestamp time.Time
+	if updated > 0 {
+		timestamp = normalizeTimestamp(provider, time.Unix(0, updated))
+	}
+	quote := &models.Quote{
+		Symbol:        s.Ticker,
+		Currency:      SymbolCurrency(s.Ticker),
+		Price:         price,
+		Open:          s.Day.O,
+		High:          s.Day.H,
+		Low:           s.Day.L,
+		Volume:        int64(s.Day.V),
+		PreviousClose: s.PrevDay.C,
+		Change:        s.TodaysChange,
+		ChangePercent: s.TodaysChangePerc,
+		Timestamp:     timestamp,
+		Bid:           s.LastQuote.Bid,
+		Ask:           s.LastQuote.Ask,
+	}
+	if s.LastTrade.T > 0 {
+		tradedAt := normalizeTimestamp(provider, time.Unix(0, s.LastTrade.T))
+		if InExtendedSession(tradedAt, SymbolExchange(s.Ticker)) {
+			quote.Price = cmp.Or(s.Day.C, s.PrevDay.C, s.LastTrade.P)
+			if quote.PreviousClose > 0 {
+				quote.Change = quote.Price - quote.PreviousClose
+				quote.ChangePercent = quote.Change / quote.PreviousClose * 100
+			}
+			setExtendedHours(quote, s.LastTrade.P, tradedAt)
+		}
+	}
+	return quote
+}
+
+// GetQuote fetches the current quote for a symbol from its snapshot, which needs a
+// paid plan; the free tier gets ErrNotAuthorized
+func (p *Polygon) GetQuote(ctx context.Context, symbol string) (*models.Quote, error) {
+	var result struct {
+		Ticker polygonSnapshot `json:"ticker"`
+	}
+	path := "/v2/snapshot/locale/us/markets/stocks/tickers/" + url.PathEscape(symbol)
+	if err := p.get(ctx, path, nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Ticker.Ticker == "" {
+		return nil, ErrInvalidSymbol
+	}
+	return result.Ticker.quote(p.Name()), nil
+}
+
+// GetQuotes fetches quotes for several symbols in one snapshot request. Symbols
+// missing from the response are reported in a *BatchError.
+func (p *Polygon) GetQuotes(ctx context.Context, symbols []string) (map[string]models.Quote, error) {
+	var result struct {
+		Tickers []polygonSnapshot `json:"tickers"`
+	}
+	query := url.Values{"tickers": {strings.Join(symbols, ",")}}
+	if err := p.get(ctx, "/v2/snapshot/locale/us/markets/stocks/tickers", query, &result); err != nil {
+		return nil, err
+	}
+
+	quotes := make(map[string]models.Quote, len(symbols))
+	for i := range result.Tickers {
+		quote := result.Tickers[i].quote(p.Name())
+		quotes[quote.Symbol] = *quote
+	}
+	errs := make(map[string]error)
+	for _, symbol := range symbols {
+		if _, ok := quotes[symbol]; !ok {
+			errs[symbol] = ErrInvalidSymbol
+		}
+	}
+	if len(errs) > 0 {
+		return quotes, &BatchError{Errors: errs}
+	}
+	return quotes, nil
+}
+
+// polygonSpan is an aggregate bar size
+type polygonSpan struct {
+	multiplier int
+	timespan   string
+}
+
+// polygonSpans maps Intervals to Polygon aggregate bar sizes
+var polygonSpans = map[string]polygonSpan{
+	Interval1Min:  {1, "minute"},
+	Interval5Min:  {5, "minute"},
+	Interval15Min: {15, "minute"},
+	Interval1Hour: {1, "hour"},
+	Interval1Day:  {1, "day"},
+}
+
+// polygonPeriodSpans are the default bar sizes for each period
+var polygonPeriodSpans = map[string]polygonSpan{
+	"1d": {5, "minute"},
+	"5d": {15, "minute"},
+	"1m": {1, "day"},
+	"3m": {1, "day"},
+	"6m": {1, "day"},
+	"1y": {1, "day"},
+	"5y": {1, "week"},
+}
+
+// polygonRangeSlack widens the requested date range so short periods still reach
+// back to the last session over weekends and holidays; results are trimmed to period
+const polygonRangeSlack = 4 * 24 * time.Hour
+
+// GetHistoricalData fetches historical OHLCV data from Polygon's aggregates. Supported
+// periods are 1d (5m bars), 5d (15m bars), 1m, 3m, 6m, 1y (daily bars) and 5y (weekly
+// bars); anything else falls back to one month of daily bars. A non-empty interval
+// overrides the bar size.
+func (p *Polygon) GetHistoricalData(ctx context.Context, symbol string, period string, interval string) ([]models.Candle, error) {
+	if err := ValidateInterval(p.Name(), period, interval); err != nil {
+		return nil, err
+	}
+
+	if _, ok := periodLengths[period]; !ok {
+		period = "1m"
+	}
+	span := polygonPeriodSpans[period]
+	if interval != "" {
+		span = polygonSpans[interval]
+	}
+	to := time.Now()
+	from := to.Add(-periodLengths[period] - polygonRangeSlack)
+
+	var result struct {
+		Results []struct {
+			O float64 `json:"o"`
+			H float64 `json:"h"`
+			L float64 `json:"l"`
+			C float64 `json:"c"`
+			V float64 `json:"v"`
+			T int64   `json:"t"` // milliseconds
+		} `json:"results"`
+	}
+	path := fmt.Sprintf("/v2/aggs/ticker/%s/range/%d/%s/%d/%d",
+		url.PathEscape(symbol), span.multiplier, span.timespan, from.UnixMilli(), to.UnixMilli())
+	query := url.Values{"adjusted": {"true"}, "sort": {"desc"}, "limit": {"50000"}}
+	if err := p.get(ctx, path, query, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Results) == 0 {
+		return nil, ErrInvalidSymbol
+	}
+
+	candles := make([]models.Candle, 0, len(result.Results))
+	for _, bar := range result.Results {
+		candles = append(candles, models.Candle{
+			Timestamp: normalizeTimestamp(p.Name(), time.UnixMilli(bar.T)),
+			Open:      bar.O,
+			High:      bar.H,
+			Low:       bar.L,
+			Close:     bar.C,
+			Volume:    int64(bar.V),
+			AdjClose:  bar.C, // requested split-adjusted
+		})
+	}
+	return trimToPeriod(candles, period), nil
+}
+
+// GetSplits lists a symbol's stock splits from Polygon's reference data
+func (p *Polygon) GetSplits(ctx context.Context, symbol string) ([]models.Split, error) {
+	var result struct {
+		Results []struct {
+			ExecutionDate string  `json:"execution_date"`
+			SplitFrom     float64 `json:"split_from"`
+			SplitTo       float64 `json:"split_to"`
+		} `json:"results"`
+	}
+	query := url.Values{"ticker": {symbol}, "limit": {"1000"}}
+	if err := p.get(ctx, "/v3/reference/splits", query, &result); err != nil {
+		return nil, err
+	}
+
+	splits := make([]models.Split, 0, len(result.Results))
+	for _, r := range result.Results {
+		date, err := time.ParseInLocation("2006-01-02", r.ExecutionDate, exchangeLocation)
+		if err != nil || r.SplitFrom <= 0 || r.SplitTo <= 0 {
+			continue
+		}
+		splits = append(splits, models.Split{Date: date, Ratio: r.SplitTo / r.SplitFrom})
+	}
+	return splits, nil
+}
+
+// SearchSymbols looks up active tickers by symbol or company name in Polygon's
+// reference data
+func (p *Polygon) SearchSymbols(ctx context.Context, query string) ([]models.SymbolMatch, error) {
+	var result struct {
+		Results []struct {
+			Ticker          string `json:"ticker"`
+			Name            string `json:"name"`
+			Market          string `json:"market"`
+			PrimaryExchange string `json:"primary_exchange"`
+			Type            string `json:"type"`
+		} `json:"results"`
+	}
+	params := url.Values{"search": {query}, "active": {"true"}, "limit": {"20"}}
+	if err := p.get(ctx, "/v3/reference/tickers", params, &result); err != nil {
+		return nil, err
+	}
+
+	matches := make([]models.SymbolMatch, 0, len(result.Results))
+	for _, r := range result.Results {
+		match := models.SymbolMatch{
+			Symbol:   r.Ticker,
+			Name:     r.Name,
+			Exchange: r.PrimaryExchange,
+			Type:     matchType(r.Type),
+		}
+		if r.Market == "crypto" {
+			match.Type = "crypto"
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// get calls a Polygon REST endpoint and decodes the response into out. Polygon's
+// error envelope is turned into ErrRateLimited, ErrNotAuthorized, ErrInvalidSymbol
+// or ErrAPIError carrying its message.
+func (p *Polygon) get(ctx context.Context, path string, query url.Values, out any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("apiKey", p.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := doWithRetry(p.Name(), p.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var envelope struct {
+		Status  string `json:"status"`
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(body, &envelope)
+	if err := polygonError(resp.StatusCode, envelope.Status, cmp.Or(envelope.Message, envelope.Error)); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%w: polygon returned an unreadable response: %v", ErrAPIError, err)
+	}
+	return nil
+}
+
+// polygonError maps a Polygon response status and envelope to an error, or nil for
+// a successful response
+func polygonError(statusCode int, status, message string) error {
+	if statusCode == http.StatusOK && status != "ERROR" && status != "NOT_AUTHORIZED" {
+		return nil
+	}
+	message = cmp.Or(message, http.StatusText(statusCode))
+
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: polygon: %s", ErrRateLimited, message)
+	case statusCode == http.StatusForbidden || status == "NOT_AUTHORIZED":
+		return fmt.Errorf("%w: polygon: %s", ErrNotAuthorized, message)
+	case statusCode == http.StatusNotFound || status == "NOT_FOUND":
+		return ErrInvalidSymbol
+	default:
+		return fmt.Errorf("%w: polygon: %s", ErrAPIError, message)
+	}
+}
+
+// polygonEvent is a message on Polygon's WebSocket feed: a status update or a
+// per-second aggregate ("A") for a subscribed symbol
+type polygonEvent struct {
+	Ev      string `json:"ev"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+
+	Sym       string  `json:"sym"`
+	Open      float64 `json:"op"` // today's official open
+	High      float64 `json:"h"`
+	Low       float64 `json:"l"`
+	Close     float64 `json:"c"`
+	DayVolume float64 `json:"av"` // accumulated volume for the day
+	End       int64   `json:"e"`  // end of the aggregate window, milliseconds
+}
+
+// StreamQuotes streams quotes from Polygon's WebSocket feed of per-second aggregates.
+// A feed that drops mid-session is reconnected, resubscribing and reseeding every
+// symbol. Plans without streaming access, and feeds that can't be reached or
+// reconnected, fall back to polling snapshots.
+func (p *Polygon) StreamQuotes(ctx context.Context, sub *Subscription, ch chan<- models.Quote) error {
+	for {
+		conn, err := p.dialStream(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.Warn("polygon streaming unavailable, polling instead", "error", err)
+			return pollQuotes(ctx, sub, pollIntervals[p.Name()], p.GetQuote, ch)
+		}
+
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		err = p.streamAggregates(ctx, conn, sub, ch)
+		stop()
+		conn.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		slog.Warn("polygon stream dropped, reconnecting", "error", err, "delay", polygonReconnectDelay)
+
+		timer := time.NewTimer(polygonReconnectDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// dialStream connects and authenticates to the WebSocket feed, giving up if the feed
+// doesn't answer the auth within polygonAuthTimeout
+func (p *Polygon) dialStream(ctx context.Context) (*websocket.Conn, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, p.wsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.WriteJSON(map[string]string{"action": "auth", "params": p.apiKey}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// The feed announces the connection, then answers the auth
+	conn.SetReadDeadline(time.Now().Add(polygonAuthTimeout))
+	for {
+		var events []polygonEvent
+		if err := conn.ReadJSON(&events); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		for _, ev := range events {
+			switch ev.Status {
+			case "auth_success":
+				conn.SetReadDeadline(time.Time{})
+				return conn, nil
+			case "auth_failed":
+				conn.Close()
+				return nil, fmt.Errorf("%w: polygon: %s", ErrNotAuthorized, ev.Message)
+			}
+		}
+	}
+}
+
+// streamAggregates follows the subscription on an authenticated feed, sending a
+// snapshot quote when a symbol is added and an updated quote for every aggregate
+func (p *Polygon) streamAggregates(ctx context.Context, conn *websocket.Conn, sub *Subscription, ch chan<- models.Quote) error {
+	events := make(chan []polygonEvent)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			var batch []polygonEvent
+			if err := conn.ReadJSON(&batch); err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case events <- batch:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	send := func(quote models.Quote) error {
+		select {
+		case ch <- quote:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// Symbols whose seeding quote failed are reported and seeded again on a backoff;
+	// their aggregates still stream meanwhile
+	quotes := make(map[string]*models.Quote)
+	backoff := newSymbolBackoff(sub, pollIntervals[p.Name()])
+	seed := func(symbol string) error {
+		quote, err := p.GetQuote(ctx, symbol)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			backoff.fail(symbol, err)
+			return nil
+		}
+		backoff.succeed(symbol)
+		*quotes[symbol] = *quote
+		return send(*quote)
+	}
+	resubscribe := func() error {
+		want := make(map[string]bool)
+		var added, removed []string
+		for _, symbol := range sub.Symbols() {
+			want[symbol] = true
+			if _, ok := quotes[symbol]; !ok {
+				added = append(added, symbol)
+			}
+		}
+		for symbol := range quotes {
+			if !want[symbol] {
+				removed = append(removed, symbol)
+				delete(quotes, symbol)
+			}
+		}
+		backoff.prune(sub.Symbols())
+		if len(removed) > 0 {
+			if err := conn.WriteJSON(map[string]string{"action": "unsubscribe", "params": polygonChannels(removed)}); err != nil {
+				return err
+			}
+		}
+		if len(added) == 0 {
+			return nil
+		}
+		if err := conn.WriteJSON(map[string]string{"action": "subscribe", "params": polygonChannels(added)}); err != nil {
+			return err
+		}
+
+		// Seed new symbols with the day's figures the aggregates don't carry
+		for _, symbol := range added {
+			quotes[symbol] = &models.Quote{Symbol: symbol, Currency: SymbolCurrency(symbol)}
+			if err := seed(symbol); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := resubscribe(); err != nil {
+		return err
+	}
+	for {
+		var retry <-chan time.Time
+		if at, ok := backoff.next(); ok {
+			retry = time.After(time.Until(at))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		case <-sub.changed:
+			if err := resubscribe(); err != nil {
+				return err
+			}
+		case <-retry:
+			now := time.Now()
+			for symbol := range backoff.failing {
+				if !backoff.due(symbol, now) {
+					continue
+				}
+				if err := seed(symbol); err != nil {
+					return err
+				}
+			}
+		case batch := <-events:
+			for _, ev := range batch {
+				quote, ok := quotes[ev.Sym]
+				if ev.Ev != "A" || !ok {
+					continue
+				}
+				applyAggregate(quote, p.Name(), ev)
+				if err := send(*quote); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// applyAggregate updates a quote with a per-second aggregate, extending the day's
+// range and recomputing the change from the previous close when it's known. An
+// aggregate outside the regular session only updates the extended-hours price.
+func applyAggregate(quote *models.Quote, provider string, ev polygonEvent) {
+	end := normalizeTimestamp(provider, time.UnixMilli(ev.End))
+	if InExtendedSession(end, SymbolExchange(quote.Symbol)) {
+		setExtendedHours(quote, ev.Close, end)
+		return
+	}
+	setExtendedHours(quote, 0, time.Time{})
+	quote.Price = ev.Close
+	if ev.Open > 0 {
+		quote.Open = ev.Open
+	}
+	if ev.High > quote.High {
+		quote.High = ev.High
+	}
+	if quote.Low == 0 || (ev.Low > 0 && ev.Low < quote.Low) {
+		quote.Low = ev.Low
+	}
+	if ev.DayVolume > 0 {
+		quote.Volume = int64(ev.DayVolume)
+	}
+	if quote.PreviousClose > 0 {
+		quote.Change = quote.Price - quote.PreviousClose
+		quote.ChangePercent = quote.Change / quote.PreviousClose * 100
+	}
+	quote.Timestamp = end
+}
+
+// polygonChannels lists the aggregate channels for symbols, e.g. "A.AAPL,A.MSFT"
+func polygonChannels(symbols []string) string {
+	channels := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		channels[i] = "A." + symbol
+	}
+	return strings.Join(channels, ",")
+}
@@ -0,0 +1,77 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"stockmarket/internal/models"
+)
+
+// TestPolygonStreamReconnects checks that a feed dropping mid-session is reconnected
+// and keeps streaming rather than ending the stream
+func TestPolygonStreamReconnects(t *testing.T) {
+	var sessions atomic.Int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/stocks") {
+			json.NewEncoder(w).Encode(map[string]any{"status": "OK", "ticker": map[string]any{
+				"ticker": "AAPL", "day": map[string]any{"c": 100}, "prevDay": map[string]any{"c": 99},
+			}})
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		session := sessions.Add(1)
+		conn.WriteJSON([]polygonEvent{{Ev: "status", Status: "connected"}})
+		var msg map[string]string
+		conn.ReadJSON(&msg) // auth
+		conn.WriteJSON([]polygonEvent{{Ev: "status", Status: "auth_success"}})
+		conn.ReadJSON(&msg) // subscribe
+		price := 100 + float64(session)
+		conn.WriteJSON([]polygonEvent{{Ev: "A", Sym: "AAPL", Close: price, End: time.Date(2024, 3, 5, 15, 0, 0, 0, time.UTC).UnixMilli()}})
+		if session == 1 {
+			return // drop the first session
+		}
+		conn.ReadJSON(&msg) // hold the second open until the client leaves
+	}))
+	defer server.Close()
+
+	p := NewPolygon("key")
+	p.baseURL = server.URL
+	p.wsURL = "ws" + strings.TrimPrefix(server.URL, "http") + "/stocks"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan models.Quote, 16)
+	done := make(chan error, 1)
+	go func() { done <- p.StreamQuotes(ctx, NewSubscription([]string{"AAPL"}), ch) }()
+
+	for {
+		select {
+		case quote := <-ch:
+			if quote.Price == 102 {
+				cancel()
+				<-done
+				if n := sessions.Load(); n != 2 {
+					t.Errorf("%d sessions, want 2", n)
+				}
+				return
+			}
+		case err := <-done:
+			t.Fatalf("stream ended after %d sessions: %v", sessions.Load(), err)
+		case <-ctx.Done():
+			t.Fatal("no quote from the reconnected session")
+		}
+	}
+}
@@ -3,10 +3,12 @@ package market
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"time"
 
+	"stockmarket/internal/apperr"
 	"stockmarket/internal/models"
 )
 
@@ -28,19 +30,79 @@ var sharedHTTPClient = &http.Client{
 // Provider defines the interface for market data providers
 type Provider interface {
 	GetQuote(ctx context.Context, symbol string) (*models.Quote, error)
-	GetHistoricalData(ctx context.Context, symbol string, period string) ([]models.Candle, error)
-	StreamQuotes(ctx context.Context, symbols []string, ch chan<- models.Quote) error
+	// GetQuotes fetches several quotes; failed symbols are reported in a *BatchError
+	// while the rest are still returned
+	GetQuotes(ctx context.Context, symbols []string) (map[string]models.Quote, error)
+	// GetHistoricalData fetches candles over period, newest first, in bars of interval
+	// (one of Intervals) or the provider's default for the period when it's empty.
+	// Unsupported combinations fail with ErrUnsupportedInterval.
+	GetHistoricalData(ctx context.Context, symbol string, period string, interval string) ([]models.Candle, error)
+	// StreamQuotes streams quotes for a subscription's symbols, following changes to it
+	StreamQuotes(ctx context.Context, sub *Subscription, ch chan<- models.Quote) error
 	Name() string
 }
 
+// TranscriptProvider is implemented by providers that serve earnings-call transcripts
+type TranscriptProvider interface {
+	GetEarningsTranscript(ctx context.Context, symbol string, quarter string) (*models.EarningsTranscript, error)
+}
+
+// FundamentalsProvider is implemented by providers that serve dividend fundamentals
+type FundamentalsProvider interface {
+	GetFundamentals(ctx context.Context, symbol string) (*models.Fundamentals, error)
+}
+
+// SplitProvider is implemented by providers that list a symbol's stock splits, used
+// to adjust the candles of providers that only serve raw prices
+type SplitProvider interface {
+	GetSplits(ctx context.Context, symbol string) ([]models.Split, error)
+}
+
+// TradeProvider is implemented by providers with a real-time trade-level feed
+type TradeProvider interface {
+	StreamTrades(ctx context.Context, symbols []string, ch chan<- models.Trade) error
+}
+
+// Mover list types for MoversProvider
+const (
+	MoversGainers    = "gainers"
+	MoversLosers     = "losers"
+	MoversMostActive = "most_active"
+)
+
+// MoversProvider is implemented by providers with a market screener for top movers
+type MoversProvider interface {
+	GetMovers(ctx context.Context, moverType string) ([]models.Mover, error)
+}
+
+// SymbolSearcher is implemented by providers with a ticker search endpoint. Providers
+// without one can be searched with SearchKnownSymbols.
+type SymbolSearcher interface {
+	SearchSymbols(ctx context.Context, query string) ([]models.SymbolMatch, error)
+}
+
+// ErrNotSupported is returned when a provider doesn't offer the requested data
+var ErrNotSupported = apperr.New(apperr.NotSupported, "not supported by provider")
+
 // ErrRateLimited is returned when rate limit is exceeded
-var ErrRateLimited = errors.New("rate limit exceeded")
+var ErrRateLimited = apperr.New(apperr.RateLimited, "rate limit exceeded")
 
 // ErrInvalidSymbol is returned when the symbol is not found
-var ErrInvalidSymbol = errors.New("invalid symbol")
+var ErrInvalidSymbol = apperr.New(apperr.InvalidSymbol, "invalid symbol")
+
+// ErrAPIError is returned when the API returns an error or can't be reached
+var ErrAPIError = apperr.New(apperr.ProviderUnavailable, "API error")
+
+// ErrNotAuthorized is returned when the provider plan doesn't include the endpoint
+var ErrNotAuthorized = apperr.New(apperr.ProviderUnauthorized, "not authorized for this endpoint")
 
-// ErrAPIError is returned when the API returns an error
-var ErrAPIError = errors.New("API error")
+// Providers lists the registered market data provider names
+var Providers = []string{"alphavantage", "yahoo", "finnhub", "polygon", "binance", "mock"}
+
+// RequiresAPIKey reports whether the named provider needs an API key
+func RequiresAPIKey(name string) bool {
+	return name != "yahoo" && name != "binance" && name != "mock"
+}
 
 // NewProvider creates a market data provider based on the provider name
 func NewProvider(name string, apiKey string) (Provider, error) {
@@ -51,7 +113,22 @@ func NewProvider(name string, apiKey string) (Provider, error) {
 		return NewYahooFinance(), nil
 	case "finnhub":
 		return NewFinnhub(apiKey), nil
+	case "polygon":
+		return NewPolygon(apiKey), nil
+	case "binance":
+		return NewBinance(), nil
+	case "mock":
+		return NewMock(), nil
 	default:
 		return nil, errors.New("unknown provider: " + name)
 	}
 }
+
+// PreviousQuarter returns the most recently completed calendar quarter, e.g. "2024Q4"
+func PreviousQuarter(t time.Time) string {
+	year, quarter := t.Year(), (int(t.Month())-1)/3
+	if quarter == 0 {
+		year, quarter = year-1, 4
+	}
+	return fmt.Sprintf("%dQ%d", year, quarter)
+}
@@ -0,0 +1,42 @@
+package market
+
+import (
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// ApplyYearRange fills in the 52-week high/low from daily candles when the provider
+// didn't supply them, then derives the percent-from-high. Candles older than a year
+// are ignored; symbols with a shorter history use whatever data is available.
+func ApplyYearRange(quote *models.Quote, candles []models.Candle) {
+	if quote.FiftyTwoWeekHigh == 0 && len(candles) > 0 {
+		cutoff := time.Now().AddDate(-1, 0, 0)
+		var high, low float64
+		for _, c := range candles {
+			if c.Timestamp.Before(cutoff) || c.High <= 0 || c.Low <= 0 {
+				continue
+			}
+			if high == 0 || c.High > high {
+				high = c.High
+			}
+			if low == 0 || c.Low < low {
+				low = c.Low
+			}
+		}
+		quote.FiftyTwoWeekHigh = high
+		quote.FiftyTwoWeekLow = low
+	}
+
+	// The live price can exceed a range computed from daily closes
+	if quote.Price > quote.FiftyTwoWeekHigh && quote.FiftyTwoWeekHigh > 0 {
+		quote.FiftyTwoWeekHigh = quote.Price
+	}
+	if quote.Price > 0 && quote.Price < quote.FiftyTwoWeekLow {
+		quote.FiftyTwoWeekLow = quote.Price
+	}
+
+	if quote.FiftyTwoWeekHigh > 0 {
+		quote.PercentFromHigh = (quote.FiftyTwoWeekHigh - quote.Price) / quote.FiftyTwoWeekHigh * 100
+	}
+}
@@ -0,0 +1,155 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitWait is the longest a provider request waits for a token before failing
+// with a RateLimitError; zero fails fast. Set from config at startup.
+var RateLimitWait time.Duration
+
+// RateLimitError is returned when a provider's request budget is exhausted
+type RateLimitError struct {
+	Provider   string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	// Round up so a sub-second wait isn't reported as "retry after 0s"
+	after := time.Duration(math.Ceil(e.RetryAfter.Seconds())) * time.Second
+	return fmt.Sprintf("%s rate limited, retry after %s", e.Provider, after)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// rateLimiter is a token bucket for one provider. Each HTTP request, including
+// retries, takes a token.
+type rateLimiter struct {
+	provider string
+	burst    float64
+	rate     float64 // tokens per second
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+var (
+	rateLimitersMu sync.RWMutex
+	rateLimiters   = make(map[string]*rateLimiter)
+)
+
+// SetRateLimit limits a provider to count requests per interval with bursts of up
+// to burst. The bucket is shared by every instance of the provider, since handlers
+// create their own through NewProvider. A zero count removes the limit.
+func SetRateLimit(provider string, count int, interval time.Duration, burst int) {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	if count <= 0 || interval <= 0 {
+		delete(rateLimiters, provider)
+		return
+	}
+	if burst <= 0 {
+		burst = count
+	}
+	rateLimiters[provider] = &rateLimiter{
+		provider: provider,
+		burst:    float64(burst),
+		rate:     float64(count) / interval.Seconds(),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// waitRateLimit takes a token for a request to provider, waiting up to
+// RateLimitWait (and never past ctx's deadline) for one to become available
+func waitRateLimit(ctx context.Context, provider string) error {
+	rateLimitersMu.RLock()
+	l := rateLimiters[provider]
+	rateLimitersMu.RUnlock()
+	if l == nil {
+		return nil
+	}
+
+	delay := l.reserve(RateLimitWait)
+	if delay < 0 {
+		return &RateLimitError{Provider: provider, RetryAfter: l.retryAfter()}
+	}
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		l.cancel()
+		return &RateLimitError{Provider: provider, RetryAfter: delay}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// refill adds the tokens earned since the last refill; callers hold mu
+func (l *rateLimiter) refill() {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// reserve takes a token, letting the balance go negative so concurrent waiters queue
+// in order. It returns how long the caller must wait for its token, or -1 without
+// taking one if that would be longer than maxWait.
+func (l *rateLimiter) reserve(maxWait time.Duration) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	delay := l.untilTokens(1)
+	if delay > maxWait {
+		return -1
+	}
+	l.tokens--
+	return delay
+}
+
+// cancel returns a reserved token that was never used
+func (l *rateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = math.Min(l.tokens+1, l.burst)
+}
+
+// retryAfter is how long until a token is available
+func (l *rateLimiter) retryAfter() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	return l.untilTokens(1)
+}
+
+// untilTokens is how long until the balance reaches n; callers hold mu
+func (l *rateLimiter) untilTokens(n float64) time.Duration {
+	if l.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - l.tokens) / l.rate * float64(time.Second))
+}
@@ -0,0 +1,107 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryAttempts is how many times a provider HTTP request is tried in total on
+// transient failures; set from config at startup
+var RetryAttempts = 3
+
+// RetryBaseDelay is the backoff before the first retry; it doubles each attempt
+var RetryBaseDelay = 500 * time.Millisecond
+
+// retryableStatus are the responses worth retrying
+var retryableStatus = map[int]bool{
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// CallRecorder, if set, receives the final status (0 without a response), latency and
+// error of every provider HTTP request, retries and backoff included
+var CallRecorder func(provider string, status int, latency time.Duration, err error)
+
+// doWithRetry sends a body-less request, retrying connection errors and transient
+// statuses with jittered exponential backoff. A 429's Retry-After header overrides
+// the backoff. It never waits past the request context's deadline; the last
+// response or error is returned instead. Every attempt takes a token from the
+// provider's rate limit, if one is set.
+func doWithRetry(provider string, client *http.Client, req *http.Request) (resp *http.Response, err error) {
+	if CallRecorder != nil {
+		start := time.Now()
+		defer func() {
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			CallRecorder(provider, status, time.Since(start), err)
+		}()
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		if err := waitRateLimit(ctx, provider); err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if attempt >= RetryAttempts || ctx.Err() != nil {
+			return resp, unreachable(ctx, err)
+		}
+		if err == nil && !retryableStatus[resp.StatusCode] {
+			return resp, nil
+		}
+
+		delay := RetryBaseDelay << (attempt - 1)
+		delay += time.Duration(rand.Int64N(int64(delay)/2 + 1))
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = after
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, unreachable(ctx, err)
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// unreachable reports a request that got no reply from the provider as an API error,
+// unless ctx ended first, which is reported as is
+func unreachable(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrAPIError, err)
+}
@@ -0,0 +1,233 @@
+package market
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// StreamInterval overrides each provider's default quote polling cadence when
+// positive; set from config at startup
+var StreamInterval time.Duration
+
+// pollIntervals are each provider's default quote polling cadence, kept within
+// their free-tier rate limits
+var pollIntervals = map[string]time.Duration{
+	"alphavantage": 15 * time.Second,
+	"yahoo":        10 * time.Second,
+	"finnhub":      5 * time.Second,
+	"polygon":      15 * time.Second, // free tier allows 5 requests a minute
+	"binance":      5 * time.Second,
+	"mock":         5 * time.Second, // one step of the generated walk
+}
+
+// Subscription is the symbol set of a quote stream. It can be changed while the
+// stream runs; the stream picks up the new set on its next poll.
+type Subscription struct {
+	symbols []string
+	mu      sync.RWMutex
+	changed chan struct{}
+
+	onStatus func(SymbolStatus) // set before the stream starts; nil ignores statuses
+}
+
+// SymbolStatus is a change in one streamed symbol's health: it failed to fetch, or it
+// streams again after failing
+type SymbolStatus struct {
+	Symbol  string
+	Err     error         // nil when the symbol recovered
+	RetryIn time.Duration // how long until a failed symbol is tried again
+}
+
+// maxSymbolBackoff caps how long a failing symbol waits between retries
+const maxSymbolBackoff = 5 * time.Minute
+
+// NewSubscription creates a subscription to symbols
+func NewSubscription(symbols []string) *Subscription {
+	return &Subscription{
+		symbols: append([]string{}, symbols...),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Symbols returns the current symbol set
+func (s *Subscription) Symbols() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string{}, s.symbols...)
+}
+
+// OnSymbolStatus makes the stream report each symbol that fails to fetch, and each
+// that recovers, to fn. A stream split across providers may call fn from several
+// goroutines at once. Call it before streaming.
+func (s *Subscription) OnSymbolStatus(fn func(SymbolStatus)) {
+	s.onStatus = fn
+}
+
+// split returns a subscription to part of the symbols, reporting statuses like s does
+func (s *Subscription) split(symbols []string) *Subscription {
+	part := NewSubscription(symbols)
+	part.onStatus = s.onStatus
+	return part
+}
+
+// Filter returns a subscription to the symbols of s that keep admits, reporting
+// statuses like s does. It follows s's changes until ctx ends, and refresh re-applies
+// keep for a filter whose answer changes over time. The filtered subscription takes
+// s's change notifications, so stream it instead of s, and filter s only once.
+func (s *Subscription) Filter(ctx context.Context, keep func(symbol string) bool) (filtered *Subscription, refresh func()) {
+	admitted := func() []string {
+		return slices.DeleteFunc(s.Symbols(), func(symbol string) bool { return !keep(symbol) })
+	}
+	filtered = s.split(admitted())
+	refreshed := make(chan struct{}, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.changed:
+			case <-refreshed:
+			}
+			filtered.Set(admitted())
+		}
+	}()
+	return filtered, func() {
+		select {
+		case refreshed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Set replaces the symbol set and wakes the stream so it polls the new set immediately
+func (s *Subscription) Set(symbols []string) {
+	s.mu.Lock()
+	s.symbols = append([]string{}, symbols...)
+	s.mu.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// symbolBackoff tracks a stream's failing symbols, so each is retried on its own
+// doubling backoff while the others keep streaming
+type symbolBackoff struct {
+	sub     *Subscription
+	base    time.Duration
+	failing map[string]*symbolRetry
+}
+
+// symbolRetry is a failing symbol's consecutive failures and when it's next tried
+type symbolRetry struct {
+	failures int
+	at       time.Time
+}
+
+func newSymbolBackoff(sub *Subscription, base time.Duration) *symbolBackoff {
+	return &symbolBackoff{sub: sub, base: base, failing: make(map[string]*symbolRetry)}
+}
+
+// due reports whether symbol should be fetched at now: it isn't failing, or its retry is due
+func (b *symbolBackoff) due(symbol string, now time.Time) bool {
+	retry, ok := b.failing[symbol]
+	return !ok || !now.Before(retry.at)
+}
+
+// fail records a failed fetch of symbol, doubling its wait up to maxSymbolBackoff, and
+// reports it
+func (b *symbolBackoff) fail(symbol string, err error) {
+	retry, ok := b.failing[symbol]
+	if !ok {
+		retry = &symbolRetry{}
+		b.failing[symbol] = retry
+	}
+	retry.failures++
+	wait := min(b.base<<min(retry.failures-1, 16), maxSymbolBackoff)
+	retry.at = time.Now().Add(wait)
+	b.report(SymbolStatus{Symbol: symbol, Err: err, RetryIn: wait})
+}
+
+// succeed records a fetch of symbol, reporting its recovery if it was failing
+func (b *symbolBackoff) succeed(symbol string) {
+	if _, ok := b.failing[symbol]; ok {
+		delete(b.failing, symbol)
+		b.report(SymbolStatus{Symbol: symbol})
+	}
+}
+
+// prune forgets failing symbols that are no longer in symbols
+func (b *symbolBackoff) prune(symbols []string) {
+	for symbol := range b.failing {
+		if !slices.Contains(symbols, symbol) {
+			delete(b.failing, symbol)
+		}
+	}
+}
+
+// next returns the soonest retry of a failing symbol, false when none is failing
+func (b *symbolBackoff) next() (time.Time, bool) {
+	var soonest time.Time
+	for _, retry := range b.failing {
+		if soonest.IsZero() || retry.at.Before(soonest) {
+			soonest = retry.at
+		}
+	}
+	return soonest, !soonest.IsZero()
+}
+
+func (b *symbolBackoff) report(status SymbolStatus) {
+	if b.sub.onStatus != nil {
+		b.sub.onStatus(status)
+	}
+}
+
+// pollQuotes streams quotes for a subscription by polling getQuote every interval
+// (or StreamInterval when set), and right away whenever the subscription changes.
+// A symbol that fails to fetch is reported and skipped until its retry, backing off
+// from one interval up to maxSymbolBackoff, while the others keep streaming.
+func pollQuotes(ctx context.Context, sub *Subscription, interval time.Duration, getQuote func(context.Context, string) (*models.Quote, error), ch chan<- models.Quote) error {
+	if StreamInterval > 0 {
+		interval = StreamInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	backoff := newSymbolBackoff(sub, interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-sub.changed:
+		}
+
+		symbols := sub.Symbols()
+		backoff.prune(symbols)
+		now := time.Now()
+		for _, symbol := range symbols {
+			if !backoff.due(symbol, now) {
+				continue
+			}
+			quote, err := getQuote(ctx, symbol)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				backoff.fail(symbol, err)
+				continue
+			}
+			backoff.succeed(symbol)
+			select {
+			case ch <- *quote:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
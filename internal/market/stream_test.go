@@ -0,0 +1,42 @@
+package market
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitSymbols waits for sub's symbols to become want
+func waitSymbols(t *testing.T, sub *Subscription, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !slices.Equal(sub.Symbols(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("symbols = %v, want %v", sub.Symbols(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSubscriptionFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var open atomic.Bool
+	sub := NewSubscription([]string{"AAPL", "BTC-USD"})
+	gated, refresh := sub.Filter(ctx, func(symbol string) bool { return open.Load() || IsCrypto(symbol) })
+	waitSymbols(t, gated, []string{"BTC-USD"})
+
+	open.Store(true)
+	refresh()
+	waitSymbols(t, gated, []string{"AAPL", "BTC-USD"})
+
+	sub.Set([]string{"MSFT", "ETH-USD"})
+	waitSymbols(t, gated, []string{"MSFT", "ETH-USD"})
+
+	open.Store(false)
+	refresh()
+	waitSymbols(t, gated, []string{"ETH-USD"})
+}
@@ -0,0 +1,37 @@
+package market
+
+import (
+	"fmt"
+	"strings"
+
+	"stockmarket/internal/apperr"
+)
+
+// MaxSymbolLength is the longest symbol accepted at the API boundary
+const MaxSymbolLength = 15
+
+// ErrSymbolRequired is returned by NormalizeSymbol for an empty symbol
+var ErrSymbolRequired = apperr.New(apperr.InvalidSymbol, "symbol is required")
+
+// NormalizeSymbol trims and upper-cases a symbol taken from a request and checks it
+// is made of letters, digits, '.' and '-' only, starting with a letter or digit, so
+// it's safe to place in provider URLs. Invalid symbols fail with an error wrapping
+// ErrInvalidSymbol.
+func NormalizeSymbol(input string) (string, error) {
+	symbol := strings.ToUpper(strings.TrimSpace(input))
+	if symbol == "" {
+		return "", ErrSymbolRequired
+	}
+	if len(symbol) > MaxSymbolLength {
+		return "", fmt.Errorf("%w: longer than %d characters", ErrInvalidSymbol, MaxSymbolLength)
+	}
+	for _, r := range symbol {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '.' && r != '-' {
+			return "", fmt.Errorf("%w: only letters, digits, '.' and '-' are allowed", ErrInvalidSymbol)
+		}
+	}
+	if symbol[0] == '.' || symbol[0] == '-' {
+		return "", fmt.Errorf("%w: must start with a letter or digit", ErrInvalidSymbol)
+	}
+	return symbol, nil
+}
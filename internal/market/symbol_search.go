@@ -0,0 +1,157 @@
+package market
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"stockmarket/internal/models"
+)
+
+// knownSymbols is the built-in list SearchKnownSymbols filters: widely held US stocks
+// and ETFs and the major crypto pairs
+var knownSymbols = []models.SymbolMatch{
+	{Symbol: "AAPL", Name: "Apple Inc.", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "ABBV", Name: "AbbVie Inc.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "ADBE", Name: "Adobe Inc.", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "AMD", Name: "Advanced Micro Devices, Inc.", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "AMZN", Name: "Amazon.com, Inc.", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "AVGO", Name: "Broadcom Inc.", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "BA", Name: "The Boeing Company", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "BAC", Name: "Bank of America Corporation", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "BRK-B", Name: "Berkshire Hathaway Inc.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "COST", Name: "Costco Wholesale Corporation", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "CRM", Name: "Salesforce, Inc.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "CSCO", Name: "Cisco Systems, Inc.", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "CVX", Name: "Chevron Corporation", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "DIS", Name: "The Walt Disney Company", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "GOOGL", Name: "Alphabet Inc. (Google)", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "HD", Name: "The Home Depot, Inc.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "IBM", Name: "International Business Machines Corporation", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "INTC", Name: "Intel Corporation", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "JNJ", Name: "Johnson & Johnson", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "JPM", Name: "JPMorgan Chase & Co.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "KO", Name: "The Coca-Cola Company", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "LLY", Name: "Eli Lilly and Company", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "MA", Name: "Mastercard Incorporated", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "MCD", Name: "McDonald's Corporation", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "META", Name: "Meta Platforms, Inc. (Facebook)", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "MRK", Name: "Merck & Co., Inc.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "MSFT", Name: "Microsoft Corporation", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "NFLX", Name: "Netflix, Inc.", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "NKE", Name: "NIKE, Inc.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "NVDA", Name: "NVIDIA Corporation", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "ORCL", Name: "Oracle Corporation", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "PEP", Name: "PepsiCo, Inc.", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "PFE", Name: "Pfizer Inc.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "PG", Name: "The Procter & Gamble Company", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "PYPL", Name: "PayPal Holdings, Inc.", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "QCOM", Name: "QUALCOMM Incorporated", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "SBUX", Name: "Starbucks Corporation", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "T", Name: "AT&T Inc.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "TSLA", Name: "Tesla, Inc.", Exchange: "NASDAQ", Type: "stock"},
+	{Symbol: "UNH", Name: "UnitedHealth Group Incorporated", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "V", Name: "Visa Inc.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "VZ", Name: "Verizon Communications Inc.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "WMT", Name: "Walmart Inc.", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "XOM", Name: "Exxon Mobil Corporation", Exchange: "NYSE", Type: "stock"},
+	{Symbol: "DIA", Name: "SPDR Dow Jones Industrial Average ETF Trust", Exchange: "NYSE Arca", Type: "etf"},
+	{Symbol: "IWM", Name: "iShares Russell 2000 ETF", Exchange: "NYSE Arca", Type: "etf"},
+	{Symbol: "QQQ", Name: "Invesco QQQ Trust (Nasdaq-100)", Exchange: "NASDAQ", Type: "etf"},
+	{Symbol: "SPY", Name: "SPDR S&P 500 ETF Trust", Exchange: "NYSE Arca", Type: "etf"},
+	{Symbol: "VOO", Name: "Vanguard S&P 500 ETF", Exchange: "NYSE Arca", Type: "etf"},
+	{Symbol: "VTI", Name: "Vanguard Total Stock Market ETF", Exchange: "NYSE Arca", Type: "etf"},
+	{Symbol: "BTC-USD", Name: "Bitcoin", Exchange: "Crypto", Type: "crypto"},
+	{Symbol: "ETH-USD", Name: "Ethereum", Exchange: "Crypto", Type: "crypto"},
+	{Symbol: "SOL-USD", Name: "Solana", Exchange: "Crypto", Type: "crypto"},
+	{Symbol: "XRP-USD", Name: "XRP", Exchange: "Crypto", Type: "crypto"},
+	{Symbol: "ADA-USD", Name: "Cardano", Exchange: "Crypto", Type: "crypto"},
+	{Symbol: "DOGE-USD", Name: "Dogecoin", Exchange: "Crypto", Type: "crypto"},
+	{Symbol: "LTC-USD", Name: "Litecoin", Exchange: "Crypto", Type: "crypto"},
+}
+
+// SearchKnownSymbols searches the built-in symbol list, for providers without a search
+// endpoint. Exact tickers come first, then tickers starting with the query, then names
+// with a word starting with it, then names containing it; at most limit are returned.
+func SearchKnownSymbols(query string, limit int) []models.SymbolMatch {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return []models.SymbolMatch{}
+	}
+
+	type ranked struct {
+		match models.SymbolMatch
+		rank  int
+	}
+	var found []ranked
+	for _, known := range knownSymbols {
+		ticker, name := strings.ToLower(known.Symbol), strings.ToLower(known.Name)
+		rank := -1
+		switch {
+		case ticker == query:
+			rank = 0
+		case strings.HasPrefix(ticker, query):
+			rank = 1
+		case slices.ContainsFunc(strings.FieldsFunc(name, isNameSeparator), func(word string) bool { return strings.HasPrefix(word, query) }):
+			rank = 2
+		case strings.Contains(name, query):
+			rank = 3
+		}
+		if rank >= 0 {
+			found = append(found, ranked{match: known, rank: rank})
+		}
+	}
+	slices.SortStableFunc(found, func(a, b ranked) int {
+		return cmp.Or(cmp.Compare(a.rank, b.rank), cmp.Compare(a.match.Symbol, b.match.Symbol))
+	})
+
+	matches := make([]models.SymbolMatch, 0, min(len(found), limit))
+	for _, f := range found[:min(len(found), limit)] {
+		matches = append(matches, f.match)
+	}
+	return matches
+}
+
+// NormalizeMatches runs provider search results through NormalizeSymbol, dropping
+// matches whose symbols couldn't be tracked, such as Polygon's "X:BTCUSD", and repeats
+func NormalizeMatches(matches []models.SymbolMatch) []models.SymbolMatch {
+	normalized := make([]models.SymbolMatch, 0, len(matches))
+	seen := make(map[string]bool, len(matches))
+	for _, match := range matches {
+		symbol, err := NormalizeSymbol(match.Symbol)
+		if err != nil || seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		match.Symbol = symbol
+		normalized = append(normalized, match)
+	}
+	return normalized
+}
+
+// matchTypes maps the security types providers report to the ones SymbolMatch uses
+var matchTypes = map[string]string{
+	"equity":         "stock",
+	"common stock":   "stock",
+	"cs":             "stock",
+	"adr":            "stock",
+	"adrc":           "stock",
+	"etf":            "etf",
+	"etp":            "etf",
+	"mutual fund":    "fund",
+	"mutualfund":     "fund",
+	"fund":           "fund",
+	"cryptocurrency": "crypto",
+	"crypto":         "crypto",
+}
+
+// matchType normalizes a provider's security type, lower-casing types it doesn't know
+func matchType(providerType string) string {
+	t := strings.ToLower(strings.TrimSpace(providerType))
+	return cmp.Or(matchTypes[t], t)
+}
+
+// isNameSeparator splits company names into words, so "coca" finds "The Coca-Cola Company"
+func isNameSeparator(r rune) bool {
+	return r == ' ' || r == '-' || r == '(' || r == ')' || r == ',' || r == '.'
+}
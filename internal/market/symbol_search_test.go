@@ -0,0 +1,21 @@
+package market
+
+import (
+	"reflect"
+	"testing"
+
+	"stockmarket/internal/models"
+)
+
+func TestNormalizeMatches(t *testing.T) {
+	got := NormalizeMatches([]models.SymbolMatch{
+		{Symbol: "X:BTCUSD", Name: "Bitcoin - United States Dollar"},
+		{Symbol: " bmw.de ", Name: "Bayerische Motoren Werke AG"},
+		{Symbol: "BMW.DE", Name: "BMW (duplicate listing)"},
+		{Symbol: "", Name: "No symbol"},
+	})
+	want := []models.SymbolMatch{{Symbol: "BMW.DE", Name: "Bayerische Motoren Werke AG"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NormalizeMatches = %+v, want %+v", got, want)
+	}
+}
@@ -1,10 +1,12 @@
 package market
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"stockmarket/internal/models"
@@ -12,6 +14,17 @@ import (
 
 const yahooBaseURL = "https://query1.finance.yahoo.com/v8/finance"
 
+const yahooScreenerURL = "https://query1.finance.yahoo.com/v1/finance/screener/predefined/saved"
+
+const yahooSearchURL = "https://query1.finance.yahoo.com/v1/finance/search"
+
+// yahooScreenerIDs maps mover types to Yahoo's predefined screeners
+var yahooScreenerIDs = map[string]string{
+	MoversGainers:    "day_gainers",
+	MoversLosers:     "day_losers",
+	MoversMostActive: "most_actives",
+}
+
 // YahooFinance implements the Provider interface for Yahoo Finance API
 type YahooFinance struct {
 	client *http.Client
@@ -29,9 +42,10 @@ func (yf *YahooFinance) Name() string {
 	return "yahoo"
 }
 
-// GetQuote fetches the current quote for a symbol
+// GetQuote fetches the current quote for a symbol. The day's minute bars include the
+// pre- and post-market ones, so the newest gives the extended-hours price.
 func (yf *YahooFinance) GetQuote(ctx context.Context, symbol string) (*models.Quote, error) {
-	url := fmt.Sprintf("%s/chart/%s?interval=1m&range=1d", yahooBaseURL, symbol)
+	url := fmt.Sprintf("%s/chart/%s?interval=1m&range=1d&includePrePost=true", yahooBaseURL, symbol)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -39,7 +53,7 @@ func (yf *YahooFinance) GetQuote(ctx context.Context, symbol string) (*models.Qu
 	}
 	req.Header.Set("User-Agent", "Mozilla/5.0")
 
-	resp, err := yf.client.Do(req)
+	resp, err := doWithRetry(yf.Name(), yf.client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +77,16 @@ func (yf *YahooFinance) GetQuote(ctx context.Context, symbol string) (*models.Qu
 					RegularMarketDayLow  float64 `json:"regularMarketDayLow"`
 					RegularMarketVolume  int64   `json:"regularMarketVolume"`
 					RegularMarketOpen    float64 `json:"regularMarketOpen"`
+					FiftyTwoWeekHigh     float64 `json:"fiftyTwoWeekHigh"`
+					FiftyTwoWeekLow      float64 `json:"fiftyTwoWeekLow"`
+					Currency             string  `json:"currency"`
 				} `json:"meta"`
+				Timestamp  []int64 `json:"timestamp"`
+				Indicators struct {
+					Quote []struct {
+						Close []*float64 `json:"close"`
+					} `json:"quote"`
+				} `json:"indicators"`
 			} `json:"result"`
 			Error *struct {
 				Code        string `json:"code"`
@@ -87,26 +110,64 @@ func (yf *YahooFinance) GetQuote(ctx context.Context, symbol string) (*models.Qu
 		return nil, ErrInvalidSymbol
 	}
 
-	meta := result.Chart.Result[0].Meta
-	change := meta.RegularMarketPrice - meta.PreviousClose
-	changePercent := (change / meta.PreviousClose) * 100
-
-	return &models.Quote{
-		Symbol:        symbol,
-		Price:         meta.RegularMarketPrice,
-		Open:          meta.RegularMarketOpen,
-		High:          meta.RegularMarketDayHigh,
-		Low:           meta.RegularMarketDayLow,
-		Volume:        meta.RegularMarketVolume,
-		PreviousClose: meta.PreviousClose,
-		Change:        change,
-		ChangePercent: changePercent,
-		Timestamp:     time.Unix(meta.RegularMarketTime, 0),
-	}, nil
+	chart := result.Chart.Result[0]
+	meta := chart.Meta
+	var change, changePercent float64
+	if meta.PreviousClose > 0 {
+		change = meta.RegularMarketPrice - meta.PreviousClose
+		changePercent = (change / meta.PreviousClose) * 100
+	}
+
+	quote := &models.Quote{
+		Symbol:           symbol,
+		Price:            meta.RegularMarketPrice,
+		Open:             meta.RegularMarketOpen,
+		High:             meta.RegularMarketDayHigh,
+		Low:              meta.RegularMarketDayLow,
+		Volume:           meta.RegularMarketVolume,
+		PreviousClose:    meta.PreviousClose,
+		Change:           change,
+		ChangePercent:    changePercent,
+		Timestamp:        normalizeTimestamp(yf.Name(), time.Unix(meta.RegularMarketTime, 0)),
+		FiftyTwoWeekHigh: meta.FiftyTwoWeekHigh,
+		FiftyTwoWeekLow:  meta.FiftyTwoWeekLow,
+		Currency:         cmp.Or(meta.Currency, SymbolCurrency(symbol)),
+	}
+	// Bars with no trades have null closes
+	if len(chart.Indicators.Quote) > 0 {
+		closes := chart.Indicators.Quote[0].Close
+		for i := min(len(closes), len(chart.Timestamp)) - 1; i >= 0; i-- {
+			if closes[i] != nil {
+				setExtendedHours(quote, *closes[i], normalizeTimestamp(yf.Name(), time.Unix(chart.Timestamp[i], 0)))
+				break
+			}
+		}
+	}
+	return quote, nil
 }
 
-// GetHistoricalData fetches historical OHLCV data
-func (yf *YahooFinance) GetHistoricalData(ctx context.Context, symbol string, period string) ([]models.Candle, error) {
+// GetQuotes fetches quotes for several symbols with a bounded concurrent fan-out
+func (yf *YahooFinance) GetQuotes(ctx context.Context, symbols []string) (map[string]models.Quote, error) {
+	return fanOutQuotes(ctx, symbols, yf.GetQuote)
+}
+
+// yahooIntervals maps Intervals to Yahoo chart intervals
+var yahooIntervals = map[string]string{
+	Interval1Min:  "1m",
+	Interval5Min:  "5m",
+	Interval15Min: "15m",
+	Interval1Hour: "60m",
+	Interval1Day:  "1d",
+}
+
+// GetHistoricalData fetches historical OHLCV data. Supported periods are 1d (5m bars),
+// 5d (15m bars), 1m, 3m, 6m, 1y (daily bars) and 5y (weekly bars); anything else
+// falls back to one month of daily bars. A non-empty interval overrides the bar size.
+func (yf *YahooFinance) GetHistoricalData(ctx context.Context, symbol string, period string, barInterval string) ([]models.Candle, error) {
+	if err := ValidateInterval(yf.Name(), period, barInterval); err != nil {
+		return nil, err
+	}
+
 	// Map period to Yahoo Finance parameters
 	range_ := "1mo"
 	interval := "1d"
@@ -124,6 +185,9 @@ func (yf *YahooFinance) GetHistoricalData(ctx context.Context, symbol string, pe
 	case "3m":
 		range_ = "3mo"
 		interval = "1d"
+	case "6m":
+		range_ = "6mo"
+		interval = "1d"
 	case "1y":
 		range_ = "1y"
 		interval = "1d"
@@ -131,6 +195,9 @@ func (yf *YahooFinance) GetHistoricalData(ctx context.Context, symbol string, pe
 		range_ = "5y"
 		interval = "1wk"
 	}
+	if barInterval != "" {
+		interval = yahooIntervals[barInterval]
+	}
 
 	url := fmt.Sprintf("%s/chart/%s?interval=%s&range=%s", yahooBaseURL, symbol, interval, range_)
 
@@ -140,7 +207,7 @@ func (yf *YahooFinance) GetHistoricalData(ctx context.Context, symbol string, pe
 	}
 	req.Header.Set("User-Agent", "Mozilla/5.0")
 
-	resp, err := yf.client.Do(req)
+	resp, err := doWithRetry(yf.Name(), yf.client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -162,6 +229,10 @@ func (yf *YahooFinance) GetHistoricalData(ctx context.Context, symbol string, pe
 						Close  []float64 `json:"close"`
 						Volume []int64   `json:"volume"`
 					} `json:"quote"`
+					// Split and dividend adjusted closes, present for daily and longer bars
+					AdjClose []struct {
+						AdjClose []float64 `json:"adjclose"`
+					} `json:"adjclose"`
 				} `json:"indicators"`
 			} `json:"result"`
 			Error *struct {
@@ -184,6 +255,10 @@ func (yf *YahooFinance) GetHistoricalData(ctx context.Context, symbol string, pe
 	}
 
 	q := r.Indicators.Quote[0]
+	var adjCloses []float64
+	if len(r.Indicators.AdjClose) > 0 {
+		adjCloses = r.Indicators.AdjClose[0].AdjClose
+	}
 	var candles []models.Candle
 
 	for i := 0; i < len(r.Timestamp); i++ {
@@ -191,14 +266,21 @@ func (yf *YahooFinance) GetHistoricalData(ctx context.Context, symbol string, pe
 			break
 		}
 
-		candles = append(candles, models.Candle{
-			Timestamp: time.Unix(r.Timestamp[i], 0),
+		candle := models.Candle{
+			Timestamp: normalizeTimestamp(yf.Name(), time.Unix(r.Timestamp[i], 0)),
 			Open:      q.Open[i],
 			High:      q.High[i],
 			Low:       q.Low[i],
 			Close:     q.Close[i],
 			Volume:    q.Volume[i],
-		})
+		}
+		// Yahoo's closes are already split adjusted, so without a dividend adjusted
+		// close (intraday bars) the close is the adjusted one
+		candle.AdjClose = candle.Close
+		if i < len(adjCloses) {
+			candle.AdjClose = adjCloses[i]
+		}
+		candles = append(candles, candle)
 	}
 
 	// Reverse to get newest first
@@ -209,27 +291,171 @@ func (yf *YahooFinance) GetHistoricalData(ctx context.Context, symbol string, pe
 	return candles, nil
 }
 
-// StreamQuotes streams real-time quotes via polling
-func (yf *YahooFinance) StreamQuotes(ctx context.Context, symbols []string, ch chan<- models.Quote) error {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
-			for _, symbol := range symbols {
-				quote, err := yf.GetQuote(ctx, symbol)
-				if err != nil {
-					continue
-				}
-				select {
-				case ch <- *quote:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-			}
+// GetSplits lists a symbol's stock splits over its whole history, from the split
+// events of Yahoo's chart
+func (yf *YahooFinance) GetSplits(ctx context.Context, symbol string) ([]models.Split, error) {
+	url := fmt.Sprintf("%s/chart/%s?interval=3mo&range=max&events=splits", yahooBaseURL, symbol)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	resp, err := doWithRetry(yf.Name(), yf.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, ErrInvalidSymbol
+	}
+	if resp.StatusCode != 200 {
+		return nil, ErrAPIError
+	}
+
+	var result struct {
+		Chart struct {
+			Result []struct {
+				Events struct {
+					Splits map[string]struct {
+						Date        int64   `json:"date"`
+						Numerator   float64 `json:"numerator"`
+						Denominator float64 `json:"denominator"`
+					} `json:"splits"`
+				} `json:"events"`
+			} `json:"result"`
+		} `json:"chart"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.Chart.Result) == 0 {
+		return nil, ErrInvalidSymbol
+	}
+
+	var splits []models.Split
+	for _, event := range result.Chart.Result[0].Events.Splits {
+		if event.Numerator > 0 && event.Denominator > 0 {
+			splits = append(splits, models.Split{Date: splitDate(time.Unix(event.Date, 0)), Ratio: event.Numerator / event.Denominator})
 		}
 	}
+	return splits, nil
+}
+
+// GetMovers fetches the day's top gainers, losers or most active stocks from Yahoo's screener
+func (yf *YahooFinance) GetMovers(ctx context.Context, moverType string) ([]models.Mover, error) {
+	scrID, ok := yahooScreenerIDs[moverType]
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	url := fmt.Sprintf("%s?scrIds=%s&count=25", yahooScreenerURL, scrID)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	resp, err := doWithRetry(yf.Name(), yf.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, ErrAPIError
+	}
+
+	var result struct {
+		Finance struct {
+			Result []struct {
+				Quotes []struct {
+					Symbol                     string  `json:"symbol"`
+					RegularMarketPrice         float64 `json:"regularMarketPrice"`
+					RegularMarketChange        float64 `json:"regularMarketChange"`
+					RegularMarketChangePercent float64 `json:"regularMarketChangePercent"`
+					RegularMarketVolume        int64   `json:"regularMarketVolume"`
+				} `json:"quotes"`
+			} `json:"result"`
+		} `json:"finance"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.Finance.Result) == 0 {
+		return nil, ErrAPIError
+	}
+
+	quotes := result.Finance.Result[0].Quotes
+	movers := make([]models.Mover, 0, len(quotes))
+	for i, q := range quotes {
+		movers = append(movers, models.Mover{
+			Rank:          i + 1,
+			Symbol:        q.Symbol,
+			Price:         q.RegularMarketPrice,
+			Change:        q.RegularMarketChange,
+			ChangePercent: q.RegularMarketChangePercent,
+			Volume:        q.RegularMarketVolume,
+		})
+	}
+	return movers, nil
+}
+
+// SearchSymbols looks up tickers by symbol or company name with Yahoo's search
+func (yf *YahooFinance) SearchSymbols(ctx context.Context, query string) ([]models.SymbolMatch, error) {
+	searchURL := fmt.Sprintf("%s?q=%s&quotesCount=20&newsCount=0", yahooSearchURL, url.QueryEscape(query))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	resp, err := doWithRetry(yf.Name(), yf.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return nil, ErrRateLimited
+	}
+	if resp.StatusCode != 200 {
+		return nil, ErrAPIError
+	}
+
+	var result struct {
+		Quotes []struct {
+			Symbol    string `json:"symbol"`
+			ShortName string `json:"shortname"`
+			LongName  string `json:"longname"`
+			ExchDisp  string `json:"exchDisp"`
+			QuoteType string `json:"quoteType"`
+		} `json:"quotes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	matches := make([]models.SymbolMatch, 0, len(result.Quotes))
+	for _, q := range result.Quotes {
+		if q.Symbol == "" {
+			continue
+		}
+		matches = append(matches, models.SymbolMatch{
+			Symbol:   q.Symbol,
+			Name:     cmp.Or(q.LongName, q.ShortName),
+			Exchange: q.ExchDisp,
+			Type:     matchType(q.QuoteType),
+		})
+	}
+	return matches, nil
+}
+
+// StreamQuotes streams real-time quotes via polling
+func (yf *YahooFinance) StreamQuotes(ctx context.Context, sub *Subscription, ch chan<- models.Quote) error {
+	return pollQuotes(ctx, sub, pollIntervals[yf.Name()], yf.GetQuote, ch)
 }
@@ -1,31 +1,124 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // UserConfig holds all user configuration settings
 type UserConfig struct {
 	ID                   int64                `json:"id"`
-	MarketDataProvider   string               `json:"market_data_provider"` // "alphavantage" | "yahoo" | "finnhub"
-	MarketDataAPIKey     string               `json:"market_data_api_key"`  // encrypted at rest
-	AIProvider           string               `json:"ai_provider"`          // "openai" | "claude" | "gemini"
-	AIProviderAPIKey     string               `json:"ai_provider_api_key"`  // encrypted at rest
-	AIModel              string               `json:"ai_model"`             // e.g., "gpt-4o", "claude-sonnet"
-	RiskTolerance        string               `json:"risk_tolerance"`       // "conservative" | "moderate" | "aggressive"
-	TradeFrequency       string               `json:"trade_frequency"`      // "daily" | "weekly" | "swing"
-	TrackedSymbols       []string             `json:"tracked_symbols"`      // e.g., ["AAPL", "GOOGL", "MSFT"]
-	PollingInterval      int                  `json:"polling_interval"`     // in seconds, default 30
+	Name                 string               `json:"name"`                          // profile name, e.g. "default"
+	MarketDataProvider   string               `json:"market_data_provider"`          // "alphavantage" | "yahoo" | "finnhub" | "polygon" | "binance" | "mock"
+	MarketDataAPIKey     string               `json:"market_data_api_key"`           // encrypted at rest
+	MarketDataFallback   string               `json:"market_data_provider_fallback"` // tried when the primary fails; uses the server's API key
+	AIProvider           string               `json:"ai_provider"`                   // "openai" | "claude" (or "anthropic") | "gemini" | "ollama" | "mock"
+	AIProviderAPIKey     string               `json:"ai_provider_api_key"`           // encrypted at rest
+	AIModel              string               `json:"ai_model"`                      // e.g., "gpt-4o", "claude-sonnet"
+	RiskTolerance        string               `json:"risk_tolerance"`                // "conservative" | "moderate" | "aggressive"
+	TradeFrequency       string               `json:"trade_frequency"`               // "daily" | "weekly" | "swing"
+	TrackedSymbols       []string             `json:"tracked_symbols"`               // e.g., ["AAPL", "GOOGL", "MSFT"]
+	PollingInterval      int                  `json:"polling_interval"`              // in seconds, default 30
+	SymbolAliases        map[string]string    `json:"symbol_aliases"`                // e.g., {"GOOGLE": "GOOGL"}
+	WatchlistGroups      []WatchlistGroup     `json:"watchlist_groups"`              // named sections of TrackedSymbols, in display order
 	NotificationChannels []NotificationConfig `json:"notification_channels"`
+	NotifyMinConfidence  float64              `json:"notify_min_confidence"`  // signals below this confidence (0-1) aren't notified, default 0.7
+	NotifyOnActions      []string             `json:"notify_on_actions"`      // actions that are notified, default ["BUY", "SELL"]
+	NotifyOnHold         bool                 `json:"notify_on_hold"`         // HOLD is only notified when this is set, even if listed
+	IncludeExtendedHours bool                 `json:"include_extended_hours"` // analyses and alerts use pre-market and after-hours prices
+	Version              int64                `json:"version"`                // incremented on every update, for optimistic locking
 	CreatedAt            time.Time            `json:"created_at"`
 	UpdatedAt            time.Time            `json:"updated_at"`
 }
 
+// UngroupedWatchlistGroup is the name of the section holding tracked symbols that
+// aren't in any watchlist group; it can't be used as a group name
+const UngroupedWatchlistGroup = "Ungrouped"
+
+// WatchlistGroup is a named section of a profile's watchlist, e.g. "Tech". A symbol
+// is in at most one group; tracked symbols in none show under "Ungrouped".
+type WatchlistGroup struct {
+	Name    string   `json:"name"`
+	Symbols []string `json:"symbols"`
+}
+
+// Signal notification defaults for profiles that haven't changed them
+const DefaultNotifyMinConfidence = 0.7
+
+var DefaultNotifyOnActions = []string{"BUY", "SELL"}
+
+// ConfigBackupVersion is the schema version of ConfigBackup documents this build
+// writes and accepts
+const ConfigBackupVersion = 1
+
+// ConfigBackup is a profile's settings, active alerts and notification channels, for
+// moving a setup to another instance. API keys are the encrypted blobs stored at rest,
+// so they only import into an instance with the same ENCRYPTION_KEY, unless redacted.
+type ConfigBackup struct {
+	SchemaVersion        int                  `json:"schema_version"`
+	ExportedAt           time.Time            `json:"exported_at"`
+	SecretsRedacted      bool                 `json:"secrets_redacted,omitempty"` // API keys and webhook headers were left out
+	Config               UserConfig           `json:"config"`                     // its notification_channels are left empty
+	Alerts               []PriceAlert         `json:"alerts"`
+	NotificationChannels []NotificationConfig `json:"notification_channels"`
+}
+
+// Profile is one household member's configuration profile. Each has its own
+// settings, tracked symbols, alerts and notification channels.
+type Profile struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // NotificationConfig holds notification channel settings
 type NotificationConfig struct {
-	ID      int64    `json:"id"`
-	Type    string   `json:"type"`   // "email" | "discord" | "sms"
-	Target  string   `json:"target"` // email address, webhook URL, phone number
-	Enabled bool     `json:"enabled"`
-	Events  []string `json:"events"` // ["buy_signal", "sell_signal", "price_alert"]
+	ID       int64           `json:"id"`
+	Type     string          `json:"type"`   // "email" | "discord" | "slack" | "sms" | "webhook" | "telegram"
+	Target   string          `json:"target"` // email address, webhook URL, phone number, Telegram chat ID
+	Enabled  bool            `json:"enabled"`
+	Events   []string        `json:"events"`             // ["buy_signal", "sell_signal", "price_alert", "daily_digest"]
+	Symbols  *SymbolFilter   `json:"symbols,omitempty"`  // which symbols' notifications it receives; nil for all
+	Webhook  *WebhookConfig  `json:"webhook,omitempty"`  // request settings for "webhook" channels
+	Telegram *TelegramConfig `json:"telegram,omitempty"` // bot credentials for "telegram" channels
+}
+
+// SymbolFilter limits a notification channel to some symbols. A non-empty Include
+// admits only the symbols listed; Exclude then drops symbols from what's admitted.
+// Notifications without a symbol, such as the daily digest, always pass.
+type SymbolFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// TelegramConfig holds the bot a "telegram" channel sends through
+type TelegramConfig struct {
+	BotToken string `json:"bot_token"` // from @BotFather, e.g. "123456:ABC-DEF..."
+}
+
+// WebhookConfig shapes the request a generic webhook channel sends
+type WebhookConfig struct {
+	Method   string            `json:"method,omitempty"`   // HTTP method, default POST
+	Headers  map[string]string `json:"headers,omitempty"`  // extra request headers, e.g. Authorization
+	Template string            `json:"template,omitempty"` // Go text/template over the Notification; empty sends it as JSON
+	Timeout  string            `json:"timeout,omitempty"`  // request timeout as a duration, e.g. "5s"
+}
+
+// Trade is an individual trade print from a real-time trades feed
+type Trade struct {
+	Symbol    string    `json:"symbol"`
+	Price     float64   `json:"price"`
+	Size      float64   `json:"size"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// MarketStatus reports whether an exchange is trading and when that next changes
+type MarketStatus struct {
+	Exchange      string    `json:"exchange"`
+	Open          bool      `json:"open"`
+	ExtendedHours bool      `json:"extended_hours"`      // pre- and post-market count as open
+	NextOpen      time.Time `json:"next_open,omitzero"`  // unset for CRYPTO, which never closes
+	NextClose     time.Time `json:"next_close,omitzero"` // unset for CRYPTO
 }
 
 // Quote represents a stock quote
@@ -38,8 +131,31 @@ type Quote struct {
 	Volume        int64     `json:"volume"`
 	PreviousClose float64   `json:"previous_close"`
 	Change        float64   `json:"change"`
-	ChangePercent float64   `json:"change_percent"`
+	ChangePercent float64   `json:"change_percent"` // day change vs PreviousClose
 	Timestamp     time.Time `json:"timestamp"`
+
+	// Currency the prices are in as the provider reports it, e.g. GBP, or GBp for pence
+	// on the LSE; empty when the provider doesn't say, which is taken as USD
+	Currency string `json:"currency,omitempty"`
+
+	// Top of book, where the provider supplies it
+	Bid float64 `json:"bid,omitempty"`
+	Ask float64 `json:"ask,omitempty"`
+
+	// 52-week range context (zero when unavailable)
+	FiftyTwoWeekHigh float64 `json:"fifty_two_week_high,omitempty"`
+	FiftyTwoWeekLow  float64 `json:"fifty_two_week_low,omitempty"`
+	PercentFromHigh  float64 `json:"percent_from_high,omitempty"` // how far below the 52-week high, in percent
+
+	// Discontinuity is set when the price jump looks like a corporate action (e.g. a split)
+	Discontinuity string `json:"discontinuity,omitempty"`
+
+	// Latest pre-market or after-hours trade, where the provider supplies it, while the
+	// regular session is closed; Price stays the regular session's. The change is from
+	// Price. All zero during the regular session.
+	ExtendedHoursPrice         float64    `json:"extended_hours_price,omitempty"`
+	ExtendedHoursChangePercent float64    `json:"extended_hours_change_percent,omitempty"`
+	ExtendedHoursTimestamp     *time.Time `json:"extended_hours_timestamp,omitempty"`
 }
 
 // Candle represents OHLCV data
@@ -50,6 +166,41 @@ type Candle struct {
 	Low       float64   `json:"low"`
 	Close     float64   `json:"close"`
 	Volume    int64     `json:"volume"`
+	AdjClose  float64   `json:"adj_close,omitempty"` // split (and, where the provider includes them, dividend) adjusted close; 0 when unknown
+}
+
+// Split is a stock split: from Date on, each share is Ratio shares (4 for a 4-for-1
+// split, 0.1 for a 1-for-10 reverse split)
+type Split struct {
+	Date  time.Time `json:"date"`
+	Ratio float64   `json:"ratio"`
+}
+
+// EarningsTranscript holds an earnings-call transcript and its cached sentiment summary
+type EarningsTranscript struct {
+	Symbol     string    `json:"symbol"`
+	Quarter    string    `json:"quarter"` // e.g., "2024Q1"
+	Transcript string    `json:"transcript"`
+	Summary    string    `json:"summary,omitempty"`
+	FetchedAt  time.Time `json:"fetched_at"`
+}
+
+// PromptTemplate is an analysis prompt override stored in the database, named like the
+// files in PROMPT_TEMPLATES_DIR and used in place of a file of the same name
+type PromptTemplate struct {
+	Name      string    `json:"name"`
+	Template  string    `json:"template"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Fundamentals holds per-share dividend data for income screening. Fields are nil
+// when the provider doesn't report them.
+type Fundamentals struct {
+	Symbol                   string    `json:"symbol"`
+	DividendYield            *float64  `json:"dividend_yield"`                       // percent, e.g. 3.2
+	PayoutRatio              *float64  `json:"payout_ratio"`                         // percent of earnings paid out
+	ConsecutiveIncreaseYears *int      `json:"consecutive_increase_years,omitempty"` // years of rising annual dividends
+	FetchedAt                time.Time `json:"fetched_at"`
 }
 
 // AnalysisRequest represents a request for AI analysis
@@ -60,6 +211,263 @@ type AnalysisRequest struct {
 	RiskProfile    string   `json:"risk_profile"`
 	TradeFrequency string   `json:"trade_frequency"`
 	UserContext    string   `json:"user_context"` // optional user notes
+
+	FiftyTwoWeekHigh float64 `json:"fifty_two_week_high,omitempty"`
+	FiftyTwoWeekLow  float64 `json:"fifty_two_week_low,omitempty"`
+
+	// Quote is the latest quote, for the session's range, volume, change and spread
+	Quote *Quote `json:"quote,omitempty"`
+
+	// Timeframes holds extra candle series for multi-timeframe analysis
+	Timeframes []TimeframeData `json:"timeframes,omitempty"`
+
+	// TranscriptSummary is a condensed earnings-call sentiment summary, if available
+	TranscriptSummary string `json:"transcript_summary,omitempty"`
+
+	// Position is the user's current holding in the symbol, when position context is enabled
+	Position *Position `json:"position,omitempty"`
+
+	// Levels are support/resistance levels detected from HistoricalData
+	Levels []PriceLevel `json:"levels,omitempty"`
+
+	// Indicators are technical indicators computed from HistoricalData
+	Indicators *Indicators `json:"indicators,omitempty"`
+
+	// VWAP is the current session's VWAP from intraday bars, for intraday trade frequencies
+	VWAP *float64 `json:"vwap,omitempty"`
+
+	// Benchmark compares the symbol against a benchmark index
+	Benchmark *BenchmarkComparison `json:"benchmark,omitempty"`
+
+	// MarketContext is a macro summary (e.g. sector performance) for the prompt
+	MarketContext string `json:"market_context,omitempty"`
+
+	// RetryHint is extra instruction added when re-running an unhelpful analysis
+	RetryHint string `json:"retry_hint,omitempty"`
+
+	// DetailLevel is "brief", "standard" or "detailed" (empty means standard)
+	DetailLevel string `json:"detail_level,omitempty"`
+
+	// RiskReview asks for a downside-focused SELL or HOLD call on a held symbol
+	RiskReview bool `json:"risk_review,omitempty"`
+}
+
+// PromptPreview is the analysis prompt a request would send, built without calling the AI
+type PromptPreview struct {
+	Symbol     string       `json:"symbol"`
+	Price      float64      `json:"price"`
+	Template   string       `json:"template"` // prompt template used, "analysis" for the embedded one
+	Prompt     string       `json:"prompt"`
+	Indicators *Indicators  `json:"indicators,omitempty"`
+	Levels     []PriceLevel `json:"levels,omitempty"`
+}
+
+// RiskReview ranks a profile's tracked symbols by how urgently the AI would exit them
+type RiskReview struct {
+	Symbols     []RiskReviewEntry `json:"symbols"`
+	Batch       string            `json:"batch,omitempty"` // tag on the saved analyses, when saved
+	GeneratedAt time.Time         `json:"generated_at"`
+}
+
+// RiskReviewEntry is one symbol's risk review. Symbols that couldn't be reviewed carry
+// only Error.
+type RiskReviewEntry struct {
+	Symbol     string   `json:"symbol"`
+	Action     string   `json:"action,omitempty"` // "SELL" or "HOLD"
+	Confidence float64  `json:"confidence,omitempty"`
+	Price      float64  `json:"price,omitempty"`
+	StopLoss   float64  `json:"stop_loss,omitempty"`
+	Reasoning  string   `json:"reasoning,omitempty"`
+	Risks      []string `json:"risks,omitempty"`
+	AnalysisID int64    `json:"analysis_id,omitempty"` // set when the review was saved
+	Error      string   `json:"error,omitempty"`
+}
+
+// Position is a user's holding in a symbol
+type Position struct {
+	Symbol    string    `json:"symbol"`
+	Quantity  float64   `json:"quantity"`
+	AvgCost   float64   `json:"avg_cost"`  // average cost per share
+	OpenedAt  time.Time `json:"opened_at"` // when the position was first opened
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PortfolioPosition is a held position valued at its latest quote. The valuation
+// fields are nil when the quote couldn't be fetched, with the reason in Error.
+type PortfolioPosition struct {
+	Position
+	CostBasis           float64  `json:"cost_basis"`
+	Price               *float64 `json:"price,omitempty"`
+	MarketValue         *float64 `json:"market_value,omitempty"`
+	UnrealizedPL        *float64 `json:"unrealized_pl,omitempty"`
+	UnrealizedPLPercent *float64 `json:"unrealized_pl_percent,omitempty"`
+	Error               string   `json:"error,omitempty"`
+}
+
+// Portfolio is the user's positions with unrealized P&L. Totals cover only the
+// positions that could be priced; Partial is set when any couldn't.
+type Portfolio struct {
+	Positions           []PortfolioPosition `json:"positions"`
+	CostBasis           float64             `json:"cost_basis"`
+	MarketValue         float64             `json:"market_value"`
+	UnrealizedPL        float64             `json:"unrealized_pl"`
+	UnrealizedPLPercent float64             `json:"unrealized_pl_percent"`
+	Partial             bool                `json:"partial,omitempty"`
+}
+
+// AIUsage is the token usage and estimated cost of one AI completion
+type AIUsage struct {
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	Cost         float64   `json:"cost"` // USD
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// MarketOverview aggregates the dashboard's data in one response
+type MarketOverview struct {
+	Symbols      []SymbolOverview `json:"symbols"`
+	Group        string           `json:"group,omitempty"` // the watchlist group it was limited to, if any
+	ActiveAlerts int              `json:"active_alerts"`
+	GeneratedAt  time.Time        `json:"generated_at"`
+}
+
+// SymbolOverview is one tracked symbol in a MarketOverview; QuoteError is set when its
+// quote couldn't be fetched
+type SymbolOverview struct {
+	Symbol         string            `json:"symbol"`
+	Group          string            `json:"group"` // its watchlist group, or "Ungrouped"
+	Quote          *Quote            `json:"quote,omitempty"`
+	QuoteError     string            `json:"quote_error,omitempty"`
+	LatestAnalysis *AnalysisResponse `json:"latest_analysis,omitempty"`
+}
+
+// AnalysisUsageTotals aggregates token usage and cost across saved analyses
+type AnalysisUsageTotals struct {
+	Analyses         int     `json:"analyses"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// BenchmarkComparison relates a symbol's returns to a benchmark index
+type BenchmarkComparison struct {
+	Symbol          string   `json:"symbol"` // benchmark symbol, e.g. SPY
+	Beta            *float64 `json:"beta,omitempty"`
+	BenchmarkReturn *float64 `json:"benchmark_return,omitempty"` // percent over the last month
+	SymbolReturn    *float64 `json:"symbol_return,omitempty"`    // percent over the last month
+
+	// RelativeStrength is the symbol's return minus the benchmark's over Period, the
+	// analysis history, in percentage points
+	Period           string   `json:"period,omitempty"`
+	RelativeStrength *float64 `json:"relative_strength,omitempty"`
+}
+
+// Indicators are the latest values of standard technical indicators; nil when there
+// wasn't enough history to compute them
+type Indicators struct {
+	RSI14      *float64 `json:"rsi_14,omitempty"`
+	SMA20      *float64 `json:"sma_20,omitempty"`
+	SMA50      *float64 `json:"sma_50,omitempty"`
+	EMA12      *float64 `json:"ema_12,omitempty"`
+	EMA26      *float64 `json:"ema_26,omitempty"`
+	MACD       *float64 `json:"macd,omitempty"`
+	MACDSignal *float64 `json:"macd_signal,omitempty"`
+	MACDHist   *float64 `json:"macd_hist,omitempty"`
+}
+
+// PriceLevel is a support or resistance level detected from swing points
+type PriceLevel struct {
+	Kind    string  `json:"kind"` // "support" | "resistance"
+	Price   float64 `json:"price"`
+	Touches int     `json:"touches"` // swing points merged into this level
+}
+
+// AlertSuggestion is a price level suggested for an alert after an analysis
+type AlertSuggestion struct {
+	Source    string  `json:"source"`    // "target" | "stop_loss" | "support" | "resistance"
+	Condition string  `json:"condition"` // "above" | "below"
+	Price     float64 `json:"price"`
+}
+
+// QuoteSnapshot is a recorded point-in-time quote for export
+type QuoteSnapshot struct {
+	Symbol        string    `json:"symbol"`
+	Price         float64   `json:"price"`
+	ChangePercent float64   `json:"change_percent"`
+	Volume        int64     `json:"volume"`
+	QuotedAt      time.Time `json:"quoted_at"`
+}
+
+// SectorPerformance is a sector's return, measured through its sector ETF
+type SectorPerformance struct {
+	Sector       string   `json:"sector"`
+	Symbol       string   `json:"symbol"`
+	Price        float64  `json:"price"`
+	DailyReturn  float64  `json:"daily_return"`            // percent
+	WeeklyReturn *float64 `json:"weekly_return,omitempty"` // percent over the last 5 trading days
+	Error        string   `json:"error,omitempty"`
+}
+
+// Mover is a ranked entry in a gainers/losers/most-active list
+type Mover struct {
+	Rank          int     `json:"rank"`
+	Symbol        string  `json:"symbol"`
+	Price         float64 `json:"price"`
+	Change        float64 `json:"change"`
+	ChangePercent float64 `json:"change_percent"`
+	Volume        int64   `json:"volume"`
+}
+
+// SymbolMatch is one result of a symbol search
+type SymbolMatch struct {
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Exchange string `json:"exchange,omitempty"`
+	Type     string `json:"type,omitempty"` // "stock", "etf", "fund", "crypto", or the source's own name for others
+}
+
+// ProviderHealth is the last known state of a market data provider
+type ProviderHealth struct {
+	Provider            string    `json:"provider"`
+	Up                  bool      `json:"up"`
+	CheckedAt           time.Time `json:"checked_at"`
+	LatencyMs           int64     `json:"latency_ms"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+// MetricsSnapshot is the in-memory request and upstream call metrics served by
+// GET /api/metrics. Window counts and latencies cover the last WindowSeconds; totals
+// count everything since Since.
+type MetricsSnapshot struct {
+	WindowSeconds int           `json:"window_seconds"`
+	Since         time.Time     `json:"since"`
+	Endpoints     []MetricStats `json:"endpoints"` // keyed "METHOD /route/pattern"
+	AI            []MetricStats `json:"ai"`        // AI analysis calls per provider
+	Market        []MetricStats `json:"market"`    // market data HTTP calls per provider
+}
+
+// MetricStats summarizes the calls to one endpoint or provider. Errors are 5xx
+// responses, failed AI calls, and market calls that failed or were throttled;
+// ClientErrors are other 4xx responses.
+type MetricStats struct {
+	Name         string  `json:"name"`
+	Count        int     `json:"count"`
+	Errors       int     `json:"errors"`
+	ClientErrors int     `json:"client_errors"`
+	P50Ms        float64 `json:"p50_ms"`
+	P95Ms        float64 `json:"p95_ms"`
+	Total        uint64  `json:"total"`
+	TotalErrors  uint64  `json:"total_errors"`
+}
+
+// TimeframeData is a candle series for one timeframe of a multi-timeframe analysis
+type TimeframeData struct {
+	Period  string   `json:"period"` // e.g., "1y", "5d"
+	Candles []Candle `json:"candles"`
+	Weight  float64  `json:"weight,omitempty"` // share of the recommendation its signals should carry
 }
 
 // AnalysisResponse represents the AI analysis result
@@ -73,6 +481,80 @@ type AnalysisResponse struct {
 	Risks        []string     `json:"risks"`
 	Timeframe    string       `json:"timeframe"`
 	GeneratedAt  time.Time    `json:"generated_at"`
+	Price        float64      `json:"price,omitempty"`    // quote the analysis was made at; 0 for ones saved before it was kept
+	Currency     string       `json:"currency,omitempty"` // currency of Price and PriceTargets, as the quote reported it
+
+	GuardrailFlagged bool     `json:"guardrail_flagged,omitempty"` // price levels failed the sanity check
+	Incomplete       bool     `json:"incomplete,omitempty"`        // the model listed no risks
+	Timeframes       []string `json:"timeframes,omitempty"`        // periods used in a multi-timeframe analysis
+
+	SmoothedConfidence *float64 `json:"smoothed_confidence,omitempty"` // EWMA over the symbol's prior analyses
+	RawConfidence      *float64 `json:"raw_confidence,omitempty"`      // the model's confidence before calibration
+	Tags               []string `json:"tags,omitempty"`                // user categories, normalized to lowercase
+	PositionContext    bool     `json:"position_context,omitempty"`    // the user's position was included in the prompt
+
+	SuggestedAlerts []AlertSuggestion `json:"suggested_alerts,omitempty"` // levels offered for one-click alerts
+
+	Beta      *float64 `json:"beta,omitempty"`      // beta against Benchmark, when a comparison was included
+	Benchmark string   `json:"benchmark,omitempty"` // benchmark symbol the beta is measured against
+
+	DetailLevel string `json:"detail_level,omitempty"` // reasoning length requested, e.g. "brief"
+
+	Ensemble []EnsembleVerdict `json:"ensemble,omitempty"` // each model's own verdict, for ensemble analyses
+
+	// Token usage and estimated cost of the completions that produced this analysis
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+
+	Cached bool `json:"cached,omitempty"`  // reused from the analysis cache instead of a new AI call
+	DryRun bool `json:"dry_run,omitempty"` // not saved, cached, forwarded or notified
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // soft-deleted; purged after SOFT_DELETE_RETENTION
+
+	// Rendered prompt and raw model reply, kept only in the analysis_debug table
+	Prompt      string `json:"-"`
+	RawResponse string `json:"-"`
+}
+
+// AnalysisDebug is the prompt sent and raw reply received for a stored analysis,
+// with anything resembling an API key redacted
+type AnalysisDebug struct {
+	AnalysisID  int64     `json:"analysis_id"`
+	Prompt      string    `json:"prompt"`
+	RawResponse string    `json:"raw_response"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TimelinePoint is one stored analysis in a symbol's timeline, with the price it was made at
+type TimelinePoint struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Action     string    `json:"action"`
+	Confidence float64   `json:"confidence"`
+	Price      float64   `json:"price"` // 0 for analyses saved before prices were kept
+}
+
+// AnalysisDiff compares two analyses of the same symbol, To against the baseline From
+type AnalysisDiff struct {
+	From *AnalysisResponse `json:"from"`
+	To   *AnalysisResponse `json:"to"`
+
+	ActionChanged   bool    `json:"action_changed"`
+	ConfidenceDelta float64 `json:"confidence_delta"` // To minus From
+	// PriceDelta and PriceChangePercent compare the quotes the analyses were made at;
+	// they're left out when either predates prices being kept
+	PriceDelta         *float64 `json:"price_delta,omitempty"`
+	PriceChangePercent *float64 `json:"price_change_percent,omitempty"`
+
+	Reasoning []DiffSegment `json:"reasoning"`
+}
+
+// DiffSegment is a run of words of a text diff: kept in both texts ("equal"), only in
+// the baseline ("delete") or only in the text compared against it ("insert")
+type DiffSegment struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
 }
 
 // PriceTargets holds price target information
@@ -85,22 +567,114 @@ type PriceTargets struct {
 // PriceAlert represents a user-defined price alert
 type PriceAlert struct {
 	ID        int64     `json:"id"`
+	ProfileID int64     `json:"profile_id"`
 	Symbol    string    `json:"symbol"`
-	Condition string    `json:"condition"` // "above" | "below"
+	Condition string    `json:"condition"` // "above" | "below" | "pct_change_up" | "volume_spike" | ...
 	Price     float64   `json:"price"`
 	Triggered bool      `json:"triggered"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// Move and volume conditions
+	ReferencePrice float64 `json:"reference_price,omitempty"` // pct_change_*: price the move is measured from (0 uses the previous close)
+	Percent        float64 `json:"percent,omitempty"`         // pct_change_*: size of the move in percent
+	VolumeMultiple float64 `json:"volume_multiple,omitempty"` // volume_spike: multiple of the 20-day average volume (0 uses 2)
+
+	// Lifetime: one-shot alerts deactivate after firing once; recurring ones stay active
+	// until they expire or are deleted
+	Recurring bool       `json:"recurring,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Expired   bool       `json:"expired,omitempty"` // deactivated by reaching ExpiresAt
+
+	// Repeat behavior for recurring alerts; setting either makes an alert recurring
+	CooldownSeconds int        `json:"cooldown_seconds,omitempty"` // minimum time between firings
+	Rearm           bool       `json:"rearm,omitempty"`            // fire again only after the condition stops matching
+	Disarmed        bool       `json:"disarmed,omitempty"`         // a re-arm alert waiting for its condition to clear
+	LastTriggeredAt *time.Time `json:"last_triggered_at,omitempty"`
+
+	MutedUntil *time.Time `json:"muted_until,omitempty"` // notifications are suppressed until then
+	// BypassQuietHours notifies even during quiet hours, for alerts that can't wait
+	BypassQuietHours bool `json:"bypass_quiet_hours,omitempty"`
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // soft-deleted; purged after SOFT_DELETE_RETENTION
+}
+
+// EnsembleVerdict is one model's verdict in an ensemble analysis, or why it gave none
+type EnsembleVerdict struct {
+	Provider   string  `json:"provider"`
+	Model      string  `json:"model"`
+	Weight     float64 `json:"weight"`
+	Action     string  `json:"action,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+	Error      string  `json:"error,omitempty"` // the member failed or ran out of time
+}
+
+// Job statuses: a job is pending until a worker claims it, running while it does, and
+// done or failed once it finishes; a failed attempt with retries left goes back to pending
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is a unit of background work in the durable job queue, so it survives restarts
+type Job struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"` // "analysis", "notification" or "prune"
+	ProfileID   int64           `json:"profile_id,omitempty"`
+	Key         string          `json:"key,omitempty"` // a pending job with the same type and key makes a new one redundant
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	RunAt       time.Time       `json:"run_at"` // when it's due, or due again after a failed attempt
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// AlertTrigger is one time an alert fired, with the market as it stood then
+type AlertTrigger struct {
+	ID            int64     `json:"id"`
+	AlertID       int64     `json:"alert_id"`
+	Symbol        string    `json:"symbol"`
+	Price         float64   `json:"price"`
+	PreviousClose float64   `json:"previous_close"`
+	ChangePercent float64   `json:"change_percent"`
+	Volume        int64     `json:"volume"`
+	Source        string    `json:"source"` // "stream" or "poll"
+	Message       string    `json:"message"`
+	TriggeredAt   time.Time `json:"triggered_at"`
 }
 
 // Notification represents a notification to be sent
 type Notification struct {
 	ID       int64     `json:"id"`
-	Type     string    `json:"type"` // "buy_signal", "sell_signal", "price_alert"
+	Type     string    `json:"type"` // "buy_signal", "sell_signal", "price_alert", "daily_digest"
 	Title    string    `json:"title"`
 	Message  string    `json:"message"`
 	Symbol   string    `json:"symbol"`
 	SentAt   time.Time `json:"sent_at"`
 	Channels []string  `json:"channels"` // which channels it was sent to
+
+	RequestID string `json:"-"` // correlation ID of the request that raised it, for logs
+	// BypassQuietHours sends it even during quiet hours (price alerts that ask for it)
+	BypassQuietHours bool `json:"-"`
+}
+
+// NotificationDelivery is the outcome of sending one notification to one channel
+type NotificationDelivery struct {
+	ID               int64     `json:"id"`
+	NotificationType string    `json:"notification_type"`
+	Title            string    `json:"title"`
+	Symbol           string    `json:"symbol"`
+	ChannelID        int64     `json:"channel_id"`
+	ChannelType      string    `json:"channel_type"`
+	Status           string    `json:"status"` // "delivered", "failed", "queued" by a rate limit, or "deferred" or "suppressed" by quiet hours
+	Attempts         int       `json:"attempts"`
+	Error            string    `json:"error,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
 }
 
 // RiskProfile defines analysis behavior based on risk tolerance
@@ -161,9 +735,11 @@ type Recommendation struct {
 	Symbol      string    `json:"symbol"`
 	Action      string    `json:"action"`
 	Confidence  float64   `json:"confidence"`
+	EntryPrice  float64   `json:"entry_price"`
 	TargetPrice float64   `json:"target_price"`
 	StopLoss    float64   `json:"stop_loss"`
 	Reasoning   string    `json:"reasoning"`
+	Risks       []string  `json:"risks"`
 	Timeframe   string    `json:"timeframe"`
 	AIProvider  string    `json:"ai_provider"`
 	CreatedAt   time.Time `json:"created_at"`
@@ -186,12 +762,15 @@ type Analysis struct {
 	Recommendation Recommendation `json:"recommendation"`
 	MarketData     *Quote         `json:"market_data"`
 	AIProvider     string         `json:"ai_provider"`
+	Tags           []string       `json:"tags,omitempty"`
 	CreatedAt      time.Time      `json:"created_at"`
 }
 
 // AppConfig for settings page
 type AppConfig struct {
+	ProfileID          int64    `json:"profile_id"`
 	MarketDataProvider string   `json:"market_data_provider"`
+	MarketDataFallback string   `json:"market_data_provider_fallback"`
 	HasMarketAPIKey    bool     `json:"has_market_api_key"`
 	MarketAPIKeyMasked string   `json:"market_api_key_masked"`
 	AIProvider         string   `json:"ai_provider"`
@@ -202,10 +781,14 @@ type AppConfig struct {
 	TradeFrequency     string   `json:"trade_frequency"`
 	TrackedSymbols     []string `json:"tracked_symbols"`
 	PollingInterval    int      `json:"polling_interval"` // in seconds
+	ExtendedHours      bool     `json:"include_extended_hours"`
+	Version            int64    `json:"version"`
 	EmailAddress       string   `json:"email_address"`
 	EmailEnabled       bool     `json:"email_enabled"`
 	DiscordWebhook     string   `json:"discord_webhook"`
 	DiscordEnabled     bool     `json:"discord_enabled"`
+	SlackWebhook       string   `json:"slack_webhook"`
+	SlackEnabled       bool     `json:"slack_enabled"`
 	SMSPhone           string   `json:"sms_phone"`
 	SMSEnabled         bool     `json:"sms_enabled"`
 }
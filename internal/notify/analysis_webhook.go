@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"stockmarket/internal/models"
+)
+
+// AnalysisWebhook forwards analysis results to a downstream HTTP endpoint
+type AnalysisWebhook struct {
+	url           string
+	actions       map[string]bool
+	minConfidence float64
+	client        *http.Client
+}
+
+// NewAnalysisWebhook creates an analysis webhook. An empty actions list forwards every action.
+func NewAnalysisWebhook(url string, actions []string, minConfidence float64) *AnalysisWebhook {
+	allowed := make(map[string]bool, len(actions))
+	for _, action := range actions {
+		allowed[strings.ToUpper(action)] = true
+	}
+
+	return &AnalysisWebhook{
+		url:           url,
+		actions:       allowed,
+		minConfidence: minConfidence,
+		client:        sharedHTTPClient,
+	}
+}
+
+// Matches reports whether an analysis passes the action and confidence filters
+func (w *AnalysisWebhook) Matches(analysis *models.AnalysisResponse) bool {
+	if len(w.actions) > 0 && !w.actions[strings.ToUpper(analysis.Action)] {
+		return false
+	}
+	return analysis.Confidence >= w.minConfidence
+}
+
+// Forward posts the analysis to the webhook if it passes the configured filters
+func (w *AnalysisWebhook) Forward(analysis *models.AnalysisResponse) error {
+	if !w.Matches(analysis) {
+		log.Printf("[WEBHOOK] Filtered out analysis %d for %s (action=%s confidence=%.2f)",
+			analysis.ID, analysis.Symbol, analysis.Action, analysis.Confidence)
+		return nil
+	}
+
+	jsonBody, err := json.Marshal(analysis)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: analysis webhook returned status %d", ErrNotificationFailed, resp.StatusCode)
+	}
+
+	log.Printf("[WEBHOOK] Forwarded analysis %d for %s (action=%s confidence=%.2f)",
+		analysis.ID, analysis.Symbol, analysis.Action, analysis.Confidence)
+	return nil
+}
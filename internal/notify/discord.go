@@ -79,12 +79,12 @@ func (d *DiscordNotifier) Send(notification models.Notification, target string)
 
 	resp, err := d.client.Post(target, "application/json", bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+		return fmt.Errorf("%w: %w", ErrNotificationFailed, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("%w: discord returned status %d", ErrNotificationFailed, resp.StatusCode)
+		return &statusError{service: "discord", code: resp.StatusCode}
 	}
 
 	return nil
@@ -72,14 +72,14 @@ func (e *EmailNotifier) Send(notification models.Notification, target string) er
 
 	resp, err := e.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("%w: failed to send email: %v", ErrNotificationFailed, err)
+		return fmt.Errorf("%w: failed to send email: %w", ErrNotificationFailed, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		var errResp map[string]interface{}
 		json.NewDecoder(resp.Body).Decode(&errResp)
-		return fmt.Errorf("%w: resend returned status %d: %v", ErrNotificationFailed, resp.StatusCode, errResp)
+		return &statusError{service: "resend", code: resp.StatusCode, detail: fmt.Sprint(errResp)}
 	}
 
 	fmt.Printf("[EMAIL] Successfully sent email to %s\n", target)
@@ -126,7 +126,7 @@ func formatEmailBody(n models.Notification) string {
           <tr>
             <td style="padding: 30px;">
               <h2 style="margin: 0 0 10px 0; color: #111827; font-size: 20px; font-weight: 600;">%s</h2>
-              <p style="margin: 0 0 20px 0; color: #6b7280; font-size: 16px; line-height: 1.5;">%s</p>
+              <p style="margin: 0 0 20px 0; color: #6b7280; font-size: 16px; line-height: 1.5; white-space: pre-line;">%s</p>
               <table role="presentation" style="width: 100%%; background: #f9fafb; border-radius: 8px; padding: 20px;">
                 <tr>
                   <td style="padding: 10px 20px;">
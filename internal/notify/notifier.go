@@ -1,10 +1,16 @@
 package notify
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"stockmarket/internal/models"
@@ -31,9 +37,60 @@ type Notifier interface {
 	Type() string
 }
 
+// ChannelNotifier is implemented by notifiers that need a channel's full
+// configuration, not just its target, to send
+type ChannelNotifier interface {
+	SendChannel(notification models.Notification, channel models.NotificationConfig) error
+}
+
 // ErrNotificationFailed is returned when notification fails
 var ErrNotificationFailed = errors.New("notification failed")
 
+// ErrThrottled is reported for a channel whose notification was queued by its rate
+// limit instead of sent; its delivery is recorded once the queue sends it
+var ErrThrottled = errors.New("notification queued by rate limit")
+
+// ErrDropped is the outcome of a queued or held notification discarded because its
+// rate-limit or quiet-hours queue was full
+var ErrDropped = errors.New("notification dropped from a full queue")
+
+// statusError is a non-2xx response from a notification endpoint
+type statusError struct {
+	service string
+	code    int
+	detail  string
+}
+
+func (e *statusError) Error() string {
+	msg := fmt.Sprintf("%v: %s returned status %d", ErrNotificationFailed, e.service, e.code)
+	if e.detail != "" {
+		msg += ": " + e.detail
+	}
+	return msg
+}
+
+func (e *statusError) Unwrap() error {
+	return ErrNotificationFailed
+}
+
+// retryable reports whether a send failure is worth retrying: network errors,
+// rate limiting and server errors. Bad configuration and rejected requests aren't.
+func retryable(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code == http.StatusTooManyRequests || status.code >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Delivery defaults; see SetDeliveryPolicy
+const (
+	defaultSendTimeout  = 30 * time.Second
+	defaultSendRetries  = 2
+	defaultRetryBackoff = 500 * time.Millisecond
+)
+
 // NewNotifier creates a notifier based on the type
 func NewNotifier(notifType string, config map[string]string) (Notifier, error) {
 	switch notifType {
@@ -41,23 +98,170 @@ func NewNotifier(notifType string, config map[string]string) (Notifier, error) {
 		return NewEmailNotifier(config), nil
 	case "discord":
 		return NewDiscordNotifier(), nil
+	case "slack":
+		return NewSlackNotifier(), nil
 	case "sms":
 		return NewSMSNotifier(config), nil
+	case "webhook":
+		return NewWebhookNotifier(), nil
+	case "telegram":
+		return NewTelegramNotifier(), nil
 	default:
 		return nil, errors.New("unknown notifier type: " + notifType)
 	}
 }
 
+// Dispatch pool defaults; see NewService
+const (
+	defaultDispatchWorkers   = 4
+	defaultDispatchQueueSize = 100
+)
+
+// dispatchJob is a queued notification awaiting delivery
+type dispatchJob struct {
+	notification models.Notification
+	channels     []models.NotificationConfig
+}
+
 // Service manages sending notifications to configured channels
 type Service struct {
 	notifiers map[string]Notifier
+	throttles map[string]*channelThrottle // outbound rate limits by channel type
+	quiet     *quietHours                 // nil when there are no quiet hours
+
+	// Delivery policy and the optional sink for per-channel outcomes
+	sendTimeout  time.Duration
+	retries      int
+	retryBackoff time.Duration
+	recorder     func(models.NotificationDelivery)
+
+	// Asynchronous dispatch queue and its worker pool, drained on shutdown
+	queue     chan dispatchJob
+	workers   sync.WaitGroup
+	queueMu   sync.RWMutex
+	closed    bool
+	abandoned atomic.Bool
+	flushed   atomic.Int64
+	dropped   atomic.Int64
+	done      chan struct{}
+}
+
+// NewService creates a new notification service and starts a pool of workers
+// delivering from a queue of up to queueSize notifications. Non-positive values
+// use the defaults.
+func NewService(workers, queueSize int) *Service {
+	if workers <= 0 {
+		workers = defaultDispatchWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultDispatchQueueSize
+	}
+	s := &Service{
+		notifiers:    make(map[string]Notifier),
+		throttles:    make(map[string]*channelThrottle),
+		sendTimeout:  defaultSendTimeout,
+		retries:      defaultSendRetries,
+		retryBackoff: defaultRetryBackoff,
+		queue:        make(chan dispatchJob, queueSize),
+		done:         make(chan struct{}),
+	}
+	s.workers.Add(workers)
+	for range workers {
+		go s.runDispatcher()
+	}
+	go func() {
+		s.workers.Wait()
+		close(s.done)
+	}()
+	return s
 }
 
-// NewService creates a new notification service
-func NewService() *Service {
-	return &Service{
-		notifiers: make(map[string]Notifier),
+// Enqueue queues a notification for asynchronous delivery without blocking.
+// Notifications are dropped with a warning if the queue is full or the service is
+// draining.
+func (s *Service) Enqueue(notification models.Notification, channels []models.NotificationConfig) {
+	s.queueMu.RLock()
+	defer s.queueMu.RUnlock()
+
+	if s.closed {
+		s.dropped.Add(1)
+		log.Printf("[NOTIFY] Dropping notification type=%s: service is shutting down", notification.Type)
+		return
+	}
+
+	select {
+	case s.queue <- dispatchJob{notification: notification, channels: channels}:
+	default:
+		s.dropped.Add(1)
+		log.Printf("[NOTIFY] Dropping notification type=%s: dispatch queue full%s", notification.Type, requestTag(notification))
+	}
+}
+
+// requestTag formats the ID of the request that raised a notification for log lines,
+// so deliveries can be traced back to it
+func requestTag(notification models.Notification) string {
+	if notification.RequestID == "" {
+		return ""
+	}
+	return " request_id=" + notification.RequestID
+}
+
+// runDispatcher delivers queued notifications until the queue is closed
+func (s *Service) runDispatcher() {
+	defer s.workers.Done()
+	for job := range s.queue {
+		if s.abandoned.Load() {
+			s.dropped.Add(1)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
+		s.SendToChannels(ctx, job.notification, job.channels)
+		cancel()
+		s.flushed.Add(1)
+	}
+}
+
+// Drain stops accepting notifications and waits for queued and in-flight ones to be
+// delivered, giving up when ctx expires. It returns how many queued notifications
+// were delivered during the drain and how many were dropped.
+func (s *Service) Drain(ctx context.Context) (flushed, dropped int64) {
+	s.queueMu.Lock()
+	if s.closed {
+		s.queueMu.Unlock()
+		return 0, 0
+	}
+	s.closed = true
+	pending := int64(len(s.queue))
+	flushedBefore := s.flushed.Load()
+	droppedBefore := s.dropped.Load()
+	close(s.queue)
+	s.queueMu.Unlock()
+
+	select {
+	case <-s.done:
+		flushed = s.flushed.Load() - flushedBefore
+		dropped = s.dropped.Load() - droppedBefore
+	case <-ctx.Done():
+		// Stop delivering; anything not yet sent (including in-flight sends) is lost
+		s.abandoned.Store(true)
+		flushed = s.flushed.Load() - flushedBefore
+		dropped = pending - flushed
+	}
+
+	log.Printf("[NOTIFY] Shutdown flushed %d and dropped %d of %d queued notifications",
+		flushed, dropped, pending)
+
+	for channel, t := range s.throttles {
+		if n := t.close(); n > 0 {
+			log.Printf("[NOTIFY] Shutdown dropped %d throttled %s notification(s)", n, channel)
+		}
 	}
+	if s.quiet != nil {
+		if n := s.quiet.close(); n > 0 {
+			log.Printf("[NOTIFY] Shutdown dropped %d notification(s) held for quiet hours", n)
+		}
+	}
+	return flushed, dropped
 }
 
 // RegisterNotifier registers a notifier
@@ -65,11 +269,217 @@ func (s *Service) RegisterNotifier(n Notifier) {
 	s.notifiers[n.Type()] = n
 }
 
-// SendToChannels sends a notification to all enabled channels
-func (s *Service) SendToChannels(notification models.Notification, channels []models.NotificationConfig) []error {
-	var errs []error
+// HasNotifier reports whether a notifier is registered for a channel type
+func (s *Service) HasNotifier(channelType string) bool {
+	_, ok := s.notifiers[channelType]
+	return ok
+}
 
-	log.Printf("[NOTIFY] Sending notification type=%s to %d channels", notification.Type, len(channels))
+// SetDeliveryPolicy sets how long queued notifications may take to reach all their
+// channels and how many times, with doubling backoff, a transient failure is retried.
+// Call before dispatching.
+func (s *Service) SetDeliveryPolicy(timeout time.Duration, retries int, backoff time.Duration) {
+	s.sendTimeout = timeout
+	s.retries = retries
+	s.retryBackoff = backoff
+}
+
+// SetDeliveryRecorder sets a function that receives the outcome of every channel
+// delivery. Call before dispatching.
+func (s *Service) SetDeliveryRecorder(recorder func(models.NotificationDelivery)) {
+	s.recorder = recorder
+}
+
+// SetRateLimit limits sends to a channel type to burst notifications per interval.
+// Excess notifications wait in a queue of up to queueSize, after which overflow
+// ("drop" or "digest") decides what happens. Call before dispatching.
+func (s *Service) SetRateLimit(channelType string, burst int, interval time.Duration, queueSize int, overflow string) {
+	t := newChannelThrottle(channelType, burst, interval, queueSize, overflow)
+	s.throttles[channelType] = t
+	go t.run(func(item pendingSend) {
+		if s.holdIfQuiet(item) {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
+		defer cancel()
+		item.finish(s.deliver(ctx, item.notification, item.channel))
+	})
+}
+
+// SetQuietHours holds back notifications raised between the "HH:MM" times start and
+// end in location, which may span midnight. Depending on mode (QuietHoursDefer,
+// QuietHoursDigest or QuietHoursDrop) they're sent one by one or as a digest per
+// channel when quiet hours end, or discarded. Notifications with BypassQuietHours set
+// are always sent. The arguments are validated by config.Load. Call before dispatching.
+func (s *Service) SetQuietHours(start, end string, location *time.Location, mode string) error {
+	q, err := newQuietHours(start, end, location, mode)
+	if err != nil {
+		return err
+	}
+	s.quiet = q
+	go q.run(s.sendHeld)
+	return nil
+}
+
+// holdIfQuiet holds back, or drops in QuietHoursDrop mode, a queued notification that
+// a rate limit releases during quiet hours, reporting whether it did
+func (s *Service) holdIfQuiet(item pendingSend) bool {
+	if s.quiet == nil || item.notification.BypassQuietHours || !s.quiet.contains(time.Now()) {
+		return false
+	}
+	log.Printf("[NOTIFY] Quiet hours, holding back queued %s notification (%s)%s", item.channel.Type, s.quiet.mode, requestTag(item.notification))
+	s.record(item.notification, item.channel, 0, ErrQuietHours)
+	if s.quiet.mode == QuietHoursDrop {
+		item.finish(ErrQuietHours)
+	} else {
+		s.quiet.hold(item)
+	}
+	return true
+}
+
+// sendHeld sends notifications held through quiet hours, subject to rate limits
+func (s *Service) sendHeld(items []pendingSend) {
+	var wg sync.WaitGroup
+	for _, item := range items {
+		if t, ok := s.throttles[item.channel.Type]; ok && !t.allow() {
+			t.enqueue(item)
+			s.record(item.notification, item.channel, 0, ErrThrottled)
+			continue
+		}
+		wg.Add(1)
+		go func(item pendingSend) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
+			defer cancel()
+			item.finish(s.deliver(ctx, item.notification, item.channel))
+		}(item)
+	}
+	wg.Wait()
+}
+
+// send delivers one notification through the registered notifier for a channel's type
+func (s *Service) send(notification models.Notification, channel models.NotificationConfig) error {
+	log.Printf("[NOTIFY] Sending %s notification to %s%s", channel.Type, channel.Target, requestTag(notification))
+	n := s.notifiers[channel.Type]
+	var err error
+	if cn, ok := n.(ChannelNotifier); ok {
+		err = cn.SendChannel(notification, channel)
+	} else {
+		err = n.Send(notification, channel.Target)
+	}
+	if err != nil {
+		log.Printf("[NOTIFY] Failed to send %s notification: %v%s", channel.Type, err, requestTag(notification))
+		return err
+	}
+	log.Printf("[NOTIFY] Successfully sent %s notification%s", channel.Type, requestTag(notification))
+	return nil
+}
+
+// deliver sends a notification to one channel, retrying transient failures with
+// doubling backoff until the retries or ctx run out, and records the outcome
+func (s *Service) deliver(ctx context.Context, notification models.Notification, channel models.NotificationConfig) error {
+	backoff := s.retryBackoff
+	attempts := 0
+	var err error
+	for {
+		attempts++
+		if err = s.sendContext(ctx, notification, channel); err == nil || attempts > s.retries || !retryable(err) {
+			break
+		}
+		log.Printf("[NOTIFY] Retrying %s notification in %s (attempt %d failed)%s", channel.Type, backoff, attempts, requestTag(notification))
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+			backoff *= 2
+			continue
+		}
+		break
+	}
+	s.record(notification, channel, attempts, err)
+	return err
+}
+
+// sendContext sends a notification but stops waiting once ctx is done. The
+// notifier's own HTTP timeout bounds a request abandoned this way.
+func (s *Service) sendContext(ctx context.Context, notification models.Notification, channel models.NotificationConfig) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.send(notification, channel)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, ctx.Err())
+	}
+}
+
+// SendTest sends a notification to one channel immediately, bypassing its enabled
+// flag, event filter, rate limit and retries, and returns the notifier's error
+func (s *Service) SendTest(ctx context.Context, notification models.Notification, channel models.NotificationConfig) error {
+	if !s.HasNotifier(channel.Type) {
+		return errors.New("no notifier for type: " + channel.Type)
+	}
+	return s.sendContext(ctx, notification, channel)
+}
+
+// record reports a channel delivery outcome to the recorder, if one is set
+func (s *Service) record(notification models.Notification, channel models.NotificationConfig, attempts int, err error) {
+	if s.recorder == nil {
+		return
+	}
+	delivery := models.NotificationDelivery{
+		NotificationType: notification.Type,
+		Title:            notification.Title,
+		Symbol:           notification.Symbol,
+		ChannelID:        channel.ID,
+		ChannelType:      channel.Type,
+		Status:           "delivered",
+		Attempts:         attempts,
+		CreatedAt:        time.Now(),
+	}
+	switch {
+	case errors.Is(err, ErrThrottled):
+		delivery.Status = "queued"
+	case errors.Is(err, ErrQuietHours) && s.quiet.mode == QuietHoursDrop:
+		delivery.Status = "suppressed"
+	case errors.Is(err, ErrQuietHours):
+		delivery.Status = "deferred"
+	case err != nil:
+		delivery.Status = "failed"
+		delivery.Error = err.Error()
+	}
+	s.recorder(delivery)
+}
+
+// SendToChannels sends a notification to every enabled channel subscribed to its
+// type whose symbol filter admits its symbol, in parallel so a slow or broken channel doesn't hold up the others, and
+// waits for them within ctx. The result has an entry per attempted channel ID: nil
+// when delivered, ErrThrottled when queued by a rate limit, ErrQuietHours when held
+// back by quiet hours, otherwise the failure.
+func (s *Service) SendToChannels(ctx context.Context, notification models.Notification, channels []models.NotificationConfig) map[int64]error {
+	results, _ := s.SendToChannelsTracked(ctx, notification, channels, nil)
+	return results
+}
+
+// SendToChannelsTracked sends like SendToChannels and also returns the IDs of the
+// channels whose notification a rate limit queued or quiet hours held back in memory.
+// Once each of those is finally sent, fails or is dropped, released gets its outcome,
+// possibly before SendToChannelsTracked returns. Held notifications abandoned at
+// shutdown are never released.
+func (s *Service) SendToChannelsTracked(ctx context.Context, notification models.Notification, channels []models.NotificationConfig, released func(channelID int64, err error)) (map[int64]error, []int64) {
+	results := make(map[int64]error)
+	var held []int64
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	log.Printf("[NOTIFY] Sending notification type=%s to %d channels%s", notification.Type, len(channels), requestTag(notification))
+	quiet := s.quiet != nil && !notification.BypassQuietHours && s.quiet.contains(time.Now())
 
 	for _, ch := range channels {
 		if !ch.Enabled {
@@ -89,22 +499,74 @@ func (s *Service) SendToChannels(notification models.Notification, channels []mo
 			log.Printf("[NOTIFY] Channel %s doesn't handle event %s (events: %v)", ch.Type, notification.Type, ch.Events)
 			continue
 		}
+		if !MatchesSymbol(ch.Symbols, notification.Symbol) {
+			log.Printf("[NOTIFY] Channel %s filters out symbol %s", ch.Type, notification.Symbol)
+			continue
+		}
 
-		notifier, ok := s.notifiers[ch.Type]
-		if !ok {
+		if _, ok := s.notifiers[ch.Type]; !ok {
 			log.Printf("[NOTIFY] No notifier registered for type: %s", ch.Type)
-			errs = append(errs, errors.New("no notifier for type: "+ch.Type))
+			err := errors.New("no notifier for type: " + ch.Type)
+			mu.Lock()
+			results[ch.ID] = err
+			mu.Unlock()
+			s.record(notification, ch, 0, err)
 			continue
 		}
 
-		log.Printf("[NOTIFY] Sending %s notification to %s", ch.Type, ch.Target)
-		if err := notifier.Send(notification, ch.Target); err != nil {
-			log.Printf("[NOTIFY] Failed to send %s notification: %v", ch.Type, err)
-			errs = append(errs, err)
-		} else {
-			log.Printf("[NOTIFY] Successfully sent %s notification", ch.Type)
+		item := pendingSend{notification: notification, channel: ch}
+		if released != nil {
+			item.done = func(err error) { released(ch.ID, err) }
 		}
+
+		if quiet {
+			if s.quiet.mode != QuietHoursDrop {
+				held = append(held, ch.ID)
+				s.quiet.hold(item)
+			}
+			log.Printf("[NOTIFY] Quiet hours, holding back %s notification (%s)%s", ch.Type, s.quiet.mode, requestTag(notification))
+			mu.Lock()
+			results[ch.ID] = ErrQuietHours
+			mu.Unlock()
+			s.record(notification, ch, 0, ErrQuietHours)
+			continue
+		}
+
+		if t, ok := s.throttles[ch.Type]; ok && !t.allow() {
+			held = append(held, ch.ID)
+			t.enqueue(item)
+			mu.Lock()
+			results[ch.ID] = ErrThrottled
+			mu.Unlock()
+			s.record(notification, ch, 0, ErrThrottled)
+			continue
+		}
+
+		wg.Add(1)
+		go func(ch models.NotificationConfig) {
+			defer wg.Done()
+			err := s.deliver(ctx, notification, ch)
+			mu.Lock()
+			results[ch.ID] = err
+			mu.Unlock()
+		}(ch)
 	}
 
-	return errs
+	wg.Wait()
+	return results, held
+}
+
+// MatchesSymbol reports whether a channel's symbol filter admits a notification for
+// symbol. A nil filter, and a notification without a symbol, always match.
+func MatchesSymbol(filter *models.SymbolFilter, symbol string) bool {
+	if filter == nil || symbol == "" {
+		return true
+	}
+	listed := func(symbols []string) bool {
+		return slices.ContainsFunc(symbols, func(s string) bool { return strings.EqualFold(s, symbol) })
+	}
+	if len(filter.Include) > 0 && !listed(filter.Include) {
+		return false
+	}
+	return !listed(filter.Exclude)
 }
@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+
+	"stockmarket/internal/models"
+)
+
+// recordingNotifier records the targets it's sent to
+type recordingNotifier struct {
+	mu      sync.Mutex
+	targets []string
+}
+
+func (n *recordingNotifier) Send(_ models.Notification, target string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.targets = append(n.targets, target)
+	return nil
+}
+
+func (n *recordingNotifier) Type() string { return "webhook" }
+
+func (n *recordingNotifier) sent() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sent := n.targets
+	n.targets = nil
+	slices.Sort(sent)
+	return sent
+}
+
+// TestSendToChannelsRouting checks that a notification reaches the channels whose event
+// types and symbol filter admit it, and only those
+func TestSendToChannelsRouting(t *testing.T) {
+	s := NewService(1, 1)
+	recorder := &recordingNotifier{}
+	s.RegisterNotifier(recorder)
+	channels := []models.NotificationConfig{
+		{ID: 1, Type: "webhook", Target: "tsla-only", Enabled: true, Events: []string{"price_alert"}, Symbols: &models.SymbolFilter{Include: []string{"TSLA"}}},
+		{ID: 2, Type: "webhook", Target: "not-tsla", Enabled: true, Events: []string{"price_alert"}, Symbols: &models.SymbolFilter{Exclude: []string{"tsla"}}},
+		{ID: 3, Type: "webhook", Target: "signals", Enabled: true, Events: []string{"buy_signal"}},
+		{ID: 4, Type: "webhook", Target: "disabled", Enabled: false, Events: []string{"price_alert", "buy_signal"}},
+	}
+
+	cases := []struct {
+		notification models.Notification
+		want         []string
+	}{
+		{models.Notification{Type: "price_alert", Symbol: "TSLA"}, []string{"tsla-only"}},
+		{models.Notification{Type: "price_alert", Symbol: "AAPL"}, []string{"not-tsla"}},
+		{models.Notification{Type: "price_alert"}, []string{"not-tsla", "tsla-only"}}, // no symbol to filter on
+		{models.Notification{Type: "buy_signal", Symbol: "TSLA"}, []string{"signals"}},
+	}
+	for _, c := range cases {
+		results := s.SendToChannels(context.Background(), c.notification, channels)
+		if got := recorder.sent(); !slices.Equal(got, c.want) {
+			t.Errorf("%s for %q went to %v, want %v", c.notification.Type, c.notification.Symbol, got, c.want)
+		}
+		if len(results) != len(c.want) {
+			t.Errorf("%s for %q: %d results, want one per receiving channel", c.notification.Type, c.notification.Symbol, len(results))
+		}
+	}
+}
+
+func TestNewNotifier(t *testing.T) {
+	for _, notifType := range []string{"email", "discord", "slack", "sms", "webhook", "telegram"} {
+		n, err := NewNotifier(notifType, map[string]string{})
+		if err != nil {
+			t.Errorf("NewNotifier(%q): %v", notifType, err)
+			continue
+		}
+		if n.Type() != notifType {
+			t.Errorf("NewNotifier(%q).Type() = %q", notifType, n.Type())
+		}
+	}
+	if _, err := NewNotifier("pager", nil); err == nil {
+		t.Error("NewNotifier(\"pager\") succeeded, want an unknown type error")
+	}
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// What happens to notifications raised during quiet hours
+const (
+	QuietHoursDefer  = "defer"  // hold them and send each when quiet hours end
+	QuietHoursDigest = "digest" // hold them and send one summary per channel when quiet hours end
+	QuietHoursDrop   = "drop"   // discard them
+)
+
+// ErrQuietHours is reported for a channel whose notification was held back by quiet
+// hours; a deferred notification's delivery is recorded again once it's sent
+var ErrQuietHours = errors.New("notification held by quiet hours")
+
+// maxQuietHeld bounds the notifications held through one quiet period. Beyond it a
+// digest collapses what's held and defer drops the newest.
+const maxQuietHeld = 500
+
+// quietHours is a daily window, in its location's wall-clock time so it keeps its
+// hours across daylight saving changes, during which notifications are held back. A
+// window ending earlier in the day than it starts runs past midnight.
+type quietHours struct {
+	start, end int // minutes after midnight
+	location   *time.Location
+	mode       string
+
+	mu      sync.Mutex
+	pending []pendingSend
+	wake    chan struct{}
+	stop    chan struct{}
+}
+
+// parseClock returns the minutes after midnight of an "HH:MM" time
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// newQuietHours creates quiet hours from settings config.Load has validated
+func newQuietHours(start, end string, location *time.Location, mode string) (*quietHours, error) {
+	startMin, err := parseClock(start)
+	if err != nil {
+		return nil, err
+	}
+	endMin, err := parseClock(end)
+	if err != nil {
+		return nil, err
+	}
+	return &quietHours{
+		start:    startMin,
+		end:      endMin,
+		location: location,
+		mode:     mode,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// contains reports whether t falls within quiet hours
+func (q *quietHours) contains(t time.Time) bool {
+	local := t.In(q.location)
+	minute := local.Hour()*60 + local.Minute()
+	if q.start < q.end {
+		return minute >= q.start && minute < q.end
+	}
+	return minute >= q.start || minute < q.end
+}
+
+// nextEnd returns the first end of quiet hours after t. On a day the end's wall-clock
+// time is skipped by a daylight saving change it's the moment after the skip, and on
+// one it's repeated, as contains sees it, it's whichever occurrence comes next.
+func (q *quietHours) nextEnd(t time.Time) time.Time {
+	local := t.In(q.location)
+	for day := 0; ; day++ {
+		end := time.Date(local.Year(), local.Month(), local.Day()+day, q.end/60, q.end%60, 0, 0, q.location)
+		if end.Hour()*60+end.Minute() != q.end {
+			// time.Date resolves a skipped time to before the skip
+			_, end = end.ZoneBounds()
+		}
+		if end.After(t) {
+			return end
+		}
+		if _, change := end.ZoneBounds(); !change.IsZero() {
+			_, before := end.Zone()
+			_, after := change.Zone()
+			if repeat := end.Add(time.Duration(before-after) * time.Second); after < before && !repeat.Before(change) && repeat.After(t) {
+				return repeat
+			}
+		}
+	}
+}
+
+// hold keeps a notification until quiet hours end, applying the cap
+func (q *quietHours) hold(item pendingSend) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch {
+	case len(q.pending) < maxQuietHeld:
+		q.pending = append(q.pending, item)
+	case q.mode == QuietHoursDigest:
+		q.pending = digestQuiet(append(q.pending, item))
+	default:
+		log.Printf("[NOTIFY] Quiet hours queue full, dropping notification type=%s%s", item.notification.Type, requestTag(item.notification))
+		item.finish(ErrDropped)
+		return
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends the held notifications once quiet hours end, until stopped. It looks again
+// every minute while holding any, so a clock change can't leave them waiting.
+func (q *quietHours) run(send func([]pendingSend)) {
+	for {
+		now := time.Now()
+		q.mu.Lock()
+		if len(q.pending) > 0 && !q.contains(now) {
+			held := q.pending
+			q.pending = nil
+			q.mu.Unlock()
+			if q.mode == QuietHoursDigest {
+				held = digestQuiet(held)
+			}
+			log.Printf("[NOTIFY] Quiet hours over, sending %d held notification(s)", len(held))
+			send(held)
+			continue
+		}
+		var wait <-chan time.Time
+		if len(q.pending) > 0 {
+			wait = time.After(min(q.nextEnd(now).Sub(now), time.Minute))
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-wait:
+		}
+	}
+}
+
+// close stops the worker and returns how many held notifications were abandoned
+func (q *quietHours) close() int {
+	close(q.stop)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// digestQuiet collapses held notifications into a single summary per channel target,
+// keeping channel types apart since a target only means something to its own type
+func digestQuiet(items []pendingSend) []pendingSend {
+	var types []string
+	byType := make(map[string][]pendingSend)
+	for _, item := range items {
+		if _, ok := byType[item.channel.Type]; !ok {
+			types = append(types, item.channel.Type)
+		}
+		byType[item.channel.Type] = append(byType[item.channel.Type], item)
+	}
+	digested := make([]pendingSend, 0, len(types))
+	for _, channelType := range types {
+		digested = append(digested, digestPending(byType[channelType])...)
+	}
+	return digested
+}
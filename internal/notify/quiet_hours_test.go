@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+func TestQuietHoursSpringForward(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no timezone data:", err)
+	}
+	// 02:30 doesn't exist on 2024-03-10: the clocks jump from 02:00 EST to 03:00 EDT
+	q, err := newQuietHours("22:00", "02:30", ny, QuietHoursDefer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jump := time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC)
+
+	if got := q.nextEnd(time.Date(2024, 3, 9, 23, 0, 0, 0, ny)); !got.Equal(jump) {
+		t.Errorf("nextEnd before the change = %s, want the jump to 03:00 EDT", got.In(ny))
+	}
+	if got := q.nextEnd(jump.Add(-time.Minute)); !got.Equal(jump) {
+		t.Errorf("nextEnd at 01:59 EST = %s, want the jump to 03:00 EDT", got.In(ny))
+	}
+	if !q.contains(jump.Add(-time.Minute)) {
+		t.Error("01:59 EST should be quiet")
+	}
+	if q.contains(jump) {
+		t.Error("03:00 EDT should be past quiet hours")
+	}
+	if got, want := q.nextEnd(time.Date(2024, 3, 11, 23, 0, 0, 0, ny)), time.Date(2024, 3, 12, 2, 30, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("nextEnd after the change = %s, want %s", got, want)
+	}
+}
+
+func TestQuietHoursFallBack(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no timezone data:", err)
+	}
+	// 01:00-02:00 happens twice on 2024-11-03: first in EDT, then again in EST
+	q, err := newQuietHours("23:00", "01:30", ny, QuietHoursDefer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstEnd := time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC)  // 01:30 EDT
+	secondEnd := time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC) // 01:30 EST
+
+	if got := q.nextEnd(time.Date(2024, 11, 2, 23, 30, 0, 0, ny)); !got.Equal(firstEnd) {
+		t.Errorf("nextEnd before the change = %s, want 01:30 EDT", got.In(ny))
+	}
+	if q.contains(firstEnd.Add(15 * time.Minute)) {
+		t.Error("01:45 EDT should be past quiet hours")
+	}
+	repeated := time.Date(2024, 11, 3, 6, 10, 0, 0, time.UTC) // 01:10 EST
+	if !q.contains(repeated) {
+		t.Error("01:10 EST, on the wall clock before the end again, should be quiet")
+	}
+	if got := q.nextEnd(repeated); !got.Equal(secondEnd) {
+		t.Errorf("nextEnd in the repeated hour = %s, want 01:30 EST", got.In(ny))
+	}
+	if got, want := q.nextEnd(secondEnd), time.Date(2024, 11, 4, 1, 30, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("nextEnd at the second end = %s, want %s", got, want)
+	}
+}
+
+// TestQuietHoursHoldThrottled checks that a notification a rate limit releases during
+// quiet hours is held back like one raised then
+func TestQuietHoursHoldThrottled(t *testing.T) {
+	now := time.Now().UTC()
+	start, end := now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04")
+	s := NewService(1, 1)
+	var err error
+	if s.quiet, err = newQuietHours(start, end, time.UTC, QuietHoursDefer); err != nil {
+		t.Fatal(err)
+	}
+
+	item := pendingSend{channel: models.NotificationConfig{ID: 1, Type: "webhook"}, notification: models.Notification{Type: "alert"}}
+	if !s.holdIfQuiet(item) {
+		t.Fatal("queued notification sent during quiet hours")
+	}
+	if len(s.quiet.pending) != 1 {
+		t.Errorf("held %d notification(s), want 1", len(s.quiet.pending))
+	}
+
+	item.notification.BypassQuietHours = true
+	if s.holdIfQuiet(item) {
+		t.Error("a notification bypassing quiet hours was held")
+	}
+
+	s.quiet.mode = QuietHoursDrop
+	var outcome error
+	item.notification.BypassQuietHours = false
+	item.done = func(err error) { outcome = err }
+	if !s.holdIfQuiet(item) || outcome != ErrQuietHours || len(s.quiet.pending) != 1 {
+		t.Errorf("drop mode: outcome %v with %d held, want ErrQuietHours and nothing more held", outcome, len(s.quiet.pending))
+	}
+}
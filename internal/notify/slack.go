@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// SlackNotifier sends notifications via Slack incoming webhook
+type SlackNotifier struct {
+	client *http.Client
+}
+
+// NewSlackNotifier creates a new Slack notifier
+func NewSlackNotifier() *SlackNotifier {
+	return &SlackNotifier{
+		client: sharedHTTPClient,
+	}
+}
+
+// Type returns the notifier type
+func (s *SlackNotifier) Type() string {
+	return "slack"
+}
+
+// Send posts a notification to a Slack incoming webhook URL
+func (s *SlackNotifier) Send(notification models.Notification, target string) error {
+	if target == "" {
+		return fmt.Errorf("%w: no slack webhook URL", ErrNotificationFailed)
+	}
+
+	// Signals are "<action>_signal"; other notifications have no action
+	action := "-"
+	if a, ok := strings.CutSuffix(notification.Type, "_signal"); ok {
+		action = strings.ToUpper(a)
+	}
+
+	// Color the attachment by action, as Slack's good/danger/warning palette
+	color := "#808080" // gray
+	switch action {
+	case "BUY":
+		color = "#2EB886" // green
+	case "SELL":
+		color = "#E01E5A" // red
+	case "HOLD", "WATCH":
+		color = "#ECB22E" // yellow
+	}
+
+	message := map[string]interface{}{
+		"text": notification.Title,
+		"attachments": []map[string]interface{}{
+			{
+				"color":    color,
+				"fallback": notification.Title + ": " + notification.Message,
+				"fields": []map[string]interface{}{
+					{
+						"title": "Symbol",
+						"value": notification.Symbol,
+						"short": true,
+					},
+					{
+						"title": "Action",
+						"value": action,
+						"short": true,
+					},
+					{
+						"title": "Reasoning",
+						"value": notification.Message,
+						"short": false,
+					},
+				},
+				"footer": "Stock Market Analysis Platform",
+				"ts":     time.Now().Unix(),
+			},
+		},
+	}
+
+	jsonBody, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(target, "application/json", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotificationFailed, err)
+	}
+	defer resp.Body.Close()
+
+	// Slack explains rejections (e.g. "invalid_token", "channel_not_found") in a plain-text body
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return &statusError{service: "slack", code: resp.StatusCode, detail: strings.TrimSpace(string(body))}
+	}
+
+	return nil
+}
@@ -79,7 +79,7 @@ func (s *SMSNotifier) Send(notification models.Notification, target string) erro
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+		return fmt.Errorf("%w: %w", ErrNotificationFailed, err)
 	}
 	defer resp.Body.Close()
 
@@ -87,7 +87,7 @@ func (s *SMSNotifier) Send(notification models.Notification, target string) erro
 		var errResp map[string]interface{}
 		json.NewDecoder(resp.Body).Decode(&errResp)
 		fmt.Printf("[SMS] Twilio error response: %v\n", errResp)
-		return fmt.Errorf("%w: twilio returned status %d: %v", ErrNotificationFailed, resp.StatusCode, errResp)
+		return &statusError{service: "twilio", code: resp.StatusCode, detail: fmt.Sprint(errResp)}
 	}
 
 	return nil
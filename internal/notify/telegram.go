@@ -0,0 +1,146 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"stockmarket/internal/models"
+)
+
+// telegramMaxMessage is the longest text Telegram's sendMessage accepts
+const telegramMaxMessage = 4096
+
+// telegramSpecialChars must be backslash-escaped in MarkdownV2 text
+const telegramSpecialChars = "_*[]()~`>#+-=|{}.!\\"
+
+// TelegramNotifier sends notifications to a Telegram chat through the Bot API
+type TelegramNotifier struct {
+	client  *http.Client
+	apiBase string
+}
+
+// NewTelegramNotifier creates a new Telegram notifier
+func NewTelegramNotifier() *TelegramNotifier {
+	return &TelegramNotifier{
+		client:  sharedHTTPClient,
+		apiBase: "https://api.telegram.org",
+	}
+}
+
+// Type returns the notifier type
+func (t *TelegramNotifier) Type() string {
+	return "telegram"
+}
+
+// Send sends to a chat ID without a bot token, which fails; channels go through SendChannel
+func (t *TelegramNotifier) Send(notification models.Notification, target string) error {
+	return t.SendChannel(notification, models.NotificationConfig{Type: t.Type(), Target: target})
+}
+
+// SendChannel sends the notification to the channel's chat (its target) with the
+// channel's bot token
+func (t *TelegramNotifier) SendChannel(notification models.Notification, channel models.NotificationConfig) error {
+	if channel.Target == "" {
+		return fmt.Errorf("%w: no telegram chat ID", ErrNotificationFailed)
+	}
+	if channel.Telegram == nil || channel.Telegram.BotToken == "" {
+		return fmt.Errorf("%w: no telegram bot token", ErrNotificationFailed)
+	}
+
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"chat_id":    channel.Target,
+		"text":       telegramMessage(notification),
+		"parse_mode": "MarkdownV2",
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Post(t.apiBase+"/bot"+channel.Telegram.BotToken+"/sendMessage", "application/json", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		// The request URL holds the bot token, so don't let it into logs
+		return fmt.Errorf("%w: telegram request failed", ErrNotificationFailed)
+	}
+	defer resp.Body.Close()
+
+	// Telegram reports every outcome as {"ok": ..., "error_code": ..., "description": ...}
+	var result struct {
+		OK          bool   `json:"ok"`
+		ErrorCode   int    `json:"error_code"`
+		Description string `json:"description"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err := json.Unmarshal(body, &result); err != nil || !result.OK {
+		code := result.ErrorCode
+		if code == 0 {
+			code = resp.StatusCode
+		}
+		return &statusError{service: "telegram", code: code, detail: result.Description}
+	}
+
+	return nil
+}
+
+// telegramMessage formats a notification as MarkdownV2: the symbol in bold with the
+// action, the title, then the reasoning, cut short to fit Telegram's length limit. A
+// title too long to leave room for the reasoning is cut short too.
+func telegramMessage(notification models.Notification) string {
+	var header strings.Builder
+	if notification.Symbol != "" {
+		header.WriteString("*" + escapeTelegram(notification.Symbol) + "*")
+		// Signals are "<action>_signal"; other notifications have no action
+		if action, ok := strings.CutSuffix(notification.Type, "_signal"); ok {
+			header.WriteString(" " + escapeTelegram("· "+strings.ToUpper(action)))
+		}
+		header.WriteString("\n")
+	}
+	const separator = "\n\n"
+	titleBudget := telegramMaxMessage - utf8.RuneCountInString(header.String()) - utf8.RuneCountInString(separator)
+	header.WriteString(truncateTelegram(notification.Title, titleBudget) + separator)
+
+	budget := telegramMaxMessage - utf8.RuneCountInString(header.String())
+	return header.String() + truncateTelegram(notification.Message, budget)
+}
+
+// truncateTelegram escapes text and cuts it to at most budget characters, ending it
+// with an ellipsis when it's cut. It cuts on whole escaped characters so an escape
+// sequence is never split, and returns "" when the budget can't fit even the ellipsis.
+func truncateTelegram(text string, budget int) string {
+	const ellipsis = "…"
+	escaped := escapeTelegram(text)
+	if utf8.RuneCountInString(escaped) <= budget {
+		return escaped
+	}
+
+	var truncated strings.Builder
+	used := utf8.RuneCountInString(ellipsis)
+	if used > budget {
+		return ""
+	}
+	for _, r := range text {
+		escaped := escapeTelegram(string(r))
+		if used+utf8.RuneCountInString(escaped) > budget {
+			break
+		}
+		truncated.WriteString(escaped)
+		used += utf8.RuneCountInString(escaped)
+	}
+	return truncated.String() + ellipsis
+}
+
+// escapeTelegram escapes text for a MarkdownV2 message
+func escapeTelegram(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune(telegramSpecialChars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"stockmarket/internal/models"
+)
+
+func TestTelegramMessageFitsLimit(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		notification models.Notification
+	}{
+		{"long message", models.Notification{Type: "buy_signal", Symbol: "AAPL", Title: "Buy", Message: strings.Repeat("a.", telegramMaxMessage)}},
+		{"long title", models.Notification{Type: "buy_signal", Symbol: "AAPL", Title: strings.Repeat("t", 2*telegramMaxMessage), Message: "reasoning"}},
+		{"escaped title", models.Notification{Symbol: "BRK-B", Title: strings.Repeat(".", telegramMaxMessage), Message: "reasoning"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			text := telegramMessage(tc.notification)
+			if n := utf8.RuneCountInString(text); n > telegramMaxMessage {
+				t.Fatalf("message is %d characters, over the %d limit", n, telegramMaxMessage)
+			}
+			cut, _, ok := strings.Cut(text, "…")
+			if !ok {
+				t.Fatalf("cut message has no ellipsis: ...%s", text[len(text)-20:])
+			}
+			if strings.HasSuffix(cut, `\`) {
+				t.Error("cut inside an escape sequence")
+			}
+		})
+	}
+
+	short := telegramMessage(models.Notification{Type: "sell_signal", Symbol: "AAPL", Title: "Sell now", Message: "Price 1.5"})
+	if want := "*AAPL* · SELL\nSell now\n\nPrice 1\\.5"; short != want {
+		t.Errorf("short message = %q, want %q", short, want)
+	}
+}
@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// Overflow policies for a throttled channel whose queue is full
+const (
+	ThrottleOverflowDrop   = "drop"   // discard the newest notification
+	ThrottleOverflowDigest = "digest" // collapse the queue into one summary per target
+)
+
+// pendingSend is a throttled notification waiting for a token, or one held through
+// quiet hours. done, when set, gets the outcome once it's sent or dropped.
+type pendingSend struct {
+	notification models.Notification
+	channel      models.NotificationConfig
+	done         func(error)
+}
+
+// finish reports a held notification's outcome to its done func, if it has one
+func (p pendingSend) finish(err error) {
+	if p.done != nil {
+		p.done(err)
+	}
+}
+
+// channelThrottle is a token bucket limiting outbound sends for one channel type.
+// Sends beyond the limit wait in a bounded queue drained by run.
+type channelThrottle struct {
+	channel  string
+	burst    float64
+	rate     float64 // tokens per second
+	queueMax int
+	digest   bool
+
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time
+	pending []pendingSend
+	wake    chan struct{}
+	stop    chan struct{}
+}
+
+func newChannelThrottle(channel string, burst int, interval time.Duration, queueMax int, overflow string) *channelThrottle {
+	return &channelThrottle{
+		channel:  channel,
+		burst:    float64(burst),
+		rate:     float64(burst) / interval.Seconds(),
+		queueMax: queueMax,
+		digest:   overflow == ThrottleOverflowDigest,
+		tokens:   float64(burst),
+		last:     time.Now(),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// refill adds the tokens earned since the last refill; callers hold mu
+func (t *channelThrottle) refill() {
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+	t.last = now
+}
+
+// allow takes a token for an immediate send. It refuses while notifications are
+// queued so delivery stays in order.
+func (t *channelThrottle) allow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) > 0 {
+		return false
+	}
+	t.refill()
+	if t.tokens < 1 {
+		return false
+	}
+	t.tokens--
+	return true
+}
+
+// enqueue holds a notification until a token is available, applying the overflow
+// policy when the queue is full
+func (t *channelThrottle) enqueue(item pendingSend) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case len(t.pending) < t.queueMax:
+		t.pending = append(t.pending, item)
+		log.Printf("[NOTIFY] Throttling %s: %d notification(s) queued", t.channel, len(t.pending))
+	case t.digest:
+		t.pending = digestPending(append(t.pending, item))
+		log.Printf("[NOTIFY] Throttle queue full for %s, digested into %d notification(s)", t.channel, len(t.pending))
+	default:
+		log.Printf("[NOTIFY] Throttle queue full for %s, dropping notification type=%s", t.channel, item.notification.Type)
+		item.finish(ErrDropped)
+		return
+	}
+
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued notifications as tokens become available until stopped
+func (t *channelThrottle) run(send func(pendingSend)) {
+	for {
+		t.mu.Lock()
+		t.refill()
+		if len(t.pending) > 0 && t.tokens >= 1 {
+			item := t.pending[0]
+			t.pending = t.pending[1:]
+			t.tokens--
+			t.mu.Unlock()
+			send(item)
+			continue
+		}
+		var wait <-chan time.Time
+		if len(t.pending) > 0 {
+			wait = time.After(time.Duration((1 - t.tokens) / t.rate * float64(time.Second)))
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-t.stop:
+			return
+		case <-t.wake:
+		case <-wait:
+		}
+	}
+}
+
+// close stops the worker and returns how many queued notifications were abandoned
+func (t *channelThrottle) close() int {
+	close(t.stop)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+// digestPending collapses queued notifications into a single summary per target, which
+// reports its outcome to every collapsed notification's done func
+func digestPending(items []pendingSend) []pendingSend {
+	var targets []string
+	byTarget := make(map[string][]pendingSend)
+	for _, item := range items {
+		target := item.channel.Target
+		if _, ok := byTarget[target]; !ok {
+			targets = append(targets, target)
+		}
+		byTarget[target] = append(byTarget[target], item)
+	}
+
+	digested := make([]pendingSend, 0, len(targets))
+	for _, target := range targets {
+		held := byTarget[target]
+		if len(held) == 1 {
+			digested = append(digested, held[0])
+			continue
+		}
+
+		lines := make([]string, len(held))
+		for i, item := range held {
+			lines[i] = item.notification.Title + ": " + item.notification.Message
+		}
+		digested = append(digested, pendingSend{
+			channel: held[0].channel,
+			notification: models.Notification{
+				Type:    held[len(held)-1].notification.Type,
+				Title:   fmt.Sprintf("%d notifications", len(held)),
+				Message: strings.Join(lines, "\n"),
+			},
+			done: func(err error) {
+				for _, item := range held {
+					item.finish(err)
+				}
+			},
+		})
+	}
+	return digested
+}
@@ -0,0 +1,179 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"stockmarket/internal/models"
+)
+
+// Webhook request limits
+const (
+	defaultWebhookTimeout = 10 * time.Second
+	maxWebhookTimeout     = time.Minute
+)
+
+// webhookFuncs are available to payload templates. json encodes a value, so a
+// message with quotes or newlines still yields a valid body: {"text": {{json .Message}}}
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// WebhookNotifier sends notifications to an arbitrary HTTP endpoint, rendering the
+// JSON body from the channel's template
+type WebhookNotifier struct {
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a new generic webhook notifier
+func NewWebhookNotifier() *WebhookNotifier {
+	return &WebhookNotifier{
+		// Per-channel timeouts are applied with a context, so don't cap them with the
+		// shared client's own timeout
+		client: &http.Client{Transport: sharedHTTPClient.Transport},
+	}
+}
+
+// Type returns the notifier type
+func (w *WebhookNotifier) Type() string {
+	return "webhook"
+}
+
+// Send posts the notification as JSON to target with the default settings
+func (w *WebhookNotifier) Send(notification models.Notification, target string) error {
+	return w.SendChannel(notification, models.NotificationConfig{Type: w.Type(), Target: target})
+}
+
+// SendChannel sends the notification to the channel's URL using its webhook settings
+func (w *WebhookNotifier) SendChannel(notification models.Notification, channel models.NotificationConfig) error {
+	if channel.Target == "" {
+		return fmt.Errorf("%w: no webhook URL", ErrNotificationFailed)
+	}
+
+	method, timeout, tmpl, err := parseWebhookConfig(channel.Webhook)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+	body, err := renderWebhookBody(tmpl, notification)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, channel.Target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if channel.Webhook != nil {
+		for name, value := range channel.Webhook.Headers {
+			req.Header.Set(name, value)
+		}
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotificationFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return &statusError{service: "webhook", code: resp.StatusCode, detail: strings.TrimSpace(string(respBody))}
+	}
+
+	return nil
+}
+
+// ValidateWebhookConfig checks a webhook channel's settings, so a bad method, timeout
+// or template is rejected when the channel is saved rather than on every send. The
+// template is rendered against a sample notification and must produce valid JSON.
+func ValidateWebhookConfig(cfg *models.WebhookConfig) error {
+	_, _, tmpl, err := parseWebhookConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg != nil {
+		for name := range cfg.Headers {
+			if strings.TrimSpace(name) == "" || strings.ContainsAny(name, ": \t\r\n") {
+				return fmt.Errorf("invalid webhook header name %q", name)
+			}
+		}
+	}
+
+	sample := models.Notification{
+		Type:    "buy_signal",
+		Title:   "BUY AAPL",
+		Message: "Sample notification",
+		Symbol:  "AAPL",
+		SentAt:  time.Now(),
+	}
+	_, err = renderWebhookBody(tmpl, sample)
+	return err
+}
+
+// parseWebhookConfig resolves a channel's method, timeout and payload template,
+// applying defaults for anything unset. A nil template means the notification is
+// sent as plain JSON.
+func parseWebhookConfig(cfg *models.WebhookConfig) (string, time.Duration, *template.Template, error) {
+	if cfg == nil {
+		return http.MethodPost, defaultWebhookTimeout, nil, nil
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(cfg.Method))
+	switch method {
+	case "":
+		method = http.MethodPost
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return "", 0, nil, fmt.Errorf("webhook method must be POST, PUT or PATCH, got %q", cfg.Method)
+	}
+
+	timeout := defaultWebhookTimeout
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil || d <= 0 || d > maxWebhookTimeout {
+			return "", 0, nil, fmt.Errorf("webhook timeout must be a duration between 0 and %s, got %q", maxWebhookTimeout, cfg.Timeout)
+		}
+		timeout = d
+	}
+
+	if strings.TrimSpace(cfg.Template) == "" {
+		return method, timeout, nil, nil
+	}
+	tmpl, err := template.New("webhook").Funcs(webhookFuncs).Parse(cfg.Template)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("invalid webhook template: %v", err)
+	}
+	return method, timeout, tmpl, nil
+}
+
+// renderWebhookBody executes the payload template, or marshals the notification when
+// there is none, and checks the result is JSON
+func renderWebhookBody(tmpl *template.Template, notification models.Notification) ([]byte, error) {
+	if tmpl == nil {
+		return json.Marshal(notification)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, notification); err != nil {
+		return nil, fmt.Errorf("webhook template failed: %v", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.New("webhook template did not render valid JSON")
+	}
+	return buf.Bytes(), nil
+}
@@ -8,46 +8,40 @@ import (
 	"strings"
 	"time"
 
+	"stockmarket/internal/ai"
 	"stockmarket/internal/api"
 	"stockmarket/internal/db"
 	"stockmarket/internal/market"
+	"stockmarket/internal/models"
 	"stockmarket/internal/web/pages"
-
-	"github.com/scmhub/calendar"
 )
 
-// Package-level cached calendar (immutable, safe to share)
-var nyseCalendar = calendar.XNYS()
-
-// EST timezone for market hours
-var estLocation = time.FixedZone("EST", -5*60*60)
-
 // TemplHandlers uses templ components for rendering
 type TemplHandlers struct {
-	db *db.DB
+	db     *db.DB
+	server *api.Server
 }
 
-// NewTemplHandlers creates a new templ-based handler
-func NewTemplHandlers(database *db.DB) *TemplHandlers {
-	return &TemplHandlers{db: database}
+// NewTemplHandlers creates a new templ-based handler; server supplies the market overview
+func NewTemplHandlers(database *db.DB, server *api.Server) *TemplHandlers {
+	return &TemplHandlers{db: database, server: server}
 }
 
-// Dashboard renders the dashboard page using templ
+// Dashboard renders the dashboard page using templ, with the watchlist filled in from
+// the same overview as GET /api/overview
 func (h *TemplHandlers) Dashboard(w http.ResponseWriter, r *http.Request) {
-	config, _ := h.db.GetConfig()
-	alerts, _ := h.db.GetActiveAlerts()
+	userConfig, _ := h.db.GetProfileConfig(api.ProfileID(r.Context()))
 	recommendations, _ := h.db.GetRecommendationsToday()
 
-	var trackedSymbols []string
-	if config != nil {
-		trackedSymbols = config.TrackedSymbols
-	}
-
 	data := pages.DashboardData{
-		MarketOpen:     isMarketOpen(),
-		TrackedSymbols: trackedSymbols,
-		SignalsToday:   len(recommendations),
-		ActiveAlerts:   len(alerts),
+		MarketOpen:   isMarketOpen(),
+		SignalsToday: len(recommendations),
+	}
+	if userConfig != nil {
+		overview := h.server.Overview(r.Context(), userConfig, "")
+		data.TrackedSymbols = userConfig.TrackedSymbols
+		data.ActiveAlerts = overview.ActiveAlerts
+		data.Watchlist = watchlistSections(overview)
 	}
 
 	w.Header().Set(api.HEADER_CONTENT_TYPE, api.CONTENT_TYPE_HTML)
@@ -57,12 +51,19 @@ func (h *TemplHandlers) Dashboard(w http.ResponseWriter, r *http.Request) {
 // Analysis renders the analysis page using templ
 func (h *TemplHandlers) Analysis(w http.ResponseWriter, r *http.Request) {
 	symbol := strings.TrimPrefix(r.URL.Path, "/analysis/")
-	if symbol == "/analysis" || symbol == "" {
+	if symbol == "/analysis" {
 		symbol = ""
 	}
+	if symbol != "" {
+		var err error
+		if symbol, err = market.NormalizeSymbol(symbol); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	data := pages.AnalysisPageData{
-		Symbol: strings.ToUpper(symbol),
+		Symbol: symbol,
 	}
 
 	w.Header().Set(api.HEADER_CONTENT_TYPE, api.CONTENT_TYPE_HTML)
@@ -83,7 +84,7 @@ func (h *TemplHandlers) Alerts(w http.ResponseWriter, r *http.Request) {
 
 // Settings renders the settings page using templ
 func (h *TemplHandlers) Settings(w http.ResponseWriter, r *http.Request) {
-	config, _ := h.db.GetConfig()
+	config, _ := h.db.GetConfig(api.ProfileID(r.Context()))
 
 	data := pages.SettingsConfig{
 		MarketDataProvider: "yahoo",
@@ -96,6 +97,7 @@ func (h *TemplHandlers) Settings(w http.ResponseWriter, r *http.Request) {
 
 	if config != nil {
 		data.MarketDataProvider = config.MarketDataProvider
+		data.MarketDataFallback = config.MarketDataFallback
 		data.HasMarketAPIKey = config.HasMarketAPIKey
 		data.AIProvider = config.AIProvider
 		data.AIModel = config.AIModel
@@ -103,11 +105,15 @@ func (h *TemplHandlers) Settings(w http.ResponseWriter, r *http.Request) {
 		data.RiskTolerance = config.RiskTolerance
 		data.TradeFrequency = config.TradeFrequency
 		data.PollingInterval = config.PollingInterval
+		data.ExtendedHours = config.ExtendedHours
+		data.Version = config.Version
 		data.TrackedSymbols = config.TrackedSymbols
 		data.EmailAddress = config.EmailAddress
 		data.EmailEnabled = config.EmailEnabled
 		data.DiscordWebhook = config.DiscordWebhook
 		data.DiscordEnabled = config.DiscordEnabled
+		data.SlackWebhook = config.SlackWebhook
+		data.SlackEnabled = config.SlackEnabled
 		data.SMSPhone = config.SMSPhone
 		data.SMSEnabled = config.SMSEnabled
 	}
@@ -120,40 +126,57 @@ func (h *TemplHandlers) Settings(w http.ResponseWriter, r *http.Request) {
 
 // PartialWatchlist renders the watchlist partial
 func (h *TemplHandlers) PartialWatchlist(w http.ResponseWriter, r *http.Request) {
-	userConfig, _ := h.db.GetOrCreateConfig()
+	userConfig, _ := h.db.GetProfileConfig(api.ProfileID(r.Context()))
 
-	var stocks []pages.Stock
+	var sections []pages.WatchlistSection
 	if userConfig != nil && len(userConfig.TrackedSymbols) > 0 {
-		// Get the configured market data provider
-		provider, err := market.NewProvider(userConfig.MarketDataProvider, userConfig.MarketDataAPIKey)
-		if err != nil {
-			// Fallback to Yahoo Finance if provider creation fails
-			provider = market.NewYahooFinance()
-		}
-
-		for _, sym := range userConfig.TrackedSymbols {
-			stock := pages.Stock{
-				Symbol: sym,
-				Name:   sym + " Inc.",
-			}
+		sections = watchlistSections(h.server.Overview(r.Context(), userConfig, ""))
+	}
 
-			// Fetch real quote
-			quote, err := provider.GetQuote(r.Context(), sym)
-			if err == nil && quote != nil {
-				stock.Price = quote.Price
-				stock.ChangePercent = quote.ChangePercent
-			} else {
-				// Fallback to placeholder if quote fails
-				stock.Price = 0
-				stock.ChangePercent = 0
-			}
+	w.Header().Set(api.HEADER_CONTENT_TYPE, api.CONTENT_TYPE_HTML)
+	pages.WatchlistPartial(sections).Render(r.Context(), w)
+}
 
-			stocks = append(stocks, stock)
+// watchlistSections splits an overview's rows into its watchlist groups, in order. A
+// profile without groups gets one untitled section.
+func watchlistSections(overview *models.MarketOverview) []pages.WatchlistSection {
+	var sections []pages.WatchlistSection
+	for i, stock := range watchlistStocks(overview) {
+		group := overview.Symbols[i].Group
+		if len(sections) == 0 || sections[len(sections)-1].Name != group {
+			sections = append(sections, pages.WatchlistSection{Name: group})
 		}
+		last := &sections[len(sections)-1]
+		last.Stocks = append(last.Stocks, stock)
 	}
+	if len(sections) == 1 && sections[0].Name == models.UngroupedWatchlistGroup {
+		sections[0].Name = ""
+	}
+	return sections
+}
 
-	w.Header().Set(api.HEADER_CONTENT_TYPE, api.CONTENT_TYPE_HTML)
-	pages.WatchlistPartial(stocks).Render(r.Context(), w)
+// watchlistStocks converts an overview to watchlist rows; a symbol whose quote failed
+// shows a zero price
+func watchlistStocks(overview *models.MarketOverview) []pages.Stock {
+	stocks := make([]pages.Stock, 0, len(overview.Symbols))
+	for _, entry := range overview.Symbols {
+		stock := pages.Stock{
+			Symbol:    entry.Symbol,
+			Name:      entry.Symbol + " Inc.",
+			PriceText: market.FormatPrice(0, ""),
+		}
+		if entry.Quote != nil {
+			stock.Price = entry.Quote.Price
+			stock.PriceText = market.FormatPrice(entry.Quote.Price, entry.Quote.Currency)
+			stock.ChangePercent = entry.Quote.ChangePercent
+			if entry.Quote.ExtendedHoursPrice > 0 {
+				stock.ExtendedText = fmt.Sprintf("Ext. %s %+.2f%%", market.FormatPrice(entry.Quote.ExtendedHoursPrice, entry.Quote.Currency),
+					entry.Quote.ExtendedHoursChangePercent)
+			}
+		}
+		stocks = append(stocks, stock)
+	}
+	return stocks
 }
 
 // PartialRecommendations renders the recommendations partial
@@ -174,6 +197,10 @@ func (h *TemplHandlers) PartialRecommendations(w http.ResponseWriter, r *http.Re
 			Symbol:     rec.Symbol,
 			Action:     rec.Action,
 			Confidence: rec.Confidence,
+			Levels: ai.LevelSummary(rec.Symbol, rec.Action, models.PriceTargets{
+				Entry: rec.EntryPrice, Target: rec.TargetPrice, StopLoss: rec.StopLoss,
+			}, market.SymbolCurrency(rec.Symbol)),
+			Risks: rec.Risks,
 		}
 	}
 
@@ -202,6 +229,7 @@ func (h *TemplHandlers) PartialRecommendationsList(w http.ResponseWriter, r *htt
 			Action:      rec.Action,
 			Confidence:  rec.Confidence,
 			TargetPrice: rec.TargetPrice,
+			Currency:    market.SymbolCurrency(rec.Symbol),
 			AIProvider:  rec.AIProvider,
 			CreatedAt:   rec.CreatedAt,
 		}
@@ -211,17 +239,16 @@ func (h *TemplHandlers) PartialRecommendationsList(w http.ResponseWriter, r *htt
 	pages.RecommendationsListPartial(recs).Render(r.Context(), w)
 }
 
-// PartialAnalysisHistory renders the analysis history table
+// PartialAnalysisHistory renders the analysis history table, filtered and sorted
+// by the same query parameters as GET /api/analyses
 func (h *TemplHandlers) PartialAnalysisHistory(w http.ResponseWriter, r *http.Request) {
-	limitStr := r.URL.Query().Get("limit")
-	limit := 20
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
+	filter, err := api.ParseAnalysisFilter(r, 20)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	analysesRaw, _ := h.db.GetRecentAnalyses(limit)
+	analysesRaw, _ := h.db.FilterAnalyses(filter)
 
 	analyses := make([]pages.Analysis, len(analysesRaw))
 	for i, ar := range analysesRaw {
@@ -262,16 +289,21 @@ func (h *TemplHandlers) PartialAnalysisDetail(w http.ResponseWriter, r *http.Req
 		Symbol:     analysis.Symbol,
 		CreatedAt:  analysis.CreatedAt,
 		AIProvider: analysis.AIProvider,
+		Currency:   market.SymbolCurrency(analysis.Symbol),
 		Recommendation: pages.AnalysisRecommendation{
 			Action:      analysis.Recommendation.Action,
 			Confidence:  analysis.Recommendation.Confidence,
 			TargetPrice: analysis.Recommendation.TargetPrice,
 			StopLoss:    analysis.Recommendation.StopLoss,
 			Reasoning:   analysis.Recommendation.Reasoning,
+			Risks:       analysis.Recommendation.Risks,
 		},
 	}
 
 	if analysis.MarketData != nil {
+		if analysis.MarketData.Currency != "" {
+			result.Currency = analysis.MarketData.Currency
+		}
 		result.MarketData = &pages.MarketData{
 			Price:         analysis.MarketData.Price,
 			ChangePercent: analysis.MarketData.ChangePercent,
@@ -286,16 +318,22 @@ func (h *TemplHandlers) PartialAnalysisDetail(w http.ResponseWriter, r *http.Req
 
 // PartialAlertsList renders the alerts list
 func (h *TemplHandlers) PartialAlertsList(w http.ResponseWriter, r *http.Request) {
-	alertsRaw, _ := h.db.GetActiveAlerts()
+	var alertsRaw []models.PriceAlert
+	if userConfig, err := h.db.GetProfileConfig(api.ProfileID(r.Context())); err == nil {
+		alertsRaw, _ = h.db.GetActiveAlerts(userConfig.ID)
+	}
 
 	alerts := make([]pages.Alert, len(alertsRaw))
 	for i, ar := range alertsRaw {
 		alerts[i] = pages.Alert{
-			ID:          ar.ID,
-			Symbol:      ar.Symbol,
-			Condition:   ar.Condition,
-			TargetPrice: ar.Price,
-			Triggered:   ar.Triggered,
+			ID:             ar.ID,
+			Symbol:         ar.Symbol,
+			Condition:      ar.Condition,
+			TargetPrice:    ar.Price,
+			Currency:       market.SymbolCurrency(ar.Symbol),
+			Triggered:      ar.Triggered,
+			Percent:        ar.Percent,
+			VolumeMultiple: ar.VolumeMultiple,
 		}
 	}
 
@@ -305,7 +343,7 @@ func (h *TemplHandlers) PartialAlertsList(w http.ResponseWriter, r *http.Request
 
 // PartialQuickAnalyze renders quick analyze buttons
 func (h *TemplHandlers) PartialQuickAnalyze(w http.ResponseWriter, r *http.Request) {
-	config, _ := h.db.GetConfig()
+	config, _ := h.db.GetConfig(api.ProfileID(r.Context()))
 
 	var symbols []string
 	if config != nil {
@@ -316,9 +354,37 @@ func (h *TemplHandlers) PartialQuickAnalyze(w http.ResponseWriter, r *http.Reque
 	pages.QuickAnalyzePartial(symbols).Render(r.Context(), w)
 }
 
+// symbolSuggestionLimit caps the suggestions offered while typing a symbol
+const symbolSuggestionLimit = 8
+
+// PartialSymbolSearch renders the symbols matching what's typed into a symbol input,
+// sent as q or as the input's own symbol field, as datalist options
+func (h *TemplHandlers) PartialSymbolSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		query = strings.TrimSpace(r.URL.Query().Get("symbol"))
+	}
+
+	var suggestions []pages.SymbolSuggestion
+	if userConfig, err := h.db.GetProfileConfig(api.ProfileID(r.Context())); err == nil && query != "" {
+		if result, err := h.server.SearchSymbols(r.Context(), userConfig, query, symbolSuggestionLimit); err == nil {
+			for _, match := range result.Matches {
+				label := match.Name
+				if match.Exchange != "" {
+					label += " · " + match.Exchange
+				}
+				suggestions = append(suggestions, pages.SymbolSuggestion{Symbol: match.Symbol, Label: label})
+			}
+		}
+	}
+
+	w.Header().Set(api.HEADER_CONTENT_TYPE, api.CONTENT_TYPE_HTML)
+	pages.SymbolSuggestionsPartial(suggestions).Render(r.Context(), w)
+}
+
 // PartialWatchlistAlertButtons renders watchlist buttons for alerts page
 func (h *TemplHandlers) PartialWatchlistAlertButtons(w http.ResponseWriter, r *http.Request) {
-	config, _ := h.db.GetConfig()
+	config, _ := h.db.GetConfig(api.ProfileID(r.Context()))
 
 	var symbols []string
 	if config != nil {
@@ -344,5 +410,5 @@ func formatVolume(vol int64) string {
 }
 
 func isMarketOpen() bool {
-	return nyseCalendar.IsOpen(time.Now().In(estLocation))
+	return market.IsMarketOpen(time.Now(), market.DefaultExchange)
 }